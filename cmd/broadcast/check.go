@@ -0,0 +1,149 @@
+package broadcast
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+const (
+	checkConfigFlagName = "check-config"
+
+	redacted = "redacted"
+)
+
+// secretKeys are substrings of keys of flags whose values are secrets.
+var secretKeys = []string{"password", "credential", "secret", "token", "signing_key"}
+
+// checkConfig prints the effective config of flags loaded from the config file and command line to w, with secrets
+// redacted, then validates config. Options set by configure of embedders are validated but not printed.
+func checkConfig(w io.Writer, c *cli.Context, flags []cli.Flag, config *cfg.ConfigOptions) error {
+	if err := printConfig(w, c, flags); err != nil {
+		return err
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w, "# config is valid")
+	return err
+}
+
+// printConfig prints values of flags as TOML of the config file, sections in order of their first flag.
+func printConfig(w io.Writer, c *cli.Context, flags []cli.Flag) error {
+	var sections []string
+	lines := make(map[string][]string)
+	for _, f := range flags {
+		name := f.Names()[0]
+		i := strings.Index(name, ".")
+		if i < 0 {
+			continue // Not loaded from the config file, e.g. config.
+		}
+		section, key := name[:i], name[i+1:]
+		if _, ok := lines[section]; !ok {
+			sections = append(sections, section)
+		}
+		lines[section] = append(lines[section], key+" = "+tomlValue(key, c.Value(name)))
+	}
+	for i, section := range sections {
+		if i > 0 {
+			if _, err := fmt.Fprintln(w); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "[%s]\n%s\n", section, strings.Join(lines[section], "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tomlValue returns v of key in TOML with secrets redacted.
+func tomlValue(key string, v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(redact(key, v))
+	case time.Duration:
+		return strconv.Quote(v.String())
+	case cli.StringSlice:
+		values := make([]string, 0, len(v.Value()))
+		for _, s := range v.Value() {
+			values = append(values, strconv.Quote(redact(key, s)))
+		}
+		return "[" + strings.Join(values, ", ") + "]"
+	case float64:
+		f := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(f, ".eIN") {
+			f += ".0"
+		}
+		return f
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// redact returns s of key with secrets redacted: values of secret keys, credentials of ICE servers, values of
+// headers, and passwords and secret query parameters of URLs, including those of "tenant=URL" sinks.
+func redact(key, s string) string {
+	if s == "" {
+		return s
+	}
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return redacted
+		}
+	}
+	switch key {
+	case "ice_servers":
+		if i := strings.LastIndex(s, "@"); i >= 0 {
+			if j := strings.Index(s[:i], ":"); j >= 0 {
+				return s[:j+1] + redacted + s[i:]
+			}
+		}
+	case "headers":
+		if i := strings.Index(s, "="); i >= 0 {
+			return s[:i+1] + redacted
+		}
+	case "sinks":
+		// Recording sinks are in form of "tenant=URL", unlike URLs of audit sinks, whose queries have "=".
+		if i := strings.Index(s, "="); i >= 0 && !strings.ContainsAny(s[:i], "/:?") {
+			return s[:i+1] + redactURL(s[i+1:])
+		}
+	}
+	return redactURL(s)
+}
+
+// redactURL returns s with its password and values of secret query parameters redacted if it's a URL.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return s
+	}
+	redactedURL := false
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+			redactedURL = true
+		}
+	}
+	query := u.Query()
+	for name := range query {
+		for _, secret := range secretKeys {
+			if strings.Contains(strings.ToLower(name), secret) {
+				query.Set(name, redacted)
+				u.RawQuery = query.Encode()
+				redactedURL = true
+			}
+		}
+	}
+	if !redactedURL {
+		return s
+	}
+	return u.String()
+}
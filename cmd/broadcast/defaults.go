@@ -0,0 +1,62 @@
+package broadcast
+
+import (
+	"flag"
+	"io"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// DefaultConfig returns options of the broadcast service by defaults of flags, as if no flag is set and no config
+// file is loaded, e.g. to run the service in process. Options of slice flags are empty.
+func DefaultConfig() (*cfg.ConfigOptions, error) {
+	var config cfg.ConfigOptions
+	set := flag.NewFlagSet("broadcast", flag.ContinueOnError)
+	set.SetOutput(io.Discard)
+	for _, flags := range [][]cli.Flag{
+		MQTTClientFlags(&config.MQTTClientConfigOptions),
+		webRTCFlags(&config.WebRTCConfigOptions),
+		serverFlags(&config.ServerConfigOptions),
+		sessionFlags(&config.SessionConfigOptions),
+		quotaFlags(&config.QuotaConfigOptions),
+		recordingFlags(&config.RecordingConfigOptions),
+		metricsFlags(&config.MetricsConfigOptions),
+		authFlags(&config.AuthConfigOptions),
+		standbyFlags(&config.StandbyConfigOptions),
+		sloFlags(&config.SLOConfigOptions),
+		subscriberMQTTFlags(&config.SubscriberMQTTConfigOptions),
+		qualityFlags(&config.QualityConfigOptions),
+		canaryFlags(&config.CanaryConfigOptions),
+		hlsFlags(&config.HLSConfigOptions),
+		directoryFlags(&config.DirectoryConfigOptions),
+		rtspFlags(&config.RTSPConfigOptions),
+		srtFlags(&config.SRTConfigOptions),
+		rtmpFlags(&config.RTMPConfigOptions),
+		whipFlags(&config.WHIPConfigOptions),
+		healthFlags(&config.HealthConfigOptions),
+		adminFlags(&config.AdminConfigOptions),
+		edgeSignalFlags(&config.EdgeSignalConfigOptions),
+		aclFlags(&config.ACLConfigOptions),
+		rateLimitFlags(&config.RateLimitConfigOptions),
+		clusterFlags(&config.ClusterConfigOptions),
+		auditFlags(&config.AuditConfigOptions),
+		webhookFlags(&config.WebhookConfigOptions),
+		demoFlags(&config.DemoConfigOptions),
+		recoveryFlags(&config.RecoveryConfigOptions),
+		thumbnailFlags(&config.ThumbnailConfigOptions),
+		tracingFlags(&config.TracingConfigOptions),
+		tenantFlags(&config.TenantConfigOptions),
+		accountingFlags(&config.AccountingConfigOptions),
+		shareFlags(&config.ShareConfigOptions),
+	} {
+		// Applying a flag sets its destination to the default value.
+		for _, f := range flags {
+			if err := f.Apply(set); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &config, nil
+}
@@ -0,0 +1,252 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/SB-IM/logging"
+	mqttclient "github.com/SB-IM/mqtt-client"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/SB-IM/skywalker/internal/broadcast"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/mqttx"
+)
+
+// reloadableOptions are options of config file applied on SIGHUP, changes of others take effect after restart.
+var reloadableOptions = map[string]bool{
+	"mqtt.username":                true,
+	"mqtt.password":                true,
+	"mqtt.ca_cert":                 true,
+	"mqtt.client_cert":             true,
+	"mqtt.client_key":              true,
+	"webrtc.ice_server":            true,
+	"webrtc.ice_server_username":   true,
+	"webrtc.ice_server_credential": true,
+	"webrtc.ice_servers":           true,
+	"acl.rules":                    true,
+	"acl.timeout":                  true,
+	"log.level":                    true,
+}
+
+// reload reloads config file on every SIGHUP. Options safe to change at runtime, i.e. ICE servers, ACL and log level,
+// are applied to svc, and changed options requiring restart are logged.
+// MQTT client is reconnected if credentials or TLS files changed, so that scheduled credential rotation doesn't
+// interrupt live sessions. Reloaded ones are proven by a probe connection first, and previous ones are kept if the
+// broker rejects them.
+func reload(
+	ctx context.Context,
+	logger *zerolog.Logger,
+	svc *broadcast.Service,
+	mc mqtt.Client,
+	path string,
+	flags []cli.Flag,
+	debug bool,
+	config cfg.ConfigOptions,
+	options mqttclient.ConfigOptions,
+	connOptions cfg.MQTTConnConfigOptions,
+) {
+	last, err := fileValues(path, flags)
+	if err != nil {
+		logger.Err(err).Msg("could not load config file, changed options requiring restart are not reported")
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGHUP)
+	for range sigs {
+		logger.Info().Str("config", path).Msg("reloading config")
+		values, err := fileValues(path, flags)
+		if err != nil {
+			logger.Err(err).Msg("could not reload config")
+			continue
+		}
+		if last != nil {
+			for _, name := range changedOptions(last, values) {
+				if !reloadableOptions[name] {
+					logger.Warn().Str("option", name).Msg("option changed, restart to apply it")
+				}
+			}
+		}
+		last = values
+
+		// Everything is validated before any option is applied, so a failed reload changes nothing.
+		updated, err := reloadedConfig(values, config)
+		if err != nil {
+			logger.Err(err).Msg("could not apply reloaded config")
+			continue
+		}
+		if err := svc.Reload(&updated); err != nil {
+			logger.Err(err).Msg("could not apply reloaded config")
+			continue
+		}
+		config = updated
+		level, _ := values["log.level"].(string)
+		if err := setLogLevel(level, debug); err != nil {
+			logger.Err(err).Msg("could not apply reloaded log level")
+		}
+
+		reloaded, reloadedConn := options, connOptions
+		reloaded.Username, _ = values["mqtt.username"].(string)
+		reloaded.Password, _ = values["mqtt.password"].(string)
+		reloadedConn.CACert, _ = values["mqtt.ca_cert"].(string)
+		reloadedConn.ClientCert, _ = values["mqtt.client_cert"].(string)
+		reloadedConn.ClientKey, _ = values["mqtt.client_key"].(string)
+		if reloaded.Username == options.Username && reloaded.Password == options.Password && reloadedConn == connOptions {
+			continue
+		}
+
+		// The broker kicks one of two connections sharing a client ID, so reloaded credentials are proven by
+		// a probe of another client ID while the old client keeps serving live sessions.
+		probe := reloaded
+		probe.ClientID += mqttReloadProbeSuffix
+		pc, err := mqttx.Connect(ctx, probe, reloadedConn, mqttConnectTimeout)
+		if err != nil {
+			logger.Err(err).Msg("could not connect to MQTT broker with reloaded credentials, keeping previous ones")
+			continue
+		}
+		pc.Disconnect(mqttDisconnectQuiesce)
+
+		logger.Info().Msg("reconnecting to MQTT broker with reloaded credentials")
+		// Old client must be disconnected first, as the broker kicks one of two connections sharing a client ID.
+		mc.Disconnect(mqttDisconnectQuiesce)
+		next, err := mqttx.Connect(ctx, reloaded, reloadedConn, mqttConnectTimeout)
+		if err != nil {
+			logger.Err(err).Msg("could not connect to MQTT broker with reloaded credentials, falling back to previous ones")
+			// The client keeps reconnecting in background.
+			if next, err = mqttx.NewClient(ctx, options, connOptions); err != nil {
+				logger.Err(err).Msg("could not reconnect to MQTT broker with previous credentials")
+				continue
+			}
+		} else {
+			options, connOptions = reloaded, reloadedConn
+		}
+		mc = next
+		svc.SetClient(mc)
+	}
+}
+
+// fileValues returns values of flags in config file at path by flag name. An option absent from the file means
+// the default of the flag, while a zero one is reloaded as is, e.g. to clear MQTT credentials or ICE servers.
+func fileValues(path string, flags []cli.Flag) (map[string]interface{}, error) {
+	isc, err := altsrc.NewTomlSourceFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not load config file: %w", err)
+	}
+	// isc reads absent options as zero values, so which ones are set is told by metadata of the file.
+	md, err := toml.DecodeFile(path, &map[string]interface{}{})
+	if err != nil {
+		return nil, fmt.Errorf("could not load config file: %w", err)
+	}
+	values := make(map[string]interface{}, len(flags))
+	for _, flag := range flags {
+		var (
+			name  = flag.Names()[0]
+			set   = md.IsDefined(strings.Split(name, ".")...)
+			value interface{}
+			err   error
+		)
+		switch f := flag.(type) {
+		case *altsrc.StringFlag:
+			value = f.Value
+			if set {
+				value, err = isc.String(name)
+			}
+		case *altsrc.BoolFlag:
+			value = f.Value
+			if set {
+				value, err = isc.Bool(name)
+			}
+		case *altsrc.IntFlag:
+			value = f.Value
+			if set {
+				value, err = isc.Int(name)
+			}
+		case *altsrc.Float64Flag:
+			value = f.Value
+			if set {
+				value, err = isc.Float64(name)
+			}
+		case *altsrc.DurationFlag:
+			value = f.Value
+			if set {
+				value, err = isc.Duration(name)
+			}
+		case *altsrc.StringSliceFlag:
+			var v []string
+			if f.Value != nil {
+				v = f.Value.Value()
+			}
+			if set {
+				v, err = isc.StringSlice(name)
+			}
+			value = v
+		default:
+			// Other flags are not loaded from config file.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read %s: %w", name, err)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// changedOptions returns names of options whose values differ, in order.
+func changedOptions(old, new map[string]interface{}) []string {
+	var names []string
+	for name, value := range new {
+		if !reflect.DeepEqual(old[name], value) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reloadedConfig returns config with reloadable options of values, it returns an error if any of them is invalid.
+func reloadedConfig(values map[string]interface{}, config cfg.ConfigOptions) (cfg.ConfigOptions, error) {
+	iceServers, _ := values["webrtc.ice_servers"].([]string)
+	servers, err := parseICEServers(iceServers)
+	if err != nil {
+		return config, err
+	}
+	if level, _ := values["log.level"].(string); level != "" {
+		if _, err := zerolog.ParseLevel(level); err != nil {
+			return config, fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+	config.ICEServer, _ = values["webrtc.ice_server"].(string)
+	config.Username, _ = values["webrtc.ice_server_username"].(string)
+	config.Credential, _ = values["webrtc.ice_server_credential"].(string)
+	config.ICEServers = servers
+	config.ACL, _ = values["acl.rules"].(string)
+	config.ACLTimeout, _ = values["acl.timeout"].(time.Duration)
+	return config, nil
+}
+
+// setLogLevel sets default log level of components, empty level means debug or info by debug.
+// Levels of components set by admin API are kept.
+func setLogLevel(level string, debug bool) error {
+	logging.Debug(debug)
+	l := zerolog.GlobalLevel()
+	if level != "" {
+		var err error
+		if l, err = zerolog.ParseLevel(level); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", level, err)
+		}
+	}
+	loglevel.Default.SetDefault(l)
+	return nil
+}
@@ -0,0 +1,96 @@
+package broadcast
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+)
+
+func TestFileValues(t *testing.T) {
+	flags := []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "mqtt.username", Value: "skywalker"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "mqtt.password", Value: "secret"}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{Name: "hls.enable", Value: true}),
+		altsrc.NewIntFlag(&cli.IntFlag{Name: "quota.daily_egress_mb", Value: 1024}),
+		altsrc.NewFloat64Flag(&cli.Float64Flag{Name: "slo.target", Value: 0.99}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{Name: "acl.timeout", Value: time.Second}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "webrtc.ice_servers", Value: cli.NewStringSlice("stun:stun.l.google.com:19302")}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "signal_server.allowed_origins", Value: cli.NewStringSlice("*")}),
+	}
+	tests := []struct {
+		name string
+		file string
+		want map[string]interface{}
+	}{
+		{
+			name: "absent options are defaults",
+			file: "[mqtt]\nusername = \"drone\"\n",
+			want: map[string]interface{}{
+				"mqtt.username":                 "drone",
+				"mqtt.password":                 "secret",
+				"hls.enable":                    true,
+				"quota.daily_egress_mb":         1024,
+				"slo.target":                    0.99,
+				"acl.timeout":                   time.Second,
+				"webrtc.ice_servers":            []string{"stun:stun.l.google.com:19302"},
+				"signal_server.allowed_origins": []string{"*"},
+			},
+		},
+		{
+			name: "zero options are reloaded as is",
+			file: `
+[mqtt]
+username = ""
+password = ""
+
+[hls]
+enable = false
+
+[quota]
+daily_egress_mb = 0
+
+[slo]
+target = 0.0
+
+[acl]
+timeout = "0s"
+
+[signal_server]
+allowed_origins = []
+
+[webrtc]
+ice_servers = []
+`,
+			want: map[string]interface{}{
+				"mqtt.username":                 "",
+				"mqtt.password":                 "",
+				"hls.enable":                    false,
+				"quota.daily_egress_mb":         0,
+				"slo.target":                    0.0,
+				"acl.timeout":                   time.Duration(0),
+				"webrtc.ice_servers":            []string{},
+				"signal_server.allowed_origins": []string{},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := fileValues(path, flags)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fileValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,9 @@
+//go:build broadcastctl
+
+package main
+
+import "github.com/SB-IM/skywalker/cmd/broadcastctl"
+
+func init() {
+	commands = append(commands, broadcastctl.Command())
+}
@@ -0,0 +1,269 @@
+package broadcastctl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/SB-IM/skywalker/internal/broadcastctl"
+)
+
+const configFlagName = "config"
+
+// Command returns a broadcastctl command, which calls the admin API of a broadcast instance on behalf of operators,
+// so they don't have to curl JSON endpoints during incidents. Responses are printed in JSON.
+func Command() *cli.Command {
+	var (
+		options broadcastctl.ConfigOptions
+		client  *broadcastctl.Client
+	)
+
+	flags := func() (flags []cli.Flag) {
+		for _, v := range [][]cli.Flag{
+			loadConfigFlag(),
+			broadcastctlFlags(&options),
+		} {
+			flags = append(flags, v...)
+		}
+		return
+	}()
+
+	return &cli.Command{
+		Name:  "broadcastctl",
+		Usage: "operate a broadcast instance by its admin API",
+		Flags: flags,
+		Before: func(c *cli.Context) error {
+			if err := altsrc.InitInputSourceWithContext(
+				flags,
+				altsrc.NewTomlSourceFromFlagFunc(configFlagName),
+			)(c); err != nil {
+				return err
+			}
+			var err error
+			client, err = broadcastctl.New(options)
+			return err
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:  "streams",
+				Usage: "list live streams with ingest stats",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "tenant",
+						Usage: "List streams of the tenant only",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					return printJSON(client.Streams(c.Context, c.String("tenant")))
+				},
+			},
+			{
+				Name:  "accounting",
+				Usage: "report viewer egress bytes per interval",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "from", Usage: "Start of report in RFC 3339, e.g. 2021-10-01T00:00:00Z"},
+					&cli.StringFlag{Name: "to", Usage: "End of report in RFC 3339, exclusive"},
+					&cli.StringFlag{Name: "group", Usage: "Group rows by session, machine or subject", Value: "session"},
+				},
+				Action: func(c *cli.Context) error {
+					query := url.Values{}
+					for _, name := range []string{"from", "to", "group"} {
+						if v := c.String(name); v != "" {
+							query.Set(name, v)
+						}
+					}
+					return printJSON(client.Accounting(c.Context, query))
+				},
+			},
+			{
+				Name:  "tenants",
+				Usage: "list concurrent streams and viewers of tenants with their limits",
+				Action: func(c *cli.Context) error {
+					return printJSON(client.Tenants(c.Context))
+				},
+			},
+			{
+				Name:      "stats",
+				Usage:     "show ingest stats of a stream",
+				ArgsUsage: "<id> <track_source>",
+				Action: func(c *cli.Context) error {
+					meta, err := streamArgs(c)
+					if err != nil {
+						return err
+					}
+					return printJSON(client.Stats(c.Context, meta))
+				},
+			},
+			{
+				Name:      "close",
+				Usage:     "close a stream and its viewers, or all streams of a machine if track source is omitted",
+				ArgsUsage: "<id> [track_source]",
+				Action: func(c *cli.Context) error {
+					if c.NArg() < 1 {
+						return cli.Exit("machine id is required", 2)
+					}
+					trackSource := -1
+					if c.NArg() > 1 {
+						n, err := strconv.Atoi(c.Args().Get(1))
+						if err != nil || n < 0 {
+							return cli.Exit("invalid track source", 2)
+						}
+						trackSource = n
+					}
+					return printJSON(client.CloseSession(c.Context, c.Args().First(), trackSource))
+				},
+			},
+			{
+				Name:      "kick",
+				Usage:     "close a subscriber peer connection",
+				ArgsUsage: "<peer_id>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						return cli.Exit("peer id is required", 2)
+					}
+					return client.Kick(c.Context, c.Args().First())
+				},
+			},
+			{
+				Name:      "keyframe",
+				Usage:     "ask edge of a stream for a keyframe",
+				ArgsUsage: "<id> <track_source>",
+				Action: func(c *cli.Context) error {
+					meta, err := streamArgs(c)
+					if err != nil {
+						return err
+					}
+					return client.Keyframe(c.Context, meta)
+				},
+			},
+			{
+				Name:  "record",
+				Usage: "list, start or stop recordings",
+				Subcommands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "list recordings",
+						Action: func(c *cli.Context) error {
+							return printJSON(client.Recordings(c.Context))
+						},
+					},
+					{
+						Name:      "start",
+						Usage:     "start recording a stream",
+						ArgsUsage: "<id> <track_source>",
+						Action: func(c *cli.Context) error {
+							meta, err := streamArgs(c)
+							if err != nil {
+								return err
+							}
+							return printJSON(client.StartRecording(c.Context, meta))
+						},
+					},
+					{
+						Name:      "stop",
+						Usage:     "stop recording a stream",
+						ArgsUsage: "<id> <track_source>",
+						Action: func(c *cli.Context) error {
+							meta, err := streamArgs(c)
+							if err != nil {
+								return err
+							}
+							return printJSON(client.StopRecording(c.Context, meta))
+						},
+					},
+				},
+			},
+			{
+				Name:      "loglevel",
+				Usage:     "list log levels of components, or set one of a component, an empty level resets it",
+				ArgsUsage: "[component level]",
+				Action: func(c *cli.Context) error {
+					switch c.NArg() {
+					case 0:
+						return printJSON(client.LogLevels(c.Context))
+					case 2:
+						return printJSON(client.SetLogLevel(c.Context, c.Args().Get(0), c.Args().Get(1)))
+					default:
+						return cli.Exit("component and level are required to set log level", 2)
+					}
+				},
+			},
+		},
+	}
+}
+
+// streamArgs parses "<id> <track_source>" arguments.
+func streamArgs(c *cli.Context) (*pb.Meta, error) {
+	if c.NArg() != 2 {
+		return nil, cli.Exit("machine id and track source are required", 2)
+	}
+	n, err := strconv.Atoi(c.Args().Get(1))
+	if err != nil || n < 0 {
+		return nil, cli.Exit("invalid track source", 2)
+	}
+	return &pb.Meta{Id: c.Args().Get(0), TrackSource: pb.TrackSource(n)}, nil
+}
+
+// printJSON prints an admin API response in indented JSON.
+func printJSON(v json.RawMessage, err error) error {
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("could not print response: %w", err)
+	}
+	return nil
+}
+
+// loadConfigFlag sets a config file path for app command.
+func loadConfigFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        configFlagName,
+			Aliases:     []string{"c"},
+			Usage:       "Config file path",
+			Value:       "config/config.toml",
+			DefaultText: "config/config.toml",
+		},
+	}
+}
+
+func broadcastctlFlags(options *broadcastctl.ConfigOptions) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "broadcastctl.url",
+			Usage:       "Base URL of the broadcast instance",
+			Value:       "http://localhost:8080",
+			DefaultText: "http://localhost:8080",
+			EnvVars:     []string{"BROADCASTCTL_URL"},
+			Destination: &options.URL,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "broadcastctl.token",
+			Usage:       "Admin token of the instance, see admin.token",
+			Value:       "",
+			DefaultText: "",
+			EnvVars:     []string{"BROADCASTCTL_TOKEN"},
+			Destination: &options.Token,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "broadcastctl.timeout",
+			Usage:       "Timeout of an admin API request",
+			Value:       10 * time.Second,
+			DefaultText: "10s",
+			Destination: &options.Timeout,
+		}),
+	}
+}
@@ -0,0 +1,9 @@
+//go:build edge
+
+package main
+
+import "github.com/SB-IM/skywalker/cmd/edge"
+
+func init() {
+	commands = append(commands, edge.Command())
+}
@@ -0,0 +1,195 @@
+package edge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/SB-IM/logging"
+	mqttclient "github.com/SB-IM/mqtt-client"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/SB-IM/skywalker/cmd/broadcast"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/mqttx"
+	"github.com/SB-IM/skywalker/internal/edge"
+)
+
+const (
+	configFlagName = "config"
+
+	mqttConnectTimeout = 3 * time.Second
+	// mqttDisconnectQuiesce is the time in milliseconds waiting for existing MQTT work to be completed.
+	mqttDisconnectQuiesce = 250
+)
+
+// Command returns an edge command, which publishes a local video file or RTP over UDP to a broadcast instance
+// as a Sphinx edge does, for testing without real drones.
+func Command() *cli.Command {
+	var (
+		logger zerolog.Logger
+		mc     mqtt.Client
+
+		mqttConfigOptions       mqttclient.ConfigOptions
+		mqttConnConfigOptions   cfg.MQTTConnConfigOptions
+		mqttClientConfigOptions cfg.MQTTClientConfigOptions
+		edgeConfigOptions       edge.ConfigOptions
+	)
+
+	flags := func() (flags []cli.Flag) {
+		for _, v := range [][]cli.Flag{
+			loadConfigFlag(),
+			broadcast.MQTTFlags(&mqttConfigOptions),
+			broadcast.MQTTConnFlags(&mqttConnConfigOptions),
+			broadcast.MQTTClientFlags(&mqttClientConfigOptions),
+			edgeFlags(&edgeConfigOptions),
+		} {
+			flags = append(flags, v...)
+		}
+		return
+	}()
+
+	return &cli.Command{
+		Name:  "edge",
+		Usage: "publish a video file or RTP over UDP as a synthetic Sphinx edge",
+		Flags: flags,
+		Before: func(c *cli.Context) error {
+			if err := altsrc.InitInputSourceWithContext(
+				flags,
+				altsrc.NewTomlSourceFromFlagFunc(configFlagName),
+			)(c); err != nil {
+				return err
+			}
+			// Client ID of broadcast is taken by default, which the broker would kick off.
+			if !c.IsSet("mqtt.clientID") {
+				mqttConfigOptions.ClientID = fmt.Sprintf("skywalker_edge_%d", os.Getpid())
+			}
+
+			// Set up logger.
+			debug := c.Bool("debug")
+			logging.Debug(debug)
+			logger = log.With().Str("service", "skywalker").Str("command", "edge").Logger()
+
+			client, err := mqttx.Connect(logger.WithContext(context.Background()), mqttConfigOptions, mqttConnConfigOptions, mqttConnectTimeout)
+			if err != nil {
+				return err
+			}
+			mc = client
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			e, err := edge.New(mc, &logger, mqttClientConfigOptions, edgeConfigOptions)
+			if err != nil {
+				return err
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			e.Run(ctx)
+			return nil
+		},
+		After: func(c *cli.Context) error {
+			if mc != nil {
+				mc.Disconnect(mqttDisconnectQuiesce)
+			}
+			logger.Info().Msg("exits")
+			return nil
+		},
+	}
+}
+
+// loadConfigFlag sets a config file path for app command.
+// Note: you can't set any other flags' `Required` value to `true`,
+// As it conflicts with this flag. You can set only either this flag or specifically the other flags but not both.
+func loadConfigFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        configFlagName,
+			Aliases:     []string{"c"},
+			Usage:       "Config file path",
+			Value:       "config/config.toml",
+			DefaultText: "config/config.toml",
+		},
+	}
+}
+
+func edgeFlags(options *edge.ConfigOptions) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "edge.id",
+			Usage:       "Machine ID of the synthetic edge, edges are suffixed by -n if count > 1",
+			Value:       "synthetic_edge",
+			DefaultText: "synthetic_edge",
+			Destination: &options.ID,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:        "edge.track_source",
+			Usage:       "Track source of the stream",
+			Value:       0,
+			DefaultText: "0",
+			Destination: &options.TrackSource,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:        "edge.count",
+			Usage:       "Synthetic edges publishing the same file, e.g. for load tests",
+			Value:       1,
+			DefaultText: "1",
+			Destination: &options.Count,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "edge.source",
+			Usage:       "H264 Annex B (.h264) or IVF (.ivf) file, or udp://host:port receiving RTP",
+			Value:       "",
+			DefaultText: "",
+			Destination: &options.Source,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "edge.codec",
+			Usage:       "Codec of RTP received by UDP source, h264, vp8 or vp9",
+			Value:       "h264",
+			DefaultText: "h264",
+			Destination: &options.Codec,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:        "edge.fps",
+			Usage:       "Frame rate of H264 files, IVF files carry their own",
+			Value:       30,
+			DefaultText: "30",
+			Destination: &options.FPS,
+		}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{
+			Name:        "edge.loop",
+			Usage:       "Replay files from the start at EOF",
+			Value:       true,
+			DefaultText: "true",
+			Destination: &options.Loop,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "edge.ice_server",
+			Usage:       "STUN or TURN server of the synthetic edge, empty uses host candidates only",
+			Value:       "",
+			DefaultText: "",
+			Destination: &options.ICEServer,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "edge.signal_timeout",
+			Usage:       "Max time of offer/answer exchange until ICE connects",
+			Value:       10 * time.Second,
+			DefaultText: "10s",
+			Destination: &options.SignalTimeout,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "edge.retry_interval",
+			Usage:       "Interval of offering again after the peer connection is gone",
+			Value:       5 * time.Second,
+			DefaultText: "5s",
+			Destination: &options.RetryInterval,
+		}),
+	}
+}
@@ -0,0 +1,9 @@
+//go:build loadtest
+
+package main
+
+import "github.com/SB-IM/skywalker/cmd/loadtest"
+
+func init() {
+	commands = append(commands, loadtest.Command())
+}
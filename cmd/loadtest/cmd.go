@@ -0,0 +1,157 @@
+package loadtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/SB-IM/logging"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/SB-IM/skywalker/internal/loadtest"
+)
+
+const configFlagName = "config"
+
+// Command returns a loadtest command, which runs many WebSocket subscribers of a stream against a broadcast
+// instance and prints their setup time and packet loss in JSON.
+func Command() *cli.Command {
+	var (
+		logger                zerolog.Logger
+		loadtestConfigOptions loadtest.ConfigOptions
+	)
+
+	flags := func() (flags []cli.Flag) {
+		for _, v := range [][]cli.Flag{
+			loadConfigFlag(),
+			loadtestFlags(&loadtestConfigOptions),
+		} {
+			flags = append(flags, v...)
+		}
+		return
+	}()
+
+	return &cli.Command{
+		Name:  "loadtest",
+		Usage: "load test subscriber connections of a broadcast instance",
+		Flags: flags,
+		Before: func(c *cli.Context) error {
+			if err := altsrc.InitInputSourceWithContext(
+				flags,
+				altsrc.NewTomlSourceFromFlagFunc(configFlagName),
+			)(c); err != nil {
+				return err
+			}
+
+			// Set up logger.
+			debug := c.Bool("debug")
+			logging.Debug(debug)
+			logger = log.With().Str("service", "skywalker").Str("command", "loadtest").Logger()
+			return nil
+		},
+		Action: func(c *cli.Context) error {
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+			report, err := loadtest.Run(ctx, &logger, loadtestConfigOptions)
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(report); err != nil {
+				return err
+			}
+			if report.Succeeded == 0 {
+				return errors.New("no client received video")
+			}
+			return nil
+		},
+		After: func(c *cli.Context) error {
+			logger.Info().Msg("exits")
+			return nil
+		},
+	}
+}
+
+// loadConfigFlag sets a config file path for app command.
+// Note: you can't set any other flags' `Required` value to `true`,
+// As it conflicts with this flag. You can set only either this flag or specifically the other flags but not both.
+func loadConfigFlag() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        configFlagName,
+			Aliases:     []string{"c"},
+			Usage:       "Config file path",
+			Value:       "config/config.toml",
+			DefaultText: "config/config.toml",
+		},
+	}
+}
+
+func loadtestFlags(options *loadtest.ConfigOptions) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "loadtest.url",
+			Usage:       "Base URL of the broadcast instance, e.g. wss://eu.example.com",
+			Value:       "ws://localhost:8080",
+			DefaultText: "ws://localhost:8080",
+			Destination: &options.URL,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "loadtest.token",
+			Usage:       "Subscriber JWT, empty if the instance doesn't authenticate",
+			Value:       "",
+			DefaultText: "",
+			Destination: &options.Token,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "loadtest.id",
+			Usage:       "Machine ID of the stream subscribed",
+			Value:       "synthetic_edge",
+			DefaultText: "synthetic_edge",
+			Destination: &options.ID,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:        "loadtest.track_source",
+			Usage:       "Track source of the stream subscribed",
+			Value:       0,
+			DefaultText: "0",
+			Destination: &options.TrackSource,
+		}),
+		altsrc.NewIntFlag(&cli.IntFlag{
+			Name:        "loadtest.clients",
+			Usage:       "Concurrent subscriber clients",
+			Value:       100,
+			DefaultText: "100",
+			Destination: &options.Clients,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "loadtest.ramp_up",
+			Usage:       "Clients are started evenly over ramp_up, 0 starts them at once",
+			Value:       10 * time.Second,
+			DefaultText: "10s",
+			Destination: &options.RampUp,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "loadtest.duration",
+			Usage:       "Time each client receives RTP after its first video packet",
+			Value:       30 * time.Second,
+			DefaultText: "30s",
+			Destination: &options.Duration,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "loadtest.signal_timeout",
+			Usage:       "Max time from offer to the first video packet of a client",
+			Value:       10 * time.Second,
+			DefaultText: "10s",
+			Destination: &options.SignalTimeout,
+		}),
+	}
+}
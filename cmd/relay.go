@@ -0,0 +1,9 @@
+//go:build relay
+
+package main
+
+import "github.com/SB-IM/skywalker/cmd/relay"
+
+func init() {
+	commands = append(commands, relay.Command())
+}
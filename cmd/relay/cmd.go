@@ -0,0 +1,69 @@
+package relay
+
+import (
+	"errors"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"github.com/urfave/cli/v2/altsrc"
+
+	"github.com/SB-IM/skywalker/cmd/broadcast"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// Command returns a relay command, which runs broadcast as an edge of an origin/edge cascade:
+// live streams of the upstream instance are subscribed over WebRTC and republished to viewers here.
+func Command() *cli.Command {
+	var options cfg.CascadeConfigOptions
+	return broadcast.NewCommand(
+		"relay",
+		"relay live streams of an upstream skywalker to users",
+		flags(&options),
+		func(c *cli.Context, config *cfg.ConfigOptions) error {
+			if options.Upstream == "" {
+				return errors.New("missing relay.upstream")
+			}
+			// Slice flags have no destination.
+			options.CascadeMachines = c.StringSlice("relay.machines")
+			config.CascadeConfigOptions = options
+			return nil
+		},
+	)
+}
+
+func flags(options *cfg.CascadeConfigOptions) []cli.Flag {
+	return []cli.Flag{
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "relay.upstream",
+			Usage:       "Base URL of the upstream skywalker whose streams are relayed, e.g. https://origin.example.com",
+			Value:       "",
+			DefaultText: "",
+			Destination: &options.Upstream,
+		}),
+		altsrc.NewStringFlag(&cli.StringFlag{
+			Name:        "relay.token",
+			Usage:       "Subscriber JWT of upstream, empty if upstream doesn't authenticate",
+			Value:       "",
+			DefaultText: "",
+			Destination: &options.UpstreamToken,
+		}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{
+			Name:  "relay.machines",
+			Usage: `Edge device IDs relayed, "*" or empty relays all, "prefix*" matches by prefix`,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "relay.poll_interval",
+			Usage:       "Interval of listing live streams of upstream",
+			Value:       5 * time.Second,
+			DefaultText: "5s",
+			Destination: &options.CascadePollInterval,
+		}),
+		altsrc.NewDurationFlag(&cli.DurationFlag{
+			Name:        "relay.max_backoff",
+			Usage:       "Max interval of reconnecting a relayed stream, it doubles from 1s",
+			Value:       30 * time.Second,
+			DefaultText: "30s",
+			Destination: &options.CascadeMaxBackoff,
+		}),
+	}
+}
@@ -1,11 +1,37 @@
+// Command broadcast serves the embedded demo player apart from broadcast, watching streams of the broadcast
+// instance at -signal, e.g. to try a remote instance which doesn't serve the player itself.
 package main
 
 import (
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/demo"
 )
 
 func main() {
-	http.Handle("/", http.FileServer(http.Dir("e2e/broadcast/static")))
-	log.Fatal(http.ListenAndServe(":7070", nil))
+	addr := flag.String("addr", ":7070", "Address serving the demo player")
+	signal := flag.String("signal", "ws://localhost:8080/v1/broadcast/signal", "WebSocket signaling URL of broadcast")
+	streams := flag.String("streams", "", `Comma separated streams listed, in form of "id:track_source"`)
+	flag.Parse()
+
+	config := cfg.DemoConfigOptions{Demo: true, DemoSignalURL: *signal}
+	if *streams != "" {
+		config.DemoStreams = strings.Split(*streams, ",")
+	}
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+	player, err := demo.New(nil, &logger, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	http.Handle(demo.Path, player.Handler())
+	http.Handle("/", http.RedirectHandler(demo.Path, http.StatusFound))
+	logger.Info().Str("address", *addr).Msg("serving demo player")
+	log.Fatal(http.ListenAndServe(*addr, nil))
 }
@@ -0,0 +1,2 @@
+// Package pipeline tests the broadcast pipeline end to end in process, see TestPipeline.
+package pipeline
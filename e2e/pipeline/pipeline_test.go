@@ -0,0 +1,225 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqttclient "github.com/SB-IM/mqtt-client"
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	cmdbroadcast "github.com/SB-IM/skywalker/cmd/broadcast"
+	"github.com/SB-IM/skywalker/internal/broadcast"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/edge"
+	"github.com/SB-IM/skywalker/internal/loadtest"
+	"github.com/SB-IM/skywalker/testsupport"
+)
+
+const (
+	// frameInterval is the interval of synthetic frames, i.e. 30 fps.
+	frameInterval = time.Second / 30
+	// clockRate is the RTP clock rate of H.264.
+	clockRate = 90000
+	// signalTimeout is the max time of the edge and the subscriber signaling.
+	signalTimeout = 10 * time.Second
+	// timeout is the max time of the whole test.
+	timeout = time.Minute
+	// duration is the time the subscriber receives RTP.
+	duration = 3 * time.Second
+)
+
+// testWriter writes logs to the test, so they are shown once it fails or runs verbosely.
+// Logs of goroutines outliving the test are dropped, as the test can't be logged to once completed.
+type testWriter struct {
+	t *testing.T
+
+	mu   sync.Mutex
+	done bool
+}
+
+func newTestWriter(t *testing.T) *testWriter {
+	w := &testWriter{t: t}
+	t.Cleanup(func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.done = true
+	})
+	return w
+}
+
+func (w *testWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.done {
+		w.t.Log(strings.TrimSuffix(string(p), "\n"))
+	}
+	return len(p), nil
+}
+
+// TestPipeline runs the broadcast service with an in-memory MQTT broker, publishes a synthetic H.264 RTP stream
+// as an edge over the MQTT path, subscribes to it over a real WebSocket, and checks RTP arrives at the subscriber.
+// Peers are pion ones on loopback, so it needs neither Docker nor browsers.
+func TestPipeline(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipped end to end test in short mode")
+	}
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: newTestWriter(t), NoColor: true}).
+		Level(zerolog.InfoLevel).
+		With().Timestamp().Logger()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	broker := testsupport.NewBroker()
+	ctx = logger.WithContext(ctx)
+	ctx = mqttclient.WithContext(ctx, broker.NewClient())
+
+	config, err := cmdbroadcast.DefaultConfig()
+	if err != nil {
+		t.Fatalf("could not load default config: %v", err)
+	}
+	config.Port = freePort(t)
+	config.Host = "127.0.0.1"
+
+	svc, err := broadcast.New(ctx, config)
+	if err != nil {
+		t.Fatalf("could not create broadcast service: %v", err)
+	}
+	if err := svc.Start(ctx); err != nil {
+		t.Fatalf("could not start broadcast service: %v", err)
+	}
+	defer func() {
+		if err := svc.Shutdown(context.Background()); err != nil {
+			t.Errorf("could not shut down broadcast service: %v", err)
+		}
+	}()
+
+	meta := &pb.Meta{Id: "e2e", TrackSource: pb.TrackSource_DRONE}
+	stop := publish(ctx, t, broker.NewClient(), config.MQTTClientConfigOptions, meta, &logger)
+	defer stop()
+
+	report, err := loadtest.Run(ctx, &logger, loadtest.ConfigOptions{
+		URL:           "ws://" + net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		ID:            meta.Id,
+		TrackSource:   int(meta.TrackSource),
+		Clients:       1,
+		Duration:      duration,
+		SignalTimeout: signalTimeout,
+	})
+	if err != nil {
+		t.Fatalf("could not subscribe: %v", err)
+	}
+	if report.Succeeded != 1 || report.PacketsReceived == 0 {
+		t.Fatalf("subscriber received no RTP, errors: %v", report.Errors)
+	}
+	logger.Info().
+		Uint64("packets", report.PacketsReceived).
+		Uint64("lost", report.PacketsLost).
+		Float64("setup_ms", report.SetupMax).
+		Float64("bitrate_kbps", report.Bitrate).
+		Msg("subscriber received RTP")
+}
+
+// publish signals a peer connection of meta as an edge over client, and streams synthetic frames in background.
+// The returned function stops streaming and closes the peer connection.
+func publish(
+	ctx context.Context,
+	t *testing.T,
+	client mqtt.Client,
+	config cfg.MQTTClientConfigOptions,
+	meta *pb.Meta,
+	logger *zerolog.Logger,
+) func() {
+	t.Helper()
+	track, err := webrtc.NewTrackLocalStaticRTP(
+		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: clockRate},
+		"video",
+		meta.Id,
+	)
+	if err != nil {
+		t.Fatalf("could not create video track: %v", err)
+	}
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("could not create PeerConnection: %v", err)
+	}
+	rtpSender, err := peerConnection.AddTrack(track)
+	if err != nil {
+		_ = peerConnection.Close()
+		t.Fatalf("could not add video track: %v", err)
+	}
+	// Read RTCP so interceptors work.
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := rtpSender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	signalCtx, cancel := context.WithTimeout(ctx, signalTimeout)
+	err = edge.Signal(signalCtx, client, config, meta, peerConnection, logger)
+	cancel()
+	if err != nil {
+		_ = peerConnection.Close()
+		t.Fatalf("could not publish: %v", err)
+	}
+	logger.Info().Msg("edge signaled, streaming synthetic frames")
+
+	ctx, cancel = context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := stream(ctx, track); err != nil && !errors.Is(err, context.Canceled) {
+			t.Errorf("could not stream synthetic frames: %v", err)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		_ = peerConnection.Close()
+	}
+}
+
+// stream writes a synthetic frame to track every frameInterval until ctx is done. Each frame is an IDR NAL unit
+// in a single packet, its content is arbitrary as the pipeline forwards RTP without decoding.
+func stream(ctx context.Context, track *webrtc.TrackLocalStaticRTP) error {
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	payload := make([]byte, 1000)
+	payload[0] = 0x65 // NAL unit header of an IDR slice.
+	packet := &rtp.Packet{Header: rtp.Header{Version: 2, Marker: true}, Payload: payload}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := track.WriteRTP(packet); err != nil {
+			return err
+		}
+		packet.SequenceNumber++
+		packet.Timestamp += uint32(clockRate * frameInterval / time.Second)
+	}
+}
+
+// freePort returns a free TCP port of loopback.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not find a free port: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
@@ -3,24 +3,29 @@ module github.com/SB-IM/skywalker
 go 1.17
 
 require (
+	github.com/BurntSushi/toml v0.4.1
 	github.com/SB-IM/logging v0.2.5
 	github.com/SB-IM/mqtt-client v0.1.5
 	github.com/SB-IM/pb v0.3.1
 	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/gorilla/mux v1.8.0
+	github.com/pion/interceptor v0.1.0
 	github.com/pion/logging v0.2.2
 	github.com/pion/randutil v0.1.0
 	github.com/pion/rtcp v1.2.8
+	github.com/pion/rtp v1.7.2
+	github.com/pion/transport v0.12.3
 	github.com/pion/turn/v2 v2.0.5
 	github.com/pion/webrtc/v3 v3.1.0
 	github.com/rs/zerolog v1.25.0
 	github.com/urfave/cli/v2 v2.3.0
+	google.golang.org/grpc v1.41.0
 	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 	nhooyr.io/websocket v1.8.7
 )
 
 require (
-	github.com/BurntSushi/toml v0.4.1 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.1 // indirect
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
@@ -28,14 +33,11 @@ require (
 	github.com/pion/datachannel v1.4.21 // indirect
 	github.com/pion/dtls/v2 v2.0.9 // indirect
 	github.com/pion/ice/v2 v2.1.12 // indirect
-	github.com/pion/interceptor v0.1.0 // indirect
 	github.com/pion/mdns v0.0.5 // indirect
-	github.com/pion/rtp v1.7.2 // indirect
 	github.com/pion/sctp v1.7.12 // indirect
 	github.com/pion/sdp/v3 v3.0.4 // indirect
 	github.com/pion/srtp/v2 v2.0.5 // indirect
 	github.com/pion/stun v0.3.5 // indirect
-	github.com/pion/transport v0.12.3 // indirect
 	github.com/pion/udp v0.1.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
@@ -43,5 +45,4 @@ require (
 	golang.org/x/net v0.0.0-20210917221730-978cfadd31cf // indirect
 	golang.org/x/sys v0.0.0-20210917161153-d61c044b1678 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
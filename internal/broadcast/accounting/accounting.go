@@ -0,0 +1,175 @@
+// Package accounting accounts bytes forwarded to viewers for billing, per session and per viewer attributed to
+// the subject of its token. Bytes are aggregated over fixed intervals aligned to the clock, e.g. hours, and closed
+// intervals are kept in memory for reports until they are older than the retention.
+package accounting
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// Key attributes bytes to a viewer of a session.
+type Key struct {
+	Tenant      string
+	ID          string
+	TrackSource pb.TrackSource
+	// Subject is the subject of the token of the viewer, empty if it's not authenticated.
+	Subject string
+}
+
+// Grouping of report rows.
+const (
+	// BySession reports a row per session and subject.
+	BySession = "session"
+	// ByMachine reports a row per machine, summing its track sources and viewers.
+	ByMachine = "machine"
+	// BySubject reports a row per subject, summing sessions it watched.
+	BySubject = "subject"
+)
+
+// Row is bytes forwarded in an interval, fields summed by grouping are empty.
+type Row struct {
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	Tenant      string          `json:"tenant,omitempty"`
+	ID          string          `json:"id,omitempty"`
+	TrackSource *pb.TrackSource `json:"track_source,omitempty"`
+	Subject     string          `json:"subject,omitempty"`
+	Bytes       uint64          `json:"bytes"`
+}
+
+// period is bytes of keys in the interval starting at start.
+type period struct {
+	start time.Time
+	bytes map[Key]uint64
+}
+
+// Accountant aggregates bytes of keys over intervals.
+type Accountant struct {
+	interval  time.Duration
+	retention time.Duration
+
+	mu      sync.Mutex
+	current *period
+	// closed are closed periods, oldest first.
+	closed []*period
+}
+
+// New returns a new Accountant, it returns nil if AccountingInterval is not positive, which disables accounting.
+func New(config cfg.AccountingConfigOptions) *Accountant {
+	if config.AccountingInterval <= 0 {
+		return nil
+	}
+	return &Accountant{
+		interval:  config.AccountingInterval,
+		retention: config.AccountingRetention,
+	}
+}
+
+// Add accounts n bytes forwarded to the viewer of key. It does nothing on a nil Accountant.
+func (a *Accountant) Add(key Key, n uint64) {
+	if a == nil || n == 0 {
+		return
+	}
+	metrics.EgressBytes.WithLabelValues(key.Tenant, key.ID, strconv.Itoa(int(key.TrackSource))).Add(n)
+	metrics.ViewerEgressBytes.WithLabelValues(key.Tenant, key.Subject).Add(n)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.roll(time.Now())
+	a.current.bytes[key] += n
+}
+
+// roll closes the current period if now is past it, and drops closed periods older than retention.
+// a.mu must be held.
+func (a *Accountant) roll(now time.Time) {
+	start := now.Truncate(a.interval)
+	if a.current != nil && a.current.start.Equal(start) {
+		return
+	}
+	if a.current != nil && len(a.current.bytes) > 0 {
+		a.closed = append(a.closed, a.current)
+	}
+	a.current = &period{start: start, bytes: make(map[Key]uint64)}
+	if a.retention > 0 {
+		i := 0
+		for i < len(a.closed) && a.closed[i].start.Before(start.Add(-a.retention)) {
+			i++
+		}
+		a.closed = a.closed[i:]
+	}
+}
+
+// Report returns rows of intervals overlapping [from, to) grouped by group, zero times are unbounded.
+// The current interval is included, its bytes keep growing until it's closed.
+// Rows are ordered by interval, then by tenant, ID, track source and subject.
+func (a *Accountant) Report(from, to time.Time, group string) []Row {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	a.roll(time.Now())
+	periods := append(append([]*period(nil), a.closed...), a.current)
+	var rows []Row
+	for _, p := range periods {
+		end := p.start.Add(a.interval)
+		if (!from.IsZero() && !end.After(from)) || (!to.IsZero() && !p.start.Before(to)) {
+			continue
+		}
+		grouped := make(map[Key]uint64, len(p.bytes))
+		for key, n := range p.bytes {
+			grouped[groupKey(key, group)] += n
+		}
+		for key, n := range grouped {
+			row := Row{
+				Start:   p.start,
+				End:     end,
+				Tenant:  key.Tenant,
+				ID:      key.ID,
+				Subject: key.Subject,
+				Bytes:   n,
+			}
+			if group != ByMachine && group != BySubject {
+				trackSource := key.TrackSource
+				row.TrackSource = &trackSource
+			}
+			rows = append(rows, row)
+		}
+	}
+	a.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		x, y := rows[i], rows[j]
+		switch {
+		case !x.Start.Equal(y.Start):
+			return x.Start.Before(y.Start)
+		case x.Tenant != y.Tenant:
+			return x.Tenant < y.Tenant
+		case x.ID != y.ID:
+			return x.ID < y.ID
+		case x.TrackSource != nil && *x.TrackSource != *y.TrackSource:
+			return *x.TrackSource < *y.TrackSource
+		default:
+			return x.Subject < y.Subject
+		}
+	})
+	return rows
+}
+
+// groupKey returns key with fields summed by group cleared.
+func groupKey(key Key, group string) Key {
+	switch group {
+	case ByMachine:
+		key.TrackSource, key.Subject = 0, ""
+	case BySubject:
+		key.ID, key.TrackSource = "", 0
+	}
+	return key
+}
@@ -0,0 +1,38 @@
+package accounting
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvHeader is the header of CSV reports, times are in RFC 3339.
+var csvHeader = []string{"start", "end", "tenant", "id", "track_source", "subject", "bytes"}
+
+// WriteCSV writes rows as CSV with a header, track sources summed by grouping are empty.
+func WriteCSV(w io.Writer, rows []Row) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		trackSource := ""
+		if row.TrackSource != nil {
+			trackSource = strconv.Itoa(int(*row.TrackSource))
+		}
+		if err := cw.Write([]string{
+			row.Start.UTC().Format(time.RFC3339),
+			row.End.UTC().Format(time.RFC3339),
+			row.Tenant,
+			row.ID,
+			trackSource,
+			row.Subject,
+			strconv.FormatUint(row.Bytes, 10),
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
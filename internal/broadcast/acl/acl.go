@@ -0,0 +1,54 @@
+// Package acl restricts which subscribers may watch streams of which machines, by rules of a YAML file
+// or by an external authorizer called over HTTP. It's checked before subscriber peer connections are created,
+// in addition to streams restricted by claims of subscriber tokens.
+package acl
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// ErrDenied is returned if a subscriber is not allowed to watch a stream.
+var ErrDenied = errors.New("denied by stream access control list")
+
+// Request is a subscriber asking to watch a stream.
+type Request struct {
+	// Subject is subject of the subscriber token, or client ID of an MQTT subscriber, it's empty if anonymous.
+	Subject    string   `json:"subject"`
+	Tenant     string   `json:"tenant"`
+	Meta       *pb.Meta `json:"meta"`
+	RemoteAddr string   `json:"remote_addr,omitempty"`
+}
+
+// ACL checks requests of subscribers.
+type ACL interface {
+	// Check returns ErrDenied if the subscriber of r is not allowed to watch the stream, or another error
+	// if it could not be checked, which denies the subscriber as well.
+	Check(ctx context.Context, r *Request) error
+}
+
+// New returns ACL of config, ACL is an http or https URL of an external authorizer, or path of a YAML rules file.
+// It returns nil if ACL is empty, all subscribers are allowed then.
+func New(config cfg.ACLConfigOptions) (ACL, error) {
+	if config.ACL == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(config.ACL, "http://") || strings.HasPrefix(config.ACL, "https://") {
+		u, err := url.Parse(config.ACL)
+		if err != nil {
+			return nil, err
+		}
+		return newAuthorizer(u, config.ACLTimeout), nil
+	}
+	r, err := loadRules(config.ACL)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
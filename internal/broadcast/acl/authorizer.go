@@ -0,0 +1,56 @@
+package acl
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const defaultTimeout = 2 * time.Second
+
+// authorizer asks an external authorizer by POSTing Request as JSON, it replies 2xx to allow
+// and 403 to deny the subscriber, other replies are errors.
+type authorizer struct {
+	client *http.Client
+	url    string
+}
+
+func newAuthorizer(u *url.URL, timeout time.Duration) *authorizer {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &authorizer{
+		client: &http.Client{Timeout: timeout},
+		url:    u.String(),
+	}
+}
+
+func (a *authorizer) Check(ctx context.Context, r *Request) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not call ACL authorizer: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusForbidden:
+		return ErrDenied
+	default:
+		return fmt.Errorf("unexpected ACL authorizer status %s", resp.Status)
+	}
+}
@@ -0,0 +1,101 @@
+package acl
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	pb "github.com/SB-IM/pb/signal"
+	"gopkg.in/yaml.v2"
+)
+
+// wildcard matches any machine ID, subject or tenant.
+const wildcard = "*"
+
+// Rule allows subjects or tenants to watch streams of a machine.
+type Rule struct {
+	// ID is the machine ID, "*" matches all machines.
+	ID string `yaml:"id"`
+	// TrackSources restricts track sources of the machine, empty means all.
+	TrackSources []pb.TrackSource `yaml:"track_sources"`
+	// Subjects are allowed subjects of subscriber tokens or client IDs of MQTT subscribers, "*" allows all
+	// including anonymous subscribers.
+	Subjects []string `yaml:"subjects"`
+	// Tenants are allowed tenants, "*" allows all.
+	Tenants []string `yaml:"tenants"`
+}
+
+// rulesFile is the YAML file of rules.
+type rulesFile struct {
+	// DefaultAllow allows streams matched by no rule if true.
+	DefaultAllow bool   `yaml:"default_allow"`
+	Rules        []Rule `yaml:"rules"`
+}
+
+// rules allows a subscriber to watch a stream if any rule matching the stream allows it.
+// Streams matched by no rule are allowed only if defaultAllow is true.
+type rules struct {
+	defaultAllow bool
+	rules        []Rule
+}
+
+func loadRules(path string) (*rules, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read ACL rules: %w", err)
+	}
+	var file rulesFile
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, fmt.Errorf("could not parse ACL rules: %w", err)
+	}
+	for i, rule := range file.Rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("invalid ACL rule %d: missing id", i)
+		}
+		if len(rule.Subjects) == 0 && len(rule.Tenants) == 0 {
+			return nil, fmt.Errorf("invalid ACL rule %d of %s: no subjects or tenants", i, rule.ID)
+		}
+	}
+	return &rules{defaultAllow: file.DefaultAllow, rules: file.Rules}, nil
+}
+
+func (r *rules) Check(_ context.Context, req *Request) error {
+	matched := false
+	for _, rule := range r.rules {
+		if !rule.match(req.Meta) {
+			continue
+		}
+		matched = true
+		if contains(rule.Subjects, req.Subject) || contains(rule.Tenants, req.Tenant) {
+			return nil
+		}
+	}
+	if !matched && r.defaultAllow {
+		return nil
+	}
+	return ErrDenied
+}
+
+func (rule *Rule) match(meta *pb.Meta) bool {
+	if rule.ID != wildcard && rule.ID != meta.Id {
+		return false
+	}
+	if len(rule.TrackSources) == 0 {
+		return true
+	}
+	for _, trackSource := range rule.TrackSources {
+		if trackSource == meta.TrackSource {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == wildcard || (value == v && v != "") {
+			return true
+		}
+	}
+	return false
+}
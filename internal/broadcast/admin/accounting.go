@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/accounting"
+)
+
+// handleAccounting reports viewer egress bytes of intervals overlapping [from, to) in RFC 3339, both optional.
+// Rows are per session and subject by default, or per machine or subject by group. Format is json or csv.
+func (a *Admin) handleAccounting() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.accountant == nil {
+			http.Error(w, "accounting disabled", http.StatusNotFound)
+			return
+		}
+		query := r.URL.Query()
+		var from, to time.Time
+		for _, v := range []struct {
+			name string
+			t    *time.Time
+		}{{"from", &from}, {"to", &to}} {
+			if s := query.Get(v.name); s != "" {
+				t, err := time.Parse(time.RFC3339, s)
+				if err != nil {
+					http.Error(w, "invalid "+v.name, http.StatusBadRequest)
+					return
+				}
+				*v.t = t
+			}
+		}
+		group := query.Get("group")
+		switch group {
+		case "":
+			group = accounting.BySession
+		case accounting.BySession, accounting.ByMachine, accounting.BySubject:
+		default:
+			http.Error(w, "invalid group, must be session, machine or subject", http.StatusBadRequest)
+			return
+		}
+
+		rows := a.accountant.Report(from, to, group)
+		switch query.Get("format") {
+		case "", "json":
+			if rows == nil {
+				rows = []accounting.Row{}
+			}
+			a.writeJSON(w, rows)
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="accounting.csv"`)
+			if err := accounting.WriteCSV(w, rows); err != nil {
+				a.logger.Err(err).Msg("could not write accounting CSV")
+			}
+		default:
+			http.Error(w, "invalid format, must be json or csv", http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Package admin serves operator actions cutting streams, e.g. on privacy incidents or bandwidth emergencies.
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/accounting"
+	"github.com/SB-IM/skywalker/internal/broadcast/capture"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/publisher"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/sessionstore"
+	"github.com/SB-IM/skywalker/internal/broadcast/share"
+	"github.com/SB-IM/skywalker/internal/broadcast/subscriber"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+)
+
+// Admin closes sessions and subscriber peer connections on behalf of operators.
+type Admin struct {
+	logger   zerolog.Logger
+	config   cfg.AdminConfigOptions
+	sessions *session.SessionManager
+	pub      *publisher.Publisher
+	sub      *subscriber.Subscriber
+	capture  *capture.Capturer
+	// tenants are limits and usages of tenants, it's nil unless multi-tenant.
+	tenants *tenant.Tenants
+	// accountant reports viewer egress for billing, it's nil if accounting is disabled.
+	accountant *accounting.Accountant
+	// shares are sharing links of streams, it's nil if auth is disabled.
+	shares *share.Links
+	// store shares metadata of sessions with other instances.
+	store *sessionstore.Registry
+}
+
+// New returns a new Admin.
+func New(
+	sessions *session.SessionManager,
+	pub *publisher.Publisher,
+	sub *subscriber.Subscriber,
+	tenants *tenant.Tenants,
+	accountant *accounting.Accountant,
+	shares *share.Links,
+	store *sessionstore.Registry,
+	logger *zerolog.Logger,
+	config cfg.AdminConfigOptions,
+) *Admin {
+	return &Admin{
+		logger:     loglevel.Default.Component(logger, "Admin"),
+		config:     config,
+		sessions:   sessions,
+		pub:        pub,
+		sub:        sub,
+		capture:    capture.New(logger, config),
+		tenants:    tenants,
+		accountant: accountant,
+		shares:     shares,
+		store:      store,
+	}
+}
+
+// Handler returns the admin API, requests must carry "Authorization: Bearer" header of AdminToken:
+//
+//	GET    /v1/admin/sessions?tenant=                         lists sessions with ingest stats, of a tenant if given
+//	GET    /v1/admin/sessions/{id}/{track_source}             gets ingest stats of a session
+//	DELETE /v1/admin/sessions/{id}                            closes sessions of all track sources of machine {id}
+//	DELETE /v1/admin/sessions/{id}/{track_source}             closes a session
+//	POST   /v1/admin/sessions/{id}/{track_source}/keyframe    asks edge for a keyframe of all video layers
+//	POST   /v1/admin/sessions/{id}/{track_source}/markers     adds a marker of label, note and time in JSON
+//	GET    /v1/admin/subscribers?tenant=                      lists live subscriber peer connections with RTCP stats
+//	DELETE /v1/admin/subscribers/{peer_id}                    closes a subscriber peer connection
+//	GET    /v1/admin/connections?tenant=                      lists live WebSocket connections and peer connections
+//	GET    /v1/admin/tenants                                  lists concurrent streams and viewers of tenants with limits
+//	GET    /v1/admin/accounting?from=&to=&group=&format=      reports viewer egress bytes per interval, in JSON or CSV
+//	GET    /v1/admin/connections/{id}                         gets a connection with peer connections negotiated on it
+//	GET    /v1/admin/captures                                 lists RTP captures
+//	POST   /v1/admin/captures/{id}/{track_source}             captures RTP of a session, by query of duration, format and peer_id
+//	GET    /v1/admin/captures/{name}                          downloads a capture file
+//	DELETE /v1/admin/captures/{name}                          stops a running capture, or removes a finished one
+//	GET    /v1/admin/shares                                   lists sharing links not expired with their viewers
+//	POST   /v1/admin/shares/{id}/{track_source}               mints a sharing link, by query of ttl, not_before, max_viewers and networks
+//	DELETE /v1/admin/shares/{share_id}                        revokes a sharing link and closes its viewers
+//	GET    /v1/admin/store/sessions                           lists metadata of sessions of all instances sharing session.store
+//	GET    /v1/admin/loglevel                                 lists log levels of components
+//	PUT    /v1/admin/loglevel?component=&level=               sets log level of a component, an empty level resets it
+//
+// Closing a session closes its publisher peer connection and those of its viewers.
+func (a *Admin) Handler() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/admin/sessions", a.handleSessions()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/sessions/{id}/{track_source:[0-9]+}", a.handleSession()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/sessions/{id}/{track_source:[0-9]+}/keyframe", a.handleKeyframe()).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/sessions/{id}/{track_source:[0-9]+}/markers", a.handleAddMarker()).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/sessions/{id}", a.handleCloseSession()).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/sessions/{id}/{track_source:[0-9]+}", a.handleCloseSession()).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/subscribers", a.handleSubscribers()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/subscribers/{peer_id}", a.handleKick()).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/connections", a.handleConns()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/connections/{id}", a.handleConn()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/tenants", a.handleTenants()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/accounting", a.handleAccounting()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/captures", a.handleCaptures()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/captures/{id}/{track_source:[0-9]+}", a.handleStartCapture()).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/captures/{name}", a.handleDownloadCapture()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/captures/{name}", a.handleStopCapture()).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/shares", a.handleShares()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/shares/{id}/{track_source:[0-9]+}", a.handleMintShare()).Methods(http.MethodPost)
+	router.HandleFunc("/v1/admin/shares/{share_id}", a.handleRevokeShare()).Methods(http.MethodDelete)
+	router.HandleFunc("/v1/admin/store/sessions", a.handleStoredSessions()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/loglevel", a.handleLogLevels()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/admin/loglevel", a.handleSetLogLevel()).Methods(http.MethodPut)
+	return a.Authorize(router)
+}
+
+// Authorize rejects requests to next without the admin token.
+func (a *Admin) Authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AdminToken)) != 1 {
+			a.logger.Warn().Str("remote_addr", r.RemoteAddr).Msg("unauthorized admin request")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Admin) handleCloseSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		trackSource := -1
+		if v, ok := vars["track_source"]; ok {
+			n, err := session.ParseTrackSource(v)
+			if err != nil {
+				http.Error(w, "invalid track source", http.StatusBadRequest)
+				return
+			}
+			trackSource = int(n)
+		}
+
+		var result struct {
+			Sessions    int `json:"sessions"`
+			Subscribers int `json:"subscribers"`
+		}
+		for _, sess := range a.sessions.List() {
+			if sess.Meta.Id != vars["id"] || (trackSource >= 0 && int(sess.Meta.TrackSource) != trackSource) {
+				continue
+			}
+			// Viewers are kicked first, so they don't linger on a session without publisher.
+			result.Subscribers += a.sub.KickSession(sess.Key)
+			a.pub.CloseSession(sess)
+			result.Sessions++
+		}
+		if result.Sessions == 0 {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		a.logger.Warn().
+			Str("id", vars["id"]).
+			Int("track_source", trackSource).
+			Int("sessions", result.Sessions).
+			Int("subscribers", result.Subscribers).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("operator closed sessions")
+
+		a.writeJSON(w, result)
+	}
+}
+
+func (a *Admin) handleSubscribers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		peers := a.sub.Peers()
+		filtered := peers[:0]
+		for _, peer := range peers {
+			if connOfTenant(r, conns.Conn{Tenant: peer.Tenant, Meta: peer.Meta}) {
+				filtered = append(filtered, peer)
+			}
+		}
+		a.writeJSON(w, filtered)
+	}
+}
+
+func (a *Admin) handleKick() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["peer_id"]
+		if !a.sub.Kick(id) {
+			http.Error(w, "subscriber not found", http.StatusNotFound)
+			return
+		}
+		a.logger.Warn().Str("peer_id", id).Str("remote_addr", r.RemoteAddr).Msg("operator kicked subscriber")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *Admin) handleConns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list := conns.Default.List()
+		filtered := list[:0]
+		for _, conn := range list {
+			if connOfTenant(r, conn) {
+				filtered = append(filtered, conn)
+			}
+		}
+		a.writeJSON(w, filtered)
+	}
+}
+
+func (a *Admin) handleConn() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, ok := conns.Default.Get(mux.Vars(r)["id"])
+		if !ok {
+			http.Error(w, "connection not found", http.StatusNotFound)
+			return
+		}
+		a.writeJSON(w, struct {
+			conns.Conn
+			Peers []conns.Conn `json:"peers"`
+		}{conn, conns.Default.Children(conn.ID)})
+	}
+}
+
+func (a *Admin) handleLogLevels() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		a.writeJSON(w, loglevel.Default.List())
+	}
+}
+
+func (a *Admin) handleSetLogLevel() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		component := r.URL.Query().Get("component")
+		level, err := zerolog.ParseLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			http.Error(w, "invalid log level", http.StatusBadRequest)
+			return
+		}
+		if !loglevel.Default.Set(component, level) {
+			http.Error(w, "component not found", http.StatusNotFound)
+			return
+		}
+		a.logger.Warn().
+			Str("target", component).
+			Str("level", level.String()).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("operator set log level")
+		a.writeJSON(w, loglevel.Default.List())
+	}
+}
+
+func (a *Admin) writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.Err(err).Msg("could not write admin JSON")
+	}
+}
@@ -0,0 +1,134 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/capture"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// handleStartCapture starts capturing RTP of a session, the side of a subscriber if peer_id is given.
+func (a *Admin) handleStartCapture() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := a.session(w, r)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		options := capture.Options{
+			Format: query.Get("format"),
+			PeerID: query.Get("peer_id"),
+		}
+		if v := query.Get("duration"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				http.Error(w, "invalid duration", http.StatusBadRequest)
+				return
+			}
+			options.Duration = d
+		}
+		if options.PeerID != "" && !a.subscriberSide(w, sess, &options) {
+			return
+		}
+
+		status, err := a.capture.Start(sess, options)
+		switch {
+		case errors.Is(err, capture.ErrDisabled):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, capture.ErrQuotaExceeded):
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.logger.Warn().
+			Str("id", sess.Meta.Id).
+			Int32("track_source", int32(sess.Meta.TrackSource)).
+			Str("peer_id", options.PeerID).
+			Str("capture", status.Name).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("operator started RTP capture")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		a.writeJSON(w, status)
+	}
+}
+
+// subscriberSide sets options to rewrite packets as sent to the subscriber of PeerID, or replies an error.
+// Only the default video of the session is captured, as simulcast layers aren't tapped.
+func (a *Admin) subscriberSide(w http.ResponseWriter, sess *session.Session, options *capture.Options) bool {
+	peer, meta, ok := a.sub.Viewer(options.PeerID)
+	if !ok || a.sessions.Key(meta) != sess.Key {
+		http.Error(w, "subscriber of the session not found", http.StatusNotFound)
+		return false
+	}
+	streams, err := peer.SentStreams()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return false
+	}
+	for _, stream := range streams {
+		rewrite := &capture.Rewrite{SSRC: stream.SSRC, PayloadType: stream.PayloadType}
+		switch {
+		case stream.Track == webrtc.TrackLocal(sess.VideoTrack):
+			options.Video = rewrite
+		case stream.Track == webrtc.TrackLocal(sess.AudioTrack):
+			options.Audio = rewrite
+		case stream.Track.Kind() == webrtc.RTPCodecTypeVideo:
+			http.Error(w, "subscriber watches a simulcast layer, which can't be captured", http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+func (a *Admin) handleCaptures() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		a.writeJSON(w, a.capture.List())
+	}
+}
+
+// handleDownloadCapture serves a capture file, a running capture is served as far as it's written.
+func (a *Admin) handleDownloadCapture() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		path, err := a.capture.Path(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if strings.HasSuffix(name, "."+capture.FormatPcap) {
+			w.Header().Set("Content-Type", "application/vnd.tcpdump.pcap")
+		} else {
+			w.Header().Set("Content-Type", "application/octet-stream")
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		http.ServeFile(w, r, path)
+	}
+}
+
+// handleStopCapture stops a running capture, or removes the file of a finished one.
+func (a *Admin) handleStopCapture() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		err := a.capture.Stop(name)
+		if errors.Is(err, capture.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		a.logger.Warn().Str("capture", name).Str("remote_addr", r.RemoteAddr).Msg("operator stopped RTP capture")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,66 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// maxMarkerBodySize limits request body of adding a marker.
+const maxMarkerBodySize = 64 << 10
+
+// markerRequest is request body of adding a marker.
+type markerRequest struct {
+	Label string `json:"label"`
+	Note  string `json:"note"`
+	// Time is when the event happened, defaults to now. Operators may drop markers a little late.
+	Time *time.Time `json:"time"`
+}
+
+// handleAddMarker adds a timestamped marker to a live session for post-flight review, it's stored with recordings
+// of the session.
+func (a *Admin) handleAddMarker() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := a.session(w, r)
+		if !ok {
+			return
+		}
+
+		var req markerRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxMarkerBodySize)).Decode(&req); err != nil {
+			http.Error(w, "could not decode marker: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.Label == "" {
+			http.Error(w, "label is required", http.StatusBadRequest)
+			return
+		}
+		t := time.Now()
+		if req.Time != nil {
+			t = *req.Time
+		}
+
+		marker, err := sess.Mark(req.Label, req.Note, t)
+		if err != nil {
+			if errors.Is(err, session.ErrTooManyMarkers) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		a.logger.Info().
+			Str("id", sess.ID).
+			Str("label", marker.Label).
+			Time("time", marker.Time).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("operator added marker")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		a.writeJSON(w, marker)
+	}
+}
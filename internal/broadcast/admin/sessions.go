@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// sessionStats are ingest stats of a session for operators.
+type sessionStats struct {
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	Key         string         `json:"key"`
+	Tenant      string         `json:"tenant,omitempty"`
+	Codec       string         `json:"codec"`
+	AudioCodec  string         `json:"audio_codec"`
+	CreatedAt   time.Time      `json:"created_at"`
+	LastActive  time.Time      `json:"last_active"`
+	Viewers     int64          `json:"viewers"`
+	Bitrate     uint64         `json:"bitrate"` // In bits per second.
+	Bytes       uint64         `json:"bytes"`
+	Hibernating bool           `json:"hibernating"`
+	Degraded    bool           `json:"degraded"`
+	Reasons     []string       `json:"degraded_reasons,omitempty"`
+	Layers      []string       `json:"layers,omitempty"`
+	LatencyP50  *float64       `json:"latency_p50_ms,omitempty"`
+	LatencyP95  *float64       `json:"latency_p95_ms,omitempty"`
+	LatencyP99  *float64       `json:"latency_p99_ms,omitempty"`
+}
+
+func newSessionStats(sess *session.Session) sessionStats {
+	degraded, reasons := sess.Quality.Degraded()
+	stats := sessionStats{
+		ID:          sess.Meta.Id,
+		TrackSource: sess.Meta.TrackSource,
+		Key:         sess.Key.String(),
+		Tenant:      sess.Key.Scope,
+		Codec:       sess.VideoTrack.Codec().MimeType,
+		AudioCodec:  sess.AudioTrack.Codec().MimeType,
+		CreatedAt:   sess.CreatedAt,
+		LastActive:  sess.Bitrate.LastActive(),
+		Viewers:     sess.Viewers(),
+		Bitrate:     sess.Bitrate.Bitrate(),
+		Bytes:       sess.Bitrate.Total(),
+		Hibernating: sess.Hibernating(),
+		Degraded:    degraded,
+		Reasons:     reasons,
+		Layers:      sess.Layers.RIDs(),
+	}
+	if p, ok := sess.Latency.Percentiles(); ok {
+		ms := func(d time.Duration) *float64 {
+			v := float64(d) / float64(time.Millisecond)
+			return &v
+		}
+		stats.LatencyP50, stats.LatencyP95, stats.LatencyP99 = ms(p.P50), ms(p.P95), ms(p.P99)
+	}
+	return stats
+}
+
+func (a *Admin) handleSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sessions := a.sessions.List()
+		stats := make([]sessionStats, 0, len(sessions))
+		for _, sess := range sessions {
+			if !ofTenant(r, sess) {
+				continue
+			}
+			stats = append(stats, newSessionStats(sess))
+		}
+		sort.Slice(stats, func(i, j int) bool {
+			if stats[i].ID != stats[j].ID {
+				return stats[i].ID < stats[j].ID
+			}
+			return stats[i].TrackSource < stats[j].TrackSource
+		})
+		a.writeJSON(w, stats)
+	}
+}
+
+func (a *Admin) handleSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := a.session(w, r)
+		if !ok {
+			return
+		}
+		a.writeJSON(w, newSessionStats(sess))
+	}
+}
+
+// handleKeyframe asks edge for a keyframe of the default video and all simulcast layers, e.g. when viewers
+// report frozen or green frames and periodic keyframes are far apart.
+func (a *Admin) handleKeyframe() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := a.session(w, r)
+		if !ok {
+			return
+		}
+		layers := sess.Layers.List()
+		for _, layer := range layers {
+			layer.RequestKeyframe()
+		}
+		if len(layers) == 0 {
+			sess.RequestKeyframe(sess.VideoTrack)
+		}
+		a.logger.Warn().
+			Str("id", sess.Meta.Id).
+			Int32("track_source", int32(sess.Meta.TrackSource)).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("operator requested keyframe")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// session returns the session in URL path, or replies an error.
+func (a *Admin) session(w http.ResponseWriter, r *http.Request) (*session.Session, bool) {
+	vars := mux.Vars(r)
+	trackSource, err := session.ParseTrackSource(vars["track_source"])
+	if err != nil {
+		http.Error(w, "invalid track source", http.StatusBadRequest)
+		return nil, false
+	}
+	sess, ok := a.sessions.Get(a.sessions.Key(&pb.Meta{Id: vars["id"], TrackSource: trackSource}))
+	if !ok {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return nil, false
+	}
+	return sess, true
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// defaultShareTTL is the lifetime of sharing links minted without ttl.
+const defaultShareTTL = time.Hour
+
+func (a *Admin) handleShares() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.shares == nil {
+			http.Error(w, "sharing links need auth.signing_key", http.StatusNotFound)
+			return
+		}
+		a.writeJSON(w, a.shares.List(time.Now()))
+	}
+}
+
+// handleMintShare mints a sharing link of a stream, which needn't be live yet, by query of ttl, not_before in
+// RFC 3339, max_viewers and comma separated CIDRs of networks.
+func (a *Admin) handleMintShare() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.shares == nil {
+			http.Error(w, "sharing links need auth.signing_key", http.StatusNotFound)
+			return
+		}
+		vars := mux.Vars(r)
+		trackSource, err := session.ParseTrackSource(vars["track_source"])
+		if err != nil {
+			http.Error(w, "invalid track source", http.StatusBadRequest)
+			return
+		}
+		query := r.URL.Query()
+		ttl := defaultShareTTL
+		if v := query.Get("ttl"); v != "" {
+			if ttl, err = time.ParseDuration(v); err != nil {
+				http.Error(w, "invalid ttl", http.StatusBadRequest)
+				return
+			}
+		}
+		var notBefore time.Time
+		if v := query.Get("not_before"); v != "" {
+			if notBefore, err = time.Parse(time.RFC3339, v); err != nil {
+				http.Error(w, "invalid not_before", http.StatusBadRequest)
+				return
+			}
+		}
+		var maxViewers int
+		if v := query.Get("max_viewers"); v != "" {
+			if maxViewers, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "invalid max_viewers", http.StatusBadRequest)
+				return
+			}
+		}
+		var networks []string
+		if v := query.Get("networks"); v != "" {
+			networks = strings.Split(v, ",")
+		}
+
+		meta := &pb.Meta{Id: vars["id"], TrackSource: trackSource}
+		minted, err := a.shares.Mint(meta, notBefore, ttl, maxViewers, networks, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.logger.Warn().
+			Str("id", meta.Id).
+			Int32("track_source", int32(meta.TrackSource)).
+			Str("share", minted.ID).
+			Time("expires_at", minted.ExpiresAt).
+			Str("remote_addr", r.RemoteAddr).
+			Msg("operator minted sharing link")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		a.writeJSON(w, minted)
+	}
+}
+
+func (a *Admin) handleRevokeShare() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := mux.Vars(r)["share_id"]
+		if !a.shares.Revoke(id) {
+			http.Error(w, "sharing link not found", http.StatusNotFound)
+			return
+		}
+		a.logger.Warn().Str("share", id).Str("remote_addr", r.RemoteAddr).Msg("operator revoked sharing link")
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"net/http"
+)
+
+// handleStoredSessions lists metadata of sessions of all instances sharing the session store, it lists sessions
+// of this instance only if the store is in memory.
+func (a *Admin) handleStoredSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := a.store.List(r.Context())
+		if err != nil {
+			a.logger.Err(err).Msg("could not list session store")
+			http.Error(w, "could not list session store", http.StatusBadGateway)
+			return
+		}
+		a.writeJSON(w, list)
+	}
+}
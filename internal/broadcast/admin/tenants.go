@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+)
+
+// handleTenants lists concurrent streams and viewers of tenants along with their limits.
+func (a *Admin) handleTenants() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if a.tenants == nil {
+			http.Error(w, "multi-tenancy disabled", http.StatusNotFound)
+			return
+		}
+		a.writeJSON(w, a.tenants.List())
+	}
+}
+
+// ofTenant reports whether sess belongs to the tenant in "tenant" query of r, all sessions do without the query.
+func ofTenant(r *http.Request, sess *session.Session) bool {
+	t := r.URL.Query().Get("tenant")
+	return t == "" || sess.Key.Scope == t
+}
+
+// connOfTenant reports whether conn belongs to the tenant in "tenant" query of r, by the tenant of the subscriber
+// or of the stream of a publisher. All connections do without the query.
+func connOfTenant(r *http.Request, conn conns.Conn) bool {
+	t := r.URL.Query().Get("tenant")
+	if t == "" || conn.Tenant == t {
+		return true
+	}
+	if conn.Meta == nil {
+		return false
+	}
+	owner, _ := tenant.Split(conn.Meta.Id)
+	return owner == t
+}
@@ -0,0 +1,193 @@
+// Package audit records who watched which stream and when: session start and end, and subscribers joining
+// and leaving with the subject of their token, are written as structured events to sinks, e.g. for compliance.
+// Events are queued and written in background, so a slow sink never blocks signaling.
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultBuffer  = 1024
+	defaultTimeout = 5 * time.Second
+)
+
+// EventType is type of an audit event.
+type EventType string
+
+const (
+	SessionStarted EventType = "session-started"
+	SessionEnded   EventType = "session-ended"
+	ViewerJoined   EventType = "viewer-joined"
+	ViewerLeft     EventType = "viewer-left"
+)
+
+// Event is an audit event.
+type Event struct {
+	Time        time.Time      `json:"time"`
+	Type        EventType      `json:"type"`
+	Instance    string         `json:"instance,omitempty"`
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+
+	// Fields of viewer events.
+	ConnID     string `json:"conn_id,omitempty"`
+	Subject    string `json:"subject,omitempty"` // Subject of the token, or client ID of MQTT subscribers.
+	Tenant     string `json:"tenant,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	Protocol   string `json:"protocol,omitempty"` // websocket, whep or mqtt.
+
+	// Duration is seconds a session lived or a viewer watched, it's set by end events.
+	Duration float64 `json:"duration,omitempty"`
+}
+
+// Auditor writes audit events to sinks.
+type Auditor struct {
+	logger   zerolog.Logger
+	config   cfg.AuditConfigOptions
+	instance string
+	sinks    []Sink
+	events   chan *Event
+
+	closeOnce sync.Once
+}
+
+// New returns a new Auditor writing to sinks of config, see NewSink. Events carry instance name, which defaults
+// to hostname. MQTT sinks publish by client at qos.
+func New(client mqtt.Client, logger *zerolog.Logger, instance string, qos byte, config cfg.AuditConfigOptions) (*Auditor, error) {
+	if config.AuditBuffer <= 0 {
+		config.AuditBuffer = defaultBuffer
+	}
+	if config.AuditTimeout <= 0 {
+		config.AuditTimeout = defaultTimeout
+	}
+	a := &Auditor{
+		logger:   loglevel.Default.Component(logger, "Audit"),
+		config:   config,
+		instance: instance,
+		events:   make(chan *Event, config.AuditBuffer),
+	}
+	if a.instance == "" {
+		a.instance, _ = os.Hostname()
+	}
+	for _, u := range config.AuditSinks {
+		sink, err := NewSink(u, client, qos, config.AuditTimeout)
+		if err != nil {
+			a.close()
+			return nil, err
+		}
+		a.sinks = append(a.sinks, sink)
+	}
+	if len(a.sinks) == 0 {
+		return nil, errors.New("no audit sink")
+	}
+	return a, nil
+}
+
+// SetClient replaces the MQTT client of MQTT sinks.
+func (a *Auditor) SetClient(client mqtt.Client) {
+	for _, sink := range a.sinks {
+		if s, ok := sink.(interface{ SetClient(mqtt.Client) }); ok {
+			s.SetClient(client)
+		}
+	}
+}
+
+// Emit queues e, it's dropped if the queue is full.
+func (a *Auditor) Emit(e *Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Instance = a.instance
+	select {
+	case a.events <- e:
+	default:
+		metrics.AuditEvents.WithLabelValues("dropped").Inc()
+		a.logger.Warn().Str("type", string(e.Type)).Str("id", e.ID).Msg("audit queue is full, dropped event")
+	}
+}
+
+// Run records lifecycle of sessions and writes queued events to sinks until ctx is done,
+// events queued by then are written before it returns.
+func (a *Auditor) Run(ctx context.Context, sessions *session.SessionManager) {
+	defer a.close()
+	events, stop := sessions.Watch()
+	defer stop()
+	for {
+		select {
+		case e := <-events:
+			a.session(e)
+		case e := <-a.events:
+			a.write(e)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-a.events:
+					a.write(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// session emits events of a session lifecycle event.
+func (a *Auditor) session(e session.Event) {
+	switch e.Type {
+	case session.EventCreated:
+		a.Emit(sessionEvent(SessionStarted, e.Session))
+	case session.EventClosed:
+		a.Emit(sessionEvent(SessionEnded, e.Session))
+	case session.EventReplaced:
+		a.Emit(sessionEvent(SessionEnded, e.Replaced))
+		a.Emit(sessionEvent(SessionStarted, e.Session))
+	default:
+	}
+}
+
+func sessionEvent(t EventType, sess *session.Session) *Event {
+	e := &Event{Type: t, ID: sess.Meta.Id, TrackSource: sess.Meta.TrackSource}
+	if t == SessionEnded {
+		e.Duration = time.Since(sess.CreatedAt).Seconds()
+	}
+	return e
+}
+
+// write writes e to all sinks, an error of a sink doesn't affect others.
+func (a *Auditor) write(e *Event) {
+	for _, sink := range a.sinks {
+		ctx, cancel := context.WithTimeout(context.Background(), a.config.AuditTimeout)
+		err := sink.Write(ctx, e)
+		cancel()
+		if err != nil {
+			metrics.AuditEvents.WithLabelValues("failed").Inc()
+			a.logger.Err(err).Str("type", string(e.Type)).Str("id", e.ID).Msg("could not write audit event")
+			continue
+		}
+		metrics.AuditEvents.WithLabelValues("written").Inc()
+	}
+}
+
+func (a *Auditor) close() {
+	a.closeOnce.Do(func() {
+		for _, sink := range a.sinks {
+			if err := sink.Close(); err != nil {
+				a.logger.Err(err).Msg("could not close audit sink")
+			}
+		}
+	})
+}
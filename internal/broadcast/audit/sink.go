@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Sink stores audit events.
+type Sink interface {
+	// Write stores an event, it's called by a single goroutine.
+	Write(ctx context.Context, e *Event) error
+	// Close releases resources of the sink.
+	Close() error
+}
+
+// NewSink creates an audit sink from URL. Supported URLs are:
+//
+//	/path/to/audit.log or file:///path/to/audit.log     JSON lines appended to a local file
+//	mqtt:///topic                                      JSON messages published to topic of the broadcast MQTT client
+//	http(s)://host/path                                JSON POSTed to a webhook, Authorization is set by "token" query
+func NewSink(rawURL string, client mqtt.Client, qos byte, timeout time.Duration) (Sink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse sink URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "", "file":
+		return newFileSink(u.Path)
+	case "mqtt":
+		if u.Path == "" || u.Path == "/" {
+			return nil, fmt.Errorf("missing MQTT topic of audit sink %q", rawURL)
+		}
+		return &mqttSink{client: client, topic: u.Path, qos: qos}, nil
+	case "http", "https":
+		query := u.Query()
+		token := query.Get("token")
+		query.Del("token")
+		u.RawQuery = query.Encode()
+		return &httpSink{url: u.String(), token: token, client: &http.Client{Timeout: timeout}}, nil
+	default:
+		return nil, fmt.Errorf("unsupported audit sink scheme %q", u.Scheme)
+	}
+}
+
+// fileSink appends events to a file in JSON lines.
+type fileSink struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %w", err)
+	}
+	return &fileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *fileSink) Write(_ context.Context, e *Event) error {
+	return s.enc.Encode(e)
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+// mqttSink publishes events to an MQTT topic.
+type mqttSink struct {
+	mu     sync.RWMutex
+	client mqtt.Client
+	topic  string
+	qos    byte
+}
+
+// SetClient replaces the MQTT client, it's used on the next event.
+func (s *mqttSink) SetClient(client mqtt.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.client = client
+}
+
+func (s *mqttSink) Write(ctx context.Context, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.RLock()
+	client := s.client
+	s.mu.RUnlock()
+	t := client.Publish(s.topic, s.qos, false, b)
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *mqttSink) Close() error {
+	return nil
+}
+
+// httpSink POSTs events to a webhook.
+type httpSink struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (s *httpSink) Write(ctx context.Context, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d of audit webhook", resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	return nil
+}
@@ -0,0 +1,179 @@
+// Package auth authenticates subscribers by JWT signed with HMAC SHA-256 (HS256).
+// See: https://datatracker.ietf.org/doc/html/rfc7519
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// leeway tolerates clock skew between token issuer and this server.
+const leeway = 30 * time.Second
+
+var (
+	// ErrNoToken is returned if request carries no token.
+	ErrNoToken = errors.New("no token")
+	// ErrInvalidToken is returned if token is malformed, not signed by the key or not issued by the issuer.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned if token is expired or not valid yet.
+	ErrExpiredToken = errors.New("token expired or not valid yet")
+)
+
+// Claims are claims of a subscriber token.
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+
+	// Tenant is the tenant of the client, its streams and egress accounting. It's required if multi-tenant.
+	Tenant string `json:"tenant,omitempty"`
+	// Streams restricts streams the subscriber may watch, empty means all.
+	Streams []Stream `json:"streams,omitempty"`
+	// Share is the ID of the sharing link the token is minted for, the link must be kept by the server, see package share.
+	Share string `json:"share,omitempty"`
+}
+
+// Stream is a stream a subscriber may watch.
+type Stream struct {
+	ID string `json:"id"`
+	// TrackSources restricts track sources of the machine, empty means all.
+	TrackSources []pb.TrackSource `json:"track_sources,omitempty"`
+}
+
+// Allow reports whether the subscriber may watch stream of meta. Nil claims allow all, as auth is disabled.
+func (c *Claims) Allow(meta *pb.Meta) bool {
+	if c == nil || len(c.Streams) == 0 {
+		return true
+	}
+	for _, stream := range c.Streams {
+		if stream.ID != meta.Id {
+			continue
+		}
+		if len(stream.TrackSources) == 0 {
+			return true
+		}
+		for _, trackSource := range stream.TrackSources {
+			if trackSource == meta.TrackSource {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator validates tokens of requests.
+type Authenticator struct {
+	key    []byte
+	issuer string
+}
+
+// New returns a new Authenticator, or nil if auth is disabled by an empty signing key.
+func New(config cfg.AuthConfigOptions) *Authenticator {
+	if config.SigningKey == "" {
+		return nil
+	}
+	return &Authenticator{
+		key:    []byte(config.SigningKey),
+		issuer: config.Issuer,
+	}
+}
+
+// Authenticate validates token of request r and returns its claims.
+// Token is taken from "Authorization: Bearer" header, or "token" query as browsers can't set headers of WebSocket.
+// A nil Authenticator returns nil claims without error.
+func (a *Authenticator) Authenticate(r *http.Request) (*Claims, error) {
+	if a == nil {
+		return nil, nil
+	}
+	token := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	if token == "" {
+		return nil, ErrNoToken
+	}
+	return a.Verify(token, time.Now())
+}
+
+// Verify verifies token at time now and returns its claims.
+func (a *Authenticator) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	// Only HS256 is accepted, in particular "none" must never be.
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not decode signature: %v", ErrInvalidToken, err)
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("%w: signature mismatched", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if claims.ExpiresAt != 0 && now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)) {
+		return nil, ErrExpiredToken
+	}
+	if claims.NotBefore != 0 && now.Before(time.Unix(claims.NotBefore, 0).Add(-leeway)) {
+		return nil, ErrExpiredToken
+	}
+	return &claims, nil
+}
+
+// Sign returns a token of claims signed by the key, e.g. for synthetic subscribers of this server.
+func (a *Authenticator) Sign(claims *Claims) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("could not marshal claims: %w", err)
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: could not decode segment: %v", ErrInvalidToken, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%w: could not unmarshal segment: %v", ErrInvalidToken, err)
+	}
+	return nil
+}
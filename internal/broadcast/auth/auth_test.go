@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// signRaw signs header and payload JSON by key as they are, so malformed tokens can be made.
+func signRaw(key, header, payload string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	a := New(cfg.AuthConfigOptions{SigningKey: "key", Issuer: "issuer"})
+	now := time.Unix(1_700_000_000, 0)
+	sign := func(claims *Claims) string {
+		token, err := a.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	const hs256 = `{"alg":"HS256","typ":"JWT"}`
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "valid", token: sign(&Claims{Issuer: "issuer", Subject: "viewer", ExpiresAt: now.Add(time.Minute).Unix()})},
+		{name: "no expiry", token: sign(&Claims{Issuer: "issuer"})},
+		{name: "expired within leeway", token: sign(&Claims{Issuer: "issuer", ExpiresAt: now.Add(-leeway / 2).Unix()})},
+		{name: "expired", token: sign(&Claims{Issuer: "issuer", ExpiresAt: now.Add(-2 * leeway).Unix()}), wantErr: ErrExpiredToken},
+		{name: "not valid yet within leeway", token: sign(&Claims{Issuer: "issuer", NotBefore: now.Add(leeway / 2).Unix()})},
+		{name: "not valid yet", token: sign(&Claims{Issuer: "issuer", NotBefore: now.Add(2 * leeway).Unix()}), wantErr: ErrExpiredToken},
+		{name: "unexpected issuer", token: sign(&Claims{Issuer: "other"}), wantErr: ErrInvalidToken},
+		{name: "signed by another key", token: signRaw("other", hs256, `{"iss":"issuer"}`), wantErr: ErrInvalidToken},
+		{name: "algorithm none", token: signRaw("key", `{"alg":"none"}`, `{"iss":"issuer"}`), wantErr: ErrInvalidToken},
+		{name: "unsigned", token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"issuer"}`)) + ".", wantErr: ErrInvalidToken},
+		{name: "malformed payload", token: signRaw("key", hs256, `{"iss":`), wantErr: ErrInvalidToken},
+		{name: "malformed signature", token: sign(&Claims{Issuer: "issuer"}) + "!", wantErr: ErrInvalidToken},
+		{name: "two segments", token: "a.b", wantErr: ErrInvalidToken},
+		{name: "empty", token: "", wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := a.Verify(tt.token, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && claims.Issuer != "issuer" {
+				t.Fatalf("Verify() issuer = %q, want issuer", claims.Issuer)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := New(cfg.AuthConfigOptions{SigningKey: "key"})
+	token, err := a.Sign(&Claims{Subject: "viewer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest("GET", "/v1/broadcast/signal?token="+token, nil)
+	if claims, err := a.Authenticate(r); err != nil || claims.Subject != "viewer" {
+		t.Fatalf("Authenticate() of query = %v, %v", claims, err)
+	}
+	// The header takes precedence over the query.
+	r.Header.Set("Authorization", "Bearer invalid")
+	if _, err := a.Authenticate(r); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Authenticate() of header error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := a.Authenticate(httptest.NewRequest("GET", "/", nil)); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("Authenticate() without token error = %v, want %v", err, ErrNoToken)
+	}
+	// Auth is disabled by a nil Authenticator.
+	if claims, err := New(cfg.AuthConfigOptions{}).Authenticate(r); claims != nil || err != nil {
+		t.Fatalf("Authenticate() of nil Authenticator = %v, %v", claims, err)
+	}
+}
+
+func TestClaimsAllow(t *testing.T) {
+	claims := &Claims{Streams: []Stream{
+		{ID: "a"},
+		{ID: "b", TrackSources: []pb.TrackSource{pb.TrackSource_DRONE}},
+	}}
+	tests := []struct {
+		claims *Claims
+		meta   *pb.Meta
+		want   bool
+	}{
+		{nil, &pb.Meta{Id: "x"}, true},
+		{&Claims{}, &pb.Meta{Id: "x"}, true},
+		{claims, &pb.Meta{Id: "a", TrackSource: pb.TrackSource_MONITOR}, true},
+		{claims, &pb.Meta{Id: "b", TrackSource: pb.TrackSource_DRONE}, true},
+		{claims, &pb.Meta{Id: "b", TrackSource: pb.TrackSource_MONITOR}, false},
+		{claims, &pb.Meta{Id: "x"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.claims.Allow(tt.meta); got != tt.want {
+			t.Errorf("%+v.Allow(%v) = %v, want %v", tt.claims, tt.meta, got, tt.want)
+		}
+	}
+}
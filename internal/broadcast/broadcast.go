@@ -2,61 +2,763 @@ package broadcast
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
 	"strconv"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	mqttclient "github.com/SB-IM/mqtt-client"
+	pb "github.com/SB-IM/pb/signal"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"github.com/SB-IM/skywalker/internal/broadcast/accounting"
+	"github.com/SB-IM/skywalker/internal/broadcast/acl"
+	"github.com/SB-IM/skywalker/internal/broadcast/admin"
+	"github.com/SB-IM/skywalker/internal/broadcast/audit"
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/canary"
+	"github.com/SB-IM/skywalker/internal/broadcast/cascade"
 	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/cluster"
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/cors"
+	"github.com/SB-IM/skywalker/internal/broadcast/demo"
+	"github.com/SB-IM/skywalker/internal/broadcast/directory"
+	"github.com/SB-IM/skywalker/internal/broadcast/health"
+	"github.com/SB-IM/skywalker/internal/broadcast/hls"
+	"github.com/SB-IM/skywalker/internal/broadcast/hooks"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
 	"github.com/SB-IM/skywalker/internal/broadcast/publisher"
+	"github.com/SB-IM/skywalker/internal/broadcast/record"
+	"github.com/SB-IM/skywalker/internal/broadcast/recovery"
+	"github.com/SB-IM/skywalker/internal/broadcast/rtmp"
+	"github.com/SB-IM/skywalker/internal/broadcast/rtsp"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/sessionstore"
+	"github.com/SB-IM/skywalker/internal/broadcast/share"
+	"github.com/SB-IM/skywalker/internal/broadcast/srt"
+	"github.com/SB-IM/skywalker/internal/broadcast/standby"
 	"github.com/SB-IM/skywalker/internal/broadcast/subscriber"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+	"github.com/SB-IM/skywalker/internal/broadcast/thumbnail"
+	"github.com/SB-IM/skywalker/internal/broadcast/tracing"
+	"github.com/SB-IM/skywalker/internal/broadcast/webhook"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
 )
 
+// unwindTimeout bounds unsubscribing MQTT topics after a failed start.
+const unwindTimeout = 5 * time.Second
+
 // Service consists of many sessions.
 type Service struct {
-	client   mqtt.Client
 	logger   zerolog.Logger
 	config   cfg.ConfigOptions
-	sessions sync.Map
-}
+	sessions *session.SessionManager
 
-func New(ctx context.Context, config *cfg.ConfigOptions) *Service {
-	return &Service{
-		client: mqttclient.FromContext(ctx),
-		logger: *log.Ctx(ctx),
-		config: *config,
-	}
+	// media is the ICE/UDP stack shared by publishers and subscribers, configured independently of signaling server.
+	media *webrtcx.Media
+	pub   *publisher.Publisher
+	sub   *subscriber.Subscriber
+
+	// sinks stores recordings per tenant.
+	sinks *record.Sinks
+	// recorder records live sessions to sinks.
+	recorder *record.Recorder
+	// pairing pairs this instance with a primary or standby one, it's nil if pairing is disabled.
+	pairing *standby.Pairing
+	// canary publishes and probes a synthetic session, it's nil if canary is disabled.
+	canary *canary.Canary
+	// hls serves sessions over LL-HLS, it's nil if HLS is disabled.
+	hls *hls.Gateway
+	// store shares metadata of local sessions with other instances.
+	store *sessionstore.Registry
+	// directory maps edge devices to regions hosting them, it's nil if the directory is disabled.
+	directory *directory.Directory
+	// cluster relays streams hosted by other instances, it's nil if clustering is disabled.
+	cluster *cluster.Cluster
+	// cascade relays streams of an upstream origin, it's nil unless running as an edge of a cascade.
+	cascade *cascade.Cascade
+	// audit records sessions and viewers to audit sinks, it's nil if audit is disabled.
+	audit *audit.Auditor
+	// webhooks notifies webhooks of streams starting and stopping, it's nil if webhooks are disabled.
+	webhooks *webhook.Notifier
+	// recovery persists sessions and recovers them after restarts, it's nil if recovery is disabled.
+	recovery *recovery.Recovery
+	// rtsp pulls RTSP cameras as sessions.
+	rtsp *rtsp.Puller
+	// tenants namespaces and limits streams of tenants, it's nil unless multi-tenant.
+	tenants *tenant.Tenants
+	// accountant accounts viewer egress for billing, it's nil if accounting is disabled.
+	accountant *accounting.Accountant
+	// shares are sharing links of streams minted by operators, it's nil if auth is disabled.
+	shares *share.Links
+	// health serves liveness and readiness probes.
+	health *health.Health
+	// middlewares wrap the signaling router and admin API, the first one is the outermost.
+	middlewares []func(http.Handler) http.Handler
+	// hooks are run at points of the lifecycle by Start, SetClient and Shutdown.
+	hooks map[HookPoint][]Hook
+	// extensions are hooks of extensions called by signaling, see package hooks.
+	extensions hooks.Hooks
+
+	// ctx is the context of started components, it's canceled by Shutdown.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// server serves signaling and admin API, it's nil until started.
+	server *http.Server
+	// healthServer serves health probes apart from signaling, it's nil if they are served by server.
+	healthServer *http.Server
+	// grpcServer serves gRPC signaling of edges, it's nil unless edges signal over gRPC and signaling started.
+	grpcServer *grpc.Server
+	// serving is 1 while server is serving and not shutting down, accessed atomically.
+	serving int32
+	// serveErr receives the error if server, healthServer or grpcServer stops serving before shutdown.
+	serveErr chan error
 }
 
-func (s *Service) Broadcast() error {
-	pub := publisher.New(s.client, &s.sessions, &s.logger, &cfg.PublisherConfigOptions{
+// New returns a new Service of config, signaling calls extensions in order, see package hooks.
+// It returns a *cfg.ValidationError if config is invalid.
+func New(ctx context.Context, config *cfg.ConfigOptions, extensions ...hooks.Hooks) (*Service, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	client := mqttclient.FromContext(ctx)
+	s := &Service{
+		logger:     *log.Ctx(ctx),
+		config:     *config,
+		extensions: hooks.Chain(extensions...),
+	}
+	// CORS is the outermost middleware, so preflights are answered before any middleware of embedders.
+	s.Use(cors.New(s.config.ServerConfigOptions).Handler)
+	media, err := webrtcx.NewMedia(s.config.WebRTCConfigOptions, &s.logger)
+	if err != nil {
+		return nil, fmt.Errorf("could not create media stack: %w", err)
+	}
+	s.media = media
+	s.sessions = session.NewSessionManager(s.config.TTL, &s.logger)
+	s.sessions.MonitorQuality(s.config.QualityConfigOptions)
+	s.sessions.RegisterMetrics(metrics.Default)
+	metrics.Default.RegisterConns(conns.Default)
+	s.pub = publisher.New(client, s.sessions, s.media, &s.logger, &cfg.PublisherConfigOptions{
 		MQTTClientConfigOptions: s.config.MQTTClientConfigOptions,
 		WebRTCConfigOptions:     s.config.WebRTCConfigOptions,
+		SessionConfigOptions:    s.config.SessionConfigOptions,
+		WHIPConfigOptions:       s.config.WHIPConfigOptions,
+		EdgeSignalConfigOptions: s.config.EdgeSignalConfigOptions,
 	})
-	pub.Signal()
-
-	sub := subscriber.New(s.client, &s.sessions, &s.logger, &cfg.SubscriberConfigOptions{
+	// Publishers of expired sessions are closed too, so their edges re-offer.
+	s.sessions.SetExpirer(s.pub.CloseSession)
+	s.sub = subscriber.New(client, s.sessions, s.media, &s.logger, &cfg.SubscriberConfigOptions{
 		MQTTClientConfigOptions: s.config.MQTTClientConfigOptions,
 		WebRTCConfigOptions:     s.config.WebRTCConfigOptions,
+		ServerConfigOptions:     s.config.ServerConfigOptions,
+		QuotaConfigOptions:      s.config.QuotaConfigOptions,
+		AuthConfigOptions:       s.config.AuthConfigOptions,
+		SLOConfigOptions:        s.config.SLOConfigOptions,
+
+		SubscriberMQTTConfigOptions: s.config.SubscriberMQTTConfigOptions,
+		RateLimitConfigOptions:      s.config.RateLimitConfigOptions,
+	})
+	s.accountant = accounting.New(s.config.AccountingConfigOptions)
+	s.sub.SetAccountant(s.accountant)
+	s.shares = share.New(auth.New(s.config.AuthConfigOptions), s.config.ShareConfigOptions)
+	s.sub.SetShares(s.shares)
+	s.pub.SetHooks(s.extensions)
+	s.sub.SetHooks(s.extensions)
+	return s, nil
+}
+
+// Start sets up components and starts serving signaling in background, it returns once the HTTP server listens.
+// Components run until Shutdown is called or ctx is done. If it fails, components started are stopped, so it may
+// be called again.
+func (s *Service) Start(ctx context.Context) error {
+	if s.server != nil {
+		return errors.New("service already started")
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.ctx = ctx
+	if err := s.start(ctx); err != nil {
+		s.cancel()
+		s.unwind()
+		return err
+	}
+	return nil
+}
+
+// unwind stops components left running by a failed start, so that Start may be retried: MQTT topics of
+// signaling are unsubscribed and listeners are closed. Components run with the context of start are stopped by
+// canceling it.
+func (s *Service) unwind() {
+	ctx, cancel := context.WithTimeout(context.Background(), unwindTimeout)
+	defer cancel()
+	if err := s.pub.Unsubscribe(ctx); err != nil {
+		s.logger.Err(err).Msg("could not unsubscribe publisher after failed start")
+	}
+	if err := s.sub.Unsubscribe(ctx); err != nil {
+		s.logger.Err(err).Msg("could not unsubscribe subscriber after failed start")
+	}
+	if s.grpcServer != nil {
+		s.grpcServer.Stop()
+		s.grpcServer = nil
+	}
+	if s.healthServer != nil {
+		_ = s.healthServer.Close()
+		s.healthServer = nil
+	}
+	if s.server != nil {
+		atomic.StoreInt32(&s.serving, 0)
+		_ = s.server.Close()
+		s.server = nil
+	}
+}
+
+func (s *Service) start(ctx context.Context) error {
+	// Sessions are keyed by tenant before any of them is added.
+	if s.config.MultiTenant {
+		tenants, err := tenant.New(s.sessions, s.config.TenantConfigOptions)
+		if err != nil {
+			return fmt.Errorf("invalid tenant options: %w", err)
+		}
+		s.tenants = tenants
+		s.sessions.SetNamer(tenant.Namer)
+		s.pub.SetTenants(tenants)
+		s.sub.SetTenants(tenants)
+	}
+	s.serveErr = make(chan error, 3)
+	if err := s.runHooks(ctx, AfterMQTTConnect); err != nil {
+		return err
+	}
+
+	sinks, err := record.NewSinks(s.config.Sinks)
+	if err != nil {
+		return fmt.Errorf("invalid recording sinks: %w", err)
+	}
+	s.sinks = sinks
+	s.recorder = record.NewRecorder(s.sessions, s.sinks, &s.logger, s.config.RecordingConfigOptions)
+	go s.recorder.Run(ctx)
+	go s.pub.Hibernate(ctx)
+	if len(s.config.AuditSinks) > 0 {
+		if s.audit, err = audit.New(
+			mqttclient.FromContext(ctx),
+			&s.logger,
+			s.config.Instance,
+			byte(s.config.Qos),
+			s.config.AuditConfigOptions,
+		); err != nil {
+			return fmt.Errorf("invalid audit options: %w", err)
+		}
+		s.sub.SetAudit(s.audit)
+		go s.audit.Run(ctx, s.sessions)
+	}
+	if len(s.config.Webhooks) > 0 {
+		if s.webhooks, err = webhook.New(s.sessions, &s.logger, s.config.Region, s.config.WebhookConfigOptions); err != nil {
+			return fmt.Errorf("invalid webhook options: %w", err)
+		}
+		go s.webhooks.Run(ctx)
+	}
+	go hooks.WatchSessions(ctx, s.sessions, s.extensions)
+	go s.shares.Run(ctx)
+
+	if s.config.PushURL != "" {
+		pusher, err := metrics.NewPusher(metrics.Default, s.config.MetricsConfigOptions, &s.logger)
+		if err != nil {
+			return fmt.Errorf("invalid metrics push options: %w", err)
+		}
+		go pusher.Run(ctx)
+	}
+	if s.config.TracingEndpoint != "" {
+		exporter, err := tracing.NewExporter(s.config.TracingConfigOptions, &s.logger)
+		if err != nil {
+			return fmt.Errorf("invalid tracing options: %w", err)
+		}
+		tracing.Default.SetExporter(exporter, s.config.TracingSampleRatio)
+		go exporter.Run(ctx)
+	}
+
+	if s.config.Role != "" {
+		if s.pairing, err = standby.New(mqttclient.FromContext(ctx), s.sessions, &s.logger, s.config.StandbyConfigOptions); err != nil {
+			return fmt.Errorf("invalid standby options: %w", err)
+		}
+		go s.pairing.Run(ctx, func(mirrored []*pb.Meta) { s.takeover(ctx, mirrored) })
+	}
+	if s.store, err = sessionstore.New(s.sessions, &s.logger, s.config.SessionConfigOptions); err != nil {
+		return fmt.Errorf("invalid session store options: %w", err)
+	}
+	go s.store.Run(ctx)
+	if s.config.Directory != "" {
+		if s.directory, err = directory.New(s.sessions, &s.logger, s.config.Region, s.config.DirectoryConfigOptions); err != nil {
+			return fmt.Errorf("invalid directory options: %w", err)
+		}
+		s.sub.SetDirectory(s.directory)
+		go s.directory.Run(ctx)
+	}
+	if s.config.Cluster {
+		if s.cluster, err = cluster.New(
+			mqttclient.FromContext(ctx),
+			s.sessions,
+			s.directory,
+			&s.logger,
+			s.config.AuthConfigOptions,
+			s.config.ClusterConfigOptions,
+		); err != nil {
+			return fmt.Errorf("invalid cluster options: %w", err)
+		}
+		s.sub.SetCluster(s.cluster)
+		go s.cluster.Run(ctx)
+	}
+	if s.config.Upstream != "" {
+		if s.cascade, err = cascade.New(s.sessions, &s.logger, s.config.CascadeConfigOptions); err != nil {
+			return fmt.Errorf("invalid cascade options: %w", err)
+		}
+		go s.cascade.Run(ctx)
+	}
+	a, err := acl.New(s.config.ACLConfigOptions)
+	if err != nil {
+		return fmt.Errorf("invalid ACL options: %w", err)
+	}
+	s.sub.SetACL(a)
+	if s.rtsp, err = rtsp.New(s.sessions, &s.logger, s.config.RTSPConfigOptions); err != nil {
+		return fmt.Errorf("invalid RTSP options: %w", err)
+	}
+	// SRT callers and RTMP encoders push streams, so they are accepted by a standby too, e.g. failed over to it.
+	if s.config.SRTPort != 0 {
+		listener, err := srt.New(s.sessions, &s.logger, s.config.SRTConfigOptions)
+		if err != nil {
+			return fmt.Errorf("invalid SRT options: %w", err)
+		}
+		go listener.Run(ctx)
+	}
+	if s.config.RTMPPort != 0 {
+		server, err := rtmp.New(s.sessions, &s.logger, s.config.RTMPConfigOptions)
+		if err != nil {
+			return fmt.Errorf("invalid RTMP options: %w", err)
+		}
+		go server.Run(ctx)
+	}
+	if s.health, err = health.New(&s.logger, s.config.HealthConfigOptions); err != nil {
+		return fmt.Errorf("invalid health options: %w", err)
+	}
+	s.addHealthChecks()
+	go s.health.Run(ctx)
+	if s.config.Thumbnails {
+		thumbnails, err := thumbnail.New(s.sessions, &s.logger, s.config.ThumbnailConfigOptions)
+		if err != nil {
+			return fmt.Errorf("invalid thumbnail options: %w", err)
+		}
+		s.sub.SetThumbnails(thumbnails)
+		go thumbnails.Run(ctx)
+	}
+	s.sub.WatchCapabilities()
+	var recovered []*pb.Meta
+	if s.config.StateFile != "" {
+		if s.recovery, err = recovery.New(s.sessions, &s.logger, s.config.RecoveryConfigOptions); err != nil {
+			return fmt.Errorf("invalid recovery options: %w", err)
+		}
+		if recovered, err = s.recovery.Load(); err != nil {
+			return err
+		}
+		go s.recovery.Run(ctx)
+	}
+	// A standby starts signaling edges and pulling cameras after taking over.
+	// A relay of a cascade publishes streams of upstream only, so it doesn't answer edges sharing the broker.
+	if s.config.Role != standby.RoleStandby && s.cascade == nil {
+		if err := s.signal(ctx); err != nil {
+			return err
+		}
+		go s.rtsp.Run(ctx)
+		if s.recovery != nil {
+			go s.recovery.Resignal(ctx, recovered, s.pub.Resignal)
+		}
+	}
+
+	mux := http.NewServeMux()
+	if s.config.HealthPort == 0 {
+		s.handleHealth(mux)
+	}
+	mux.Handle("/", s.signalHandler())
+	recordings := s.wrap(s.recorder.Handler())
+	mux.Handle("/v1/broadcast/recordings", recordings) // Recording admin API.
+	mux.Handle("/v1/broadcast/recordings/", recordings)
+	rtspSources := s.wrap(s.rtsp.Handler())
+	mux.Handle("/v1/broadcast/rtsp", rtspSources) // RTSP source admin API.
+	mux.Handle("/v1/broadcast/rtsp/", rtspSources)
+	if s.config.WHIP {
+		mux.Handle("/v1/broadcast/whip/", s.wrap(s.pub.WHIPHandler())) // WHIP for standard encoders.
+	}
+	if s.config.AdminToken != "" {
+		adminAPI := admin.New(s.sessions, s.pub, s.sub, s.tenants, s.accountant, s.shares, s.store, &s.logger, s.config.AdminConfigOptions)
+		mux.Handle("/v1/admin/", s.wrap(adminAPI.Handler())) // Operator actions.
+		if s.config.HealthPort == 0 {
+			// Prometheus metrics, scraped with the admin token unless served apart from signaling.
+			mux.Handle("/metrics", s.wrap(adminAPI.Authorize(metrics.Default.Handler())))
+		}
+	}
+	if s.directory != nil {
+		mux.Handle("/v1/broadcast/directory/", s.wrap(s.directory.Handler())) // Edge device lookup across regions.
+	}
+	if s.cluster != nil {
+		mux.Handle("/v1/broadcast/cluster", s.wrap(s.cluster.Handler())) // Instances of the cluster.
+	}
+	if s.cascade != nil {
+		mux.Handle("/v1/broadcast/cascade", s.wrap(s.cascade.Handler())) // Streams relayed from upstream.
+	}
+	if s.config.Demo {
+		player, err := demo.New(s.sessions, &s.logger, s.config.DemoConfigOptions)
+		if err != nil {
+			return fmt.Errorf("invalid demo options: %w", err)
+		}
+		mux.Handle(demo.Path, s.wrap(player.Handler())) // Demo player for debug and demos.
+	}
+	if s.config.HLS {
+		s.hls = hls.New(s.sessions, &s.logger, s.config.AuthConfigOptions, s.config.HLSConfigOptions)
+		s.hls.SetShares(s.shares)
+		go s.hls.Run(ctx)
+		mux.Handle("/v1/broadcast/hls/", s.wrap(s.hls.Handler())) // LL-HLS for viewers without WebRTC.
+	}
+	if s.config.Canary {
+		// A standby reports down until it takes over, as publisher doesn't signal before.
+		if s.canary, err = canary.New(
+			mqttclient.FromContext(ctx),
+			s.signalHandler(),
+			&s.logger,
+			s.config.MQTTClientConfigOptions,
+			s.config.AuthConfigOptions,
+			s.config.CanaryConfigOptions,
+		); err != nil {
+			return fmt.Errorf("invalid canary options: %w", err)
+		}
+		mux.Handle("/v1/broadcast/canary", s.canary.Handler()) // Canary probe status.
+		go func() {
+			if err := s.canary.Run(ctx); err != nil {
+				s.logger.Err(err).Msg("canary stopped")
+			}
+		}()
+	}
+
+	server := s.newServer(mux)
+	if server.TLSConfig, err = s.tlsConfig(); err != nil {
+		return fmt.Errorf("invalid TLS options: %w", err)
+	}
+	if err := s.runHooks(ctx, BeforeListen); err != nil {
+		return err
+	}
+	// Listen explicitly as keep-alive period of ListenAndServe is not configurable.
+	ln, err := (&net.ListenConfig{KeepAlive: s.config.TCPKeepAlive}).Listen(ctx, "tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", server.Addr, err)
+	}
+	s.logger.Info().
+		Str("host", s.config.Host).
+		Int("port", s.config.Port).
+		Bool("tls", server.TLSConfig != nil).
+		Msg("starting HTTP server")
+	s.server = server
+	atomic.StoreInt32(&s.serving, 1)
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			// Certificates are loaded in TLSConfig already.
+			err = server.ServeTLS(ln, "", "")
+		} else {
+			err = server.Serve(ln)
+		}
+		atomic.StoreInt32(&s.serving, 0)
+		if !errors.Is(err, http.ErrServerClosed) {
+			s.serveErr <- err
+		}
+	}()
+	if s.config.HealthPort != 0 {
+		return s.serveHealth(ctx)
+	}
+	return nil
+}
+
+// addHealthChecks adds readiness checks of MQTT broker connectivity and HTTP server,
+// and heartbeats of publisher, subscriber and sessions run by watchdog.
+func (s *Service) addHealthChecks() {
+	s.health.AddCheck("mqtt", func() error {
+		if !s.pub.Connected() {
+			return errors.New("MQTT broker not connected")
+		}
+		return nil
+	})
+	s.health.AddCheck("http", func() error {
+		if atomic.LoadInt32(&s.serving) == 0 {
+			return errors.New("HTTP server not serving")
+		}
+		return nil
 	})
-	handler := sub.Signal()
+	s.health.AddHeartbeat("publisher", s.pub.Heartbeat)
+	s.health.AddHeartbeat("subscriber", s.sub.Heartbeat)
+	s.health.AddHeartbeat("sessions", func() { s.sessions.List() })
+}
+
+// handleHealth registers health probes on mux, they are not wrapped by middlewares.
+func (s *Service) handleHealth(mux *http.ServeMux) {
+	mux.Handle("/healthz", s.health.LiveHandler()) // Liveness probe.
+	mux.Handle("/readyz", s.health.ReadyHandler()) // Readiness probe.
+}
+
+// serveHealth serves health probes and Prometheus metrics on HealthPort in background, in plain HTTP as kubelet
+// probes do. The port is internal, so metrics are served without the admin token.
+func (s *Service) serveHealth(ctx context.Context) error {
+	mux := http.NewServeMux()
+	s.handleHealth(mux)
+	mux.Handle("/metrics", metrics.Default.Handler()) // Prometheus metrics.
+	server := s.newServer(mux)
+	server.Addr = net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.HealthPort))
+	ln, err := (&net.ListenConfig{KeepAlive: s.config.TCPKeepAlive}).Listen(ctx, "tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", server.Addr, err)
+	}
+	s.logger.Info().Int("port", s.config.HealthPort).Msg("starting health server")
+	s.healthServer = server
+	go func() {
+		if err := server.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			s.serveErr <- err
+		}
+	}()
+	return nil
+}
+
+// ServeErr returns a channel receiving the error if the HTTP server stops serving before Shutdown.
+// It must be called after Start.
+func (s *Service) ServeErr() <-chan error {
+	return s.serveErr
+}
+
+// Use appends middlewares applied to the signaling router and admin API, e.g. for authentication, tracing
+// or security headers of embedders. The first middleware is the outermost, and they must be added before Start is called.
+func (s *Service) Use(middlewares ...func(http.Handler) http.Handler) {
+	s.middlewares = append(s.middlewares, middlewares...)
+}
+
+// signalHandler returns the signaling router wrapped by middlewares.
+func (s *Service) signalHandler() http.Handler {
+	return s.wrap(s.sub.Signal())
+}
+
+// wrap wraps h by middlewares.
+func (s *Service) wrap(h http.Handler) http.Handler {
+	for i := len(s.middlewares) - 1; i >= 0; i-- {
+		h = s.middlewares[i](h)
+	}
+	return h
+}
+
+// takeover starts signaling and pulling cameras after this standby takes over from a failed primary,
+// and asks edges of mirrored sessions to re-signal.
+func (s *Service) takeover(ctx context.Context, mirrored []*pb.Meta) {
+	if err := s.signal(ctx); err != nil {
+		s.logger.Err(err).Msg("could not start signaling after takeover")
+		s.serveErr <- err
+		return
+	}
+	go s.rtsp.Run(ctx)
+	for _, meta := range mirrored {
+		s.pub.Resignal(meta)
+	}
+}
+
+// signal starts signaling of publishers over MQTT or gRPC, and MQTT signaling of subscribers if enabled.
+func (s *Service) signal(ctx context.Context) error {
+	if s.config.EdgeSignal == publisher.EdgeSignalGRPC {
+		if err := s.serveGRPC(ctx); err != nil {
+			return err
+		}
+	} else {
+		s.pub.Signal()
+	}
+	if s.config.MQTTSignal {
+		s.sub.SignalMQTT()
+	}
+	return nil
+}
+
+// serveGRPC serves gRPC signaling of edges on GRPCPort in background, over TLS if signaling server has TLS.
+func (s *Service) serveGRPC(ctx context.Context) error {
+	var opts []grpc.ServerOption
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return fmt.Errorf("invalid TLS options: %w", err)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	s.pub.RegisterGRPC(server)
 
-	server := s.newServer(handler)
-	s.logger.Info().Str("host", s.config.Host).Int("port", s.config.Port).Msg("starting HTTP server")
-	return server.ListenAndServe()
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.GRPCPort))
+	ln, err := (&net.ListenConfig{KeepAlive: s.config.TCPKeepAlive}).Listen(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %s: %w", addr, err)
+	}
+	s.logger.Info().Int("port", s.config.GRPCPort).Bool("tls", tlsConfig != nil).Msg("starting gRPC signaling server")
+	s.grpcServer = server
+	go func() {
+		// Serve returns nil once stopped.
+		if err := server.Serve(ln); err != nil {
+			s.serveErr <- err
+		}
+	}()
+	return nil
+}
+
+// stopGRPC stops gRPC signaling, streams still signaling are given until ctx is done.
+func (s *Service) stopGRPC(ctx context.Context) {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+}
+
+// tlsConfig returns TLS config of signaling server, or nil if TLS is disabled.
+func (s *Service) tlsConfig() (*tls.Config, error) {
+	if s.config.TLSCert == "" && s.config.TLSKey == "" {
+		if s.config.TLSClientCA != "" {
+			return nil, errors.New("client CA requires TLS certificate and key")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(s.config.TLSCert, s.config.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if s.config.TLSClientCA != "" {
+		pem, err := os.ReadFile(s.config.TLSClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in client CA")
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// Shutdown runs BeforeDrain hooks, stops accepting new signaling, then closes WebSocket connections,
+// unsubscribes MQTT topics and closes peer connections before ctx is done, and in ShutdownTimeout if set.
+// Components started are stopped at last.
+func (s *Service) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return errors.New("service not started")
+	}
+	defer s.cancel()
+	if s.config.ShutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.ShutdownTimeout)
+		defer cancel()
+	}
+	s.logger.Info().Dur("timeout", s.config.ShutdownTimeout).Msg("shutting down")
+
+	// Readiness fails from now on, so no new viewers are routed here while draining.
+	atomic.StoreInt32(&s.serving, 0)
+	if err := s.runHooks(ctx, BeforeDrain); err != nil {
+		s.logger.Err(err).Msg("draining anyway")
+	}
+	// Hijacked WebSocket connections are not tracked by HTTP server, they are closed by subscriber.
+	if err := s.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("could not shut down HTTP server: %w", err)
+	}
+	if s.grpcServer != nil {
+		s.stopGRPC(ctx)
+	}
+	if err := s.sub.Close(ctx); err != nil {
+		return err
+	}
+	if err := s.pub.Close(ctx); err != nil {
+		return err
+	}
+	s.sessions.Close()
+	if err := s.media.Close(); err != nil {
+		s.logger.Err(err).Msg("could not close media sockets")
+	}
+	// Health server is shut down at last, so liveness is reported while draining.
+	if s.healthServer != nil {
+		if err := s.healthServer.Shutdown(ctx); err != nil {
+			return fmt.Errorf("could not shut down health server: %w", err)
+		}
+	}
+	s.logger.Info().Msg("shut down gracefully")
+	return nil
+}
+
+// Reload applies options of config safe to change at runtime, i.e. ICE servers and ACL, others are ignored.
+// Peer connections created afterwards use them, established ones are kept. Nothing is applied if config or its
+// ACL is invalid.
+func (s *Service) Reload(config *cfg.ConfigOptions) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	a, err := acl.New(config.ACLConfigOptions)
+	if err != nil {
+		return fmt.Errorf("invalid ACL options: %w", err)
+	}
+	s.media.SetICEServers(config.WebRTCConfigOptions)
+	s.sub.SetACL(a)
+	s.logger.Info().Int("ice_servers", len(s.media.ICEServers())).Bool("acl", a != nil).Msg("reloaded config")
+	return nil
+}
+
+// SetClient switches MQTT signaling of publishers and subscribers to the given client.
+// It's used when MQTT credentials are rotated, and disconnecting the old client is up to the caller.
+// Live WebRTC sessions are kept untouched.
+func (s *Service) SetClient(client mqtt.Client) {
+	s.pub.SetClient(client)
+	s.sub.SetClient(client)
+	if s.pairing != nil {
+		s.pairing.SetClient(client)
+	}
+	if s.canary != nil {
+		s.canary.SetClient(client)
+	}
+	if s.audit != nil {
+		s.audit.SetClient(client)
+	}
+	if s.cluster != nil {
+		s.cluster.SetClient(client)
+	}
+	s.logger.Info().Msg("switched to new MQTT client")
+	if s.ctx == nil {
+		return
+	}
+	if err := s.runHooks(s.ctx, AfterMQTTConnect); err != nil {
+		s.logger.Err(err).Msg("hooks of new MQTT client failed")
+	}
 }
 
 func (s *Service) newServer(handler http.Handler) *http.Server {
 	return &http.Server{
 		Handler: handler,
-		Addr:    s.config.Host + ":" + strconv.Itoa(s.config.Port),
+		Addr:    net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port)),
 		// Good practice: enforce timeouts for servers you create!
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
+		ReadTimeout:       s.config.ReadTimeout,
+		ReadHeaderTimeout: s.config.ReadHeaderTimeout,
+		WriteTimeout:      s.config.WriteTimeout,
+		IdleTimeout:       s.config.IdleTimeout,
 	}
 }
@@ -0,0 +1,194 @@
+// Package canary publishes a synthetic color bars session and probes it with a synthetic subscriber,
+// giving continuous proof that signaling and media paths of an instance work, e.g. for release validation.
+//
+// The synthetic edge signals publisher over MQTT as a real edge does, and the synthetic subscriber signals
+// over WebSocket with the signaling handler served on loopback, so both go through the same code as real peers.
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+const (
+	// tenant of synthetic subscriber, so its egress is accounted apart from viewers.
+	tenant = "canary"
+
+	// tokenTTL is lifetime of tokens of synthetic subscriber if auth is enabled.
+	tokenTTL = 5 * time.Minute
+)
+
+// Canary runs a synthetic edge and a synthetic subscriber of the canary session.
+type Canary struct {
+	client     mqtt.Client
+	clientMux  sync.RWMutex
+	logger     zerolog.Logger
+	mqttConfig cfg.MQTTClientConfigOptions
+	config     cfg.CanaryConfigOptions
+
+	meta *pb.Meta
+	// signal is the subscriber signaling handler joined by synthetic subscriber.
+	signal http.Handler
+	// auth signs tokens of synthetic subscriber, it's nil if auth is disabled.
+	auth *auth.Authenticator
+	// issuer is the expected issuer of tokens.
+	issuer string
+
+	statusMux sync.RWMutex
+	status    Status
+}
+
+// Status is the result of canary probes.
+type Status struct {
+	ID       string `json:"id"`
+	Up       bool   `json:"up"` // Whether the last probe received media.
+	Probes   int    `json:"probes"`
+	Failures int    `json:"failures"`
+
+	LastProbe *time.Time `json:"last_probe,omitempty"`
+	// Latency is milliseconds from offer to first media of the last probe, zero if it failed.
+	Latency int64  `json:"latency_ms"`
+	Error   string `json:"error,omitempty"`
+}
+
+// New returns a new Canary, signal is the subscriber signaling handler.
+func New(
+	client mqtt.Client,
+	signal http.Handler,
+	logger *zerolog.Logger,
+	mqttConfig cfg.MQTTClientConfigOptions,
+	authConfig cfg.AuthConfigOptions,
+	config cfg.CanaryConfigOptions,
+) (*Canary, error) {
+	if config.CanaryID == "" {
+		return nil, errors.New("empty canary ID")
+	}
+	if config.ProbeInterval <= 0 || config.ProbeTimeout <= 0 {
+		return nil, errors.New("probe interval and timeout must be positive")
+	}
+	l := loglevel.Default.Component(logger, "Canary")
+	return &Canary{
+		client:     client,
+		logger:     l,
+		mqttConfig: mqttConfig,
+		config:     config,
+		meta: &pb.Meta{
+			Id:          config.CanaryID,
+			TrackSource: pb.TrackSource_DRONE,
+		},
+		signal: signal,
+		auth:   auth.New(authConfig),
+		issuer: authConfig.Issuer,
+		status: Status{ID: config.CanaryID},
+	}, nil
+}
+
+// SetClient replaces the MQTT client of synthetic edge, it's used on the next offer.
+func (c *Canary) SetClient(client mqtt.Client) {
+	c.clientMux.Lock()
+	defer c.clientMux.Unlock()
+	c.client = client
+}
+
+func (c *Canary) mqttClient() mqtt.Client {
+	c.clientMux.RLock()
+	defer c.clientMux.RUnlock()
+	return c.client
+}
+
+// Run publishes the canary session and probes it in ProbeInterval until ctx is done.
+func (c *Canary) Run(ctx context.Context) error {
+	// Signaling handler is served on loopback, so probes don't depend on TLS and address of the public server.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("could not listen on loopback: %w", err)
+	}
+	server := &http.Server{Handler: c.signal}
+	go func() {
+		if err := server.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			c.logger.Err(err).Msg("loopback signaling server failed")
+		}
+	}()
+	defer server.Close()
+	c.logger.Info().Str("id", c.config.CanaryID).Str("address", ln.Addr().String()).Msg("started canary")
+
+	go c.publish(ctx)
+
+	ticker := time.NewTicker(c.config.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			latency, err := c.probe(ctx, "ws://"+ln.Addr().String())
+			if ctx.Err() != nil {
+				return nil
+			}
+			c.report(latency, err)
+		}
+	}
+}
+
+// report records result of a probe.
+func (c *Canary) report(latency time.Duration, err error) {
+	now := time.Now()
+	c.statusMux.Lock()
+	defer c.statusMux.Unlock()
+
+	c.status.Probes++
+	c.status.LastProbe = &now
+	if err != nil {
+		c.status.Up = false
+		c.status.Failures++
+		c.status.Latency = 0
+		c.status.Error = err.Error()
+		metrics.CanaryProbes.WithLabelValues("failure").Inc()
+		metrics.CanaryUp.Set(0)
+		c.logger.Warn().Err(err).Msg("canary probe failed")
+		return
+	}
+	c.status.Up = true
+	c.status.Latency = latency.Milliseconds()
+	c.status.Error = ""
+	metrics.CanaryProbes.WithLabelValues("success").Inc()
+	metrics.CanaryUp.Set(1)
+	c.logger.Debug().Dur("latency", latency).Msg("canary probe succeeded")
+}
+
+// Status returns the result of canary probes.
+func (c *Canary) Status() Status {
+	c.statusMux.RLock()
+	defer c.statusMux.RUnlock()
+	return c.status
+}
+
+// Handler serves status of canary probes, it responds 503 Service Unavailable unless the last probe succeeded,
+// so deployments can gate releases on it.
+func (c *Canary) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := c.Status()
+		w.Header().Set("Content-Type", "application/json")
+		if !status.Up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			c.logger.Err(err).Msg("could not write canary status JSON")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+
+	"github.com/SB-IM/skywalker/internal/edge"
+)
+
+const (
+	// frameInterval is the interval of test pattern frames, 10 fps.
+	frameInterval = 100 * time.Millisecond
+	// gop is frames from a keyframe to the next one, so a probe receives a keyframe every second.
+	gop = 10
+
+	// republishInterval is the interval of synthetic edge offering again after its peer connection is gone.
+	republishInterval = 5 * time.Second
+)
+
+// publish runs the synthetic edge, which offers the test pattern to publisher over MQTT and streams it
+// until its peer connection is gone, then offers again until ctx is done.
+func (c *Canary) publish(ctx context.Context) {
+	for {
+		err := c.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		c.logger.Warn().Err(err).Msg("canary edge stopped, offering again")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(republishInterval):
+		}
+	}
+}
+
+// stream signals a peer connection of the test pattern and writes frames until it's gone or ctx is done.
+func (c *Canary) stream(ctx context.Context) error {
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return fmt.Errorf("could not create PeerConnection: %w", err)
+	}
+	defer peerConnection.Close()
+
+	track, err := webrtc.NewTrackLocalStaticSample(
+		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000},
+		"video",
+		"canary",
+	)
+	if err != nil {
+		return fmt.Errorf("could not create video track: %w", err)
+	}
+	rtpSender, err := peerConnection.AddTrack(track)
+	if err != nil {
+		return fmt.Errorf("could not add video track: %w", err)
+	}
+	// Read RTCP so interceptors work.
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			if _, _, err := rtpSender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	gone := make(chan struct{})
+	var goneOnce sync.Once
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		c.logger.Debug().Str("state", state.String()).Msg("canary edge peer connection state changed")
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			goneOnce.Do(func() { close(gone) })
+		}
+	})
+
+	if err := c.signalEdge(ctx, peerConnection); err != nil {
+		return err
+	}
+	c.logger.Info().Msg("canary edge signaled")
+
+	p := newPattern(gop)
+	ticker := time.NewTicker(frameInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-gone:
+			return errors.New("peer connection is gone")
+		case <-ticker.C:
+			if err := track.WriteSample(media.Sample{Data: p.next(), Duration: frameInterval}); err != nil {
+				return fmt.Errorf("could not write sample: %w", err)
+			}
+		}
+	}
+}
+
+// signalEdge offers to publisher over MQTT as an edge does, and sets the answer and candidates of publisher.
+func (c *Canary) signalEdge(ctx context.Context, peerConnection *webrtc.PeerConnection) error {
+	ctx, cancel := context.WithTimeout(ctx, c.config.ProbeTimeout)
+	defer cancel()
+	return edge.Signal(ctx, c.mqttClient(), c.mqttConfig, c.meta, peerConnection, &c.logger)
+}
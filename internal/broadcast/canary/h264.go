@@ -0,0 +1,227 @@
+package canary
+
+// Test pattern is encoded as H264 constrained baseline without any encoder dependency:
+// keyframes carry raw color bars in I_PCM macroblocks, and the frames in between skip all macroblocks.
+// See ITU-T H.264 sections 7.3 and 7.4.
+const (
+	patternWidthMBs  = 10 // 160 pixels
+	patternHeightMBs = 6  // 96 pixels
+	patternMBs       = patternWidthMBs * patternHeightMBs
+
+	// log2MaxFrameNum is log2 of MaxFrameNum, frame_num of frames between keyframes must not reach it.
+	log2MaxFrameNum = 4
+
+	nalSPS     = 7
+	nalPPS     = 8
+	nalIDR     = 5
+	nalNonIDR  = 1
+	mbTypeIPCM = 25
+)
+
+// colorBars are Y, Cb and Cr of 75% SMPTE color bars in BT.601:
+// white, yellow, cyan, green, magenta, red, blue and black.
+var colorBars = [][3]byte{
+	{180, 128, 128},
+	{162, 44, 142},
+	{131, 156, 44},
+	{112, 72, 58},
+	{84, 184, 198},
+	{65, 100, 212},
+	{35, 212, 114},
+	{16, 128, 128},
+}
+
+// pattern generates access units of a color bars stream in Annex B byte stream format.
+type pattern struct {
+	gop      int // Frames from a keyframe to the next one.
+	frame    int
+	idrPicID uint
+}
+
+// newPattern returns a pattern with a keyframe every gop frames.
+func newPattern(gop int) *pattern {
+	if gop < 1 {
+		gop = 1
+	}
+	if gop > 1<<log2MaxFrameNum {
+		gop = 1 << log2MaxFrameNum
+	}
+	return &pattern{gop: gop}
+}
+
+// next returns the next access unit. A keyframe is led by SPS and PPS so subscribers can join at it.
+func (p *pattern) next() []byte {
+	frameNum := p.frame % p.gop
+	p.frame++
+
+	if frameNum != 0 {
+		return nalUnit(2, nalNonIDR, skipSlice(uint(frameNum)))
+	}
+	p.idrPicID = (p.idrPicID + 1) % 2 // Consecutive IDR pictures must differ in idr_pic_id.
+	au := append(nalUnit(3, nalSPS, sps()), nalUnit(3, nalPPS, pps())...)
+	return append(au, nalUnit(3, nalIDR, pcmSlice(p.idrPicID))...)
+}
+
+func sps() []byte {
+	var w bitWriter
+	w.writeBits(66, 8)   // profile_idc: baseline
+	w.writeBits(0xc0, 8) // constraint_set0_flag and constraint_set1_flag: constrained baseline
+	w.writeBits(30, 8)   // level_idc: 3.0
+	w.writeUE(0)         // seq_parameter_set_id
+	w.writeUE(log2MaxFrameNum - 4)
+	w.writeUE(2)      // pic_order_cnt_type: output order is decoding order
+	w.writeUE(1)      // max_num_ref_frames
+	w.writeBits(0, 1) // gaps_in_frame_num_value_allowed_flag
+	w.writeUE(patternWidthMBs - 1)
+	w.writeUE(patternHeightMBs - 1)
+	w.writeBits(1, 1) // frame_mbs_only_flag
+	w.writeBits(1, 1) // direct_8x8_inference_flag
+	w.writeBits(0, 1) // frame_cropping_flag
+	w.writeBits(0, 1) // vui_parameters_present_flag
+	return w.rbsp()
+}
+
+func pps() []byte {
+	var w bitWriter
+	w.writeUE(0)      // pic_parameter_set_id
+	w.writeUE(0)      // seq_parameter_set_id
+	w.writeBits(0, 1) // entropy_coding_mode_flag: CAVLC
+	w.writeBits(0, 1) // bottom_field_pic_order_in_frame_present_flag
+	w.writeUE(0)      // num_slice_groups_minus1
+	w.writeUE(0)      // num_ref_idx_l0_default_active_minus1
+	w.writeUE(0)      // num_ref_idx_l1_default_active_minus1
+	w.writeBits(0, 1) // weighted_pred_flag
+	w.writeBits(0, 2) // weighted_bipred_idc
+	w.writeSE(0)      // pic_init_qp_minus26
+	w.writeSE(0)      // pic_init_qs_minus26
+	w.writeSE(0)      // chroma_qp_index_offset
+	w.writeBits(1, 1) // deblocking_filter_control_present_flag
+	w.writeBits(0, 1) // constrained_intra_pred_flag
+	w.writeBits(0, 1) // redundant_pic_cnt_present_flag
+	return w.rbsp()
+}
+
+// pcmSlice returns an IDR slice of color bars in I_PCM macroblocks.
+func pcmSlice(idrPicID uint) []byte {
+	var w bitWriter
+	w.writeUE(0)                    // first_mb_in_slice
+	w.writeUE(7)                    // slice_type: I, all slices of the picture
+	w.writeUE(0)                    // pic_parameter_set_id
+	w.writeBits(0, log2MaxFrameNum) // frame_num
+	w.writeUE(idrPicID)
+	w.writeBits(0, 1) // no_output_of_prior_pics_flag
+	w.writeBits(0, 1) // long_term_reference_flag
+	w.writeSE(0)      // slice_qp_delta
+	w.writeUE(1)      // disable_deblocking_filter_idc
+
+	for mb := 0; mb < patternMBs; mb++ {
+		x0 := mb % patternWidthMBs * 16
+		w.writeUE(mbTypeIPCM)
+		w.align() // pcm_alignment_zero_bit
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 16; x++ {
+				w.writeBits(uint(bar(x0 + x)[0]), 8)
+			}
+		}
+		for c := 1; c <= 2; c++ {
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					w.writeBits(uint(bar(x0 + x*2)[c]), 8)
+				}
+			}
+		}
+	}
+	return w.rbsp()
+}
+
+// skipSlice returns a P slice skipping all macroblocks, i.e. repeating the previous frame.
+func skipSlice(frameNum uint) []byte {
+	var w bitWriter
+	w.writeUE(0) // first_mb_in_slice
+	w.writeUE(5) // slice_type: P, all slices of the picture
+	w.writeUE(0) // pic_parameter_set_id
+	w.writeBits(frameNum, log2MaxFrameNum)
+	w.writeBits(0, 1)     // num_ref_idx_active_override_flag
+	w.writeBits(0, 1)     // ref_pic_list_modification_flag_l0
+	w.writeBits(0, 1)     // adaptive_ref_pic_marking_mode_flag
+	w.writeSE(0)          // slice_qp_delta
+	w.writeUE(1)          // disable_deblocking_filter_idc
+	w.writeUE(patternMBs) // mb_skip_run
+	return w.rbsp()
+}
+
+// bar returns color of the bar at luma column x.
+func bar(x int) [3]byte {
+	return colorBars[x*len(colorBars)/(patternWidthMBs*16)]
+}
+
+// nalUnit returns a NAL unit with start code, emulation prevention bytes are inserted into rbsp.
+func nalUnit(refIdc, unitType byte, rbsp []byte) []byte {
+	b := make([]byte, 0, len(rbsp)+len(rbsp)/64+5)
+	b = append(b, 0, 0, 0, 1, refIdc<<5|unitType)
+	zeros := 0
+	for _, v := range rbsp {
+		if zeros == 2 && v <= 3 {
+			b = append(b, 3)
+			zeros = 0
+		}
+		b = append(b, v)
+		if v == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return b
+}
+
+// bitWriter writes bits MSB first.
+type bitWriter struct {
+	buf  []byte
+	bits uint // Bits written in the last byte.
+}
+
+func (w *bitWriter) writeBits(v uint, n uint) {
+	for i := n; i > 0; i-- {
+		if w.bits%8 == 0 {
+			w.buf = append(w.buf, 0)
+			w.bits = 0
+		}
+		w.buf[len(w.buf)-1] |= byte(v>>(i-1)&1) << (7 - w.bits)
+		w.bits++
+	}
+}
+
+// writeUE writes v in unsigned Exp-Golomb code.
+func (w *bitWriter) writeUE(v uint) {
+	v++
+	n := uint(0)
+	for x := v; x > 1; x >>= 1 {
+		n++
+	}
+	w.writeBits(0, n)
+	w.writeBits(v, n+1)
+}
+
+// writeSE writes v in signed Exp-Golomb code.
+func (w *bitWriter) writeSE(v int) {
+	if v > 0 {
+		w.writeUE(uint(2*v - 1))
+	} else {
+		w.writeUE(uint(-2 * v))
+	}
+}
+
+// align writes zero bits up to the next byte boundary.
+func (w *bitWriter) align() {
+	if w.bits%8 != 0 {
+		w.writeBits(0, 8-w.bits%8)
+	}
+}
+
+// rbsp returns written bits ended with rbsp_trailing_bits.
+func (w *bitWriter) rbsp() []byte {
+	w.writeBits(1, 1)
+	w.align()
+	return w.buf
+}
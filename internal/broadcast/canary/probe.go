@@ -0,0 +1,112 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/signalclient"
+)
+
+// errNoMedia is returned if a probe receives no media in ProbeTimeout.
+var errNoMedia = errors.New("no media received")
+
+// probe joins the canary session as a subscriber via WebSocket signaling of base URL,
+// and returns latency from offer to first video RTP packet.
+func (c *Canary) probe(ctx context.Context, base string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.ProbeTimeout)
+	defer cancel()
+
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return 0, fmt.Errorf("could not create PeerConnection: %w", err)
+	}
+	defer peerConnection.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := peerConnection.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return 0, fmt.Errorf("could not add %s transceiver: %w", kind, err)
+		}
+	}
+
+	firstMedia := make(chan struct{})
+	var firstMediaOnce sync.Once
+	peerConnection.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			if track.Kind() == webrtc.RTPCodecTypeVideo {
+				firstMediaOnce.Do(func() { close(firstMedia) })
+			}
+		}
+	})
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not create offer: %w", err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		return 0, fmt.Errorf("could not set local description: %w", err)
+	}
+	select {
+	case <-gatherComplete:
+	case <-ctx.Done():
+		return 0, fmt.Errorf("could not gather candidates: %w", ctx.Err())
+	}
+
+	u, err := c.signalURL(base)
+	if err != nil {
+		return 0, err
+	}
+	client, err := signalclient.Dial(ctx, u)
+	if err != nil {
+		return 0, err
+	}
+	defer client.Close()
+
+	start := time.Now()
+	if err := client.Offer(ctx, c.meta, peerConnection); err != nil {
+		return 0, err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Signal(ctx, peerConnection, nil)
+	}()
+	select {
+	case <-firstMedia:
+		return time.Since(start), nil
+	case err := <-errc:
+		return 0, err
+	case <-ctx.Done():
+		return 0, errNoMedia
+	}
+}
+
+// signalURL returns URL of signaling handler at base, with a token if auth is enabled.
+func (c *Canary) signalURL(base string) (string, error) {
+	query := url.Values{"tenant": {tenant}}
+	if c.auth != nil {
+		token, err := c.auth.Sign(&auth.Claims{
+			Issuer:    c.issuer,
+			Subject:   "canary",
+			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
+			Tenant:    tenant,
+			Streams:   []auth.Stream{{ID: c.meta.Id}},
+		})
+		if err != nil {
+			return "", fmt.Errorf("could not sign token: %w", err)
+		}
+		query.Set("token", token)
+	}
+	return base + "/v1/broadcast/signal?" + query.Encode(), nil
+}
@@ -0,0 +1,89 @@
+// Package capability keeps track source capabilities advertised by edges,
+// so frontends can render source pickers before any session exists.
+package capability
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	pb "github.com/SB-IM/pb/signal"
+)
+
+// Document is a capability document retained by an edge on its capability topic.
+type Document struct {
+	Sources []Source `json:"sources"`
+}
+
+// Source is capability of a track source of an edge.
+type Source struct {
+	TrackSource  pb.TrackSource `json:"track_source"`
+	Name         string         `json:"name,omitempty"` // Human readable name, e.g. camera model.
+	Codecs       []string       `json:"codecs,omitempty"`
+	MaxWidth     int            `json:"max_width,omitempty"`
+	MaxHeight    int            `json:"max_height,omitempty"`
+	MaxFramerate int            `json:"max_framerate,omitempty"`
+}
+
+// Parse parses a capability document.
+func Parse(payload []byte) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, fmt.Errorf("could not unmarshal capability document: %w", err)
+	}
+	seen := make(map[pb.TrackSource]bool, len(doc.Sources))
+	for _, source := range doc.Sources {
+		// Track sources unknown to pb are kept, so new payloads are advertised before pb knows them.
+		if source.TrackSource < 0 {
+			return nil, fmt.Errorf("invalid track source %d", source.TrackSource)
+		}
+		if seen[source.TrackSource] {
+			return nil, fmt.Errorf("duplicate track source %d", source.TrackSource)
+		}
+		seen[source.TrackSource] = true
+		if source.MaxWidth < 0 || source.MaxHeight < 0 || source.MaxFramerate < 0 {
+			return nil, errors.New("negative max resolution or framerate")
+		}
+	}
+	return &doc, nil
+}
+
+// Store keeps the latest capability documents by edge ID.
+type Store struct {
+	mu   sync.RWMutex
+	docs map[string]*Document
+}
+
+// NewStore returns a new Store.
+func NewStore() *Store {
+	return &Store{
+		docs: make(map[string]*Document),
+	}
+}
+
+// Set sets capability document of an edge, replacing the old one.
+func (s *Store) Set(id string, doc *Document) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.docs[id] = doc
+}
+
+// Delete deletes capability document of an edge, e.g. after its retained message is cleared.
+func (s *Store) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.docs, id)
+}
+
+// List returns capability documents by edge ID. Documents must not be modified.
+func (s *Store) List() map[string]*Document {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	docs := make(map[string]*Document, len(s.docs))
+	for id, doc := range s.docs {
+		docs[id] = doc
+	}
+	return docs
+}
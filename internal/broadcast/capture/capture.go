@@ -0,0 +1,321 @@
+// Package capture dumps RTP of sessions to pcap or rtpdump files for debugging, e.g. green frames on some
+// decoders, which need raw RTP to diagnose. Captures are started by operators for a limited time, and files
+// of all captures are capped by a disk quota.
+package capture
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// DefaultDuration is the duration of a capture if none is given.
+const DefaultDuration = 10 * time.Second
+
+var (
+	// ErrDisabled is returned if no capture directory is configured.
+	ErrDisabled = errors.New("capture disabled")
+	// ErrQuotaExceeded is returned if capture files take up the whole disk quota.
+	ErrQuotaExceeded = errors.New("capture disk quota exceeded")
+	// ErrNotFound is returned if there is no capture of the name.
+	ErrNotFound = errors.New("capture not found")
+
+	unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+)
+
+// Rewrite rewrites SSRC and payload type of packets of a kind, e.g. to those negotiated with a subscriber.
+type Rewrite struct {
+	SSRC        uint32
+	PayloadType uint8
+}
+
+// Options are options of a capture.
+type Options struct {
+	Format   string
+	Duration time.Duration
+	// PeerID is the subscriber peer connection captured, empty captures the publisher side.
+	PeerID string
+	// Video and Audio rewrite packets as sent to the subscriber of PeerID, nil keeps them as from edge.
+	Video, Audio *Rewrite
+}
+
+// Status is the status of a capture.
+type Status struct {
+	Name        string         `json:"name"`
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	PeerID      string         `json:"peer_id,omitempty"`
+	Format      string         `json:"format"`
+	StartedAt   time.Time      `json:"started_at"`
+	Until       time.Time      `json:"until"`
+	Packets     uint64         `json:"packets"`
+	Bytes       int64          `json:"bytes"`
+	Running     bool           `json:"running"`
+	Error       string         `json:"error,omitempty"`
+}
+
+// Capturer runs captures of sessions into CaptureDir.
+type Capturer struct {
+	logger zerolog.Logger
+	config cfg.AdminConfigOptions
+	// quota is bytes of all capture files, zero means unlimited.
+	quota int64
+
+	mu       sync.Mutex
+	captures map[string]*capture
+	// used is bytes of capture files in CaptureDir, counted once a capture starts and as it writes.
+	used int64
+}
+
+// capture is a capture of a session.
+type capture struct {
+	status Status
+	sess   *session.Session
+	tap    *session.Tap
+	stop   chan struct{}
+	once   sync.Once
+}
+
+// New returns a new Capturer.
+func New(logger *zerolog.Logger, config cfg.AdminConfigOptions) *Capturer {
+	return &Capturer{
+		logger:   loglevel.Default.Component(logger, "Capture"),
+		config:   config,
+		quota:    int64(config.CaptureQuotaMB) << 20,
+		captures: make(map[string]*capture),
+	}
+}
+
+// Start starts capturing sess by options, it returns the status once started.
+func (c *Capturer) Start(sess *session.Session, options Options) (Status, error) {
+	if c.config.CaptureDir == "" {
+		return Status{}, ErrDisabled
+	}
+	if options.Format == "" {
+		options.Format = FormatPcap
+	}
+	if options.Duration <= 0 {
+		options.Duration = DefaultDuration
+	}
+	if c.config.CaptureMaxDuration > 0 && options.Duration > c.config.CaptureMaxDuration {
+		options.Duration = c.config.CaptureMaxDuration
+	}
+	if err := os.MkdirAll(c.config.CaptureDir, 0o750); err != nil {
+		return Status{}, fmt.Errorf("could not create capture directory: %w", err)
+	}
+
+	now := time.Now()
+	name := unsafeChars.ReplaceAllString(sess.Meta.Id, "_") + "_" + fmt.Sprint(int(sess.Meta.TrackSource)) + "_" +
+		now.UTC().Format("20060102T150405.000")
+	if options.PeerID != "" {
+		name += "_" + unsafeChars.ReplaceAllString(options.PeerID, "_")
+	}
+	name += "." + options.Format
+
+	c.mu.Lock()
+	used, err := c.usage()
+	if err != nil {
+		c.mu.Unlock()
+		return Status{}, err
+	}
+	c.used = used
+	if c.quota > 0 && c.used >= c.quota {
+		c.mu.Unlock()
+		return Status{}, ErrQuotaExceeded
+	}
+	c.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(c.config.CaptureDir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return Status{}, fmt.Errorf("could not create capture file: %w", err)
+	}
+	w, err := newWriter(options.Format, f, now)
+	if err != nil {
+		f.Close()
+		_ = os.Remove(f.Name())
+		return Status{}, err
+	}
+
+	capt := &capture{
+		status: Status{
+			Name:        name,
+			ID:          sess.Meta.Id,
+			TrackSource: sess.Meta.TrackSource,
+			PeerID:      options.PeerID,
+			Format:      options.Format,
+			StartedAt:   now,
+			Until:       now.Add(options.Duration),
+			Running:     true,
+		},
+		sess: sess,
+		tap:  sess.Taps.Add(),
+		stop: make(chan struct{}),
+	}
+	c.mu.Lock()
+	c.captures[name] = capt
+	c.mu.Unlock()
+
+	logger := c.logger.With().Str("capture", name).Str("id", sess.Meta.Id).Int32("track_source", int32(sess.Meta.TrackSource)).Logger()
+	logger.Info().Str("peer_id", options.PeerID).Dur("duration", options.Duration).Msg("started capture")
+	go func() {
+		err := c.run(capt, w, &options)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		c.mu.Lock()
+		capt.status.Running = false
+		if err != nil {
+			capt.status.Error = err.Error()
+		}
+		status := capt.status
+		c.mu.Unlock()
+		logger.Info().Err(err).Uint64("packets", status.Packets).Int64("bytes", status.Bytes).Msg("finished capture")
+	}()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return capt.status, nil
+}
+
+// run writes packets of the tap of capt until it's stopped or expired, or the quota is used up.
+func (c *Capturer) run(capt *capture, w writer, options *Options) error {
+	defer capt.sess.Taps.Remove(capt.tap)
+	timer := time.NewTimer(time.Until(capt.status.Until))
+	defer timer.Stop()
+	for {
+		select {
+		case packet, ok := <-capt.tap.Packets():
+			if !ok {
+				return w.flush()
+			}
+			data := packet.Data
+			switch {
+			case packet.Kind == webrtc.RTPCodecTypeVideo && options.Video != nil:
+				data = rewriteRTP(data, options.Video)
+			case packet.Kind == webrtc.RTPCodecTypeAudio && options.Audio != nil:
+				data = rewriteRTP(data, options.Audio)
+			}
+			if !c.reserve(capt, int64(len(data))) {
+				_ = w.flush()
+				return ErrQuotaExceeded
+			}
+			if err := w.writePacket(time.Now(), packet.Kind, data); err != nil {
+				return err
+			}
+		case <-timer.C:
+			return w.flush()
+		case <-capt.stop:
+			return w.flush()
+		}
+	}
+}
+
+// reserve counts n bytes written by capt, it reports false if they would exceed the quota.
+// Bytes of headers in files are not counted, so files may exceed the quota by them.
+func (c *Capturer) reserve(capt *capture, n int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.quota > 0 && c.used+n > c.quota {
+		return false
+	}
+	c.used += n
+	capt.status.Packets++
+	capt.status.Bytes += n
+	return true
+}
+
+// usage returns bytes of files in CaptureDir, files being written are counted by bytes they've written.
+// c.mu must be held.
+func (c *Capturer) usage() (int64, error) {
+	entries, err := os.ReadDir(c.config.CaptureDir)
+	if err != nil {
+		return 0, fmt.Errorf("could not read capture directory: %w", err)
+	}
+	var used int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if capt, ok := c.captures[entry.Name()]; ok && capt.status.Running {
+			continue
+		}
+		used += info.Size()
+	}
+	for _, capt := range c.captures {
+		if capt.status.Running {
+			used += capt.status.Bytes
+		}
+	}
+	return used, nil
+}
+
+// List lists captures since started, including finished ones.
+func (c *Capturer) List() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	statuses := make([]Status, 0, len(c.captures))
+	for _, capt := range c.captures {
+		statuses = append(statuses, capt.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].StartedAt.Before(statuses[j].StartedAt)
+	})
+	return statuses
+}
+
+// Path returns the file path of the capture of name.
+func (c *Capturer) Path(name string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.captures[name]; !ok {
+		return "", ErrNotFound
+	}
+	return filepath.Join(c.config.CaptureDir, name), nil
+}
+
+// Stop stops the capture of name if it's running, or removes its file if it's finished, freeing the quota.
+func (c *Capturer) Stop(name string) error {
+	c.mu.Lock()
+	capt, ok := c.captures[name]
+	running := ok && capt.status.Running
+	if ok && !running {
+		delete(c.captures, name)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	if running {
+		capt.once.Do(func() { close(capt.stop) })
+		return nil
+	}
+	if err := os.Remove(filepath.Join(c.config.CaptureDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// rewriteRTP returns a copy of packet with SSRC and payload type of rewrite.
+func rewriteRTP(packet []byte, rewrite *Rewrite) []byte {
+	if len(packet) < 12 {
+		return packet
+	}
+	b := append([]byte(nil), packet...)
+	b[1] = b[1]&0x80 | rewrite.PayloadType&0x7F
+	b[8], b[9], b[10], b[11] = byte(rewrite.SSRC>>24), byte(rewrite.SSRC>>16), byte(rewrite.SSRC>>8), byte(rewrite.SSRC)
+	return b
+}
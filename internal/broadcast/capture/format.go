@@ -0,0 +1,164 @@
+package capture
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Formats of capture files.
+const (
+	// FormatPcap is pcap of RTP over UDP over raw IPv4, video and audio are on ports 5004 and 5006,
+	// so Wireshark decodes them by "Decode As RTP" or its rtp_udp heuristic.
+	FormatPcap = "pcap"
+	// FormatRTPDump is rtpdump of rtptools, read by rtpplay and Wireshark. Video and audio are mixed
+	// in a stream, told apart by SSRC.
+	FormatRTPDump = "rtpdump"
+)
+
+const (
+	pcapMagic     = 0xa1b2c3d4
+	pcapSnapLen   = 65535
+	linkTypeRaw   = 101 // LINKTYPE_RAW, packets begin with IPv4 headers.
+	ipv4HeaderLen = 20
+	udpHeaderLen  = 8
+	videoPort     = 5004
+	audioPort     = 5006
+)
+
+var (
+	srcAddr = net.IPv4(10, 0, 0, 1).To4()
+	dstAddr = net.IPv4(10, 0, 0, 2).To4()
+)
+
+// writer writes RTP packets to a capture file.
+type writer interface {
+	writePacket(t time.Time, kind webrtc.RTPCodecType, packet []byte) error
+	flush() error
+}
+
+func newWriter(format string, w io.Writer, start time.Time) (writer, error) {
+	b := bufio.NewWriter(w)
+	switch format {
+	case FormatPcap:
+		return newPcapWriter(b)
+	case FormatRTPDump:
+		return newRTPDumpWriter(b, start)
+	default:
+		return nil, fmt.Errorf("unsupported capture format %q", format)
+	}
+}
+
+// pcapWriter writes pcap, see https://wiki.wireshark.org/Development/LibpcapFileFormat.
+type pcapWriter struct {
+	w  *bufio.Writer
+	id uint16 // Identification of IPv4 headers.
+}
+
+func newPcapWriter(w *bufio.Writer) (*pcapWriter, error) {
+	var header [24]byte
+	binary.LittleEndian.PutUint32(header[0:], pcapMagic)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &pcapWriter{w: w}, nil
+}
+
+func (p *pcapWriter) writePacket(t time.Time, kind webrtc.RTPCodecType, packet []byte) error {
+	port := uint16(videoPort)
+	if kind == webrtc.RTPCodecTypeAudio {
+		port = audioPort
+	}
+	length := ipv4HeaderLen + udpHeaderLen + len(packet)
+
+	var record [16 + ipv4HeaderLen + udpHeaderLen]byte
+	binary.LittleEndian.PutUint32(record[0:], uint32(t.Unix()))
+	binary.LittleEndian.PutUint32(record[4:], uint32(t.Nanosecond()/1000))
+	binary.LittleEndian.PutUint32(record[8:], uint32(length))
+	binary.LittleEndian.PutUint32(record[12:], uint32(length))
+
+	ip := record[16 : 16+ipv4HeaderLen]
+	ip[0] = 0x45 // Version 4, header of 5 words.
+	binary.BigEndian.PutUint16(ip[2:], uint16(length))
+	binary.BigEndian.PutUint16(ip[4:], p.id)
+	p.id++
+	ip[8] = 64 // TTL.
+	ip[9] = 17 // UDP.
+	copy(ip[12:], srcAddr)
+	copy(ip[16:], dstAddr)
+	binary.BigEndian.PutUint16(ip[10:], checksum(ip))
+
+	udp := record[16+ipv4HeaderLen:]
+	binary.BigEndian.PutUint16(udp[0:], port)
+	binary.BigEndian.PutUint16(udp[2:], port)
+	binary.BigEndian.PutUint16(udp[4:], uint16(udpHeaderLen+len(packet)))
+	// Checksum of UDP over IPv4 is optional, it's left zero.
+
+	if _, err := p.w.Write(record[:]); err != nil {
+		return err
+	}
+	_, err := p.w.Write(packet)
+	return err
+}
+
+func (p *pcapWriter) flush() error {
+	return p.w.Flush()
+}
+
+// checksum returns the internet checksum of an IPv4 header, see RFC 1071.
+func checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	for sum > 0xFFFF {
+		sum = sum>>16 + sum&0xFFFF
+	}
+	return ^uint16(sum)
+}
+
+// rtpDumpWriter writes rtpdump, see https://github.com/irtlab/rtptools.
+type rtpDumpWriter struct {
+	w     *bufio.Writer
+	start time.Time
+}
+
+func newRTPDumpWriter(w *bufio.Writer, start time.Time) (*rtpDumpWriter, error) {
+	if _, err := fmt.Fprintf(w, "#!rtpplay1.0 %s/%d\n", net.IP(dstAddr), videoPort); err != nil {
+		return nil, err
+	}
+	var header [16]byte
+	binary.BigEndian.PutUint32(header[0:], uint32(start.Unix()))
+	binary.BigEndian.PutUint32(header[4:], uint32(start.Nanosecond()/1000))
+	copy(header[8:], dstAddr)
+	binary.BigEndian.PutUint16(header[12:], videoPort)
+	if _, err := w.Write(header[:]); err != nil {
+		return nil, err
+	}
+	return &rtpDumpWriter{w: w, start: start}, nil
+}
+
+func (r *rtpDumpWriter) writePacket(t time.Time, _ webrtc.RTPCodecType, packet []byte) error {
+	var header [8]byte
+	binary.BigEndian.PutUint16(header[0:], uint16(len(header)+len(packet)))
+	binary.BigEndian.PutUint16(header[2:], uint16(len(packet)))
+	binary.BigEndian.PutUint32(header[4:], uint32(t.Sub(r.start)/time.Millisecond))
+	if _, err := r.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := r.w.Write(packet)
+	return err
+}
+
+func (r *rtpDumpWriter) flush() error {
+	return r.w.Flush()
+}
@@ -0,0 +1,305 @@
+// Package cascade runs an instance as an edge of an origin/edge cascade: live streams of an upstream instance
+// are pulled over WebRTC as a subscriber and republished to local sessions, so viewers are spread over
+// relays instead of all watching the origin. Streams are discovered by polling the streams API of upstream,
+// and pulls reconnect with backoff until the stream is gone upstream.
+package cascade
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/relay"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	defaultMaxBackoff   = 30 * time.Second
+
+	minBackoff  = time.Second
+	listTimeout = 5 * time.Second
+
+	// tenant of relays, so their egress is accounted apart from viewers by upstream.
+	tenant = "cascade"
+)
+
+// stream is a stream listed by the streams API of upstream.
+type stream struct {
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	Live        bool           `json:"live"`
+}
+
+// Status is status of a stream pulled from upstream.
+type Status struct {
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	Live        bool           `json:"live"`
+	Error       string         `json:"error,omitempty"` // The last error if not live.
+	Since       time.Time      `json:"since"`           // Since when it's live or failing.
+}
+
+// pull is a stream being pulled.
+type pull struct {
+	meta   *pb.Meta
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+func (p *pull) set(live bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Live, p.status.Since, p.status.Error = live, time.Now(), ""
+	if err != nil {
+		p.status.Error = err.Error()
+	}
+}
+
+// Cascade pulls live streams of upstream matching machines.
+type Cascade struct {
+	logger   zerolog.Logger
+	config   cfg.CascadeConfigOptions
+	sessions *session.SessionManager
+	client   *http.Client
+
+	// streamsURL and signalURL are URLs of the streams API and signaling of upstream.
+	streamsURL string
+	signalURL  string
+
+	mu    sync.Mutex
+	pulls map[session.Key]*pull
+}
+
+// New returns a new Cascade of Upstream of config, which is a base URL of a skywalker instance,
+// e.g. https://origin.example.com.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.CascadeConfigOptions) (*Cascade, error) {
+	u, err := url.Parse(config.Upstream)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse upstream URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, errors.New("missing upstream host")
+	}
+	signal := *u
+	switch u.Scheme {
+	case "http":
+		signal.Scheme = "ws"
+	case "https":
+		signal.Scheme = "wss"
+	default:
+		return nil, fmt.Errorf("unsupported upstream scheme %q", u.Scheme)
+	}
+	u.Path = path.Join(u.Path, "/v1/broadcast/streams")
+	signal.Path = path.Join(signal.Path, "/v1/broadcast/signal")
+	query := url.Values{"tenant": {tenant}}
+	if config.UpstreamToken != "" {
+		query.Set("token", config.UpstreamToken)
+	}
+	signal.RawQuery = query.Encode()
+
+	if config.CascadePollInterval <= 0 {
+		config.CascadePollInterval = defaultPollInterval
+	}
+	if config.CascadeMaxBackoff < minBackoff {
+		config.CascadeMaxBackoff = defaultMaxBackoff
+	}
+	return &Cascade{
+		logger:     loglevel.Default.Component(logger, "Cascade").With().Str("upstream", u.Host).Logger(),
+		config:     config,
+		sessions:   sessions,
+		client:     &http.Client{Timeout: listTimeout},
+		streamsURL: u.String(),
+		signalURL:  signal.String(),
+		pulls:      make(map[session.Key]*pull),
+	}, nil
+}
+
+// Run polls live streams of upstream every PollInterval, and pulls ones of machines until ctx is done.
+// A stream is pulled until it's gone upstream. Streams keep being pulled if upstream can't be listed.
+func (c *Cascade) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.CascadePollInterval)
+	defer ticker.Stop()
+	c.logger.Info().Strs("machines", c.config.CascadeMachines).Msg("relaying streams of upstream")
+	for {
+		if streams, err := c.list(ctx); err != nil {
+			c.logger.Err(err).Msg("could not list upstream streams")
+		} else {
+			c.sync(ctx, streams)
+		}
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			for key, p := range c.pulls {
+				p.cancel()
+				<-p.done
+				delete(c.pulls, key)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// list returns live streams of upstream.
+func (c *Cascade) list(ctx context.Context) ([]stream, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.streamsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.UpstreamToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.UpstreamToken)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var streams []stream
+	if err := json.NewDecoder(resp.Body).Decode(&streams); err != nil {
+		return nil, fmt.Errorf("could not decode streams: %w", err)
+	}
+	live := streams[:0]
+	for _, s := range streams {
+		if s.Live {
+			live = append(live, s)
+		}
+	}
+	return live, nil
+}
+
+// sync starts pulling live streams of machines not pulled yet, and stops pulling streams gone upstream.
+func (c *Cascade) sync(ctx context.Context, streams []stream) {
+	live := make(map[session.Key]*pb.Meta)
+	for _, s := range streams {
+		if !c.match(s.ID) {
+			continue
+		}
+		meta := &pb.Meta{Id: s.ID, TrackSource: s.TrackSource}
+		live[c.sessions.Key(meta)] = meta
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, meta := range live {
+		if _, ok := c.pulls[key]; ok {
+			continue
+		}
+		pctx, cancel := context.WithCancel(ctx)
+		p := &pull{
+			meta:   meta,
+			cancel: cancel,
+			done:   make(chan struct{}),
+			status: Status{ID: meta.Id, TrackSource: meta.TrackSource, Since: time.Now()},
+		}
+		c.pulls[key] = p
+		go c.run(pctx, p)
+	}
+	for key, p := range c.pulls {
+		if _, ok := live[key]; !ok {
+			p.cancel()
+			delete(c.pulls, key)
+		}
+	}
+}
+
+// match reports whether machine id is relayed, all are if machines are not set.
+func (c *Cascade) match(id string) bool {
+	if len(c.config.CascadeMachines) == 0 {
+		return true
+	}
+	for _, m := range c.config.CascadeMachines {
+		if m == "*" || m == id || strings.HasSuffix(m, "*") && strings.HasPrefix(id, strings.TrimSuffix(m, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// run pulls a stream, and reconnects with backoff until ctx is done.
+func (c *Cascade) run(ctx context.Context, p *pull) {
+	defer close(p.done)
+	logger := c.logger.With().Str("id", p.meta.Id).Int32("track_source", int32(p.meta.TrackSource)).Logger()
+
+	backoff := minBackoff
+	for {
+		started := time.Now()
+		err := relay.Pull(ctx, c.signalURL, p.meta, c.sessions, "upstream", &logger, func(*session.Session) {
+			p.set(true, nil)
+		})
+		if ctx.Err() != nil {
+			logger.Info().Msg("stopped relaying stream")
+			return
+		}
+		if err == nil {
+			err = relay.ErrUpstreamClosed
+		}
+		p.set(false, err)
+		// A pull lasting long enough is not a flapping one.
+		if time.Since(started) > c.config.CascadeMaxBackoff {
+			backoff = minBackoff
+		}
+		logger.Warn().Err(err).Dur("backoff", backoff).Msg("relaying stream stopped, reconnecting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > c.config.CascadeMaxBackoff {
+			backoff = c.config.CascadeMaxBackoff
+		}
+	}
+}
+
+// List returns status of all streams pulled.
+func (c *Cascade) List() []Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list := make([]Status, 0, len(c.pulls))
+	for _, p := range c.pulls {
+		p.mu.Lock()
+		list = append(list, p.status)
+		p.mu.Unlock()
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ID != list[j].ID {
+			return list[i].ID < list[j].ID
+		}
+		return list[i].TrackSource < list[j].TrackSource
+	})
+	return list
+}
+
+// Handler serves status of streams pulled from upstream at /v1/broadcast/cascade.
+func (c *Cascade) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(c.List()); err != nil {
+			c.logger.Err(err).Msg("could not write cascade JSON")
+		}
+	})
+}
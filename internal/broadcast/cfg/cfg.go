@@ -1,26 +1,101 @@
 package cfg
 
+import "time"
+
 type ConfigOptions struct {
 	WebRTCConfigOptions
 	MQTTClientConfigOptions
 	ServerConfigOptions
+	SessionConfigOptions
+	QuotaConfigOptions
+	RecordingConfigOptions
+	MetricsConfigOptions
+	AuthConfigOptions
+	StandbyConfigOptions
+	SLOConfigOptions
+	SubscriberMQTTConfigOptions
+	QualityConfigOptions
+	CanaryConfigOptions
+	HLSConfigOptions
+	DirectoryConfigOptions
+	RTSPConfigOptions
+	SRTConfigOptions
+	RTMPConfigOptions
+	WHIPConfigOptions
+	HealthConfigOptions
+	AdminConfigOptions
+	EdgeSignalConfigOptions
+	ACLConfigOptions
+	RateLimitConfigOptions
+	ClusterConfigOptions
+	CascadeConfigOptions
+	AuditConfigOptions
+	WebhookConfigOptions
+	DemoConfigOptions
+	RecoveryConfigOptions
+	ThumbnailConfigOptions
+	TracingConfigOptions
+	TenantConfigOptions
+	AccountingConfigOptions
+	ShareConfigOptions
 }
 
 type PublisherConfigOptions struct {
 	MQTTClientConfigOptions
 	WebRTCConfigOptions
+	SessionConfigOptions
+	WHIPConfigOptions
+	EdgeSignalConfigOptions
 }
 
 type SubscriberConfigOptions struct {
 	MQTTClientConfigOptions
 	WebRTCConfigOptions
+	ServerConfigOptions
+	QuotaConfigOptions
+	AuthConfigOptions
+	SLOConfigOptions
+	SubscriberMQTTConfigOptions
+	RateLimitConfigOptions
 }
 
 type WebRTCConfigOptions struct {
-	ICEServer      string
-	Username       string
-	Credential     string
-	EnableFrontend bool // Enable static file server handler serving webRTC frontend, useful for debug
+	ICEServer  string
+	Username   string
+	Credential string
+	ICEServers []ICEServer // More STUN and TURN servers used along with ICEServer
+
+	WaitICEGathering     bool          // Wait for ICE gathering before sending answer instead of half-trickle
+	ICEGatheringTimeout  time.Duration // Max waiting time for ICE gathering if WaitICEGathering is enabled
+	VanillaICETimeout    time.Duration // Max waiting time for ICE gathering of subscribers without trickle ICE, 0 waits until SignalTimeout
+	SignalTimeout        time.Duration // Max time of offer/answer exchange, non-positive value means no timeout
+	StatsInterval        time.Duration // Interval of sending stats events to subscribers, non-positive value disables them
+	DefaultLayer         string        // RID of simulcast layer subscribers watch by default, the first offered one if not offered
+	CongestionControl    bool          // Switch simulcast layers of each subscriber by its estimated bandwidth
+	MaxSubscriberBitrate int           // Max video bitrate in kbps sent to a subscriber by switching simulcast layers, 0 means no cap
+	Retransmission       bool          // Answer NACKs of subscribers from packets cached once per session
+	RetransmissionBuffer int           // Packets of each video track cached for retransmission
+	JitterBuffer         time.Duration // Latency budget of reordering packets from edge, non-positive value forwards them as received
+	LowLatency           bool          // Mark all sessions low-latency, otherwise edges mark sessions in their offers
+	PlayoutDelay         bool          // Negotiate the playout-delay RTP header extension with subscribers of low-latency sessions
+	PlayoutDelayMin      time.Duration // Min playout delay asked of subscribers of low-latency sessions
+	PlayoutDelayMax      time.Duration // Max playout delay asked of subscribers of low-latency sessions
+
+	ICEConnectTimeout     time.Duration // Max time of a subscriber connecting ICE after answered, non-positive value means no timeout
+	MaxSubscriberDuration time.Duration // Max time a subscriber watches once connected, non-positive value means no limit
+
+	MediaInterfaces []string // Network interfaces gathering ICE candidates, empty means all
+	UDPPortMin      uint     // Min ephemeral UDP port of ICE, 0 along with UDPPortMax means any
+	UDPPortMax      uint     // Max ephemeral UDP port of ICE
+	UDPPort         int      // Single UDP port multiplexing ICE of all peer connections, 0 uses ephemeral ports
+	TCPPort         int      // TCP port of ICE-TCP passive candidates for networks blocking UDP, 0 disables ICE-TCP
+	NAT1To1IPs      []string // Public IPs advertised in place of host candidate IPs behind 1:1 NAT, as external[/local]
+	IPv6            bool     // Gather IPv6 ICE candidates besides IPv4 ones
+	Codecs          []Codec  // Codecs accepted per track source in order of preference, H264 and Opus if not set
+
+	TURNSecret        string        // Shared secret minting TURN credentials as coturn use-auth-secret, empty disables it
+	TURNURLs          []string      // TURN servers accepting minted credentials
+	TURNCredentialTTL time.Duration // Lifetime of minted TURN credentials
 }
 
 type MQTTClientConfigOptions struct {
@@ -29,11 +104,264 @@ type MQTTClientConfigOptions struct {
 	CandidateSendTopicPrefix string // Opposite to edge's CandidateRecvTopicPrefix topic
 	CandidateRecvTopicPrefix string // Opposite to edge's CandidateSendTopicPrefix topic.
 	HookStreamTopicPrefix    string
+	HibernateTopicPrefix     string // Edges pause and resume sending media of idle sessions on "prefix/id/track_source"
+	CapabilityTopicPrefix    string // Edges retain capability documents on "prefix/id"
 	Qos                      uint
 	Retained                 bool
 }
 
+// LogConfigOptions configures logging of the command.
+type LogConfigOptions struct {
+	Level string // Default log level of components, e.g. "warn", empty means debug or info by --debug
+
+	SampleBurst      int           // Debug and info logs of a component logged in every SamplePeriod, 0 disables sampling
+	SamplePeriod     time.Duration // Period of SampleBurst
+	SampleThereafter int           // Every n-th debug and info log of a component logged after SampleBurst, 0 drops them
+}
+
+// MQTTConnConfigOptions configures connection to MQTT broker, server and credentials are mqttclient.ConfigOptions.
+type MQTTConnConfigOptions struct {
+	CACert     string // CA file verifying the broker of ssl, tls and wss servers, empty uses system CAs
+	ClientCert string // Client certificate file authenticating to the broker by mutual TLS
+	ClientKey  string // Private key file of ClientCert
+
+	ProtocolVersion      uint          // 3 for MQTT v3.1, 4 for v3.1.1, 0 tries v3.1.1 then v3.1
+	KeepAlive            time.Duration // Interval of keep-alive pings to the broker
+	PingTimeout          time.Duration // Connection is lost if a ping isn't answered in it
+	CleanSession         bool          // Discard subscriptions of the client ID at the broker on connect
+	ConnectRetryInterval time.Duration // Interval of retrying the first connect
+	MaxReconnectInterval time.Duration // Reconnect interval doubles from 1s up to it after connection is lost
+	OfflineQueueSize     int           // Messages published while disconnected are replayed on reconnect, 0 disables it
+}
+
 type ServerConfigOptions struct {
-	Host string
-	Port int
+	Host   string // Listening host of signaling, health and gRPC servers, empty means all IPv4 and IPv6 addresses
+	Port   int
+	Region string // Region this server is deployed in, it's reported to subscribers
+
+	ShutdownTimeout time.Duration // Max time of draining connections on shutdown, non-positive value waits forever
+
+	ReadTimeout       time.Duration // Max time of reading an entire HTTP request, zero means no timeout
+	ReadHeaderTimeout time.Duration // Max time of reading HTTP request headers, zero means no timeout
+	WriteTimeout      time.Duration // Max time of writing an HTTP response, zero means no timeout
+	IdleTimeout       time.Duration // Max time of waiting for the next request on keep-alive connections
+	TCPKeepAlive      time.Duration // TCP keep-alive period detecting half-open connections, negative value disables it
+	WSWriteTimeout    time.Duration // Max time of writing a WebSocket message, zero means no timeout
+	WSPingInterval    time.Duration // Interval of pinging signaling WebSocket clients, non-positive value disables it
+	WSPongTimeout     time.Duration // Max time of waiting for a pong, the connection is closed as stale once exceeded
+
+	TLSCert     string // Certificate file serving HTTPS and WSS, empty serves plain HTTP
+	TLSKey      string // Private key file of TLSCert
+	TLSClientCA string // CA file verifying client certificates, enables mutual TLS if set
+
+	AllowedOrigins          []string // Host patterns of origins allowed by WebSocket handshakes and CORS, besides the same host
+	InsecureSkipOriginCheck bool     // Allow any origin, only for development
+}
+
+type SessionConfigOptions struct {
+	TTL            time.Duration // Session expires if no media is received from edge in TTL
+	HibernateAfter time.Duration // Edge is asked to pause a session without viewers in it, non-positive value disables it
+	Store          string        // Store of session metadata, "memory" or URL shared by instances, e.g. redis://host:6379/0
+	StoreInstance  string        // Instance name in store, defaults to hostname
+	StoreTTL       time.Duration // Metadata of a failed instance expires in it
+}
+
+type QuotaConfigOptions struct {
+	DailyEgressMB   int // Daily viewer egress cap per tenant in megabytes, zero means unlimited
+	MonthlyEgressMB int // Monthly viewer egress cap per tenant in megabytes, zero means unlimited
+	AccountInterval time.Duration
+}
+
+type RecordingConfigOptions struct {
+	Sinks    []string      // Recording sinks in form of "tenant=URL"
+	Machines []string      // Edge device IDs recorded once they publish, "*" records all
+	Rotation time.Duration // Interval of rotating recording segments, non-positive value disables rotation
+}
+
+type MetricsConfigOptions struct {
+	PushURL      string // Prometheus Pushgateway URL, empty disables pushing
+	PushInterval time.Duration
+	PushJob      string
+	PushInstance string // Defaults to hostname
+}
+
+type TracingConfigOptions struct {
+	TracingEndpoint    string   // Base URL of OTLP/HTTP receiver spans are exported to, empty disables tracing
+	TracingServiceName string   // service.name of spans
+	TracingSampleRatio float64  // Ratio of signaling traces sampled, traces continued from edges and clients follow their decisions
+	TracingHeaders     []string // Headers of export requests in form of "key=value", e.g. auth of hosted collectors
+}
+
+type AuthConfigOptions struct {
+	SigningKey string // HMAC key of subscriber JWT, empty disables auth
+	Issuer     string // Expected issuer of subscriber JWT, empty accepts any
+}
+
+type StandbyConfigOptions struct {
+	Role              string // "primary" or "standby", empty disables pairing
+	Instance          string // Instance name in heartbeats, defaults to hostname
+	TopicPrefix       string // MQTT topic prefix of pairing heartbeats
+	HeartbeatInterval time.Duration
+	FailoverTimeout   time.Duration // Standby takes over if no heartbeat is received from primary in it
+	TakeoverCommand   string        // Shell command switching signaling endpoint to standby, e.g. moving virtual IP
+}
+
+type SLOConfigOptions struct {
+	JoinTarget    time.Duration // Latency from offer received to first media of a subscriber join
+	JoinObjective float64       // Ratio of joins expected within JoinTarget
+	Window        time.Duration
+}
+
+type SubscriberMQTTConfigOptions struct {
+	MQTTSignal                   bool   // Enables subscriber signaling over MQTT alongside WebSocket
+	MQTTOfferTopicPrefix         string // Subscribers publish offers to "prefix/client_id/id/track_source"
+	MQTTAnswerTopicPrefix        string
+	MQTTCandidateSendTopicPrefix string // Opposite to subscriber's candidate receiving topic
+	MQTTCandidateRecvTopicPrefix string // Opposite to subscriber's candidate sending topic
+}
+
+type QualityConfigOptions struct {
+	CheckInterval time.Duration // Interval of checking ingest quality, non-positive value disables it
+	DegradedAfter time.Duration // Quality is degraded once degradation is found consecutively in it
+	MaxPacketLoss float64       // Max ratio of lost RTP packets of video from edge
+	StallTimeout  time.Duration // Max time without media from edge, zero disables it
+	MinBitrate    int           // Min bitrate in kbps of stream from edge, zero disables it
+}
+
+type CanaryConfigOptions struct {
+	Canary        bool          // Publish a synthetic test pattern session and probe it with a synthetic subscriber
+	CanaryID      string        // Machine ID of the canary session, it must not collide with edges
+	ProbeInterval time.Duration // Interval of synthetic subscriber joining the canary session
+	ProbeTimeout  time.Duration // Max time of a probe from offer to first media
+}
+
+type HLSConfigOptions struct {
+	HLS             bool          // Remux live sessions into LL-HLS for viewers that can't do WebRTC
+	SegmentDuration time.Duration // Target duration of segments, which start at the next keyframe after it
+	PartDuration    time.Duration // Target duration of LL-HLS partial segments
+	WindowSize      int           // Segments listed in playlist
+}
+
+type DirectoryConfigOptions struct {
+	Directory         string        // URL of directory store shared by regions, e.g. redis://host:6379/0, empty disables it
+	DirectoryInstance string        // Instance name in directory, defaults to hostname
+	PublicURL         string        // Public base URL of this instance viewers are redirected to, e.g. wss://eu.example.com
+	DirectoryTTL      time.Duration // Entries of a failed instance expire in it
+}
+
+type RTSPConfigOptions struct {
+	RTSPSources string // YAML file of RTSP sources pulled as track sources of machines, empty means none
+}
+
+type SRTConfigOptions struct {
+	SRTPort    int           // UDP port of SRT listener for edges publishing MPEG-TS, 0 disables it
+	SRTStreams []string      // Streams accepted, each in form of "stream_id=id:track_source"
+	SRTLatency time.Duration // Receiver latency, packets not recovered in it are dropped
+}
+
+type RTMPConfigOptions struct {
+	RTMPPort       int      // TCP port of RTMP server for third-party encoders, 0 disables it
+	RTMPStreams    []string // Stream keys accepted, each in form of "stream_key=id:track_source"
+	RTMPTranscoder string   // Path of ffmpeg transcoding AAC audio to Opus, empty drops audio
+}
+
+type WHIPConfigOptions struct {
+	WHIP      bool   // Serve WHIP endpoint for standard encoders publishing without MQTT
+	WHIPToken string // Bearer token of WHIP publishers, empty accepts any
+}
+
+type HealthConfigOptions struct {
+	HealthPort       int           // Port serving health probes and metrics apart from signaling, 0 serves them on signaling server, metrics with admin token
+	WatchdogInterval time.Duration // Interval of watchdog heartbeats of signaling components
+	WatchdogTimeout  time.Duration // Liveness fails if a heartbeat doesn't return in it, e.g. on deadlock
+}
+
+type AdminConfigOptions struct {
+	AdminToken string // Bearer token of operators closing sessions and kicking subscribers, empty disables the admin API
+
+	CaptureDir         string        // Directory of RTP capture files, empty disables captures
+	CaptureQuotaMB     int           // Disk quota of all capture files in megabytes, zero means unlimited
+	CaptureMaxDuration time.Duration // Max duration of a capture
+}
+
+type EdgeSignalConfigOptions struct {
+	EdgeSignal string // Transport of edge publisher signaling, mqtt or grpc
+	GRPCPort   int    // Port of gRPC signaling service edges dial if EdgeSignal is grpc
+	GRPCToken  string // Bearer token of gRPC edges, empty accepts any
+	EdgeSecret string // Secret deriving machine keys of edge offer and candidate tokens over MQTT, empty accepts any offer
+}
+
+type ACLConfigOptions struct {
+	ACL        string        // YAML file of stream access rules, or http(s) URL of an external authorizer, empty disables ACL
+	ACLTimeout time.Duration // Timeout of calling the external authorizer
+}
+
+type RateLimitConfigOptions struct {
+	SignalRate           float64 // New signaling connections per second per client IP, 0 means unlimited
+	SignalBurst          int     // Signaling connections a client IP may open at once, at least SignalRate
+	MaxSignalConnections int     // Max concurrent signaling connections of all clients, 0 means unlimited
+}
+
+type ClusterConfigOptions struct {
+	Cluster             bool          // Relay streams hosted by other instances located by directory, instead of redirecting viewers
+	ClusterTopicPrefix  string        // Instances announce themselves retained on "prefix/instance" for discovery
+	ClusterHeartbeat    time.Duration // Interval of announcements, an instance is gone after 3 intervals without one
+	ClusterIdleTimeout  time.Duration // A relayed stream is stopped once it has no viewers for it
+	ClusterRelayTimeout time.Duration // Max time of pulling a stream from another instance before viewers are answered
+}
+
+type CascadeConfigOptions struct {
+	Upstream            string        // Base URL of the origin instance whose streams are relayed, e.g. https://origin.example.com, empty disables it
+	UpstreamToken       string        // Subscriber JWT of upstream, empty if upstream doesn't authenticate
+	CascadeMachines     []string      // Edge device IDs relayed, "*" or empty relays all, "prefix*" matches by prefix
+	CascadePollInterval time.Duration // Interval of listing live streams of upstream
+	CascadeMaxBackoff   time.Duration // Max interval of reconnecting a relayed stream, it doubles from 1s
+}
+
+type AuditConfigOptions struct {
+	AuditSinks   []string      // Sinks of audit events, file path, mqtt:///topic or http(s) webhook URL, empty disables audit
+	AuditBuffer  int           // Events queued for sinks, events are dropped once it's full
+	AuditTimeout time.Duration // Max time of writing an event to a sink
+}
+
+type WebhookConfigOptions struct {
+	Webhooks       []string      // URLs notified of streams starting and stopping, empty disables webhooks
+	WebhookSecret  string        // HMAC SHA-256 key signing payloads, empty sends them unsigned
+	WebhookRetries int           // Retries of a failed delivery before giving up
+	WebhookBackoff time.Duration // Interval before the first retry, it doubles on every retry
+	WebhookTimeout time.Duration // Max time of a delivery attempt
+}
+
+type RecoveryConfigOptions struct {
+	StateFile        string        // File persisting sessions, whose edges are asked to re-signal on startup, empty disables it
+	ResignalAttempts int           // Times edges of a session not published again are asked before giving up
+	ResignalInterval time.Duration // Interval of asking edges to re-signal
+}
+
+type ThumbnailConfigOptions struct {
+	Thumbnails        bool          // Take JPEG thumbnails of live H264 streams by decoding keyframes, it costs CPU
+	ThumbnailInterval time.Duration // Interval of taking thumbnails of each stream
+	ThumbnailWidth    int           // Width in pixels of thumbnails, height keeps aspect ratio
+	ThumbnailDecoder  string        // Path of ffmpeg decoding keyframes
+}
+
+type DemoConfigOptions struct {
+	Demo          bool     // Serve the embedded demo player under /demo/, useful for debug and demos
+	DemoSignalURL string   // WebSocket signaling URL of the demo player, empty means the server serving it
+	DemoStreams   []string // Streams listed by the demo player even if not live, in form of "id:track_source"
+}
+
+type TenantConfigOptions struct {
+	MultiTenant  bool     // Namespace machine IDs as "tenant:id", and MQTT topics of edges as "tenant/prefix/id/track_source"
+	TenantLimits []string // Concurrent streams and viewers per tenant in form of "tenant=streams:viewers", "*" for others, 0 means unlimited
+}
+
+type AccountingConfigOptions struct {
+	AccountingInterval  time.Duration // Interval egress bytes are aggregated over for billing reports, non-positive disables accounting
+	AccountingRetention time.Duration // Closed intervals older than it are dropped, non-positive keeps all
+}
+
+type ShareConfigOptions struct {
+	ShareBaseURL string        // URL of the viewer page of sharing links, the token and the stream are appended as query
+	ShareMaxTTL  time.Duration // Max lifetime of a sharing link, non-positive means no limit
 }
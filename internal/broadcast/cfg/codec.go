@@ -0,0 +1,65 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// supportedCodecs are mime types of codecs forwarded from edges, in lower case.
+var supportedCodecs = map[string]bool{
+	"video/h264": true,
+	"video/vp8":  true,
+	"video/vp9":  true,
+	"video/av1":  true,
+	"audio/opus": true,
+	"audio/g722": true,
+	"audio/pcmu": true,
+	"audio/pcma": true,
+}
+
+// Codec is a codec accepted from edges of a track source.
+type Codec struct {
+	TrackSource int32
+	MimeType    string // e.g. "video/VP8"
+	ClockRate   uint32 // Zero accepts any
+	SDPFmtpLine string // Format parameters the offer must carry, e.g. "profile-level-id=42e01f", empty accepts any
+}
+
+// ParseCodec parses codec in form of "track_source:mime_type[/clock_rate][;fmtp]",
+// e.g. "1:video/VP8" or "2:video/H264/90000;packetization-mode=1;profile-level-id=42e01f".
+func ParseCodec(s string) (Codec, error) {
+	var codec Codec
+	i := strings.Index(s, ":")
+	if i < 0 {
+		return codec, errors.New("codec track source is missing")
+	}
+	trackSource, err := strconv.ParseInt(s[:i], 10, 32)
+	if err != nil {
+		return codec, fmt.Errorf("invalid codec track source: %w", err)
+	}
+	codec.TrackSource = int32(trackSource)
+	s = s[i+1:]
+
+	if i := strings.Index(s, ";"); i >= 0 {
+		codec.SDPFmtpLine = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return codec, errors.New("codec must be a mime type with optional clock rate, e.g. video/VP8/90000")
+	}
+	codec.MimeType = parts[0] + "/" + parts[1]
+	if !supportedCodecs[strings.ToLower(codec.MimeType)] {
+		return codec, fmt.Errorf("unsupported codec %s", codec.MimeType)
+	}
+	if len(parts) == 3 {
+		clockRate, err := strconv.ParseUint(parts[2], 10, 32)
+		if err != nil {
+			return codec, fmt.Errorf("invalid codec clock rate: %w", err)
+		}
+		codec.ClockRate = uint32(clockRate)
+	}
+	return codec, nil
+}
@@ -0,0 +1,60 @@
+package cfg
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ICEServer is a STUN or TURN server.
+type ICEServer struct {
+	URL        string
+	Username   string
+	Credential string
+}
+
+// ParseICEServer parses ICE server in form of "[username:credential@]URL",
+// e.g. "stun:stun.l.google.com:19302" or "user:password@turn:turn.example.com:3478?transport=udp".
+// Credential may contain ":" or "@", but username may not contain ":".
+func ParseICEServer(s string) (ICEServer, error) {
+	var server ICEServer
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		userinfo := s[:i]
+		s = s[i+1:]
+		j := strings.Index(userinfo, ":")
+		if j < 0 {
+			return server, errors.New("ICE server credential is missing")
+		}
+		server.Username, server.Credential = userinfo[:j], userinfo[j+1:]
+	}
+	if !strings.HasPrefix(s, "stun:") && !strings.HasPrefix(s, "stuns:") &&
+		!strings.HasPrefix(s, "turn:") && !strings.HasPrefix(s, "turns:") {
+		return server, errors.New("ICE server URL must be stun:, stuns:, turn: or turns:")
+	}
+	server.URL = s
+	return server, nil
+}
+
+// ParseNAT1To1IP parses NAT 1:1 IP in form of "external[/local]", e.g. "203.0.113.10" advertised in place of
+// host candidate IPs of its address family, or "2001:db8::10/fd00::10" in place of the local IP only.
+// IPs of a mapping must be of the same address family, local is nil if not mapped.
+func ParseNAT1To1IP(s string) (external, local net.IP, err error) {
+	ext, loc := s, ""
+	if i := strings.Index(s, "/"); i >= 0 {
+		ext, loc = s[:i], s[i+1:]
+	}
+	if external = net.ParseIP(ext); external == nil {
+		return nil, nil, fmt.Errorf("NAT 1:1 IP %q must be external IP or external/local", s)
+	}
+	if loc == "" {
+		return external, nil, nil
+	}
+	if local = net.ParseIP(loc); local == nil {
+		return nil, nil, fmt.Errorf("NAT 1:1 IP %q must be external IP or external/local", s)
+	}
+	if (external.To4() == nil) != (local.To4() == nil) {
+		return nil, nil, fmt.Errorf("NAT 1:1 IP %q maps IPs of different address families", s)
+	}
+	return external, local, nil
+}
@@ -0,0 +1,301 @@
+package cfg
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxPlayoutDelay is the max delay of the playout-delay RTP header extension, 12 bits of 10ms.
+const maxPlayoutDelay = 4095 * 10 * time.Millisecond
+
+// ValidationError lists problems of options found by Validate.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return "invalid config: " + e.Problems[0]
+	}
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks options for mistakes which would otherwise surface at runtime as cryptic failures, e.g. topic
+// prefixes edges never match or TURN servers without credentials. Problems are named by keys of the config file,
+// and all of them are reported at once in a *ValidationError.
+func (c *ConfigOptions) Validate() error {
+	var v validator
+	c.validateTopics(&v)
+	c.validateICE(&v)
+	c.validateServer(&v)
+	c.validateFeatures(&v)
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+// topic is an MQTT topic prefix and its key.
+type topic struct {
+	key, prefix string
+	required    bool
+}
+
+// validateTopics checks topic prefixes, topics are built as "prefix/id/track_source" and subscribed with wildcards,
+// so a prefix must not end with "/" or contain wildcards, and distinct kinds of messages need distinct prefixes.
+func (c *ConfigOptions) validateTopics(v *validator) {
+	topics := []topic{
+		{"mqtt_client.topic_offer_prefix", c.OfferTopicPrefix, true},
+		{"mqtt_client.topic_answer_prefix", c.AnswerTopicPrefix, true},
+		{"mqtt_client.topic_candidate_send_prefix", c.CandidateSendTopicPrefix, true},
+		{"mqtt_client.topic_candidate_recv_prefix", c.CandidateRecvTopicPrefix, true},
+		{"mqtt_client.topic_hook_stream_prefix", c.HookStreamTopicPrefix, true},
+		{"mqtt_client.topic_hibernate_prefix", c.HibernateTopicPrefix, false},
+		{"mqtt_client.topic_capability_prefix", c.CapabilityTopicPrefix, false},
+	}
+	if c.MQTTSignal {
+		topics = append(topics,
+			topic{"subscriber_mqtt.topic_offer_prefix", c.MQTTOfferTopicPrefix, true},
+			topic{"subscriber_mqtt.topic_answer_prefix", c.MQTTAnswerTopicPrefix, true},
+			topic{"subscriber_mqtt.topic_candidate_send_prefix", c.MQTTCandidateSendTopicPrefix, true},
+			topic{"subscriber_mqtt.topic_candidate_recv_prefix", c.MQTTCandidateRecvTopicPrefix, true},
+		)
+	}
+	if c.Role != "" {
+		topics = append(topics, topic{"standby.topic_prefix", c.StandbyConfigOptions.TopicPrefix, true})
+	}
+	if c.Cluster {
+		topics = append(topics, topic{"cluster.topic_prefix", c.ClusterTopicPrefix, true})
+	}
+
+	keys := make(map[string]string, len(topics))
+	for _, t := range topics {
+		switch {
+		case t.prefix == "":
+			if t.required {
+				v.addf("%s must not be empty", t.key)
+			}
+			continue
+		case strings.ContainsAny(t.prefix, "+#"):
+			v.addf("%s %q must not contain MQTT wildcards + or #", t.key, t.prefix)
+		case strings.HasSuffix(t.prefix, "/"):
+			v.addf("%s %q must not end with /, topics are built as prefix/id/track_source", t.key, t.prefix)
+		}
+		if key, ok := keys[t.prefix]; ok {
+			v.addf("%s and %s are both %q, messages of one would be taken for the other", key, t.key, t.prefix)
+			continue
+		}
+		keys[t.prefix] = t.key
+	}
+	if c.Qos > 2 {
+		v.addf("mqtt_client.qos %d must be 0, 1 or 2", c.Qos)
+	}
+}
+
+func (c *ConfigOptions) validateICE(v *validator) {
+	if c.ICEServer != "" {
+		validateICEServer(v, "webrtc.ice_server", ICEServer{URL: c.ICEServer, Username: c.Username, Credential: c.Credential},
+			"webrtc.ice_server_username and webrtc.ice_server_credential")
+	} else if c.Username != "" || c.Credential != "" {
+		v.addf("webrtc.ice_server_username and webrtc.ice_server_credential are set, but webrtc.ice_server is empty")
+	}
+	for _, server := range c.ICEServers {
+		validateICEServer(v, "webrtc.ice_servers", server, "username:credential@ in the entry")
+	}
+
+	switch {
+	case c.TURNSecret != "" && len(c.TURNURLs) == 0:
+		v.addf("webrtc.turn_secret is set, but webrtc.turn_urls is empty, no TURN server would get minted credentials")
+	case c.TURNSecret == "" && len(c.TURNURLs) > 0:
+		v.addf("webrtc.turn_urls need webrtc.turn_secret minting their credentials, list servers with static credentials in webrtc.ice_servers")
+	case c.TURNSecret != "" && c.TURNCredentialTTL <= 0:
+		v.addf("webrtc.turn_credential_ttl must be positive")
+	}
+	for _, u := range c.TURNURLs {
+		if !strings.HasPrefix(u, "turn:") && !strings.HasPrefix(u, "turns:") {
+			v.addf("webrtc.turn_urls %q must be a turn: or turns: URL", u)
+		}
+	}
+
+	if (c.UDPPortMin == 0) != (c.UDPPortMax == 0) {
+		v.addf("webrtc.udp_port_min and webrtc.udp_port_max must be set together")
+	}
+	if c.UDPPortMin > c.UDPPortMax && c.UDPPortMax != 0 {
+		v.addf("webrtc.udp_port_min %d is greater than webrtc.udp_port_max %d", c.UDPPortMin, c.UDPPortMax)
+	}
+	if c.UDPPortMax > 65535 {
+		v.addf("webrtc.udp_port_max %d is not a port", c.UDPPortMax)
+	}
+	validatePort(v, "webrtc.udp_port", c.UDPPort)
+	validatePort(v, "webrtc.tcp_port", c.TCPPort)
+	c.validateNAT1To1IPs(v)
+}
+
+// validateNAT1To1IPs checks NAT 1:1 IPs, an address family has either one external IP advertised in place of all
+// host candidate IPs, or mappings of distinct local IPs.
+func (c *ConfigOptions) validateNAT1To1IPs(v *validator) {
+	// soles and mapped are keyed by whether the family is IPv4.
+	soles := make(map[bool]string)
+	mapped := make(map[bool]string)
+	locals := make(map[string]bool)
+	for _, s := range c.NAT1To1IPs {
+		external, local, err := ParseNAT1To1IP(s)
+		if err != nil {
+			v.addf("webrtc.nat_1to1_ips: %v", err)
+			continue
+		}
+		ipv4 := external.To4() != nil
+		if !ipv4 && !c.IPv6 {
+			v.addf("webrtc.nat_1to1_ips %q is IPv6, but webrtc.ipv6 is disabled", s)
+		}
+		if local == nil {
+			if sole, ok := soles[ipv4]; ok {
+				v.addf("webrtc.nat_1to1_ips %q and %q are both external IPs of one address family, map them as external/local", sole, s)
+			}
+			soles[ipv4] = s
+		} else {
+			if locals[local.String()] {
+				v.addf("webrtc.nat_1to1_ips %q maps local IP %s mapped before", s, local)
+			}
+			locals[local.String()] = true
+			mapped[ipv4] = s
+		}
+		if sole, ok := soles[ipv4]; ok && mapped[ipv4] != "" {
+			v.addf("webrtc.nat_1to1_ips %q and %q mix an external IP and mappings of one address family", sole, mapped[ipv4])
+			delete(mapped, ipv4)
+		}
+	}
+}
+
+// validateICEServer checks the scheme of server, and credentials of TURN servers named by credentials.
+func validateICEServer(v *validator, key string, server ICEServer, credentials string) {
+	switch {
+	case strings.HasPrefix(server.URL, "turn:"), strings.HasPrefix(server.URL, "turns:"):
+		if server.Username == "" || server.Credential == "" {
+			v.addf("%s %q is a TURN server, it needs %s", key, server.URL, credentials)
+		}
+	case strings.HasPrefix(server.URL, "stun:"), strings.HasPrefix(server.URL, "stuns:"):
+	default:
+		v.addf("%s %q must be a stun:, stuns:, turn: or turns: URL", key, server.URL)
+	}
+}
+
+func (c *ConfigOptions) validateServer(v *validator) {
+	validatePort(v, "signal_server.port", c.ServerConfigOptions.Port)
+	validatePort(v, "health.port", c.HealthPort)
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		v.addf("signal_server.tls_cert and signal_server.tls_key must be set together")
+	}
+	if c.TLSClientCA != "" && c.TLSCert == "" {
+		v.addf("signal_server.tls_client_ca needs signal_server.tls_cert, mutual TLS is served over HTTPS only")
+	}
+
+	switch c.EdgeSignal {
+	case "mqtt":
+	case "grpc":
+		if c.GRPCPort <= 0 {
+			v.addf("edge_signal.grpc_port must be set if edge_signal.transport is grpc")
+		}
+	default:
+		v.addf("edge_signal.transport %q must be mqtt or grpc", c.EdgeSignal)
+	}
+	validatePort(v, "edge_signal.grpc_port", c.GRPCPort)
+	validatePort(v, "srt.port", c.SRTPort)
+	validatePort(v, "rtmp.port", c.RTMPPort)
+
+	if c.ShareBaseURL != "" {
+		if parsed, err := url.Parse(c.ShareBaseURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			v.addf("share.base_url %q must be an http or https URL", c.ShareBaseURL)
+		}
+	}
+	if c.Store != "" && c.Store != "memory" {
+		if parsed, err := url.Parse(c.Store); err != nil || !isStoreScheme(parsed.Scheme) {
+			v.addf("session.store %q must be memory or a redis, rediss, etcd or etcds URL", redactURL(c.Store))
+		}
+	}
+	for _, u := range c.Webhooks {
+		if parsed, err := url.Parse(u); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			v.addf("webhook.urls %q must be an http or https URL", redactURL(u))
+		}
+	}
+}
+
+func (c *ConfigOptions) validateFeatures(v *validator) {
+	switch c.Role {
+	case "", "primary", "standby":
+	default:
+		v.addf(`standby.role %q must be "primary", "standby" or empty`, c.Role)
+	}
+	if c.MultiTenant && c.SigningKey == "" {
+		v.addf("tenant.enable needs auth.signing_key, tenants of subscribers are taken from their tokens only")
+	}
+	if c.Cluster && c.Directory == "" {
+		v.addf("cluster.enable needs directory.url locating streams of other instances")
+	}
+	if c.PlayoutDelay {
+		switch {
+		case c.PlayoutDelayMin < 0:
+			v.addf("webrtc.playout_delay_min %s must not be negative", c.PlayoutDelayMin)
+		case c.PlayoutDelayMin > c.PlayoutDelayMax:
+			v.addf("webrtc.playout_delay_min %s is longer than webrtc.playout_delay_max %s", c.PlayoutDelayMin, c.PlayoutDelayMax)
+		case c.PlayoutDelayMax > maxPlayoutDelay:
+			v.addf("webrtc.playout_delay_max %s exceeds %s the playout-delay extension carries", c.PlayoutDelayMax, maxPlayoutDelay)
+		}
+	}
+	if c.HLS && c.PartDuration > c.SegmentDuration {
+		v.addf("hls.part_duration %s is longer than hls.segment_duration %s", c.PartDuration, c.SegmentDuration)
+	}
+	if c.JoinObjective <= 0 || c.JoinObjective > 1 {
+		v.addf("slo.join_objective %g must be in (0, 1]", c.JoinObjective)
+	}
+	if c.MaxPacketLoss < 0 || c.MaxPacketLoss > 1 {
+		v.addf("quality.max_packet_loss %g must be in [0, 1]", c.MaxPacketLoss)
+	}
+	if c.TracingSampleRatio < 0 || c.TracingSampleRatio > 1 {
+		v.addf("tracing.sample_ratio %g must be in [0, 1]", c.TracingSampleRatio)
+	}
+	if c.SignalRate > 0 && float64(c.SignalBurst) < c.SignalRate {
+		v.addf("ratelimit.signal_burst %d must be at least ratelimit.signal_rate %g", c.SignalBurst, c.SignalRate)
+	}
+	if c.Thumbnails && c.ThumbnailDecoder == "" {
+		v.addf("thumbnail.enable needs thumbnail.decoder, the path of ffmpeg")
+	}
+	if c.AccountingInterval > 0 && c.AccountingRetention > 0 && c.AccountingRetention < c.AccountingInterval {
+		v.addf("accounting.retention %s is shorter than accounting.interval %s, no closed interval would be reported",
+			c.AccountingRetention, c.AccountingInterval)
+	}
+}
+
+func validatePort(v *validator, key string, port int) {
+	if port < 0 || port > 65535 {
+		v.addf("%s %d is not a port", key, port)
+	}
+}
+
+// redactURL returns u with its password replaced, it's u itself if u has no password or can't be parsed.
+func redactURL(u string) string {
+	if parsed, err := url.Parse(u); err == nil && parsed.User != nil {
+		if _, ok := parsed.User.Password(); ok {
+			return parsed.Redacted()
+		}
+	}
+	return u
+}
+
+func isStoreScheme(scheme string) bool {
+	switch scheme {
+	case "redis", "rediss", "etcd", "etcds":
+		return true
+	}
+	return false
+}
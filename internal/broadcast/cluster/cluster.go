@@ -0,0 +1,390 @@
+// Package cluster runs instances as a cluster sharing session state, so a viewer reaching any instance can watch
+// a stream published to another. Sessions are located by the directory shared by instances, and instances
+// discover each other by announcements retained on MQTT. A stream hosted elsewhere is relayed to this instance
+// over WebRTC once a viewer asks for it, and stopped once it has no viewers for IdleTimeout.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/directory"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/relay"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultHeartbeat    = 5 * time.Second
+	defaultIdleTimeout  = 30 * time.Second
+	defaultRelayTimeout = 10 * time.Second
+
+	// expiryHeartbeats is the number of heartbeats missed before an instance is taken as gone.
+	expiryHeartbeats = 3
+
+	// tenant of relays, so their egress is accounted apart from viewers by the hosting instance.
+	tenant = "cluster"
+	// tokenTTL is lifetime of tokens of relays if auth is enabled, it only matters at signaling.
+	tokenTTL = 5 * time.Minute
+)
+
+// ErrNotHosted is returned if a stream is hosted by no instance of the cluster.
+var ErrNotHosted = errors.New("stream not hosted by any instance")
+
+// Instance is an instance of the cluster.
+type Instance struct {
+	directory.Entry
+	Sessions int `json:"sessions"` // Sessions published to the instance.
+	Relays   int `json:"relays"`   // Sessions relayed from other instances.
+}
+
+// announcement is an instance announced and when it's received.
+type announcement struct {
+	Instance
+	receivedAt time.Time
+}
+
+// pull is a stream being relayed from another instance.
+type pull struct {
+	started chan struct{} // Closed once sess is set or pulling failed.
+	sess    *session.Session
+	err     error
+}
+
+// Cluster relays streams hosted by other instances, and announces this instance to them.
+type Cluster struct {
+	logger    zerolog.Logger
+	config    cfg.ClusterConfigOptions
+	sessions  *session.SessionManager
+	directory *directory.Directory
+	// auth signs tokens of relays, it's nil if auth is disabled.
+	auth   *auth.Authenticator
+	issuer string
+
+	client    mqtt.Client
+	clientMux sync.RWMutex
+	watching  bool // Whether Run has subscribed announcements, guarded by clientMux.
+
+	// ctx is the context of relays, it's canceled once Run returns.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	instances map[string]announcement
+	pulls     map[session.Key]*pull
+}
+
+// New returns a new Cluster locating streams by d, which must be enabled.
+func New(
+	client mqtt.Client,
+	sessions *session.SessionManager,
+	d *directory.Directory,
+	logger *zerolog.Logger,
+	authConfig cfg.AuthConfigOptions,
+	config cfg.ClusterConfigOptions,
+) (*Cluster, error) {
+	if d == nil {
+		return nil, errors.New("directory is required to locate streams")
+	}
+	if config.ClusterTopicPrefix == "" {
+		return nil, errors.New("topic prefix is required")
+	}
+	if config.ClusterHeartbeat <= 0 {
+		config.ClusterHeartbeat = defaultHeartbeat
+	}
+	if config.ClusterIdleTimeout <= 0 {
+		config.ClusterIdleTimeout = defaultIdleTimeout
+	}
+	if config.ClusterRelayTimeout <= 0 {
+		config.ClusterRelayTimeout = defaultRelayTimeout
+	}
+
+	c := &Cluster{
+		logger:    loglevel.Default.Component(logger, "Cluster").With().Str("instance", d.Self().Instance).Logger(),
+		config:    config,
+		sessions:  sessions,
+		directory: d,
+		auth:      auth.New(authConfig),
+		issuer:    authConfig.Issuer,
+		client:    client,
+		instances: make(map[string]announcement),
+		pulls:     make(map[session.Key]*pull),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+// SetClient replaces the MQTT client, e.g. after broker credentials are rotated,
+// and subscribes announcements with the new client if Run has subscribed them.
+func (c *Cluster) SetClient(client mqtt.Client) {
+	c.clientMux.Lock()
+	c.client = client
+	watching := c.watching
+	c.clientMux.Unlock()
+
+	if watching {
+		c.subscribe()
+	}
+}
+
+func (c *Cluster) mqttClient() mqtt.Client {
+	c.clientMux.RLock()
+	defer c.clientMux.RUnlock()
+	return c.client
+}
+
+func (c *Cluster) topic(instance string) string {
+	return c.config.ClusterTopicPrefix + "/" + instance
+}
+
+// Run announces this instance every Heartbeat and watches announcements of others until ctx is done,
+// then withdraws the announcement and stops relaying.
+func (c *Cluster) Run(ctx context.Context) {
+	defer c.cancel()
+	c.clientMux.Lock()
+	c.watching = true
+	c.clientMux.Unlock()
+	c.subscribe()
+
+	ticker := time.NewTicker(c.config.ClusterHeartbeat)
+	defer ticker.Stop()
+	c.logger.Info().Dur("heartbeat", c.config.ClusterHeartbeat).Msg("joined cluster")
+	for {
+		c.announce()
+		select {
+		case <-ctx.Done():
+			c.clientMux.Lock()
+			c.watching = false
+			c.clientMux.Unlock()
+			client := c.mqttClient()
+			client.Unsubscribe(c.topic("+"))
+			// An empty retained message clears the announcement.
+			client.Publish(c.topic(c.directory.Self().Instance), 0, true, []byte{})
+			c.logger.Info().Msg("left cluster")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// announce publishes a retained announcement of this instance.
+func (c *Cluster) announce() {
+	self := Instance{Entry: c.directory.Self()}
+	self.UpdatedAt = time.Now()
+	for _, sess := range c.sessions.List() {
+		if sess.Origin != "" {
+			self.Relays++
+		} else {
+			self.Sessions++
+		}
+	}
+	payload, err := json.Marshal(&self)
+	if err != nil {
+		c.logger.Err(err).Msg("could not marshal announcement")
+		return
+	}
+	t := c.mqttClient().Publish(c.topic(self.Instance), 0, true, payload)
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			c.logger.Err(t.Error()).Msg("could not publish announcement")
+		}
+	}()
+}
+
+func (c *Cluster) subscribe() {
+	topic := c.topic("+")
+	t := c.mqttClient().Subscribe(topic, 0, func(_ mqtt.Client, m mqtt.Message) {
+		if len(m.Payload()) == 0 {
+			return
+		}
+		var instance Instance
+		if err := json.Unmarshal(m.Payload(), &instance); err != nil {
+			c.logger.Err(err).Str("topic", m.Topic()).Msg("could not unmarshal announcement")
+			return
+		}
+		if instance.Instance == c.directory.Self().Instance {
+			return
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if _, ok := c.instances[instance.Instance]; !ok {
+			c.logger.Info().Str("peer", instance.Instance).Str("region", instance.Region).Msg("discovered instance")
+		}
+		c.instances[instance.Instance] = announcement{Instance: instance, receivedAt: time.Now()}
+	})
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			c.logger.Err(t.Error()).Msgf("could not subscribe to %s", topic)
+		} else {
+			c.logger.Info().Msgf("subscribed to %s", topic)
+		}
+	}()
+}
+
+// Instances returns other instances announced recently, in order of names.
+func (c *Cluster) Instances() []Instance {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiry := time.Duration(expiryHeartbeats) * c.config.ClusterHeartbeat
+	instances := make([]Instance, 0, len(c.instances))
+	for name, a := range c.instances {
+		if time.Since(a.receivedAt) > expiry {
+			delete(c.instances, name)
+			c.logger.Info().Str("peer", name).Msg("instance is gone")
+			continue
+		}
+		instances = append(instances, a.Instance)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Instance < instances[j].Instance })
+	return instances
+}
+
+// Relay returns the session of meta relayed from the instance hosting it, pulling it if not relayed yet.
+// It waits until the hosting instance answers, RelayTimeout expires or ctx is done.
+// ErrNotHosted is returned if no other instance hosts the stream.
+func (c *Cluster) Relay(ctx context.Context, meta *pb.Meta) (*session.Session, error) {
+	key := c.sessions.Key(meta)
+	c.mu.Lock()
+	p, ok := c.pulls[key]
+	if !ok {
+		p = &pull{started: make(chan struct{})}
+		c.pulls[key] = p
+	}
+	c.mu.Unlock()
+	if !ok {
+		entry, hosted := c.directory.Remote(ctx, key)
+		if !hosted {
+			c.finish(key, p, ErrNotHosted)
+			return nil, ErrNotHosted
+		}
+		go c.pull(key, p, meta, entry)
+	}
+
+	timer := time.NewTimer(c.config.ClusterRelayTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.started:
+		return p.sess, p.err
+	case <-timer.C:
+		return nil, fmt.Errorf("could not relay stream in %s", c.config.ClusterRelayTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// pull relays the stream of meta from the instance of entry, until it has no viewers for IdleTimeout,
+// upstream ends or Run returns.
+func (c *Cluster) pull(key session.Key, p *pull, meta *pb.Meta, entry directory.Entry) {
+	logger := c.logger.With().Str("id", meta.Id).Int32("track_source", int32(meta.TrackSource)).Str("origin", entry.Instance).Logger()
+	u, err := c.signalURL(entry, meta)
+	if err != nil {
+		c.finish(key, p, err)
+		return
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	var once sync.Once
+	err = relay.Pull(ctx, u, meta, c.sessions, entry.Instance, &logger, func(sess *session.Session) {
+		once.Do(func() {
+			p.sess = sess
+			close(p.started)
+		})
+		go c.stopIdle(ctx, sess, cancel)
+	})
+	if err != nil {
+		logger.Err(err).Msg("stopped relaying stream")
+	} else {
+		logger.Info().Msg("stopped relaying stream")
+	}
+	c.mu.Lock()
+	delete(c.pulls, key)
+	c.mu.Unlock()
+	once.Do(func() {
+		p.err = err
+		close(p.started)
+	})
+}
+
+// finish ends p of key which failed with err before pulling.
+func (c *Cluster) finish(key session.Key, p *pull, err error) {
+	c.mu.Lock()
+	delete(c.pulls, key)
+	c.mu.Unlock()
+	p.err = err
+	close(p.started)
+}
+
+// stopIdle calls stop once sess has no viewers for IdleTimeout, or returns once ctx is done.
+func (c *Cluster) stopIdle(ctx context.Context, sess *session.Session, stop context.CancelFunc) {
+	ticker := time.NewTicker(c.config.ClusterIdleTimeout / 2)
+	defer ticker.Stop()
+	idleSince := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if sess.Viewers() > 0 {
+				idleSince = now
+				continue
+			}
+			if now.Sub(idleSince) >= c.config.ClusterIdleTimeout {
+				stop()
+				return
+			}
+		}
+	}
+}
+
+// signalURL returns URL of the signaling endpoint of entry, with a token of meta if auth is enabled.
+func (c *Cluster) signalURL(entry directory.Entry, meta *pb.Meta) (string, error) {
+	query := url.Values{"tenant": {tenant}}
+	if c.auth != nil {
+		token, err := c.auth.Sign(&auth.Claims{
+			Issuer:    c.issuer,
+			Subject:   "cluster/" + c.directory.Self().Instance,
+			ExpiresAt: time.Now().Add(tokenTTL).Unix(),
+			Tenant:    tenant,
+			Streams:   []auth.Stream{{ID: meta.Id, TrackSources: []pb.TrackSource{meta.TrackSource}}},
+		})
+		if err != nil {
+			return "", fmt.Errorf("could not sign token: %w", err)
+		}
+		query.Set("token", token)
+	}
+	return entry.SignalURL() + "?" + query.Encode(), nil
+}
+
+// Handler serves instances of the cluster at /v1/broadcast/cluster.
+func (c *Cluster) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		type data struct {
+			Self      directory.Entry `json:"self"`
+			Instances []Instance      `json:"instances"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(data{Self: c.directory.Self(), Instances: c.Instances()}); err != nil {
+			c.logger.Err(err).Msg("could not write cluster JSON")
+		}
+	})
+}
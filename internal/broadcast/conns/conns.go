@@ -0,0 +1,154 @@
+// Package conns identifies signaling WebSocket connections and peer connections by UUID,
+// so logs, error replies and the admin API can correlate a failing viewer with its WebSocket.
+package conns
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+)
+
+// Kind is the kind of a connection.
+type Kind string
+
+const (
+	KindWebSocket Kind = "websocket"
+	KindPeer      Kind = "peer"
+)
+
+// Header carries the connection ID in HTTP replies of WHIP and WHEP, including error replies.
+const Header = "X-Connection-ID"
+
+// Default is the registry of broadcast service connections.
+var Default = NewRegistry()
+
+// Conn is a registered connection.
+type Conn struct {
+	ID   string `json:"id"`
+	Kind Kind   `json:"kind"`
+	// Role is publisher or subscriber.
+	Role string `json:"role"`
+	// Parent is ID of the WebSocket connection a peer connection is negotiated on, empty if it's signaled otherwise,
+	// e.g. by MQTT, WHIP or WHEP.
+	Parent     string    `json:"parent,omitempty"`
+	Meta       *pb.Meta  `json:"meta,omitempty"`
+	Tenant     string    `json:"tenant,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Since      time.Time `json:"since"`
+}
+
+// IDs returns ID of the WebSocket connection and ID of the peer connection c is or belongs to,
+// either is empty if there's none.
+func (c Conn) IDs() (connID, peerID string) {
+	if c.Kind == KindWebSocket {
+		return c.ID, ""
+	}
+	return c.Parent, c.ID
+}
+
+// Logger returns a copy of logger with IDs of c.
+func (c Conn) Logger(logger *zerolog.Logger) zerolog.Logger {
+	l := logger.With()
+	connID, peerID := c.IDs()
+	if connID != "" {
+		l = l.Str("conn_id", connID)
+	}
+	if peerID != "" {
+		l = l.Str("peer_id", peerID)
+	}
+	return l.Logger()
+}
+
+// Registry tracks live connections by ID.
+type Registry struct {
+	mu    sync.RWMutex
+	conns map[string]Conn
+}
+
+// NewRegistry returns a new Registry.
+func NewRegistry() *Registry {
+	return &Registry{conns: make(map[string]Conn)}
+}
+
+// Register registers c until done is closed, and returns the registered one.
+// A new ID is assigned if c has none, one is preassigned if logs need it before the connection is set up.
+func (r *Registry) Register(c Conn, done <-chan struct{}) Conn {
+	if c.ID == "" {
+		c.ID = NewID()
+	}
+	c.Since = time.Now()
+	r.mu.Lock()
+	r.conns[c.ID] = c
+	r.mu.Unlock()
+
+	go func() {
+		<-done
+		r.mu.Lock()
+		delete(r.conns, c.ID)
+		r.mu.Unlock()
+	}()
+	return c
+}
+
+// Get returns the connection of id.
+func (r *Registry) Get(id string) (Conn, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.conns[id]
+	return c, ok
+}
+
+// List returns connections in order of time registered.
+func (r *Registry) List() []Conn {
+	r.mu.RLock()
+	list := make([]Conn, 0, len(r.conns))
+	for _, c := range r.conns {
+		list = append(list, c)
+	}
+	r.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Since.Before(list[j].Since) })
+	return list
+}
+
+// Children returns peer connections negotiated on the WebSocket connection of id.
+func (r *Registry) Children(id string) []Conn {
+	children := make([]Conn, 0)
+	for _, c := range r.List() {
+		if c.Parent == id {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// NewID returns a random (version 4) UUID.
+// See: https://datatracker.ietf.org/doc/html/rfc4122#section-4.4
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on supported platforms.
+		panic(fmt.Sprintf("could not read random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying c, replies and logs of a connection take IDs from it.
+func NewContext(ctx context.Context, c Conn) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the connection carried by ctx.
+func FromContext(ctx context.Context) (Conn, bool) {
+	c, ok := ctx.Value(contextKey{}).(Conn)
+	return c, ok
+}
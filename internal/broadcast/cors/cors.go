@@ -0,0 +1,104 @@
+// Package cors checks origins of browser requests to signaling and REST endpoints, for both WebSocket handshakes
+// and CORS of REST endpoints, e.g. WHEP and stream discovery called by web apps of other origins.
+// See: https://fetch.spec.whatwg.org/#http-cors-protocol
+package cors
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"nhooyr.io/websocket"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+const (
+	allowMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	allowHeaders = "Authorization, Content-Type, If-Match, Traceparent"
+	// exposeHeaders are headers WHIP and WHEP clients read, e.g. resource URL of a peer connection.
+	exposeHeaders = "Location, Link, ETag, Retry-After"
+	// maxAge is seconds browsers cache a preflight result.
+	maxAge = "600"
+)
+
+// Policy allows origins of AllowedOrigins, and origins of the same host as requests are always allowed.
+type Policy struct {
+	patterns []string
+	skip     bool
+}
+
+// New returns a new Policy of host patterns of config, e.g. "app.example.com" or "*.example.com", matched by
+// path.Match against hosts of origins as websocket.AcceptOptions.OriginPatterns are.
+func New(config cfg.ServerConfigOptions) *Policy {
+	patterns := make([]string, 0, len(config.AllowedOrigins))
+	for _, v := range config.AllowedOrigins {
+		patterns = append(patterns, strings.ToLower(v))
+	}
+	return &Policy{
+		patterns: patterns,
+		skip:     config.InsecureSkipOriginCheck,
+	}
+}
+
+// AcceptOptions returns options of accepting WebSocket connections by the policy.
+func (p *Policy) AcceptOptions() *websocket.AcceptOptions {
+	return &websocket.AcceptOptions{
+		OriginPatterns:     p.patterns,
+		InsecureSkipVerify: p.skip,
+	}
+}
+
+// Allow reports whether origin of a request to host is allowed.
+func (p *Policy) Allow(origin, host string) bool {
+	if p.skip {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		if ok, _ := path.Match(pattern, strings.ToLower(u.Host)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Handler is a middleware adding CORS headers to responses of allowed origins, and answering their preflights.
+// Responses to other origins carry no CORS headers, so browsers don't expose them.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.Allow(origin, r.Host) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", exposeHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+		w.Header().Set("Access-Control-Max-Age", maxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
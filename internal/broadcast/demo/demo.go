@@ -0,0 +1,135 @@
+// Package demo serves the demo player, a web page watching live streams over WebSocket signaling, e.g. for debug
+// and demos. The player is embedded in the binary, so it works wherever the binary runs, and the page is rendered
+// with streams and signaling URL of the server, so it needs no editing.
+package demo
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// Path is the path prefix the demo player is served under.
+const Path = "/demo/"
+
+//go:embed static
+var static embed.FS
+
+// page is the template of the player page.
+var page = template.Must(template.ParseFS(static, "static/index.html"))
+
+// Demo serves the demo player.
+type Demo struct {
+	logger zerolog.Logger
+	config cfg.DemoConfigOptions
+	// sessions lists live streams, it's nil if only configured streams are listed.
+	sessions *session.SessionManager
+	// streams are configured streams listed even if they are not live.
+	streams []Stream
+}
+
+// Stream is a stream listed by the player.
+type Stream struct {
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	Live        bool           `json:"live"`
+}
+
+// player is the data the page is rendered with.
+type player struct {
+	// SignalURL is the WebSocket signaling URL, the player derives it from its own location if empty.
+	SignalURL string   `json:"signal_url"`
+	Streams   []Stream `json:"streams"`
+}
+
+// New returns a new Demo listing live sessions of sessions, which may be nil, along with configured streams.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.DemoConfigOptions) (*Demo, error) {
+	streams := make([]Stream, 0, len(config.DemoStreams))
+	for _, v := range config.DemoStreams {
+		stream, err := parseStream(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid demo stream %q: %w", v, err)
+		}
+		streams = append(streams, stream)
+	}
+	return &Demo{
+		logger:   loglevel.Default.Component(logger, "Demo"),
+		config:   config,
+		sessions: sessions,
+		streams:  streams,
+	}, nil
+}
+
+// parseStream parses a stream in form of "id:track_source".
+func parseStream(s string) (Stream, error) {
+	i := strings.LastIndexByte(s, ':')
+	if i <= 0 {
+		return Stream{}, errors.New("must be in form of id:track_source")
+	}
+	source, err := strconv.ParseInt(s[i+1:], 10, 32)
+	if err != nil {
+		return Stream{}, fmt.Errorf("invalid track source: %w", err)
+	}
+	return Stream{ID: s[:i], TrackSource: pb.TrackSource(source)}, nil
+}
+
+// Handler serves the player page at Path, it must be mounted at Path.
+func (d *Demo) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != Path {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		// Streams listed change as sessions come and go.
+		w.Header().Set("Cache-Control", "no-cache")
+		if err := page.Execute(w, player{SignalURL: d.config.DemoSignalURL, Streams: d.list()}); err != nil {
+			d.logger.Err(err).Msg("could not render demo player")
+		}
+	})
+}
+
+// list returns live streams followed by configured streams not live, sorted by ID and track source.
+func (d *Demo) list() []Stream {
+	streams := []Stream{}
+	live := make(map[Stream]bool)
+	if d.sessions != nil {
+		for _, sess := range d.sessions.List() {
+			stream := Stream{ID: sess.Meta.Id, TrackSource: sess.Meta.TrackSource}
+			live[stream] = true
+			stream.Live = true
+			streams = append(streams, stream)
+		}
+	}
+	for _, stream := range d.streams {
+		if !live[stream] {
+			streams = append(streams, stream)
+		}
+	}
+	sort.SliceStable(streams, func(i, j int) bool {
+		if streams[i].Live != streams[j].Live {
+			return streams[i].Live
+		}
+		if streams[i].ID != streams[j].ID {
+			return streams[i].ID < streams[j].ID
+		}
+		return streams[i].TrackSource < streams[j].TrackSource
+	})
+	return streams
+}
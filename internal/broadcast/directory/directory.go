@@ -0,0 +1,221 @@
+// Package directory maps edge devices to the region and instance hosting their sessions, in a store shared by
+// instances of all regions, so viewers reaching any region can be redirected to the right one and worldwide
+// deployments present a single viewing URL.
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultTTL = 30 * time.Second
+
+	storeTimeout = 5 * time.Second
+)
+
+// Entry tells where sessions of an edge device are hosted.
+type Entry struct {
+	Region   string `json:"region,omitempty"`
+	Instance string `json:"instance"`
+	// URL is the public base URL of the hosting instance, e.g. "wss://eu.example.com".
+	URL       string    `json:"url"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SignalURL returns URL of the signaling endpoint of the hosting instance.
+func (e Entry) SignalURL() string {
+	return e.URL + "/v1/broadcast/signal"
+}
+
+// Directory registers edge devices of local sessions, and looks up edge devices hosted elsewhere.
+// Entries are refreshed every third of TTL, so entries of a failed instance expire in TTL.
+type Directory struct {
+	logger   zerolog.Logger
+	store    Store
+	sessions *session.SessionManager
+	self     Entry
+	ttl      time.Duration
+}
+
+// New returns a new Directory of this instance in region.
+func New(
+	sessions *session.SessionManager,
+	logger *zerolog.Logger,
+	region string,
+	config cfg.DirectoryConfigOptions,
+) (*Directory, error) {
+	store, err := NewStore(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+	if config.PublicURL == "" {
+		return nil, errors.New("public URL is required to redirect viewers to this instance")
+	}
+	if config.DirectoryTTL <= 0 {
+		config.DirectoryTTL = defaultTTL
+	}
+	if config.DirectoryInstance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("could not get hostname as instance: %w", err)
+		}
+		config.DirectoryInstance = hostname
+	}
+
+	return &Directory{
+		logger:   loglevel.Default.Component(logger, "Directory").With().Str("instance", config.DirectoryInstance).Logger(),
+		store:    store,
+		sessions: sessions,
+		self: Entry{
+			Region:   region,
+			Instance: config.DirectoryInstance,
+			URL:      config.PublicURL,
+		},
+		ttl: config.DirectoryTTL,
+	}, nil
+}
+
+// Self returns the entry of this instance.
+func (d *Directory) Self() Entry {
+	return d.self
+}
+
+// name returns directory name of edge device of a session key, track sources of the same device are
+// hosted together.
+func name(key session.Key) string {
+	if key.Scope != "" {
+		return key.Scope + "/" + key.ID
+	}
+	return key.ID
+}
+
+// Run registers edge devices of local sessions as they come and go until ctx is done.
+func (d *Directory) Run(ctx context.Context) {
+	events, stop := d.sessions.Watch()
+	defer stop()
+	ticker := time.NewTicker(d.ttl / 3)
+	defer ticker.Stop()
+
+	// Registered edge devices, a device is registered while any of its sessions is live.
+	registered := make(map[string]struct{})
+	d.sync(ctx, registered, false)
+	for {
+		select {
+		case <-ctx.Done():
+			// Entries are left to expire, as a standby may take over sessions meanwhile.
+			return
+		case <-ticker.C:
+			d.sync(ctx, registered, true)
+		case event := <-events:
+			if event.Type == session.EventCreated || event.Type == session.EventClosed {
+				d.sync(ctx, registered, false)
+			}
+		}
+	}
+}
+
+// sync registers edge devices of local sessions not registered yet, or all of them if refresh is set,
+// and unregisters devices without local sessions. Sessions are listed rather than counted by events,
+// as events may be dropped while the store is slow.
+func (d *Directory) sync(ctx context.Context, registered map[string]struct{}, refresh bool) {
+	live := make(map[string]struct{})
+	for _, sess := range d.sessions.List() {
+		// Sessions relayed from other instances are hosted by their origins.
+		if sess.Origin != "" {
+			continue
+		}
+		live[name(sess.Key)] = struct{}{}
+	}
+	for n := range live {
+		if _, ok := registered[n]; !ok || refresh {
+			d.put(ctx, n)
+			registered[n] = struct{}{}
+		}
+	}
+	for n := range registered {
+		if _, ok := live[n]; !ok {
+			d.delete(ctx, n)
+			delete(registered, n)
+		}
+	}
+}
+
+func (d *Directory) put(ctx context.Context, n string) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	entry := d.self
+	entry.UpdatedAt = time.Now()
+	if err := d.store.Put(ctx, n, entry, d.ttl); err != nil {
+		d.logger.Err(err).Str("name", n).Msg("could not register edge device in directory")
+	}
+}
+
+func (d *Directory) delete(ctx context.Context, n string) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	if err := d.store.Delete(ctx, n, d.self.Instance); err != nil {
+		d.logger.Err(err).Str("name", n).Msg("could not unregister edge device from directory")
+		return
+	}
+	d.logger.Info().Str("name", n).Msg("unregistered edge device from directory")
+}
+
+// Remote returns the entry of edge device of key if it's hosted by another instance.
+func (d *Directory) Remote(ctx context.Context, key session.Key) (Entry, bool) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	entry, ok, err := d.store.Get(ctx, name(key))
+	if err != nil {
+		d.logger.Err(err).Str("name", name(key)).Msg("could not look up directory")
+		return Entry{}, false
+	}
+	if !ok || entry.Instance == d.self.Instance {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Handler serves lookups of edge devices at /v1/broadcast/directory/{id}, and replies not found if a device
+// is not live in any region.
+func (d *Directory) Handler() http.Handler {
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/broadcast/directory/{id}", func(w http.ResponseWriter, r *http.Request) {
+		key := d.sessions.Key(&pb.Meta{Id: mux.Vars(r)["id"]})
+		ctx, cancel := context.WithTimeout(r.Context(), storeTimeout)
+		defer cancel()
+		entry, ok, err := d.store.Get(ctx, name(key))
+		if err != nil {
+			d.logger.Err(err).Str("name", name(key)).Msg("could not look up directory")
+			http.Error(w, "could not look up directory", http.StatusBadGateway)
+			return
+		}
+		if !ok {
+			http.Error(w, "edge device not found", http.StatusNotFound)
+			return
+		}
+
+		type data struct {
+			Entry
+			SignalURL string `json:"signal_url"`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(data{Entry: entry, SignalURL: entry.SignalURL()}); err != nil {
+			d.logger.Err(err).Msg("could not write directory entry JSON")
+		}
+	}).Methods(http.MethodGet)
+	return r
+}
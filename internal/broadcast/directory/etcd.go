@@ -0,0 +1,60 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/kv"
+)
+
+// EtcdStore stores directory entries in etcd, attached to leases of their TTL.
+type EtcdStore struct {
+	client *kv.Etcd
+}
+
+func newEtcdStoreFromURL(u *url.URL) (*EtcdStore, error) {
+	client, err := kv.NewEtcd(u)
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdStore{client: client}, nil
+}
+
+// Put implements Store.
+func (s *EtcdStore) Put(ctx context.Context, name string, entry Entry, ttl time.Duration) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.client.Put(ctx, keyPrefix+name, value, ttl)
+}
+
+// Get implements Store.
+func (s *EtcdStore) Get(ctx context.Context, name string) (Entry, bool, error) {
+	value, ok, err := s.client.Get(ctx, keyPrefix+name)
+	if err != nil || !ok {
+		return Entry{}, false, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(value, &entry); err != nil {
+		return Entry{}, false, fmt.Errorf("could not unmarshal directory entry: %w", err)
+	}
+	return entry, true, nil
+}
+
+// Delete implements Store. The entry is deleted only if it's still the one read, so it's kept if another
+// instance puts a newer one meanwhile.
+func (s *EtcdStore) Delete(ctx context.Context, name string, instance string) error {
+	value, ok, err := s.client.Get(ctx, keyPrefix+name)
+	if err != nil || !ok {
+		return err
+	}
+	var entry Entry
+	if err := json.Unmarshal(value, &entry); err != nil || entry.Instance != instance {
+		return nil
+	}
+	return s.client.DeleteIf(ctx, keyPrefix+name, value)
+}
@@ -0,0 +1,63 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/kv"
+)
+
+// redisDeleteScript deletes an entry only if it's hosted by the given instance, atomically.
+const redisDeleteScript = `local v = redis.call('GET', KEYS[1])
+if v and cjson.decode(v).instance == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0`
+
+// RedisStore stores directory entries in Redis.
+type RedisStore struct {
+	client *kv.Redis
+}
+
+func newRedisStoreFromURL(u *url.URL) (*RedisStore, error) {
+	client, err := kv.NewRedis(u)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Put implements Store.
+func (s *RedisStore) Put(ctx context.Context, name string, entry Entry, ttl time.Duration) error {
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Do(ctx, "SET", keyPrefix+name, string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Get implements Store.
+func (s *RedisStore) Get(ctx context.Context, name string) (Entry, bool, error) {
+	reply, err := s.client.Do(ctx, "GET", keyPrefix+name)
+	if errors.Is(err, kv.ErrNil) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+	var entry Entry
+	if err := json.Unmarshal([]byte(reply), &entry); err != nil {
+		return Entry{}, false, fmt.Errorf("could not unmarshal directory entry: %w", err)
+	}
+	return entry, true, nil
+}
+
+// Delete implements Store.
+func (s *RedisStore) Delete(ctx context.Context, name string, instance string) error {
+	_, err := s.client.Do(ctx, "EVAL", redisDeleteScript, "1", keyPrefix+name, instance)
+	return err
+}
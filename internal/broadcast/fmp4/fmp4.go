@@ -0,0 +1,220 @@
+// Package fmp4 muxes H264 video and Opus audio into fragmented MP4 of ISO/IEC 14496-12, for LL-HLS and recordings.
+package fmp4
+
+import (
+	"encoding/binary"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+)
+
+// Track IDs of fragmented MP4.
+const (
+	videoTrackID = 1
+	audioTrackID = 2
+)
+
+// Sample flags of trun, see ISO/IEC 14496-12 8.8.3.1.
+const (
+	FlagsSync    = 0x02000000 // sample_depends_on 2, a keyframe.
+	FlagsNonSync = 0x01010000 // sample_depends_on 1 and sample_is_non_sync_sample.
+)
+
+// opusPreSkip is pre-skip of Opus in samples at 48 kHz, which is 6.5 ms as libopus encoders use.
+const opusPreSkip = 312
+
+// Sample is a media sample of a fragment.
+type Sample struct {
+	Data     []byte
+	Time     int64 // Decode time in track timescale, 90 kHz of video and 48 kHz of audio.
+	Duration uint32
+	Flags    uint32
+}
+
+// box returns an ISO BMFF box of typ with children concatenated as payload.
+func box(typ string, children ...[]byte) []byte {
+	size := 8
+	for _, child := range children {
+		size += len(child)
+	}
+	b := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(b, uint32(size))
+	copy(b[4:], typ)
+	for _, child := range children {
+		b = append(b, child...)
+	}
+	return b
+}
+
+// fullBox returns a full box of typ with version and flags.
+func fullBox(typ string, version byte, flags uint32, children ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, children...)...)
+}
+
+func u16(v uint16) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+func u32(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func zeros(n int) []byte {
+	return make([]byte, n)
+}
+
+// matrix is the unity transformation matrix of tkhd and mvhd.
+var matrix = []byte{
+	0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0x40, 0, 0, 0,
+}
+
+// InitSegment returns the initialization segment of H264 video of sps and pps, and Opus audio if audio is set.
+func InitSegment(sps, pps []byte, audio bool) ([]byte, error) {
+	width, height, err := rtpx.SPSResolution(sps)
+	if err != nil {
+		return nil, err
+	}
+
+	traks := [][]byte{videoTrak(sps, pps, width, height)}
+	trexs := [][]byte{trex(videoTrackID)}
+	nextTrackID := uint32(videoTrackID + 1)
+	if audio {
+		traks = append(traks, audioTrak())
+		trexs = append(trexs, trex(audioTrackID))
+		nextTrackID = audioTrackID + 1
+	}
+
+	mvhd := fullBox("mvhd", 0, 0,
+		zeros(8),                                // Creation and modification time.
+		u32(1000),                               // Timescale.
+		zeros(4),                                // Duration, unknown as it's live.
+		u32(0x00010000), u16(0x0100), zeros(10), // Rate, volume and reserved.
+		matrix,
+		zeros(24), // Pre-defined.
+		u32(nextTrackID),
+	)
+	moov := box("moov", append(append([][]byte{mvhd}, traks...), box("mvex", trexs...))...)
+	ftyp := box("ftyp", []byte("iso5"), u32(512), []byte("iso5iso6mp41"))
+	return append(ftyp, moov...), nil
+}
+
+func videoTrak(sps, pps []byte, width, height int) []byte {
+	avcC := box("avcC",
+		[]byte{1, sps[1], sps[2], sps[3], 0xFF, 0xE1}, // 4 bytes NALU length and one SPS.
+		u16(uint16(len(sps))), sps,
+		[]byte{1}, u16(uint16(len(pps))), pps,
+	)
+	avc1 := box("avc1",
+		zeros(6), u16(1), // Reserved and data reference index.
+		zeros(16),
+		u16(uint16(width)), u16(uint16(height)),
+		u32(0x00480000), u32(0x00480000), // 72 dpi.
+		zeros(4), u16(1), // Reserved and frame count.
+		zeros(32),                // Compressor name.
+		u16(0x0018), u16(0xFFFF), // Depth and pre-defined.
+		avcC,
+	)
+	return trak(videoTrackID, uint32(width), uint32(height), 0, rtpx.VideoClockRate, "vide",
+		fullBox("vmhd", 0, 1, zeros(8)), avc1)
+}
+
+func audioTrak() []byte {
+	dOps := box("dOps",
+		[]byte{0, 2}, // Version and output channel count.
+		u16(opusPreSkip),
+		u32(rtpx.AudioClockRate),
+		u16(0), []byte{0}, // Output gain and channel mapping family.
+	)
+	opus := box("Opus",
+		zeros(6), u16(1), // Reserved and data reference index.
+		zeros(8),
+		u16(2), u16(16), // Channel count and sample size.
+		zeros(4),
+		u32(rtpx.AudioClockRate<<16),
+		dOps,
+	)
+	return trak(audioTrackID, 0, 0, 0x0100, rtpx.AudioClockRate, "soun",
+		fullBox("smhd", 0, 0, zeros(4)), opus)
+}
+
+// trak returns a track box without samples, which are all in fragments.
+func trak(id, width, height uint32, volume uint16, timescale uint32, handler string, mhd, sampleEntry []byte) []byte {
+	tkhd := fullBox("tkhd", 0, 3, // Enabled and in movie.
+		zeros(8), u32(id), zeros(4), zeros(4), // Times, track ID, reserved and duration.
+		zeros(8), zeros(4), // Reserved, layer and alternate group.
+		u16(volume), zeros(2),
+		matrix,
+		u32(width<<16), u32(height<<16),
+	)
+	mdhd := fullBox("mdhd", 0, 0, zeros(8), u32(timescale), zeros(4), u16(0x55C4), zeros(2)) // Language "und".
+	hdlr := fullBox("hdlr", 0, 0, zeros(4), []byte(handler), zeros(12), []byte("skywalker\x00"))
+	dinf := box("dinf", fullBox("dref", 0, 0, u32(1), fullBox("url ", 0, 1)))
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, u32(1), sampleEntry),
+		fullBox("stts", 0, 0, u32(0)),
+		fullBox("stsc", 0, 0, u32(0)),
+		fullBox("stsz", 0, 0, u32(0), u32(0)),
+		fullBox("stco", 0, 0, u32(0)),
+	)
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", mhd, dinf, stbl)))
+}
+
+func trex(id uint32) []byte {
+	return fullBox("trex", 0, 0, u32(id), u32(1), zeros(12))
+}
+
+// Fragment returns a movie fragment of sequence number with video and audio samples, in moof and mdat.
+// Samples of a track must be in decode order.
+func Fragment(sequence uint32, video, audio []Sample) []byte {
+	type run struct {
+		id      uint32
+		samples []Sample
+	}
+	var runs []run
+	for _, r := range []run{{videoTrackID, video}, {audioTrackID, audio}} {
+		if len(r.samples) > 0 {
+			runs = append(runs, r)
+		}
+	}
+
+	// trun data offsets are relative to moof, so moof is built twice: to size it, then with offsets.
+	build := func(offset uint32) []byte {
+		boxes := [][]byte{fullBox("mfhd", 0, 0, u32(sequence))}
+		for _, r := range runs {
+			entries := make([]byte, 0, 12*len(r.samples))
+			for _, s := range r.samples {
+				entries = append(entries, u32(s.Duration)...)
+				entries = append(entries, u32(uint32(len(s.Data)))...)
+				entries = append(entries, u32(s.Flags)...)
+			}
+			boxes = append(boxes, box("traf",
+				fullBox("tfhd", 0, 0x020000, u32(r.id)), // default-base-is-moof
+				fullBox("tfdt", 1, 0, u64(uint64(r.samples[0].Time))),
+				// data-offset, sample-duration, sample-size and sample-flags present.
+				fullBox("trun", 0, 0x000701, u32(uint32(len(r.samples))), u32(offset), entries),
+			))
+			for _, s := range r.samples {
+				offset += uint32(len(s.Data))
+			}
+		}
+		return box("moof", boxes...)
+	}
+	moof := build(0)
+	moof = build(uint32(len(moof)) + 8) // Data starts after mdat header.
+
+	var data [][]byte
+	for _, r := range runs {
+		for _, s := range r.samples {
+			data = append(data, s.Data)
+		}
+	}
+	return append(moof, box("mdat", data...)...)
+}
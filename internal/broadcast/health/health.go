@@ -0,0 +1,196 @@
+// Package health serves liveness and readiness probes, e.g. of Kubernetes deployments.
+//
+// Readiness runs checks on every probe, e.g. whether MQTT broker is connected. Liveness is reported by a watchdog,
+// which runs heartbeats periodically in background and reports down if one doesn't return in time,
+// e.g. when a signaling goroutine deadlocks holding a lock the heartbeat acquires.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+)
+
+// Check returns an error if a dependency isn't ready.
+type Check func() error
+
+// Heartbeat returns once the component is responsive, it blocks if the component is stuck.
+type Heartbeat func()
+
+// Health tracks readiness checks and liveness heartbeats by name.
+type Health struct {
+	logger zerolog.Logger
+	config cfg.HealthConfigOptions
+
+	mu     sync.RWMutex
+	checks map[string]Check
+	beats  map[string]Heartbeat
+	// stalled are heartbeats not returned in watchdog timeout, by the time they started.
+	stalled map[string]time.Time
+}
+
+// Status is the result of a probe.
+type Status struct {
+	Up bool `json:"up"`
+	// Failures are errors by name of failed checks or stalled heartbeats.
+	Failures map[string]string `json:"failures,omitempty"`
+}
+
+// New returns a new Health.
+func New(logger *zerolog.Logger, config cfg.HealthConfigOptions) (*Health, error) {
+	if config.WatchdogInterval <= 0 || config.WatchdogTimeout <= 0 {
+		return nil, errors.New("non-positive watchdog interval or timeout")
+	}
+	return &Health{
+		logger:  loglevel.Default.Component(logger, "Health"),
+		config:  config,
+		checks:  make(map[string]Check),
+		beats:   make(map[string]Heartbeat),
+		stalled: make(map[string]time.Time),
+	}, nil
+}
+
+// AddCheck adds a readiness check, it replaces the one of the same name.
+func (h *Health) AddCheck(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = check
+}
+
+// AddHeartbeat adds a liveness heartbeat run by watchdog, it replaces the one of the same name.
+func (h *Health) AddHeartbeat(name string, beat Heartbeat) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.beats[name] = beat
+}
+
+// Run runs heartbeats every watchdog interval until ctx is done.
+func (h *Health) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.config.WatchdogInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.beat()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// beat runs heartbeats not stalled yet concurrently, and marks those not returned in watchdog timeout stalled.
+// A stalled heartbeat is not run again until it returns, so a deadlock doesn't pile up goroutines.
+func (h *Health) beat() {
+	h.mu.RLock()
+	beats := make(map[string]Heartbeat, len(h.beats))
+	for name, beat := range h.beats {
+		if _, ok := h.stalled[name]; !ok {
+			beats[name] = beat
+		}
+	}
+	h.mu.RUnlock()
+
+	for name, beat := range beats {
+		go h.watch(name, beat)
+	}
+}
+
+// watch runs beat, marking it stalled while it doesn't return after watchdog timeout.
+func (h *Health) watch(name string, beat Heartbeat) {
+	started := time.Now()
+	done := make(chan struct{})
+	go func() {
+		beat()
+		close(done)
+	}()
+
+	timer := time.NewTimer(h.config.WatchdogTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	h.mu.Lock()
+	h.stalled[name] = started
+	h.mu.Unlock()
+	h.logger.Error().Str("heartbeat", name).Dur("timeout", h.config.WatchdogTimeout).Msg("heartbeat stalled")
+
+	<-done
+	h.mu.Lock()
+	delete(h.stalled, name)
+	h.mu.Unlock()
+	h.logger.Warn().Str("heartbeat", name).Dur("took", time.Since(started)).Msg("heartbeat recovered")
+}
+
+// Live reports stalled heartbeats.
+func (h *Health) Live() Status {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status := Status{Up: len(h.stalled) == 0}
+	for name, started := range h.stalled {
+		if status.Failures == nil {
+			status.Failures = make(map[string]string)
+		}
+		status.Failures[name] = "stalled for " + time.Since(started).Round(time.Second).String()
+	}
+	return status
+}
+
+// Ready runs readiness checks in order of names.
+func (h *Health) Ready() Status {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.checks))
+	checks := make(map[string]Check, len(h.checks))
+	for name, check := range h.checks {
+		names = append(names, name)
+		checks[name] = check
+	}
+	h.mu.RUnlock()
+	sort.Strings(names)
+
+	status := Status{Up: true}
+	for _, name := range names {
+		if err := checks[name](); err != nil {
+			if status.Failures == nil {
+				status.Failures = make(map[string]string)
+			}
+			status.Up = false
+			status.Failures[name] = err.Error()
+		}
+	}
+	return status
+}
+
+// LiveHandler serves liveness, it replies 503 if a heartbeat stalled.
+func (h *Health) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, h.Live())
+	})
+}
+
+// ReadyHandler serves readiness, it replies 503 if a check failed.
+func (h *Health) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeStatus(w, h.Ready())
+	})
+}
+
+func writeStatus(w http.ResponseWriter, status Status) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !status.Up {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,303 @@
+// Package hls serves live sessions over LL-HLS for viewers that can't do WebRTC, e.g. ops dashboards or
+// mobile web in restricted networks. Sessions are remuxed into fragmented MP4 without transcoding.
+// See: https://datatracker.ietf.org/doc/html/draft-pantos-hls-rfc8216bis
+package hls
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/share"
+)
+
+// Gateway remuxes every live session into LL-HLS and serves them.
+type Gateway struct {
+	logger   zerolog.Logger
+	config   cfg.HLSConfigOptions
+	sessions *session.SessionManager
+	auth     *auth.Authenticator
+	// shares are sharing links of streams, their viewers are not counted by HLS, as it has no connection to close.
+	shares *share.Links
+
+	mu      sync.RWMutex
+	streams map[session.Key]*stream
+}
+
+// New returns a new Gateway. Viewers are authenticated as WebSocket subscribers.
+func New(
+	sessions *session.SessionManager,
+	logger *zerolog.Logger,
+	authConfig cfg.AuthConfigOptions,
+	config cfg.HLSConfigOptions,
+) *Gateway {
+	return &Gateway{
+		logger:   loglevel.Default.Component(logger, "HLS"),
+		config:   config,
+		sessions: sessions,
+		auth:     auth.New(authConfig),
+		streams:  make(map[session.Key]*stream),
+	}
+}
+
+// SetShares sets sharing links checked along with tokens minted for them. It must be called before serving.
+func (g *Gateway) SetShares(l *share.Links) {
+	g.shares = l
+}
+
+// Run remuxes sessions as they come and go until ctx is done.
+func (g *Gateway) Run(ctx context.Context) {
+	events, stop := g.sessions.Watch()
+	defer stop()
+	for _, sess := range g.sessions.List() {
+		g.start(sess)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			g.mu.Lock()
+			for key, s := range g.streams {
+				s.close()
+				delete(g.streams, key)
+			}
+			g.mu.Unlock()
+			return
+		case event := <-events:
+			switch event.Type {
+			case session.EventCreated, session.EventReplaced:
+				g.start(event.Session)
+			case session.EventClosed:
+				g.stop(event.Session)
+			}
+		}
+	}
+}
+
+// start starts remuxing sess, replacing the stream of an older session of the same key.
+// Only H264 video is remuxed, the stream of an older session is stopped anyway.
+func (g *Gateway) start(sess *session.Session) {
+	if !strings.EqualFold(sess.VideoTrack.Codec().MimeType, webrtc.MimeTypeH264) {
+		g.mu.Lock()
+		if old, ok := g.streams[sess.Key]; ok {
+			old.close()
+			delete(g.streams, sess.Key)
+		}
+		g.mu.Unlock()
+		g.logger.Info().Str("id", sess.ID).Str("codec", sess.VideoTrack.Codec().MimeType).Msg("skipped HLS of unsupported codec")
+		return
+	}
+	s := newStream(sess, &g.logger, g.config.SegmentDuration, g.config.PartDuration, g.config.WindowSize)
+	g.mu.Lock()
+	old, ok := g.streams[sess.Key]
+	g.streams[sess.Key] = s
+	g.mu.Unlock()
+	if ok {
+		old.close()
+	}
+	go s.run()
+}
+
+func (g *Gateway) stop(sess *session.Session) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if s, ok := g.streams[sess.Key]; ok && s.sess == sess {
+		s.close()
+		delete(g.streams, sess.Key)
+	}
+}
+
+// Handler serves LL-HLS of live streams at /v1/broadcast/hls/{id}/{track_source}/index.m3u8.
+func (g *Gateway) Handler() http.Handler {
+	r := mux.NewRouter()
+	const prefix = "/v1/broadcast/hls/{id}/{track_source:[0-9]+}/"
+	r.HandleFunc(prefix+"index.m3u8", g.handlePlaylist()).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"init.mp4", g.handleInit()).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"seg{msn:[0-9]+}.mp4", g.handleSegment()).Methods(http.MethodGet)
+	r.HandleFunc(prefix+"part{msn:[0-9]+}.{part:[0-9]+}.mp4", g.handlePart()).Methods(http.MethodGet)
+	return r
+}
+
+func (g *Gateway) handlePlaylist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := g.stream(w, r)
+		if !ok {
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), g.blockTimeout())
+		defer cancel()
+		if !s.wait(ctx, func() bool { return len(s.segments) > 0 }) {
+			http.Error(w, "stream not started", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Blocking playlist reload of LL-HLS, the request waits for the segment or part.
+		query := r.URL.Query()
+		if v := query.Get("_HLS_msn"); v != "" {
+			msn, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "invalid _HLS_msn", http.StatusBadRequest)
+				return
+			}
+			part := -1
+			if v := query.Get("_HLS_part"); v != "" {
+				if part, err = strconv.Atoi(v); err != nil {
+					http.Error(w, "invalid _HLS_part", http.StatusBadRequest)
+					return
+				}
+			}
+			s.mu.Lock()
+			tooFar := msn > s.current().msn+2
+			s.mu.Unlock()
+			if tooFar {
+				http.Error(w, "_HLS_msn too far in the future", http.StatusBadRequest)
+				return
+			}
+			s.wait(ctx, func() bool { return s.has(msn, part) })
+		}
+
+		s.mu.Lock()
+		playlist := s.playlist(tokenQuery(r))
+		s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte(playlist))
+	}
+}
+
+func (g *Gateway) handleInit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := g.stream(w, r)
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		data := s.init
+		s.mu.Unlock()
+		if data == nil {
+			http.Error(w, "stream not started", http.StatusNotFound)
+			return
+		}
+		writeMP4(w, data)
+	}
+}
+
+func (g *Gateway) handleSegment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := g.stream(w, r)
+		if !ok {
+			return
+		}
+		msn, _ := strconv.Atoi(mux.Vars(r)["msn"])
+		s.mu.Lock()
+		seg := s.segment(msn)
+		var data []byte
+		if seg != nil && seg.done {
+			data = seg.data()
+		}
+		s.mu.Unlock()
+		if data == nil {
+			http.Error(w, "segment not found", http.StatusNotFound)
+			return
+		}
+		writeMP4(w, data)
+	}
+}
+
+func (g *Gateway) handlePart() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := g.stream(w, r)
+		if !ok {
+			return
+		}
+		vars := mux.Vars(r)
+		msn, _ := strconv.Atoi(vars["msn"])
+		part, _ := strconv.Atoi(vars["part"])
+
+		// A preload hinted part is blocked until it's available.
+		ctx, cancel := context.WithTimeout(r.Context(), g.blockTimeout())
+		defer cancel()
+		s.wait(ctx, func() bool { return s.has(msn, part) })
+
+		s.mu.Lock()
+		var data []byte
+		if seg := s.segment(msn); seg != nil && part < len(seg.parts) {
+			data = seg.parts[part].data
+		}
+		s.mu.Unlock()
+		if data == nil {
+			http.Error(w, "part not found", http.StatusNotFound)
+			return
+		}
+		writeMP4(w, data)
+	}
+}
+
+// stream returns the stream in URL path if the viewer may watch it, or replies an error.
+func (g *Gateway) stream(w http.ResponseWriter, r *http.Request) (*stream, bool) {
+	vars := mux.Vars(r)
+	trackSource, err := session.ParseTrackSource(vars["track_source"])
+	if err != nil {
+		http.Error(w, "invalid track source", http.StatusBadRequest)
+		return nil, false
+	}
+	meta := &pb.Meta{
+		Id:          vars["id"],
+		TrackSource: trackSource,
+	}
+
+	claims, err := g.auth.Authenticate(r)
+	if err == nil {
+		err = g.shares.Check(claims, r.RemoteAddr, time.Now())
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	if !claims.Allow(meta) {
+		http.Error(w, "not allowed to watch the stream", http.StatusForbidden)
+		return nil, false
+	}
+
+	g.mu.RLock()
+	s, ok := g.streams[g.sessions.Key(meta)]
+	g.mu.RUnlock()
+	if !ok {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return nil, false
+	}
+	return s, true
+}
+
+// blockTimeout is max time of blocking requests, three target durations as LL-HLS suggests.
+func (g *Gateway) blockTimeout() time.Duration {
+	return 3 * g.config.SegmentDuration
+}
+
+// tokenQuery returns query carrying token of r, so that players fetching relative URIs are authenticated too.
+func tokenQuery(r *http.Request) string {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		return ""
+	}
+	return url.Values{"token": {token}}.Encode()
+}
+
+func writeMP4(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,351 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/fmp4"
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// part is a partial segment of LL-HLS.
+type part struct {
+	data        []byte
+	duration    time.Duration
+	independent bool // Starts with a keyframe.
+}
+
+// segment is a media segment, it's the concatenation of its parts.
+type segment struct {
+	msn      int // Media sequence number.
+	parts    []*part
+	duration time.Duration
+	done     bool
+}
+
+func (s *segment) data() []byte {
+	var b bytes.Buffer
+	for _, p := range s.parts {
+		b.Write(p.data)
+	}
+	return b.Bytes()
+}
+
+// stream remuxes a session into LL-HLS segments of fragmented MP4.
+// Segments start at keyframes after segment duration, and parts are cut at frames after part duration.
+type stream struct {
+	logger          zerolog.Logger
+	sess            *session.Session
+	tap             *session.Tap
+	segmentDuration time.Duration
+	partDuration    time.Duration
+	window          int
+
+	// Fields below are only accessed by run.
+	started  time.Time
+	video    rtpx.H264Depacketizer
+	clocks   [2]rtpx.Timeline // Of video and audio.
+	audio    bool             // Whether any audio is received.
+	hasAudio bool             // Whether the init segment has an audio track.
+	pending  [2]*fmp4.Sample  // The latest sample of video and audio, pending until its duration is known.
+	samples  [2][]fmp4.Sample // Samples of the current part.
+	partFrom time.Duration    // Start time of the current part.
+	sequence uint32           // Sequence number of the latest fragment.
+
+	mu       sync.Mutex
+	init     []byte     // Initialization segment, nil until the first keyframe.
+	segments []*segment // In window, the last one is being written if not done.
+	changed  chan struct{}
+	closed   bool
+}
+
+func newStream(
+	sess *session.Session,
+	logger *zerolog.Logger,
+	segmentDuration, partDuration time.Duration,
+	window int,
+) *stream {
+	return &stream{
+		logger:          logger.With().Str("id", sess.ID).Logger(),
+		sess:            sess,
+		tap:             sess.Taps.Add(),
+		segmentDuration: segmentDuration,
+		partDuration:    partDuration,
+		window:          window,
+		started:         time.Now(),
+		changed:         make(chan struct{}),
+	}
+}
+
+// close stops remuxing, and wakes up blocked requests.
+func (s *stream) close() {
+	s.sess.Taps.Remove(s.tap)
+}
+
+func (s *stream) run() {
+	defer func() {
+		s.mu.Lock()
+		s.closed = true
+		s.notify()
+		s.mu.Unlock()
+	}()
+
+	var sps, pps []byte
+	for packet := range s.tap.Packets() {
+		p, ok := rtpx.Parse(packet.Data)
+		if !ok {
+			continue
+		}
+		if packet.Kind == webrtc.RTPCodecTypeAudio {
+			if len(p.Payload) == 0 {
+				continue
+			}
+			s.audio = true
+			t := s.clocks[1].At(p.Timestamp, rtpx.AudioClockRate, s.started)
+			if s.init != nil {
+				s.push(1, fmp4.Sample{
+					Data:  append([]byte(nil), p.Payload...),
+					Time:  int64(t) * rtpx.AudioClockRate / int64(time.Second),
+					Flags: fmp4.FlagsSync,
+				}, false)
+			}
+			continue
+		}
+
+		au := s.video.Push(p)
+		if au == nil {
+			continue
+		}
+		for _, nalu := range au.NALUs {
+			switch nalu[0] & 0x1F {
+			case rtpx.NALUTypeSPS:
+				sps = nalu
+			case rtpx.NALUTypePPS:
+				pps = nalu
+			}
+		}
+		keyframe := au.Keyframe()
+		t := s.clocks[0].At(au.Timestamp, rtpx.VideoClockRate, s.started)
+		if s.init == nil {
+			if !keyframe || sps == nil || pps == nil {
+				continue
+			}
+			s.hasAudio = s.audio
+			data, err := fmp4.InitSegment(sps, pps, s.hasAudio)
+			if err != nil {
+				s.logger.Err(err).Msg("could not create HLS init segment")
+				continue
+			}
+			s.mu.Lock()
+			s.init = data
+			s.mu.Unlock()
+			s.partFrom = t
+			s.logger.Info().Bool("audio", s.audio).Msg("started HLS stream")
+		}
+		flags := uint32(fmp4.FlagsNonSync)
+		if keyframe {
+			flags = fmp4.FlagsSync
+		}
+		s.push(0, fmp4.Sample{
+			Data:  au.AVCC(),
+			Time:  int64(t) * rtpx.VideoClockRate / int64(time.Second),
+			Flags: flags,
+		}, keyframe)
+	}
+}
+
+// push pushes a sample of track, and flushes the pending one before it. A video keyframe may start a new
+// segment, and other video frames may start a new part.
+func (s *stream) push(track int, smp fmp4.Sample, keyframe bool) {
+	if track == 1 && !s.hasAudio {
+		return // Audio started after the init segment, which has no audio track.
+	}
+	if pending := s.pending[track]; pending != nil {
+		if smp.Time <= pending.Time {
+			return // Out of order or duplicated.
+		}
+		pending.Duration = uint32(smp.Time - pending.Time)
+		s.samples[track] = append(s.samples[track], *pending)
+	}
+	s.pending[track] = &smp
+
+	if track != 0 {
+		return
+	}
+	now := time.Duration(smp.Time) * time.Second / rtpx.VideoClockRate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := s.current()
+	switch {
+	case keyframe && (current == nil || current.duration+now-s.partFrom >= s.segmentDuration):
+		s.flushPart(now)
+		if current != nil {
+			current.done = true
+		}
+		msn := 0
+		if current != nil {
+			msn = current.msn + 1
+		}
+		s.segments = append(s.segments, &segment{msn: msn})
+		if len(s.segments) > s.window+1 {
+			s.segments = s.segments[len(s.segments)-s.window-1:]
+		}
+		s.notify()
+	case now-s.partFrom >= s.partDuration:
+		s.flushPart(now)
+		s.notify()
+	}
+}
+
+// flushPart ends the current part at now, it must be called with mu held.
+func (s *stream) flushPart(now time.Duration) {
+	current := s.current()
+	if current == nil || len(s.samples[0]) == 0 {
+		s.samples = [2][]fmp4.Sample{}
+		s.partFrom = now
+		return
+	}
+	s.sequence++
+	p := &part{
+		data:        fmp4.Fragment(s.sequence, s.samples[0], s.samples[1]),
+		duration:    now - s.partFrom,
+		independent: s.samples[0][0].Flags == fmp4.FlagsSync,
+	}
+	current.parts = append(current.parts, p)
+	current.duration += p.duration
+	s.samples = [2][]fmp4.Sample{}
+	s.partFrom = now
+}
+
+// current returns the segment being written, it must be called with mu held.
+func (s *stream) current() *segment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+// notify wakes up blocked requests, it must be called with mu held.
+func (s *stream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// wait waits until ready reports true with mu held, the stream is closed or ctx is done.
+func (s *stream) wait(ctx context.Context, ready func() bool) bool {
+	for {
+		s.mu.Lock()
+		ok, closed, changed := ready(), s.closed, s.changed
+		s.mu.Unlock()
+		if ok {
+			return true
+		}
+		if closed {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// has reports whether part of segment msn is available, part -1 means the whole segment.
+// A part is never available once its segment is done without it. It must be called with mu held.
+func (s *stream) has(msn, part int) bool {
+	seg := s.segment(msn)
+	if seg == nil {
+		return false
+	}
+	if part < 0 {
+		return seg.done
+	}
+	return part < len(seg.parts) || seg.done
+}
+
+// segment returns segment msn in window, it must be called with mu held.
+func (s *stream) segment(msn int) *segment {
+	for _, seg := range s.segments {
+		if seg.msn == msn {
+			return seg
+		}
+	}
+	return nil
+}
+
+// playlist returns the LL-HLS media playlist, URIs are appended query, e.g. token of the request.
+// It must be called with mu held.
+func (s *stream) playlist(query string) string {
+	var done []*segment
+	for _, seg := range s.segments {
+		if seg.done {
+			done = append(done, seg)
+		}
+	}
+	if len(done) > s.window {
+		done = done[len(done)-s.window:]
+	}
+	if query != "" {
+		query = "?" + query
+	}
+
+	targetDuration := s.segmentDuration
+	for _, seg := range done {
+		if seg.duration > targetDuration {
+			targetDuration = seg.duration
+		}
+	}
+	partTarget := s.partDuration
+	for _, seg := range s.segments {
+		for _, p := range seg.parts {
+			if p.duration > partTarget {
+				partTarget = p.duration
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:9\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration.Seconds())))
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", 3*partTarget.Seconds())
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", partTarget.Seconds())
+	first := s.current().msn
+	if len(done) > 0 {
+		first = done[0].msn
+	}
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", first)
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"init.mp4%s\"\n", query)
+
+	// Parts are listed for the last segments only, as players only join near the live edge.
+	writeParts := func(seg *segment) {
+		for i, p := range seg.parts {
+			fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"part%d.%d.mp4%s\"", p.duration.Seconds(), seg.msn, i, query)
+			if p.independent {
+				b.WriteString(",INDEPENDENT=YES")
+			}
+			b.WriteString("\n")
+		}
+	}
+	for i, seg := range done {
+		if i >= len(done)-2 {
+			writeParts(seg)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\nseg%d.mp4%s\n", seg.duration.Seconds(), seg.msn, query)
+	}
+	current := s.current()
+	if !current.done {
+		writeParts(current)
+		fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"part%d.%d.mp4%s\"\n", current.msn, len(current.parts), query)
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+)
+
+// HookPoint is a point of the service lifecycle where hooks run.
+type HookPoint int
+
+const (
+	// BeforeListen hooks run in Start after all components are set up, before the HTTP server listens.
+	// An error aborts Start.
+	BeforeListen HookPoint = iota
+	// AfterMQTTConnect hooks run in Start with the MQTT client given to New, and after every switch
+	// to a new client by SetClient. An error aborts Start, and is logged on switches.
+	AfterMQTTConnect
+	// BeforeDrain hooks run in Shutdown before signaling is drained, while sessions are still live.
+	// Errors are logged, and draining goes on.
+	BeforeDrain
+)
+
+func (p HookPoint) String() string {
+	switch p {
+	case BeforeListen:
+		return "before-listen"
+	case AfterMQTTConnect:
+		return "after-mqtt-connect"
+	case BeforeDrain:
+		return "before-drain"
+	default:
+		return fmt.Sprintf("HookPoint(%d)", int(p))
+	}
+}
+
+// Hook is a function run at a HookPoint.
+type Hook func(ctx context.Context) error
+
+// Hook registers hooks of point for embedders, e.g. to register the service in discovery before listening,
+// or to deregister it before draining. Hooks of a point run in order of registration, and they must be
+// registered before Start is called.
+func (s *Service) Hook(point HookPoint, hooks ...Hook) {
+	if s.hooks == nil {
+		s.hooks = make(map[HookPoint][]Hook)
+	}
+	s.hooks[point] = append(s.hooks[point], hooks...)
+}
+
+// runHooks runs hooks of point in order, stopping at the first error.
+func (s *Service) runHooks(ctx context.Context, point HookPoint) error {
+	for _, hook := range s.hooks[point] {
+		if err := hook(ctx); err != nil {
+			return fmt.Errorf("%s hook failed: %w", point, err)
+		}
+	}
+	return nil
+}
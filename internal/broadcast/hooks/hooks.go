@@ -0,0 +1,162 @@
+// Package hooks plugs business logic of extensions into signaling, e.g. custom checks of downstream forks,
+// without patching publisher and subscriber. An extension implements Hooks, embedding Nop for methods it
+// doesn't need, and is passed to broadcast.New, or registered by Register in an init function of a file
+// compiled into the binary, which the broadcast command passes along.
+package hooks
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+)
+
+// Roles of remote peers of candidates.
+const (
+	RolePublisher  = "publisher"
+	RoleSubscriber = "subscriber"
+)
+
+// Hooks are called by signaling, concurrently and on its path, so they must be safe for concurrent use and
+// return quickly.
+type Hooks interface {
+	// OnPublishRequest is called once an offer of edge is authenticated, before it's answered.
+	// An error rejects the offer.
+	OnPublishRequest(ctx context.Context, req *PublishRequest) error
+	// OnSubscribeRequest is called once an offer of a viewer passes auth, ACL and limits, before it's answered.
+	// An error rejects the offer, its message is replied to the viewer as the reason.
+	OnSubscribeRequest(ctx context.Context, req *SubscribeRequest) error
+	// OnSessionClosed is called once a session is closed, or replaced by a new publisher of its stream.
+	OnSessionClosed(ctx context.Context, info *SessionInfo)
+	// OnCandidate is called with each candidate of a remote peer before it's added to the peer connection.
+	// An error drops the candidate, e.g. to keep peers off private networks.
+	OnCandidate(ctx context.Context, c *Candidate) error
+}
+
+// PublishRequest is an offer of edge publishing a stream.
+type PublishRequest struct {
+	Meta *pb.Meta
+	// Transport is the signaling transport of edge, "mqtt", "grpc" or "whip".
+	Transport string
+	// RemoteAddr is the address of edge, empty if it signals over MQTT.
+	RemoteAddr string
+}
+
+// SubscribeRequest is an offer of a viewer watching a stream.
+type SubscribeRequest struct {
+	Meta *pb.Meta
+	// Protocol is the signaling protocol of the viewer, "websocket", "whep" or "mqtt".
+	Protocol string
+	Tenant   string
+	// Subject is the subject of the token of the viewer, or the client ID of an MQTT viewer.
+	// It's empty if the viewer isn't authenticated.
+	Subject string
+	// RemoteAddr is the address of the viewer, empty if it signals over MQTT.
+	RemoteAddr string
+}
+
+// SessionInfo is a closed session.
+type SessionInfo struct {
+	Meta      *pb.Meta
+	CreatedAt time.Time
+	ClosedAt  time.Time
+	// Origin is the instance the session is relayed from, empty if it's published to this one.
+	Origin string
+	// Replaced reports whether the session is replaced by a new publisher of its stream rather than closed.
+	Replaced bool
+}
+
+// Candidate is a candidate of a remote peer.
+type Candidate struct {
+	Meta *pb.Meta
+	// Role is the role of the remote peer, RolePublisher or RoleSubscriber.
+	Role string
+	// Candidate is the candidate-attribute, e.g. "candidate:1 1 udp 2130706431 192.0.2.1 50000 typ host".
+	Candidate string
+}
+
+// Nop implements Hooks by allowing everything, it's the default. Extensions embed it to implement only
+// the hooks they need.
+type Nop struct{}
+
+func (Nop) OnPublishRequest(context.Context, *PublishRequest) error     { return nil }
+func (Nop) OnSubscribeRequest(context.Context, *SubscribeRequest) error { return nil }
+func (Nop) OnSessionClosed(context.Context, *SessionInfo)               {}
+func (Nop) OnCandidate(context.Context, *Candidate) error               { return nil }
+
+// Chain returns Hooks calling hooks in order, requests and candidates are rejected by the first error.
+// It returns Nop if there are no hooks.
+func Chain(hooks ...Hooks) Hooks {
+	switch len(hooks) {
+	case 0:
+		return Nop{}
+	case 1:
+		return hooks[0]
+	default:
+		return chain(hooks)
+	}
+}
+
+type chain []Hooks
+
+func (c chain) OnPublishRequest(ctx context.Context, req *PublishRequest) error {
+	for _, h := range c {
+		if err := h.OnPublishRequest(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c chain) OnSubscribeRequest(ctx context.Context, req *SubscribeRequest) error {
+	for _, h := range c {
+		if err := h.OnSubscribeRequest(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c chain) OnSessionClosed(ctx context.Context, info *SessionInfo) {
+	for _, h := range c {
+		h.OnSessionClosed(ctx, info)
+	}
+}
+
+func (c chain) OnCandidate(ctx context.Context, candidate *Candidate) error {
+	for _, h := range c {
+		if err := h.OnCandidate(ctx, candidate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	registeredMu sync.Mutex
+	registered   []Hooks
+)
+
+// Register registers hooks of an extension compiled into the binary, usually in its init function.
+// The broadcast command passes registered hooks to broadcast.New in order of registration.
+func Register(h Hooks) {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	registered = append(registered, h)
+}
+
+// Registered returns hooks registered by Register.
+func Registered() []Hooks {
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	return append([]Hooks(nil), registered...)
+}
+
+// CandidateFilter returns a function calling OnCandidate of h with candidates of the remote peer of role
+// streaming meta, see webrtc.WebRTC.FilterCandidates.
+func CandidateFilter(h Hooks, role string, meta *pb.Meta) func(candidate string) error {
+	return func(candidate string) error {
+		return h.OnCandidate(context.Background(), &Candidate{Meta: meta, Role: role, Candidate: candidate})
+	}
+}
@@ -0,0 +1,65 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+)
+
+// Logger is an example extension logging every hook and allowing everything, e.g. to see what hooks of
+// an extension would be called with before writing it. Register it by
+//
+//	func init() {
+//		hooks.Register(hooks.NewLogger(&log.Logger))
+//	}
+type Logger struct {
+	logger zerolog.Logger
+}
+
+// NewLogger returns a new Logger.
+func NewLogger(logger *zerolog.Logger) *Logger {
+	return &Logger{logger: loglevel.Default.Component(logger, "Hooks")}
+}
+
+func (l *Logger) OnPublishRequest(_ context.Context, req *PublishRequest) error {
+	l.logger.Info().
+		Str("id", req.Meta.Id).
+		Int32("track_source", int32(req.Meta.TrackSource)).
+		Str("transport", req.Transport).
+		Str("remote_addr", req.RemoteAddr).
+		Msg("publish request")
+	return nil
+}
+
+func (l *Logger) OnSubscribeRequest(_ context.Context, req *SubscribeRequest) error {
+	l.logger.Info().
+		Str("id", req.Meta.Id).
+		Int32("track_source", int32(req.Meta.TrackSource)).
+		Str("protocol", req.Protocol).
+		Str("tenant", req.Tenant).
+		Str("subject", req.Subject).
+		Str("remote_addr", req.RemoteAddr).
+		Msg("subscribe request")
+	return nil
+}
+
+func (l *Logger) OnSessionClosed(_ context.Context, info *SessionInfo) {
+	l.logger.Info().
+		Str("id", info.Meta.Id).
+		Int32("track_source", int32(info.Meta.TrackSource)).
+		Dur("duration", info.ClosedAt.Sub(info.CreatedAt)).
+		Bool("replaced", info.Replaced).
+		Msg("session closed")
+}
+
+func (l *Logger) OnCandidate(_ context.Context, c *Candidate) error {
+	l.logger.Debug().
+		Str("id", c.Meta.Id).
+		Int32("track_source", int32(c.Meta.TrackSource)).
+		Str("role", c.Role).
+		Str("candidate", c.Candidate).
+		Msg("remote candidate")
+	return nil
+}
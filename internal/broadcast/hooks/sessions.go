@@ -0,0 +1,38 @@
+package hooks
+
+import (
+	"context"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// WatchSessions calls OnSessionClosed of h with sessions closed or replaced until ctx is done.
+func WatchSessions(ctx context.Context, sessions *session.SessionManager, h Hooks) {
+	events, stop := sessions.Watch()
+	defer stop()
+	for {
+		select {
+		case e := <-events:
+			switch e.Type {
+			case session.EventClosed:
+				h.OnSessionClosed(ctx, sessionInfo(e.Session, false))
+			case session.EventReplaced:
+				h.OnSessionClosed(ctx, sessionInfo(e.Replaced, true))
+			default:
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func sessionInfo(sess *session.Session, replaced bool) *SessionInfo {
+	return &SessionInfo{
+		Meta:      sess.Meta,
+		CreatedAt: sess.CreatedAt,
+		ClosedAt:  time.Now(),
+		Origin:    sess.Origin,
+		Replaced:  replaced,
+	}
+}
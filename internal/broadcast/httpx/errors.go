@@ -1,5 +1,11 @@
 package httpx
 
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
 // Code is an error code.
 type Code int
 
@@ -12,13 +18,115 @@ const (
 
 	// Code for Common errors.
 	ErrUnmarshalJSON
+
+	// Code specifically for broadcast service, appended to keep existing codes unchanged.
+	ErrQuotaExceeded
+	ErrForbidden
+	ErrLayerNotFound
+	ErrFailedToSelectLayer
+	ErrACLDenied
+	ErrUnsupportedProtocolVersion
+	ErrUnexpectedHello
+	ErrICEConnectTimeout
+	ErrTenantViewerLimit
+	ErrFailedToRestartICE
+	ErrHookRejected
+	ErrShareLinkInvalid
+	ErrShareViewerLimit
 )
 
 // Errors maps error code to error message.
 var Errors = map[Code]string{
-	ErrReadMessage:              "Could not read message",
-	ErrIncorrectMetadata:        "Incorrect edge device metadata",
-	ErrMetadataNotMatched:       "Metadata not matched with any existing session",
-	ErrFailedToCreateSubscriber: "Failed to create subscriber for user",
-	ErrUnmarshalJSON:            "Could not unmarshal JSON data",
+	ErrReadMessage:                "Could not read message",
+	ErrIncorrectMetadata:          "Incorrect edge device metadata",
+	ErrMetadataNotMatched:         "Metadata not matched with any existing session",
+	ErrFailedToCreateSubscriber:   "Failed to create subscriber for user",
+	ErrUnmarshalJSON:              "Could not unmarshal JSON data",
+	ErrQuotaExceeded:              "Viewer egress quota of tenant exceeded",
+	ErrForbidden:                  "Not allowed to watch the stream",
+	ErrLayerNotFound:              "Simulcast layer not offered by edge",
+	ErrFailedToSelectLayer:        "Failed to switch to simulcast layer",
+	ErrACLDenied:                  "Denied by stream access control list",
+	ErrUnsupportedProtocolVersion: "Signaling protocol version not supported",
+	ErrUnexpectedHello:            "Hello must be sent before any offer",
+	ErrICEConnectTimeout:          "ICE connection not established in time, check network and TURN servers",
+	ErrTenantViewerLimit:          "Concurrent viewers limit of tenant reached",
+	ErrFailedToRestartICE:         "Failed to restart ICE, subscribe to the stream again",
+	ErrHookRejected:               "Rejected by signaling hooks",
+	ErrShareLinkInvalid:           "Sharing link revoked, expired or not valid from this network",
+	ErrShareViewerLimit:           "Concurrent viewers limit of sharing link reached",
+}
+
+// Category tells whose fault an error is, so clients know whether fixing the request may help.
+type Category string
+
+const (
+	CategoryClient Category = "client"
+	CategoryServer Category = "server"
+)
+
+// Kind is the machine-readable nature of an error code.
+type Kind struct {
+	Category Category
+	// Retryable is whether the same request may succeed later, e.g. once the stream goes live, with backoff.
+	Retryable bool
+}
+
+// Kinds maps error code to its kind, codes not in it are of server errors and not retryable.
+var Kinds = map[Code]Kind{
+	ErrReadMessage:                {Category: CategoryClient},
+	ErrIncorrectMetadata:          {Category: CategoryClient},
+	ErrMetadataNotMatched:         {Category: CategoryClient, Retryable: true},
+	ErrFailedToCreateSubscriber:   {Category: CategoryServer, Retryable: true},
+	ErrUnmarshalJSON:              {Category: CategoryClient},
+	ErrQuotaExceeded:              {Category: CategoryClient, Retryable: true},
+	ErrForbidden:                  {Category: CategoryClient},
+	ErrLayerNotFound:              {Category: CategoryClient},
+	ErrFailedToSelectLayer:        {Category: CategoryServer, Retryable: true},
+	ErrACLDenied:                  {Category: CategoryClient},
+	ErrUnsupportedProtocolVersion: {Category: CategoryClient},
+	ErrUnexpectedHello:            {Category: CategoryClient},
+	ErrICEConnectTimeout:          {Category: CategoryServer, Retryable: true},
+	ErrTenantViewerLimit:          {Category: CategoryClient, Retryable: true},
+	ErrFailedToRestartICE:         {Category: CategoryServer},
+	ErrHookRejected:               {Category: CategoryClient},
+	ErrShareLinkInvalid:           {Category: CategoryClient},
+	ErrShareViewerLimit:           {Category: CategoryClient, Retryable: true},
+}
+
+// Error is an error replied to clients, in data of WebSocket "error" event and body of HTTP responses.
+type Error struct {
+	Code      Code     `json:"code"`
+	Message   string   `json:"message"`
+	Category  Category `json:"category"`
+	Retryable bool     `json:"retryable"`
+	// Details tell more of the error, e.g. the tenant of which quota is exceeded.
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// NewError returns the error of code with details, which may be nil.
+func NewError(code Code, details map[string]interface{}) *Error {
+	kind, ok := Kinds[code]
+	if !ok {
+		kind.Category = CategoryServer
+	}
+	return &Error{
+		Code:      code,
+		Message:   Errors[code],
+		Category:  kind.Category,
+		Retryable: kind.Retryable,
+		Details:   details,
+	}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// WriteError replies e as JSON body of status.
+func WriteError(w http.ResponseWriter, e *Error, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(e)
 }
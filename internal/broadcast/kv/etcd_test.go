@@ -0,0 +1,80 @@
+package kv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct {
+		prefix, want []byte
+	}{
+		{[]byte("a"), []byte("b")},
+		{[]byte("sessions/"), []byte("sessions0")},
+		{[]byte{'a', 0xff}, []byte("b")},
+		{[]byte{0xff, 0xff}, []byte{0}},
+		{nil, []byte{0}},
+	}
+	for _, tt := range tests {
+		if got := prefixEnd(tt.prefix); !bytes.Equal(got, tt.want) {
+			t.Errorf("prefixEnd(%q) = %q, want %q", tt.prefix, got, tt.want)
+		}
+	}
+}
+
+// TestEtcdList tests values are decoded from ranges, and an expired token is renewed once.
+func TestEtcdList(t *testing.T) {
+	var authentications int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/auth/authenticate":
+			authentications++
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "token" + strconv.Itoa(authentications)})
+		case "/v3/kv/range":
+			// The first token is expired.
+			if r.Header.Get("Authorization") != "token2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			var request map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Error(err)
+			}
+			if want := map[string]string{"key": encode([]byte("s/")), "range_end": encode([]byte("s0"))}; !reflect.DeepEqual(request, want) {
+				t.Errorf("range request = %v, want %v", request, want)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"kvs": []map[string]string{{"value": encode([]byte("a"))}, {"value": encode([]byte("b"))}},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	u, err := url.Parse("etcd://user:password@" + server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewEtcd(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := c.List(context.Background(), "s/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]byte{[]byte("a"), []byte("b")}; !reflect.DeepEqual(values, want) {
+		t.Fatalf("List() = %q, want %q", values, want)
+	}
+	if authentications != 2 {
+		t.Fatalf("authenticated %d times, want 2", authentications)
+	}
+}
@@ -0,0 +1,57 @@
+package kv
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRedisReply(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   string
+		want    interface{}
+		wantErr error // Checked by errors.Is.
+		anyErr  bool  // Any error is expected.
+	}{
+		{name: "simple string", reply: "+OK\r\n", want: "OK"},
+		{name: "integer", reply: ":42\r\n", want: "42"},
+		{name: "error", reply: "-ERR wrong type\r\n", wantErr: RedisError("ERR wrong type")},
+		{name: "bulk string", reply: "$5\r\nhello\r\n", want: "hello"},
+		{name: "bulk string of CRLF", reply: "$2\r\n\r\n\r\n", want: "\r\n"},
+		{name: "empty bulk string", reply: "$0\r\n\r\n", want: ""},
+		{name: "nil bulk string", reply: "$-1\r\n", want: nil},
+		{name: "array", reply: "*2\r\n$3\r\nfoo\r\n:1\r\n", want: []interface{}{"foo", "1"}},
+		{name: "nested array", reply: "*2\r\n*1\r\n+a\r\n$-1\r\n", want: []interface{}{[]interface{}{"a"}, nil}},
+		{name: "empty array", reply: "*0\r\n", want: []interface{}{}},
+		{name: "nil array", reply: "*-1\r\n", want: nil},
+		{name: "invalid bulk length", reply: "$x\r\n", anyErr: true},
+		{name: "invalid array length", reply: "*x\r\n", anyErr: true},
+		{name: "empty reply", reply: "\r\n", anyErr: true},
+		{name: "unexpected type", reply: "?\r\n", anyErr: true},
+		{name: "truncated bulk string", reply: "$5\r\nhel", wantErr: io.ErrUnexpectedEOF},
+		{name: "truncated array", reply: "*2\r\n+a\r\n", wantErr: io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRedisReply(bufio.NewReader(strings.NewReader(tt.reply)))
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("readRedisReply() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.anyErr:
+				if err == nil {
+					t.Fatalf("readRedisReply() = %#v, want error", got)
+				}
+			case err != nil:
+				t.Fatalf("readRedisReply() error = %v", err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Fatalf("readRedisReply() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
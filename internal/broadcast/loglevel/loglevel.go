@@ -0,0 +1,137 @@
+// Package loglevel controls log levels of component loggers at runtime, so debug logs of a component can be turned on
+// during incidents without restart and without flooding logs of other components.
+package loglevel
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Default is the default Levels of component loggers.
+var Default = New()
+
+// Levels are log levels of components. A component logs at its own level if set, or the default level otherwise.
+//
+// As zerolog drops events below the global level before hooks see them, the global level is lowered to the most
+// verbose level of all, and events of components above their levels are discarded by hooks. Loggers of no component
+// log at the global level then.
+type Levels struct {
+	mu         sync.RWMutex
+	defaultLvl zerolog.Level
+	levels     map[string]zerolog.Level // Levels set of components, by component.
+	components map[string]bool          // Components of created loggers.
+
+	sampleBurst  uint32
+	samplePeriod time.Duration
+	sampleAfter  uint32
+}
+
+// New returns new Levels of the current global level as default.
+func New() *Levels {
+	return &Levels{
+		defaultLvl: zerolog.GlobalLevel(),
+		levels:     make(map[string]zerolog.Level),
+		components: make(map[string]bool),
+	}
+}
+
+// SetSampling samples debug and info events of component loggers created afterwards, each logger logs the first burst
+// events in every period, and every thereafter-th event after them, thereafter 0 drops them.
+// Warnings and errors are never sampled. A zero burst disables sampling.
+func (l *Levels) SetSampling(burst uint32, period time.Duration, thereafter uint32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sampleBurst, l.samplePeriod, l.sampleAfter = burst, period, thereafter
+}
+
+// Component returns a logger of component derived from logger, it's logged with "component" field.
+func (l *Levels) Component(logger *zerolog.Logger, component string) zerolog.Logger {
+	l.mu.Lock()
+	l.components[component] = true
+	burst, period, after := l.sampleBurst, l.samplePeriod, l.sampleAfter
+	l.mu.Unlock()
+
+	c := logger.With().Str("component", component).Logger().Hook(zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, _ string) {
+		if level < l.level(component) {
+			e.Discard()
+		}
+	}))
+	if burst > 0 {
+		sampler := &zerolog.BurstSampler{Burst: burst, Period: period}
+		if after > 0 {
+			sampler.NextSampler = &zerolog.BasicSampler{N: after}
+		} else {
+			sampler.NextSampler = dropSampler{}
+		}
+		c = c.Sample(zerolog.LevelSampler{DebugSampler: sampler, InfoSampler: sampler})
+	}
+	return c
+}
+
+// dropSampler drops all events.
+type dropSampler struct{}
+
+func (dropSampler) Sample(zerolog.Level) bool { return false }
+
+// level returns the level of component.
+func (l *Levels) level(component string) zerolog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if level, ok := l.levels[component]; ok {
+		return level
+	}
+	return l.defaultLvl
+}
+
+// SetDefault sets the level of components without their own.
+func (l *Levels) SetDefault(level zerolog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.defaultLvl = level
+	l.updateGlobal()
+}
+
+// Set sets the level of component, zerolog.NoLevel resets it to the default. It returns false if no logger
+// of component is created.
+func (l *Levels) Set(component string, level zerolog.Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.components[component] {
+		return false
+	}
+	if level == zerolog.NoLevel {
+		delete(l.levels, component)
+	} else {
+		l.levels[component] = level
+	}
+	l.updateGlobal()
+	return true
+}
+
+// List returns levels of all components by component.
+func (l *Levels) List() map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	levels := make(map[string]string, len(l.components))
+	for component := range l.components {
+		level, ok := l.levels[component]
+		if !ok {
+			level = l.defaultLvl
+		}
+		levels[component] = level.String()
+	}
+	return levels
+}
+
+// updateGlobal sets the global level to the most verbose level of all, it must be called with mu held.
+func (l *Levels) updateGlobal() {
+	global := l.defaultLvl
+	for _, level := range l.levels {
+		if level < global {
+			global = level
+		}
+	}
+	zerolog.SetGlobalLevel(global)
+}
@@ -0,0 +1,172 @@
+package metrics
+
+// Default is the registry of broadcast service metrics.
+var Default = NewRegistry()
+
+// Metrics of broadcast service. Gauges of publishers and subscribers are collected from sessions,
+// see session.SessionManager.RegisterMetrics.
+var (
+	RTPPacketsForwarded = Default.NewCounterVec(
+		"skywalker_broadcast_rtp_packets_forwarded_total",
+		"RTP packets forwarded from edge to subscribers.",
+		"kind",
+	)
+	RTPBytesForwarded = Default.NewCounterVec(
+		"skywalker_broadcast_rtp_bytes_forwarded_total",
+		"RTP bytes forwarded from edge to subscribers.",
+		"kind",
+	)
+	SignalingFailures = Default.NewCounterVec(
+		"skywalker_broadcast_signaling_failures_total",
+		"WebRTC signaling failures.",
+		"role", "reason",
+	)
+	WebSocketConnects = Default.NewCounter(
+		"skywalker_broadcast_websocket_connects_total",
+		"WebSocket connections accepted.",
+	)
+	WebSocketDisconnects = Default.NewCounter(
+		"skywalker_broadcast_websocket_disconnects_total",
+		"WebSocket connections closed.",
+	)
+	WebSocketConnections = Default.NewGauge(
+		"skywalker_broadcast_websocket_connections",
+		"WebSocket connections currently open.",
+	)
+	JoinLatency = Default.NewHistogram(
+		"skywalker_broadcast_join_latency_seconds",
+		"Latency of subscribers joining from offer received to first media confirmed by subscriber.",
+		[]float64{0.25, 0.5, 1, 1.5, 2, 3, 5, 10, 30},
+	)
+	JoinsPending = Default.NewGauge(
+		"skywalker_broadcast_joins_pending",
+		"Subscribers joining and waiting for first media.",
+	)
+	JoinFailures = Default.NewCounter(
+		"skywalker_broadcast_join_failures_total",
+		"Subscribers failed to receive media after joining.",
+	)
+	CanaryProbes = Default.NewCounterVec(
+		"skywalker_broadcast_canary_probes_total",
+		"Probes of synthetic subscriber joining the canary session.",
+		"result",
+	)
+	CanaryUp = Default.NewGauge(
+		"skywalker_broadcast_canary_up",
+		"Whether the last canary probe received media, 1 if so.",
+	)
+	Recordings = Default.NewGauge(
+		"skywalker_broadcast_recordings",
+		"Live sessions being recorded.",
+	)
+	RecordingSegments = Default.NewCounterVec(
+		"skywalker_broadcast_recording_segments_total",
+		"Recording segments closed, by result of storing them in sink.",
+		"result",
+	)
+	DirectoryRedirects = Default.NewCounter(
+		"skywalker_broadcast_directory_redirects_total",
+		"Subscribers redirected to instances hosting their streams in other regions.",
+	)
+	HibernatingSessions = Default.NewGauge(
+		"skywalker_broadcast_hibernating_sessions",
+		"Idle sessions whose edges are asked to pause sending media.",
+	)
+	TelemetryMessages = Default.NewCounter(
+		"skywalker_broadcast_telemetry_messages_total",
+		"Telemetry data channel messages received from edges.",
+	)
+	MQTTConnectionLosses = Default.NewCounter(
+		"skywalker_broadcast_mqtt_connection_losses_total",
+		"Connections to MQTT broker lost, each is followed by reconnecting.",
+	)
+	MQTTOfflineDropped = Default.NewCounter(
+		"skywalker_broadcast_mqtt_offline_dropped_total",
+		"Messages published while disconnected from MQTT broker and dropped from the full offline queue.",
+	)
+	SignalRejections = Default.NewCounterVec(
+		"skywalker_broadcast_signal_rejections_total",
+		"Signaling connections rejected, by reason of rate_limit or max_connections.",
+		"reason",
+	)
+	SubscriberLimits = Default.NewCounterVec(
+		"skywalker_broadcast_subscriber_limits_total",
+		"Subscribers closed by limits, by reason of ice_connect_timeout or session_expired.",
+		"reason",
+	)
+	KeyframeRequests = Default.NewCounterVec(
+		"skywalker_broadcast_keyframe_requests_total",
+		"Keyframe requests of subscribers, by result of relayed to edge as PLI or throttled.",
+		"result",
+	)
+	WebSocketStale = Default.NewCounter(
+		"skywalker_broadcast_websocket_stale_total",
+		"WebSocket connections closed for no pong from client.",
+	)
+	AuditEvents = Default.NewCounterVec(
+		"skywalker_broadcast_audit_events_total",
+		"Audit events by result of written to sinks, failed of a sink, or dropped from the full queue.",
+		"result",
+	)
+	LayerSwitches = Default.NewCounterVec(
+		"skywalker_broadcast_layer_switches_total",
+		"Simulcast layer switches of subscribers by congestion control, by direction of up or down.",
+		"direction",
+	)
+	WebhookDeliveries = Default.NewCounterVec(
+		"skywalker_broadcast_webhook_deliveries_total",
+		"Webhook deliveries by result of delivered, retried, failed after all retries, or dropped from the full queue.",
+		"result",
+	)
+	Retransmissions = Default.NewCounterVec(
+		"skywalker_broadcast_retransmissions_total",
+		"Packets NACKed by subscribers by result of sent from session caches, or missed as not cached anymore.",
+		"result",
+	)
+	JitterBufferPackets = Default.NewCounterVec(
+		"skywalker_broadcast_jitter_buffer_packets_total",
+		"Packets from edge by kind, and by result of reordered after held, late after skipped or released, or skipped as lost.",
+		"kind", "result",
+	)
+	DuplicateOffers = Default.NewCounterVec(
+		"skywalker_broadcast_duplicate_offers_total",
+		"Offers redelivered by MQTT by result of answered again, or dropped after their peer connection closed.",
+		"result",
+	)
+	ICERestarts = Default.NewCounterVec(
+		"skywalker_broadcast_ice_restarts_total",
+		"ICE restarts of subscribers by result of restarted or failed.",
+		"result",
+	)
+	EgressBytes = Default.NewCounterVec(
+		"skywalker_broadcast_egress_bytes_total",
+		"Bytes forwarded to viewers per session, estimated by bytes received from edge, see package accounting.",
+		"tenant", "id", "track_source",
+	)
+	SessionOperations = Default.NewCounterVec(
+		"skywalker_broadcast_session_operations_total",
+		"Operations of the session store by op of add, remove, get or list, and fanout_write of RTP written to tracks.",
+		"op",
+	)
+	SessionOperationLatency = Default.NewCounterVec(
+		"skywalker_broadcast_session_operation_latency_nanoseconds_total",
+		"Latency of operations of the session store accumulated by op, the average is it divided by operations.",
+		"op",
+	)
+	FanoutSkipped = Default.NewCounterVec(
+		"skywalker_broadcast_fanout_skipped_packets_total",
+		"Packets skipped by subscribers falling behind a track, by kind.",
+		"kind",
+	)
+	ViewerEgressBytes = Default.NewCounterVec(
+		"skywalker_broadcast_viewer_egress_bytes_total",
+		"Bytes forwarded to viewers per token subject, empty if viewers are not authenticated.",
+		"tenant", "subject",
+	)
+)
+
+// Roles of signaling failures.
+const (
+	RolePublisher  = "publisher"
+	RoleSubscriber = "subscriber"
+)
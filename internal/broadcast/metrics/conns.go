@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+)
+
+// RegisterConns registers gauges of live connections per kind and role collected from r.
+// Connection IDs are not labels as they are unbounded, they are looked up by admin API instead.
+// It should be called once per registry.
+func (r *Registry) RegisterConns(registry *conns.Registry) {
+	r.NewGaugeFunc(
+		"skywalker_broadcast_connections",
+		"Live signaling WebSocket connections and peer connections.",
+		[]string{"kind", "role"},
+		func() []Sample {
+			counts := make(map[[2]string]int)
+			for _, c := range registry.List() {
+				counts[[2]string{string(c.Kind), c.Role}]++
+			}
+			samples := make([]Sample, 0, len(counts))
+			for labels, n := range counts {
+				samples = append(samples, Sample{LabelValues: []string{labels[0], labels[1]}, Value: float64(n)})
+			}
+			return samples
+		},
+	)
+}
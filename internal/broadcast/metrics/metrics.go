@@ -0,0 +1,377 @@
+// Package metrics exposes broadcast service metrics in Prometheus text format.
+// Only counters, gauges and histograms are supported, which is all the service needs.
+// See: https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+
+	labelSeparator = "\xff"
+)
+
+// collector writes samples of a metric family.
+type collector interface {
+	describe() (name, help, typ string)
+	collect() []Sample
+}
+
+// Sample is a sample of a metric with label values in order of label names.
+// Labels of empty values are omitted, which Prometheus treats the same.
+type Sample struct {
+	Suffix      string // Suffix of metric name, e.g. "_bucket" of histograms.
+	LabelValues []string
+	Value       float64
+}
+
+// Registry holds metrics to be exposed.
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []collector
+}
+
+// NewRegistry returns a new Registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounter registers and returns a counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).WithLabelValues()
+}
+
+// NewCounterVec registers and returns a counter partitioned by labels.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{vec: newVec(name, help, typeCounter, labels)}
+	r.register(v)
+	return v
+}
+
+// NewGauge registers and returns a gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).WithLabelValues()
+}
+
+// NewGaugeVec registers and returns a gauge partitioned by labels.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{vec: newVec(name, help, typeGauge, labels)}
+	r.register(v)
+	return v
+}
+
+// NewGaugeFunc registers a gauge whose samples are collected by f on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, f func() []Sample) {
+	r.register(&gaugeFunc{name: name, help: help, labels: labels, f: f})
+}
+
+// Handler returns a HTTP handler exposing metrics.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.Write(w)
+	})
+}
+
+// Write writes all metrics in Prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.RLock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		name, help, typ := c.describe()
+		labels := labelNames(c)
+		bw.WriteString("# HELP " + name + " " + escape(help, false) + "\n")
+		bw.WriteString("# TYPE " + name + " " + typ + "\n")
+		for _, s := range c.collect() {
+			bw.WriteString(name + s.Suffix)
+			written := 0
+			for i, label := range labels {
+				if s.LabelValues[i] == "" {
+					continue
+				}
+				if written == 0 {
+					bw.WriteByte('{')
+				} else {
+					bw.WriteByte(',')
+				}
+				bw.WriteString(label + `="` + escape(s.LabelValues[i], true) + `"`)
+				written++
+			}
+			if written > 0 {
+				bw.WriteByte('}')
+			}
+			bw.WriteString(" " + formatValue(s.Value) + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v uint64 // Accessed atomically.
+}
+
+// Inc increments counter by 1.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+// Add increments counter by n.
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) value() float64 {
+	return float64(atomic.LoadUint64(&c.v))
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	v int64 // Accessed atomically.
+}
+
+// Inc increments gauge by 1.
+func (g *Gauge) Inc() {
+	atomic.AddInt64(&g.v, 1)
+}
+
+// Dec decrements gauge by 1.
+func (g *Gauge) Dec() {
+	atomic.AddInt64(&g.v, -1)
+}
+
+// Set sets gauge to n.
+func (g *Gauge) Set(n int64) {
+	atomic.StoreInt64(&g.v, n)
+}
+
+func (g *Gauge) value() float64 {
+	return float64(atomic.LoadInt64(&g.v))
+}
+
+// Histogram samples observations into cumulative buckets, so percentiles can be estimated by Prometheus.
+type Histogram struct {
+	name, help  string
+	upperBounds []float64
+
+	mu     sync.Mutex
+	counts []uint64 // Non-cumulative count of each bucket, the last one is +Inf.
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram registers and returns a histogram of buckets, which are upper bounds in increasing order.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		name:        name,
+		help:        help,
+		upperBounds: buckets,
+		counts:      make([]uint64, len(buckets)+1),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe adds an observation.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upperBounds, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+func (h *Histogram) describe() (name, help, typ string) {
+	return h.name, h.help, typeHistogram
+}
+
+func (h *Histogram) collect() []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := make([]Sample, 0, len(h.counts)+2)
+	var cumulative uint64
+	for i, count := range h.counts {
+		cumulative += count
+		le := "+Inf"
+		if i < len(h.upperBounds) {
+			le = formatValue(h.upperBounds[i])
+		}
+		samples = append(samples, Sample{Suffix: "_bucket", LabelValues: []string{le}, Value: float64(cumulative)})
+	}
+	return append(samples,
+		Sample{Suffix: "_sum", LabelValues: []string{""}, Value: h.sum},
+		Sample{Suffix: "_count", LabelValues: []string{""}, Value: float64(h.count)},
+	)
+}
+
+// CounterVec is a set of counters partitioned by label values.
+type CounterVec struct {
+	*vec
+}
+
+// WithLabelValues returns the counter of label values, which must be in order of label names.
+// Caller should keep the counter instead of calling this in hot paths.
+func (v *CounterVec) WithLabelValues(values ...string) *Counter {
+	return v.get(values, func() valuer { return &Counter{} }).(*Counter)
+}
+
+// GaugeVec is a set of gauges partitioned by label values.
+type GaugeVec struct {
+	*vec
+}
+
+// WithLabelValues returns the gauge of label values, which must be in order of label names.
+func (v *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return v.get(values, func() valuer { return &Gauge{} }).(*Gauge)
+}
+
+type valuer interface {
+	value() float64
+}
+
+type vecChild struct {
+	labelValues []string
+	valuer
+}
+
+type vec struct {
+	name, help, typ string
+	labels          []string
+
+	mu       sync.RWMutex
+	children map[string]vecChild
+}
+
+func newVec(name, help, typ string, labels []string) *vec {
+	return &vec{
+		name:     name,
+		help:     help,
+		typ:      typ,
+		labels:   labels,
+		children: make(map[string]vecChild),
+	}
+}
+
+func (v *vec) get(values []string, newValuer func() valuer) valuer {
+	if len(values) != len(v.labels) {
+		panic("metrics: inconsistent label cardinality of " + v.name)
+	}
+	key := strings.Join(values, labelSeparator)
+
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child.valuer
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok := v.children[key]; ok {
+		return child.valuer
+	}
+	child = vecChild{labelValues: append([]string(nil), values...), valuer: newValuer()}
+	v.children[key] = child
+	return child.valuer
+}
+
+func (v *vec) describe() (name, help, typ string) {
+	return v.name, v.help, v.typ
+}
+
+func (v *vec) collect() []Sample {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.children))
+	for key := range v.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	samples := make([]Sample, 0, len(keys))
+	for _, key := range keys {
+		child := v.children[key]
+		samples = append(samples, Sample{LabelValues: child.labelValues, Value: child.value()})
+	}
+	return samples
+}
+
+type gaugeFunc struct {
+	name, help string
+	labels     []string
+	f          func() []Sample
+}
+
+func (g *gaugeFunc) describe() (name, help, typ string) {
+	return g.name, g.help, typeGauge
+}
+
+func (g *gaugeFunc) collect() []Sample {
+	return g.f()
+}
+
+func labelNames(c collector) []string {
+	switch c := c.(type) {
+	case *CounterVec:
+		return c.labels
+	case *GaugeVec:
+		return c.labels
+	case *gaugeFunc:
+		return c.labels
+	case *Histogram:
+		return []string{"le"}
+	default:
+		return nil
+	}
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escape escapes help text or label value if quote is true.
+func escape(s string, quote bool) string {
+	if quote {
+		return labelValueEscaper.Replace(s)
+	}
+	return helpEscaper.Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
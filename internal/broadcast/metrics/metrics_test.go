@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_requests_total", "Requests.\nServed.").Add(3)
+	errs := r.NewCounterVec("test_errors_total", `Errors of \ kind.`, "kind", "code")
+	errs.WithLabelValues("b", "").Inc()
+	errs.WithLabelValues(`a"`+"\n"+`\`, "1").Add(2)
+	r.NewGauge("test_sessions", "Sessions.").Set(-2)
+	r.NewGaugeFunc("test_ratio", "Ratio.", []string{"stream"}, func() []Sample {
+		return []Sample{{LabelValues: []string{"s"}, Value: 0.5}, {LabelValues: []string{"t"}, Value: math.NaN()}}
+	})
+	h := r.NewHistogram("test_latency_seconds", "Latency.", []float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2} {
+		h.Observe(v)
+	}
+
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_requests_total Requests.\nServed.
+# TYPE test_requests_total counter
+test_requests_total 3
+# HELP test_errors_total Errors of \\ kind.
+# TYPE test_errors_total counter
+test_errors_total{kind="a\"\n\\",code="1"} 2
+test_errors_total{kind="b"} 1
+# HELP test_sessions Sessions.
+# TYPE test_sessions gauge
+test_sessions -2
+# HELP test_ratio Ratio.
+# TYPE test_ratio gauge
+test_ratio{stream="s"} 0.5
+test_ratio{stream="t"} NaN
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 2
+test_latency_seconds_bucket{le="1"} 3
+test_latency_seconds_bucket{le="+Inf"} 4
+test_latency_seconds_sum 2.65
+test_latency_seconds_count 4
+`
+	if got := b.String(); got != want {
+		t.Fatalf("Write() =\n%s\nwant\n%s", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if got := w.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("Content-Type = %q", got)
+	}
+	if w.Body.String() != want {
+		t.Fatalf("Handler() body =\n%s", w.Body)
+	}
+}
+
+func TestVecLabelCardinality(t *testing.T) {
+	v := NewRegistry().NewCounterVec("test_total", "Test.", "a", "b")
+	if v.WithLabelValues("x", "y") != v.WithLabelValues("x", "y") {
+		t.Fatal("WithLabelValues() returned another counter of the same label values")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithLabelValues() of inconsistent label cardinality didn't panic")
+		}
+	}()
+	v.WithLabelValues("x")
+}
+
+func TestFormatValue(t *testing.T) {
+	for v, want := range map[float64]string{
+		0:            "0",
+		1e21:         "1e+21",
+		-1.5:         "-1.5",
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+	} {
+		if got := formatValue(v); got != want {
+			t.Errorf("formatValue(%v) = %q, want %q", v, got, want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+)
+
+const (
+	defaultPushInterval = 15 * time.Second
+	defaultPushJob      = "skywalker"
+
+	pushTimeout = 10 * time.Second
+)
+
+// Pusher pushes metrics of a registry to Prometheus Pushgateway periodically.
+// It's for deployments without a Prometheus scraper, metrics reach monitoring through an outbound-only connection.
+// See: https://github.com/prometheus/pushgateway#api
+type Pusher struct {
+	registry *Registry
+	logger   zerolog.Logger
+	interval time.Duration
+	url      string
+	client   *http.Client
+}
+
+// NewPusher returns a new Pusher of registry r.
+func NewPusher(r *Registry, config cfg.MetricsConfigOptions, logger *zerolog.Logger) (*Pusher, error) {
+	u, err := url.Parse(config.PushURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse push URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported push URL scheme: %q", u.Scheme)
+	}
+
+	interval := config.PushInterval
+	if interval <= 0 {
+		interval = defaultPushInterval
+	}
+	job := config.PushJob
+	if job == "" {
+		job = defaultPushJob
+	}
+	instance := config.PushInstance
+	if instance == "" {
+		if instance, err = os.Hostname(); err != nil {
+			return nil, fmt.Errorf("could not get hostname as instance: %w", err)
+		}
+	}
+
+	return &Pusher{
+		registry: r,
+		logger:   loglevel.Default.Component(logger, "Pusher"),
+		interval: interval,
+		url: strings.TrimSuffix(u.String(), "/") + "/metrics" +
+			groupingKey("job", job) + groupingKey("instance", instance),
+		client: &http.Client{Timeout: pushTimeout},
+	}, nil
+}
+
+// Run pushes metrics every interval until ctx is done.
+func (p *Pusher) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.logger.Info().Str("url", p.url).Dur("interval", p.interval).Msg("started pushing metrics")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.Push(ctx); err != nil {
+				p.logger.Err(err).Msg("could not push metrics")
+			}
+		}
+	}
+}
+
+// Push pushes metrics once. All metrics of the grouping key on Pushgateway are replaced.
+func (p *Pusher) Push(ctx context.Context) error {
+	var buf bytes.Buffer
+	if err := p.registry.Write(&buf); err != nil {
+		return fmt.Errorf("could not write metrics: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, p.url, &buf)
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// groupingKey returns a path segment of grouping key label.
+// Values containing "/" are base64 encoded as Pushgateway requires.
+func groupingKey(label, value string) string {
+	if strings.Contains(value, "/") {
+		return "/" + label + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return "/" + label + "/" + url.PathEscape(value)
+}
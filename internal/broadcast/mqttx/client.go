@@ -0,0 +1,209 @@
+package mqttx
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// ErrDropped completes tokens of messages dropped from a full offline queue, or queued on disconnect.
+var ErrDropped = errors.New("message dropped from MQTT offline queue")
+
+// client wraps a paho client, it resubscribes topics after every reconnect, as subscriptions of a clean session
+// are gone with the broker, and queues messages published while disconnected to replay them after reconnect,
+// as paho drops QoS 0 messages in the meantime.
+type client struct {
+	mqtt.Client
+	logger zerolog.Logger
+	// queueSize caps queue, the oldest message is dropped if exceeded, zero disables queueing.
+	queueSize int
+
+	mu            sync.Mutex
+	subscriptions map[string]subscription
+	queue         []*message
+	// pending are tokens of subscriptions made while disconnected, they complete on connect.
+	pending []*token
+}
+
+type subscription struct {
+	qos      byte
+	callback mqtt.MessageHandler
+}
+
+type message struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  interface{}
+	token    *token
+}
+
+func newClient(logger *zerolog.Logger, queueSize int) *client {
+	return &client{
+		logger:        *logger,
+		queueSize:     queueSize,
+		subscriptions: make(map[string]subscription),
+	}
+}
+
+// Publish publishes at once if connected, or queues the message, the token completes once it's replayed or dropped.
+func (c *client) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.mu.Lock()
+	if c.IsConnectionOpen() || c.queueSize <= 0 {
+		c.mu.Unlock()
+		return c.Client.Publish(topic, qos, retained, payload)
+	}
+	msg := &message{topic: topic, qos: qos, retained: retained, payload: payload, token: newToken()}
+	if len(c.queue) >= c.queueSize {
+		dropped := c.queue[0]
+		c.queue = c.queue[1:]
+		dropped.token.complete(ErrDropped)
+		metrics.MQTTOfflineDropped.Inc()
+		c.logger.Warn().Str("topic", dropped.topic).Msg("MQTT offline queue full, dropped the oldest message")
+	}
+	c.queue = append(c.queue, msg)
+	c.mu.Unlock()
+	return msg.token
+}
+
+// Subscribe subscribes topic and records it to resubscribe after reconnect. If disconnected, the token completes
+// once it's subscribed on connect.
+func (c *client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions[topic] = subscription{qos: qos, callback: callback}
+	if c.IsConnectionOpen() {
+		return c.Client.Subscribe(topic, qos, callback)
+	}
+	t := newToken()
+	c.pending = append(c.pending, t)
+	return t
+}
+
+// SubscribeMultiple subscribes filters as Subscribe does.
+func (c *client) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic, qos := range filters {
+		c.subscriptions[topic] = subscription{qos: qos, callback: callback}
+	}
+	if c.IsConnectionOpen() {
+		return c.Client.SubscribeMultiple(filters, callback)
+	}
+	t := newToken()
+	c.pending = append(c.pending, t)
+	return t
+}
+
+// Unsubscribe unsubscribes topics, they are not resubscribed after reconnect.
+func (c *client) Unsubscribe(topics ...string) mqtt.Token {
+	c.mu.Lock()
+	for _, topic := range topics {
+		delete(c.subscriptions, topic)
+	}
+	c.mu.Unlock()
+	return c.Client.Unsubscribe(topics...)
+}
+
+// Disconnect disconnects from the broker, and drops queued messages.
+func (c *client) Disconnect(quiesce uint) {
+	c.mu.Lock()
+	queue, pending := c.queue, c.pending
+	c.queue, c.pending = nil, nil
+	c.mu.Unlock()
+	for _, msg := range queue {
+		msg.token.complete(ErrDropped)
+	}
+	for _, t := range pending {
+		t.complete(mqtt.ErrNotConnected)
+	}
+	c.Client.Disconnect(quiesce)
+}
+
+// onConnect resubscribes recorded topics and replays queued messages in order, it's called on every connect.
+// Messages published after connected may overtake queued ones being replayed.
+func (c *client) onConnect() {
+	c.mu.Lock()
+	filters := make(map[string]subscription, len(c.subscriptions))
+	for topic, sub := range c.subscriptions {
+		filters[topic] = sub
+	}
+	queue, pending := c.queue, c.pending
+	c.queue, c.pending = nil, nil
+	c.mu.Unlock()
+
+	var subscribed error
+	for topic, sub := range filters {
+		t := c.Client.Subscribe(topic, sub.qos, sub.callback)
+		<-t.Done()
+		if err := t.Error(); err != nil {
+			subscribed = err
+			c.logger.Err(err).Str("topic", topic).Msg("could not resubscribe")
+		}
+	}
+	for _, t := range pending {
+		t.complete(subscribed)
+	}
+	if len(filters) > 0 {
+		c.logger.Info().Int("topics", len(filters)).Msg("resubscribed topics")
+	}
+
+	for _, msg := range queue {
+		t := c.Client.Publish(msg.topic, msg.qos, msg.retained, msg.payload)
+		go func(msg *message) {
+			<-t.Done()
+			msg.token.complete(t.Error())
+		}(msg)
+	}
+	if len(queue) > 0 {
+		c.logger.Info().Int("messages", len(queue)).Msg("replayed messages queued while disconnected")
+	}
+}
+
+// token is the token of a queued message or pending subscription.
+type token struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+func newToken() *token {
+	return &token{done: make(chan struct{})}
+}
+
+func (t *token) complete(err error) {
+	t.once.Do(func() {
+		t.err = err
+		close(t.done)
+	})
+}
+
+func (t *token) Wait() bool {
+	<-t.done
+	return true
+}
+
+func (t *token) WaitTimeout(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-t.done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+func (t *token) Done() <-chan struct{} {
+	return t.done
+}
+
+func (t *token) Error() error {
+	<-t.done
+	return t.err
+}
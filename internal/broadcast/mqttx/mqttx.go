@@ -0,0 +1,168 @@
+// Package mqttx connects to MQTT broker with TLS, MQTT over WebSocket and reconnect options,
+// which mqttclient doesn't support. The client reconnects with backoff after the broker restarts,
+// then resubscribes topics and replays messages published while disconnected.
+package mqttx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	mqttclient "github.com/SB-IM/mqtt-client"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// Protocol versions of MQTT CONNECT packet, MQTT v5 is not supported by paho.mqtt.golang.
+const (
+	ProtocolV31  = 3
+	ProtocolV311 = 4
+)
+
+// Connect connects to broker of options and returns the connected client, it fails if the broker
+// isn't connected in timeout. Server URL schemes are tcp, or ssl, tls and mqtts over TLS,
+// or ws and wss for MQTT over WebSocket.
+func Connect(ctx context.Context, options mqttclient.ConfigOptions, config cfg.MQTTConnConfigOptions, timeout time.Duration) (
+	mqtt.Client,
+	error,
+) {
+	client, t, err := connect(ctx, options, config)
+	if err != nil {
+		return nil, err
+	}
+	if !t.WaitTimeout(timeout) {
+		// Stop retrying in background.
+		client.Disconnect(0)
+		return nil, fmt.Errorf("could not connect to MQTT broker %s in %s", options.Server, timeout)
+	}
+	if err := t.Error(); err != nil {
+		return nil, fmt.Errorf("could not connect to MQTT broker %s: %w", options.Server, err)
+	}
+	return client, nil
+}
+
+// NewClient returns a client connecting to broker of options in background, it retries until connected.
+func NewClient(ctx context.Context, options mqttclient.ConfigOptions, config cfg.MQTTConnConfigOptions) (mqtt.Client, error) {
+	client, _, err := connect(ctx, options, config)
+	return client, err
+}
+
+func connect(ctx context.Context, options mqttclient.ConfigOptions, config cfg.MQTTConnConfigOptions) (
+	mqtt.Client,
+	mqtt.Token,
+	error,
+) {
+	logger := loglevel.Default.Component(log.Ctx(ctx), "MQTT").With().Str("server", options.Server).Logger()
+	c := newClient(&logger, config.OfflineQueueSize)
+	opts, err := clientOptions(options, config, c, &logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Client = mqtt.NewClient(opts)
+	return c, c.Client.Connect(), nil
+}
+
+func clientOptions(options mqttclient.ConfigOptions, config cfg.MQTTConnConfigOptions, c *client, logger *zerolog.Logger) (
+	*mqtt.ClientOptions,
+	error,
+) {
+	server, err := url.Parse(options.Server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT server: %w", err)
+	}
+	switch config.ProtocolVersion {
+	case 0, ProtocolV31, ProtocolV311:
+	case 5:
+		return nil, errors.New("MQTT v5 is not supported, use protocol version 3 (v3.1) or 4 (v3.1.1)")
+	default:
+		return nil, fmt.Errorf("invalid MQTT protocol version %d", config.ProtocolVersion)
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(options.Server).
+		SetClientID(options.ClientID).
+		SetUsername(options.Username).
+		SetPassword(options.Password).
+		SetCleanSession(config.CleanSession).
+		SetKeepAlive(config.KeepAlive).
+		SetPingTimeout(config.PingTimeout).
+		// Reconnect is retried with doubling interval capped by MaxReconnectInterval, as well as the first connect.
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(config.ConnectRetryInterval).
+		SetMaxReconnectInterval(config.MaxReconnectInterval).
+		SetOnConnectHandler(func(mqtt.Client) {
+			logger.Info().Msg("connected to MQTT broker")
+			c.onConnect()
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			metrics.MQTTConnectionLosses.Inc()
+			logger.Err(err).Msg("lost connection to MQTT broker, reconnecting")
+		}).
+		SetReconnectingHandler(func(mqtt.Client, *mqtt.ClientOptions) {
+			logger.Warn().Msg("reconnecting to MQTT broker")
+		})
+	if config.ProtocolVersion != 0 {
+		opts.SetProtocolVersion(config.ProtocolVersion)
+	}
+
+	tlsConfig, err := tlsConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		switch server.Scheme {
+		case "tcp", "mqtt", "ws", "unix":
+			return nil, fmt.Errorf("TLS options require a TLS server, e.g. ssl or wss, got %s", server.Scheme)
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	return opts, nil
+}
+
+// tlsConfig returns TLS config of broker connection, or nil if no TLS option is set,
+// system CAs verify the broker of ssl, tls and wss servers then.
+func tlsConfig(config cfg.MQTTConnConfigOptions) (*tls.Config, error) {
+	if config.CACert == "" && config.ClientCert == "" && config.ClientKey == "" {
+		return nil, nil
+	}
+	c := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CACert != "" {
+		pem, err := os.ReadFile(config.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read MQTT CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in MQTT CA")
+		}
+		c.RootCAs = pool
+	}
+	if config.ClientCert != "" || config.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(config.ClientCert, config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load MQTT client certificate: %w", err)
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+	return c, nil
+}
+
+// SignalTransport is the part of mqtt.Client signaling of publisher and subscriber relies on, so they can be driven
+// by an in-memory transport instead of a broker in tests. mqtt.Client is one, testsupport.Client too.
+type SignalTransport interface {
+	Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token
+	Unsubscribe(topics ...string) mqtt.Token
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+	IsConnectionOpen() bool
+}
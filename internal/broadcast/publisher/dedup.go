@@ -0,0 +1,123 @@
+package publisher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// errRedeliveredOffer is returned if a redelivered offer is dropped, as its first delivery failed or its peer
+// connection is closed meanwhile.
+var errRedeliveredOffer = errors.New("redelivered offer of failed or closed peer connection")
+
+// offerIdentity identifies an offer of edge, the offer sequence if edge numbers its offers by "seq" in the JSON
+// of offer SDP along with the ICE ufrag of the SDP, or the hash of its SDP otherwise. Edges create a new SDP for
+// each offer, with new ICE credentials, so identical SDPs are redelivered copies of one offer, and the ufrag tells
+// apart offers of an edge restarting its sequence.
+func offerIdentity(sdp string) string {
+	var v struct {
+		Seq *uint64 `json:"seq"`
+		SDP string  `json:"sdp"`
+	}
+	err := json.Unmarshal([]byte(sdp), &v)
+	if v.SDP != "" {
+		sdp = v.SDP
+	}
+	if err == nil && v.Seq != nil {
+		return "seq:" + strconv.FormatUint(*v.Seq, 10) + ":" + iceUfrag(sdp)
+	}
+	sum := sha256.Sum256([]byte(sdp))
+	return "sdp:" + hex.EncodeToString(sum[:])
+}
+
+// iceUfrag returns the first ICE ufrag of sdp, empty if there is none.
+func iceUfrag(sdp string) string {
+	const prefix = "a=ice-ufrag:"
+	for _, line := range strings.Split(sdp, "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix)
+		}
+	}
+	return ""
+}
+
+// offered is the latest offer of a session.
+type offered struct {
+	identity string
+	// done is closed once the offer is signaled, then answer is set unless signaling failed.
+	done   chan struct{}
+	answer *webrtc.SessionDescription
+	// closed is set once the peer connection of the offer is closed, then the offer is forgotten.
+	closed bool
+}
+
+// offers deduplicates offers redelivered by MQTT, which delivers an offer at least once with QoS 1, e.g. again
+// after edge reconnects to broker before it got the ack. A redelivered offer is answered again by the answer of
+// its first delivery rather than creating another peer connection, which would replace the one edge is using.
+type offers struct {
+	mu     sync.Mutex
+	latest map[session.Key]*offered
+}
+
+func newOffers() *offers {
+	return &offers{latest: make(map[session.Key]*offered)}
+}
+
+// begin returns the first delivery of the offer of identity to the session of key, and reports whether it's
+// delivered before. Otherwise the offer becomes the latest one of key, and the caller must finish it.
+func (o *offers) begin(key session.Key, identity string) (*offered, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if latest, ok := o.latest[key]; ok && latest.identity == identity {
+		return latest, true
+	}
+	first := &offered{identity: identity, done: make(chan struct{})}
+	o.latest[key] = first
+	return first, false
+}
+
+// finish records answer of the offer signaled, and w its peer connection. A failed offer, whose answer is nil, is forgotten,
+// so it's signaled again if it's redelivered, and so is an offer once its peer connection is closed.
+func (o *offers) finish(key session.Key, first *offered, answer *webrtc.SessionDescription, w *webrtcx.WebRTC) {
+	o.mu.Lock()
+	first.answer = answer
+	if answer == nil && o.latest[key] == first {
+		delete(o.latest, key)
+	}
+	o.mu.Unlock()
+	close(first.done)
+	if w == nil {
+		return
+	}
+	go func() {
+		<-w.Done()
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		first.closed = true
+		if o.latest[key] == first {
+			delete(o.latest, key)
+		}
+	}()
+}
+
+// wait waits for the first delivery of an offer signaled, and returns its answer. It returns nil if signaling
+// failed or the peer connection is closed already, then the redelivered offer is dropped, as edge gives up
+// an offer not answered in time and offers again.
+func (o *offers) wait(first *offered) *webrtc.SessionDescription {
+	<-first.done
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if first.closed {
+		return nil
+	}
+	return first.answer
+}
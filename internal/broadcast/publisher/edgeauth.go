@@ -0,0 +1,117 @@
+package publisher
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+)
+
+// edgeTokenLeeway tolerates clock skew between edges and this server.
+const edgeTokenLeeway = 30 * time.Second
+
+// candidateTokenAttr is the extension attribute of edge candidates carrying their tokens, ignored by ICE agents.
+const candidateTokenAttr = " token "
+
+var (
+	errNoEdgeToken      = errors.New("no edge token")
+	errInvalidEdgeToken = errors.New("invalid edge token")
+	errExpiredEdgeToken = errors.New("edge token expired")
+)
+
+// offerToken returns the edge token in the JSON of offer SDP of an edge, empty if there is none.
+func offerToken(sdp string) string {
+	var v struct {
+		Token string `json:"token"`
+	}
+	_ = json.Unmarshal([]byte(sdp), &v)
+	return v.Token
+}
+
+// machineKey returns the key of a machine derived from the edge secret, so each edge is provisioned with its own key
+// and a leaked one can't sign offers of other machines.
+func machineKey(secret, id string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(id))
+	return mac.Sum(nil)
+}
+
+// signEdgeToken returns the token of an offer publishing the stream of meta, valid until expiry. The ID of meta is
+// namespaced by tenant if multi-tenant, so a token binds the machine to its tenant too.
+// It's in form of "<expiry in unix seconds>.<base64url HMAC SHA-256 of "id:track_source:expiry" by machine key>".
+func signEdgeToken(secret string, meta *pb.Meta, expiry int64) string {
+	exp := strconv.FormatInt(expiry, 10)
+	mac := hmac.New(sha256.New, machineKey(secret, meta.Id))
+	mac.Write([]byte(meta.Id + ":" + strconv.Itoa(int(meta.TrackSource)) + ":" + exp))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyEdgeToken checks that token is signed for the stream of meta and is not expired.
+func verifyEdgeToken(secret string, meta *pb.Meta, token string) error {
+	if token == "" {
+		return errNoEdgeToken
+	}
+	i := strings.IndexByte(token, '.')
+	if i <= 0 {
+		return errInvalidEdgeToken
+	}
+	expiry, err := strconv.ParseInt(token[:i], 10, 64)
+	if err != nil {
+		return errInvalidEdgeToken
+	}
+	if !hmac.Equal([]byte(token), []byte(signEdgeToken(secret, meta, expiry))) {
+		return errInvalidEdgeToken
+	}
+	if time.Now().Add(-edgeTokenLeeway).Unix() > expiry {
+		return errExpiredEdgeToken
+	}
+	return nil
+}
+
+// signEdgeCandidate returns candidate of an edge publishing the stream of meta, with its token appended as the
+// extension attribute "token <base64url HMAC SHA-256 of "id:track_source:candidate" by machine key>".
+func signEdgeCandidate(secret string, meta *pb.Meta, candidate string) string {
+	mac := hmac.New(sha256.New, machineKey(secret, meta.Id))
+	mac.Write([]byte(meta.Id + ":" + strconv.Itoa(int(meta.TrackSource)) + ":" + candidate))
+	return candidate + candidateTokenAttr + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyEdgeCandidate checks that candidate is signed for the stream of meta, and returns it without its token.
+func verifyEdgeCandidate(secret string, meta *pb.Meta, candidate string) (string, error) {
+	i := strings.LastIndex(candidate, candidateTokenAttr)
+	if i < 0 {
+		return "", errNoEdgeToken
+	}
+	unsigned := candidate[:i]
+	if !hmac.Equal([]byte(candidate), []byte(signEdgeCandidate(secret, meta, unsigned))) {
+		return "", errInvalidEdgeToken
+	}
+	return unsigned, nil
+}
+
+// authorizeCandidate checks the token of a candidate received over MQTT from the edge of an authorized offer, and
+// returns the candidate without it. Any MQTT client publishing to the candidate topic could otherwise inject
+// candidates into the peer connection of the edge. All candidates are authorized if no edge secret is set.
+func (p *Publisher) authorizeCandidate(meta *pb.Meta, candidate string) (string, error) {
+	if p.config.EdgeSecret == "" {
+		return candidate, nil
+	}
+	return verifyEdgeCandidate(p.config.EdgeSecret, meta, candidate)
+}
+
+// authorizeOffer checks the edge token of an MQTT offer, all offers are authorized if no edge secret is set.
+// Any MQTT client publishing to the offer topic could otherwise register a stream of any machine. The offer must be
+// qualified by the tenant of its topic before, see qualifyOffer, so a token of one tenant isn't valid on topics of
+// another.
+func (p *Publisher) authorizeOffer(offer *pb.SessionDescription) error {
+	if p.config.EdgeSecret == "" {
+		return nil
+	}
+	return verifyEdgeToken(p.config.EdgeSecret, offer.Meta, offerToken(offer.Sdp))
+}
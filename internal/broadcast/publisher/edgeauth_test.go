@@ -0,0 +1,97 @@
+package publisher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+)
+
+func TestVerifyEdgeToken(t *testing.T) {
+	const secret = "secret"
+	meta := &pb.Meta{Id: "machine", TrackSource: pb.TrackSource_DRONE}
+	valid := time.Now().Add(time.Minute).Unix()
+	token := signEdgeToken(secret, meta, valid)
+
+	tests := []struct {
+		name    string
+		secret  string
+		meta    *pb.Meta
+		token   string
+		wantErr error
+	}{
+		{name: "valid", secret: secret, meta: meta, token: token},
+		{name: "expired within leeway", secret: secret, meta: meta,
+			token: signEdgeToken(secret, meta, time.Now().Add(-edgeTokenLeeway/2).Unix())},
+		{name: "expired", secret: secret, meta: meta,
+			token: signEdgeToken(secret, meta, time.Now().Add(-2*edgeTokenLeeway).Unix()), wantErr: errExpiredEdgeToken},
+		{name: "another secret", secret: "other", meta: meta, token: token, wantErr: errInvalidEdgeToken},
+		{name: "another machine", secret: secret, meta: &pb.Meta{Id: "other", TrackSource: pb.TrackSource_DRONE},
+			token: token, wantErr: errInvalidEdgeToken},
+		{name: "another track source", secret: secret, meta: &pb.Meta{Id: "machine", TrackSource: pb.TrackSource_MONITOR},
+			token: token, wantErr: errInvalidEdgeToken},
+		{name: "extended expiry", secret: secret, meta: meta,
+			token: "9" + token, wantErr: errInvalidEdgeToken},
+		{name: "no expiry", secret: secret, meta: meta, token: token[strings.IndexByte(token, '.'):], wantErr: errInvalidEdgeToken},
+		{name: "malformed expiry", secret: secret, meta: meta, token: "x.y", wantErr: errInvalidEdgeToken},
+		{name: "no signature", secret: secret, meta: meta, token: "123", wantErr: errInvalidEdgeToken},
+		{name: "empty", secret: secret, meta: meta, wantErr: errNoEdgeToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyEdgeToken(tt.secret, tt.meta, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyEdgeToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyEdgeCandidate(t *testing.T) {
+	const (
+		secret    = "secret"
+		candidate = "candidate:1 1 udp 2130706431 192.0.2.1 5000 typ host"
+	)
+	meta := &pb.Meta{Id: "machine", TrackSource: pb.TrackSource_DRONE}
+	signed := signEdgeCandidate(secret, meta, candidate)
+
+	tests := []struct {
+		name      string
+		meta      *pb.Meta
+		candidate string
+		want      string
+		wantErr   error
+	}{
+		{name: "valid", meta: meta, candidate: signed, want: candidate},
+		{name: "another machine", meta: &pb.Meta{Id: "other", TrackSource: pb.TrackSource_DRONE},
+			candidate: signed, wantErr: errInvalidEdgeToken},
+		{name: "altered candidate", meta: meta,
+			candidate: strings.Replace(signed, "192.0.2.1", "192.0.2.2", 1), wantErr: errInvalidEdgeToken},
+		{name: "altered token", meta: meta, candidate: signed + "x", wantErr: errInvalidEdgeToken},
+		{name: "unsigned", meta: meta, candidate: candidate, wantErr: errNoEdgeToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := verifyEdgeCandidate(secret, tt.meta, tt.candidate)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("verifyEdgeCandidate() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("verifyEdgeCandidate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOfferToken(t *testing.T) {
+	for sdp, want := range map[string]string{
+		`{"type":"offer","sdp":"v=0","token":"1.abc"}`: "1.abc",
+		`{"type":"offer","sdp":"v=0"}`:                 "",
+		`v=0`:                                          "",
+	} {
+		if got := offerToken(sdp); got != want {
+			t.Errorf("offerToken(%q) = %q, want %q", sdp, got, want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package publisher
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// Transports of edge signaling.
+const (
+	EdgeSignalMQTT = "mqtt"
+	EdgeSignalGRPC = "grpc"
+)
+
+// edgeSignalServer serves the EdgeSignal gRPC service.
+type edgeSignalServer interface {
+	signalGRPC(stream grpc.ServerStream) error
+}
+
+// edgeSignalServiceDesc describes the EdgeSignal service of edge_signal.proto, messages are google.protobuf.Any
+// wrapping pb/signal messages, so no code is generated for them.
+var edgeSignalServiceDesc = grpc.ServiceDesc{
+	ServiceName: "skywalker.broadcast.EdgeSignal",
+	HandlerType: (*edgeSignalServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Signal",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(edgeSignalServer).signalGRPC(stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "edge_signal.proto",
+}
+
+// RegisterGRPC registers the EdgeSignal service, so edges dial the broadcast service for signaling instead of MQTT.
+//
+// An edge opens a Signal stream and sends its offer as pb.SessionDescription, the answer is sent back on the stream,
+// then candidates of both peers are exchanged as pb.ICECandidate. The peer connection outlives the stream,
+// as it does the MQTT messages. A new offer on the stream replaces the former one, e.g. after the edge restarts
+// its pipeline, and a failed signaling ends the stream with an error status.
+func (p *Publisher) RegisterGRPC(registrar grpc.ServiceRegistrar) {
+	registrar.RegisterService(&edgeSignalServiceDesc, p)
+}
+
+// grpcStream serializes sending on a Signal stream, which is not safe for concurrent use.
+type grpcStream struct {
+	stream grpc.ServerStream
+	mu     sync.Mutex
+}
+
+func (s *grpcStream) send(m proto.Message) error {
+	msg, err := anypb.New(m)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream.SendMsg(msg)
+}
+
+// grpcOffer is an offer signaled on a stream, its candidates are held back until its answer is sent,
+// as the edge must set remote description before adding them.
+type grpcOffer struct {
+	stream *grpcStream
+	meta   *pb.Meta
+	// candidates are received from edge, they are queued until the peer connection adds them.
+	// It's closed once signaling failed or the peer connection is closed, so candidates are no longer added.
+	candidates *webrtcx.CandidateQueue
+
+	mu       sync.Mutex
+	answered bool
+	pending  []*pb.ICECandidate
+}
+
+func (o *grpcOffer) finish() {
+	o.candidates.Close()
+}
+
+func (o *grpcOffer) sendCandidate(candidate *webrtc.ICECandidate) error {
+	msg := &pb.ICECandidate{Meta: o.meta, Candidate: candidate.ToJSON().Candidate}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.answered {
+		o.pending = append(o.pending, msg)
+		return nil
+	}
+	return o.stream.send(msg)
+}
+
+func (o *grpcOffer) recvCandidate() *webrtcx.CandidateQueue {
+	return o.candidates
+}
+
+// answer sends answer followed by candidates held back.
+func (o *grpcOffer) answer(answer *webrtc.SessionDescription) error {
+	sdp, err := json.Marshal(answer)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.stream.send(&pb.SessionDescription{Meta: o.meta, Sdp: string(sdp)}); err != nil {
+		return err
+	}
+	o.answered = true
+	for _, c := range o.pending {
+		if err := o.stream.send(c); err != nil {
+			return err
+		}
+	}
+	o.pending = nil
+	return nil
+}
+
+func (p *Publisher) signalGRPC(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	if !p.authorizeGRPC(ctx) {
+		return status.Error(codes.Unauthenticated, "invalid gRPC token")
+	}
+	var remoteAddr string
+	if pr, ok := peer.FromContext(ctx); ok {
+		remoteAddr = pr.Addr.String()
+	}
+	s := &grpcStream{stream: stream}
+
+	msgs := make(chan *anypb.Any)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg := new(anypb.Any)
+			if err := stream.RecvMsg(msg); err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case msgs <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// failed receives the status of a failed signaling, which ends the stream.
+	failed := make(chan error, 1)
+	var offer *grpcOffer
+	for {
+		select {
+		case msg := <-msgs:
+			switch {
+			case msg.MessageIs(&pb.SessionDescription{}):
+				var sdp pb.SessionDescription
+				if err := msg.UnmarshalTo(&sdp); err != nil || sdp.Meta == nil {
+					signalingFailed("unmarshal")
+					return status.Error(codes.InvalidArgument, "invalid offer")
+				}
+				if offer != nil {
+					offer.finish()
+				}
+				offer = &grpcOffer{
+					stream:     s,
+					meta:       sdp.Meta,
+					candidates: webrtcx.NewCandidateQueue(),
+				}
+				go p.handleGRPCOffer(&sdp, offer, remoteAddr, failed)
+			case msg.MessageIs(&pb.ICECandidate{}):
+				var candidate pb.ICECandidate
+				if err := msg.UnmarshalTo(&candidate); err != nil {
+					return status.Error(codes.InvalidArgument, "invalid candidate")
+				}
+				if offer == nil {
+					return status.Error(codes.FailedPrecondition, "candidate sent before offer")
+				}
+				// Candidates of an ended or closed peer connection are dropped.
+				offer.candidates.Push(candidate.Candidate)
+			default:
+				return status.Errorf(codes.InvalidArgument, "unexpected message %s", msg.GetTypeUrl())
+			}
+		case err := <-recvErr:
+			// The peer connection is kept after edge closes the stream.
+			if errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled {
+				return nil
+			}
+			return err
+		case err := <-failed:
+			return err
+		}
+	}
+}
+
+// handleGRPCOffer answers offer on its stream, it sends the status to failed if signaling failed.
+func (p *Publisher) handleGRPCOffer(sdp *pb.SessionDescription, offer *grpcOffer, remoteAddr string, failed chan<- error) {
+	conn := newPeer(sdp.Meta, remoteAddr)
+	logger := conn.Logger(&p.logger).With().
+		Str("id", sdp.Meta.Id).
+		Int32("track_source", int32(sdp.Meta.TrackSource)).
+		Str("remote_addr", remoteAddr).
+		Logger()
+	logger.Info().Msg("received offer from gRPC edge")
+
+	fail := func(reason string, err error) {
+		offer.finish()
+		signalingFailed(reason)
+		select {
+		case failed <- err:
+		default:
+		}
+	}
+
+	w, err := p.answerGRPC(sdp, offer, conn, &logger)
+	if err != nil {
+		logger.Err(err).Msg("failed to signal gRPC edge")
+		switch {
+		case errors.Is(err, webrtcx.ErrSignalTimeout):
+			fail("timeout", status.Error(codes.DeadlineExceeded, "signaling timed out"))
+		case errors.Is(err, errHookRejected):
+			fail("hook", status.Error(codes.PermissionDenied, err.Error()))
+		default:
+			fail("signal", status.Error(codes.InvalidArgument, "could not answer offer"))
+		}
+		return
+	}
+	go func() {
+		<-w.Done()
+		offer.finish()
+	}()
+	logger.Info().Msg("Successfully signaled gRPC edge")
+}
+
+// answerGRPC creates the publisher of offer and sends the answer on its stream.
+func (p *Publisher) answerGRPC(sdp *pb.SessionDescription, offer *grpcOffer, conn conns.Conn, logger *zerolog.Logger) (
+	*webrtcx.WebRTC,
+	error,
+) {
+	var desc webrtc.SessionDescription
+	if err := json.Unmarshal([]byte(sdp.Sdp), &desc); err != nil {
+		return nil, err
+	}
+	config := p.config.WebRTCConfigOptions
+	config.LowLatency = config.LowLatency || offerLowLatency(sdp.Sdp)
+	answer, w, err := p.publish(context.Background(), EdgeSignalGRPC, sdp.Meta, &desc, config, offer.sendCandidate, offer.recvCandidate, conn, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err := offer.answer(answer); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// authorizeGRPC reports whether metadata of ctx carries the gRPC token, all streams are authorized if no token is set.
+func (p *Publisher) authorizeGRPC(ctx context.Context) bool {
+	if p.config.GRPCToken == "" {
+		return true
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return false
+	}
+	token := strings.TrimPrefix(values[0], "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.config.GRPCToken)) == 1
+}
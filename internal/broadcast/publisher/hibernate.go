@@ -0,0 +1,116 @@
+package publisher
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// Payloads of hibernate topic.
+const (
+	hibernatePause  = "pause"
+	hibernateResume = "resume"
+)
+
+// Hibernate asks edges to pause sending media of sessions without any viewer in HibernateAfter, and to resume
+// once a viewer joins, saving uplink bandwidth of rarely watched feeds. It returns after ctx is done, and it
+// does nothing if HibernateAfter is not positive. Sessions tapped in process, e.g. being recorded, are never idle.
+func (p *Publisher) Hibernate(ctx context.Context) {
+	if p.config.HibernateAfter <= 0 {
+		return
+	}
+	// Idleness is checked a few times in HibernateAfter, while waking up is instant.
+	ticker := time.NewTicker(p.config.HibernateAfter / 4)
+	defer ticker.Stop()
+
+	idleSince := make(map[*session.Session]time.Time)
+	hibernating := make(map[*session.Session]context.CancelFunc)
+	defer func() {
+		for _, cancel := range hibernating {
+			cancel()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			live := make(map[*session.Session]bool)
+			for _, sess := range p.sessions.List() {
+				live[sess] = true
+				// Edges of relayed sessions are signaled by their origins.
+				if sess.Origin != "" || sess.Hibernating() {
+					continue
+				}
+				if cancel, ok := hibernating[sess]; ok {
+					// Woken up by a viewer.
+					cancel()
+					delete(hibernating, sess)
+				}
+				if sess.Viewers() > 0 || sess.Taps.Len() > 0 {
+					delete(idleSince, sess)
+					continue
+				}
+				since, ok := idleSince[sess]
+				if !ok {
+					idleSince[sess] = now
+					continue
+				}
+				if now.Sub(since) < p.config.HibernateAfter {
+					continue
+				}
+				woken, ok := sess.Hibernate()
+				if !ok {
+					continue
+				}
+				delete(idleSince, sess)
+				wctx, cancel := context.WithCancel(ctx)
+				hibernating[sess] = cancel
+				p.hibernate(sess.Meta, hibernatePause)
+				metrics.HibernatingSessions.Inc()
+				go p.wake(wctx, sess, woken)
+			}
+			// Forget sessions gone, and stop waiting for viewers of them.
+			for sess := range idleSince {
+				if !live[sess] {
+					delete(idleSince, sess)
+				}
+			}
+			for sess, cancel := range hibernating {
+				if !live[sess] {
+					cancel()
+					delete(hibernating, sess)
+				}
+			}
+		}
+	}
+}
+
+// wake asks edge to resume sending media of hibernating sess once a viewer joins, or gives up once ctx is done.
+func (p *Publisher) wake(ctx context.Context, sess *session.Session, woken <-chan struct{}) {
+	defer metrics.HibernatingSessions.Dec()
+	select {
+	case <-woken:
+		p.hibernate(sess.Meta, hibernateResume)
+	case <-ctx.Done():
+	}
+}
+
+// hibernate publishes payload to hibernate topic of an edge track source.
+func (p *Publisher) hibernate(meta *pb.Meta, payload string) {
+	topic := p.topic(p.config.HibernateTopicPrefix, meta)
+	t := p.mqttClient().Publish(topic, byte(p.config.Qos), p.config.Retained, payload)
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			p.logger.Err(t.Error()).Msgf("could not publish to %s", topic)
+		} else {
+			p.logger.Info().Str("topic", topic).Str("payload", payload).Msg("sent hibernation signal to edge")
+		}
+	}()
+}
@@ -0,0 +1,41 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/hooks"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// transportWHIP is the signaling transport of WHIP publishers, reported to hooks along with EdgeSignalMQTT
+// and EdgeSignalGRPC.
+const transportWHIP = "whip"
+
+// errHookRejected is returned if an offer is rejected by hooks.
+var errHookRejected = errors.New("rejected by hooks")
+
+// SetHooks sets hooks of extensions called on offers and candidates of edges, it must be called before Signal.
+func (p *Publisher) SetHooks(h hooks.Hooks) {
+	p.hooks = h
+}
+
+// checkHooks calls OnPublishRequest of hooks, it returns errHookRejected wrapping the reason if rejected.
+func (p *Publisher) checkHooks(ctx context.Context, transport string, meta *pb.Meta, remoteAddr string) error {
+	if err := p.hooks.OnPublishRequest(ctx, &hooks.PublishRequest{
+		Meta:       meta,
+		Transport:  transport,
+		RemoteAddr: remoteAddr,
+	}); err != nil {
+		return fmt.Errorf("%w: %v", errHookRejected, err)
+	}
+	return nil
+}
+
+// filterCandidates filters candidates of edge publishing meta by hooks.
+func (p *Publisher) filterCandidates(w *webrtcx.WebRTC, meta *pb.Meta) {
+	w.FilterCandidates(hooks.CandidateFilter(p.hooks, hooks.RolePublisher, meta))
+}
@@ -1,9 +1,12 @@
 package publisher
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 
 	pb "github.com/SB-IM/pb/signal"
@@ -13,46 +16,89 @@ import (
 	"google.golang.org/protobuf/proto"
 
 	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/hooks"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/mqttx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+	"github.com/SB-IM/skywalker/internal/broadcast/tracing"
 	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
 )
 
 // Publisher stands for a publisher webRTC peer.
 type Publisher struct {
-	client mqtt.Client
-	logger zerolog.Logger
-	config *cfg.PublisherConfigOptions
+	client    mqttx.SignalTransport
+	clientMux sync.RWMutex
+	signaling bool // Whether Signal has been called, guarded by clientMux.
+	logger    zerolog.Logger
+	config    *cfg.PublisherConfigOptions
 
 	// sessions must be created before used by publisher and is shared between publishers and subscribers.
 	// It's mainly written and maintained by publishers
-	sessions *sync.Map
+	sessions *session.SessionManager
+	// media is the ICE/UDP stack of publisher peer connections.
+	media *webrtcx.Media
+
+	// peers are live publisher peer connections.
+	peers *webrtcx.Peers
+	// lives are the latest publisher peers by session key, an older one is torn down once edge re-offers.
+	lives    map[session.Key]*webrtcx.WebRTC
+	livesMux sync.Mutex
+	// candidateTopics are subscribed topics of receiving edge candidates by the candidate queue of the latest peer
+	// connection of each, they are unsubscribed once it's closed or on Close. candidateTopicsMux serializes
+	// subscribing and unsubscribing them, so a closed peer connection never unsubscribes a re-offer.
+	candidateTopics    sync.Map
+	candidateTopicsMux sync.Mutex
+	// whips are peers of WHIP publishers by resource ID.
+	whips    map[string]*webrtcx.WebRTC
+	whipsMux sync.Mutex
+	// offers are the latest MQTT offers of sessions, redelivered ones are answered again without signaling.
+	offers *offers
+	// tenants limits streams of tenants, it's nil unless multi-tenant.
+	tenants *tenant.Tenants
+	// hooks are hooks of extensions, Nop by default.
+	hooks hooks.Hooks
 }
 
 // New returns a new Publisher.
 func New(
-	client mqtt.Client,
-	sessions *sync.Map,
+	client mqttx.SignalTransport,
+	sessions *session.SessionManager,
+	media *webrtcx.Media,
 	logger *zerolog.Logger,
 	config *cfg.PublisherConfigOptions,
 ) *Publisher {
-	l := logger.With().Str("component", "Publisher").Logger()
+	l := loglevel.Default.Component(logger, "Publisher")
 	return &Publisher{
 		client:   client,
 		logger:   l,
 		config:   config,
 		sessions: sessions,
+		media:    media,
+		peers:    webrtcx.NewPeers(),
+		lives:    make(map[session.Key]*webrtcx.WebRTC),
+		whips:    make(map[string]*webrtcx.WebRTC),
+		offers:   newOffers(),
+		hooks:    hooks.Nop{},
 	}
 }
 
 // Signal performs webRTC signaling for all publisher peers.
 func (p *Publisher) Signal() {
+	p.clientMux.Lock()
+	p.signaling = true
+	p.clientMux.Unlock()
+
 	// The receiving topic is different for each edge device only in "id/track_source" pattern suffix,
 	// therefore each edge client can retain its own message with its unique topic when broadcast service disconnected
 	// unexpectedly, but message payload is different.
 	// NOTE: currently, retained messsage is disabled for both cloud and edge clients due to its wired behavior.
 	// The id and trackSource in payload determine the following publishing topic.
 	// Receive remote SDP with MQTT.
-	topic := p.config.OfferTopicPrefix + "/" + "+" + "/" + "+"
-	t := p.client.Subscribe(topic, byte(p.config.Qos), p.handleMessage())
+	topic := p.offerTopic()
+	t := p.mqttClient().Subscribe(topic, byte(p.config.Qos), p.handleMessage())
 	// the connection handler is called in a goroutine so blocking here would hot cause an issue. However as blocking
 	// in other handlers does cause problems its best to just assume we should not block
 	go func() {
@@ -65,6 +111,119 @@ func (p *Publisher) Signal() {
 	}()
 }
 
+// Close stops receiving offers from edge and closes all publisher peer connections,
+// it returns after peer connections are closed or ctx is done.
+func (p *Publisher) Close(ctx context.Context) error {
+	topics := []string{p.offerTopic()}
+	p.candidateTopics.Range(func(key, _ interface{}) bool {
+		topics = append(topics, key.(string))
+		return true
+	})
+	t := p.mqttClient().Unsubscribe(topics...)
+	select {
+	case <-t.Done():
+		if t.Error() != nil {
+			p.logger.Err(t.Error()).Msg("could not unsubscribe from topics")
+		} else {
+			p.logger.Info().Int("topics", len(topics)).Msg("unsubscribed from topics")
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := p.peers.Close(ctx); err != nil {
+		return fmt.Errorf("could not close publisher peer connections: %w", err)
+	}
+	p.logger.Info().Msg("closed publisher peer connections")
+	return nil
+}
+
+// Unsubscribe stops signaling started by Signal, it unsubscribes from offer topic before ctx is done.
+// Established peer connections are kept, and Signal may be called again, e.g. to retry a failed start.
+func (p *Publisher) Unsubscribe(ctx context.Context) error {
+	p.clientMux.Lock()
+	signaling := p.signaling
+	p.signaling = false
+	p.clientMux.Unlock()
+	if !signaling {
+		return nil
+	}
+
+	topic := p.offerTopic()
+	t := p.mqttClient().Unsubscribe(topic)
+	select {
+	case <-t.Done():
+		if t.Error() != nil {
+			p.logger.Err(t.Error()).Msgf("could not unsubscribe from %s", topic)
+		} else {
+			p.logger.Info().Msgf("unsubscribed from %s", topic)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// offerTopic returns the topic filter of offers, tenants of multi-tenant edges are the first level.
+func (p *Publisher) offerTopic() string {
+	topic := p.config.OfferTopicPrefix + "/" + "+" + "/" + "+"
+	if p.tenants != nil {
+		topic = "+" + "/" + topic
+	}
+	return topic
+}
+
+// SetClient replaces the MQTT client used for signaling, e.g. after broker credentials are rotated,
+// and subscribes to offer topic with the new client if signaling has started.
+// Established peer connections are not affected as they no longer rely on MQTT.
+func (p *Publisher) SetClient(client mqttx.SignalTransport) {
+	p.clientMux.Lock()
+	p.client = client
+	signaling := p.signaling
+	p.clientMux.Unlock()
+
+	if signaling {
+		p.Signal()
+	}
+}
+
+// Resignal asks an edge to offer again through its stream hook, as a subscriber does when a viewer connects.
+// It's used after taking over from a failed instance, whose peer connections with edges are gone.
+func (p *Publisher) Resignal(meta *pb.Meta) {
+	topic := p.topic(p.config.HookStreamTopicPrefix, meta)
+	t := p.mqttClient().Publish(topic, byte(p.config.Qos), p.config.Retained, strconv.Itoa(int(webrtc.ICEConnectionStateConnected)))
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			p.logger.Err(t.Error()).Msgf("could not publish to %s", topic)
+		} else {
+			p.logger.Info().Str("topic", topic).Msg("asked edge to re-signal")
+		}
+	}()
+}
+
+// Connected reports whether the MQTT client receiving offers from edges is connected to broker.
+func (p *Publisher) Connected() bool {
+	return p.mqttClient().IsConnectionOpen()
+}
+
+// Heartbeat acquires locks taken by signaling in turn, it blocks while one of them is held, e.g. on deadlock.
+func (p *Publisher) Heartbeat() {
+	p.clientMux.Lock()
+	p.clientMux.Unlock() //nolint:staticcheck // Empty critical section waits for holders.
+	p.livesMux.Lock()
+	p.livesMux.Unlock() //nolint:staticcheck
+	p.whipsMux.Lock()
+	p.whipsMux.Unlock() //nolint:staticcheck
+	p.peers.Len()
+}
+
+func (p *Publisher) mqttClient() mqttx.SignalTransport {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+	return p.client
+}
+
 // sendCandidate sends candidate to remote webRTC peer via MQTT.
 // The publish topic is unique to this edge device.
 func (p *Publisher) sendCandidate(meta *pb.Meta) webrtcx.SendCandidateFunc {
@@ -73,8 +232,8 @@ func (p *Publisher) sendCandidate(meta *pb.Meta) webrtcx.SendCandidateFunc {
 		if err != nil {
 			return fmt.Errorf("could not encode candidate: %w", err)
 		}
-		topic := p.config.CandidateSendTopicPrefix + "/" + meta.Id + "/" + strconv.Itoa(int(meta.TrackSource))
-		t := p.client.Publish(topic, byte(p.config.Qos), p.config.Retained, payload)
+		topic := p.topic(p.config.CandidateSendTopicPrefix, meta)
+		t := p.mqttClient().Publish(topic, byte(p.config.Qos), p.config.Retained, payload)
 		// Handle the token in a go routine so this loop keeps sending messages regardless of delivery status
 		go func() {
 			<-t.Done()
@@ -86,23 +245,33 @@ func (p *Publisher) sendCandidate(meta *pb.Meta) webrtcx.SendCandidateFunc {
 	}
 }
 
-// recvCandidate is not a one time subscriber.
-// The caller must check if result in channel is nil.
-// sendCandidate receive candidate from remote webRTC peer via MQTT.
-// The subscription topic is unique to this edge device.
-func (p *Publisher) recvCandidate(meta *pb.Meta) webrtcx.RecvCandidateFunc {
-	return func() <-chan string {
-		// TODO: Figure how to properly close channel.
-		ch := make(chan string, 2) // Make buffer 2 because we have at least 2 sendings.
-		topic := p.config.CandidateRecvTopicPrefix + "/" + meta.Id + "/" + strconv.Itoa(int(meta.TrackSource))
+// recvCandidate receives candidates from remote webRTC peer via MQTT.
+// The subscription topic is unique to this edge device, a re-offer of it replaces the queue by subscribing again.
+// release unsubscribes from the topic once the peer connection is closed or signaling failed, unless a re-offer
+// subscribed to it again, it must be called after signaling returns.
+func (p *Publisher) recvCandidate(meta *pb.Meta) (recv webrtcx.RecvCandidateFunc, release func()) {
+	topic := p.topic(p.config.CandidateRecvTopicPrefix, meta)
+	var candidates *webrtcx.CandidateQueue
+	recv = func() *webrtcx.CandidateQueue {
+		candidates = webrtcx.NewCandidateQueue()
+		p.candidateTopicsMux.Lock()
+		defer p.candidateTopicsMux.Unlock()
+		p.candidateTopics.Store(topic, candidates)
 		// Receive remote ICE candidate with MQTT.
-		t := p.client.Subscribe(topic, byte(p.config.Qos), func(c mqtt.Client, m mqtt.Message) {
+		t := p.mqttClient().Subscribe(topic, byte(p.config.Qos), func(c mqtt.Client, m mqtt.Message) {
 			candidate, err := pb.DecodeCandidate(m.Payload())
 			if err != nil {
 				p.logger.Err(err).Msg("could not decode candidate")
 				return
 			}
-			ch <- candidate
+			if candidate, err = p.authorizeCandidate(meta, candidate); err != nil {
+				p.logger.Warn().Err(err).Str("topic", topic).Msg("dropped unauthenticated candidate")
+				return
+			}
+			// Handlers must not block, candidates of an ended or closed peer connection are dropped.
+			if !candidates.Push(candidate) {
+				p.logger.Warn().Str("topic", topic).Msg("dropped candidate of ended or closed peer connection")
+			}
 		})
 		// the connection handler is called in a goroutine so blocking here would hot cause an issue. However as blocking
 		// in other handlers does cause problems its best to just assume we should not block
@@ -114,8 +283,27 @@ func (p *Publisher) recvCandidate(meta *pb.Meta) webrtcx.RecvCandidateFunc {
 				p.logger.Info().Msgf("subscribed to %s", topic)
 			}
 		}()
-		return ch
+		return candidates
 	}
+	release = func() { p.unsubscribeCandidate(topic, candidates) }
+	return recv, release
+}
+
+// unsubscribeCandidate unsubscribes from candidate topic if it's still subscribed for candidates.
+func (p *Publisher) unsubscribeCandidate(topic string, candidates *webrtcx.CandidateQueue) {
+	p.candidateTopicsMux.Lock()
+	defer p.candidateTopicsMux.Unlock()
+	if current, ok := p.candidateTopics.Load(topic); !ok || candidates == nil || current != candidates {
+		return
+	}
+	p.candidateTopics.Delete(topic)
+	t := p.mqttClient().Unsubscribe(topic)
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			p.logger.Err(t.Error()).Msgf("could not unsubscribe from %s", topic)
+		}
+	}()
 }
 
 // handleMessage handles MQTT subscription message.
@@ -124,88 +312,374 @@ func (p *Publisher) handleMessage() mqtt.MessageHandler {
 		var offer pb.SessionDescription
 		if err := proto.Unmarshal(m.Payload(), &offer); err != nil {
 			p.logger.Err(err).Msg("could not unmarshal sdp")
+			signalingFailed("unmarshal")
 			return
 		}
 
-		logger := p.logger.With().
+		peer := newPeer(offer.Meta, "")
+		logger := peer.Logger(&p.logger).With().
 			Str("offer_topic_prefix", p.config.OfferTopicPrefix).
 			Str("id", offer.Meta.Id).
 			Int32("track_source", int32(offer.Meta.TrackSource)).
 			Logger()
 		logger.Info().Msg("received offer from edge")
+		p.qualifyOffer(m.Topic(), &offer)
+		if err := p.authorizeOffer(&offer); err != nil {
+			logger.Warn().Err(err).Msg("rejected unauthenticated offer")
+			signalingFailed("unauthenticated")
+			return
+		}
+		// Edges continue their traces by traceparent in the JSON of offer SDP, as MQTT 3 messages have no headers.
+		ctx, span := tracing.Default.Start(
+			tracing.WithRemote(context.Background(), offerTraceparent(offer.Sdp)),
+			"publisher.handle_offer",
+			tracing.KindServer,
+		)
+		defer span.End()
+		span.SetString("signal.transport", EdgeSignalMQTT)
+		span.SetString("stream.id", offer.Meta.Id)
+		span.SetInt("stream.track_source", int64(offer.Meta.TrackSource))
+		span.SetString("peer.id", peer.ID)
 
-		answer, err := p.signalPeerConnection(&offer, &logger)
+		answer, err := p.signalPeerConnection(ctx, &offer, peer, &logger)
+		if errors.Is(err, errRedeliveredOffer) {
+			logger.Info().Msg("dropped redelivered offer")
+			return
+		}
 		if err != nil {
+			span.SetError(err)
 			logger.Err(err).Msg("failed to signal peer connection")
+			switch {
+			case errors.Is(err, webrtcx.ErrSignalTimeout):
+				signalingFailed("timeout")
+			case errors.Is(err, errStreamLimit):
+				signalingFailed("tenant_limit")
+			case errors.Is(err, errHookRejected):
+				signalingFailed("hook")
+			default:
+				signalingFailed("signal")
+			}
 			return
 		}
 		logger.Info().Msg("Successfully signaled peer connection")
 
 		payload, err := pb.EncodeSDP(answer, nil)
 		if err != nil {
+			span.SetError(err)
 			logger.Err(err).Msg("could not encode sdp")
+			signalingFailed("encode")
 			return
 		}
 
 		// The publishing topic is unique to each edge device and is determined by above receiving message payload.
-		answerTopic := p.config.AnswerTopicPrefix + "/" + offer.Meta.Id + "/" + strconv.Itoa(int(offer.Meta.TrackSource))
+		answerTopic := p.topic(p.config.AnswerTopicPrefix, offer.Meta)
+		_, publishSpan := tracing.Default.Start(ctx, "publisher.send_answer", tracing.KindClient)
+		publishSpan.SetString("mqtt.topic", answerTopic)
 		t := c.Publish(answerTopic, byte(p.config.Qos), p.config.Retained, payload)
 		<-t.Done()
+		publishSpan.SetError(t.Error())
+		publishSpan.End()
 		if t.Error() != nil {
+			span.SetError(t.Error())
 			p.logger.Err(t.Error()).Msgf("could not publish to %s", answerTopic)
+			signalingFailed("publish")
 			return
 		}
 		logger.Info().Str("answer_topic", answerTopic).Msg("sent answer to edge")
 	}
 }
 
-// signalPeerConnection creates video track and performs webRTC signaling.
-func (p *Publisher) signalPeerConnection(offer *pb.SessionDescription, logger *zerolog.Logger) (
+// newPeer returns a publisher peer connection of meta with a new ID, it's registered once created.
+func newPeer(meta *pb.Meta, remoteAddr string) conns.Conn {
+	return conns.Conn{
+		ID:         conns.NewID(),
+		Kind:       conns.KindPeer,
+		Role:       metrics.RolePublisher,
+		Meta:       meta,
+		RemoteAddr: remoteAddr,
+	}
+}
+
+// signalingFailed counts a failed signaling of edge offer.
+func signalingFailed(reason string) {
+	metrics.SignalingFailures.WithLabelValues(metrics.RolePublisher, reason).Inc()
+}
+
+// offerTraceparent returns the W3C traceparent in the JSON of offer SDP of an edge, empty if there is none.
+func offerTraceparent(sdp string) string {
+	var v struct {
+		Traceparent string `json:"traceparent"`
+	}
+	_ = json.Unmarshal([]byte(sdp), &v)
+	return v.Traceparent
+}
+
+// offerLowLatency reports whether the JSON of offer SDP of an edge marks its session low-latency, e.g. of
+// teleoperation, by "low_latency": true.
+func offerLowLatency(sdp string) bool {
+	var v struct {
+		LowLatency bool `json:"low_latency"`
+	}
+	_ = json.Unmarshal([]byte(sdp), &v)
+	return v.LowLatency
+}
+
+// signalPeerConnection creates video and audio tracks and performs webRTC signaling over MQTT.
+// A redelivered offer is answered by the answer of its first delivery, or errRedeliveredOffer is returned.
+// ctx carries the trace of signaling.
+func (p *Publisher) signalPeerConnection(ctx context.Context, offer *pb.SessionDescription, peer conns.Conn, logger *zerolog.Logger) (
 	*webrtc.SessionDescription,
 	error,
 ) {
+	key := p.sessions.Key(offer.Meta)
+	first, redelivered := p.offers.begin(key, offerIdentity(offer.Sdp))
+	if redelivered {
+		answer := p.offers.wait(first)
+		if answer == nil {
+			metrics.DuplicateOffers.WithLabelValues("dropped").Inc()
+			return nil, errRedeliveredOffer
+		}
+		metrics.DuplicateOffers.WithLabelValues("answered").Inc()
+		logger.Info().Msg("answering redelivered offer again")
+		return answer, nil
+	}
+
 	var sdp webrtc.SessionDescription
 	if err := json.Unmarshal([]byte(offer.Sdp), &sdp); err != nil {
+		p.offers.finish(key, first, nil, nil)
 		return nil, err
 	}
+	config := p.config.WebRTCConfigOptions
+	config.LowLatency = config.LowLatency || offerLowLatency(offer.Sdp)
+	recvCandidate, releaseCandidate := p.recvCandidate(offer.Meta)
+	answer, w, err := p.publish(ctx, EdgeSignalMQTT, offer.Meta, &sdp, config, p.sendCandidate(offer.Meta), recvCandidate, peer, logger)
+	p.offers.finish(key, first, answer, w)
+	if err != nil {
+		releaseCandidate()
+		return nil, err
+	}
+	go func() {
+		<-w.Done()
+		releaseCandidate()
+	}()
+	return answer, nil
+}
 
-	videoTrack, err := webrtcx.CreateLocalTrack()
+// publish answers offer of an edge publishing the session of meta over transport, candidates are exchanged by
+// the given functions. The peer connection is registered as peer once created. Signaling is bound to ctx.
+// Sessions of LowLatency config are forwarded without the jitter buffer, and prefer video codecs without B-frames.
+func (p *Publisher) publish(
+	ctx context.Context,
+	transport string,
+	meta *pb.Meta,
+	offer *webrtc.SessionDescription,
+	config cfg.WebRTCConfigOptions,
+	sendCandidate webrtcx.SendCandidateFunc,
+	recvCandidate webrtcx.RecvCandidateFunc,
+	peer conns.Conn,
+	logger *zerolog.Logger,
+) (*webrtc.SessionDescription, *webrtcx.WebRTC, error) {
+	if err := p.allowStream(meta); err != nil {
+		return nil, nil, err
+	}
+	if err := p.checkHooks(ctx, transport, meta, peer.RemoteAddr); err != nil {
+		return nil, nil, err
+	}
+	negotiate := webrtcx.NegotiateCodecs
+	if config.LowLatency {
+		// Reordering holds packets back, so low-latency sessions are forwarded as received.
+		config.JitterBuffer = 0
+		negotiate = webrtcx.NegotiateLowLatencyCodecs
+	}
+	codecs, err := negotiate(offer, int32(meta.TrackSource), config.Codecs)
 	if err != nil {
-		return nil, fmt.Errorf("could not create webRTC local video track: %w", err)
+		return nil, nil, err
 	}
-	logger.Info().Msg("created video track")
+	key, rids := p.sessions.Key(meta), webrtcx.SimulcastRIDs(offer)
+	sess, continued := p.continuable(key, codecs, rids, config.LowLatency)
+	if continued {
+		logger.Info().Msg("continued session of restarted edge")
+	} else {
+		videoTrack, audioTrack, err := webrtcx.CreateLocalTrack(codecs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create webRTC local tracks: %w", err)
+		}
+		logger.Info().Str("video_codec", codecs.Video.MimeType).Str("audio_codec", codecs.Audio.MimeType).Msg("created video and audio tracks")
 
-	w := webrtcx.New(
-		p.config.WebRTCConfigOptions,
+		sess = session.New(key, meta, videoTrack, audioTrack)
+		sess.LowLatency = config.LowLatency
+		if err := p.addLayers(sess, rids); err != nil {
+			return nil, nil, err
+		}
+		if config.Retransmission && config.RetransmissionBuffer > 0 {
+			sess.EnableRetransmission(config.RetransmissionBuffer)
+		}
+	}
+	var w *webrtcx.WebRTC
+	w = webrtcx.New(
+		p.media,
+		config,
 		logger,
-		p.sendCandidate(offer.Meta),
-		p.recvCandidate(offer.Meta),
-		p.registerSession(offer.Meta, videoTrack),
+		sendCandidate,
+		recvCandidate,
+		p.registerSession(sess),
+		p.unregisterSession(sess, &w),
 		webrtcx.NoopHookStreamFunc,
 	)
+	w.RewriteRTP(sess.Rewriter)
+	w.RelayTelemetry(sess.Telemetry)
+	w.PreferCodecs(codecs)
+	w.MeasureLatency(sess.Latency)
+	w.CacheVideo(sess.VideoCache)
+	p.filterCandidates(w, meta)
 
-	// TODO: handle blocking case with timeout for channels.
-	w.SignalChan <- &sdp
-	if err := w.CreatePublisher(videoTrack); err != nil {
-		return nil, fmt.Errorf("failed to create webRTC publisher: %w", err)
+	ctx, span := tracing.Default.Start(ctx, "publisher.create_publisher", tracing.KindInternal)
+	defer span.End()
+	ctx, cancel := webrtcx.SignalContext(ctx, config)
+	defer cancel()
+	answer, err := w.CreatePublisher(ctx, offer, sess.VideoTrack, sess.AudioTrack, sess.Keyframes(), sess.Layers, sess.Bitrate, sess.Clock, sess.Quality, sess.Taps)
+	if err != nil {
+		span.SetError(err)
+		return nil, nil, fmt.Errorf("failed to create webRTC publisher: %w", err)
 	}
+	p.peers.Add(w)
+	conns.Default.Register(peer, w.Done())
+	p.replace(sess, w, logger)
 	logger.Info().Msg("created publisher")
 
-	return <-w.SignalChan, nil
+	return answer, w, nil
 }
 
-func (p *Publisher) registerSession(
-	meta *pb.Meta,
-	videoTrack *webrtc.TrackLocalStaticRTP,
-) webrtcx.RegisterSessionFunc {
+// continuable returns the session of key to be continued by a re-offer of edge, e.g. after it reconnects, if its
+// publisher is still live and it was published with the same codecs, simulcast layers and latency mode. Its tracks
+// are kept, so subscribers keep watching without renegotiation, and rewriters of the session keep their streams
+// continuous. Otherwise it reports false, and the re-offer replaces the session.
+func (p *Publisher) continuable(key session.Key, codecs *webrtcx.Codecs, rids []string, lowLatency bool) (*session.Session, bool) {
+	sess, ok := p.sessions.Get(key)
+	if !ok || sess.Origin != "" || sess.LowLatency != lowLatency {
+		return nil, false
+	}
+	p.livesMux.Lock()
+	_, live := p.lives[key]
+	p.livesMux.Unlock()
+	if !live || !sameCodec(sess.VideoTrack.Codec(), codecs.Video) || !sameCodec(sess.AudioTrack.Codec(), codecs.Audio) {
+		return nil, false
+	}
+	offered := sess.Layers.RIDs()
+	if len(offered) != len(rids) {
+		return nil, false
+	}
+	for i := range rids {
+		if offered[i] != rids[i] {
+			return nil, false
+		}
+	}
+	return sess, true
+}
+
+func sameCodec(x, y webrtc.RTPCodecCapability) bool {
+	return strings.EqualFold(x.MimeType, y.MimeType) && x.ClockRate == y.ClockRate && x.Channels == y.Channels &&
+		x.SDPFmtpLine == y.SDPFmtpLine
+}
+
+// addLayers adds simulcast layers of rids offered by edge to session. The default layer, DefaultLayer if offered
+// or the first one otherwise, is forwarded to video track of the session, so subscribers watch it unless they
+// select another.
+func (p *Publisher) addLayers(sess *session.Session, rids []string) error {
+	if len(rids) == 0 {
+		return nil
+	}
+	defaultRID := rids[0]
+	for _, rid := range rids {
+		if rid == p.config.DefaultLayer {
+			defaultRID = rid
+		}
+	}
+	for _, rid := range rids {
+		track := sess.VideoTrack
+		if rid != defaultRID {
+			var err error
+			if track, err = webrtcx.CreateLayerTrack(sess.VideoTrack); err != nil {
+				return fmt.Errorf("could not create track of layer %s: %w", rid, err)
+			}
+		}
+		sess.Layers.Add(rid, track)
+	}
+	p.logger.Info().Str("id", sess.ID).Strs("layers", rids).Str("default", defaultRID).Msg("edge offered simulcast")
+	return nil
+}
+
+// replace tears down the old peer connection of the same session if edge re-offers, e.g. after it reconnects,
+// and replaces the session with the new one at once, so new subscribers never bind to the dead tracks
+// and subscribers of the old session are notified to renegotiate. A continued session is kept as it is.
+func (p *Publisher) replace(sess *session.Session, w *webrtcx.WebRTC, logger *zerolog.Logger) {
+	p.livesMux.Lock()
+	old, restarted := p.lives[sess.Key]
+	p.lives[sess.Key] = w
+	p.livesMux.Unlock()
+
+	go func() {
+		<-w.Done()
+		p.livesMux.Lock()
+		defer p.livesMux.Unlock()
+		if p.lives[sess.Key] == w {
+			delete(p.lives, sess.Key)
+		}
+	}()
+
+	if !restarted {
+		return
+	}
+	// Old session is no longer current, so it's not unregistered once its peer connection is closed.
+	p.sessions.Add(sess)
+	if err := old.Close(); err != nil {
+		logger.Err(err).Msg("could not close old publisher peer connection")
+	}
+	logger.Info().Msg("replaced publisher of restarted edge")
+}
+
+// CloseSession removes sess from sessions and closes its publisher peer connection, e.g. when operators cut a stream
+// or it's expired. The edge may publish it again by a new offer. Nothing is closed if sess is not current, as the
+// publisher peer connection of its key is then of a newer session.
+func (p *Publisher) CloseSession(sess *session.Session) {
+	p.livesMux.Lock()
+	w, ok := p.lives[sess.Key]
+	p.livesMux.Unlock()
+
+	if !p.sessions.Remove(sess) {
+		return
+	}
+	p.logger.Info().Str("key", sess.ID).Int32("value", int32(sess.Meta.TrackSource)).Msg("closed session")
+	if !ok {
+		return
+	}
+	if err := w.Close(); err != nil {
+		p.logger.Err(err).Str("key", sess.ID).Msg("could not close publisher peer connection")
+	}
+}
+
+func (p *Publisher) registerSession(sess *session.Session) webrtcx.RegisterSessionFunc {
 	return func() {
-		sessionID := meta.Id + strconv.Itoa(int(meta.TrackSource))
-		_, ok := p.sessions.Load(sessionID)
-		p.sessions.Store(sessionID, videoTrack)
-		if ok {
-			p.logger.Info().Str("key", sessionID).Int32("value", int32(meta.TrackSource)).Msg("re-registered old session")
+		if p.sessions.Add(sess) {
+			p.logger.Info().Str("key", sess.ID).Int32("value", int32(sess.Meta.TrackSource)).Msg("re-registered old session")
 		} else {
-			p.logger.Info().Str("key", sessionID).Int32("value", int32(meta.TrackSource)).Msg("registered session")
+			p.logger.Info().Str("key", sess.ID).Int32("value", int32(sess.Meta.TrackSource)).Msg("registered session")
+		}
+	}
+}
+
+// unregisterSession returns a function unregistering sess once the publisher peer connection w is closed, unless
+// another one of a restarted edge continues sess.
+func (p *Publisher) unregisterSession(sess *session.Session, w **webrtcx.WebRTC) webrtcx.UnregisterSessionFunc {
+	return func() {
+		p.livesMux.Lock()
+		current, ok := p.lives[sess.Key]
+		p.livesMux.Unlock()
+		if ok && current != *w {
+			return
+		}
+		if p.sessions.Remove(sess) {
+			p.logger.Info().Str("key", sess.ID).Int32("value", int32(sess.Meta.TrackSource)).Msg("unregistered session")
 		}
 	}
 }
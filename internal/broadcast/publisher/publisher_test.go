@@ -0,0 +1,155 @@
+package publisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+	"github.com/SB-IM/skywalker/internal/edge"
+	"github.com/SB-IM/skywalker/testsupport"
+)
+
+// signalTimeout is the max time of edge signaling in tests.
+const signalTimeout = 10 * time.Second
+
+var testMQTTConfig = cfg.MQTTClientConfigOptions{
+	OfferTopicPrefix:         "/edge/livestream/signal/offer",
+	AnswerTopicPrefix:        "/edge/livestream/signal/answer",
+	CandidateSendTopicPrefix: "/edge/livestream/signal/candidate/recv",
+	CandidateRecvTopicPrefix: "/edge/livestream/signal/candidate/send",
+	HookStreamTopicPrefix:    "/edge/livestream/hook",
+	Qos:                      1,
+}
+
+// testPublisher is a publisher signaling over an in-memory broker, with peers on a virtual network.
+type testPublisher struct {
+	*Publisher
+	broker   *testsupport.Broker
+	peers    *testsupport.PeerFactory
+	sessions *session.SessionManager
+}
+
+func newTestPublisher(t *testing.T, edgeSecret string) *testPublisher {
+	t.Helper()
+	peers, err := testsupport.NewPeerFactory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.Nop()
+	config := &cfg.PublisherConfigOptions{
+		MQTTClientConfigOptions: testMQTTConfig,
+		WebRTCConfigOptions:     cfg.WebRTCConfigOptions{SignalTimeout: signalTimeout},
+		EdgeSignalConfigOptions: cfg.EdgeSignalConfigOptions{EdgeSecret: edgeSecret},
+	}
+	broker := testsupport.NewBroker()
+	client := broker.NewClient()
+	sessions := session.NewSessionManager(0, &logger)
+	p := New(client, sessions, webrtcx.NewMediaOf(peers, config.WebRTCConfigOptions), &logger, config)
+	p.Signal()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.Close(ctx); err != nil {
+			t.Error(err)
+		}
+		client.Disconnect(0)
+		sessions.Close()
+		if err := peers.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &testPublisher{Publisher: p, broker: broker, peers: peers, sessions: sessions}
+}
+
+// newEdge returns a peer connection of an edge sending track, it's closed after the test.
+func (p *testPublisher) newEdge(t *testing.T, track webrtc.TrackLocal) *webrtc.PeerConnection {
+	t.Helper()
+	peerConnection, err := p.peers.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = peerConnection.Close() })
+	if _, err := peerConnection.AddTrack(track); err != nil {
+		t.Fatal(err)
+	}
+	return peerConnection
+}
+
+// signal signals peerConnection of meta to the publisher as an edge does over a client of the broker.
+func (p *testPublisher) signal(peerConnection *webrtc.PeerConnection, meta *pb.Meta, timeout time.Duration) error {
+	client := p.broker.NewClient()
+	defer client.Disconnect(0)
+	logger := zerolog.Nop()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return edge.Signal(ctx, client, testMQTTConfig, meta, peerConnection, &logger)
+}
+
+func newVideoTrack(t *testing.T) *webrtc.TrackLocalStaticRTP {
+	t.Helper()
+	track, err := webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}, "video", "edge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return track
+}
+
+func TestPublisherSignal(t *testing.T) {
+	p := newTestPublisher(t, "")
+	meta := &pb.Meta{Id: "drone", TrackSource: pb.TrackSource_DRONE}
+	track := newVideoTrack(t)
+	if err := p.signal(p.newEdge(t, track), meta, signalTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	sess, ok := p.sessions.Get(p.sessions.Key(meta))
+	if !ok {
+		t.Fatal("no session of the edge after signaled")
+	}
+	tap := sess.Taps.Add()
+	defer sess.Taps.Remove(tap)
+
+	// Send frames until one arrives, as media may flow a moment after ICE connects.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(signalTimeout)
+	packet := &rtp.Packet{Header: rtp.Header{Version: 2, Marker: true}, Payload: []byte{0x65, 1, 2, 3}}
+	for {
+		select {
+		case got := <-tap.Packets():
+			if got.Kind != webrtc.RTPCodecTypeVideo {
+				t.Fatalf("tapped %s packet, want video", got.Kind)
+			}
+			return
+		case <-ticker.C:
+			if err := track.WriteRTP(packet); err != nil {
+				t.Fatal(err)
+			}
+			packet.SequenceNumber++
+			packet.Timestamp += 3000
+		case <-timeout:
+			t.Fatal("timed out waiting for RTP from edge")
+		}
+	}
+}
+
+func TestPublisherSignalEdgeToken(t *testing.T) {
+	p := newTestPublisher(t, "secret")
+	meta := &pb.Meta{Id: "drone", TrackSource: pb.TrackSource_DRONE}
+
+	// Offers without tokens are dropped, so the edge is never answered.
+	if err := p.signal(p.newEdge(t, newVideoTrack(t)), meta, time.Second); err == nil {
+		t.Fatal("unauthenticated edge signaled")
+	}
+	if _, ok := p.sessions.Get(p.sessions.Key(meta)); ok {
+		t.Fatal("session of unauthenticated edge is registered")
+	}
+}
@@ -0,0 +1,43 @@
+package publisher
+
+import (
+	"errors"
+	"strconv"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+)
+
+// errStreamLimit is returned if the tenant of a stream already publishes as many streams as its limit.
+var errStreamLimit = errors.New("streams limit of tenant reached")
+
+// SetTenants enables multi-tenancy, edges then signal on topics prefixed by their tenant and streams of tenants are
+// limited by t. It must be called before Signal.
+func (p *Publisher) SetTenants(t *tenant.Tenants) {
+	p.tenants = t
+}
+
+// topic returns the MQTT topic of prefix of the edge track source of meta, prefixed by its tenant if multi-tenant.
+func (p *Publisher) topic(prefix string, meta *pb.Meta) string {
+	if p.tenants != nil {
+		return tenant.Topic(prefix, meta)
+	}
+	return prefix + "/" + meta.Id + "/" + strconv.Itoa(int(meta.TrackSource))
+}
+
+// qualifyOffer namespaces the machine ID of an offer received on topic by its tenant if multi-tenant.
+// Edges keep their raw IDs, and the edge token is verified after, binding the machine to its tenant.
+func (p *Publisher) qualifyOffer(topic string, offer *pb.SessionDescription) {
+	if p.tenants != nil {
+		offer.Meta.Id = tenant.Qualify(tenant.FromTopic(topic), offer.Meta.Id)
+	}
+}
+
+// allowStream returns errStreamLimit if the stream of meta would exceed the streams limit of its tenant.
+func (p *Publisher) allowStream(meta *pb.Meta) error {
+	if p.tenants != nil && !p.tenants.AllowStream(p.sessions.Key(meta)) {
+		return errStreamLimit
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package publisher
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+	"github.com/pion/randutil"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+const (
+	whipPath = "/v1/broadcast/whip"
+	// maxOfferSize limits SDP offers of WHIP publishers.
+	maxOfferSize = 64 << 10
+
+	resourceIDLength = 16
+	resourceIDRunes  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// WHIPHandler returns the WebRTC-HTTP Ingestion Protocol (WHIP) endpoint, so standard encoders, e.g. OBS,
+// publish sessions without MQTT, see https://datatracker.ietf.org/doc/draft-ietf-wish-whip/
+//
+//	POST   /v1/broadcast/whip/{id}/{track_source}             publishes the session of an SDP offer, replying the answer
+//	DELETE /v1/broadcast/whip/{id}/{track_source}/{resource}  stops publishing, resource is of Location of the answer
+//
+// Trickle ICE is not supported, the answer carries all candidates gathered in ICEGatheringTimeout. The session is
+// marked low-latency by low_latency=true in the query of the offer.
+func (p *Publisher) WHIPHandler() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc(whipPath+"/{id}/{track_source:[0-9]+}", p.handleWHIP()).Methods(http.MethodPost)
+	router.HandleFunc(whipPath+"/{id}/{track_source:[0-9]+}/{resource}", p.handleWHIPDelete()).Methods(http.MethodDelete)
+	return router
+}
+
+func (p *Publisher) handleWHIP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.authorizeWHIP(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid WHIP token", http.StatusUnauthorized)
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/sdp" {
+			http.Error(w, "offer must be application/sdp", http.StatusUnsupportedMediaType)
+			return
+		}
+		vars := mux.Vars(r)
+		trackSource, err := session.ParseTrackSource(vars["track_source"])
+		if err != nil {
+			http.Error(w, "invalid track source", http.StatusBadRequest)
+			return
+		}
+		meta := &pb.Meta{Id: vars["id"], TrackSource: trackSource}
+		// Every reply carries the peer connection ID, so failures can be correlated with logs.
+		conn := newPeer(meta, r.RemoteAddr)
+		w.Header().Set(conns.Header, conn.ID)
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxOfferSize))
+		if err != nil {
+			http.Error(w, "could not read offer", http.StatusBadRequest)
+			return
+		}
+
+		logger := conn.Logger(&p.logger).With().
+			Str("id", meta.Id).
+			Int32("track_source", int32(meta.TrackSource)).
+			Str("remote_addr", r.RemoteAddr).
+			Logger()
+		logger.Info().Msg("received offer from WHIP publisher")
+
+		// Without trickling, candidates must be carried by the answer.
+		config := p.config.WebRTCConfigOptions
+		config.WaitICEGathering = true
+		if lowLatency, err := strconv.ParseBool(r.URL.Query().Get("low_latency")); err == nil && lowLatency {
+			config.LowLatency = true
+		}
+		offer := &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(body)}
+		answer, peer, err := p.publish(context.Background(), transportWHIP, meta, offer, config, webrtcx.NoopSendCandidateFunc, webrtcx.NoopRecvCandidateFunc, conn, &logger)
+		if err != nil {
+			logger.Err(err).Msg("failed to signal WHIP publisher")
+			switch {
+			case errors.Is(err, webrtcx.ErrSignalTimeout):
+				signalingFailed("timeout")
+				http.Error(w, "signaling timed out", http.StatusServiceUnavailable)
+			case errors.Is(err, errStreamLimit):
+				signalingFailed("tenant_limit")
+				http.Error(w, err.Error(), http.StatusTooManyRequests)
+			case errors.Is(err, errHookRejected):
+				signalingFailed("hook")
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				signalingFailed("signal")
+				http.Error(w, "could not answer offer", http.StatusBadRequest)
+			}
+			return
+		}
+
+		resource, err := randutil.GenerateCryptoRandomString(resourceIDLength, resourceIDRunes)
+		if err != nil {
+			logger.Err(err).Msg("could not generate WHIP resource ID")
+			_ = peer.Close()
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		p.whipsMux.Lock()
+		p.whips[resource] = peer
+		p.whipsMux.Unlock()
+		go func() {
+			<-peer.Done()
+			p.whipsMux.Lock()
+			delete(p.whips, resource)
+			p.whipsMux.Unlock()
+		}()
+		logger.Info().Str("resource", resource).Msg("Successfully signaled WHIP publisher")
+
+		w.Header().Set("Content-Type", "application/sdp")
+		w.Header().Set("Location", strings.Join([]string{whipPath, meta.Id, vars["track_source"], resource}, "/"))
+		w.WriteHeader(http.StatusCreated)
+		if _, err := io.WriteString(w, answer.SDP); err != nil {
+			logger.Err(err).Msg("could not write WHIP answer")
+		}
+	}
+}
+
+func (p *Publisher) handleWHIPDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !p.authorizeWHIP(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid WHIP token", http.StatusUnauthorized)
+			return
+		}
+		resource := mux.Vars(r)["resource"]
+		p.whipsMux.Lock()
+		peer, ok := p.whips[resource]
+		delete(p.whips, resource)
+		p.whipsMux.Unlock()
+		if !ok {
+			http.Error(w, "WHIP resource not found", http.StatusNotFound)
+			return
+		}
+		if err := peer.Close(); err != nil {
+			p.logger.Err(err).Str("resource", resource).Msg("could not close WHIP publisher peer connection")
+		}
+		p.logger.Info().Str("resource", resource).Msg("WHIP publisher stopped")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// authorizeWHIP reports whether r carries the WHIP token, all requests are authorized if no token is set.
+func (p *Publisher) authorizeWHIP(r *http.Request) bool {
+	if p.config.WHIPToken == "" {
+		return true
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.config.WHIPToken)) == 1
+}
@@ -0,0 +1,80 @@
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+const (
+	megabyte = 1 << 20
+
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+// Quota accounts viewer egress bytes per tenant and enforces optional daily and monthly caps.
+// Tenants must be authenticated ones, e.g. by token claims, as a viewer naming its own tenant would escape caps.
+// Usages are kept in memory and are reset on restart.
+type Quota struct {
+	daily   uint64 // Cap in bytes, zero means unlimited.
+	monthly uint64 // Cap in bytes, zero means unlimited.
+
+	mu     sync.Mutex
+	usages map[string]*usage
+}
+
+// usage is egress bytes of a tenant in current day and month, both in UTC.
+type usage struct {
+	day        string
+	dayBytes   uint64
+	month      string
+	monthBytes uint64
+}
+
+// New returns a new Quota.
+func New(config cfg.QuotaConfigOptions) *Quota {
+	return &Quota{
+		daily:   uint64(config.DailyEgressMB) * megabyte,
+		monthly: uint64(config.MonthlyEgressMB) * megabyte,
+		usages:  make(map[string]*usage),
+	}
+}
+
+// Exceeded reports whether tenant has used up its daily or monthly egress.
+func (q *Quota) Exceeded(tenant string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.usage(tenant, time.Now())
+	return (q.daily > 0 && u.dayBytes >= q.daily) || (q.monthly > 0 && u.monthBytes >= q.monthly)
+}
+
+// Add accounts n egress bytes to tenant.
+func (q *Quota) Add(tenant string, n uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u := q.usage(tenant, time.Now())
+	u.dayBytes += n
+	u.monthBytes += n
+}
+
+// usage returns usage of tenant rolled over to the period of now. It must be called with mu held.
+func (q *Quota) usage(tenant string, now time.Time) *usage {
+	u, ok := q.usages[tenant]
+	if !ok {
+		u = &usage{}
+		q.usages[tenant] = u
+	}
+
+	now = now.UTC()
+	if day := now.Format(dayLayout); u.day != day {
+		u.day, u.dayBytes = day, 0
+	}
+	if month := now.Format(monthLayout); u.month != month {
+		u.month, u.monthBytes = month, 0
+	}
+	return u
+}
@@ -0,0 +1,113 @@
+// Package ratelimit limits the rate of signaling connections per client IP and caps concurrent ones,
+// so a misbehaving client, e.g. a frontend stuck in a retry loop, can't exhaust file descriptors.
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// sweepInterval is the interval of removing buckets of idle IPs, which are full again.
+const sweepInterval = time.Minute
+
+// Limiter limits new connections per IP by token buckets, and concurrent connections of all IPs.
+// Buckets are kept in memory and are reset on restart.
+type Limiter struct {
+	rate  float64 // Tokens per second refilled, zero means unlimited.
+	burst float64 // Bucket capacity.
+	max   int32   // Max concurrent connections, zero means unlimited.
+
+	conns int32 // Concurrent connections, accessed atomically.
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// bucket is the token bucket of an IP.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a new Limiter.
+func New(config cfg.RateLimitConfigOptions) *Limiter {
+	burst := float64(config.SignalBurst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(config.SignalRate))
+	}
+	return &Limiter{
+		rate:      config.SignalRate,
+		burst:     burst,
+		max:       int32(config.MaxSignalConnections),
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether a new connection from remoteAddr is allowed, and takes a token of its IP if so.
+func (l *Limiter) Allow(remoteAddr string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep removes buckets refilled to full, as they're the same as new ones. It must be called with mu held.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for ip, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// Acquire takes a slot of concurrent connections, it returns false if all are taken.
+// Release must be called once the connection is closed if acquired.
+func (l *Limiter) Acquire() bool {
+	if l.max <= 0 {
+		return true
+	}
+	if atomic.AddInt32(&l.conns, 1) > l.max {
+		atomic.AddInt32(&l.conns, -1)
+		return false
+	}
+	return true
+}
+
+// Release releases a slot taken by Acquire.
+func (l *Limiter) Release() {
+	if l.max <= 0 {
+		return
+	}
+	atomic.AddInt32(&l.conns, -1)
+}
@@ -0,0 +1,34 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FileSink stores recordings on local disk.
+type FileSink struct {
+	dir string
+}
+
+// NewFileSink returns a new FileSink storing recordings under dir.
+func NewFileSink(dir string) (*FileSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("empty recording directory")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("could not create recording directory: %w", err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+// Create implements Sink.
+func (s *FileSink) Create(_ context.Context, name string) (io.WriteCloser, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(cleanName(name)))
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return nil, fmt.Errorf("could not create recording directory: %w", err)
+	}
+	return os.Create(p)
+}
@@ -0,0 +1,95 @@
+package record
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// Handler returns the admin API of recordings:
+//
+//	GET    /v1/broadcast/recordings                          lists recordings
+//	POST   /v1/broadcast/recordings/{id}/{track_source}      starts recording a live stream
+//	DELETE /v1/broadcast/recordings/{id}/{track_source}      stops recording a stream
+func (r *Recorder) Handler() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/broadcast/recordings", r.handleList()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/broadcast/recordings/{id}/{track_source:[0-9]+}", r.handleStart()).Methods(http.MethodPost)
+	router.HandleFunc("/v1/broadcast/recordings/{id}/{track_source:[0-9]+}", r.handleStop()).Methods(http.MethodDelete)
+	return router
+}
+
+func (r *Recorder) handleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(r.List()); err != nil {
+			r.logger.Err(err).Msg("could not write recordings JSON")
+		}
+	}
+}
+
+func (r *Recorder) handleStart() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		meta, ok := streamMeta(w, req)
+		if !ok {
+			return
+		}
+		sess, ok := r.sessions.Get(r.sessions.Key(meta))
+		if !ok {
+			http.Error(w, "stream not found", http.StatusNotFound)
+			return
+		}
+
+		status, err := r.Start(sess)
+		switch {
+		case errors.Is(err, ErrRecording):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case errors.Is(err, ErrNoSink), errors.Is(err, ErrUnsupportedCodec):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			r.logger.Err(err).Msg("could not write recording JSON")
+		}
+	}
+}
+
+func (r *Recorder) handleStop() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		meta, ok := streamMeta(w, req)
+		if !ok {
+			return
+		}
+		if err := r.Stop(r.sessions.Key(meta)); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// streamMeta returns metadata of stream in URL path, or replies bad request.
+func streamMeta(w http.ResponseWriter, req *http.Request) (*pb.Meta, bool) {
+	vars := mux.Vars(req)
+	trackSource, err := session.ParseTrackSource(vars["track_source"])
+	if err != nil {
+		http.Error(w, "invalid track source", http.StatusBadRequest)
+		return nil, false
+	}
+	return &pb.Meta{
+		Id:          vars["id"],
+		TrackSource: trackSource,
+	}, true
+}
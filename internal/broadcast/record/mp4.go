@@ -0,0 +1,84 @@
+package record
+
+import (
+	"io"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/fmp4"
+)
+
+// Tracks of samples written to mp4Writer.
+const (
+	trackVideo = 0
+	trackAudio = 1
+)
+
+// maxFragmentSize caps bytes of samples of a fragment in case keyframes are rare, as they are buffered until then.
+const maxFragmentSize = 5 << 20
+
+// mp4Writer writes H264 video and Opus audio to a fragmented MP4 file as they arrive, a fragment per GOP, so that
+// nothing is seeked back and a file cut off by a crash is still playable up to its last fragment.
+type mp4Writer struct {
+	w        io.Writer
+	sequence uint32           // Sequence number of the latest fragment.
+	pending  [2]*fmp4.Sample  // The latest sample of video and audio, pending until its duration is known.
+	samples  [2][]fmp4.Sample // Samples of the current fragment.
+	size     int              // Bytes of samples of the current fragment.
+}
+
+// newMP4Writer writes the initialization segment of a fragmented MP4 file with a video track of H264 sps and pps,
+// and an Opus audio track.
+func newMP4Writer(w io.Writer, sps, pps []byte) (*mp4Writer, error) {
+	init, err := fmp4.InitSegment(sps, pps, true)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(init); err != nil {
+		return nil, err
+	}
+	return &mp4Writer{w: w}, nil
+}
+
+// writeSample writes a sample of track, timestamped in the timescale of the track from start of the file, once
+// its duration is known by the next sample. A video keyframe ends the fragment of samples before it.
+func (m *mp4Writer) writeSample(track int, s fmp4.Sample) error {
+	if pending := m.pending[track]; pending != nil {
+		if s.Time <= pending.Time {
+			return nil // Out of order or duplicated.
+		}
+		pending.Duration = uint32(s.Time - pending.Time)
+		m.samples[track] = append(m.samples[track], *pending)
+		m.size += len(pending.Data)
+	}
+	m.pending[track] = &s
+	if track == trackVideo && (s.Flags == fmp4.FlagsSync || m.size > maxFragmentSize) {
+		return m.flush()
+	}
+	return nil
+}
+
+// close writes samples pending, the last sample of a track lasts as long as the one before it.
+func (m *mp4Writer) close() error {
+	for track, pending := range m.pending {
+		if pending == nil {
+			continue
+		}
+		if n := len(m.samples[track]); n > 0 {
+			pending.Duration = m.samples[track][n-1].Duration
+		}
+		m.samples[track] = append(m.samples[track], *pending)
+		m.pending[track] = nil
+	}
+	return m.flush()
+}
+
+// flush writes samples of the current fragment.
+func (m *mp4Writer) flush() error {
+	if len(m.samples[trackVideo]) == 0 && len(m.samples[trackAudio]) == 0 {
+		return nil
+	}
+	m.sequence++
+	_, err := m.w.Write(fmp4.Fragment(m.sequence, m.samples[trackVideo], m.samples[trackAudio]))
+	m.samples = [2][]fmp4.Sample{}
+	m.size = 0
+	return err
+}
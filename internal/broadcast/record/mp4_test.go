@@ -0,0 +1,84 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/fmp4"
+)
+
+var (
+	testSPS = []byte{0x67, 0x42, 0xc0, 0x1f, 0xda, 0x01, 0x40, 0x16, 0xe8, 0x40}
+	testPPS = []byte{0x68, 0xce, 0x3c, 0x80}
+)
+
+// boxTypes returns types of top-level boxes of b.
+func boxTypes(t *testing.T, b []byte) []string {
+	t.Helper()
+	var types []string
+	for len(b) > 0 {
+		if len(b) < 8 {
+			t.Fatalf("truncated box header of %d bytes", len(b))
+		}
+		size := binary.BigEndian.Uint32(b)
+		if size < 8 || int(size) > len(b) {
+			t.Fatalf("box %q of size %d, %d bytes left", b[4:8], size, len(b))
+		}
+		types = append(types, string(b[4:8]))
+		b = b[size:]
+	}
+	return types
+}
+
+func TestMP4Writer(t *testing.T) {
+	var b bytes.Buffer
+	m, err := newMP4Writer(&b, testSPS, testPPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		flags := uint32(fmp4.FlagsNonSync)
+		if i%5 == 0 {
+			flags = fmp4.FlagsSync
+		}
+		if err := m.writeSample(trackVideo, fmp4.Sample{Data: []byte{1, 2, 3}, Time: int64(i) * 3000, Flags: flags}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.writeSample(trackAudio, fmp4.Sample{Data: []byte{4}, Time: int64(i) * 1600, Flags: fmp4.FlagsSync}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Out of order samples are skipped.
+	if err := m.writeSample(trackAudio, fmp4.Sample{Data: []byte{5}, Time: 0, Flags: fmp4.FlagsSync}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keyframe of the second GOP ends the first fragment, and close writes the second.
+	want := []string{"ftyp", "moov", "moof", "mdat", "moof", "mdat"}
+	if got := boxTypes(t, b.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("boxes = %v, want %v", got, want)
+	}
+	if m.sequence != 2 {
+		t.Fatalf("sequence = %d, want 2", m.sequence)
+	}
+}
+
+func TestMP4WriterEmpty(t *testing.T) {
+	var b bytes.Buffer
+	m, err := newMP4Writer(&b, testSPS, testPPS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ftyp", "moov"}
+	if got := boxTypes(t, b.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Fatalf("boxes = %v, want %v", got, want)
+	}
+}
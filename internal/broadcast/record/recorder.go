@@ -0,0 +1,451 @@
+package record
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/fmp4"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// allMachines in RecordingConfigOptions.Machines records all edge devices.
+const allMachines = "*"
+
+var (
+	// ErrRecording is returned if a session is being recorded already.
+	ErrRecording = errors.New("session is being recorded already")
+	// ErrNotRecording is returned if a session is not being recorded.
+	ErrNotRecording = errors.New("session is not being recorded")
+	// ErrNoSink is returned if a session has no recording sink.
+	ErrNoSink = errors.New("no recording sink of session")
+	// ErrUnsupportedCodec is returned if video of a session is not H264.
+	ErrUnsupportedCodec = errors.New("only H264 video can be recorded")
+)
+
+// Status is status of a recording.
+type Status struct {
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	StartedAt   time.Time      `json:"started_at"`
+	Segments    int            `json:"segments"`          // Segments opened so far, including the current one.
+	Segment     string         `json:"segment,omitempty"` // Name of the current segment in sink.
+	Bytes       uint64         `json:"bytes"`             // Media bytes written so far.
+	// Markers are markers of the session added since the recording started.
+	Markers []session.Marker `json:"markers"`
+}
+
+// segmentMarker is a marker of a session stored with the recording segment it falls in.
+type segmentMarker struct {
+	session.Marker
+	// SegmentOffset is milliseconds since the segment started.
+	SegmentOffset int64 `json:"segment_offset"`
+}
+
+// Recorder records live sessions to their recording sinks, in fragmented MP4 segments of H264 video and Opus audio.
+// A segment is rotated at the first keyframe after rotation interval, so that every segment is playable alone.
+// Markers of a session falling in a segment are stored along with it, in JSON of the segment name suffixed by
+// ".markers.json" instead of ".mp4".
+type Recorder struct {
+	logger   zerolog.Logger
+	config   cfg.RecordingConfigOptions
+	sessions *session.SessionManager
+	sinks    *Sinks
+
+	mu         sync.Mutex
+	recordings map[session.Key]*recorder
+}
+
+// NewRecorder returns a new Recorder.
+func NewRecorder(
+	sessions *session.SessionManager,
+	sinks *Sinks,
+	logger *zerolog.Logger,
+	config cfg.RecordingConfigOptions,
+) *Recorder {
+	return &Recorder{
+		logger:     loglevel.Default.Component(logger, "Recorder"),
+		config:     config,
+		sessions:   sessions,
+		sinks:      sinks,
+		recordings: make(map[session.Key]*recorder),
+	}
+}
+
+// Run records sessions of machines in config once they are published, until ctx is done.
+// A recording follows the session of the same key if edge restarts publishing.
+func (r *Recorder) Run(ctx context.Context) {
+	events, stop := r.sessions.Watch()
+	defer stop()
+	for _, sess := range r.sessions.List() {
+		r.autoStart(sess)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.stopAll()
+			return
+		case event := <-events:
+			switch event.Type {
+			case session.EventCreated:
+				r.autoStart(event.Session)
+			case session.EventReplaced:
+				if !r.stop(event.Replaced) {
+					r.autoStart(event.Session)
+				} else if _, err := r.start(event.Session); err != nil {
+					r.logger.Err(err).Str("id", event.Session.ID).Msg("could not resume recording")
+				}
+			case session.EventClosed:
+				r.stop(event.Session)
+			}
+		}
+	}
+}
+
+// Start starts recording sess.
+func (r *Recorder) Start(sess *session.Session) (*Status, error) {
+	return r.start(sess)
+}
+
+// Stop stops recording session of key. The current segment is closed and stored in background.
+func (r *Recorder) Stop(key session.Key) error {
+	r.mu.Lock()
+	rec, ok := r.recordings[key]
+	r.mu.Unlock()
+	if !ok || !r.stop(rec.sess) {
+		return ErrNotRecording
+	}
+	return nil
+}
+
+// List returns status of all recordings.
+func (r *Recorder) List() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	statuses := make([]Status, 0, len(r.recordings))
+	for _, rec := range r.recordings {
+		statuses = append(statuses, rec.status())
+	}
+	return statuses
+}
+
+func (r *Recorder) autoStart(sess *session.Session) {
+	for _, machine := range r.config.Machines {
+		if machine == allMachines || machine == sess.Meta.Id {
+			if _, err := r.start(sess); err != nil {
+				r.logger.Err(err).Str("id", sess.ID).Msg("could not start recording")
+			}
+			return
+		}
+	}
+}
+
+func (r *Recorder) start(sess *session.Session) (*Status, error) {
+	if !strings.EqualFold(sess.VideoTrack.Codec().MimeType, webrtc.MimeTypeH264) {
+		return nil, ErrUnsupportedCodec
+	}
+	sink, ok := r.sinks.For(sess.Key.Scope)
+	if !ok {
+		return nil, ErrNoSink
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.recordings[sess.Key]; ok {
+		return nil, ErrRecording
+	}
+	rec := &recorder{
+		logger:   r.logger.With().Str("id", sess.ID).Logger(),
+		sink:     sink,
+		rotation: r.config.Rotation,
+		sess:     sess,
+		tap:      sess.Taps.Add(),
+		started:  time.Now(),
+	}
+	r.recordings[sess.Key] = rec
+	metrics.Recordings.Inc()
+	go rec.run()
+	rec.logger.Info().Msg("started recording")
+
+	status := rec.status()
+	return &status, nil
+}
+
+// stop stops recording sess, and reports whether it's being recorded.
+func (r *Recorder) stop(sess *session.Session) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec, ok := r.recordings[sess.Key]
+	if !ok || rec.sess != sess {
+		return false
+	}
+	delete(r.recordings, sess.Key)
+	metrics.Recordings.Dec()
+	// Closing the tap ends run of the recorder.
+	sess.Taps.Remove(rec.tap)
+	rec.logger.Info().Msg("stopped recording")
+	return true
+}
+
+func (r *Recorder) stopAll() {
+	r.mu.Lock()
+	sessions := make([]*session.Session, 0, len(r.recordings))
+	for _, rec := range r.recordings {
+		sessions = append(sessions, rec.sess)
+	}
+	r.mu.Unlock()
+	for _, sess := range sessions {
+		r.stop(sess)
+	}
+}
+
+// recorder records a session.
+type recorder struct {
+	logger   zerolog.Logger
+	sink     Sink
+	rotation time.Duration
+	sess     *session.Session
+	tap      *session.Tap
+	started  time.Time
+
+	video    rtpx.H264Depacketizer
+	clocks   [2]rtpx.Timeline // Of video and audio.
+	sps, pps []byte
+
+	segment *segment
+
+	mu       sync.Mutex // Guards fields below read by status.
+	segments int
+	name     string
+	bytes    uint64
+}
+
+// segment is a fragmented MP4 file being written.
+type segment struct {
+	wc        io.WriteCloser
+	buf       *bufio.Writer
+	mp4       *mp4Writer
+	sps       []byte
+	startedAt time.Time
+	start     time.Duration // Timestamp of the recording where the segment starts.
+}
+
+func (r *recorder) status() Status {
+	markers := make([]session.Marker, 0)
+	for _, marker := range r.sess.Markers() {
+		if !marker.Time.Before(r.started) {
+			markers = append(markers, marker)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return Status{
+		ID:          r.sess.Meta.Id,
+		TrackSource: r.sess.Meta.TrackSource,
+		StartedAt:   r.started,
+		Segments:    r.segments,
+		Segment:     r.name,
+		Bytes:       r.bytes,
+		Markers:     markers,
+	}
+}
+
+// segmentMarkers returns markers of the session in seg ending at end, a timestamp of the recording.
+func (r *recorder) segmentMarkers(seg *segment, end time.Duration) []segmentMarker {
+	var markers []segmentMarker
+	for _, marker := range r.sess.Markers() {
+		timestamp := marker.Time.Sub(r.started)
+		if timestamp < seg.start || timestamp >= end {
+			continue
+		}
+		markers = append(markers, segmentMarker{Marker: marker, SegmentOffset: (timestamp - seg.start).Milliseconds()})
+	}
+	return markers
+}
+
+func (r *recorder) run() {
+	defer r.closeSegment()
+	for packet := range r.tap.Packets() {
+		p, ok := rtpx.Parse(packet.Data)
+		if !ok {
+			continue
+		}
+		if packet.Kind == webrtc.RTPCodecTypeAudio {
+			r.writeAudio(p)
+			continue
+		}
+		if au := r.video.Push(p); au != nil {
+			r.writeVideo(au)
+		}
+	}
+}
+
+func (r *recorder) writeVideo(au *rtpx.AccessUnit) {
+	for _, nalu := range au.NALUs {
+		switch nalu[0] & 0x1F {
+		case rtpx.NALUTypeSPS:
+			r.sps = nalu
+		case rtpx.NALUTypePPS:
+			r.pps = nalu
+		}
+	}
+	timestamp := r.clocks[0].At(au.Timestamp, rtpx.VideoClockRate, r.started)
+	keyframe := au.Keyframe()
+
+	// A new segment starts at a keyframe, once rotation is due or resolution changed.
+	if keyframe && r.sps != nil && r.pps != nil && (r.segment == nil ||
+		(r.rotation > 0 && time.Since(r.segment.startedAt) >= r.rotation) ||
+		string(r.sps) != string(r.segment.sps)) {
+		r.closeSegment()
+		r.openSegment(timestamp)
+	}
+	if r.segment == nil {
+		return
+	}
+	flags := uint32(fmp4.FlagsNonSync)
+	if keyframe {
+		flags = fmp4.FlagsSync
+	}
+	r.write(trackVideo, rtpx.VideoClockRate, timestamp, flags, au.AVCC())
+	if keyframe && r.segment != nil {
+		// The keyframe wrote the fragment of the previous GOP, keep the file playable up to it if the server crashes.
+		if err := r.segment.buf.Flush(); err != nil {
+			r.fail(err)
+		}
+	}
+}
+
+func (r *recorder) writeAudio(p rtpx.Packet) {
+	timestamp := r.clocks[1].At(p.Timestamp, rtpx.AudioClockRate, r.started)
+	if r.segment == nil || len(p.Payload) == 0 {
+		return
+	}
+	r.write(trackAudio, rtpx.AudioClockRate, timestamp, fmp4.FlagsSync, p.Payload)
+}
+
+// write writes frame of track at timestamp of the recording, in the timescale of clockRate.
+func (r *recorder) write(track int, clockRate int64, timestamp time.Duration, flags uint32, frame []byte) {
+	timestamp -= r.segment.start
+	if timestamp < 0 {
+		return // Audio a little earlier than the keyframe starting the segment.
+	}
+	sample := fmp4.Sample{Data: frame, Time: int64(timestamp) * clockRate / int64(time.Second), Flags: flags}
+	if err := r.segment.mp4.writeSample(track, sample); err != nil {
+		r.fail(err)
+		return
+	}
+	r.mu.Lock()
+	r.bytes += uint64(len(frame))
+	r.mu.Unlock()
+}
+
+func (r *recorder) openSegment(start time.Duration) {
+	now := time.Now()
+	name := fmt.Sprintf("%s/%s/%s.mp4",
+		r.sess.Meta.Id,
+		strconv.Itoa(int(r.sess.Meta.TrackSource)),
+		now.UTC().Format("20060102T150405Z"),
+	)
+	// Uploading sinks upload on close, which must not be cut by shutdown.
+	wc, err := r.sink.Create(context.Background(), name)
+	if err != nil {
+		r.logger.Err(err).Str("segment", name).Msg("could not create recording segment")
+		return
+	}
+	buf := bufio.NewWriter(wc)
+	mp4, err := newMP4Writer(buf, r.sps, r.pps)
+	if err != nil {
+		r.logger.Err(err).Str("segment", name).Msg("could not write recording segment header")
+		_ = wc.Close()
+		return
+	}
+	r.segment = &segment{
+		wc:        wc,
+		buf:       buf,
+		mp4:       mp4,
+		sps:       r.sps,
+		startedAt: now,
+		start:     start,
+	}
+	r.mu.Lock()
+	r.segments++
+	r.name = name
+	r.mu.Unlock()
+	r.logger.Info().Str("segment", name).Msg("opened recording segment")
+}
+
+// closeSegment closes the current segment, and stores it in background as uploading may take a while.
+func (r *recorder) closeSegment() {
+	seg := r.segment
+	if seg == nil {
+		return
+	}
+	r.segment = nil
+	r.mu.Lock()
+	name := r.name
+	r.name = ""
+	r.mu.Unlock()
+	markers := r.segmentMarkers(seg, time.Since(r.started))
+	// Samples pending are written before the segment goes to background.
+	mp4Err := seg.mp4.close()
+
+	go func() {
+		err := mp4Err
+		if flushErr := seg.buf.Flush(); err == nil {
+			err = flushErr
+		}
+		if closeErr := seg.wc.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			metrics.RecordingSegments.WithLabelValues("failure").Inc()
+			r.logger.Err(err).Str("segment", name).Msg("could not store recording segment")
+			return
+		}
+		metrics.RecordingSegments.WithLabelValues("success").Inc()
+		r.logger.Info().Str("segment", name).Msg("stored recording segment")
+		if len(markers) > 0 {
+			r.storeMarkers(strings.TrimSuffix(name, ".mp4")+".markers.json", markers)
+		}
+	}()
+}
+
+// storeMarkers stores markers of a segment as name in JSON.
+func (r *recorder) storeMarkers(name string, markers []segmentMarker) {
+	wc, err := r.sink.Create(context.Background(), name)
+	if err != nil {
+		r.logger.Err(err).Str("markers", name).Msg("could not create recording markers")
+		return
+	}
+	err = json.NewEncoder(wc).Encode(markers)
+	if closeErr := wc.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		r.logger.Err(err).Str("markers", name).Msg("could not store recording markers")
+		return
+	}
+	r.logger.Info().Str("markers", name).Int("count", len(markers)).Msg("stored recording markers")
+}
+
+// fail drops the current segment after a write error, a new one is opened at the next keyframe.
+func (r *recorder) fail(err error) {
+	r.logger.Err(err).Msg("could not write recording segment")
+	r.closeSegment()
+}
@@ -0,0 +1,177 @@
+package record
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	gcsEndpoint = "https://storage.googleapis.com"
+
+	amzDateLayout = "20060102T150405Z"
+)
+
+// S3Sink stores recordings in an S3 compatible object storage, including GCS with HMAC keys.
+// Objects are addressed in path style, that is, endpoint/bucket/key.
+type S3Sink struct {
+	client    *http.Client
+	endpoint  string
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+}
+
+func newS3SinkFromURL(u *url.URL, endpoint string) (*S3Sink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing bucket")
+	}
+
+	query := u.Query()
+	region := query.Get("region")
+	if v := query.Get("endpoint"); v != "" {
+		endpoint = v
+	}
+	switch {
+	case endpoint == gcsEndpoint && region == "":
+		region = "auto"
+	case region == "":
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	accessKey := u.User.Username()
+	secretKey, _ := u.User.Password()
+	if accessKey == "" {
+		accessKey, secretKey = os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("missing credentials of bucket %s", u.Host)
+	}
+
+	return &S3Sink{
+		client:    &http.Client{Timeout: uploadTimeout},
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		bucket:    u.Host,
+		prefix:    strings.Trim(u.Path, "/"),
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+	}, nil
+}
+
+// Create implements Sink.
+func (s *S3Sink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return newUploadWriter(ctx, name, s.upload)
+}
+
+func (s *S3Sink) upload(ctx context.Context, name string, content io.ReadSeeker, size int64) error {
+	key := name
+	if s.prefix != "" {
+		key = s.prefix + "/" + name
+	}
+
+	// Payload is hashed for signing, then rewound for sending.
+	h := sha256.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return fmt.Errorf("could not hash recording: %w", err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not rewind recording: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPut,
+		s.endpoint+"/"+s.bucket+"/"+escapePath(key),
+		io.NopCloser(content),
+	)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	s.sign(req, hex.EncodeToString(h.Sum(nil)), time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+// sign signs request with AWS signature version 4.
+// See: https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (s *S3Sink) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format(amzDateLayout)
+	date := amzDate[:8]
+	scope := date + "/" + s.region + "/s3/aws4_request"
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // No query.
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hashedRequest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hashedRequest[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escapePath escapes each segment of a slash separated path, with only unreserved characters left unescaped.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+				c == '-' || c == '_' || c == '.' || c == '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
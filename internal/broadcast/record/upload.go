@@ -0,0 +1,56 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// uploadTimeout bounds an upload of a segment, generous as a segment of long rotation may be large.
+const uploadTimeout = 10 * time.Minute
+
+// uploadFunc uploads content of size bytes as recording of name.
+type uploadFunc func(ctx context.Context, name string, content io.ReadSeeker, size int64) error
+
+// uploadWriter buffers a recording into a temporary file, and uploads it on Close.
+// Remote storages are then written once with known length, and retried uploads don't lose data.
+type uploadWriter struct {
+	*os.File
+
+	ctx    context.Context
+	name   string
+	upload uploadFunc
+}
+
+func newUploadWriter(ctx context.Context, name string, upload uploadFunc) (*uploadWriter, error) {
+	f, err := os.CreateTemp("", "skywalker-recording-*")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temporary recording file: %w", err)
+	}
+	return &uploadWriter{
+		File:   f,
+		ctx:    ctx,
+		name:   cleanName(name),
+		upload: upload,
+	}, nil
+}
+
+// Close uploads the recording and removes the temporary file.
+func (w *uploadWriter) Close() error {
+	defer os.Remove(w.File.Name())
+	defer w.File.Close()
+
+	size, err := w.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("could not get recording size: %w", err)
+	}
+	if _, err := w.File.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("could not rewind recording: %w", err)
+	}
+	if err := w.upload(w.ctx, w.name, w.File, size); err != nil {
+		return fmt.Errorf("could not upload recording %s: %w", w.name, err)
+	}
+	return nil
+}
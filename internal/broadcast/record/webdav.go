@@ -0,0 +1,86 @@
+package record
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// WebDAVSink stores recordings in a WebDAV server.
+type WebDAVSink struct {
+	client   *http.Client
+	base     string // Base URL without trailing slash.
+	username string
+	password string
+}
+
+func newWebDAVSinkFromURL(u *url.URL) (*WebDAVSink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("missing WebDAV host")
+	}
+
+	scheme := "http"
+	if u.Scheme == "webdavs" {
+		scheme = "https"
+	}
+	password, _ := u.User.Password()
+	return &WebDAVSink{
+		client:   &http.Client{Timeout: uploadTimeout},
+		base:     scheme + "://" + u.Host + "/" + escapePath(strings.Trim(u.Path, "/")),
+		username: u.User.Username(),
+		password: password,
+	}, nil
+}
+
+// Create implements Sink.
+func (s *WebDAVSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return newUploadWriter(ctx, name, s.upload)
+}
+
+func (s *WebDAVSink) upload(ctx context.Context, name string, content io.ReadSeeker, size int64) error {
+	// Collections must exist before putting a resource into it.
+	segments := strings.Split(name, "/")
+	collection := strings.TrimSuffix(s.base, "/")
+	for _, segment := range segments[:len(segments)-1] {
+		collection += "/" + escapePath(segment)
+		if err := s.do(ctx, "MKCOL", collection+"/", nil, 0, http.StatusCreated, http.StatusMethodNotAllowed); err != nil {
+			return fmt.Errorf("could not make collection: %w", err)
+		}
+	}
+
+	return s.do(ctx, http.MethodPut, s.base+"/"+escapePath(name), io.NopCloser(content), size,
+		http.StatusCreated, http.StatusNoContent, http.StatusOK)
+}
+
+// do sends a request, and succeeds only if response status is one of expected.
+func (s *WebDAVSink) do(
+	ctx context.Context,
+	method, target string,
+	body io.ReadCloser,
+	size int64,
+	expected ...int,
+) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected status of %s %s: %s", method, target, resp.Status)
+}
@@ -0,0 +1,207 @@
+// Package recovery recovers streams after broadcast restarts, e.g. on a redeploy.
+//
+// Metadata of sessions published to this instance is persisted to a state file as sessions come and go.
+// On startup, edges of sessions in the file are asked to re-signal through their stream hooks, as a standby
+// asks them after taking over, so streams recover in seconds instead of waiting for edges to re-offer.
+// Requests are repeated until a session is published again or attempts run out, as edges may be reconnecting
+// to the broker as well.
+package recovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultResignalAttempts = 3
+	defaultResignalInterval = 5 * time.Second
+)
+
+// state is the content of the state file.
+type state struct {
+	Sessions []*pb.Meta `json:"sessions"`
+}
+
+// ResignalFunc asks the edge of meta to offer again.
+type ResignalFunc func(meta *pb.Meta)
+
+// Recovery persists sessions and recovers them on startup.
+type Recovery struct {
+	logger   zerolog.Logger
+	config   cfg.RecoveryConfigOptions
+	sessions *session.SessionManager
+
+	mu sync.Mutex
+	// recovering are sessions of the state file not published again yet, they are persisted along with
+	// live ones, so they survive another restart during recovery.
+	recovering map[session.Key]*pb.Meta
+}
+
+// New returns a new Recovery persisting sessions to StateFile of config.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.RecoveryConfigOptions) (*Recovery, error) {
+	if config.StateFile == "" {
+		return nil, errors.New("empty state file")
+	}
+	if config.ResignalAttempts <= 0 {
+		config.ResignalAttempts = defaultResignalAttempts
+	}
+	if config.ResignalInterval <= 0 {
+		config.ResignalInterval = defaultResignalInterval
+	}
+	return &Recovery{
+		logger:     loglevel.Default.Component(logger, "Recovery"),
+		config:     config,
+		sessions:   sessions,
+		recovering: make(map[session.Key]*pb.Meta),
+	}, nil
+}
+
+// Load reads sessions of the state file left by the last run, a missing file means no session.
+// They are persisted until recovered, so Load must be called before Run.
+func (r *Recovery) Load() ([]*pb.Meta, error) {
+	b, err := os.ReadFile(r.config.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read state file: %w", err)
+	}
+	var s state
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid state file: %w", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, meta := range s.Sessions {
+		r.recovering[r.sessions.Key(meta)] = meta
+	}
+	return s.Sessions, nil
+}
+
+// Run persists sessions on every change until ctx is done.
+func (r *Recovery) Run(ctx context.Context) {
+	events, stop := r.sessions.Watch()
+	defer stop()
+	r.save()
+	for {
+		select {
+		case e := <-events:
+			switch e.Type {
+			case session.EventCreated, session.EventReplaced:
+				r.mu.Lock()
+				delete(r.recovering, e.Session.Key)
+				r.mu.Unlock()
+				r.save()
+			case session.EventClosed:
+				r.save()
+			default:
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Resignal asks edges of metas to re-signal by resignal every ResignalInterval, until their sessions are
+// published again, attempts run out or ctx is done. Sessions not recovered are dropped from the state file.
+func (r *Recovery) Resignal(ctx context.Context, metas []*pb.Meta, resignal ResignalFunc) {
+	if len(metas) == 0 {
+		return
+	}
+	r.logger.Info().Int("sessions", len(metas)).Msg("recovering sessions of last run")
+	ticker := time.NewTicker(r.config.ResignalInterval)
+	defer ticker.Stop()
+	for attempt := 1; ; attempt++ {
+		pending := r.pending()
+		if len(pending) == 0 {
+			r.logger.Info().Int("sessions", len(metas)).Msg("recovered all sessions of last run")
+			return
+		}
+		if attempt > r.config.ResignalAttempts {
+			break
+		}
+		for _, meta := range pending {
+			resignal(meta)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+
+	r.mu.Lock()
+	lost := len(r.recovering)
+	r.recovering = make(map[session.Key]*pb.Meta)
+	r.mu.Unlock()
+	r.save()
+	r.logger.Warn().Int("sessions", lost).Msg("gave up recovering sessions of last run")
+}
+
+// pending returns sessions being recovered, sessions published again are no longer recovered,
+// even if their events are dropped.
+func (r *Recovery) pending() []*pb.Meta {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metas := make([]*pb.Meta, 0, len(r.recovering))
+	for key, meta := range r.recovering {
+		if _, ok := r.sessions.Get(key); ok {
+			delete(r.recovering, key)
+			continue
+		}
+		metas = append(metas, meta)
+	}
+	return metas
+}
+
+// save writes live sessions published to this instance, along with ones being recovered, to the state file.
+// The file is replaced atomically, so a crash while writing leaves the former one.
+func (r *Recovery) save() {
+	s := state{Sessions: r.pending()}
+	for _, sess := range r.sessions.List() {
+		// Relayed sessions are recovered by instances they are published to.
+		if sess.Origin != "" {
+			continue
+		}
+		s.Sessions = append(s.Sessions, sess.Meta)
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		r.logger.Err(err).Msg("could not encode state")
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.config.StateFile), filepath.Base(r.config.StateFile)+".*")
+	if err != nil {
+		r.logger.Err(err).Msg("could not create state file")
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		r.logger.Err(err).Msg("could not write state file")
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		r.logger.Err(err).Msg("could not write state file")
+		return
+	}
+	if err := os.Rename(tmp.Name(), r.config.StateFile); err != nil {
+		r.logger.Err(err).Msg("could not replace state file")
+		return
+	}
+	r.logger.Debug().Int("sessions", len(s.Sessions)).Msg("saved state")
+}
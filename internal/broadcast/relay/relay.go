@@ -0,0 +1,164 @@
+// Package relay pulls streams from other skywalker instances as a subscriber over WebSocket signaling,
+// and forwards them to local sessions, so viewers of this instance watch streams published to others.
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/signalclient"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// rtpBufferSize is size of buffers reading RTP from upstream.
+const rtpBufferSize = 1500
+
+// ErrUpstreamClosed is returned if the peer connection to upstream is closed or failed.
+var ErrUpstreamClosed = errors.New("upstream peer connection closed")
+
+// Pull subscribes to the stream of meta through signaling URL u of upstream, e.g.
+// "wss://eu.example.com/v1/broadcast/signal?token=...", and forwards it to a new session of sessions relayed
+// from origin, until upstream ends or ctx is done. It returns nil if ctx is done, or ErrUpstreamClosed if
+// the peer connection to upstream is gone. The session is added once the answer of upstream is received,
+// and started is called with it if not nil. Keyframe requests of local viewers are relayed upstream as PLIs.
+func Pull(
+	ctx context.Context,
+	u string,
+	meta *pb.Meta,
+	sessions *session.SessionManager,
+	origin string,
+	logger *zerolog.Logger,
+	started func(sess *session.Session),
+) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return fmt.Errorf("could not create PeerConnection: %w", err)
+	}
+	defer peerConnection.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := peerConnection.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return fmt.Errorf("could not add %s transceiver: %w", kind, err)
+		}
+	}
+	// Signaling is stopped once the peer connection is gone.
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		logger.Debug().Str("state", state.String()).Msg("upstream connection state has changed")
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			cancel()
+		}
+	})
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("could not create offer: %w", err)
+	}
+	// Candidates are carried by the offer, so upstream needs no trickle from this side.
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("could not set local description: %w", err)
+	}
+	select {
+	case <-gatherComplete:
+	case <-ctx.Done():
+		return fmt.Errorf("could not gather candidates: %w", ctx.Err())
+	}
+
+	client, err := signalclient.Dial(ctx, u)
+	if err != nil {
+		return fmt.Errorf("could not signal upstream: %w", err)
+	}
+	defer client.Close()
+	if err := client.Offer(ctx, meta, peerConnection); err != nil {
+		return err
+	}
+
+	var sess *session.Session
+	defer func() {
+		if sess != nil {
+			sessions.Remove(sess)
+		}
+	}()
+	answered := func(answer *webrtc.SessionDescription) error {
+		videoTrack, audioTrack, err := webrtcx.CreateLocalTrack(webrtcx.AnsweredCodecs(answer))
+		if err != nil {
+			return fmt.Errorf("could not create webRTC local tracks: %w", err)
+		}
+		sess = session.New(sessions.Key(meta), meta, videoTrack, audioTrack)
+		sess.Origin = origin
+		peerConnection.OnTrack(func(t *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+			forward(ctx, peerConnection, t, sess, logger)
+		})
+		sessions.Add(sess)
+		logger.Info().Str("origin", origin).Msg("relaying stream from upstream")
+		if started != nil {
+			started(sess)
+		}
+		return nil
+	}
+
+	err = client.Signal(ctx, peerConnection, answered)
+	switch {
+	case parent.Err() != nil:
+		return nil
+	case ctx.Err() != nil:
+		return ErrUpstreamClosed
+	default:
+		return err
+	}
+}
+
+// forward forwards RTP of remote track t to the track of its kind in sess, as a publisher does,
+// until upstream ends or ctx is done. Keyframe requests of sess are sent upstream if t is video.
+func forward(ctx context.Context, peerConnection *webrtc.PeerConnection, t *webrtc.TrackRemote, sess *session.Session, logger *zerolog.Logger) {
+	localTrack := sess.AudioTrack
+	if t.Kind() == webrtc.RTPCodecTypeVideo {
+		localTrack = sess.VideoTrack
+		go requestKeyframes(ctx, peerConnection, t, sess.Keyframes())
+	}
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := t.Read(buf)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Err(err).Str("kind", t.Kind().String()).Msg("could not read upstream track")
+			}
+			return
+		}
+		sess.Bitrate.Add(n)
+		sess.Taps.Write(t.Kind(), buf[:n])
+		if err := localTrack.Forward(buf[:n]); err != nil {
+			logger.Err(err).Msg("could not write local track")
+			return
+		}
+	}
+}
+
+// requestKeyframes sends a PLI upstream on each request of keyframes until ctx is done.
+func requestKeyframes(ctx context.Context, peerConnection *webrtc.PeerConnection, t *webrtc.TrackRemote, keyframes <-chan struct{}) {
+	for {
+		select {
+		case <-keyframes:
+			if err := peerConnection.WriteRTCP([]rtcp.Packet{
+				&rtcp.PictureLossIndication{MediaSSRC: uint32(t.SSRC())},
+			}); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// AMF0 markers, see AMF0 specification of Adobe.
+const (
+	amfNumber      = 0x00
+	amfBoolean     = 0x01
+	amfString      = 0x02
+	amfObject      = 0x03
+	amfNull        = 0x05
+	amfUndefined   = 0x06
+	amfECMAArray   = 0x08
+	amfObjectEnd   = 0x09
+	amfStrictArray = 0x0A
+	amfDate        = 0x0B
+	amfLongString  = 0x0C
+)
+
+var errAMF = errors.New("malformed AMF0")
+
+// amfObj is an AMF0 object, ECMA arrays are decoded into it too.
+type amfObj map[string]interface{}
+
+// decodeAMF decodes AMF0 values of b, which are float64, bool, string, amfObj, []interface{} or nil.
+func decodeAMF(b []byte) ([]interface{}, error) {
+	var values []interface{}
+	for len(b) > 0 {
+		v, n, err := decodeValue(b)
+		if err != nil {
+			return values, err
+		}
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values, nil
+}
+
+// decodeValue decodes a value at the start of b, and returns it with its size.
+func decodeValue(b []byte) (interface{}, int, error) {
+	switch b[0] {
+	case amfNumber:
+		if len(b) < 9 {
+			return nil, 0, errAMF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), 9, nil
+	case amfBoolean:
+		if len(b) < 2 {
+			return nil, 0, errAMF
+		}
+		return b[1] != 0, 2, nil
+	case amfString:
+		s, n, err := decodeString(b[1:])
+		return s, 1 + n, err
+	case amfLongString:
+		if len(b) < 5 {
+			return nil, 0, errAMF
+		}
+		n := int(binary.BigEndian.Uint32(b[1:]))
+		if len(b) < 5+n {
+			return nil, 0, errAMF
+		}
+		return string(b[5 : 5+n]), 5 + n, nil
+	case amfObject:
+		obj, n, err := decodeProperties(b[1:])
+		return obj, 1 + n, err
+	case amfECMAArray:
+		if len(b) < 5 {
+			return nil, 0, errAMF
+		}
+		obj, n, err := decodeProperties(b[5:])
+		return obj, 5 + n, err
+	case amfStrictArray:
+		if len(b) < 5 {
+			return nil, 0, errAMF
+		}
+		count, off := int(binary.BigEndian.Uint32(b[1:])), 5
+		values := make([]interface{}, 0)
+		for i := 0; i < count; i++ {
+			if off >= len(b) {
+				return nil, 0, errAMF
+			}
+			v, n, err := decodeValue(b[off:])
+			if err != nil {
+				return nil, 0, err
+			}
+			values = append(values, v)
+			off += n
+		}
+		return values, off, nil
+	case amfDate:
+		if len(b) < 11 {
+			return nil, 0, errAMF
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b[1:])), 11, nil
+	case amfNull, amfUndefined:
+		return nil, 1, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported AMF0 marker 0x%02x", b[0])
+	}
+}
+
+func decodeString(b []byte) (string, int, error) {
+	if len(b) < 2 {
+		return "", 0, errAMF
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", 0, errAMF
+	}
+	return string(b[2 : 2+n]), 2 + n, nil
+}
+
+// decodeProperties decodes properties of an object until its end marker.
+func decodeProperties(b []byte) (amfObj, int, error) {
+	obj := make(amfObj)
+	off := 0
+	for {
+		key, n, err := decodeString(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		off += n
+		if off >= len(b) {
+			return nil, 0, errAMF
+		}
+		if key == "" && b[off] == amfObjectEnd {
+			return obj, off + 1, nil
+		}
+		v, n, err := decodeValue(b[off:])
+		if err != nil {
+			return nil, 0, err
+		}
+		obj[key] = v
+		off += n
+	}
+}
+
+// encodeAMF encodes values of float64, int, bool, string, amfObj or nil in AMF0.
+// Properties of objects are encoded in order of keys.
+func encodeAMF(values ...interface{}) []byte {
+	var b []byte
+	for _, v := range values {
+		b = appendValue(b, v)
+	}
+	return b
+}
+
+func appendValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case float64:
+		b = append(b, amfNumber, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[len(b)-8:], math.Float64bits(v))
+	case int:
+		return appendValue(b, float64(v))
+	case bool:
+		if v {
+			return append(b, amfBoolean, 1)
+		}
+		return append(b, amfBoolean, 0)
+	case string:
+		b = append(b, amfString)
+		b = appendString(b, v)
+	case amfObj:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = append(b, amfObject)
+		for _, k := range keys {
+			b = appendString(b, k)
+			b = appendValue(b, v[k])
+		}
+		b = append(b, 0, 0, amfObjectEnd)
+	default:
+		b = append(b, amfNull)
+	}
+	return b
+}
+
+func appendString(b []byte, s string) []byte {
+	b = append(b, byte(len(s)>>8), byte(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,78 @@
+package rtmp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAMFRoundTrip(t *testing.T) {
+	values := []interface{}{
+		"connect",
+		float64(1),
+		amfObj{"app": "live", "tcUrl": "rtmp://localhost/live", "fpad": false, "capabilities": float64(15)},
+		nil,
+		true,
+	}
+	got, err := decodeAMF(encodeAMF(values...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Fatalf("decodeAMF(encodeAMF()) = %v, want %v", got, values)
+	}
+}
+
+func TestDecodeAMF(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		want    []interface{}
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "number", b: []byte{amfNumber, 0x40, 0x45, 0, 0, 0, 0, 0, 0}, want: []interface{}{float64(42)}},
+		{name: "boolean", b: []byte{amfBoolean, 1, amfBoolean, 0}, want: []interface{}{true, false}},
+		{name: "string", b: []byte{amfString, 0, 2, 'h', 'i'}, want: []interface{}{"hi"}},
+		{name: "long string", b: []byte{amfLongString, 0, 0, 0, 2, 'h', 'i'}, want: []interface{}{"hi"}},
+		{name: "null and undefined", b: []byte{amfNull, amfUndefined}, want: []interface{}{nil, nil}},
+		{name: "date", b: []byte{amfDate, 0x40, 0x45, 0, 0, 0, 0, 0, 0, 0, 0}, want: []interface{}{float64(42)}},
+		{
+			name: "ECMA array",
+			b:    []byte{amfECMAArray, 0, 0, 0, 1, 0, 1, 'a', amfBoolean, 1, 0, 0, amfObjectEnd},
+			want: []interface{}{amfObj{"a": true}},
+		},
+		{
+			name: "strict array",
+			b:    []byte{amfStrictArray, 0, 0, 0, 2, amfNull, amfString, 0, 1, 'a'},
+			want: []interface{}{[]interface{}{nil, "a"}},
+		},
+		{name: "empty strict array", b: []byte{amfStrictArray, 0, 0, 0, 0}, want: []interface{}{[]interface{}{}}},
+		{name: "short number", b: []byte{amfNumber, 0x40}, wantErr: true},
+		{name: "short boolean", b: []byte{amfBoolean}, wantErr: true},
+		{name: "short string", b: []byte{amfString, 0, 3, 'h', 'i'}, wantErr: true},
+		{name: "short string length", b: []byte{amfString, 0}, wantErr: true},
+		{name: "short long string", b: []byte{amfLongString, 0, 0, 0, 3, 'h', 'i'}, wantErr: true},
+		{name: "short date", b: []byte{amfDate, 0x40, 0x45, 0, 0, 0, 0, 0, 0}, wantErr: true},
+		{name: "object without end", b: []byte{amfObject, 0, 1, 'a', amfNull}, wantErr: true},
+		{name: "object without value", b: []byte{amfObject, 0, 1, 'a'}, wantErr: true},
+		{name: "strict array beyond values", b: []byte{amfStrictArray, 0, 0, 0, 2, amfNull}, wantErr: true},
+		{name: "short strict array", b: []byte{amfStrictArray, 0, 0}, wantErr: true},
+		{name: "unsupported marker", b: []byte{0x10}, wantErr: true},
+		{name: "values before malformed", b: []byte{amfNull, amfNumber}, want: []interface{}{nil}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeAMF(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeAMF() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("decodeAMF() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+	if _, err := decodeAMF([]byte{amfNumber}); !errors.Is(err, errAMF) {
+		t.Fatalf("decodeAMF() error = %v, want %v", err, errAMF)
+	}
+}
@@ -0,0 +1,242 @@
+package rtmp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Message types, see section 5.4 and 7.1 of RTMP specification.
+const (
+	msgSetChunkSize     = 1
+	msgAbort            = 2
+	msgAck              = 3
+	msgUserControl      = 4
+	msgWindowAckSize    = 5
+	msgSetPeerBandwidth = 6
+	msgAudio            = 8
+	msgVideo            = 9
+	msgDataAMF0         = 18
+	msgCommandAMF0      = 20
+)
+
+const (
+	defaultChunkSize = 128
+	// outChunkSize is the chunk size of messages sent, told to the client by set chunk size.
+	outChunkSize = 4096
+	// maxMessageSize caps messages received, so a client can't make the server allocate without bound.
+	maxMessageSize    = 16 << 20
+	extendedTimestamp = 0xFFFFFF
+)
+
+// Chunk stream IDs of messages sent.
+const (
+	csidControl = 2
+	csidCommand = 3
+	csidStatus  = 5
+)
+
+// message is an RTMP message.
+type message struct {
+	typ       uint8
+	streamID  uint32
+	timestamp uint32 // Milliseconds.
+	payload   []byte
+}
+
+// chunkStream is the state of a chunk stream received, headers of later chunks omit fields of former ones.
+type chunkStream struct {
+	timestamp uint32
+	delta     uint32
+	length    uint32
+	typ       uint8
+	streamID  uint32
+	extended  bool
+	payload   []byte
+	started   bool
+}
+
+// chunkReader reads messages of chunk streams, see section 5.3 of RTMP specification.
+type chunkReader struct {
+	r         *bufio.Reader
+	chunkSize uint32
+	streams   map[uint32]*chunkStream
+	// read is the bytes read, acknowledged to the client by its window.
+	read uint32
+}
+
+func newChunkReader(r io.Reader) *chunkReader {
+	return &chunkReader{
+		r:         bufio.NewReader(r),
+		chunkSize: defaultChunkSize,
+		streams:   make(map[uint32]*chunkStream),
+	}
+}
+
+func (c *chunkReader) readFull(b []byte) error {
+	n, err := io.ReadFull(c.r, b)
+	c.read += uint32(n)
+	return err
+}
+
+// readMessage reads chunks until a message is complete.
+func (c *chunkReader) readMessage() (*message, error) {
+	var b [11]byte
+	for {
+		if err := c.readFull(b[:1]); err != nil {
+			return nil, err
+		}
+		format := b[0] >> 6
+		csid := uint32(b[0] & 0x3F)
+		switch csid {
+		case 0:
+			if err := c.readFull(b[:1]); err != nil {
+				return nil, err
+			}
+			csid = 64 + uint32(b[0])
+		case 1:
+			if err := c.readFull(b[:2]); err != nil {
+				return nil, err
+			}
+			csid = 64 + uint32(b[0]) + uint32(b[1])<<8
+		}
+
+		cs, ok := c.streams[csid]
+		if !ok {
+			if format != 0 {
+				return nil, fmt.Errorf("chunk stream %d started without full header", csid)
+			}
+			cs = &chunkStream{}
+			c.streams[csid] = cs
+		}
+		var timestamp uint32
+		switch format {
+		case 0:
+			if err := c.readFull(b[:11]); err != nil {
+				return nil, err
+			}
+			timestamp = uint24(b[0:])
+			cs.length = uint24(b[3:])
+			cs.typ = b[6]
+			cs.streamID = binary.LittleEndian.Uint32(b[7:])
+		case 1:
+			if err := c.readFull(b[:7]); err != nil {
+				return nil, err
+			}
+			timestamp = uint24(b[0:])
+			cs.length = uint24(b[3:])
+			cs.typ = b[6]
+		case 2:
+			if err := c.readFull(b[:3]); err != nil {
+				return nil, err
+			}
+			timestamp = uint24(b[0:])
+		}
+		if format < 3 {
+			cs.extended = timestamp == extendedTimestamp
+		}
+		if cs.extended {
+			if err := c.readFull(b[:4]); err != nil {
+				return nil, err
+			}
+			if format < 3 {
+				timestamp = binary.BigEndian.Uint32(b[:4])
+			}
+		}
+		if len(cs.payload) == 0 {
+			// A new message, a type 3 chunk of which repeats the former delta.
+			switch format {
+			case 0:
+				cs.timestamp = timestamp
+			case 1, 2:
+				cs.delta = timestamp
+				cs.timestamp += timestamp
+			case 3:
+				if cs.started {
+					cs.timestamp += cs.delta
+				}
+			}
+			cs.started = true
+		}
+		if cs.length > maxMessageSize {
+			return nil, fmt.Errorf("message of %d bytes is too large", cs.length)
+		}
+
+		n := cs.length - uint32(len(cs.payload))
+		if n > c.chunkSize {
+			n = c.chunkSize
+		}
+		start := len(cs.payload)
+		cs.payload = append(cs.payload, make([]byte, n)...)
+		if err := c.readFull(cs.payload[start:]); err != nil {
+			return nil, err
+		}
+		if uint32(len(cs.payload)) < cs.length {
+			continue
+		}
+		msg := &message{typ: cs.typ, streamID: cs.streamID, timestamp: cs.timestamp, payload: cs.payload}
+		cs.payload = nil
+
+		switch msg.typ {
+		case msgSetChunkSize:
+			if len(msg.payload) < 4 {
+				return nil, errors.New("malformed set chunk size")
+			}
+			size := binary.BigEndian.Uint32(msg.payload) & 0x7FFFFFFF
+			if size == 0 || size > maxMessageSize {
+				return nil, fmt.Errorf("invalid chunk size %d", size)
+			}
+			c.chunkSize = size
+			continue
+		case msgAbort:
+			if len(msg.payload) >= 4 {
+				if s, ok := c.streams[binary.BigEndian.Uint32(msg.payload)]; ok {
+					s.payload = nil
+				}
+			}
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// writeMessage writes msg in chunks of outChunkSize on chunk stream csid, which must be less than 64.
+func writeMessage(w io.Writer, csid uint8, msg *message) error {
+	b := make([]byte, 0, 12+len(msg.payload)+len(msg.payload)/outChunkSize)
+	timestamp := msg.timestamp
+	if timestamp >= extendedTimestamp {
+		timestamp = extendedTimestamp
+	}
+	b = append(b, csid,
+		byte(timestamp>>16), byte(timestamp>>8), byte(timestamp),
+		byte(len(msg.payload)>>16), byte(len(msg.payload)>>8), byte(len(msg.payload)),
+		msg.typ,
+		byte(msg.streamID), byte(msg.streamID>>8), byte(msg.streamID>>16), byte(msg.streamID>>24),
+	)
+	if timestamp == extendedTimestamp {
+		b = append(b, byte(msg.timestamp>>24), byte(msg.timestamp>>16), byte(msg.timestamp>>8), byte(msg.timestamp))
+	}
+	for p := msg.payload; ; {
+		n := len(p)
+		if n > outChunkSize {
+			n = outChunkSize
+		}
+		b = append(b, p[:n]...)
+		p = p[n:]
+		if len(p) == 0 {
+			break
+		}
+		b = append(b, 0xC0|csid)
+		if timestamp == extendedTimestamp {
+			b = append(b, byte(msg.timestamp>>24), byte(msg.timestamp>>16), byte(msg.timestamp>>8), byte(msg.timestamp))
+		}
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2])
+}
@@ -0,0 +1,130 @@
+package rtmp
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	messages := []*message{
+		{typ: msgCommandAMF0, timestamp: 0, payload: encodeAMF("connect", 1, amfObj{"app": "live"})},
+		// Spans chunks of outChunkSize.
+		{typ: msgVideo, streamID: 1, timestamp: 40, payload: bytes.Repeat([]byte{1}, 2*outChunkSize+1)},
+		// Extended timestamps are repeated in each chunk.
+		{typ: msgAudio, streamID: 1, timestamp: extendedTimestamp + 1, payload: bytes.Repeat([]byte{2}, outChunkSize+1)},
+	}
+	var buf bytes.Buffer
+	// Set chunk size so the reader reads chunks of outChunkSize.
+	if err := writeMessage(&buf, csidControl, &message{typ: msgSetChunkSize, payload: []byte{0, 0, outChunkSize >> 8, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range messages {
+		if err := writeMessage(&buf, csidCommand, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := uint32(buf.Len())
+
+	r := newChunkReader(&buf)
+	for _, want := range messages {
+		got, err := r.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("readMessage() = type %d, stream %d, timestamp %d, %d bytes, want type %d, stream %d, timestamp %d, %d bytes",
+				got.typ, got.streamID, got.timestamp, len(got.payload), want.typ, want.streamID, want.timestamp, len(want.payload))
+		}
+	}
+	if r.chunkSize != outChunkSize {
+		t.Fatalf("chunk size = %d, want %d", r.chunkSize, outChunkSize)
+	}
+	if r.read != size {
+		t.Fatalf("read %d bytes, want %d", r.read, size)
+	}
+	if _, err := r.readMessage(); err != io.EOF {
+		t.Fatalf("readMessage() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		want    []*message
+		wantErr bool
+	}{
+		{
+			name: "compressed headers",
+			b: []byte{
+				// Type 0 of timestamp 100.
+				0x04, 0, 0, 100, 0, 0, 1, msgAudio, 1, 0, 0, 0, 'a',
+				// Type 1 of delta 20.
+				0x44, 0, 0, 20, 0, 0, 2, msgVideo, 'b', 'c',
+				// Type 2 of delta 10.
+				0x84, 0, 0, 10, 'd', 'e',
+				// Type 3 repeating the delta.
+				0xC4, 'f', 'g',
+			},
+			want: []*message{
+				{typ: msgAudio, streamID: 1, timestamp: 100, payload: []byte("a")},
+				{typ: msgVideo, streamID: 1, timestamp: 120, payload: []byte("bc")},
+				{typ: msgVideo, streamID: 1, timestamp: 130, payload: []byte("de")},
+				{typ: msgVideo, streamID: 1, timestamp: 140, payload: []byte("fg")},
+			},
+		},
+		{
+			name: "2 bytes chunk stream ID",
+			b:    []byte{0x00, 0x06, 0, 0, 1, 0, 0, 1, msgAudio, 0, 0, 0, 0, 'a'},
+			want: []*message{{typ: msgAudio, timestamp: 1, payload: []byte("a")}},
+		},
+		{
+			name: "3 bytes chunk stream ID",
+			b:    []byte{0x01, 0x06, 0x01, 0, 0, 1, 0, 0, 1, msgAudio, 0, 0, 0, 0, 'a'},
+			want: []*message{{typ: msgAudio, timestamp: 1, payload: []byte("a")}},
+		},
+		{
+			name: "aborted message",
+			b: []byte{
+				// 2 bytes of a 3 bytes message on chunk stream 4 after set chunk size of 2 bytes, aborted by a message
+				// in 2 chunks.
+				0x02, 0, 0, 0, 0, 0, 4, msgSetChunkSize, 0, 0, 0, 0, 0, 0, 0, 2,
+				0x04, 0, 0, 0, 0, 0, 3, msgAudio, 0, 0, 0, 0, 'x', 'x',
+				0x02, 0, 0, 0, 0, 0, 4, msgAbort, 0, 0, 0, 0, 0, 0, 0xC2, 0, 4,
+				0x04, 0, 0, 0, 0, 0, 1, msgAudio, 0, 0, 0, 0, 'a',
+			},
+			want: []*message{{typ: msgAudio, payload: []byte("a")}},
+		},
+		{name: "stream started without full header", b: []byte{0x44, 0, 0, 0, 0, 0, 1, msgAudio, 'a'}, wantErr: true},
+		{
+			name:    "zero chunk size",
+			b:       []byte{0x02, 0, 0, 0, 0, 0, 4, msgSetChunkSize, 0, 0, 0, 0, 0, 0, 0, 0},
+			wantErr: true,
+		},
+		{name: "truncated", b: []byte{0x04, 0, 0, 0, 0, 0, 2, msgAudio, 0, 0, 0, 0, 'a'}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newChunkReader(bytes.NewReader(tt.b))
+			for _, want := range tt.want {
+				got, err := r.readMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("readMessage() = %+v, want %+v", got, want)
+				}
+			}
+			_, err := r.readMessage()
+			if tt.wantErr {
+				if err == nil || err == io.EOF {
+					t.Fatalf("readMessage() error = %v, want an error of malformed chunks", err)
+				}
+			} else if err != io.EOF {
+				t.Fatalf("readMessage() error = %v, want %v", err, io.EOF)
+			}
+		})
+	}
+}
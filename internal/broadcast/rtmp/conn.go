@@ -0,0 +1,359 @@
+package rtmp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+const (
+	handshakeSize = 1536
+	rtmpVersion   = 3
+	// readTimeout is the max time without any message from the encoder.
+	readTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+	// windowAckSize is the window of acknowledgements asked from the encoder, and its peer bandwidth.
+	windowAckSize = 2500000
+	// publishStreamID is the message stream ID of the stream created for publishing, as a connection publishes one.
+	publishStreamID = 1
+)
+
+var errUnpublished = errors.New("encoder unpublished")
+
+// conn is an RTMP connection of an encoder, messages of it are handled by a single goroutine.
+type conn struct {
+	s      *Server
+	nc     net.Conn
+	r      *chunkReader
+	logger zerolog.Logger
+	done   chan struct{}
+
+	wmu sync.Mutex
+	// peerWindow is the window of acknowledgements told by the encoder, acked is the bytes acknowledged.
+	peerWindow, acked uint32
+
+	// Set once publishing.
+	meta       *pb.Meta
+	sess       *session.Session
+	f          *forwarder
+	avc        *avcConfig
+	aac        *aacConfig
+	transcoder *transcoder
+	unpublish  func()
+}
+
+func newConn(s *Server, nc net.Conn) *conn {
+	return &conn{
+		s:      s,
+		nc:     nc,
+		r:      newChunkReader(nc),
+		logger: s.logger.With().Str("remote_addr", nc.RemoteAddr().String()).Logger(),
+		done:   make(chan struct{}),
+	}
+}
+
+// close closes the connection, ending publishing of it.
+func (c *conn) close() {
+	c.nc.Close()
+}
+
+// serve handles the connection until the encoder leaves.
+func (c *conn) serve(ctx context.Context) error {
+	defer close(c.done)
+	defer c.cleanup()
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.close()
+		case <-c.done:
+		}
+	}()
+
+	_ = c.nc.SetDeadline(time.Now().Add(readTimeout))
+	if err := c.handshake(); err != nil {
+		return fmt.Errorf("could not handshake: %w", err)
+	}
+	_ = c.nc.SetDeadline(time.Time{})
+
+	for {
+		_ = c.nc.SetReadDeadline(time.Now().Add(readTimeout))
+		msg, err := c.r.readMessage()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if c.peerWindow > 0 && c.r.read-c.acked >= c.peerWindow {
+			c.acked = c.r.read
+			if err := c.writeControl(msgAck, uint32Bytes(c.acked)); err != nil {
+				return err
+			}
+		}
+
+		switch msg.typ {
+		case msgWindowAckSize:
+			if len(msg.payload) >= 4 {
+				c.peerWindow = binary.BigEndian.Uint32(msg.payload)
+			}
+		case msgCommandAMF0:
+			err = c.command(ctx, msg)
+		case msgVideo:
+			err = c.video(msg)
+		case msgAudio:
+			err = c.audio(msg)
+		default:
+			// Metadata and user control messages are of no use for forwarding.
+		}
+		if errors.Is(err, errUnpublished) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handshake does the simple handshake, see section 5.2 of RTMP specification.
+func (c *conn) handshake() error {
+	c0c1 := make([]byte, 1+handshakeSize)
+	if _, err := io.ReadFull(c.nc, c0c1); err != nil {
+		return err
+	}
+	if c0c1[0] != rtmpVersion {
+		return fmt.Errorf("unsupported RTMP version %d", c0c1[0])
+	}
+	s0s1s2 := make([]byte, 1+2*handshakeSize)
+	s0s1s2[0] = rtmpVersion
+	if _, err := rand.Read(s0s1s2[9 : 1+handshakeSize]); err != nil {
+		return err
+	}
+	copy(s0s1s2[1+handshakeSize:], c0c1[1:]) // S2 echoes C1.
+	if _, err := c.nc.Write(s0s1s2); err != nil {
+		return err
+	}
+	c2 := make([]byte, handshakeSize)
+	_, err := io.ReadFull(c.nc, c2)
+	return err
+}
+
+// command handles an AMF0 command of the encoder.
+func (c *conn) command(ctx context.Context, msg *message) error {
+	values, err := decodeAMF(msg.payload)
+	if err != nil {
+		return fmt.Errorf("could not decode command: %w", err)
+	}
+	if len(values) < 2 {
+		return nil
+	}
+	name, _ := values[0].(string)
+	txn, _ := values[1].(float64)
+	switch name {
+	case "connect":
+		if err := c.writeControl(msgWindowAckSize, uint32Bytes(windowAckSize)); err != nil {
+			return err
+		}
+		if err := c.writeControl(msgSetPeerBandwidth, append(uint32Bytes(windowAckSize), 2)); err != nil {
+			return err
+		}
+		if err := c.writeControl(msgSetChunkSize, uint32Bytes(outChunkSize)); err != nil {
+			return err
+		}
+		return c.write(csidCommand, 0, encodeAMF("_result", txn,
+			amfObj{"fmsVer": "FMS/3,0,1,123", "capabilities": 31},
+			amfObj{
+				"level":          "status",
+				"code":           "NetConnection.Connect.Success",
+				"description":    "Connection succeeded.",
+				"objectEncoding": 0,
+			},
+		))
+	case "createStream":
+		return c.write(csidCommand, 0, encodeAMF("_result", txn, nil, publishStreamID))
+	case "publish":
+		key := ""
+		if len(values) >= 4 {
+			key, _ = values[3].(string)
+		}
+		// Encoders may append query parameters to stream keys.
+		if i := strings.IndexByte(key, '?'); i >= 0 {
+			key = key[:i]
+		}
+		return c.publish(ctx, msg.streamID, key)
+	case "deleteStream", "FCUnpublish":
+		return errUnpublished
+	default:
+		// releaseStream and FCPublish need no reply to publish.
+		return nil
+	}
+}
+
+// publish starts publishing the stream of key, or rejects it if it's not configured.
+func (c *conn) publish(ctx context.Context, streamID uint32, key string) error {
+	if c.meta != nil {
+		return errors.New("published twice")
+	}
+	meta, ok := c.s.streams[key]
+	if !ok {
+		_ = c.onStatus(streamID, "error", "NetStream.Publish.BadName", "Unknown stream key.")
+		return errors.New("rejected encoder of unknown stream key")
+	}
+	c.meta = meta
+	c.logger = c.logger.With().Str("id", meta.Id).Int32("track_source", int32(meta.TrackSource)).Logger()
+	c.unpublish = c.s.publish(c)
+
+	videoTrack, audioTrack, err := webrtcx.CreateLocalTrack(webrtcx.DefaultCodecs())
+	if err != nil {
+		return fmt.Errorf("could not create webRTC local tracks: %w", err)
+	}
+	c.sess = session.New(c.s.sessions.Key(meta), meta, videoTrack, audioTrack)
+	c.f = newForwarder(c.sess)
+	if c.s.config.RTMPTranscoder != "" {
+		if c.transcoder, err = newTranscoder(ctx, c.s.config.RTMPTranscoder); err != nil {
+			c.logger.Err(err).Msg("could not transcode audio, forwarding video only")
+		} else {
+			go func(t *transcoder) {
+				if err := t.read(c.f.audio); err != nil {
+					c.logger.Err(err).Msg("could not forward transcoded audio")
+				}
+			}(c.transcoder)
+		}
+	}
+	c.s.sessions.Add(c.sess)
+	c.logger.Info().Bool("audio", c.transcoder != nil).Msg("encoder publishing")
+	return c.onStatus(streamID, "status", "NetStream.Publish.Start", "Publishing.")
+}
+
+// cleanup stops publishing if the connection published.
+func (c *conn) cleanup() {
+	c.nc.Close()
+	if c.transcoder != nil {
+		if err := c.transcoder.close(); err != nil {
+			c.logger.Debug().Err(err).Msg("transcoder closed")
+		}
+	}
+	if c.sess != nil {
+		c.s.sessions.Remove(c.sess)
+	}
+	if c.unpublish != nil {
+		c.unpublish()
+	}
+}
+
+func (c *conn) video(msg *message) error {
+	if c.f == nil {
+		return nil
+	}
+	tag, err := parseVideoTag(msg.payload)
+	if errors.Is(err, errUnsupportedCodec) {
+		return errors.New("only H264 video is supported")
+	}
+	if err != nil {
+		return err
+	}
+	switch tag.packetType {
+	case avcSequenceHeader:
+		if c.avc, err = parseAVCConfig(tag.data); err != nil {
+			return err
+		}
+		c.f.parameterSets(c.avc)
+	case avcNALU:
+		if c.avc == nil {
+			return nil // Waiting for the sequence header.
+		}
+		nalus, err := splitNALUs(tag.data, c.avc.lengthSize)
+		if err != nil {
+			return err
+		}
+		if len(nalus) == 0 {
+			return nil
+		}
+		// Presentation time in 90kHz, as RTP timestamps of H264.
+		pts := uint32(int64(msg.timestamp)+int64(tag.compositionTime)) * 90
+		return c.f.video(&rtpx.AccessUnit{Timestamp: pts, NALUs: nalus})
+	}
+	return nil
+}
+
+func (c *conn) audio(msg *message) error {
+	if c.transcoder == nil {
+		return nil
+	}
+	tag, err := parseAudioTag(msg.payload)
+	if errors.Is(err, errUnsupportedCodec) {
+		c.logger.Warn().Msg("only AAC audio is supported, dropped audio")
+		c.stopTranscoder()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	switch tag.packetType {
+	case aacSequenceHeader:
+		if c.aac, err = parseAACConfig(tag.data); err != nil {
+			c.logger.Warn().Err(err).Msg("dropped audio")
+			c.stopTranscoder()
+		}
+	case aacRaw:
+		if c.aac == nil {
+			return nil
+		}
+		if err := c.transcoder.write(c.aac.adts(tag.data)); err != nil {
+			c.logger.Err(err).Msg("could not write audio to transcoder, dropped audio")
+			c.stopTranscoder()
+		}
+	}
+	return nil
+}
+
+// stopTranscoder stops transcoding audio, video keeps being forwarded.
+func (c *conn) stopTranscoder() {
+	if err := c.transcoder.close(); err != nil {
+		c.logger.Debug().Err(err).Msg("transcoder closed")
+	}
+	c.transcoder = nil
+}
+
+// onStatus sends an onStatus command of the publishing stream.
+func (c *conn) onStatus(streamID uint32, level, code, description string) error {
+	return c.write(csidStatus, streamID, encodeAMF("onStatus", 0, nil, amfObj{
+		"level":       level,
+		"code":        code,
+		"description": description,
+	}))
+}
+
+// writeControl sends a protocol control message.
+func (c *conn) writeControl(typ uint8, payload []byte) error {
+	return c.writeMessage(csidControl, &message{typ: typ, payload: payload})
+}
+
+// write sends an AMF0 command on message stream streamID.
+func (c *conn) write(csid uint8, streamID uint32, payload []byte) error {
+	return c.writeMessage(csid, &message{typ: msgCommandAMF0, streamID: streamID, payload: payload})
+}
+
+func (c *conn) writeMessage(csid uint8, msg *message) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_ = c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return writeMessage(c.nc, csid, msg)
+}
+
+func uint32Bytes(v uint32) []byte {
+	return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
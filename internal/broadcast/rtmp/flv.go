@@ -0,0 +1,166 @@
+package rtmp
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// FLV tags of RTMP audio and video messages, see section E.4.2 and E.4.3 of FLV specification.
+const (
+	codecAVC  = 7
+	formatAAC = 10
+
+	avcSequenceHeader = 0
+	avcNALU           = 1
+
+	aacSequenceHeader = 0
+	aacRaw            = 1
+)
+
+var errUnsupportedCodec = errors.New("unsupported codec")
+
+// videoTag is the FLV video tag of a video message carrying AVC.
+type videoTag struct {
+	keyframe   bool
+	packetType uint8
+	// compositionTime is PTS - DTS in milliseconds.
+	compositionTime int32
+	data            []byte
+}
+
+func parseVideoTag(b []byte) (*videoTag, error) {
+	if len(b) < 5 {
+		return nil, errors.New("short video tag")
+	}
+	if b[0]&0x0F != codecAVC {
+		return nil, errUnsupportedCodec
+	}
+	cts := int32(uint24(b[2:])<<8) >> 8 // Sign extended.
+	return &videoTag{
+		keyframe:        b[0]>>4 == 1,
+		packetType:      b[1],
+		compositionTime: cts,
+		data:            b[5:],
+	}, nil
+}
+
+// avcConfig is the AVCDecoderConfigurationRecord of ISO/IEC 14496-15 5.2.4.1.
+type avcConfig struct {
+	lengthSize int // Size of NAL unit length prefixes.
+	sps, pps   [][]byte
+}
+
+func parseAVCConfig(b []byte) (*avcConfig, error) {
+	errMalformed := errors.New("malformed AVC decoder configuration")
+	if len(b) < 6 {
+		return nil, errMalformed
+	}
+	c := &avcConfig{lengthSize: int(b[4]&0x03) + 1}
+	p := b[5:]
+	read := func(count int) ([][]byte, error) {
+		var nalus [][]byte
+		for i := 0; i < count; i++ {
+			if len(p) < 2 {
+				return nil, errMalformed
+			}
+			n := int(binary.BigEndian.Uint16(p))
+			if len(p) < 2+n {
+				return nil, errMalformed
+			}
+			nalus = append(nalus, append([]byte(nil), p[2:2+n]...))
+			p = p[2+n:]
+		}
+		return nalus, nil
+	}
+	var err error
+	count := int(p[0] & 0x1F)
+	p = p[1:]
+	if c.sps, err = read(count); err != nil {
+		return nil, err
+	}
+	if len(p) < 1 {
+		return nil, errMalformed
+	}
+	count = int(p[0])
+	p = p[1:]
+	if c.pps, err = read(count); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// splitNALUs splits NAL units of b prefixed by lengths of size bytes.
+func splitNALUs(b []byte, size int) ([][]byte, error) {
+	var nalus [][]byte
+	for len(b) > 0 {
+		if len(b) < size {
+			return nil, errors.New("short NAL unit length")
+		}
+		n := 0
+		for _, v := range b[:size] {
+			n = n<<8 | int(v)
+		}
+		b = b[size:]
+		if n > len(b) {
+			return nil, errors.New("NAL unit exceeds video tag")
+		}
+		if n > 0 {
+			nalus = append(nalus, append([]byte(nil), b[:n]...))
+		}
+		b = b[n:]
+	}
+	return nalus, nil
+}
+
+// audioTag is the FLV audio tag of an audio message carrying AAC.
+type audioTag struct {
+	packetType uint8
+	data       []byte
+}
+
+func parseAudioTag(b []byte) (*audioTag, error) {
+	if len(b) < 2 {
+		return nil, errors.New("short audio tag")
+	}
+	if b[0]>>4 != formatAAC {
+		return nil, errUnsupportedCodec
+	}
+	return &audioTag{packetType: b[1], data: b[2:]}, nil
+}
+
+// aacConfig is the AudioSpecificConfig of ISO/IEC 14496-3 1.6.2.1, of which ADTS headers are made.
+type aacConfig struct {
+	objectType     uint8
+	frequencyIndex uint8
+	channels       uint8
+}
+
+func parseAACConfig(b []byte) (*aacConfig, error) {
+	if len(b) < 2 {
+		return nil, errors.New("short audio specific config")
+	}
+	c := &aacConfig{
+		objectType:     b[0] >> 3,
+		frequencyIndex: (b[0]&0x07)<<1 | b[1]>>7,
+		channels:       (b[1] >> 3) & 0x0F,
+	}
+	// ADTS only carries profiles of object types 1 to 4, e.g. AAC LC is 2.
+	if c.objectType < 1 || c.objectType > 4 || c.frequencyIndex > 12 {
+		return nil, errors.New("unsupported audio specific config")
+	}
+	return c, nil
+}
+
+// adts returns raw AAC frame in ADTS, which the transcoder reads as a stream.
+func (c *aacConfig) adts(frame []byte) []byte {
+	n := 7 + len(frame)
+	b := make([]byte, 7, n)
+	b[0] = 0xFF
+	b[1] = 0xF1 // MPEG-4 without CRC.
+	b[2] = (c.objectType-1)<<6 | c.frequencyIndex<<2 | c.channels>>2
+	b[3] = (c.channels&0x03)<<6 | byte(n>>11)
+	b[4] = byte(n >> 3)
+	b[5] = byte(n&0x07)<<5 | 0x1F
+	b[6] = 0xFC
+	return append(b, frame...)
+}
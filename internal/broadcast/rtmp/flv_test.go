@@ -0,0 +1,146 @@
+package rtmp
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseVideoTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		want    *videoTag
+		wantErr error
+	}{
+		{
+			name: "keyframe",
+			b:    []byte{0x17, avcNALU, 0, 0, 40, 1, 2},
+			want: &videoTag{keyframe: true, packetType: avcNALU, compositionTime: 40, data: []byte{1, 2}},
+		},
+		{
+			name: "negative composition time",
+			b:    []byte{0x27, avcNALU, 0xFF, 0xFF, 0xD8},
+			want: &videoTag{packetType: avcNALU, compositionTime: -40, data: []byte{}},
+		},
+		{name: "HEVC", b: []byte{0x1C, 0, 0, 0, 0}, wantErr: errUnsupportedCodec},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseVideoTag(tt.b)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("parseVideoTag() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseVideoTag() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+	if _, err := parseVideoTag([]byte{0x17, 0, 0, 0}); err == nil {
+		t.Fatal("parseVideoTag() of short tag error = nil")
+	}
+}
+
+func TestParseAVCConfig(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xC0, 0x1F}
+	pps := []byte{0x68, 0xCE}
+	config := append([]byte{1, 0x42, 0xC0, 0x1F, 0xFF, 0xE1, 0, byte(len(sps))}, sps...)
+	config = append(config, 1, 0, byte(len(pps)))
+	config = append(config, pps...)
+
+	got, err := parseAVCConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&avcConfig{lengthSize: 4, sps: [][]byte{sps}, pps: [][]byte{pps}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseAVCConfig() = %+v, want %+v", got, want)
+	}
+
+	for n := 0; n < len(config); n++ {
+		if _, err := parseAVCConfig(config[:n]); err == nil {
+			t.Fatalf("parseAVCConfig() of %d bytes error = nil", n)
+		}
+	}
+}
+
+func TestSplitNALUs(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		size    int
+		want    [][]byte
+		wantErr bool
+	}{
+		{name: "4 bytes lengths", b: []byte{0, 0, 0, 2, 1, 2, 0, 0, 0, 1, 3}, size: 4, want: [][]byte{{1, 2}, {3}}},
+		{name: "2 bytes lengths", b: []byte{0, 1, 1, 0, 1, 2}, size: 2, want: [][]byte{{1}, {2}}},
+		{name: "empty NAL unit skipped", b: []byte{0, 0, 0, 1, 1}, size: 2, want: [][]byte{{1}}},
+		{name: "NAL unit exceeding tag", b: []byte{0, 0, 0, 3, 1, 2}, size: 4, wantErr: true},
+		{name: "short length", b: []byte{0, 0, 0, 1, 1, 0}, size: 4, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitNALUs(tt.b, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitNALUs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitNALUs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAudioTag(t *testing.T) {
+	got, err := parseAudioTag([]byte{0xAF, aacRaw, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&audioTag{packetType: aacRaw, data: []byte{1, 2}}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("parseAudioTag() = %+v, want %+v", got, want)
+	}
+	// MP3.
+	if _, err := parseAudioTag([]byte{0x2F, 0}); !errors.Is(err, errUnsupportedCodec) {
+		t.Fatalf("parseAudioTag() error = %v, want %v", err, errUnsupportedCodec)
+	}
+	if _, err := parseAudioTag([]byte{0xAF}); err == nil {
+		t.Fatal("parseAudioTag() of short tag error = nil")
+	}
+}
+
+func TestAACConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       []byte
+		want    *aacConfig
+		wantErr bool
+	}{
+		// AAC LC, 44100 Hz, stereo.
+		{name: "AAC LC", b: []byte{0x12, 0x10}, want: &aacConfig{objectType: 2, frequencyIndex: 4, channels: 2}},
+		// AAC LC, 48000 Hz, mono.
+		{name: "mono", b: []byte{0x11, 0x88}, want: &aacConfig{objectType: 2, frequencyIndex: 3, channels: 1}},
+		// HE-AAC is object type 5, which ADTS can't carry.
+		{name: "HE-AAC", b: []byte{0x2B, 0x92}, wantErr: true},
+		{name: "escaped frequency", b: []byte{0x17, 0x90}, wantErr: true},
+		{name: "short", b: []byte{0x12}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAACConfig(tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAACConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parseAACConfig() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	c := &aacConfig{objectType: 2, frequencyIndex: 4, channels: 2}
+	frame := bytes.Repeat([]byte{0xAB}, 300)
+	// A 307 bytes frame of AAC LC, 44100 Hz, stereo.
+	want := append([]byte{0xFF, 0xF1, 0x50, 0x80, 0x26, 0x7F, 0xFC}, frame...)
+	if got := c.adts(frame); !bytes.Equal(got, want) {
+		t.Fatalf("adts() header = % x, want % x", got[:7], want[:7])
+	}
+}
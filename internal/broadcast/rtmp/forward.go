@@ -0,0 +1,95 @@
+package rtmp
+
+import (
+	"github.com/pion/randutil"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	// mtu is max RTP payload size of packetized video, so packets fit in UDP of subscriber peer connections.
+	mtu = 1200
+	// Payload types of packetized media, tracks rewrite them for each subscriber.
+	videoPayloadType = 96
+	audioPayloadType = 111
+	// opusFrameSamples is RTP timestamp increment of an Opus frame, 20ms in 48kHz.
+	opusFrameSamples = 960
+)
+
+// forwarder packetizes video and audio of an encoder into RTP to a session, as edge publisher sends it.
+// SPS and PPS of the sequence header are put ahead of keyframes, so subscribers joining at any keyframe
+// can decode it.
+type forwarder struct {
+	sess       *session.Session
+	packetizer rtpx.H264Packetizer
+	videoSSRC  uint32
+	sps, pps   []byte
+
+	audioSSRC      uint32
+	audioSeq       uint16
+	audioTimestamp uint32
+}
+
+func newForwarder(sess *session.Session) *forwarder {
+	random := randutil.NewMathRandomGenerator()
+	return &forwarder{
+		sess: sess,
+		packetizer: rtpx.H264Packetizer{
+			MTU:            mtu,
+			SequenceNumber: uint16(random.Uint32()),
+		},
+		videoSSRC:      random.Uint32(),
+		audioSSRC:      random.Uint32(),
+		audioSeq:       uint16(random.Uint32()),
+		audioTimestamp: random.Uint32(),
+	}
+}
+
+// parameterSets keeps SPS and PPS of a sequence header.
+func (f *forwarder) parameterSets(config *avcConfig) {
+	if len(config.sps) > 0 {
+		f.sps = config.sps[0]
+	}
+	if len(config.pps) > 0 {
+		f.pps = config.pps[0]
+	}
+}
+
+func (f *forwarder) video(au *rtpx.AccessUnit) error {
+	f.sess.Clock.Observe(au.Timestamp)
+	inBand := false
+	for _, nalu := range au.NALUs {
+		if nalu[0]&0x1F == rtpx.NALUTypeSPS {
+			inBand = true
+		}
+	}
+	if au.Keyframe() && !inBand && f.sps != nil && f.pps != nil {
+		au.NALUs = append([][]byte{f.sps, f.pps}, au.NALUs...)
+	}
+
+	for _, packet := range f.packetizer.Packetize(au) {
+		b := packet.Marshal(videoPayloadType, f.videoSSRC)
+		f.sess.Bitrate.Add(len(b))
+		f.sess.Taps.Write(webrtc.RTPCodecTypeVideo, b)
+		if err := f.sess.VideoTrack.Forward(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// audio forwards an Opus packet of the transcoder.
+func (f *forwarder) audio(packet []byte) error {
+	b := rtpx.Packet{
+		SequenceNumber: f.audioSeq,
+		Timestamp:      f.audioTimestamp,
+		Payload:        packet,
+	}.Marshal(audioPayloadType, f.audioSSRC)
+	f.audioSeq++
+	f.audioTimestamp += opusFrameSamples
+	f.sess.Bitrate.Add(len(b))
+	f.sess.Taps.Write(webrtc.RTPCodecTypeAudio, b)
+	return f.sess.AudioTrack.Forward(b)
+}
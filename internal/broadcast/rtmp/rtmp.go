@@ -0,0 +1,130 @@
+// Package rtmp ingests RTMP from third-party encoders, e.g. OBS or hardware encoders of partners, and registers
+// them as sessions like edge publishers, so subscribers watch them as any edge stream. Each stream key is
+// configured as a track source of a machine, and encoders publish to "rtmp://host:port/live/<stream key>".
+//
+// H264 video is remuxed into RTP as is. AAC audio is transcoded to Opus by an ffmpeg process, as browsers
+// don't decode AAC over WebRTC, or dropped if no transcoder is configured.
+// See: https://rtmp.veriskope.com/docs/spec/
+package rtmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// Server accepts RTMP encoders publishing configured stream keys.
+type Server struct {
+	logger   zerolog.Logger
+	sessions *session.SessionManager
+	config   cfg.RTMPConfigOptions
+	// streams are track sources of machines by stream key.
+	streams map[string]*pb.Meta
+	ln      net.Listener
+
+	mu sync.Mutex
+	// publishing are connections publishing sessions by session key, a new encoder of a stream replaces the old one.
+	publishing map[session.Key]*conn
+}
+
+// New returns a new Server listening on RTMPPort of config.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.RTMPConfigOptions) (*Server, error) {
+	s := &Server{
+		logger:     loglevel.Default.Component(logger, "RTMP"),
+		sessions:   sessions,
+		config:     config,
+		streams:    make(map[string]*pb.Meta, len(config.RTMPStreams)),
+		publishing: make(map[session.Key]*conn),
+	}
+	for _, v := range config.RTMPStreams {
+		key, meta, err := parseStream(v)
+		if err != nil {
+			// Stream keys are secrets, so they are not told.
+			return nil, fmt.Errorf("invalid RTMP stream: %w", err)
+		}
+		s.streams[key] = meta
+	}
+	if config.RTMPTranscoder != "" {
+		if _, err := exec.LookPath(config.RTMPTranscoder); err != nil {
+			return nil, fmt.Errorf("could not find transcoder: %w", err)
+		}
+	}
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(config.RTMPPort))
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+	s.ln = ln
+	return s, nil
+}
+
+// parseStream parses a stream in form of "stream_key=id:track_source".
+func parseStream(s string) (string, *pb.Meta, error) {
+	i := strings.IndexByte(s, '=')
+	j := strings.LastIndexByte(s, ':')
+	if i <= 0 || j <= i+1 {
+		return "", nil, errors.New("must be in form of stream_key=id:track_source")
+	}
+	source, err := session.ParseTrackSource(s[j+1:])
+	if err != nil {
+		return "", nil, err
+	}
+	return s[:i], &pb.Meta{Id: s[i+1 : j], TrackSource: source}, nil
+}
+
+// Run serves encoders until ctx is done.
+func (s *Server) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		s.ln.Close()
+	}()
+
+	s.logger.Info().Str("address", s.ln.Addr().String()).Int("streams", len(s.streams)).Msg("listening RTMP")
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				s.logger.Err(err).Msg("could not accept RTMP connection")
+			}
+			return
+		}
+		c := newConn(s, nc)
+		go func() {
+			err := c.serve(ctx)
+			c.logger.Info().Err(err).Msg("RTMP encoder left")
+		}()
+	}
+}
+
+// publish registers c as the publisher of its stream, replacing the one publishing it if any.
+// The returned function unregisters it.
+func (s *Server) publish(c *conn) (unpublish func()) {
+	key := s.sessions.Key(c.meta)
+	s.mu.Lock()
+	old := s.publishing[key]
+	s.publishing[key] = c
+	s.mu.Unlock()
+	if old != nil {
+		old.logger.Info().Msg("replaced by a new encoder of the stream")
+		old.close()
+		<-old.done
+	}
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.publishing[key] == c {
+			delete(s.publishing, key)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// transcoder transcodes AAC in ADTS to Opus by an ffmpeg process, as browsers don't decode AAC over WebRTC.
+// Opus packets are read from Ogg output of it, each of which is a 20ms frame.
+type transcoder struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+}
+
+func newTranscoder(ctx context.Context, path string) (*transcoder, error) {
+	t := &transcoder{}
+	t.cmd = exec.CommandContext(ctx, path,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "aac", "-i", "pipe:0",
+		"-vn", "-c:a", "libopus", "-b:a", "64k", "-ar", "48000", "-ac", "2",
+		"-frame_duration", "20", "-application", "lowdelay",
+		"-flush_packets", "1", "-f", "ogg", "pipe:1",
+	)
+	var err error
+	if t.stdin, err = t.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if t.stdout, err = t.cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	t.cmd.Stderr = &t.stderr
+	if err := t.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("could not start transcoder: %w", err)
+	}
+	return t, nil
+}
+
+// write writes an AAC frame in ADTS.
+func (t *transcoder) write(frame []byte) error {
+	_, err := t.stdin.Write(frame)
+	return err
+}
+
+// read reads Opus packets until the transcoder exits, calling onPacket with each of them.
+func (t *transcoder) read(onPacket func(packet []byte) error) error {
+	r := bufio.NewReader(t.stdout)
+	var packet []byte
+	headers := 0 // OpusHead and OpusTags packets lead the stream.
+	for {
+		segments, err := readOggPage(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		for _, s := range segments {
+			packet = append(packet, s.data...)
+			if !s.complete {
+				continue
+			}
+			if headers < 2 {
+				headers++
+			} else if err := onPacket(packet); err != nil {
+				return err
+			}
+			packet = nil
+		}
+	}
+}
+
+// close closes the transcoder and waits for it to exit.
+func (t *transcoder) close() error {
+	_ = t.stdin.Close()
+	if err := t.cmd.Wait(); err != nil {
+		return fmt.Errorf("transcoder exited: %w: %s", err, strings.TrimSpace(t.stderr.String()))
+	}
+	return nil
+}
+
+// oggSegment is data of lacing values of an Ogg page, complete if it ends a packet.
+type oggSegment struct {
+	data     []byte
+	complete bool
+}
+
+// readOggPage reads a page and returns its packet segments, see RFC 3533 section 6.
+func readOggPage(r *bufio.Reader) ([]oggSegment, error) {
+	var header [27]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "OggS" {
+		return nil, errors.New("lost Ogg page sync")
+	}
+	lacing := make([]byte, header[26])
+	if _, err := io.ReadFull(r, lacing); err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, v := range lacing {
+		size += int(v)
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	var segments []oggSegment
+	start, n := 0, 0
+	for _, v := range lacing {
+		n += int(v)
+		if v < 255 {
+			segments = append(segments, oggSegment{data: body[start:n], complete: true})
+			start = n
+		}
+	}
+	if start < n {
+		segments = append(segments, oggSegment{data: body[start:n]})
+	}
+	return segments, nil
+}
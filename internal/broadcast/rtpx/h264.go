@@ -0,0 +1,320 @@
+package rtpx
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// H264 NAL unit types, see ITU-T H.264 table 7-1 and RFC 6184.
+const (
+	NALUTypeIDR = 5
+	NALUTypeSPS = 7
+	NALUTypePPS = 8
+
+	naluTypeSTAPA = 24
+	naluTypeFUA   = 28
+)
+
+// ErrInvalidSPS is returned if an SPS can't be parsed.
+var ErrInvalidSPS = errors.New("invalid H264 SPS")
+
+// AccessUnit is NAL units of a video frame.
+type AccessUnit struct {
+	Timestamp uint32
+	NALUs     [][]byte
+}
+
+// Keyframe reports whether the access unit is an IDR picture.
+func (a *AccessUnit) Keyframe() bool {
+	for _, nalu := range a.NALUs {
+		if nalu[0]&0x1F == NALUTypeIDR {
+			return true
+		}
+	}
+	return false
+}
+
+// AVCC returns NAL units prefixed by 4 bytes length as Matroska and MP4 store them.
+func (a *AccessUnit) AVCC() []byte {
+	var b []byte
+	for _, nalu := range a.NALUs {
+		b = append(b, byte(len(nalu)>>24), byte(len(nalu)>>16), byte(len(nalu)>>8), byte(len(nalu)))
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+// H264Depacketizer assembles access units from RTP packets of H264 payload format, see RFC 6184.
+// Fragmented NAL units missing any packet are dropped, and decoders conceal the rest of the frame.
+type H264Depacketizer struct {
+	started bool
+	seq     uint16
+	au      *AccessUnit
+	fu      []byte // Fragmented NAL unit being assembled, nil if none or a fragment is lost.
+}
+
+// Push pushes an RTP packet, and returns an access unit once it's done.
+func (d *H264Depacketizer) Push(p Packet) *AccessUnit {
+	lost := d.started && p.SequenceNumber != d.seq+1
+	d.started, d.seq = true, p.SequenceNumber
+
+	var done *AccessUnit
+	if d.au != nil && d.au.Timestamp != p.Timestamp {
+		done, d.au = d.au, nil
+	}
+	if d.au == nil {
+		d.au = &AccessUnit{Timestamp: p.Timestamp}
+	}
+	if lost {
+		d.fu = nil
+	}
+
+	payload := p.Payload
+	if len(payload) == 0 {
+		return done
+	}
+	switch payload[0] & 0x1F {
+	case naluTypeSTAPA:
+		for b := payload[1:]; len(b) > 2; {
+			size := int(binary.BigEndian.Uint16(b))
+			if size == 0 || len(b) < 2+size {
+				break
+			}
+			d.add(b[2 : 2+size])
+			b = b[2+size:]
+		}
+	case naluTypeFUA:
+		if len(payload) < 2 {
+			break
+		}
+		indicator, header := payload[0], payload[1]
+		if header&0x80 != 0 { // Start.
+			d.fu = []byte{indicator&0xE0 | header&0x1F}
+		}
+		if d.fu == nil {
+			break
+		}
+		d.fu = append(d.fu, payload[2:]...)
+		if header&0x40 != 0 { // End.
+			d.add(d.fu)
+			d.fu = nil
+		}
+	default:
+		d.add(payload)
+	}
+
+	// The marker ends the access unit. If the previous one is done by this packet too, as its last packet
+	// is lost, this one is done by the next packet instead.
+	if p.Marker && done == nil {
+		done, d.au = d.au, nil
+	}
+	if done == nil || len(done.NALUs) == 0 {
+		return nil
+	}
+	return done
+}
+
+func (d *H264Depacketizer) add(nalu []byte) {
+	if len(nalu) == 0 {
+		return
+	}
+	d.au.NALUs = append(d.au.NALUs, append([]byte(nil), nalu...))
+}
+
+// H264Packetizer packetizes access units into RTP packets of H264 payload format, see RFC 6184.
+// NAL units larger than MTU are fragmented into FU-A packets.
+type H264Packetizer struct {
+	MTU            int // Max payload size.
+	SequenceNumber uint16
+}
+
+// Packetize returns packets of au, the last one is marked.
+func (p *H264Packetizer) Packetize(au *AccessUnit) []Packet {
+	var packets []Packet
+	add := func(payload []byte) {
+		packets = append(packets, Packet{
+			SequenceNumber: p.SequenceNumber,
+			Timestamp:      au.Timestamp,
+			Payload:        payload,
+		})
+		p.SequenceNumber++
+	}
+	for _, nalu := range au.NALUs {
+		if len(nalu) <= p.MTU {
+			add(nalu)
+			continue
+		}
+		indicator := nalu[0]&0xE0 | naluTypeFUA
+		payload := nalu[1:]
+		for start := true; len(payload) > 0; start = false {
+			header := nalu[0] & 0x1F
+			if start {
+				header |= 0x80
+			}
+			n := p.MTU - 2
+			if n >= len(payload) {
+				n = len(payload)
+				header |= 0x40 // End.
+			}
+			add(append([]byte{indicator, header}, payload[:n]...))
+			payload = payload[n:]
+		}
+	}
+	if len(packets) > 0 {
+		packets[len(packets)-1].Marker = true
+	}
+	return packets
+}
+
+// SPSResolution returns picture width and height of an SPS NAL unit, see ITU-T H.264 7.3.2.1.1.
+func SPSResolution(sps []byte) (width, height int, err error) {
+	if len(sps) < 4 {
+		return 0, 0, ErrInvalidSPS
+	}
+	r := &bitReader{b: unescapeRBSP(sps[1:])}
+	profile := r.bits(8)
+	r.bits(16) // Constraint flags and level.
+	r.ue()     // seq_parameter_set_id
+
+	chromaFormat := uint32(1)
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		chromaFormat = r.ue()
+		if chromaFormat == 3 {
+			r.bits(1) // separate_colour_plane_flag
+		}
+		r.ue()    // bit_depth_luma_minus8
+		r.ue()    // bit_depth_chroma_minus8
+		r.bits(1) // qpprime_y_zero_transform_bypass_flag
+		// seq_scaling_matrix_present_flag
+		if r.bits(1) == 1 {
+			lists := 8
+			if chromaFormat == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				if r.bits(1) == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := int32(8), int32(8)
+				for j := 0; j < size; j++ {
+					if next != 0 {
+						next = (last + r.se() + 256) % 256
+					}
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	r.ue() // log2_max_frame_num_minus4
+	// pic_order_cnt_type
+	switch r.ue() {
+	case 0:
+		r.ue() // log2_max_pic_order_cnt_lsb_minus4
+	case 1:
+		r.bits(1) // delta_pic_order_always_zero_flag
+		r.se()    // offset_for_non_ref_pic
+		r.se()    // offset_for_top_to_bottom_field
+		for i := r.ue(); i > 0 && !r.overflow; i-- {
+			r.se()
+		}
+	}
+	r.ue()    // max_num_ref_frames
+	r.bits(1) // gaps_in_frame_num_value_allowed_flag
+	widthMBs := int(r.ue()) + 1
+	heightMapUnits := int(r.ue()) + 1
+	frameMBsOnly := int(r.bits(1))
+	if frameMBsOnly == 0 {
+		r.bits(1) // mb_adaptive_frame_field_flag
+	}
+	r.bits(1) // direct_8x8_inference_flag
+
+	width = widthMBs * 16
+	height = (2 - frameMBsOnly) * heightMapUnits * 16
+	// frame_cropping_flag
+	if r.bits(1) == 1 {
+		left, right, top, bottom := int(r.ue()), int(r.ue()), int(r.ue()), int(r.ue())
+		cropX, cropY := 1, 2-frameMBsOnly
+		switch chromaFormat {
+		case 1:
+			cropX, cropY = 2, 2*(2-frameMBsOnly)
+		case 2:
+			cropX = 2
+		}
+		width -= cropX * (left + right)
+		height -= cropY * (top + bottom)
+	}
+	if r.overflow || width <= 0 || height <= 0 {
+		return 0, 0, ErrInvalidSPS
+	}
+	return width, height, nil
+}
+
+// unescapeRBSP removes emulation prevention bytes of a NAL unit.
+func unescapeRBSP(b []byte) []byte {
+	rbsp := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, c)
+	}
+	return rbsp
+}
+
+// bitReader reads bits and Exp-Golomb codes MSB first. Reading past the end yields zeros and sets overflow.
+type bitReader struct {
+	b        []byte
+	pos      int
+	overflow bool
+}
+
+func (r *bitReader) bits(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if r.pos >= len(r.b)*8 {
+			r.overflow = true
+			continue
+		}
+		v |= uint32(r.b[r.pos/8]>>(7-r.pos%8)) & 1
+		r.pos++
+	}
+	return v
+}
+
+// ue reads an unsigned Exp-Golomb code.
+func (r *bitReader) ue() uint32 {
+	zeros := 0
+	for r.bits(1) == 0 {
+		if r.overflow || zeros >= 31 {
+			r.overflow = true
+			return 0
+		}
+		zeros++
+	}
+	return 1<<zeros - 1 + r.bits(zeros)
+}
+
+// se reads a signed Exp-Golomb code.
+func (r *bitReader) se() int32 {
+	v := r.ue()
+	if v%2 == 1 {
+		return int32(v/2 + 1)
+	}
+	return -int32(v / 2)
+}
@@ -0,0 +1,170 @@
+// Package rtpx parses, depacketizes and packetizes RTP packets, for remuxing streams in process,
+// e.g. recording, HLS and RTSP ingestion.
+package rtpx
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Clock rates of RTP timestamps of H264 and Opus, see RFC 6184 and RFC 7587.
+const (
+	VideoClockRate = 90000
+	AudioClockRate = 48000
+)
+
+// Packet is a parsed RTP packet, see RFC 3550. Payload refers to the raw packet.
+type Packet struct {
+	Marker         bool
+	SequenceNumber uint16
+	Timestamp      uint32
+	Payload        []byte
+}
+
+// Parse parses an RTP packet, and reports whether it's valid.
+func Parse(b []byte) (Packet, bool) {
+	if len(b) < 12 || b[0]>>6 != 2 {
+		return Packet{}, false
+	}
+	offset := 12 + 4*int(b[0]&0x0F)
+	if b[0]&0x10 != 0 {
+		if len(b) < offset+4 {
+			return Packet{}, false
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(b[offset+2:offset+4]))
+	}
+	end := len(b)
+	if b[0]&0x20 != 0 {
+		end -= int(b[end-1])
+	}
+	if offset > end {
+		return Packet{}, false
+	}
+	return Packet{
+		Marker:         b[1]&0x80 != 0,
+		SequenceNumber: binary.BigEndian.Uint16(b[2:4]),
+		Timestamp:      binary.BigEndian.Uint32(b[4:8]),
+		Payload:        b[offset:end],
+	}, true
+}
+
+// Marshal returns the RTP packet of payload type and SSRC without CSRC nor extension.
+func (p Packet) Marshal(payloadType uint8, ssrc uint32) []byte {
+	b := make([]byte, 12, 12+len(p.Payload))
+	b[0] = 2 << 6
+	b[1] = payloadType & 0x7F
+	if p.Marker {
+		b[1] |= 0x80
+	}
+	binary.BigEndian.PutUint16(b[2:4], p.SequenceNumber)
+	binary.BigEndian.PutUint32(b[4:8], p.Timestamp)
+	binary.BigEndian.PutUint32(b[8:12], ssrc)
+	return append(b, p.Payload...)
+}
+
+// Timeline maps RTP timestamps of a track to time since a start shared by tracks of a session.
+// The first packet is pinned to its arrival time, and the rest follow RTP timestamps, so that tracks
+// are roughly in sync without RTCP sender reports.
+type Timeline struct {
+	started  bool
+	last     uint32
+	extended int64         // Unwrapped RTP timestamp since the first packet.
+	offset   time.Duration // Arrival of the first packet since start.
+}
+
+// At returns time since start of RTP timestamp of clockRate.
+func (t *Timeline) At(timestamp uint32, clockRate int64, start time.Time) time.Duration {
+	if !t.started {
+		t.started, t.last = true, timestamp
+		t.offset = time.Since(start)
+	}
+	t.extended += int64(int32(timestamp - t.last))
+	t.last = timestamp
+	return t.offset + time.Duration(t.extended*int64(time.Second)/clockRate)
+}
+
+// Extension returns the RTP header extension element of id in one-byte or two-byte header form,
+// see RFC 8285, and reports whether it's found.
+func Extension(b []byte, id uint8) ([]byte, bool) {
+	if len(b) < 12 || b[0]>>6 != 2 || b[0]&0x10 == 0 {
+		return nil, false
+	}
+	offset := 12 + 4*int(b[0]&0x0F)
+	if len(b) < offset+4 {
+		return nil, false
+	}
+	profile := binary.BigEndian.Uint16(b[offset : offset+2])
+	end := offset + 4 + 4*int(binary.BigEndian.Uint16(b[offset+2:offset+4]))
+	if len(b) < end {
+		return nil, false
+	}
+	twoByte := profile&0xFFF0 == 0x1000
+	if profile != 0xBEDE && !twoByte {
+		return nil, false
+	}
+	for i := offset + 4; i < end; {
+		if b[i] == 0 { // Padding.
+			i++
+			continue
+		}
+		var elemID uint8
+		var length int
+		if twoByte {
+			if i+2 > end {
+				return nil, false
+			}
+			elemID, length = b[i], int(b[i+1])
+			i += 2
+		} else {
+			elemID, length = b[i]>>4, int(b[i]&0x0F)+1
+			if elemID == 15 { // Reserved, the rest must be ignored.
+				return nil, false
+			}
+			i++
+		}
+		if i+length > end {
+			return nil, false
+		}
+		if elemID == id {
+			return b[i : i+length], true
+		}
+		i += length
+	}
+	return nil, false
+}
+
+// ntpEpochOffset is seconds from NTP epoch 1900 to Unix epoch 1970.
+const ntpEpochOffset = 2208988800
+
+// AbsCaptureTime returns capture time of the abs-capture-time extension element ext, which is a 64-bit NTP timestamp
+// of the sender clock, see http://www.webrtc.org/experiments/rtp-hdrext/abs-capture-time.
+func AbsCaptureTime(ext []byte) (time.Time, bool) {
+	if len(ext) != 8 && len(ext) != 16 {
+		return time.Time{}, false
+	}
+	ntp := binary.BigEndian.Uint64(ext[:8])
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanos := int64((ntp & 0xFFFFFFFF) * uint64(time.Second) >> 32)
+	return time.Unix(seconds, nanos), true
+}
+
+// AbsSendTime returns send time of the abs-send-time extension element ext, which is a 24-bit 6.18 fixed point
+// of NTP seconds wrapping every 64 seconds, see http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time.
+// The time is resolved as the nearest to receivedAt.
+func AbsSendTime(ext []byte, receivedAt time.Time) (time.Time, bool) {
+	if len(ext) != 3 {
+		return time.Time{}, false
+	}
+	const wrap = 64 * time.Second
+	sent := time.Duration(uint32(ext[0])<<16|uint32(ext[1])<<8|uint32(ext[2])) * time.Second >> 18
+	// Position of receivedAt in the 64-second period of NTP time.
+	received := time.Duration((receivedAt.UnixNano() + ntpEpochOffset*int64(time.Second)) % int64(wrap))
+	diff := received - sent
+	switch {
+	case diff > wrap/2:
+		diff -= wrap
+	case diff < -wrap/2:
+		diff += wrap
+	}
+	return receivedAt.Add(-diff), true
+}
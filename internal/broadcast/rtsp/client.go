@@ -0,0 +1,306 @@
+package rtsp
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5" //nolint:gosec // Digest authentication of RTSP is MD5 by RFC 2617.
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPort      = "554"
+	dialTimeout      = 5 * time.Second
+	requestTimeout   = 10 * time.Second
+	readTimeout      = 10 * time.Second // Max time without any frame once playing.
+	defaultKeepAlive = 30 * time.Second
+	userAgent        = "skywalker"
+)
+
+// errUnauthorized is returned if the camera rejects credentials.
+var errUnauthorized = errors.New("unauthorized")
+
+// response is an RTSP response.
+type response struct {
+	status int
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// client is an RTSP client receiving RTP interleaved in the TCP connection, see RFC 2326 10.12.
+// Requests are made one at a time before play, then frames are read by a single reader while keep-alive
+// requests are written concurrently.
+type client struct {
+	url  *url.URL // Request URL without credentials.
+	user *url.Userinfo
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu       sync.Mutex
+	cseq      int
+	session   string
+	keepAlive time.Duration
+	authorize func(method, uri string) string // Returns Authorization header, nil until challenged.
+}
+
+func dial(ctx context.Context, rawURL string) (*client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse RTSP URL: %w", err)
+	}
+	if u.Scheme != "rtsp" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	d := net.Dialer{Timeout: dialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	user := u.User
+	u.User = nil
+	return &client{
+		url:       u,
+		user:      user,
+		conn:      conn,
+		r:         bufio.NewReader(conn),
+		keepAlive: defaultKeepAlive,
+	}, nil
+}
+
+func (c *client) close() error {
+	return c.conn.Close()
+}
+
+// do makes a request and reads its response, retrying once with credentials if challenged.
+// It must not be called once frames are being read.
+func (c *client) do(method, uri string, header map[string]string) (*response, error) {
+	for attempt := 0; ; attempt++ {
+		_ = c.conn.SetDeadline(time.Now().Add(requestTimeout))
+		if err := c.write(method, uri, header); err != nil {
+			return nil, err
+		}
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		_ = c.conn.SetDeadline(time.Time{})
+
+		if resp.status == 401 && attempt == 0 && c.user != nil {
+			if err := c.challenge(resp.header.Get("WWW-Authenticate")); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		switch {
+		case resp.status == 401:
+			return nil, errUnauthorized
+		case resp.status != 200:
+			return nil, fmt.Errorf("%s replied status %d", method, resp.status)
+		}
+		return resp, nil
+	}
+}
+
+func (c *client) write(method, uri string, header map[string]string) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.cseq++
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: %s\r\n", method, uri, c.cseq, userAgent)
+	if c.session != "" {
+		fmt.Fprintf(&b, "Session: %s\r\n", c.session)
+	}
+	if c.authorize != nil {
+		fmt.Fprintf(&b, "Authorization: %s\r\n", c.authorize(method, uri))
+	}
+	for k, v := range header {
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	b.WriteString("\r\n")
+	_, err := io.WriteString(c.conn, b.String())
+	return err
+}
+
+func (c *client) readResponse() (*response, error) {
+	tp := textproto.NewReader(c.r)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return nil, fmt.Errorf("malformed status line %q", line)
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed status line %q", line)
+	}
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	resp := &response{status: status, header: header}
+	if v := header.Get("Content-Length"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("malformed Content-Length %q", v)
+		}
+		resp.body = make([]byte, n)
+		if _, err := io.ReadFull(c.r, resp.body); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// challenge sets up authorization of Basic or Digest challenge, see RFC 2617.
+func (c *client) challenge(header string) error {
+	username := c.user.Username()
+	password, _ := c.user.Password()
+	scheme, params := parseChallenge(header)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+		c.authorize = func(_, _ string) string { return auth }
+	case "digest":
+		realm, nonce := params["realm"], params["nonce"]
+		ha1 := md5Hex(username + ":" + realm + ":" + password)
+		c.authorize = func(method, uri string) string {
+			ha2 := md5Hex(method + ":" + uri)
+			return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+				username, realm, nonce, uri, md5Hex(ha1+":"+nonce+":"+ha2))
+		}
+	default:
+		return fmt.Errorf("unsupported authentication %q", scheme)
+	}
+	return nil
+}
+
+// describe returns the SDP of the stream and base URL of its media control URLs.
+func (c *client) describe() (*description, error) {
+	resp, err := c.do("DESCRIBE", c.url.String(), map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return nil, err
+	}
+	base := resp.header.Get("Content-Base")
+	if base == "" {
+		base = c.url.String()
+	}
+	return parseSDP(resp.body, base)
+}
+
+// setup sets up interleaved RTP of a media on channel and channel+1 for RTCP.
+func (c *client) setup(control string, channel int) error {
+	resp, err := c.do("SETUP", control, map[string]string{
+		"Transport": fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", channel, channel+1),
+	})
+	if err != nil {
+		return err
+	}
+	// Session header may carry timeout, e.g. "12345678;timeout=60".
+	session := resp.header.Get("Session")
+	if i := strings.Index(session, ";"); i >= 0 {
+		for _, param := range strings.Split(session[i+1:], ";") {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) != 2 || kv[0] != "timeout" {
+				continue
+			}
+			if timeout, err := strconv.Atoi(kv[1]); err == nil && timeout > 0 {
+				c.keepAlive = time.Duration(timeout) * time.Second / 2
+			}
+		}
+		session = session[:i]
+	}
+	if session == "" {
+		return errors.New("no session in SETUP response")
+	}
+	c.session = session
+	return nil
+}
+
+// play plays media set up, control is the aggregate control URL of the stream.
+func (c *client) play(control string) error {
+	_, err := c.do("PLAY", control, map[string]string{"Range": "npt=0.000-"})
+	return err
+}
+
+// readFrame returns the next interleaved frame, responses of keep-alive requests are skipped.
+func (c *client) readFrame() (channel int, data []byte, err error) {
+	for {
+		_ = c.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		b, err := c.r.Peek(1)
+		if err != nil {
+			return 0, nil, err
+		}
+		if b[0] != '$' {
+			if _, err := c.readResponse(); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		var header [4]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return 0, nil, err
+		}
+		data := make([]byte, int(header[2])<<8|int(header[3]))
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return 0, nil, err
+		}
+		return int(header[1]), data, nil
+	}
+}
+
+// keepAlives refreshes the session periodically until ctx is done, as servers time out sessions
+// without requests even if they're playing.
+func (c *client) keepAlives(ctx context.Context) {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.write("OPTIONS", c.url.String(), nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func parseChallenge(header string) (scheme string, params map[string]string) {
+	params = make(map[string]string)
+	header = strings.TrimSpace(header)
+	i := strings.Index(header, " ")
+	if i < 0 {
+		return header, params
+	}
+	scheme = header[:i]
+	for _, param := range strings.Split(header[i+1:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return scheme, params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s)) //nolint:gosec
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,96 @@
+package rtsp
+
+import (
+	"github.com/pion/randutil"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	// mtu is max RTP payload size of repacketized video, so packets fit in UDP of subscriber peer connections,
+	// while cameras may send large packets over TCP.
+	mtu = 1200
+	// videoPayloadType is payload type of repacketized video, tracks rewrite it for each subscriber.
+	videoPayloadType = 96
+)
+
+// forwarder forwards RTP from camera to a session as edge publisher does. Video is depacketized into frames,
+// and repacketized with SPS and PPS ahead of keyframes, as cameras may only send them in SDP while
+// browsers need them in band. Opus audio is forwarded as is.
+type forwarder struct {
+	sess         *session.Session
+	depacketizer rtpx.H264Depacketizer
+	packetizer   rtpx.H264Packetizer
+	ssrc         uint32
+	sps, pps     []byte
+}
+
+func newForwarder(sess *session.Session, parameterSets [][]byte) *forwarder {
+	random := randutil.NewMathRandomGenerator()
+	f := &forwarder{
+		sess: sess,
+		packetizer: rtpx.H264Packetizer{
+			MTU:            mtu,
+			SequenceNumber: uint16(random.Uint32()),
+		},
+		ssrc: random.Uint32(),
+	}
+	for _, nalu := range parameterSets {
+		f.parameterSet(nalu)
+	}
+	return f
+}
+
+// parameterSet keeps nalu if it's an SPS or PPS, and reports whether it's an SPS.
+func (f *forwarder) parameterSet(nalu []byte) bool {
+	switch nalu[0] & 0x1F {
+	case rtpx.NALUTypeSPS:
+		f.sps = nalu
+		return true
+	case rtpx.NALUTypePPS:
+		f.pps = nalu
+	}
+	return false
+}
+
+func (f *forwarder) video(data []byte) error {
+	f.sess.Bitrate.Add(len(data))
+	p, ok := rtpx.Parse(data)
+	if !ok {
+		return nil
+	}
+	// Sequence numbers from camera tell the loss of its uplink.
+	f.sess.Quality.Observe(p.SequenceNumber)
+	f.sess.Clock.Observe(p.Timestamp)
+
+	au := f.depacketizer.Push(p)
+	if au == nil {
+		return nil
+	}
+	inBand := false
+	for _, nalu := range au.NALUs {
+		if f.parameterSet(nalu) {
+			inBand = true
+		}
+	}
+	if au.Keyframe() && !inBand && f.sps != nil && f.pps != nil {
+		au.NALUs = append([][]byte{f.sps, f.pps}, au.NALUs...)
+	}
+
+	for _, packet := range f.packetizer.Packetize(au) {
+		b := packet.Marshal(videoPayloadType, f.ssrc)
+		f.sess.Taps.Write(webrtc.RTPCodecTypeVideo, b)
+		if err := f.sess.VideoTrack.Forward(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *forwarder) audio(data []byte) error {
+	f.sess.Bitrate.Add(len(data))
+	f.sess.Taps.Write(webrtc.RTPCodecTypeAudio, data)
+	return f.sess.AudioTrack.Forward(data)
+}
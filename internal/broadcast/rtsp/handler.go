@@ -0,0 +1,83 @@
+package rtsp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// Handler returns the admin API of RTSP sources, sources added or removed by it are not persisted:
+//
+//	GET    /v1/broadcast/rtsp                        lists sources
+//	PUT    /v1/broadcast/rtsp/{id}/{track_source}    pulls a source of {"url": "rtsp://..."}, replacing the old one
+//	DELETE /v1/broadcast/rtsp/{id}/{track_source}    stops pulling a source
+func (p *Puller) Handler() http.Handler {
+	router := mux.NewRouter()
+	router.HandleFunc("/v1/broadcast/rtsp", p.handleList()).Methods(http.MethodGet)
+	router.HandleFunc("/v1/broadcast/rtsp/{id}/{track_source:[0-9]+}", p.handlePut()).Methods(http.MethodPut)
+	router.HandleFunc("/v1/broadcast/rtsp/{id}/{track_source:[0-9]+}", p.handleDelete()).Methods(http.MethodDelete)
+	return router
+}
+
+func (p *Puller) handleList() http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(p.List()); err != nil {
+			p.logger.Err(err).Msg("could not write RTSP sources JSON")
+		}
+	}
+}
+
+func (p *Puller) handlePut() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source, ok := sourceOf(w, r)
+		if !ok {
+			return
+		}
+		var body struct {
+			URL string `json:"url"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		source.URL = body.URL
+		if err := validate(source); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p.Add(source)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (p *Puller) handleDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source, ok := sourceOf(w, r)
+		if !ok {
+			return
+		}
+		err := p.Remove(p.sessions.Key(&pb.Meta{Id: source.ID, TrackSource: source.TrackSource}))
+		if errors.Is(err, ErrSourceNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// sourceOf returns source in URL path without its URL, or replies bad request.
+func sourceOf(w http.ResponseWriter, r *http.Request) (Source, bool) {
+	vars := mux.Vars(r)
+	trackSource, err := session.ParseTrackSource(vars["track_source"])
+	if err != nil {
+		http.Error(w, "invalid track source", http.StatusBadRequest)
+		return Source{}, false
+	}
+	return Source{ID: vars["id"], TrackSource: trackSource}, true
+}
@@ -0,0 +1,303 @@
+// Package rtsp pulls RTSP streams of cameras which can't run the edge WebRTC publisher, and registers them
+// as sessions so subscribers watch them as any edge stream. Sources are configured in a YAML file or added
+// through the admin API. Only H264 video and Opus audio are supported, as they're forwarded without transcoding.
+package rtsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// Interleaved channels of RTP, RTCP of a media is on the next channel.
+const (
+	videoChannel = 0
+	audioChannel = 2
+)
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// ErrSourceNotFound is returned if a source is not pulled.
+var ErrSourceNotFound = errors.New("RTSP source not found")
+
+// Source is an RTSP stream pulled as a track source of a machine.
+type Source struct {
+	ID          string         `json:"id" yaml:"id"`
+	TrackSource pb.TrackSource `json:"track_source" yaml:"track_source"`
+	URL         string         `json:"url" yaml:"url"`
+}
+
+// Status is status of a pulled source, credentials in URL are redacted.
+type Status struct {
+	Source
+	Live  bool      `json:"live"`
+	Error string    `json:"error,omitempty"` // The last error if not live.
+	Since time.Time `json:"since"`           // Since when it's live or failing.
+}
+
+// sourcesFile is the YAML file of sources.
+type sourcesFile struct {
+	Sources []Source `yaml:"sources"`
+}
+
+// pull is a source being pulled.
+type pull struct {
+	source Source
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	status Status
+}
+
+func (p *pull) set(live bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Live, p.status.Since, p.status.Error = live, time.Now(), ""
+	if err != nil {
+		p.status.Error = err.Error()
+	}
+}
+
+// Puller pulls RTSP sources, reconnecting with backoff until they're removed.
+type Puller struct {
+	logger   zerolog.Logger
+	sessions *session.SessionManager
+	sources  []Source // Sources of YAML file.
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu    sync.Mutex
+	pulls map[session.Key]*pull
+}
+
+// New returns a new Puller of sources in YAML file of config if any.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.RTSPConfigOptions) (*Puller, error) {
+	p := &Puller{
+		logger:   loglevel.Default.Component(logger, "RTSP"),
+		sessions: sessions,
+		pulls:    make(map[session.Key]*pull),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	if config.RTSPSources == "" {
+		return p, nil
+	}
+
+	b, err := os.ReadFile(config.RTSPSources)
+	if err != nil {
+		return nil, fmt.Errorf("could not read RTSP sources: %w", err)
+	}
+	var file sourcesFile
+	if err := yaml.UnmarshalStrict(b, &file); err != nil {
+		return nil, fmt.Errorf("could not parse RTSP sources: %w", err)
+	}
+	for _, source := range file.Sources {
+		if err := validate(source); err != nil {
+			return nil, fmt.Errorf("invalid RTSP source %s: %w", source.ID, err)
+		}
+	}
+	p.sources = file.Sources
+	return p, nil
+}
+
+func validate(source Source) error {
+	if source.ID == "" {
+		return errors.New("missing id")
+	}
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "rtsp" || u.Host == "" {
+		return errors.New("not an RTSP URL")
+	}
+	return nil
+}
+
+// Run pulls sources of YAML file until ctx is done, then stops pulling all sources.
+func (p *Puller) Run(ctx context.Context) {
+	for _, source := range p.sources {
+		p.Add(source)
+	}
+	<-ctx.Done()
+
+	p.cancel()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, pl := range p.pulls {
+		<-pl.done
+		delete(p.pulls, key)
+	}
+}
+
+// Add starts pulling source, replacing the source of the same session key.
+func (p *Puller) Add(source Source) {
+	key := p.sessions.Key(&pb.Meta{Id: source.ID, TrackSource: source.TrackSource})
+	ctx, cancel := context.WithCancel(p.ctx)
+	pl := &pull{
+		source: source,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		status: Status{Source: source, Since: time.Now()},
+	}
+	if u, err := url.Parse(source.URL); err == nil {
+		pl.status.URL = u.Redacted()
+	}
+
+	p.mu.Lock()
+	old, ok := p.pulls[key]
+	p.pulls[key] = pl
+	p.mu.Unlock()
+	if ok {
+		old.cancel()
+		<-old.done
+	}
+	go p.run(ctx, pl)
+}
+
+// Remove stops pulling the source of key.
+func (p *Puller) Remove(key session.Key) error {
+	p.mu.Lock()
+	pl, ok := p.pulls[key]
+	delete(p.pulls, key)
+	p.mu.Unlock()
+	if !ok {
+		return ErrSourceNotFound
+	}
+	pl.cancel()
+	<-pl.done
+	return nil
+}
+
+// List returns status of all sources.
+func (p *Puller) List() []Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]Status, 0, len(p.pulls))
+	for _, pl := range p.pulls {
+		pl.mu.Lock()
+		list = append(list, pl.status)
+		pl.mu.Unlock()
+	}
+	return list
+}
+
+// run pulls a source, and reconnects with backoff until ctx is done.
+func (p *Puller) run(ctx context.Context, pl *pull) {
+	defer close(pl.done)
+	logger := p.logger.With().Str("id", pl.source.ID).Int32("track_source", int32(pl.source.TrackSource)).Logger()
+
+	backoff := minBackoff
+	for {
+		started := time.Now()
+		err := p.stream(ctx, pl, &logger)
+		if ctx.Err() != nil {
+			logger.Info().Msg("stopped pulling RTSP source")
+			return
+		}
+		pl.set(false, err)
+		// A stream lasting long enough is not a flapping one.
+		if time.Since(started) > maxBackoff {
+			backoff = minBackoff
+		}
+		logger.Warn().Err(err).Dur("backoff", backoff).Msg("RTSP source stopped, reconnecting")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// stream plays a source and forwards it to a new session until the connection fails or ctx is done.
+func (p *Puller) stream(ctx context.Context, pl *pull, logger *zerolog.Logger) error {
+	c, err := dial(ctx, pl.source.URL)
+	if err != nil {
+		return fmt.Errorf("could not connect: %w", err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Closing the connection unblocks reading once ctx is done.
+	go func() {
+		<-ctx.Done()
+		c.close()
+	}()
+
+	desc, err := c.describe()
+	if err != nil {
+		return fmt.Errorf("could not describe: %w", err)
+	}
+	var video, audio *media
+	for i := range desc.medias {
+		m := &desc.medias[i]
+		switch {
+		case m.kind == "video" && m.codec == "H264" && video == nil:
+			video = m
+		case m.kind == "audio" && m.codec == "OPUS" && audio == nil:
+			audio = m
+		}
+	}
+	if video == nil {
+		return errors.New("no H264 video offered")
+	}
+	if err := c.setup(video.control, videoChannel); err != nil {
+		return fmt.Errorf("could not set up video: %w", err)
+	}
+	if audio != nil {
+		if err := c.setup(audio.control, audioChannel); err != nil {
+			return fmt.Errorf("could not set up audio: %w", err)
+		}
+	}
+	if err := c.play(desc.control); err != nil {
+		return fmt.Errorf("could not play: %w", err)
+	}
+	go c.keepAlives(ctx)
+
+	videoTrack, audioTrack, err := webrtcx.CreateLocalTrack(webrtcx.DefaultCodecs())
+	if err != nil {
+		return fmt.Errorf("could not create webRTC local tracks: %w", err)
+	}
+	meta := &pb.Meta{Id: pl.source.ID, TrackSource: pl.source.TrackSource}
+	sess := session.New(p.sessions.Key(meta), meta, videoTrack, audioTrack)
+	p.sessions.Add(sess)
+	defer p.sessions.Remove(sess)
+	pl.set(true, nil)
+	logger.Info().Bool("audio", audio != nil).Msg("pulling RTSP source")
+
+	f := newForwarder(sess, video.parameterSets)
+	for {
+		channel, data, err := c.readFrame()
+		if err != nil {
+			return fmt.Errorf("could not read: %w", err)
+		}
+		switch channel {
+		case videoChannel:
+			err = f.video(data)
+		case audioChannel:
+			err = f.audio(data)
+		}
+		if err != nil {
+			return fmt.Errorf("could not forward: %w", err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package rtsp
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// media is a media description of SDP, see RFC 4566.
+type media struct {
+	kind        string // "video" or "audio".
+	payloadType uint8
+	codec       string // Encoding name in upper case, e.g. "H264".
+	clockRate   int
+	control     string // Absolute control URL.
+
+	// parameterSets are SPS and PPS of H264 from sprop-parameter-sets, see RFC 6184 8.1.
+	parameterSets [][]byte
+}
+
+// description is the session description of a stream.
+type description struct {
+	control string // Absolute aggregate control URL.
+	medias  []media
+}
+
+// parseSDP parses SDP of DESCRIBE response, control URLs are resolved against base.
+func parseSDP(b []byte, base string) (*description, error) {
+	desc := &description{control: base}
+	var m *media
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) < 2 || line[1] != '=' {
+			continue
+		}
+		key, value := line[0], line[2:]
+		switch {
+		case key == 'm':
+			// m=<media> <port> <proto> <fmt>
+			fields := strings.Fields(value)
+			if len(fields) < 4 {
+				return nil, errors.New("malformed media description")
+			}
+			pt, err := strconv.Atoi(fields[3])
+			if err != nil || pt < 0 || pt > 127 {
+				return nil, errors.New("malformed media format")
+			}
+			desc.medias = append(desc.medias, media{kind: fields[0], payloadType: uint8(pt), control: base})
+			m = &desc.medias[len(desc.medias)-1]
+		case key == 'a' && strings.HasPrefix(value, "control:"):
+			control := resolveControl(base, strings.TrimPrefix(value, "control:"))
+			if m == nil {
+				desc.control = control
+			} else {
+				m.control = control
+			}
+		case key == 'a' && strings.HasPrefix(value, "rtpmap:") && m != nil:
+			// a=rtpmap:<payload type> <encoding name>/<clock rate>[/<parameters>]
+			fields := strings.Fields(strings.TrimPrefix(value, "rtpmap:"))
+			if len(fields) < 2 || fields[0] != strconv.Itoa(int(m.payloadType)) {
+				continue
+			}
+			encoding := strings.Split(fields[1], "/")
+			m.codec = strings.ToUpper(encoding[0])
+			if len(encoding) > 1 {
+				m.clockRate, _ = strconv.Atoi(encoding[1])
+			}
+		case key == 'a' && strings.HasPrefix(value, "fmtp:") && m != nil:
+			for _, param := range strings.Split(value[strings.Index(value, " ")+1:], ";") {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || kv[0] != "sprop-parameter-sets" {
+					continue
+				}
+				for _, set := range strings.Split(kv[1], ",") {
+					if nalu, err := base64.StdEncoding.DecodeString(set); err == nil && len(nalu) > 0 {
+						m.parameterSets = append(m.parameterSets, nalu)
+					}
+				}
+			}
+		}
+	}
+	return desc, nil
+}
+
+// resolveControl resolves control URL against base. Relative URLs are appended to base as cameras expect,
+// e.g. "trackID=1" of "rtsp://host/stream" is "rtsp://host/stream/trackID=1".
+func resolveControl(base, control string) string {
+	switch {
+	case control == "*":
+		return base
+	case strings.HasPrefix(control, "rtsp://"):
+		return control
+	case strings.HasSuffix(base, "/"):
+		return base + control
+	default:
+		return base + "/" + control
+	}
+}
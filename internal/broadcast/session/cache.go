@@ -0,0 +1,76 @@
+package session
+
+import (
+	"encoding/binary"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// rtpHeaderSize is size of the fixed RTP header, see RFC 3550 section 5.1.
+const rtpHeaderSize = 12
+
+// PacketCache caches the latest RTP packets of a video track by sequence number, so packets lost by subscribers
+// are retransmitted from it on their NACKs. A session caches packets once for all of its subscribers.
+// A nil PacketCache caches nothing. It's safe for concurrent use.
+type PacketCache struct {
+	mu      sync.RWMutex
+	packets [][]byte // Indexed by sequence number modulo size.
+}
+
+// NewPacketCache returns a new PacketCache of the latest size packets.
+func NewPacketCache(size int) *PacketCache {
+	return &PacketCache{packets: make([][]byte, size)}
+}
+
+// Put caches an RTP packet, it's copied.
+func (c *PacketCache) Put(packet []byte) {
+	if c == nil || len(packet) < rtpHeaderSize {
+		return
+	}
+	i := int(binary.BigEndian.Uint16(packet[2:4])) % len(c.packets)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.packets[i] = append(c.packets[i][:0], packet...)
+}
+
+// Get returns a copy of the cached packet of sequence number seq, or nil if it's not cached or already overwritten.
+func (c *PacketCache) Get(seq uint16) []byte {
+	if c == nil {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	packet := c.packets[int(seq)%len(c.packets)]
+	if len(packet) < rtpHeaderSize || binary.BigEndian.Uint16(packet[2:4]) != seq {
+		return nil
+	}
+	return append([]byte(nil), packet...)
+}
+
+// EnableRetransmission caches the latest size packets of VideoTrack and simulcast layers for retransmission.
+// It must be called after layers are added and before video is forwarded.
+func (s *Session) EnableRetransmission(size int) {
+	s.VideoCache = NewPacketCache(size)
+	for _, layer := range s.Layers.List() {
+		if layer.Track == s.VideoTrack {
+			layer.Cache = s.VideoCache
+		} else {
+			layer.Cache = NewPacketCache(size)
+		}
+	}
+}
+
+// PacketCache returns the cache of track, VideoTrack or a simulcast layer, it's nil if retransmission is disabled.
+func (s *Session) PacketCache(track webrtc.TrackLocal) *PacketCache {
+	for _, layer := range s.Layers.List() {
+		if webrtc.TrackLocal(layer.Track) == track {
+			return layer.Cache
+		}
+	}
+	if track == webrtc.TrackLocal(s.VideoTrack) {
+		return s.VideoCache
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// videoClockRate is RTP clock rate of video codecs, see RFC 6184 for H264.
+const videoClockRate = 90000
+
+// Clock maps wall time to RTP timestamp of the video stream from edge, so events can be pinned to frames.
+// It's safe for concurrent use.
+type Clock struct {
+	mu sync.Mutex
+
+	timestamp uint32 // RTP timestamp of the latest packet.
+	at        time.Time
+}
+
+// NewClock returns a new Clock.
+func NewClock() *Clock {
+	return &Clock{}
+}
+
+// Observe records RTP timestamp of a video packet received just now.
+func (c *Clock) Observe(timestamp uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timestamp = timestamp
+	c.at = time.Now()
+}
+
+// TimestampAt returns RTP timestamp at wall time t extrapolated from the latest packet,
+// and reports whether any packet is observed.
+func (c *Clock) TimestampAt(t time.Time) (uint32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.at.IsZero() {
+		return 0, false
+	}
+	// Wrap around is intended as RTP timestamp does.
+	return c.timestamp + uint32(t.Sub(c.at).Seconds()*videoClockRate), true
+}
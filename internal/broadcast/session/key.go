@@ -0,0 +1,52 @@
+package session
+
+import (
+	"errors"
+	"strconv"
+
+	pb "github.com/SB-IM/pb/signal"
+)
+
+// Key identifies a session. Its fields are kept apart rather than concatenated,
+// so that e.g. id "12" of track source 3 never collides with id "123" of track source 0.
+// It's comparable and used as map key.
+type Key struct {
+	// Scope is reserved for composite keys, e.g. tenant or flight of the edge device. It's empty by default.
+	Scope       string
+	ID          string
+	TrackSource pb.TrackSource
+}
+
+// String returns a human-readable form of the key, e.g. "drone1/0" or "tenant/drone1/0".
+// It's for logs and labels only, never parse it back.
+func (k Key) String() string {
+	s := k.ID + "/" + strconv.Itoa(int(k.TrackSource))
+	if k.Scope != "" {
+		s = k.Scope + "/" + s
+	}
+	return s
+}
+
+// ParseTrackSource parses a decimal track source, e.g. of URL paths. Track sources are not checked against
+// the enum of pb, so new ones, e.g. thermal or gimbal cameras of new payloads, work as soon as edges send them.
+func ParseTrackSource(s string) (pb.TrackSource, error) {
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, errors.New("negative track source")
+	}
+	return pb.TrackSource(n), nil
+}
+
+// Namer derives the session key of an edge device track source from its metadata.
+type Namer func(meta *pb.Meta) Key
+
+// DefaultNamer keys sessions by edge device ID and track source.
+func DefaultNamer(meta *pb.Meta) Key {
+	return Key{
+		ID:          meta.Id,
+		TrackSource: meta.TrackSource,
+	}
+}
@@ -0,0 +1,67 @@
+package session
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is the number of latest delays percentiles are computed over.
+const latencySamples = 1024
+
+// LatencyPercentiles are percentiles of delays from capture or send time stamped by edge to receipt by this server.
+type LatencyPercentiles struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// Latency measures delays of video from edge by RTP header extensions stamping capture or send time,
+// i.e. abs-capture-time or abs-send-time. Clocks of edge and this server are assumed in sync by NTP,
+// delays measured negative are clock skew and dropped.
+// It's safe for concurrent use.
+type Latency struct {
+	mu sync.Mutex
+
+	samples []time.Duration // Ring buffer of the latest delays.
+	next    int
+}
+
+// NewLatency returns a new Latency.
+func NewLatency() *Latency {
+	return &Latency{samples: make([]time.Duration, 0, latencySamples)}
+}
+
+// Observe records a packet stamped by edge at sentAt and received at receivedAt.
+func (l *Latency) Observe(sentAt, receivedAt time.Time) {
+	delay := receivedAt.Sub(sentAt)
+	if delay < 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.samples) < latencySamples {
+		l.samples = append(l.samples, delay)
+		return
+	}
+	l.samples[l.next] = delay
+	l.next = (l.next + 1) % latencySamples
+}
+
+// Percentiles returns percentiles of the latest delays, and reports whether any delay is measured,
+// i.e. edge stamps packets.
+func (l *Latency) Percentiles() (LatencyPercentiles, bool) {
+	l.mu.Lock()
+	sorted := append([]time.Duration(nil), l.samples...)
+	l.mu.Unlock()
+	if len(sorted) == 0 {
+		return LatencyPercentiles{}, false
+	}
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	at := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return LatencyPercentiles{P50: at(0.5), P95: at(0.95), P99: at(0.99)}, true
+}
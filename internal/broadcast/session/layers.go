@@ -0,0 +1,79 @@
+package session
+
+import (
+	"sync"
+)
+
+// Layer is a simulcast video layer of a session, identified by its RID (RTP stream ID) offered by edge.
+type Layer struct {
+	RID   string
+	Track *Track
+	// Bitrate measures the layer received from edge, subscribers are switched between layers by it.
+	Bitrate *Meter
+	// Cache caches packets of the layer for retransmission, it's nil unless retransmission is enabled.
+	Cache *PacketCache
+
+	keyframes chan struct{}
+}
+
+// RequestKeyframe asks edge for a keyframe of the layer, e.g. after a subscriber switched to it.
+// Requests are merged if one is pending already.
+func (l *Layer) RequestKeyframe() {
+	select {
+	case l.keyframes <- struct{}{}:
+	default:
+	}
+}
+
+// Keyframes returns the channel of keyframe requests of the layer.
+func (l *Layer) Keyframes() <-chan struct{} {
+	return l.keyframes
+}
+
+// Layers are simulcast video layers of a session. It's empty if edge doesn't offer simulcast.
+type Layers struct {
+	mu     sync.RWMutex
+	layers []*Layer // In order offered by edge.
+}
+
+// Add adds a layer of rid forwarded to track.
+func (l *Layers) Add(rid string, track *Track) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.layers = append(l.layers, &Layer{
+		RID:       rid,
+		Track:     track,
+		Bitrate:   NewMeter(),
+		keyframes: make(chan struct{}, 1),
+	})
+}
+
+// Get returns the layer of rid.
+func (l *Layers) Get(rid string) (*Layer, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, layer := range l.layers {
+		if layer.RID == rid {
+			return layer, true
+		}
+	}
+	return nil, false
+}
+
+// List returns all layers in order offered.
+func (l *Layers) List() []*Layer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]*Layer(nil), l.layers...)
+}
+
+// RIDs returns RIDs of all layers.
+func (l *Layers) RIDs() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	rids := make([]string, 0, len(l.layers))
+	for _, layer := range l.layers {
+		rids = append(rids, layer.RID)
+	}
+	return rids
+}
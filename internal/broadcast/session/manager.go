@@ -0,0 +1,287 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+)
+
+// EventType is type of a session lifecycle event.
+type EventType int
+
+const (
+	// EventCreated is emitted when a session is added.
+	EventCreated EventType = iota
+	// EventClosed is emitted when a session is removed or expired.
+	EventClosed
+	// EventReplaced is emitted when a session is replaced by a newer one of the same key, e.g. edge restarted publishing.
+	EventReplaced
+	// EventDegraded is emitted when ingest quality of a session is degraded for a while.
+	EventDegraded
+	// EventRecovered is emitted when ingest quality of a degraded session is recovered.
+	EventRecovered
+)
+
+// String implements fmt.Stringer.
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "session-created"
+	case EventClosed:
+		return "session-closed"
+	case EventReplaced:
+		return "session-replaced"
+	case EventDegraded:
+		return "session-degraded"
+	case EventRecovered:
+		return "session-recovered"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a session lifecycle event.
+type Event struct {
+	Type    EventType
+	Session *Session
+	// Replaced is the old session replaced by Session, it's only set for EventReplaced.
+	Replaced *Session
+	// Reasons are reasons of degradation, they're only set for EventDegraded.
+	Reasons []string
+}
+
+// watcherBuffer is buffer size of a watcher channel.
+// Events are dropped for a slow watcher rather than blocking session operations.
+const watcherBuffer = 8
+
+// SessionManager manages sessions shared between publishers and subscribers.
+// Sessions are mainly added and removed by publishers and read by subscribers.
+// A session is expired if no media is received from edge in TTL unless it's hibernating.
+// All operations are instrumented, see metrics.go.
+type SessionManager struct {
+	logger zerolog.Logger
+	ttl    time.Duration
+	namer  Namer
+
+	mu       sync.RWMutex
+	sessions map[Key]*Session
+	watchers map[chan Event]struct{}
+	// expirer closes expired sessions along with their sources, see SetExpirer.
+	expirer func(*Session)
+
+	done chan struct{}
+}
+
+// NewSessionManager returns a new SessionManager. A non-positive ttl disables expiration.
+func NewSessionManager(ttl time.Duration, logger *zerolog.Logger) *SessionManager {
+	m := &SessionManager{
+		logger:   loglevel.Default.Component(logger, "SessionManager"),
+		ttl:      ttl,
+		namer:    DefaultNamer,
+		sessions: make(map[Key]*Session),
+		watchers: make(map[chan Event]struct{}),
+		done:     make(chan struct{}),
+	}
+	if ttl > 0 {
+		go m.expire()
+	}
+	return m
+}
+
+// Add adds a session, and reports whether an old session of the same key is replaced.
+// The tracks of a replaced session are no longer fed. Adding the current session again does nothing.
+func (m *SessionManager) Add(sess *Session) (replaced bool) {
+	defer observe(opAdd, time.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, replaced := m.sessions[sess.Key]
+	if old == sess {
+		return true
+	}
+	m.sessions[sess.Key] = sess
+	if replaced {
+		m.emit(Event{Type: EventReplaced, Session: sess, Replaced: old})
+	} else {
+		m.emit(Event{Type: EventCreated, Session: sess})
+	}
+	return replaced
+}
+
+// Remove removes the given session, and reports whether it's removed.
+// It does nothing if the session has been replaced by a newer one of the same key.
+func (m *SessionManager) Remove(sess *Session) bool {
+	defer observe(opRemove, time.Now())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.remove(sess)
+}
+
+// remove must be called with mu held.
+func (m *SessionManager) remove(sess *Session) bool {
+	if current, ok := m.sessions[sess.Key]; !ok || current != sess {
+		return false
+	}
+	delete(m.sessions, sess.Key)
+	m.emit(Event{Type: EventClosed, Session: sess})
+	return true
+}
+
+// SetExpirer sets the function closing expired sessions, e.g. closing the publisher peer connection of a session
+// along with removing it, so its edge re-offers rather than staying connected to a session gone. Expired sessions
+// are only removed if it's not set.
+func (m *SessionManager) SetExpirer(expirer func(*Session)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expirer = expirer
+}
+
+// SetNamer replaces DefaultNamer deriving session keys. It must be called before any session is added.
+func (m *SessionManager) SetNamer(namer Namer) {
+	m.namer = namer
+}
+
+// Key returns the session key of an edge device track source.
+func (m *SessionManager) Key(meta *pb.Meta) Key {
+	return m.namer(meta)
+}
+
+// Get returns the session of given key if it exists.
+func (m *SessionManager) Get(key Key) (*Session, bool) {
+	defer observe(opGet, time.Now())
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sess, ok := m.sessions[key]
+	return sess, ok
+}
+
+// List returns all sessions in no particular order.
+func (m *SessionManager) List() []*Session {
+	defer observe(opList, time.Now())
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, sess := range m.sessions {
+		sessions = append(sessions, sess)
+	}
+	return sessions
+}
+
+// Watch returns a channel receiving session lifecycle events, and a function to stop watching.
+// The channel is closed after stop is called.
+func (m *SessionManager) Watch() (events <-chan Event, stop func()) {
+	ch := make(chan Event, watcherBuffer)
+
+	m.mu.Lock()
+	m.watchers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			m.mu.Lock()
+			delete(m.watchers, ch)
+			m.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// MonitorQuality checks ingest quality of sessions periodically, and emits EventDegraded and EventRecovered.
+// It does nothing if CheckInterval of config is not positive.
+func (m *SessionManager) MonitorQuality(config cfg.QualityConfigOptions) {
+	if config.CheckInterval <= 0 {
+		return
+	}
+	go m.monitorQuality(config)
+}
+
+// Close stops expiring sessions and monitoring quality.
+func (m *SessionManager) Close() {
+	close(m.done)
+}
+
+// emit sends event to all watchers without blocking. It must be called with mu held.
+func (m *SessionManager) emit(event Event) {
+	for ch := range m.watchers {
+		select {
+		case ch <- event:
+		default:
+			m.logger.Warn().Str("event", event.Type.String()).Str("id", event.Session.ID).Msg("dropped event for slow watcher")
+		}
+	}
+}
+
+func (m *SessionManager) monitorQuality(config cfg.QualityConfigOptions) {
+	ticker := time.NewTicker(config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			for _, sess := range m.sessions {
+				if sess.Hibernating() {
+					continue
+				}
+				if !sess.Quality.check(now, sess.Bitrate, config) {
+					continue
+				}
+				if degraded, reasons := sess.Quality.Degraded(); degraded {
+					m.emit(Event{Type: EventDegraded, Session: sess, Reasons: reasons})
+					m.logger.Warn().Str("id", sess.ID).Strs("reasons", reasons).Msg("ingest quality degraded")
+				} else {
+					m.emit(Event{Type: EventRecovered, Session: sess})
+					m.logger.Info().Str("id", sess.ID).Msg("ingest quality recovered")
+				}
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// expire removes sessions not receiving media in ttl periodically.
+func (m *SessionManager) expire() {
+	ticker := time.NewTicker(m.ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.done:
+			return
+		case now := <-ticker.C:
+			var expired []*Session
+			m.mu.Lock()
+			for _, sess := range m.sessions {
+				if !sess.Hibernating() && now.Sub(sess.Bitrate.LastActive()) > m.ttl {
+					expired = append(expired, sess)
+				}
+			}
+			expirer := m.expirer
+			m.mu.Unlock()
+			// The expirer closes sessions out of the lock, as it removes them itself.
+			for _, sess := range expired {
+				m.logger.Info().Str("id", sess.ID).Msg("expired session")
+				if expirer != nil {
+					expirer(sess)
+				} else {
+					m.Remove(sess)
+				}
+			}
+		}
+	}
+}
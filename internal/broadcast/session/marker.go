@@ -0,0 +1,52 @@
+package session
+
+import (
+	"errors"
+	"time"
+)
+
+// maxMarkers is max markers of a session, protecting memory from misbehaving operators.
+const maxMarkers = 1000
+
+// ErrTooManyMarkers is returned if a session has too many markers.
+var ErrTooManyMarkers = errors.New("too many markers")
+
+// Marker is a timestamped event in a session dropped by operators, e.g. "object spotted",
+// for post-flight review.
+type Marker struct {
+	Label string    `json:"label"`
+	Note  string    `json:"note,omitempty"`
+	Time  time.Time `json:"time"`
+	// Offset is milliseconds since session started.
+	Offset int64 `json:"offset"`
+	// RTPTimestamp is RTP timestamp of video frame at Time, it's absent if no video is received yet.
+	RTPTimestamp *uint32 `json:"rtp_timestamp,omitempty"`
+}
+
+// Mark adds a marker at time t, which is pinned to video frame by session clock.
+func (s *Session) Mark(label, note string, t time.Time) (Marker, error) {
+	marker := Marker{
+		Label:  label,
+		Note:   note,
+		Time:   t,
+		Offset: t.Sub(s.CreatedAt).Milliseconds(),
+	}
+	if timestamp, ok := s.Clock.TimestampAt(t); ok {
+		marker.RTPTimestamp = &timestamp
+	}
+
+	s.markersMux.Lock()
+	defer s.markersMux.Unlock()
+	if len(s.markers) >= maxMarkers {
+		return Marker{}, ErrTooManyMarkers
+	}
+	s.markers = append(s.markers, marker)
+	return marker, nil
+}
+
+// Markers returns all markers in order of being added.
+func (s *Session) Markers() []Marker {
+	s.markersMux.Lock()
+	defer s.markersMux.Unlock()
+	return append([]Marker(nil), s.markers...)
+}
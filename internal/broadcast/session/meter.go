@@ -0,0 +1,81 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+const meterWindow = time.Second
+
+// Meter estimates bitrate of a stream over a fixed window.
+// It's safe for concurrent use, so all tracks of a stream can be measured by the same meter.
+type Meter struct {
+	mu sync.Mutex
+
+	windowStart time.Time
+	windowBytes uint64
+	bitrate     uint64 // Bits per second of the last complete window.
+	total       uint64
+	lastActive  time.Time
+}
+
+// NewMeter returns a new Meter.
+func NewMeter() *Meter {
+	now := time.Now()
+	return &Meter{
+		windowStart: now,
+		lastActive:  now,
+	}
+}
+
+// Add records n bytes received.
+func (m *Meter) Add(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.windowBytes += uint64(n)
+	m.total += uint64(n)
+
+	now := time.Now()
+	m.lastActive = now
+	elapsed := now.Sub(m.windowStart)
+	if elapsed < meterWindow {
+		return
+	}
+	m.bitrate = uint64(float64(m.windowBytes*8) / elapsed.Seconds())
+	m.windowStart = now
+	m.windowBytes = 0
+}
+
+// resume restarts measuring after the stream is paused on purpose, so the pause is neither inactivity
+// nor low bitrate.
+func (m *Meter) resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.lastActive = now
+	m.windowStart = now
+	m.windowBytes = 0
+}
+
+// Bitrate returns the estimated bitrate in bits per second.
+func (m *Meter) Bitrate() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.bitrate
+}
+
+// LastActive returns the last time any bytes are received, or creation time of the meter if none.
+func (m *Meter) LastActive() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lastActive
+}
+
+// Total returns total bytes received.
+func (m *Meter) Total() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.total
+}
@@ -0,0 +1,86 @@
+package session
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// Operations of SessionManager and fan-out writes of tracks, counted with their latencies.
+var (
+	opAdd    = newOperation("add")
+	opRemove = newOperation("remove")
+	opGet    = newOperation("get")
+	opList   = newOperation("list")
+	opFanout = newOperation("fanout_write")
+)
+
+// operation keeps counters of an operation, as they are updated in hot paths.
+type operation struct {
+	count, latency *metrics.Counter
+}
+
+func newOperation(name string) operation {
+	return operation{
+		count:   metrics.SessionOperations.WithLabelValues(name),
+		latency: metrics.SessionOperationLatency.WithLabelValues(name),
+	}
+}
+
+// observe records op started at start.
+func observe(op operation, start time.Time) {
+	op.count.Inc()
+	op.latency.Add(uint64(time.Since(start).Nanoseconds()))
+}
+
+// RegisterMetrics registers gauges of active publishers, subscribers and ingest latency per session collected
+// from m to r. It should be called once per registry.
+func (m *SessionManager) RegisterMetrics(r *metrics.Registry) {
+	r.NewGaugeFunc(
+		"skywalker_broadcast_publishers",
+		"Active publisher sessions.",
+		nil,
+		func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(len(m.List()))}}
+		},
+	)
+	r.NewGaugeFunc(
+		"skywalker_broadcast_subscribers",
+		"Active subscribers per session.",
+		[]string{"id", "track_source"},
+		func() []metrics.Sample {
+			sessions := m.List()
+			samples := make([]metrics.Sample, 0, len(sessions))
+			for _, sess := range sessions {
+				samples = append(samples, metrics.Sample{
+					LabelValues: []string{sess.Meta.Id, strconv.Itoa(int(sess.Meta.TrackSource))},
+					Value:       float64(sess.Viewers()),
+				})
+			}
+			return samples
+		},
+	)
+	r.NewGaugeFunc(
+		"skywalker_broadcast_ingest_latency_seconds",
+		"Percentiles of latest delays of video from capture or send time stamped by edge to receipt per session.",
+		[]string{"id", "track_source", "quantile"},
+		func() []metrics.Sample {
+			sessions := m.List()
+			samples := make([]metrics.Sample, 0, len(sessions)*3)
+			for _, sess := range sessions {
+				p, ok := sess.Latency.Percentiles()
+				if !ok {
+					continue
+				}
+				trackSource := strconv.Itoa(int(sess.Meta.TrackSource))
+				samples = append(samples,
+					metrics.Sample{LabelValues: []string{sess.Meta.Id, trackSource, "0.5"}, Value: p.P50.Seconds()},
+					metrics.Sample{LabelValues: []string{sess.Meta.Id, trackSource, "0.95"}, Value: p.P95.Seconds()},
+					metrics.Sample{LabelValues: []string{sess.Meta.Id, trackSource, "0.99"}, Value: p.P99.Seconds()},
+				)
+			}
+			return samples
+		},
+	)
+}
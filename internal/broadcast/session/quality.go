@@ -0,0 +1,103 @@
+package session
+
+import (
+	"sync"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// Reasons of ingest quality degradation.
+const (
+	ReasonPacketLoss = "packet-loss" // RTP packets from edge are lost, e.g. poor uplink.
+	ReasonStalled    = "stalled"     // No media is received from edge for a while.
+	ReasonLowBitrate = "low-bitrate" // Bitrate from edge is under the minimum.
+)
+
+// minLossPackets is the minimum of expected packets in a check to estimate loss ratio, so it's not too noisy.
+const minLossPackets = 50
+
+// Quality tracks ingest quality of a stream from edge, by RTP sequence numbers of video.
+type Quality struct {
+	mu sync.Mutex
+
+	started  bool
+	lastSeq  uint16
+	received uint64 // Received packets since last check.
+	lost     uint64 // Lost packets since last check.
+
+	pendingSince time.Time // Since when degradation is found but not sustained yet.
+	degraded     bool
+	reasons      []string
+}
+
+// NewQuality returns a new Quality.
+func NewQuality() *Quality {
+	return &Quality{}
+}
+
+// Observe records a received RTP packet of sequence number seq.
+func (q *Quality) Observe(seq uint16) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.received++
+	if !q.started {
+		q.started = true
+		q.lastSeq = seq
+		return
+	}
+	// Sequence number wraps around, a forward step is less than half of the range.
+	switch diff := seq - q.lastSeq; {
+	case diff == 0:
+		q.received-- // Duplicate.
+	case diff < 1<<15:
+		q.lost += uint64(diff - 1)
+		q.lastSeq = seq
+	case q.lost > 0:
+		q.lost-- // A late packet, which has been counted lost.
+	}
+}
+
+// Degraded reports whether ingest quality is degraded and why.
+func (q *Quality) Degraded() (bool, []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.degraded, q.reasons
+}
+
+// check checks ingest quality at now with bitrate of the stream, and reports whether the degradation state changed.
+// Quality is degraded once degradation is found consecutively in DegradedAfter, and recovered once none is found.
+func (q *Quality) check(now time.Time, bitrate *Meter, config cfg.QualityConfigOptions) (changed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var reasons []string
+	if expected := q.received + q.lost; expected >= minLossPackets &&
+		float64(q.lost)/float64(expected) > config.MaxPacketLoss {
+		reasons = append(reasons, ReasonPacketLoss)
+	}
+	q.received, q.lost = 0, 0
+	if config.StallTimeout > 0 && now.Sub(bitrate.LastActive()) > config.StallTimeout {
+		reasons = append(reasons, ReasonStalled)
+	} else if config.MinBitrate > 0 && bitrate.Bitrate() < uint64(config.MinBitrate)*1000 {
+		reasons = append(reasons, ReasonLowBitrate)
+	}
+
+	if len(reasons) == 0 {
+		q.pendingSince = time.Time{}
+		if !q.degraded {
+			return false
+		}
+		q.degraded, q.reasons = false, nil
+		return true
+	}
+	if q.pendingSince.IsZero() {
+		q.pendingSince = now
+	}
+	if q.degraded || now.Sub(q.pendingSince) < config.DegradedAfter {
+		return false
+	}
+	q.degraded, q.reasons = true, reasons
+	return true
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/pion/randutil"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// maxSeqGap is the max distance of sequence numbers of packets of one source, due to loss or reordering.
+// Sources are numbered independently, so a packet farther from the newest one starts another source.
+const maxSeqGap = 64
+
+// Rewriter rewrites sequence numbers and timestamps of RTP packets forwarded to a track, so receivers see one
+// continuous stream once its source changes, e.g. edge restarted publishing to a session, or a subscriber is
+// switched to another simulcast layer. Packets of a new source continue right after the newest packet forwarded,
+// and their timestamps advance by wall time elapsed since it. Packets of the first source are kept as they are.
+// It's safe for concurrent use.
+type Rewriter struct {
+	// ssrc is the SSRC of packets rewritten by Rewrite.
+	ssrc      uint32
+	clockRate uint32
+
+	mu      sync.Mutex
+	started bool
+	// switching is set by Switch until a packet not continuing the current source starts the next one.
+	switching bool
+	// source is the SSRC of the current source as received.
+	source uint32
+	// newest is the sequence number of the newest packet of the current source as received.
+	newest    uint16
+	seqOffset uint16
+	tsOffset  uint32
+	// first is the rewritten sequence number of the first packet of the current source.
+	first uint16
+	// lastSeq, lastTS and lastAt are of the newest packet forwarded.
+	lastSeq uint16
+	lastTS  uint32
+	lastAt  time.Time
+}
+
+// NewRewriter returns a new Rewriter of a track of clockRate.
+func NewRewriter(clockRate uint32) *Rewriter {
+	return &Rewriter{
+		ssrc:      randutil.NewMathRandomGenerator().Uint32(),
+		clockRate: clockRate,
+	}
+}
+
+// Rewrite rewrites an RTP packet in place, including its SSRC to the one of r. A packet of another SSRC than
+// the current source starts a new source.
+func (r *Rewriter) Rewrite(packet []byte) {
+	if len(packet) < rtpHeaderSize {
+		return
+	}
+	seq, ts := r.rewrite(
+		binary.BigEndian.Uint32(packet[8:12]),
+		binary.BigEndian.Uint16(packet[2:4]),
+		binary.BigEndian.Uint32(packet[4:8]),
+		time.Now(),
+	)
+	binary.BigEndian.PutUint16(packet[2:4], seq)
+	binary.BigEndian.PutUint32(packet[4:8], ts)
+	binary.BigEndian.PutUint32(packet[8:12], r.ssrc)
+}
+
+// RewriteHeader rewrites sequence number and timestamp of header in place, its SSRC is kept.
+func (r *Rewriter) RewriteHeader(header *rtp.Header) {
+	header.SequenceNumber, header.Timestamp = r.rewrite(header.SSRC, header.SequenceNumber, header.Timestamp, time.Now())
+}
+
+// Switch tells r the source is about to change while keeping its SSRC, the first packet afterwards not continuing
+// sequence numbers of the current source starts the next one.
+func (r *Rewriter) Switch() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.switching = r.started
+}
+
+// Source returns the sequence number as received of a rewritten one, e.g. to find a packet lost by a receiver
+// in a cache of its source. It reports false if seq is of a former source, or the source is switching.
+func (r *Rewriter) Source(seq uint16) (uint16, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.started || r.switching || int16(seq-r.first) < 0 {
+		return 0, false
+	}
+	return seq - r.seqOffset, true
+}
+
+func (r *Rewriter) rewrite(ssrc uint32, seq uint16, ts uint32, now time.Time) (uint16, uint32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case !r.started:
+		r.started, r.source, r.newest, r.first = true, ssrc, seq, seq
+		r.lastSeq, r.lastTS, r.lastAt = seq, ts, now
+	case ssrc != r.source || (r.switching && !continues(r.newest, seq)):
+		ticks := uint32(now.Sub(r.lastAt).Milliseconds() * int64(r.clockRate) / 1000)
+		if ticks == 0 {
+			ticks = 1
+		}
+		r.seqOffset = r.lastSeq + 1 - seq
+		r.tsOffset = r.lastTS + ticks - ts
+		r.source, r.newest, r.first, r.switching = ssrc, seq, r.lastSeq+1, false
+	case int16(seq-r.newest) > 0:
+		r.newest = seq
+	}
+
+	seq, ts = seq+r.seqOffset, ts+r.tsOffset
+	// Reordered packets don't move the newest one, so the next source doesn't rewind.
+	if int16(seq-r.lastSeq) > 0 {
+		r.lastSeq, r.lastTS, r.lastAt = seq, ts, now
+	}
+	return seq, ts
+}
+
+// continues reports whether seq is of the same source as newest.
+func continues(newest, seq uint16) bool {
+	d := int16(seq - newest)
+	return d > -maxSeqGap && d < maxSeqGap
+}
+
+// rewriterKey identifies a track of a session fed by edge.
+type rewriterKey struct {
+	kind webrtc.RTPCodecType
+	rid  string
+}
+
+// Rewriter returns the rewriter of packets from edge forwarded to the track of kind, or of the simulcast layer
+// of rid. Rewriters are kept by the session, so the stream of a track stays continuous once edge restarts
+// publishing the session.
+func (s *Session) Rewriter(kind webrtc.RTPCodecType, rid string) *Rewriter {
+	s.rewritersMux.Lock()
+	defer s.rewritersMux.Unlock()
+	key := rewriterKey{kind: kind, rid: rid}
+	if r, ok := s.rewriters[key]; ok {
+		return r
+	}
+	track := s.AudioTrack
+	if kind == webrtc.RTPCodecTypeVideo {
+		track = s.VideoTrack
+	}
+	r := NewRewriter(track.Codec().ClockRate)
+	if s.rewriters == nil {
+		s.rewriters = make(map[rewriterKey]*Rewriter)
+	}
+	s.rewriters[key] = r
+	return r
+}
@@ -0,0 +1,148 @@
+package session
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+)
+
+// Session is a live stream from a track source of an edge device.
+// It's created by publisher and read by subscribers.
+type Session struct {
+	viewers int64 // Accessed atomically, keep it first for alignment.
+
+	Key Key
+	// ID is the string form of Key, for logs and labels.
+	ID   string
+	Meta *pb.Meta
+	// Origin is the instance this session is relayed from, it's empty if the session is published to this one.
+	Origin     string
+	VideoTrack *Track
+	AudioTrack *Track
+	CreatedAt  time.Time
+	// LowLatency marks a session of which latency matters more than smoothness, e.g. of teleoperation. It's
+	// forwarded without buffering, and its subscribers are asked to play it out at once.
+	LowLatency bool
+
+	// Bitrate measures incoming stream from edge.
+	Bitrate *Meter
+	// Clock maps wall time to RTP timestamp of incoming video from edge.
+	Clock *Clock
+	// Quality tracks ingest quality of incoming video from edge.
+	Quality *Quality
+	// Layers are simulcast video layers from edge, VideoTrack is the default one of them if any.
+	Layers *Layers
+	// Taps receive default video and audio from edge in process.
+	Taps *Taps
+	// Telemetry relays telemetry data channel from edge to subscribers.
+	Telemetry *Telemetry
+	// Latency measures delays of incoming video from edge stamping packets.
+	Latency *Latency
+	// VideoCache caches packets of VideoTrack retransmitted on NACKs of subscribers, it's nil unless
+	// retransmission is enabled, see EnableRetransmission.
+	VideoCache *PacketCache
+
+	// keyframes are keyframe requests of VideoTrack if edge doesn't offer simulcast.
+	keyframes chan struct{}
+
+	markersMux sync.Mutex
+	markers    []Marker
+
+	rewritersMux sync.Mutex
+	rewriters    map[rewriterKey]*Rewriter
+
+	hibernateMux sync.Mutex
+	woken        chan struct{} // Closed once a viewer joins, it's nil unless the session is hibernating.
+}
+
+// New returns a new Session of key, see SessionManager.Key.
+func New(key Key, meta *pb.Meta, videoTrack, audioTrack *Track) *Session {
+	return &Session{
+		Key:        key,
+		ID:         key.String(),
+		Meta:       meta,
+		VideoTrack: videoTrack,
+		AudioTrack: audioTrack,
+		CreatedAt:  time.Now(),
+		Bitrate:    NewMeter(),
+		Clock:      NewClock(),
+		Quality:    NewQuality(),
+		Layers:     &Layers{},
+		Taps:       &Taps{},
+		Telemetry:  &Telemetry{},
+		Latency:    NewLatency(),
+		keyframes:  make(chan struct{}, 1),
+	}
+}
+
+// RequestKeyframe asks edge for a keyframe of track, VideoTrack or a simulcast layer, e.g. after a subscriber
+// joined or reported loss. Requests are merged if one is pending already.
+func (s *Session) RequestKeyframe(track webrtc.TrackLocal) {
+	for _, rid := range s.Layers.RIDs() {
+		if layer, ok := s.Layers.Get(rid); ok && webrtc.TrackLocal(layer.Track) == track {
+			layer.RequestKeyframe()
+			return
+		}
+	}
+	if track != webrtc.TrackLocal(s.VideoTrack) {
+		return
+	}
+	select {
+	case s.keyframes <- struct{}{}:
+	default:
+	}
+}
+
+// Keyframes returns the channel of keyframe requests of VideoTrack, it's not used if edge offers simulcast,
+// as requests go to the layers.
+func (s *Session) Keyframes() <-chan struct{} {
+	return s.keyframes
+}
+
+// Join records a viewer joining the session, and wakes the session up if it's hibernating.
+func (s *Session) Join() {
+	atomic.AddInt64(&s.viewers, 1)
+
+	s.hibernateMux.Lock()
+	defer s.hibernateMux.Unlock()
+	if s.woken != nil {
+		// Edge is given TTL to resume sending before the session expires.
+		s.Bitrate.resume()
+		close(s.woken)
+		s.woken = nil
+	}
+}
+
+// Leave records a viewer leaving the session.
+func (s *Session) Leave() {
+	atomic.AddInt64(&s.viewers, -1)
+}
+
+// Viewers returns current viewer count.
+func (s *Session) Viewers() int64 {
+	return atomic.LoadInt64(&s.viewers)
+}
+
+// Hibernate marks the session hibernating if it has no viewer, i.e. edge is asked to stop sending media,
+// and returns a channel closed once a viewer joins. A hibernating session never expires nor degrades.
+func (s *Session) Hibernate() (woken <-chan struct{}, ok bool) {
+	s.hibernateMux.Lock()
+	defer s.hibernateMux.Unlock()
+	if s.Viewers() > 0 {
+		return nil, false
+	}
+	if s.woken == nil {
+		s.woken = make(chan struct{})
+	}
+	return s.woken, true
+}
+
+// Hibernating reports whether the session is hibernating.
+func (s *Session) Hibernating() bool {
+	s.hibernateMux.Lock()
+	defer s.hibernateMux.Unlock()
+	return s.woken != nil
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+)
+
+// Metadata is metadata of a session shared by instances through a SessionStore. Tracks, stats and viewers
+// of the session live on the instance publishing it only.
+type Metadata struct {
+	Scope       string         `json:"scope,omitempty"`
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	// Instance is the instance the session is published to.
+	Instance   string    `json:"instance"`
+	VideoCodec string    `json:"video_codec"`
+	AudioCodec string    `json:"audio_codec"`
+	Layers     []string  `json:"layers,omitempty"`
+	LowLatency bool      `json:"low_latency,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Key returns the session key of md.
+func (md Metadata) Key() Key {
+	return Key{Scope: md.Scope, ID: md.ID, TrackSource: md.TrackSource}
+}
+
+// Metadata returns metadata of s published to instance.
+func (s *Session) Metadata(instance string, now time.Time) Metadata {
+	return Metadata{
+		Scope:       s.Key.Scope,
+		ID:          s.Key.ID,
+		TrackSource: s.Key.TrackSource,
+		Instance:    instance,
+		VideoCodec:  s.VideoTrack.Codec().MimeType,
+		AudioCodec:  s.AudioTrack.Codec().MimeType,
+		Layers:      s.Layers.RIDs(),
+		LowLatency:  s.LowLatency,
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   now,
+	}
+}
+
+// SessionStore stores metadata of sessions shared by instances, e.g. to find which instance publishes a session.
+type SessionStore interface {
+	// Put puts metadata of a session, which expires in ttl unless put again.
+	Put(ctx context.Context, md Metadata, ttl time.Duration) error
+	// Delete deletes metadata of key only if it's put by instance, so metadata of a newer session put by
+	// another instance is kept.
+	Delete(ctx context.Context, key Key, instance string) error
+	// List returns metadata of sessions of all instances in no particular order.
+	List(ctx context.Context) ([]Metadata, error)
+}
+
+// MemoryStore is a SessionStore in memory of this instance, which shares metadata with no other instance.
+// It's the default store of a single instance.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[Key]memoryEntry
+}
+
+type memoryEntry struct {
+	md        Metadata
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[Key]memoryEntry)}
+}
+
+// Put implements SessionStore.
+func (s *MemoryStore) Put(_ context.Context, md Metadata, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[md.Key()] = memoryEntry{md: md, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Delete implements SessionStore.
+func (s *MemoryStore) Delete(_ context.Context, key Key, instance string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.sessions[key]; ok && e.md.Instance == instance {
+		delete(s.sessions, key)
+	}
+	return nil
+}
+
+// List implements SessionStore, expired metadata is removed meanwhile. Metadata is ordered by key.
+func (s *MemoryStore) List(context.Context) ([]Metadata, error) {
+	now := time.Now()
+	s.mu.Lock()
+	list := make([]Metadata, 0, len(s.sessions))
+	for key, e := range s.sessions {
+		if !now.Before(e.expiresAt) {
+			delete(s.sessions, key)
+			continue
+		}
+		list = append(list, e.md)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key().String() < list[j].Key().String()
+	})
+	return list, nil
+}
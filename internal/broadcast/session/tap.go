@@ -0,0 +1,79 @@
+package session
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// tapBuffer is buffer size of a tap channel.
+// Packets are dropped for a slow tap rather than blocking forwarding to subscribers.
+const tapBuffer = 512
+
+// Packet is an RTP packet of the incoming stream from edge.
+type Packet struct {
+	Kind webrtc.RTPCodecType
+	Data []byte
+}
+
+// Tap receives RTP packets of default video and audio of a session in process, e.g. for recording.
+type Tap struct {
+	packets chan Packet
+}
+
+// Packets returns the channel of tapped packets, it's closed once the tap is removed.
+func (t *Tap) Packets() <-chan Packet {
+	return t.packets
+}
+
+// Taps are taps of a session.
+type Taps struct {
+	mu   sync.RWMutex
+	taps map[*Tap]struct{}
+}
+
+// Add adds a new tap.
+func (t *Taps) Add() *Tap {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.taps == nil {
+		t.taps = make(map[*Tap]struct{})
+	}
+	tap := &Tap{packets: make(chan Packet, tapBuffer)}
+	t.taps[tap] = struct{}{}
+	return tap
+}
+
+// Remove removes tap and closes its channel. Removing a removed tap does nothing.
+func (t *Taps) Remove(tap *Tap) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.taps[tap]; !ok {
+		return
+	}
+	delete(t.taps, tap)
+	close(tap.packets)
+}
+
+// Len returns the number of taps.
+func (t *Taps) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.taps)
+}
+
+// Write copies packet of kind to all taps. It's cheap if there is no tap.
+func (t *Taps) Write(kind webrtc.RTPCodecType, packet []byte) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if len(t.taps) == 0 {
+		return
+	}
+	data := append([]byte(nil), packet...)
+	for tap := range t.taps {
+		select {
+		case tap.packets <- Packet{Kind: kind, Data: data}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package session
+
+import (
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// TelemetryLabel is the label of data channels carrying telemetry, e.g. GPS, attitude and battery of drones.
+// Edge opens it to publish, and subscribers open it in their offers to receive.
+const TelemetryLabel = "telemetry"
+
+// telemetryBuffer is buffer size of a telemetry subscription.
+// Messages are dropped for a slow subscriber rather than blocking others.
+const telemetryBuffer = 64
+
+// TelemetryMessage is a data channel message from edge. Edge timestamps its telemetry, so viewers can
+// overlay it in sync with video.
+type TelemetryMessage struct {
+	IsString bool
+	Data     []byte
+}
+
+// TelemetrySubscription receives telemetry of a session.
+type TelemetrySubscription struct {
+	messages chan TelemetryMessage
+}
+
+// Messages returns the channel of telemetry, it's closed once the subscription is removed.
+func (s *TelemetrySubscription) Messages() <-chan TelemetryMessage {
+	return s.messages
+}
+
+// Telemetry relays messages of the edge data channel to data channels of all subscribers of a session.
+type Telemetry struct {
+	mu   sync.RWMutex
+	subs map[*TelemetrySubscription]struct{}
+}
+
+// Subscribe adds a new subscription.
+func (t *Telemetry) Subscribe() *TelemetrySubscription {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.subs == nil {
+		t.subs = make(map[*TelemetrySubscription]struct{})
+	}
+	sub := &TelemetrySubscription{messages: make(chan TelemetryMessage, telemetryBuffer)}
+	t.subs[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes sub and closes its channel. Removing a removed subscription does nothing.
+func (t *Telemetry) Unsubscribe(sub *TelemetrySubscription) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.subs[sub]; !ok {
+		return
+	}
+	delete(t.subs, sub)
+	close(sub.messages)
+}
+
+// Write fans out msg of edge to all subscriptions.
+func (t *Telemetry) Write(msg webrtc.DataChannelMessage) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	m := TelemetryMessage{IsString: msg.IsString, Data: msg.Data}
+	for sub := range t.subs {
+		select {
+		case sub.messages <- m:
+		default:
+		}
+	}
+}
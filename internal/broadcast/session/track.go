@@ -0,0 +1,273 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// trackRingSize is the number of packets a Track keeps for its subscribers, about 2 seconds of a 4 Mbps video.
+// A subscriber falling behind by more skips to the oldest packet kept.
+const trackRingSize = 1024
+
+// errShortPacket is returned by Track.Write if a packet is shorter than the RTP header.
+var errShortPacket = errors.New("packet shorter than RTP header")
+
+// trackPacket is a packet written to a Track, n is its index in packets written.
+type trackPacket struct {
+	n    uint64
+	data []byte
+}
+
+// Track is a local track fanning out RTP packets of a session from edge to subscribers. Packets are read once
+// from edge and written to a ring of the track, then each peer connection bound to the track sends them on its
+// own goroutine, so a slow subscriber neither blocks the reader of edge nor other subscribers, and each of them
+// is adapted independently, e.g. rewritten by interceptors of its peer connection. Writing takes no lock, and
+// a subscriber falling behind by more than the ring skips packets it missed rather than buffering them.
+// Unlike webrtc.TrackLocalStaticRTP, errors of a subscriber never fail writes of the reader.
+type Track struct {
+	// head is the number of packets written, accessed atomically. Keep it first for alignment.
+	head uint64
+
+	codec        webrtc.RTPCodecCapability
+	id, streamID string
+	ring         [trackRingSize]atomic.Value // *trackPacket
+	// senders are senders of peer connections bound to the track, a []*trackSender replaced on bindings.
+	senders   atomic.Value
+	sendersMu sync.Mutex
+	// packets and bytes count packets forwarded by Forward, and skipped counts packets skipped by senders
+	// falling behind.
+	packets, bytes, skipped *metrics.Counter
+}
+
+// NewTrack returns a new Track of codec, see webrtc.NewTrackLocalStaticRTP.
+func NewTrack(codec webrtc.RTPCodecCapability, id, streamID string) (*Track, error) {
+	kind := codecKind(codec)
+	if kind != webrtc.RTPCodecTypeVideo && kind != webrtc.RTPCodecTypeAudio {
+		return nil, fmt.Errorf("unsupported codec %q", codec.MimeType)
+	}
+	t := &Track{
+		codec:    codec,
+		id:       id,
+		streamID: streamID,
+		packets:  metrics.RTPPacketsForwarded.WithLabelValues(kind.String()),
+		bytes:    metrics.RTPBytesForwarded.WithLabelValues(kind.String()),
+		skipped:  metrics.FanoutSkipped.WithLabelValues(kind.String()),
+	}
+	t.senders.Store([]*trackSender(nil))
+	return t, nil
+}
+
+// ID implements webrtc.TrackLocal.
+func (t *Track) ID() string { return t.id }
+
+// StreamID implements webrtc.TrackLocal.
+func (t *Track) StreamID() string { return t.streamID }
+
+// Kind implements webrtc.TrackLocal.
+func (t *Track) Kind() webrtc.RTPCodecType { return codecKind(t.codec) }
+
+// Codec returns the codec of the track.
+func (t *Track) Codec() webrtc.RTPCodecCapability { return t.codec }
+
+// Write writes an RTP packet to subscribers, it's copied so b may be reused once Write returns. It returns
+// io.ErrClosedPipe if no peer connection is bound to the track.
+func (t *Track) Write(b []byte) (int, error) {
+	if len(b) < rtpHeaderSize {
+		return 0, errShortPacket
+	}
+	senders := t.senders.Load().([]*trackSender)
+	if len(senders) == 0 {
+		return 0, io.ErrClosedPipe
+	}
+	n := atomic.AddUint64(&t.head, 1) - 1
+	t.ring[n%trackRingSize].Store(&trackPacket{n: n, data: append([]byte(nil), b...)})
+	for _, s := range senders {
+		s.wake()
+	}
+	return len(b), nil
+}
+
+// Forward writes an RTP packet of the publisher to subscribers as Write does, and meters it. No subscriber bound
+// to the track isn't an error.
+// Subscribers are sent the packet on their own goroutines, so the latency of fan-out writes tells how much
+// forwarding is slowed down by handing the packet to them.
+func (t *Track) Forward(b []byte) error {
+	start := time.Now()
+	_, err := t.Write(b)
+	observe(opFanout, start)
+	if errors.Is(err, io.ErrClosedPipe) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	t.packets.Inc()
+	t.bytes.Add(uint64(len(b)))
+	return nil
+}
+
+// WriteRTP writes packet to subscribers, see Write.
+func (t *Track) WriteRTP(packet *rtp.Packet) error {
+	b, err := packet.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = t.Write(b)
+	return err
+}
+
+// Bind implements webrtc.TrackLocal, it starts sending packets written afterwards to the peer connection
+// of ctx if it supports the codec of the track.
+func (t *Track) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	codec, ok := matchCodec(t.codec, ctx.CodecParameters())
+	if !ok {
+		return webrtc.RTPCodecParameters{}, webrtc.ErrUnsupportedCodec
+	}
+	t.bind(&trackSender{
+		id:          ctx.ID(),
+		ssrc:        uint32(ctx.SSRC()),
+		payloadType: uint8(codec.PayloadType),
+		stream:      ctx.WriteStream(),
+	})
+	return codec, nil
+}
+
+// bind starts sending packets written afterwards by s.
+func (t *Track) bind(s *trackSender) {
+	s.next = atomic.LoadUint64(&t.head)
+	s.wakes = make(chan struct{}, 1)
+	s.done = make(chan struct{})
+
+	t.sendersMu.Lock()
+	senders := t.senders.Load().([]*trackSender)
+	t.senders.Store(append(append([]*trackSender(nil), senders...), s))
+	t.sendersMu.Unlock()
+
+	go t.send(s)
+}
+
+// Unbind implements webrtc.TrackLocal, it stops sending packets to the peer connection of ctx.
+func (t *Track) Unbind(ctx webrtc.TrackLocalContext) error {
+	return t.unbind(ctx.ID())
+}
+
+// unbind stops sending packets by the sender of id.
+func (t *Track) unbind(id string) error {
+	t.sendersMu.Lock()
+	defer t.sendersMu.Unlock()
+	senders := t.senders.Load().([]*trackSender)
+	for i, s := range senders {
+		if s.id != id {
+			continue
+		}
+		left := make([]*trackSender, 0, len(senders)-1)
+		left = append(left, senders[:i]...)
+		t.senders.Store(append(left, senders[i+1:]...))
+		close(s.done)
+		return nil
+	}
+	return webrtc.ErrUnbindFailed
+}
+
+// send sends packets to the peer connection of s as they are written until it's unbound.
+func (t *Track) send(s *trackSender) {
+	var packet rtp.Packet
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wakes:
+		}
+		for {
+			head := atomic.LoadUint64(&t.head)
+			if s.next >= head {
+				break
+			}
+			if head-s.next > trackRingSize {
+				t.skipped.Add(head - s.next - trackRingSize)
+				s.next = head - trackRingSize
+			}
+			p, _ := t.ring[s.next%trackRingSize].Load().(*trackPacket)
+			if p == nil || p.n < s.next {
+				// The packet is not stored yet by a concurrent write, which wakes s once it is.
+				break
+			}
+			if p.n > s.next {
+				// The slot is overwritten meanwhile, s is lapped, so it skips to the oldest packet kept.
+				continue
+			}
+			s.next++
+			if err := packet.Unmarshal(p.data); err != nil {
+				continue
+			}
+			// Packets are shared by subscribers, only the header unmarshaled for s is rewritten.
+			packet.Header.SSRC = s.ssrc
+			packet.Header.PayloadType = s.payloadType
+			// Errors are of the peer connection of s, e.g. it's closing, which is unbound soon.
+			_, _ = s.stream.WriteRTP(&packet.Header, packet.Payload)
+		}
+	}
+}
+
+// trackSender sends packets of a Track to a peer connection bound to it.
+type trackSender struct {
+	id          string
+	ssrc        uint32
+	payloadType uint8
+	stream      webrtc.TrackLocalWriter
+
+	// next is the index of the next packet to send, it's used by the goroutine sending packets only.
+	next  uint64
+	wakes chan struct{}
+	done  chan struct{}
+}
+
+// wake tells s new packets are written, wakes are merged if s is busy.
+func (s *trackSender) wake() {
+	select {
+	case s.wakes <- struct{}{}:
+	default:
+	}
+}
+
+func codecKind(codec webrtc.RTPCodecCapability) webrtc.RTPCodecType {
+	switch mime := strings.ToLower(codec.MimeType); {
+	case strings.HasPrefix(mime, "audio/"):
+		return webrtc.RTPCodecTypeAudio
+	case strings.HasPrefix(mime, "video/"):
+		return webrtc.RTPCodecTypeVideo
+	default:
+		return webrtc.RTPCodecType(0)
+	}
+}
+
+// matchCodec returns the codec of negotiated codecs matching codec, one of the same MIME type and fmtp line if
+// any, or of the same MIME type otherwise.
+func matchCodec(codec webrtc.RTPCodecCapability, negotiated []webrtc.RTPCodecParameters) (webrtc.RTPCodecParameters, bool) {
+	var partial *webrtc.RTPCodecParameters
+	for i, c := range negotiated {
+		if !strings.EqualFold(c.MimeType, codec.MimeType) {
+			continue
+		}
+		if c.SDPFmtpLine == codec.SDPFmtpLine {
+			return c, true
+		}
+		if partial == nil {
+			partial = &negotiated[i]
+		}
+	}
+	if partial == nil {
+		return webrtc.RTPCodecParameters{}, false
+	}
+	return *partial, true
+}
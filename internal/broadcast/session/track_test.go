@@ -0,0 +1,239 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// testStream is a webrtc.TrackLocalWriter calling writeRTP with packets sent to it.
+type testStream struct {
+	writeRTP func(header *rtp.Header, payload []byte)
+}
+
+func (s *testStream) WriteRTP(header *rtp.Header, payload []byte) (int, error) {
+	s.writeRTP(header, payload)
+	return header.MarshalSize() + len(payload), nil
+}
+
+func (s *testStream) Write(b []byte) (int, error) {
+	var packet rtp.Packet
+	if err := packet.Unmarshal(b); err != nil {
+		return 0, err
+	}
+	return s.WriteRTP(&packet.Header, packet.Payload)
+}
+
+func newTestTrack(t testing.TB) *Track {
+	t.Helper()
+	track, err := NewTrack(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}, "video", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return track
+}
+
+func testPacket(seq uint16) []byte {
+	b, err := (&rtp.Packet{
+		Header:  rtp.Header{Version: 2, SequenceNumber: seq, SSRC: 1, PayloadType: 96},
+		Payload: []byte(strconv.Itoa(int(seq))),
+	}).Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestTrackWriteUnbound(t *testing.T) {
+	track := newTestTrack(t)
+	if _, err := track.Write(testPacket(0)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("Write() error = %v, want %v", err, io.ErrClosedPipe)
+	}
+	if _, err := track.Write([]byte{0x80}); !errors.Is(err, errShortPacket) {
+		t.Fatalf("Write() error = %v, want %v", err, errShortPacket)
+	}
+}
+
+func TestTrackForward(t *testing.T) {
+	track := newTestTrack(t)
+	if err := track.Forward(testPacket(0)); err != nil {
+		t.Fatalf("Forward() of unbound track error = %v, want nil", err)
+	}
+	if err := track.Forward([]byte{0x80}); !errors.Is(err, errShortPacket) {
+		t.Fatalf("Forward() error = %v, want %v", err, errShortPacket)
+	}
+
+	sent := make(chan uint16, 1)
+	track.bind(&trackSender{id: "a", stream: &testStream{writeRTP: func(header *rtp.Header, _ []byte) {
+		sent <- header.SequenceNumber
+	}}})
+	defer func() { _ = track.unbind("a") }()
+	if err := track.Forward(testPacket(1)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case seq := <-sent:
+		if seq != 1 {
+			t.Fatalf("sent packet %d, want 1", seq)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+// TestTrackSkip tests a sender falling behind by more than the ring skips to the oldest packet kept.
+func TestTrackSkip(t *testing.T) {
+	track := newTestTrack(t)
+
+	const written = 2*trackRingSize + 10
+	var (
+		received []uint16
+		blocked  = make(chan struct{})
+		block    = make(chan struct{})
+		done     = make(chan struct{})
+	)
+	track.bind(&trackSender{
+		id:          "slow",
+		ssrc:        2,
+		payloadType: 102,
+		stream: &testStream{writeRTP: func(header *rtp.Header, payload []byte) {
+			if header.SSRC != 2 || header.PayloadType != 102 {
+				t.Errorf("header SSRC = %d, payload type = %d, want 2, 102", header.SSRC, header.PayloadType)
+			}
+			if string(payload) != strconv.Itoa(int(header.SequenceNumber)) {
+				t.Errorf("payload of packet %d = %q", header.SequenceNumber, payload)
+			}
+			received = append(received, header.SequenceNumber)
+			if len(received) == 1 {
+				// Block the sender on the first packet so it falls behind.
+				close(blocked)
+				<-block
+			}
+			if header.SequenceNumber == written-1 {
+				close(done)
+			}
+		}},
+	})
+	defer func() { _ = track.unbind("slow") }()
+
+	if _, err := track.Write(testPacket(0)); err != nil {
+		t.Fatal(err)
+	}
+	<-blocked
+	for seq := uint16(1); seq < written; seq++ {
+		if _, err := track.Write(testPacket(seq)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(block)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+
+	if len(received) != trackRingSize+1 {
+		t.Fatalf("received %d packets, want %d", len(received), trackRingSize+1)
+	}
+	if received[0] != 0 {
+		t.Fatalf("first packet = %d, want 0", received[0])
+	}
+	for i, seq := range received[1:] {
+		if want := uint16(written - trackRingSize + i); seq != want {
+			t.Fatalf("packet %d = %d, want %d", i+1, seq, want)
+		}
+	}
+}
+
+// TestTrackLapped tests a sender lapped by concurrent writes sends packets in order, each of them intact, and
+// catches up with the last packet written.
+func TestTrackLapped(t *testing.T) {
+	track := newTestTrack(t)
+
+	const written = 20 * trackRingSize
+	var (
+		mu   sync.Mutex
+		last = -1
+		done = make(chan struct{})
+	)
+	track.bind(&trackSender{
+		id: "lapped",
+		stream: &testStream{writeRTP: func(header *rtp.Header, payload []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+			seq := int(header.SequenceNumber)
+			if seq <= last {
+				t.Errorf("packet %d sent after %d", seq, last)
+			}
+			if string(payload) != strconv.Itoa(seq) {
+				t.Errorf("payload of packet %d = %q", seq, payload)
+			}
+			last = seq
+			if seq%64 == 0 {
+				// Fall behind the writer now and then.
+				time.Sleep(time.Millisecond)
+			}
+			if seq == written-1 {
+				close(done)
+			}
+		}},
+	})
+	defer func() { _ = track.unbind("lapped") }()
+
+	for seq := uint16(0); seq < written; seq++ {
+		if _, err := track.Write(testPacket(seq)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		mu.Lock()
+		defer mu.Unlock()
+		t.Fatalf("timed out, last packet sent is %d", last)
+	}
+}
+
+func TestTrackUnbind(t *testing.T) {
+	track := newTestTrack(t)
+	track.bind(&trackSender{id: "a", stream: &testStream{writeRTP: func(*rtp.Header, []byte) {}}})
+	if err := track.unbind("b"); !errors.Is(err, webrtc.ErrUnbindFailed) {
+		t.Fatalf("unbind() error = %v, want %v", err, webrtc.ErrUnbindFailed)
+	}
+	if err := track.unbind("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := track.Write(testPacket(0)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("Write() error = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func BenchmarkTrackWrite(b *testing.B) {
+	for _, n := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("senders=%d", n), func(b *testing.B) {
+			track := newTestTrack(b)
+			for i := 0; i < n; i++ {
+				id := strconv.Itoa(i)
+				track.bind(&trackSender{id: id, stream: &testStream{writeRTP: func(*rtp.Header, []byte) {}}})
+				defer func() { _ = track.unbind(id) }()
+			}
+			packet := testPacket(0)
+
+			b.ReportAllocs()
+			b.SetBytes(int64(len(packet)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := track.Write(packet); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
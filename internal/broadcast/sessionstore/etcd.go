@@ -0,0 +1,65 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/kv"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// EtcdStore stores metadata of sessions in etcd, attached to leases of their TTL.
+type EtcdStore struct {
+	client *kv.Etcd
+}
+
+func newEtcdStoreFromURL(u *url.URL) (*EtcdStore, error) {
+	client, err := kv.NewEtcd(u)
+	if err != nil {
+		return nil, err
+	}
+	return &EtcdStore{client: client}, nil
+}
+
+// Put implements session.SessionStore.
+func (s *EtcdStore) Put(ctx context.Context, md session.Metadata, ttl time.Duration) error {
+	value, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	return s.client.Put(ctx, storeKey(md.Key()), value, ttl)
+}
+
+// Delete implements session.SessionStore. Metadata is deleted only if it's still the one read, so it's kept
+// if another instance puts a newer one meanwhile.
+func (s *EtcdStore) Delete(ctx context.Context, key session.Key, instance string) error {
+	value, ok, err := s.client.Get(ctx, storeKey(key))
+	if err != nil || !ok {
+		return err
+	}
+	var md session.Metadata
+	if err := json.Unmarshal(value, &md); err != nil || md.Instance != instance {
+		return nil
+	}
+	return s.client.DeleteIf(ctx, storeKey(key), value)
+}
+
+// List implements session.SessionStore.
+func (s *EtcdStore) List(ctx context.Context) ([]session.Metadata, error) {
+	values, err := s.client.List(ctx, keyPrefix)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]session.Metadata, 0, len(values))
+	for _, value := range values {
+		var md session.Metadata
+		if err := json.Unmarshal(value, &md); err != nil {
+			return nil, fmt.Errorf("could not unmarshal session metadata: %w", err)
+		}
+		list = append(list, md)
+	}
+	return list, nil
+}
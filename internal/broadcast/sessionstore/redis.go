@@ -0,0 +1,95 @@
+package sessionstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/kv"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// redisScanCount is the hint of keys scanned by a SCAN.
+const redisScanCount = "100"
+
+// redisDeleteScript deletes metadata only if it's put by the given instance, atomically.
+const redisDeleteScript = `local v = redis.call('GET', KEYS[1])
+if v and cjson.decode(v).instance == ARGV[1] then return redis.call('DEL', KEYS[1]) end
+return 0`
+
+// RedisStore stores metadata of sessions in Redis, expiring with their TTL.
+type RedisStore struct {
+	client *kv.Redis
+}
+
+func newRedisStoreFromURL(u *url.URL) (*RedisStore, error) {
+	client, err := kv.NewRedis(u)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Put implements session.SessionStore.
+func (s *RedisStore) Put(ctx context.Context, md session.Metadata, ttl time.Duration) error {
+	value, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Do(ctx, "SET", storeKey(md.Key()), string(value), "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Delete implements session.SessionStore.
+func (s *RedisStore) Delete(ctx context.Context, key session.Key, instance string) error {
+	_, err := s.client.Do(ctx, "EVAL", redisDeleteScript, "1", storeKey(key), instance)
+	return err
+}
+
+// List implements session.SessionStore. Keys are scanned, then their metadata is got by MGET, metadata
+// expired meanwhile is skipped.
+func (s *RedisStore) List(ctx context.Context) ([]session.Metadata, error) {
+	var list []session.Metadata
+	cursor := "0"
+	for {
+		reply, err := s.client.DoArray(ctx, "SCAN", cursor, "MATCH", keyPrefix+"*", "COUNT", redisScanCount)
+		if err != nil {
+			return nil, err
+		}
+		if len(reply) != 2 {
+			return nil, fmt.Errorf("redis: unexpected SCAN reply of %d elements", len(reply))
+		}
+		next, _ := reply[0].(string)
+		keys, _ := reply[1].([]interface{})
+		if len(keys) > 0 {
+			args := []string{"MGET"}
+			for _, key := range keys {
+				if key, ok := key.(string); ok {
+					args = append(args, key)
+				}
+			}
+			values, err := s.client.DoArray(ctx, args...)
+			if err != nil {
+				return nil, err
+			}
+			for _, value := range values {
+				value, ok := value.(string)
+				if !ok {
+					continue
+				}
+				var md session.Metadata
+				if err := json.Unmarshal([]byte(value), &md); err != nil {
+					return nil, fmt.Errorf("could not unmarshal session metadata: %w", err)
+				}
+				list = append(list, md)
+			}
+		}
+		if next == "" || next == "0" {
+			return list, nil
+		}
+		cursor = next
+	}
+}
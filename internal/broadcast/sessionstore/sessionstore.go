@@ -0,0 +1,132 @@
+// Package sessionstore shares metadata of sessions published to this instance through a session.SessionStore,
+// in memory by default or in Redis or etcd shared by instances, as a step toward instances serving sessions of
+// each other. Tracks of sessions stay local, only metadata telling which instance publishes a session is shared.
+package sessionstore
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultTTL = 30 * time.Second
+
+	storeTimeout = 5 * time.Second
+)
+
+// Registry puts metadata of local sessions to a store as they come and go. Metadata is put again every third
+// of TTL, so metadata of a failed instance expires in TTL.
+type Registry struct {
+	logger   zerolog.Logger
+	store    session.SessionStore
+	sessions *session.SessionManager
+	instance string
+	ttl      time.Duration
+}
+
+// New returns a new Registry of sessions to the store of config.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.SessionConfigOptions) (*Registry, error) {
+	store, err := NewStore(config.Store)
+	if err != nil {
+		return nil, err
+	}
+	if config.StoreTTL <= 0 {
+		config.StoreTTL = defaultTTL
+	}
+	if config.StoreInstance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("could not get hostname as instance: %w", err)
+		}
+		config.StoreInstance = hostname
+	}
+	return &Registry{
+		logger:   loglevel.Default.Component(logger, "SessionStore").With().Str("instance", config.StoreInstance).Logger(),
+		store:    store,
+		sessions: sessions,
+		instance: config.StoreInstance,
+		ttl:      config.StoreTTL,
+	}, nil
+}
+
+// Run puts metadata of local sessions as they come and go until ctx is done.
+func (r *Registry) Run(ctx context.Context) {
+	events, stop := r.sessions.Watch()
+	defer stop()
+	ticker := time.NewTicker(r.ttl / 3)
+	defer ticker.Stop()
+
+	registered := make(map[session.Key]*session.Session)
+	r.sync(ctx, registered, false)
+	for {
+		select {
+		case <-ctx.Done():
+			// Metadata is left to expire, as a standby may take over sessions meanwhile.
+			return
+		case <-ticker.C:
+			r.sync(ctx, registered, true)
+		case event := <-events:
+			switch event.Type {
+			case session.EventCreated, session.EventReplaced, session.EventClosed:
+				r.sync(ctx, registered, false)
+			}
+		}
+	}
+}
+
+// List returns metadata of sessions of all instances sharing the store.
+func (r *Registry) List(ctx context.Context) ([]session.Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	return r.store.List(ctx)
+}
+
+// sync puts metadata of local sessions not registered yet or replaced, or all of them if refresh is set,
+// and deletes metadata of sessions gone. Sessions are listed rather than tracked by events, as events may
+// be dropped while the store is slow.
+func (r *Registry) sync(ctx context.Context, registered map[session.Key]*session.Session, refresh bool) {
+	live := make(map[session.Key]*session.Session)
+	for _, sess := range r.sessions.List() {
+		// Sessions relayed from other instances are put by their origins.
+		if sess.Origin != "" {
+			continue
+		}
+		live[sess.Key] = sess
+	}
+	for key, sess := range live {
+		if registered[key] != sess || refresh {
+			r.put(ctx, sess)
+			registered[key] = sess
+		}
+	}
+	for key := range registered {
+		if _, ok := live[key]; !ok {
+			r.delete(ctx, key)
+			delete(registered, key)
+		}
+	}
+}
+
+func (r *Registry) put(ctx context.Context, sess *session.Session) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	if err := r.store.Put(ctx, sess.Metadata(r.instance, time.Now()), r.ttl); err != nil {
+		r.logger.Err(err).Str("id", sess.ID).Msg("could not put session metadata")
+	}
+}
+
+func (r *Registry) delete(ctx context.Context, key session.Key) {
+	ctx, cancel := context.WithTimeout(ctx, storeTimeout)
+	defer cancel()
+	if err := r.store.Delete(ctx, key, r.instance); err != nil {
+		r.logger.Err(err).Str("id", key.String()).Msg("could not delete session metadata")
+	}
+}
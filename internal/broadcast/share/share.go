@@ -0,0 +1,320 @@
+// Package share mints sharing links of streams, e.g. operators sharing a stream with a customer for a demo.
+// A link lets anyone holding it watch one track source of one machine within a time window, optionally from
+// some networks only and by a limited number of concurrent viewers. The link is a subscriber token scoped to
+// the stream, and it's kept by this server too, so it's revoked at once by removing it.
+package share
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+)
+
+var (
+	// ErrRevoked is returned if the link of a token is revoked, expired or minted by another instance.
+	ErrRevoked = errors.New("sharing link revoked or expired")
+	// ErrNotStarted is returned if the time window of a link is not started yet.
+	ErrNotStarted = errors.New("sharing link not valid yet")
+	// ErrNetwork is returned if a viewer is not in networks of a link.
+	ErrNetwork = errors.New("sharing link not valid from this network")
+	// ErrMaxViewers is returned if a link already has its max viewers.
+	ErrMaxViewers = errors.New("max viewers of sharing link reached")
+)
+
+// Link is a sharing link of a stream.
+type Link struct {
+	ID          string         `json:"id"`
+	MachineID   string         `json:"machine_id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	// NotBefore and ExpiresAt are the time window of the link.
+	NotBefore time.Time `json:"not_before"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MaxViewers is the max concurrent viewers of the link, 0 means unlimited.
+	MaxViewers int `json:"max_viewers,omitempty"`
+	// Networks are CIDRs viewers of the link must be in, empty means anywhere.
+	Networks []string `json:"networks,omitempty"`
+	// Viewers are concurrent viewers of the link.
+	Viewers int `json:"viewers"`
+
+	networks []*net.IPNet
+	// kicks close peer connections of viewers once the link is revoked.
+	kicks map[int]func()
+	next  int
+}
+
+// Minted is a link just minted with its token.
+type Minted struct {
+	Link
+	Token string `json:"token"`
+	// URL is the base URL of sharing links with the token and the stream in query, empty if there is no base URL.
+	URL string `json:"url,omitempty"`
+}
+
+// Links are sharing links minted by this server.
+type Links struct {
+	auth   *auth.Authenticator
+	config cfg.ShareConfigOptions
+
+	mu    sync.Mutex
+	links map[string]*Link
+}
+
+// New returns new Links minting tokens by a, it returns nil if a is nil, as tokens of links couldn't be verified
+// without auth. A nil Links checks no links.
+func New(a *auth.Authenticator, config cfg.ShareConfigOptions) *Links {
+	if a == nil {
+		return nil
+	}
+	return &Links{
+		auth:   a,
+		config: config,
+		links:  make(map[string]*Link),
+	}
+}
+
+// Mint mints a link of the stream of meta valid from notBefore for ttl, capped by ShareMaxTTL. A zero notBefore
+// starts it at now. Viewers are limited by maxViewers and networks if given.
+func (l *Links) Mint(meta *pb.Meta, notBefore time.Time, ttl time.Duration, maxViewers int, networks []string, now time.Time) (*Minted, error) {
+	if ttl <= 0 {
+		return nil, errors.New("ttl must be positive")
+	}
+	if l.config.ShareMaxTTL > 0 && ttl > l.config.ShareMaxTTL {
+		return nil, fmt.Errorf("ttl must not exceed %s", l.config.ShareMaxTTL)
+	}
+	if maxViewers < 0 {
+		return nil, errors.New("max viewers must not be negative")
+	}
+	if notBefore.IsZero() {
+		notBefore = now
+	}
+	link := &Link{
+		ID:          newID(),
+		MachineID:   meta.Id,
+		TrackSource: meta.TrackSource,
+		NotBefore:   notBefore.UTC().Truncate(time.Second),
+		ExpiresAt:   notBefore.Add(ttl).UTC().Truncate(time.Second),
+		MaxViewers:  maxViewers,
+		Networks:    networks,
+		kicks:       make(map[int]func()),
+	}
+	for _, network := range networks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", network, err)
+		}
+		link.networks = append(link.networks, ipNet)
+	}
+
+	// Viewers of a stream namespaced by a tenant are of the tenant, as required if multi-tenant.
+	owner, _ := tenant.Split(meta.Id)
+	token, err := l.auth.Sign(&auth.Claims{
+		Subject:   "share:" + link.ID,
+		Tenant:    owner,
+		ExpiresAt: link.ExpiresAt.Unix(),
+		NotBefore: link.NotBefore.Unix(),
+		Share:     link.ID,
+		Streams:   []auth.Stream{{ID: meta.Id, TrackSources: []pb.TrackSource{meta.TrackSource}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not sign token of sharing link: %w", err)
+	}
+
+	l.mu.Lock()
+	l.links[link.ID] = link
+	minted := &Minted{Link: link.snapshot(), Token: token}
+	l.mu.Unlock()
+
+	if l.config.ShareBaseURL != "" {
+		u, err := url.Parse(l.config.ShareBaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base URL of sharing links: %w", err)
+		}
+		q := u.Query()
+		q.Set("token", token)
+		q.Set("id", meta.Id)
+		q.Set("track_source", strconv.Itoa(int(meta.TrackSource)))
+		u.RawQuery = q.Encode()
+		minted.URL = u.String()
+	}
+	return minted, nil
+}
+
+// List returns links not expired, ordered by expiry. It returns nil on a nil Links.
+func (l *Links) List(now time.Time) []Link {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	list := make([]Link, 0, len(l.links))
+	for _, link := range l.links {
+		if now.Before(link.ExpiresAt) {
+			list = append(list, link.snapshot())
+		}
+	}
+	l.mu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].ExpiresAt.Equal(list[j].ExpiresAt) {
+			return list[i].ExpiresAt.Before(list[j].ExpiresAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Revoke removes the link of id and closes peer connections of its viewers, it reports whether it's found.
+// Viewers of a link are closed once it expires as well, see Run.
+func (l *Links) Revoke(id string) bool {
+	if l == nil {
+		return false
+	}
+	var kicks []func()
+	l.mu.Lock()
+	link, ok := l.links[id]
+	if ok {
+		delete(l.links, id)
+		for _, kick := range link.kicks {
+			kicks = append(kicks, kick)
+		}
+	}
+	l.mu.Unlock()
+	for _, kick := range kicks {
+		kick()
+	}
+	return ok
+}
+
+// Check returns an error if the link of claims is revoked, not in its time window, or remoteAddr is not in its
+// networks. Claims not of a link are not checked.
+func (l *Links) Check(claims *auth.Claims, remoteAddr string, now time.Time) error {
+	if l == nil || claims == nil || claims.Share == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err := l.check(claims.Share, remoteAddr, now)
+	return err
+}
+
+// Join checks claims as Check, and counts the viewer of claims until done is closed. Once the link is revoked,
+// kick is called to close the viewer. It returns ErrMaxViewers if the link already has its max viewers.
+func (l *Links) Join(claims *auth.Claims, remoteAddr string, done <-chan struct{}, kick func(), now time.Time) error {
+	if l == nil || claims == nil || claims.Share == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	link, err := l.check(claims.Share, remoteAddr, now)
+	if err != nil {
+		return err
+	}
+	if link.MaxViewers > 0 && link.Viewers >= link.MaxViewers {
+		return ErrMaxViewers
+	}
+	link.Viewers++
+	i := link.next
+	link.next++
+	link.kicks[i] = kick
+	go func() {
+		<-done
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		link.Viewers--
+		delete(link.kicks, i)
+	}()
+	return nil
+}
+
+// check returns the link of id if remoteAddr may watch it at now. l.mu must be held.
+func (l *Links) check(id, remoteAddr string, now time.Time) (*Link, error) {
+	link, ok := l.links[id]
+	if !ok || !now.Before(link.ExpiresAt) {
+		return nil, ErrRevoked
+	}
+	if now.Before(link.NotBefore) {
+		return nil, ErrNotStarted
+	}
+	if len(link.networks) == 0 {
+		return link, nil
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range link.networks {
+		if ip != nil && network.Contains(ip) {
+			return link, nil
+		}
+	}
+	return nil, ErrNetwork
+}
+
+// Run removes expired links and closes their viewers every second until ctx is done. It does nothing on a nil Links.
+func (l *Links) Run(ctx context.Context) {
+	if l == nil {
+		return
+	}
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			l.expire(now)
+		}
+	}
+}
+
+func (l *Links) expire(now time.Time) {
+	var kicks []func()
+	l.mu.Lock()
+	for id, link := range l.links {
+		if now.Before(link.ExpiresAt) {
+			continue
+		}
+		delete(l.links, id)
+		for _, kick := range link.kicks {
+			kicks = append(kicks, kick)
+		}
+	}
+	l.mu.Unlock()
+	for _, kick := range kicks {
+		kick()
+	}
+}
+
+// snapshot returns a copy of exported fields of link. Links.mu must be held.
+func (link *Link) snapshot() Link {
+	return Link{
+		ID:          link.ID,
+		MachineID:   link.MachineID,
+		TrackSource: link.TrackSource,
+		NotBefore:   link.NotBefore,
+		ExpiresAt:   link.ExpiresAt,
+		MaxViewers:  link.MaxViewers,
+		Networks:    append([]string(nil), link.Networks...),
+		Viewers:     link.Viewers,
+	}
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
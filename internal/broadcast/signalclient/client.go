@@ -0,0 +1,157 @@
+// Package signalclient is a client of WebSocket signaling of subscribers. Relays, canary probes and load tests
+// subscribe to streams through it as browsers do.
+package signalclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+)
+
+// Message is a WebSocket signaling message of subscriber.
+type Message struct {
+	Event string          `json:"event"`
+	ID    string          `json:"id"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Client is a WebSocket signaling connection of a subscriber.
+type Client struct {
+	conn *websocket.Conn
+}
+
+// Dial connects to signaling URL u, e.g. "wss://example.com/v1/broadcast/signal?token=xxx".
+func Dial(ctx context.Context, u string) (*Client, error) {
+	conn, _, err := websocket.Dial(ctx, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not dial signaling: %w", err)
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Send sends a message of event, data is marshaled to JSON. Messages are identified by the time they are sent.
+func (c *Client) Send(ctx context.Context, event string, data interface{}) error {
+	return c.SendID(ctx, event, strconv.FormatInt(time.Now().UnixNano(), 10), data)
+}
+
+// SendID sends a message of event identified by id, data is marshaled to JSON.
+func (c *Client) SendID(ctx context.Context, event, id string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("could not marshal data: %w", err)
+	}
+	return wsjson.Write(ctx, c.conn, &Message{
+		Event: event,
+		ID:    id,
+		Data:  b,
+	})
+}
+
+// Recv receives a message, it blocks until a message arrives or ctx is done.
+func (c *Client) Recv(ctx context.Context) (*Message, error) {
+	var msg Message
+	if err := wsjson.Read(ctx, c.conn, &msg); err != nil {
+		return nil, fmt.Errorf("could not read message: %w", err)
+	}
+	return &msg, nil
+}
+
+// Offer sends the local description of peerConnection as the offer subscribing to the stream of meta.
+func (c *Client) Offer(ctx context.Context, meta *pb.Meta, peerConnection *webrtc.PeerConnection) error {
+	sdp, err := json.Marshal(peerConnection.LocalDescription())
+	if err != nil {
+		return err
+	}
+	if err := c.Send(ctx, "video-offer", &pb.SessionDescription{Meta: meta, Sdp: string(sdp)}); err != nil {
+		return fmt.Errorf("could not send offer: %w", err)
+	}
+	return nil
+}
+
+// Signal handles signaling messages of the offer sent until an error occurs or ctx is done. The answer is set
+// on peerConnection, and answered is called with it before if not nil. Candidates arrived before the answer
+// are added after it, and answers after the first one are ignored. An error event ends signaling with
+// *httpx.Error.
+func (c *Client) Signal(
+	ctx context.Context,
+	peerConnection *webrtc.PeerConnection,
+	answered func(answer *webrtc.SessionDescription) error,
+) error {
+	var (
+		done    bool
+		pending []webrtc.ICECandidateInit
+	)
+	for {
+		msg, err := c.Recv(ctx)
+		if err != nil {
+			return err
+		}
+
+		switch msg.Event {
+		case "video-answer":
+			if done {
+				continue
+			}
+			var answer pb.SessionDescription
+			if err := json.Unmarshal(msg.Data, &answer); err != nil {
+				return fmt.Errorf("could not unmarshal answer: %w", err)
+			}
+			var sdp webrtc.SessionDescription
+			if err := json.Unmarshal([]byte(answer.Sdp), &sdp); err != nil {
+				return fmt.Errorf("could not unmarshal sdp: %w", err)
+			}
+			if answered != nil {
+				if err := answered(&sdp); err != nil {
+					return err
+				}
+			}
+			if err := peerConnection.SetRemoteDescription(sdp); err != nil {
+				return fmt.Errorf("could not set remote description: %w", err)
+			}
+			done = true
+			for _, candidate := range pending {
+				if err := peerConnection.AddICECandidate(candidate); err != nil {
+					return fmt.Errorf("could not add candidate: %w", err)
+				}
+			}
+			pending = nil
+		case "new-ice-candidate":
+			var candidate pb.ICECandidate
+			if err := json.Unmarshal(msg.Data, &candidate); err != nil {
+				return fmt.Errorf("could not unmarshal candidate: %w", err)
+			}
+			var candidateInit webrtc.ICECandidateInit
+			if err := json.Unmarshal([]byte(candidate.Candidate), &candidateInit); err != nil {
+				return fmt.Errorf("could not unmarshal JSON candidate: %w", err)
+			}
+			if !done {
+				pending = append(pending, candidateInit)
+				continue
+			}
+			if err := peerConnection.AddICECandidate(candidateInit); err != nil {
+				return fmt.Errorf("could not add candidate: %w", err)
+			}
+		case "error":
+			var data httpx.Error
+			if err := json.Unmarshal(msg.Data, &data); err != nil {
+				return fmt.Errorf("could not unmarshal error: %w", err)
+			}
+			return fmt.Errorf("signaling error %w", &data)
+		default:
+		}
+	}
+}
+
+// Close closes the connection, which ends the subscription on the server.
+func (c *Client) Close() error {
+	return c.conn.Close(websocket.StatusNormalClosure, "")
+}
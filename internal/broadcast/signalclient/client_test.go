@@ -0,0 +1,106 @@
+package signalclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+	"nhooyr.io/websocket/wsjson"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+)
+
+// serve serves a signaling handler echoing messages received, and sending reply after the first echo if not nil,
+// and returns a client connected to it.
+func serve(t *testing.T, reply *Message) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close(websocket.StatusNormalClosure, "")
+		for {
+			var msg Message
+			if err := wsjson.Read(r.Context(), conn, &msg); err != nil {
+				return
+			}
+			if err := wsjson.Write(r.Context(), conn, &msg); err != nil {
+				return
+			}
+			if reply != nil {
+				if err := wsjson.Write(r.Context(), conn, reply); err != nil {
+					return
+				}
+				reply = nil
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestClientSendRecv(t *testing.T) {
+	client := serve(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.SendID(ctx, "ping", "1", map[string]int{"n": 1}); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := client.Recv(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Event != "ping" || msg.ID != "1" || string(msg.Data) != `{"n":1}` {
+		t.Fatalf("Recv() = %+v, want the message sent", msg)
+	}
+
+	if err := client.Send(ctx, "ping", nil); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = client.Recv(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID == "" {
+		t.Fatal("Send() sent a message without ID")
+	}
+}
+
+func TestClientSignalError(t *testing.T) {
+	data, err := json.Marshal(httpx.NewError(httpx.ErrMetadataNotMatched, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := serve(t, &Message{Event: "error", Data: data})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Send(ctx, "video-offer", nil); err != nil {
+		t.Fatal(err)
+	}
+	// The echo is an event of no interest, the error ends signaling.
+	err = client.Signal(ctx, nil, nil)
+	var signalErr *httpx.Error
+	if !errors.As(err, &signalErr) {
+		t.Fatalf("Signal() error = %v, want *httpx.Error", err)
+	}
+	if signalErr.Code != httpx.ErrMetadataNotMatched {
+		t.Fatalf("Signal() error code = %v, want %v", signalErr.Code, httpx.ErrMetadataNotMatched)
+	}
+}
@@ -0,0 +1,143 @@
+// Package slo tracks subscriber join latency against the service level objective,
+// that most viewers see video within a target latency after sending offer.
+package slo
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// maxJoins caps joins kept in window, older ones are dropped first if exceeded.
+const maxJoins = 100000
+
+// Tracker keeps joins in a sliding window in memory, they are lost on restart.
+type Tracker struct {
+	target    time.Duration
+	objective float64
+	window    time.Duration
+
+	mu    sync.Mutex
+	joins []join // In order of time.
+}
+
+// join is a subscriber join, latency is zero if it failed.
+type join struct {
+	time    time.Time
+	latency time.Duration
+	failed  bool
+}
+
+// Report summarizes joins in window.
+type Report struct {
+	Window    string  `json:"window"`
+	Target    string  `json:"target"`
+	Objective float64 `json:"objective"` // Ratio of joins expected within target.
+
+	Joins    int `json:"joins"`
+	Failures int `json:"failures"`
+	// Percentiles in milliseconds of successful joins.
+	P50 int64 `json:"p50_ms"`
+	P90 int64 `json:"p90_ms"`
+	P99 int64 `json:"p99_ms"`
+
+	// WithinTarget is ratio of joins within target, failures count as not.
+	WithinTarget float64 `json:"within_target"`
+	// Met reports whether the objective is met, it's true if there are no joins.
+	Met bool `json:"met"`
+}
+
+// New returns a new Tracker.
+func New(config cfg.SLOConfigOptions) *Tracker {
+	return &Tracker{
+		target:    config.JoinTarget,
+		objective: config.JoinObjective,
+		window:    config.Window,
+	}
+}
+
+// Observe records a successful join of latency.
+func (t *Tracker) Observe(latency time.Duration) {
+	t.add(join{time: time.Now(), latency: latency})
+}
+
+// Fail records a failed join.
+func (t *Tracker) Fail() {
+	t.add(join{time: time.Now(), failed: true})
+}
+
+func (t *Tracker) add(j join) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune(j.time)
+	if len(t.joins) >= maxJoins {
+		t.joins = t.joins[1:]
+	}
+	t.joins = append(t.joins, j)
+}
+
+// prune drops joins out of window, it must be called with mu held.
+func (t *Tracker) prune(now time.Time) {
+	i := sort.Search(len(t.joins), func(i int) bool {
+		return now.Sub(t.joins[i].time) <= t.window
+	})
+	if i > 0 {
+		t.joins = append(t.joins[:0], t.joins[i:]...)
+	}
+}
+
+// Report returns report of joins in window before now.
+func (t *Tracker) Report(now time.Time) Report {
+	t.mu.Lock()
+	t.prune(now)
+	latencies := make([]time.Duration, 0, len(t.joins))
+	var failures, within int
+	for _, j := range t.joins {
+		if j.failed {
+			failures++
+			continue
+		}
+		latencies = append(latencies, j.latency)
+		if j.latency <= t.target {
+			within++
+		}
+	}
+	t.mu.Unlock()
+
+	r := Report{
+		Window:       t.window.String(),
+		Target:       t.target.String(),
+		Objective:    t.objective,
+		Joins:        len(latencies) + failures,
+		Failures:     failures,
+		WithinTarget: 1,
+	}
+	if r.Joins > 0 {
+		r.WithinTarget = float64(within) / float64(r.Joins)
+	}
+	r.Met = r.WithinTarget >= t.objective
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	r.P50 = percentile(latencies, 0.5).Milliseconds()
+	r.P90 = percentile(latencies, 0.9).Milliseconds()
+	r.P99 = percentile(latencies, 0.99).Milliseconds()
+	return r
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies, it's zero if latencies is empty.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(p*float64(len(sorted))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
@@ -0,0 +1,325 @@
+package srt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+const (
+	// ackInterval is the interval of full ACKs, as libsrt sends them.
+	ackInterval = 10 * time.Millisecond
+	// nakInterval is the interval of periodic NAKs of packets still lost.
+	nakInterval = 20 * time.Millisecond
+	// keepaliveInterval is the max time without sending any packet to the caller.
+	keepaliveInterval = time.Second
+	// idleTimeout is the max time without receiving any packet from the caller.
+	idleTimeout = 5 * time.Second
+	// maxLossRanges caps ranges of a NAK, so it fits in a packet.
+	maxLossRanges = 128
+	// bufferSize is the available buffer told to the caller in ACKs, in packets.
+	bufferSize = 8192
+	// packetsQueue is the max packets queued for a connection before they are dropped.
+	packetsQueue = 1024
+)
+
+var (
+	errReplaced = errors.New("replaced by a new caller of the stream")
+	errIdle     = errors.New("no packet from caller in time")
+	errShutdown = errors.New("caller shut down")
+)
+
+// received is a data packet received out of order, waiting for packets before it.
+type received struct {
+	payload []byte
+	at      time.Time
+}
+
+// conn is an SRT connection of a caller, packets of it are handled by a single goroutine.
+type conn struct {
+	l        *Listener
+	id       uint32 // Local socket ID.
+	peerID   uint32
+	addr     net.Addr
+	meta     *pb.Meta
+	latency  time.Duration
+	logger   zerolog.Logger
+	accepted []byte // Handshake answering the conclusion, repeated if the caller repeats it.
+	start    time.Time
+
+	packets   chan []byte
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+
+	// next is the sequence number of the next packet to deliver, highest is the highest one received.
+	next, highest uint32
+	buffer        map[uint32]received
+	ackNumber     uint32
+	lastACKed     uint32
+	lastNAK       time.Time
+	lastSent      time.Time
+	lastReceived  time.Time
+	dropped       uint64
+}
+
+func newConn(l *Listener, addr net.Addr, peerID, isn uint32, meta *pb.Meta, latency time.Duration, logger *zerolog.Logger) *conn {
+	now := time.Now()
+	return &conn{
+		l:            l,
+		id:           l.newSocketID(),
+		peerID:       peerID,
+		addr:         addr,
+		meta:         meta,
+		latency:      latency,
+		logger:       logger.With().Str("id", meta.Id).Int32("track_source", int32(meta.TrackSource)).Logger(),
+		start:        now,
+		packets:      make(chan []byte, packetsQueue),
+		closing:      make(chan struct{}),
+		done:         make(chan struct{}),
+		next:         isn,
+		highest:      seqAdd(isn, -1),
+		buffer:       make(map[uint32]received),
+		lastACKed:    isn,
+		lastSent:     now,
+		lastReceived: now,
+	}
+}
+
+// push queues packet b of the connection, it's dropped if the queue is full.
+func (c *conn) push(b []byte) {
+	select {
+	case c.packets <- b:
+	default:
+	}
+}
+
+// close closes the connection, shutting down the caller.
+func (c *conn) close() {
+	c.closeOnce.Do(func() { close(c.closing) })
+}
+
+// serve publishes the stream of the caller until the connection is closed.
+func (c *conn) serve(ctx context.Context) error {
+	defer close(c.done)
+
+	videoTrack, audioTrack, err := webrtcx.CreateLocalTrack(webrtcx.DefaultCodecs())
+	if err != nil {
+		c.shutdown()
+		return fmt.Errorf("could not create webRTC local tracks: %w", err)
+	}
+	sess := session.New(c.l.sessions.Key(c.meta), c.meta, videoTrack, audioTrack)
+	c.l.sessions.Add(sess)
+	defer c.l.sessions.Remove(sess)
+
+	f := newForwarder(sess)
+	d := &demuxer{onAccessUnit: f.accessUnit}
+	deliver := func(payload []byte) error {
+		return d.write(payload)
+	}
+
+	ticker := time.NewTicker(ackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			c.shutdown()
+			return ctx.Err()
+		case <-c.closing:
+			c.shutdown()
+			return errReplaced
+		case b := <-c.packets:
+			c.lastReceived = time.Now()
+			if !isControl(b) {
+				seq := binary.BigEndian.Uint32(b[0:]) & seqMask
+				sess.Bitrate.Add(len(b) - headerSize)
+				sess.Quality.Observe(uint16(seq))
+				if err := c.receive(seq, b[headerSize:], deliver); err != nil {
+					c.shutdown()
+					return fmt.Errorf("could not forward: %w", err)
+				}
+				continue
+			}
+			switch controlType(b) {
+			case ctrlShutdown:
+				return errShutdown
+			case ctrlDropReq:
+				if len(b) >= headerSize+8 {
+					last := binary.BigEndian.Uint32(b[headerSize+4:]) & seqMask
+					if err := c.skip(seqAdd(last, 1), deliver); err != nil {
+						c.shutdown()
+						return fmt.Errorf("could not forward: %w", err)
+					}
+				}
+			default:
+				// Keepalives, ACKACKs and NAKs of nothing sent need no reply.
+			}
+		case now := <-ticker.C:
+			if now.Sub(c.lastReceived) > idleTimeout {
+				return errIdle
+			}
+			if err := c.drop(now, deliver); err != nil {
+				c.shutdown()
+				return fmt.Errorf("could not forward: %w", err)
+			}
+			c.ack()
+			if now.Sub(c.lastNAK) >= nakInterval {
+				c.nak(c.next, c.highest)
+			}
+			if now.Sub(c.lastSent) >= keepaliveInterval {
+				c.send(control(ctrlKeepalive, 0, c.timestamp(), c.peerID, make([]byte, 4)))
+			}
+		}
+	}
+}
+
+// receive buffers a data packet, delivers packets in order, and tells the caller loss of packets skipped.
+func (c *conn) receive(seq uint32, payload []byte, deliver func([]byte) error) error {
+	if seqDiff(seq, c.next) < 0 {
+		return nil // Late retransmission of a delivered or dropped packet.
+	}
+	if _, ok := c.buffer[seq]; ok {
+		return nil
+	}
+	if seqDiff(seq, c.next) >= bufferSize {
+		return nil // Far ahead of what may be buffered.
+	}
+	c.buffer[seq] = received{payload: payload, at: time.Now()}
+	if diff := seqDiff(seq, c.highest); diff > 0 {
+		if diff > 1 {
+			c.nak(seqAdd(c.highest, 1), seqAdd(seq, -1))
+		}
+		c.highest = seq
+	}
+	return c.deliver(deliver)
+}
+
+// deliver delivers packets in order from next, until one is missing.
+func (c *conn) deliver(deliver func([]byte) error) error {
+	for {
+		r, ok := c.buffer[c.next]
+		if !ok {
+			return nil
+		}
+		delete(c.buffer, c.next)
+		c.next = seqAdd(c.next, 1)
+		if err := deliver(r.payload); err != nil {
+			return err
+		}
+	}
+}
+
+// drop skips packets still lost once the earliest packet buffered after them has waited for latency,
+// as TLPKTDROP of libsrt does, so a lost packet stalls the stream at most for latency.
+func (c *conn) drop(now time.Time, deliver func([]byte) error) error {
+	if len(c.buffer) == 0 {
+		return nil
+	}
+	for seq := c.next; seqDiff(seq, c.highest) <= 0; seq = seqAdd(seq, 1) {
+		r, ok := c.buffer[seq]
+		if !ok {
+			continue
+		}
+		if now.Sub(r.at) < c.latency {
+			return nil
+		}
+		return c.skip(seq, deliver)
+	}
+	return nil
+}
+
+// skip gives up packets before seq, and delivers packets buffered from seq.
+func (c *conn) skip(seq uint32, deliver func([]byte) error) error {
+	diff := seqDiff(seq, c.next)
+	if diff <= 0 {
+		return nil
+	}
+	skipped := uint64(diff)
+	for s := range c.buffer {
+		if seqDiff(s, seq) < 0 {
+			delete(c.buffer, s)
+			skipped--
+		}
+	}
+	c.dropped += skipped
+	c.logger.Debug().Uint64("packets", skipped).Uint64("dropped", c.dropped).Msg("dropped SRT packets not recovered")
+	c.next = seq
+	if seqDiff(c.highest, seq) < 0 {
+		c.highest = seqAdd(seq, -1)
+	}
+	return c.deliver(deliver)
+}
+
+// ack sends a full ACK of packets received in order, if any more have been since the last one.
+func (c *conn) ack() {
+	if c.next == c.lastACKed {
+		return
+	}
+	c.lastACKed = c.next
+	c.ackNumber++
+	cif := make([]byte, 28)
+	binary.BigEndian.PutUint32(cif[0:], c.next)
+	binary.BigEndian.PutUint32(cif[4:], 100000) // RTT in microseconds, not measured.
+	binary.BigEndian.PutUint32(cif[8:], 50000)  // RTT variance.
+	binary.BigEndian.PutUint32(cif[12:], bufferSize-uint32(len(c.buffer)))
+	c.send(control(ctrlACK, c.ackNumber, c.timestamp(), c.peerID, cif))
+}
+
+// nak sends a NAK of packets missing in [from, to].
+func (c *conn) nak(from, to uint32) {
+	var cif []byte
+	ranges := 0
+	for seq := from; seqDiff(seq, to) <= 0 && ranges < maxLossRanges; seq = seqAdd(seq, 1) {
+		if _, ok := c.buffer[seq]; ok {
+			continue
+		}
+		last := seq
+		for seqDiff(last, to) < 0 {
+			if _, ok := c.buffer[seqAdd(last, 1)]; ok {
+				break
+			}
+			last = seqAdd(last, 1)
+		}
+		if last == seq {
+			cif = appendUint32(cif, seq)
+		} else {
+			cif = appendUint32(cif, seq|0x80000000)
+			cif = appendUint32(cif, last)
+		}
+		ranges++
+		seq = last
+	}
+	c.lastNAK = time.Now()
+	if len(cif) > 0 {
+		c.send(control(ctrlNAK, 0, c.timestamp(), c.peerID, cif))
+	}
+}
+
+// shutdown tells the caller the connection is closed.
+func (c *conn) shutdown() {
+	c.send(control(ctrlShutdown, 0, c.timestamp(), c.peerID, make([]byte, 4)))
+}
+
+func (c *conn) send(b []byte) {
+	c.lastSent = time.Now()
+	c.l.send(c.addr, b)
+}
+
+// timestamp returns the timestamp of packets sent, microseconds since the connection started.
+func (c *conn) timestamp() uint32 {
+	return uint32(time.Since(c.start) / time.Microsecond)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,72 @@
+package srt
+
+import (
+	"github.com/pion/randutil"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	// mtu is max RTP payload size of packetized video, so packets fit in UDP of subscriber peer connections.
+	mtu = 1200
+	// videoPayloadType is payload type of packetized video, tracks rewrite it for each subscriber.
+	videoPayloadType = 96
+)
+
+// forwarder packetizes access units demuxed from MPEG-TS into RTP to a session, as edge publisher sends it.
+// SPS and PPS are kept and put ahead of keyframes not carrying them, so subscribers joining at any keyframe
+// can decode it.
+type forwarder struct {
+	sess       *session.Session
+	packetizer rtpx.H264Packetizer
+	ssrc       uint32
+	sps, pps   []byte
+}
+
+func newForwarder(sess *session.Session) *forwarder {
+	random := randutil.NewMathRandomGenerator()
+	return &forwarder{
+		sess: sess,
+		packetizer: rtpx.H264Packetizer{
+			MTU:            mtu,
+			SequenceNumber: uint16(random.Uint32()),
+		},
+		ssrc: random.Uint32(),
+	}
+}
+
+// parameterSet keeps nalu if it's an SPS or PPS, and reports whether it's an SPS.
+func (f *forwarder) parameterSet(nalu []byte) bool {
+	switch nalu[0] & 0x1F {
+	case rtpx.NALUTypeSPS:
+		f.sps = nalu
+		return true
+	case rtpx.NALUTypePPS:
+		f.pps = nalu
+	}
+	return false
+}
+
+func (f *forwarder) accessUnit(au *rtpx.AccessUnit) error {
+	f.sess.Clock.Observe(au.Timestamp)
+	inBand := false
+	for _, nalu := range au.NALUs {
+		if f.parameterSet(nalu) {
+			inBand = true
+		}
+	}
+	if au.Keyframe() && !inBand && f.sps != nil && f.pps != nil {
+		au.NALUs = append([][]byte{f.sps, f.pps}, au.NALUs...)
+	}
+
+	for _, packet := range f.packetizer.Packetize(au) {
+		b := packet.Marshal(videoPayloadType, f.ssrc)
+		f.sess.Taps.Write(webrtc.RTPCodecTypeVideo, b)
+		if err := f.sess.VideoTrack.Forward(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
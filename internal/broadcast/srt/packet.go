@@ -0,0 +1,178 @@
+package srt
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// SRT packets, see https://datatracker.ietf.org/doc/html/draft-sharabayko-srt-01#section-3
+const (
+	headerSize    = 16
+	handshakeSize = 48
+	maxPacketSize = 1500
+
+	// seqMask masks 31 bits of sequence numbers.
+	seqMask = 0x7FFFFFFF
+)
+
+// Control types.
+const (
+	ctrlHandshake = 0x0000
+	ctrlKeepalive = 0x0001
+	ctrlACK       = 0x0002
+	ctrlNAK       = 0x0003
+	ctrlShutdown  = 0x0005
+	ctrlACKACK    = 0x0006
+	ctrlDropReq   = 0x0007
+)
+
+// Handshake types, rejections are told by handshake types of rejection codes.
+const (
+	hsInduction  = 0x00000001
+	hsConclusion = 0xFFFFFFFF
+
+	// srtMagic is the extension field of induction response, telling caller the listener speaks HSv5.
+	srtMagic = 0x4A17
+)
+
+// Handshake extension types and flags of extension field.
+const (
+	extHSReq = 1
+	extHSRsp = 2
+	extKMReq = 3
+	extSID   = 5
+
+	extFlagHSReq = 0x1
+)
+
+// SRT flags of HSREQ and HSRSP.
+const (
+	flagTSBPDSnd    = 0x01
+	flagTSBPDRcv    = 0x02
+	flagTLPktDrop   = 0x08
+	flagPeriodicNAK = 0x10
+	flagRexmit      = 0x20
+)
+
+// Rejection codes told to callers by handshake type.
+const (
+	rejVersion  = 1008 // HSv4 callers are not supported.
+	rejUnsecure = 1011 // Encryption is not supported.
+	rejNotFound = 1404 // Stream ID is not configured.
+)
+
+// srtVersion is the SRT version advertised in HSRSP, 1.5.0.
+const srtVersion = 0x010500
+
+var errShortPacket = errors.New("short packet")
+
+// handshake is the control information field of a handshake packet.
+type handshake struct {
+	version    uint32
+	encryption uint16
+	extension  uint16
+	isn        uint32 // Initial packet sequence number.
+	mtu        uint32
+	flowWindow uint32
+	typ        uint32
+	socketID   uint32
+	cookie     uint32
+	peerIP     [16]byte
+
+	// extensions are handshake extensions by type, only of conclusions.
+	extensions map[uint16][]byte
+}
+
+func parseHandshake(cif []byte) (*handshake, error) {
+	if len(cif) < handshakeSize {
+		return nil, errShortPacket
+	}
+	hs := &handshake{
+		version:    binary.BigEndian.Uint32(cif[0:]),
+		encryption: binary.BigEndian.Uint16(cif[4:]),
+		extension:  binary.BigEndian.Uint16(cif[6:]),
+		isn:        binary.BigEndian.Uint32(cif[8:]) & seqMask,
+		mtu:        binary.BigEndian.Uint32(cif[12:]),
+		flowWindow: binary.BigEndian.Uint32(cif[16:]),
+		typ:        binary.BigEndian.Uint32(cif[20:]),
+		socketID:   binary.BigEndian.Uint32(cif[24:]),
+		cookie:     binary.BigEndian.Uint32(cif[28:]),
+		extensions: make(map[uint16][]byte),
+	}
+	copy(hs.peerIP[:], cif[32:48])
+	for b := cif[handshakeSize:]; len(b) >= 4; {
+		typ, n := binary.BigEndian.Uint16(b[0:]), int(binary.BigEndian.Uint16(b[2:]))*4
+		if len(b) < 4+n {
+			return nil, errShortPacket
+		}
+		hs.extensions[typ] = b[4 : 4+n]
+		b = b[4+n:]
+	}
+	return hs, nil
+}
+
+func (hs *handshake) marshal() []byte {
+	b := make([]byte, handshakeSize)
+	binary.BigEndian.PutUint32(b[0:], hs.version)
+	binary.BigEndian.PutUint16(b[4:], hs.encryption)
+	binary.BigEndian.PutUint16(b[6:], hs.extension)
+	binary.BigEndian.PutUint32(b[8:], hs.isn)
+	binary.BigEndian.PutUint32(b[12:], hs.mtu)
+	binary.BigEndian.PutUint32(b[16:], hs.flowWindow)
+	binary.BigEndian.PutUint32(b[20:], hs.typ)
+	binary.BigEndian.PutUint32(b[24:], hs.socketID)
+	binary.BigEndian.PutUint32(b[28:], hs.cookie)
+	copy(b[32:48], hs.peerIP[:])
+	for typ, ext := range hs.extensions {
+		b = append(b, byte(typ>>8), byte(typ), byte(len(ext)/4>>8), byte(len(ext)/4))
+		b = append(b, ext...)
+	}
+	return b
+}
+
+// streamID decodes stream ID extension, whose bytes are reversed in each 32-bit word by libsrt.
+func streamID(ext []byte) string {
+	b := make([]byte, 0, len(ext))
+	for i := 0; i+4 <= len(ext); i += 4 {
+		b = append(b, ext[i+3], ext[i+2], ext[i+1], ext[i])
+	}
+	for len(b) > 0 && b[len(b)-1] == 0 {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
+
+// control returns a control packet of typ to socket dst.
+func control(typ uint16, info, timestamp, dst uint32, cif []byte) []byte {
+	b := make([]byte, headerSize, headerSize+len(cif))
+	binary.BigEndian.PutUint16(b[0:], 0x8000|typ)
+	binary.BigEndian.PutUint32(b[4:], info)
+	binary.BigEndian.PutUint32(b[8:], timestamp)
+	binary.BigEndian.PutUint32(b[12:], dst)
+	return append(b, cif...)
+}
+
+// isControl reports whether packet b is a control packet.
+func isControl(b []byte) bool {
+	return b[0]&0x80 != 0
+}
+
+// controlType returns the control type of control packet b.
+func controlType(b []byte) uint16 {
+	return binary.BigEndian.Uint16(b[0:]) & 0x7FFF
+}
+
+// destination returns the destination socket ID of packet b.
+func destination(b []byte) uint32 {
+	return binary.BigEndian.Uint32(b[12:])
+}
+
+// seqDiff returns a - b of 31-bit sequence numbers, wrapping around.
+func seqDiff(a, b uint32) int32 {
+	return int32((a-b)<<1) >> 1
+}
+
+// seqAdd returns sequence number a + n, wrapping around.
+func seqAdd(a uint32, n int32) uint32 {
+	return (a + uint32(n)) & seqMask
+}
@@ -0,0 +1,100 @@
+package srt
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	hs := &handshake{
+		version:    5,
+		extension:  extFlagHSReq,
+		isn:        0x12345678,
+		mtu:        maxPacketSize,
+		flowWindow: 8192,
+		typ:        hsConclusion,
+		socketID:   1,
+		cookie:     2,
+		peerIP:     [16]byte{127, 0, 0, 1},
+		extensions: map[uint16][]byte{extSID: {'e', 'v', 'i', 'l'}},
+	}
+	got, err := parseHandshake(hs.marshal())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, hs) {
+		t.Fatalf("parseHandshake() = %+v, want %+v", got, hs)
+	}
+}
+
+func TestParseHandshake(t *testing.T) {
+	b := (&handshake{version: 5, isn: 0xFFFFFFFF, typ: hsInduction}).marshal()
+	hs, err := parseHandshake(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hs.isn != seqMask {
+		t.Fatalf("ISN = %#x, want %#x", hs.isn, seqMask)
+	}
+
+	tests := []struct {
+		name string
+		cif  []byte
+	}{
+		{name: "short", cif: b[:handshakeSize-1]},
+		// An extension of 1 word without its content.
+		{name: "short extension", cif: append(b, 0, extHSReq, 0, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseHandshake(tt.cif); !errors.Is(err, errShortPacket) {
+				t.Fatalf("parseHandshake() error = %v, want %v", err, errShortPacket)
+			}
+		})
+	}
+}
+
+func TestStreamID(t *testing.T) {
+	tests := []struct {
+		ext  []byte
+		want string
+	}{
+		{[]byte("evil"), "live"},
+		{[]byte{'e', 'v', 'i', 'l', 0, 0, 'a', '/'}, "live/a"},
+		{[]byte("ab"), ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := streamID(tt.ext); got != tt.want {
+			t.Errorf("streamID(%q) = %q, want %q", tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestSeq(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want int32
+	}{
+		{10, 3, 7},
+		{3, 10, -7},
+		{1, seqMask, 2},
+		{seqMask, 1, -2},
+	}
+	for _, tt := range tests {
+		if got := seqDiff(tt.a, tt.b); got != tt.want {
+			t.Errorf("seqDiff(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := seqAdd(tt.b, tt.want); got != tt.a {
+			t.Errorf("seqAdd(%d, %d) = %d, want %d", tt.b, tt.want, got, tt.a)
+		}
+	}
+}
+
+func TestControl(t *testing.T) {
+	b := control(ctrlACK, 1, 2, 3, []byte{4})
+	if !isControl(b) || controlType(b) != ctrlACK || destination(b) != 3 || len(b) != headerSize+1 {
+		t.Fatalf("control() = % x", b)
+	}
+}
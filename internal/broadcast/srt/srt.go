@@ -0,0 +1,309 @@
+// Package srt ingests MPEG-TS over SRT from edge devices which can't run the edge WebRTC publisher, and registers
+// H264 video of them as sessions, so subscribers watch them as any edge stream. Edges call the listener in SRT
+// caller mode with a stream ID configured as a track source of a machine, e.g. by
+// "ffmpeg -re -i input.mp4 -c:v libx264 -f mpegts srt://host:port?streamid=drone-1".
+//
+// Only what live ingest needs of SRT is implemented: HSv5 handshake, ACK and NAK based retransmission, and dropping
+// of packets not recovered in latency. Encryption is not supported, and audio is not forwarded, as MPEG-TS carries
+// AAC while browsers expect Opus.
+// See: https://datatracker.ietf.org/doc/html/draft-sharabayko-srt-01
+package srt
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultLatency = 120 * time.Millisecond
+	// cookiePeriod is the period of SYN cookies, a cookie is valid in its period and the next one.
+	cookiePeriod = time.Minute
+)
+
+// Listener accepts SRT callers publishing configured streams.
+type Listener struct {
+	logger   zerolog.Logger
+	sessions *session.SessionManager
+	latency  time.Duration
+	// streams are track sources of machines by SRT stream ID.
+	streams map[string]*pb.Meta
+	// secret signs SYN cookies, so handshakes of spoofed addresses are not accepted.
+	secret [32]byte
+	pc     net.PacketConn
+
+	mu sync.Mutex
+	// conns are connections by local socket ID.
+	conns map[uint32]*conn
+	// publishing are connections publishing sessions by session key, a new caller of a stream replaces the old one.
+	publishing map[session.Key]*conn
+}
+
+// New returns a new Listener listening on SRTPort of config.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.SRTConfigOptions) (*Listener, error) {
+	l := &Listener{
+		logger:     loglevel.Default.Component(logger, "SRT"),
+		sessions:   sessions,
+		latency:    config.SRTLatency,
+		streams:    make(map[string]*pb.Meta, len(config.SRTStreams)),
+		conns:      make(map[uint32]*conn),
+		publishing: make(map[session.Key]*conn),
+	}
+	if l.latency <= 0 {
+		l.latency = defaultLatency
+	}
+	for _, v := range config.SRTStreams {
+		id, meta, err := parseStream(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SRT stream %q: %w", v, err)
+		}
+		l.streams[id] = meta
+	}
+	if _, err := rand.Read(l.secret[:]); err != nil {
+		return nil, fmt.Errorf("could not generate cookie secret: %w", err)
+	}
+	pc, err := net.ListenPacket("udp", ":"+strconv.Itoa(config.SRTPort))
+	if err != nil {
+		return nil, fmt.Errorf("could not listen: %w", err)
+	}
+	l.pc = pc
+	return l, nil
+}
+
+// parseStream parses a stream in form of "stream_id=id:track_source".
+func parseStream(s string) (string, *pb.Meta, error) {
+	i := strings.IndexByte(s, '=')
+	j := strings.LastIndexByte(s, ':')
+	if i <= 0 || j <= i+1 {
+		return "", nil, errors.New("must be in form of stream_id=id:track_source")
+	}
+	source, err := session.ParseTrackSource(s[j+1:])
+	if err != nil {
+		return "", nil, err
+	}
+	return s[:i], &pb.Meta{Id: s[i+1 : j], TrackSource: source}, nil
+}
+
+// resource returns the resource name of stream ID, which is "r" of the access control syntax, e.g.
+// "#!::r=drone-1,m=publish", or the stream ID itself.
+// See: https://github.com/Haivision/srt/blob/master/docs/features/access-control.md
+func resource(streamID string) string {
+	if !strings.HasPrefix(streamID, "#!::") {
+		return streamID
+	}
+	for _, kv := range strings.Split(streamID[len("#!::"):], ",") {
+		if strings.HasPrefix(kv, "r=") {
+			return kv[len("r="):]
+		}
+	}
+	return ""
+}
+
+// Run serves callers until ctx is done.
+func (l *Listener) Run(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		l.mu.Lock()
+		for _, c := range l.conns {
+			c.close()
+		}
+		l.mu.Unlock()
+		l.pc.Close()
+	}()
+
+	l.logger.Info().Str("address", l.pc.LocalAddr().String()).Int("streams", len(l.streams)).Msg("listening SRT")
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := l.pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				l.logger.Err(err).Msg("could not read SRT packet")
+			}
+			return
+		}
+		if n < headerSize {
+			continue
+		}
+		b := buf[:n]
+		dst := destination(b)
+		if dst == 0 {
+			if isControl(b) && controlType(b) == ctrlHandshake {
+				l.handshake(ctx, b, addr)
+			}
+			continue
+		}
+		l.mu.Lock()
+		c, ok := l.conns[dst]
+		l.mu.Unlock()
+		if !ok || c.addr.String() != addr.String() {
+			continue
+		}
+		c.push(append([]byte(nil), b...))
+	}
+}
+
+// handshake answers a handshake of a caller, see section 4.3.1 of the draft.
+func (l *Listener) handshake(ctx context.Context, b []byte, addr net.Addr) {
+	hs, err := parseHandshake(b[headerSize:])
+	if err != nil {
+		l.logger.Debug().Err(err).Str("remote_addr", addr.String()).Msg("invalid SRT handshake")
+		return
+	}
+	switch hs.typ {
+	case hsInduction:
+		// Fields not told are echoed.
+		hs.version = 5
+		hs.encryption = 0
+		hs.extension = srtMagic
+		hs.cookie = l.cookie(addr, time.Now())
+		hs.extensions = nil
+		l.send(addr, control(ctrlHandshake, 0, 0, hs.socketID, hs.marshal()))
+	case hsConclusion:
+		l.conclude(ctx, hs, addr)
+	default:
+	}
+}
+
+// conclude accepts a conclusion of a caller publishing a configured stream, or rejects it.
+func (l *Listener) conclude(ctx context.Context, hs *handshake, addr net.Addr) {
+	logger := l.logger.With().Str("remote_addr", addr.String()).Logger()
+	now := time.Now()
+	if hs.cookie != l.cookie(addr, now) && hs.cookie != l.cookie(addr, now.Add(-cookiePeriod)) {
+		logger.Debug().Msg("dropped SRT conclusion of invalid cookie")
+		return
+	}
+	// A caller repeats its conclusion until answered, so the answer of an accepted one is repeated too.
+	l.mu.Lock()
+	for _, c := range l.conns {
+		if c.peerID == hs.socketID && c.addr.String() == addr.String() {
+			l.mu.Unlock()
+			l.send(addr, c.accepted)
+			return
+		}
+	}
+	l.mu.Unlock()
+
+	reject := func(code uint32, msg string) {
+		logger.Warn().Uint32("code", code).Msg(msg)
+		hs.typ = code
+		hs.extensions = nil
+		l.send(addr, control(ctrlHandshake, 0, 0, hs.socketID, hs.marshal()))
+	}
+	if hs.version != 5 {
+		reject(rejVersion, "rejected SRT caller of unsupported handshake version")
+		return
+	}
+	if _, ok := hs.extensions[extKMReq]; ok || hs.encryption != 0 {
+		reject(rejUnsecure, "rejected encrypted SRT caller, encryption is not supported")
+		return
+	}
+	id := resource(streamID(hs.extensions[extSID]))
+	meta, ok := l.streams[id]
+	if !ok {
+		reject(rejNotFound, "rejected SRT caller of unknown stream ID "+strconv.Quote(id))
+		return
+	}
+
+	// Latency is the larger one of both sides, as TSBPD of libsrt does.
+	latency := l.latency
+	flags := uint32(flagTSBPDSnd | flagTSBPDRcv | flagTLPktDrop | flagPeriodicNAK)
+	if req := hs.extensions[extHSReq]; len(req) >= 12 {
+		if peer := time.Duration(binary.BigEndian.Uint16(req[10:])) * time.Millisecond; peer > latency {
+			latency = peer
+		}
+		flags |= binary.BigEndian.Uint32(req[4:]) & flagRexmit
+	}
+	rsp := make([]byte, 12)
+	binary.BigEndian.PutUint32(rsp[0:], srtVersion)
+	binary.BigEndian.PutUint32(rsp[4:], flags)
+	ms := uint16(latency / time.Millisecond)
+	binary.BigEndian.PutUint32(rsp[8:], uint32(ms)<<16|uint32(ms))
+
+	c := newConn(l, addr, hs.socketID, hs.isn, meta, latency, &logger)
+	peerID := hs.socketID
+	hs.typ = hsConclusion
+	hs.extension = extFlagHSReq
+	hs.socketID = c.id
+	hs.extensions = map[uint16][]byte{extHSRsp: rsp}
+	c.accepted = control(ctrlHandshake, 0, 0, peerID, hs.marshal())
+
+	l.mu.Lock()
+	l.conns[c.id] = c
+	l.mu.Unlock()
+	l.send(addr, c.accepted)
+	logger.Info().
+		Str("stream_id", id).
+		Str("id", meta.Id).
+		Int32("track_source", int32(meta.TrackSource)).
+		Dur("latency", latency).
+		Msg("accepted SRT caller")
+	go l.serve(ctx, c)
+}
+
+// serve publishes the stream of c until it's closed, replacing the caller publishing the stream if any.
+func (l *Listener) serve(ctx context.Context, c *conn) {
+	key := l.sessions.Key(c.meta)
+	l.mu.Lock()
+	old := l.publishing[key]
+	l.publishing[key] = c
+	l.mu.Unlock()
+	if old != nil {
+		old.close()
+		<-old.done
+	}
+
+	err := c.serve(ctx)
+	c.logger.Info().Err(err).Msg("SRT caller left")
+
+	l.mu.Lock()
+	delete(l.conns, c.id)
+	if l.publishing[key] == c {
+		delete(l.publishing, key)
+	}
+	l.mu.Unlock()
+}
+
+// cookie returns the SYN cookie of a caller at addr in the period of t.
+func (l *Listener) cookie(addr net.Addr, t time.Time) uint32 {
+	mac := hmac.New(sha256.New, l.secret[:])
+	mac.Write([]byte(addr.String()))
+	_ = binary.Write(mac, binary.BigEndian, t.Unix()/int64(cookiePeriod/time.Second))
+	return binary.BigEndian.Uint32(mac.Sum(nil))
+}
+
+// send sends packet b to addr.
+func (l *Listener) send(addr net.Addr, b []byte) {
+	if _, err := l.pc.WriteTo(b, addr); err != nil {
+		l.logger.Debug().Err(err).Str("remote_addr", addr.String()).Msg("could not send SRT packet")
+	}
+}
+
+// newSocketID returns a random local socket ID not in use, l.mu must not be held.
+func (l *Listener) newSocketID() uint32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		var b [4]byte
+		_, _ = rand.Read(b[:])
+		id := binary.BigEndian.Uint32(b[:]) & seqMask
+		if _, ok := l.conns[id]; id != 0 && !ok {
+			return id
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package srt
+
+import (
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+)
+
+// MPEG-TS, see ITU-T H.222.0.
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	patPID       = 0
+
+	streamTypeH264 = 0x1B
+	naluTypeAUD    = 9
+)
+
+// demuxer demuxes H264 access units of the first H264 stream of the first program in MPEG-TS.
+// Other streams, e.g. AAC audio, are ignored.
+type demuxer struct {
+	onAccessUnit func(au *rtpx.AccessUnit) error
+
+	pending  []byte // Bytes of a TS packet split across SRT packets.
+	pmtPID   int    // 0 until PAT is received.
+	videoPID int    // 0 until PMT is received.
+	pes      []byte // PES packet being assembled.
+	pts      uint32 // PTS of the last PES packet, in 90kHz as RTP timestamps of H264.
+}
+
+// write demuxes b, which may hold any part of TS packets.
+func (d *demuxer) write(b []byte) error {
+	d.pending = append(d.pending, b...)
+	p := d.pending
+	for len(p) >= tsPacketSize {
+		if p[0] != tsSyncByte {
+			// Resync at the next sync byte.
+			p = p[1:]
+			continue
+		}
+		if err := d.packet(p[:tsPacketSize]); err != nil {
+			return err
+		}
+		p = p[tsPacketSize:]
+	}
+	d.pending = append(d.pending[:0], p...)
+	return nil
+}
+
+// packet demuxes a TS packet.
+func (d *demuxer) packet(p []byte) error {
+	pid := int(p[1]&0x1F)<<8 | int(p[2])
+	start := p[1]&0x40 != 0
+	control := p[3] >> 4 & 0x3
+	payload := p[4:]
+	if control&0x2 != 0 {
+		if len(payload) == 0 || int(payload[0]) >= len(payload) {
+			return nil
+		}
+		payload = payload[1+int(payload[0]):]
+	}
+	if control&0x1 == 0 {
+		return nil
+	}
+
+	switch {
+	case pid == patPID && start:
+		d.pat(section(payload))
+	case pid == d.pmtPID && d.pmtPID != 0 && start:
+		d.pmt(section(payload))
+	case pid == d.videoPID && d.videoPID != 0:
+		if start {
+			if err := d.flush(); err != nil {
+				return err
+			}
+		} else if d.pes == nil {
+			return nil // Joined in the middle of a PES packet.
+		}
+		d.pes = append(d.pes, payload...)
+	}
+	return nil
+}
+
+// section returns the PSI section of payload starting one, without its pointer field and CRC,
+// nil if it's split across TS packets, which tables of a single program never are.
+func section(payload []byte) []byte {
+	if len(payload) == 0 || int(payload[0])+1 > len(payload) {
+		return nil
+	}
+	b := payload[1+int(payload[0]):]
+	if len(b) < 3 {
+		return nil
+	}
+	length := int(b[1]&0x0F)<<8 | int(b[2])
+	if length < 4 || 3+length > len(b) {
+		return nil
+	}
+	return b[:3+length-4]
+}
+
+// pat finds the PMT PID of the first program in PAT section b.
+func (d *demuxer) pat(b []byte) {
+	if len(b) < 8 || b[0] != 0x00 {
+		return
+	}
+	for p := b[8:]; len(p) >= 4; p = p[4:] {
+		if program := int(p[0])<<8 | int(p[1]); program != 0 {
+			d.pmtPID = int(p[2]&0x1F)<<8 | int(p[3])
+			return
+		}
+	}
+}
+
+// pmt finds the PID of the first H264 stream in PMT section b.
+func (d *demuxer) pmt(b []byte) {
+	if len(b) < 12 || b[0] != 0x02 {
+		return
+	}
+	infoLength := int(b[10]&0x0F)<<8 | int(b[11])
+	if 12+infoLength > len(b) {
+		return
+	}
+	for p := b[12+infoLength:]; len(p) >= 5; {
+		typ, pid := p[0], int(p[1]&0x1F)<<8|int(p[2])
+		if typ == streamTypeH264 {
+			if d.videoPID != pid {
+				d.videoPID = pid
+				d.pes = nil
+			}
+			return
+		}
+		n := 5 + (int(p[3]&0x0F)<<8 | int(p[4]))
+		if n > len(p) {
+			return
+		}
+		p = p[n:]
+	}
+}
+
+// flush demuxes the PES packet assembled, whose payload is an access unit in Annex B.
+func (d *demuxer) flush() error {
+	b := d.pes
+	d.pes = d.pes[:0]
+	if len(b) < 9 || b[0] != 0 || b[1] != 0 || b[2] != 1 {
+		return nil
+	}
+	headerLength := int(b[8])
+	if 9+headerLength > len(b) {
+		return nil
+	}
+	if b[7]&0x80 != 0 && headerLength >= 5 {
+		d.pts = pts(b[9:14])
+	}
+
+	au := &rtpx.AccessUnit{Timestamp: d.pts}
+	for _, nalu := range splitAnnexB(b[9+headerLength:]) {
+		if nalu[0]&0x1F == naluTypeAUD {
+			continue
+		}
+		au.NALUs = append(au.NALUs, append([]byte(nil), nalu...))
+	}
+	if len(au.NALUs) == 0 {
+		return nil
+	}
+	return d.onAccessUnit(au)
+}
+
+// pts decodes a 33-bit PTS, truncated to 32 bits as RTP timestamps wrap around.
+func pts(b []byte) uint32 {
+	return uint32(uint64(b[0]>>1&0x07)<<30 | uint64(b[1])<<22 | uint64(b[2]>>1)<<15 | uint64(b[3])<<7 | uint64(b[4]>>1))
+}
+
+// splitAnnexB splits NAL units of b by start codes.
+func splitAnnexB(b []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != 0 || b[i+1] != 0 || b[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			nalus = appendNALU(nalus, b[start:i])
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 {
+		nalus = appendNALU(nalus, b[start:])
+	}
+	return nalus
+}
+
+// appendNALU appends nalu without trailing zeros, which are leading zeros of the next 4 bytes start code.
+func appendNALU(nalus [][]byte, nalu []byte) [][]byte {
+	for len(nalu) > 0 && nalu[len(nalu)-1] == 0 {
+		nalu = nalu[:len(nalu)-1]
+	}
+	if len(nalu) == 0 {
+		return nalus
+	}
+	return append(nalus, nalu)
+}
@@ -0,0 +1,178 @@
+package srt
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+)
+
+const (
+	testPMTPID   = 0x100
+	testVideoPID = 0x101
+	testAudioPID = 0x102
+)
+
+// tsPackets returns TS packets of payload on pid, the last of which is stuffed by its adaptation field.
+func tsPackets(pid int, payload []byte) []byte {
+	var b []byte
+	for start := true; start || len(payload) > 0; start = false {
+		p := []byte{tsSyncByte, byte(pid >> 8), byte(pid), 0x10}
+		if start {
+			p[1] |= 0x40
+		}
+		if n := tsPacketSize - 4 - len(payload); n > 0 {
+			p[3] |= 0x20
+			p = append(p, byte(n-1))
+			if n > 1 {
+				p = append(p, 0x00)
+				p = append(p, bytes.Repeat([]byte{0xFF}, n-2)...)
+			}
+		}
+		n := tsPacketSize - len(p)
+		b = append(b, p...)
+		b = append(b, payload[:n]...)
+		payload = payload[n:]
+	}
+	return b
+}
+
+// psi returns the payload of PSI section of table with data after its section number fields, and a CRC left zero.
+func psi(table byte, data []byte) []byte {
+	length := 5 + len(data) + 4
+	b := []byte{0, table, 0xB0 | byte(length>>8), byte(length), 0, 1, 0xC1, 0, 0}
+	b = append(b, data...)
+	return append(b, 0, 0, 0, 0)
+}
+
+func testPAT() []byte {
+	// The network PID of program 0 is skipped.
+	return psi(0x00, []byte{0, 0, 0xE0, 0x10, 0, 1, 0xE0 | testPMTPID>>8, testPMTPID & 0xFF})
+}
+
+func testPMT() []byte {
+	return psi(0x02, []byte{
+		0xE0 | testVideoPID>>8, testVideoPID & 0xFF, 0xF0, 0, // PCR PID, no program info.
+		0x0F, 0xE0 | testAudioPID>>8, testAudioPID & 0xFF, 0xF0, 2, 0, 0, // AAC with a descriptor.
+		streamTypeH264, 0xE0 | testVideoPID>>8, testVideoPID & 0xFF, 0xF0, 0,
+	})
+}
+
+// testPES returns a PES packet of an access unit of nalus at pts.
+func testPES(pts uint64, nalus ...[]byte) []byte {
+	b := []byte{0, 0, 1, 0xE0, 0, 0, 0x80, 0x80, 5,
+		0x21 | byte(pts>>30&0x07)<<1, byte(pts >> 22), byte(pts>>15)<<1 | 1, byte(pts >> 7), byte(pts)<<1 | 1}
+	b = append(b, 0, 0, 0, 1, naluTypeAUD, 0xF0)
+	for _, nalu := range nalus {
+		b = append(b, 0, 0, 1)
+		b = append(b, nalu...)
+	}
+	return b
+}
+
+func TestDemuxer(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xC0, 0x1F}
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0x88}, 400)...)
+	slice := []byte{0x41, 0x9A}
+
+	var stream []byte
+	// Garbage before the first sync byte, and a PES packet before PAT and PMT, are skipped.
+	stream = append(stream, 0x00, 0x01)
+	stream = append(stream, tsPackets(testVideoPID, testPES(0, slice))...)
+	stream = append(stream, tsPackets(patPID, testPAT())...)
+	stream = append(stream, tsPackets(testPMTPID, testPMT())...)
+	stream = append(stream, tsPackets(testVideoPID, testPES(9000, sps, idr))...)
+	stream = append(stream, tsPackets(testAudioPID, []byte{0xFF, 0xF1})...)
+	stream = append(stream, tsPackets(testVideoPID, testPES(1<<32+12000, slice))...)
+	// The last access unit is flushed by the next PES packet.
+	stream = append(stream, tsPackets(testVideoPID, testPES(15000))...)
+
+	want := []*rtpx.AccessUnit{
+		{Timestamp: 9000, NALUs: [][]byte{sps, idr}},
+		{Timestamp: 12000, NALUs: [][]byte{slice}},
+	}
+	// Writes of any size, as TS packets may be split across SRT packets.
+	for _, size := range []int{1, 100, tsPacketSize, 7 * tsPacketSize, len(stream)} {
+		var got []*rtpx.AccessUnit
+		d := &demuxer{onAccessUnit: func(au *rtpx.AccessUnit) error {
+			got = append(got, au)
+			return nil
+		}}
+		for b := stream; len(b) > 0; {
+			n := size
+			if n > len(b) {
+				n = len(b)
+			}
+			if err := d.write(b[:n]); err != nil {
+				t.Fatal(err)
+			}
+			b = b[n:]
+		}
+		if d.pmtPID != testPMTPID || d.videoPID != testVideoPID {
+			t.Fatalf("writes of %d bytes: PMT PID = %#x, video PID = %#x, want %#x, %#x",
+				size, d.pmtPID, d.videoPID, testPMTPID, testVideoPID)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("writes of %d bytes: access units = %v, want %v", size, got, want)
+		}
+	}
+}
+
+func TestSection(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		want    []byte
+	}{
+		{name: "PAT", payload: testPAT(), want: testPAT()[1 : len(testPAT())-4]},
+		{name: "pointer field", payload: append([]byte{2, 0xFF, 0xFF}, testPAT()[1:]...), want: testPAT()[1 : len(testPAT())-4]},
+		{name: "pointer beyond payload", payload: []byte{4, 0, 0}},
+		{name: "split across packets", payload: testPAT()[:10]},
+		{name: "short length", payload: []byte{0, 0x00, 0xB0, 3, 0, 0, 0}},
+		{name: "short header", payload: []byte{0, 0x00, 0xB0}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := section(tt.payload); !bytes.Equal(got, tt.want) {
+				t.Fatalf("section() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPTS(t *testing.T) {
+	for _, want := range []uint64{0, 1, 90000, 1<<30 + 12345, 1<<32 - 1} {
+		if got := pts(testPES(want)[9:14]); got != uint32(want) {
+			t.Errorf("pts() = %d, want %d", got, want)
+		}
+	}
+	// The 33rd bit is truncated.
+	if got := pts(testPES(1<<32 + 1)[9:14]); got != 1 {
+		t.Errorf("pts() = %d, want 1", got)
+	}
+}
+
+func TestSplitAnnexB(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		want [][]byte
+	}{
+		{name: "3 bytes start codes", b: []byte{0, 0, 1, 0x67, 1, 0, 0, 1, 0x68, 2}, want: [][]byte{{0x67, 1}, {0x68, 2}}},
+		{name: "4 bytes start codes", b: []byte{0, 0, 0, 1, 0x67, 1, 0, 0, 0, 1, 0x68}, want: [][]byte{{0x67, 1}, {0x68}}},
+		{name: "trailing zeros", b: []byte{0, 0, 1, 0x65, 0, 0}, want: [][]byte{{0x65}}},
+		{name: "empty NAL units", b: []byte{0, 0, 1, 0, 0, 1, 0x41}, want: [][]byte{{0x41}}},
+		{name: "bytes before start code", b: []byte{0x09, 0, 0, 1, 0x41}, want: [][]byte{{0x41}}},
+		{name: "no start code", b: []byte{0x41, 0x9A}},
+		{name: "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitAnnexB(tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("splitAnnexB() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
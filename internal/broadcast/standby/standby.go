@@ -0,0 +1,257 @@
+// Package standby pairs a primary broadcast instance with a warm standby one over MQTT.
+//
+// The primary publishes heartbeats carrying its session registry. The standby mirrors the registry
+// without signaling edges, and takes over once heartbeats stop for FailoverTimeout:
+// it runs TakeoverCommand to switch the signaling endpoint (e.g. moving a virtual IP or updating DNS),
+// starts signaling and asks mirrored edges to re-signal, then acts as the primary.
+// A failed primary must be restarted as standby after recovery, as instances are not demoted automatically.
+package standby
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// Roles of paired instances.
+const (
+	RolePrimary = "primary"
+	RoleStandby = "standby"
+)
+
+const (
+	defaultHeartbeatInterval = time.Second
+	defaultFailoverTimeout   = 3 * time.Second
+
+	takeoverCommandTimeout = 10 * time.Second
+)
+
+// heartbeat is the payload of heartbeat topic.
+type heartbeat struct {
+	Instance string     `json:"instance"`
+	Sessions []*pb.Meta `json:"sessions"`
+}
+
+// TakeoverFunc is called once a standby takes over, with sessions mirrored from the failed primary.
+type TakeoverFunc func(mirrored []*pb.Meta)
+
+// Pairing runs an instance as primary or standby.
+type Pairing struct {
+	logger   zerolog.Logger
+	config   cfg.StandbyConfigOptions
+	sessions *session.SessionManager
+
+	client    mqtt.Client
+	clientMux sync.RWMutex
+	watching  bool // Whether standby is watching heartbeats, guarded by clientMux.
+
+	mu       sync.Mutex
+	mirrored []*pb.Meta
+	lastSeen time.Time
+}
+
+// New returns a new Pairing.
+func New(
+	client mqtt.Client,
+	sessions *session.SessionManager,
+	logger *zerolog.Logger,
+	config cfg.StandbyConfigOptions,
+) (*Pairing, error) {
+	if config.Role != RolePrimary && config.Role != RoleStandby {
+		return nil, fmt.Errorf("unknown role: %q", config.Role)
+	}
+	if config.TopicPrefix == "" {
+		return nil, errors.New("topic prefix is required")
+	}
+	if config.HeartbeatInterval <= 0 {
+		config.HeartbeatInterval = defaultHeartbeatInterval
+	}
+	if config.FailoverTimeout <= 0 {
+		config.FailoverTimeout = defaultFailoverTimeout
+	}
+	if config.Instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("could not get hostname as instance: %w", err)
+		}
+		config.Instance = hostname
+	}
+
+	return &Pairing{
+		logger:   loglevel.Default.Component(logger, "Pairing").With().Str("instance", config.Instance).Logger(),
+		config:   config,
+		sessions: sessions,
+		client:   client,
+	}, nil
+}
+
+// SetClient replaces the MQTT client, e.g. after broker credentials are rotated,
+// and watches heartbeats with the new client if standby is watching.
+func (p *Pairing) SetClient(client mqtt.Client) {
+	p.clientMux.Lock()
+	p.client = client
+	watching := p.watching
+	p.clientMux.Unlock()
+
+	if watching {
+		p.subscribe()
+	}
+}
+
+func (p *Pairing) mqttClient() mqtt.Client {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+	return p.client
+}
+
+// Run runs the instance in its role until ctx is done.
+// A standby calls takeover once the primary fails, and runs as primary afterwards.
+func (p *Pairing) Run(ctx context.Context, takeover TakeoverFunc) {
+	if p.config.Role == RoleStandby {
+		if !p.watch(ctx) {
+			return
+		}
+		p.takeover(ctx, takeover)
+	}
+	p.heartbeat(ctx)
+}
+
+func (p *Pairing) topic() string {
+	return p.config.TopicPrefix + "/heartbeat"
+}
+
+// heartbeat publishes heartbeats with current sessions every HeartbeatInterval until ctx is done.
+func (p *Pairing) heartbeat(ctx context.Context) {
+	ticker := time.NewTicker(p.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	p.logger.Info().Dur("interval", p.config.HeartbeatInterval).Msg("running as primary")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		beat := heartbeat{Instance: p.config.Instance}
+		for _, sess := range p.sessions.List() {
+			// Relayed sessions are resumed by relaying them again, not by their edges.
+			if sess.Origin != "" {
+				continue
+			}
+			beat.Sessions = append(beat.Sessions, sess.Meta)
+		}
+		payload, err := json.Marshal(&beat)
+		if err != nil {
+			p.logger.Err(err).Msg("could not marshal heartbeat")
+			continue
+		}
+		// Heartbeat must not be retained, or a standby would take a dead primary as alive.
+		t := p.mqttClient().Publish(p.topic(), 0, false, payload)
+		go func() {
+			<-t.Done()
+			if t.Error() != nil {
+				p.logger.Err(t.Error()).Msg("could not publish heartbeat")
+			}
+		}()
+	}
+}
+
+// watch mirrors sessions from heartbeats of primary, and returns true once no heartbeat is received
+// in FailoverTimeout, or false if ctx is done.
+func (p *Pairing) watch(ctx context.Context) bool {
+	p.mu.Lock()
+	p.lastSeen = time.Now() // Give primary a chance if both start at the same time.
+	p.mu.Unlock()
+
+	p.clientMux.Lock()
+	p.watching = true
+	p.clientMux.Unlock()
+	p.subscribe()
+	defer func() {
+		p.clientMux.Lock()
+		p.watching = false
+		p.clientMux.Unlock()
+		p.mqttClient().Unsubscribe(p.topic())
+	}()
+
+	ticker := time.NewTicker(p.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	p.logger.Info().Dur("failover_timeout", p.config.FailoverTimeout).Msg("running as standby")
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case now := <-ticker.C:
+			p.mu.Lock()
+			lastSeen := p.lastSeen
+			p.mu.Unlock()
+			if now.Sub(lastSeen) > p.config.FailoverTimeout {
+				p.logger.Warn().Time("last_seen", lastSeen).Msg("primary failed")
+				return true
+			}
+		}
+	}
+}
+
+func (p *Pairing) subscribe() {
+	t := p.mqttClient().Subscribe(p.topic(), 0, func(_ mqtt.Client, m mqtt.Message) {
+		var beat heartbeat
+		if err := json.Unmarshal(m.Payload(), &beat); err != nil {
+			p.logger.Err(err).Msg("could not unmarshal heartbeat")
+			return
+		}
+		if beat.Instance == p.config.Instance {
+			return
+		}
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.mirrored = beat.Sessions
+		p.lastSeen = time.Now()
+	})
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			p.logger.Err(t.Error()).Msgf("could not subscribe to %s", p.topic())
+		} else {
+			p.logger.Info().Msgf("subscribed to %s", p.topic())
+		}
+	}()
+}
+
+// takeover switches signaling endpoint to this instance and calls f with mirrored sessions.
+func (p *Pairing) takeover(ctx context.Context, f TakeoverFunc) {
+	if p.config.TakeoverCommand != "" {
+		ctx, cancel := context.WithTimeout(ctx, takeoverCommandTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", p.config.TakeoverCommand)
+		cmd.Env = append(os.Environ(), "SKYWALKER_INSTANCE="+p.config.Instance)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			// Signaling still starts, endpoint may be switched by other means.
+			p.logger.Err(err).Bytes("output", output).Msg("takeover command failed")
+		} else {
+			p.logger.Info().Msg("ran takeover command")
+		}
+	}
+
+	p.mu.Lock()
+	mirrored := p.mirrored
+	p.mu.Unlock()
+	f(mirrored)
+	p.logger.Info().Int("sessions", len(mirrored)).Msg("took over from primary")
+}
@@ -0,0 +1,8 @@
+package subscriber
+
+import "github.com/SB-IM/skywalker/internal/broadcast/accounting"
+
+// SetAccountant sets the accountant of viewer egress for billing. It must be called before serving signaling.
+func (s *Subscriber) SetAccountant(a *accounting.Accountant) {
+	s.accountant = a
+}
@@ -0,0 +1,34 @@
+package subscriber
+
+import (
+	"context"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/acl"
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+)
+
+// SetACL sets the stream access control list checked before subscriber peer connections are created.
+// It may be replaced while serving signaling, e.g. on config reload, established peer connections are kept.
+func (s *Subscriber) SetACL(a acl.ACL) {
+	s.aclMux.Lock()
+	defer s.aclMux.Unlock()
+	s.acl = a
+}
+
+// checkACL returns an error if the subscriber of claims is not allowed to watch the stream of meta by ACL.
+// All subscribers are allowed if ACL is disabled.
+func (s *Subscriber) checkACL(ctx context.Context, claims *auth.Claims, tenant string, meta *pb.Meta, remoteAddr string) error {
+	s.aclMux.RLock()
+	a := s.acl
+	s.aclMux.RUnlock()
+	if a == nil {
+		return nil
+	}
+	r := &acl.Request{Tenant: tenant, Meta: meta, RemoteAddr: remoteAddr}
+	if claims != nil {
+		r.Subject = claims.Subject
+	}
+	return a.Check(ctx, r)
+}
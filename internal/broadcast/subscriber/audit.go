@@ -0,0 +1,39 @@
+package subscriber
+
+import (
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/audit"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// SetAudit sets the auditor recording viewers joining and leaving. It must be called before serving signaling.
+func (s *Subscriber) SetAudit(a *audit.Auditor) {
+	s.audit = a
+}
+
+// auditViewer records v joining, and leaving once its peer connection w is gone. It does nothing if audit is disabled.
+func (s *Subscriber) auditViewer(w *webrtcx.WebRTC, v viewer) {
+	if s.audit == nil {
+		return
+	}
+	event := func(t audit.EventType) *audit.Event {
+		return &audit.Event{
+			Type:        t,
+			ID:          v.Meta.Id,
+			TrackSource: v.Meta.TrackSource,
+			ConnID:      v.ID,
+			Subject:     v.Subject,
+			Tenant:      v.Tenant,
+			RemoteAddr:  v.RemoteAddr,
+			Protocol:    v.Protocol,
+		}
+	}
+	s.audit.Emit(event(audit.ViewerJoined))
+	go func() {
+		<-w.Done()
+		e := event(audit.ViewerLeft)
+		e.Duration = time.Since(v.Since).Seconds()
+		s.audit.Emit(e)
+	}()
+}
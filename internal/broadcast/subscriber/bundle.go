@@ -0,0 +1,89 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// maxBundledSources caps track sources bundled in a peer connection besides the offered one.
+const maxBundledSources = 7
+
+// bundleOptions are track sources bundled by an offer in data of "video-offer" event, e.g.
+// {"meta": {"id": "drone-1", "track_source": 1, "track_sources": [1, 2]}}, watches both in a peer connection.
+type bundleOptions struct {
+	Meta struct {
+		TrackSources []pb.TrackSource `json:"track_sources"`
+	} `json:"meta"`
+}
+
+// bundled is a stream bundled in the peer connection of an answer, tracks of it are told apart by StreamID,
+// the MSID of its tracks.
+type bundled struct {
+	Meta       *pb.Meta `json:"meta"`
+	StreamID   string   `json:"stream_id"`
+	Codec      string   `json:"codec"`
+	AudioCodec string   `json:"audio_codec"`
+}
+
+// bundledMetas returns metas of track sources bundled by an offer of data, besides meta of the offer itself.
+func bundledMetas(data json.RawMessage, meta *pb.Meta) []*pb.Meta {
+	var options bundleOptions
+	if err := json.Unmarshal(data, &options); err != nil {
+		return nil
+	}
+	seen := map[pb.TrackSource]bool{meta.TrackSource: true}
+	var metas []*pb.Meta
+	for _, source := range options.Meta.TrackSources {
+		if seen[source] {
+			continue
+		}
+		seen[source] = true
+		metas = append(metas, &pb.Meta{Id: meta.Id, TrackSource: source})
+	}
+	return metas
+}
+
+// bundle returns sessions of metas bundled by an offer, each of which is checked as the offered stream is.
+// It returns the error code if any of them may not be watched or is not found, the offer fails as a whole.
+func (s *Subscriber) bundle(
+	ctx context.Context,
+	claims *auth.Claims,
+	tenant string,
+	remoteAddr string,
+	metas []*pb.Meta,
+	logger *zerolog.Logger,
+) ([]*session.Session, httpx.Code, bool) {
+	if len(metas) > maxBundledSources {
+		logger.Error().Int("track_sources", len(metas)).Msg("too many track sources bundled")
+		return nil, httpx.ErrIncorrectMetadata, false
+	}
+	sessions := make([]*session.Session, 0, len(metas))
+	for _, meta := range metas {
+		logger := logger.With().Int32("bundled_track_source", int32(meta.TrackSource)).Logger()
+		if !claims.Allow(meta) {
+			logger.Warn().Str("subject", claims.Subject).Msg("subscriber is not allowed to watch the bundled stream")
+			return nil, httpx.ErrForbidden, false
+		}
+		if err := s.checkACL(ctx, claims, tenant, meta, remoteAddr); err != nil {
+			logger.Warn().Err(err).Msg("bundled stream denied by ACL")
+			return nil, httpx.ErrACLDenied, false
+		}
+		sess, ok := s.sessions.Get(s.sessions.Key(meta))
+		if !ok {
+			sess, ok = s.relay(ctx, meta, &logger)
+		}
+		if !ok {
+			logger.Error().Msg("bundled stream not found in existing sessions")
+			return nil, httpx.ErrMetadataNotMatched, false
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, 0, true
+}
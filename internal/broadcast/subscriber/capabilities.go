@@ -0,0 +1,62 @@
+package subscriber
+
+import (
+	"strings"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/capability"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+)
+
+// WatchCapabilities subscribes to capability documents retained by edges on "capability_prefix/id",
+// they are merged into stream discovery. An empty retained message clears the document of the edge.
+func (s *Subscriber) WatchCapabilities() {
+	s.clientMux.Lock()
+	s.watching = true
+	s.clientMux.Unlock()
+
+	topic := s.capabilityTopic()
+	t := s.mqttClient().Subscribe(topic, byte(s.config.Qos), s.handleCapability())
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			s.logger.Err(t.Error()).Msgf("could not subscribe to %s", topic)
+		} else {
+			s.logger.Info().Msgf("subscribed to %s", topic)
+		}
+	}()
+}
+
+// capabilityTopic returns the topic filter of capability documents, tenants of multi-tenant edges are the first level.
+func (s *Subscriber) capabilityTopic() string {
+	topic := s.config.CapabilityTopicPrefix + "/" + "+"
+	if s.tenants != nil {
+		topic = "+" + "/" + topic
+	}
+	return topic
+}
+
+// handleCapability handles capability documents from edges.
+func (s *Subscriber) handleCapability() mqtt.MessageHandler {
+	return func(c mqtt.Client, m mqtt.Message) {
+		id := m.Topic()[strings.LastIndex(m.Topic(), "/")+1:]
+		if s.tenants != nil {
+			id = tenant.Qualify(tenant.FromTopic(m.Topic()), id)
+		}
+		logger := s.logger.With().Str("id", id).Logger()
+		if len(m.Payload()) == 0 {
+			s.capabilities.Delete(id)
+			logger.Info().Msg("cleared capabilities of edge")
+			return
+		}
+
+		doc, err := capability.Parse(m.Payload())
+		if err != nil {
+			logger.Err(err).Msg("invalid capability document")
+			return
+		}
+		s.capabilities.Set(id, doc)
+		logger.Info().Int("sources", len(doc.Sources)).Msg("updated capabilities of edge")
+	}
+}
@@ -0,0 +1,33 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cluster"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// SetCluster sets the cluster, so streams hosted by other instances are relayed to viewers here instead of
+// redirecting them. It must be called before serving signaling.
+func (s *Subscriber) SetCluster(c *cluster.Cluster) {
+	s.cluster = c
+}
+
+// relay returns the session of meta relayed from the instance hosting it, and reports whether it's relayed.
+func (s *Subscriber) relay(ctx context.Context, meta *pb.Meta, logger *zerolog.Logger) (*session.Session, bool) {
+	if s.cluster == nil {
+		return nil, false
+	}
+	sess, err := s.cluster.Relay(ctx, meta)
+	if err != nil {
+		if !errors.Is(err, cluster.ErrNotHosted) {
+			logger.Err(err).Msg("could not relay stream from instance hosting it")
+		}
+		return nil, false
+	}
+	return sess, true
+}
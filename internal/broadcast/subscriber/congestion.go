@@ -0,0 +1,134 @@
+package subscriber
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+const (
+	// congestionInterval is the interval of estimating bandwidth of a subscriber and switching its layer.
+	congestionInterval = time.Second
+	// upgradeChecks is how many consecutive estimates must fit a higher layer before switching up,
+	// so a subscriber doesn't flap between layers on a fluctuating network. Switching down is immediate.
+	upgradeChecks = 5
+)
+
+// layerSwitch is the layer switched to by congestion control of a subscriber.
+type layerSwitch struct {
+	Layer     string `json:"layer"`     // RID of the simulcast layer.
+	Bandwidth uint64 `json:"bandwidth"` // Bandwidth of subscriber in bits per second it's switched by.
+}
+
+// controlCongestion switches the simulcast layer sent to subscriber w to the highest layer fitting its
+// bandwidth estimated by its RTCP feedback and capped by MaxSubscriberBitrate, until w is gone.
+// It stops once manual is set, i.e. the subscriber selected a layer by itself, manual may be nil.
+// switched is called on each switch if not nil.
+// It does nothing if congestion control is disabled or the stream has no simulcast layers to switch between,
+// as tracks of a stream are shared by its subscribers.
+func (s *Subscriber) controlCongestion(
+	w *webrtcx.WebRTC,
+	sess *session.Session,
+	manual *int32,
+	switched func(layerSwitch),
+	logger *zerolog.Logger,
+) {
+	if !s.config.CongestionControl || len(sess.Layers.RIDs()) < 2 {
+		return
+	}
+	limit := uint64(s.config.MaxSubscriberBitrate) * 1000
+
+	var current *session.Layer
+	for _, layer := range sess.Layers.List() {
+		if layer.Track == sess.VideoTrack {
+			current = layer
+		}
+	}
+	if current == nil {
+		return
+	}
+
+	var (
+		estimator webrtcx.BandwidthEstimator
+		fits      int
+	)
+	ticker := time.NewTicker(congestionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.Done():
+			return
+		case <-ticker.C:
+		}
+		if manual != nil && atomic.LoadInt32(manual) != 0 {
+			return
+		}
+
+		bandwidth := estimator.Update(w.Stats(), current.Bitrate.Bitrate())
+		if limit > 0 && (bandwidth == 0 || bandwidth > limit) {
+			bandwidth = limit
+		}
+		target := fitLayer(sess.Layers.List(), bandwidth)
+		if target == nil || target == current {
+			fits = 0
+			continue
+		}
+		up := target.Bitrate.Bitrate() > current.Bitrate.Bitrate()
+		if up {
+			if fits++; fits < upgradeChecks {
+				continue
+			}
+		}
+		fits = 0
+
+		if err := w.ReplaceVideoTrack(target.Track); err != nil {
+			logger.Err(err).Str("layer", target.RID).Msg("could not switch simulcast layer by bandwidth")
+			return
+		}
+		target.RequestKeyframe()
+		direction := "down"
+		if up {
+			direction = "up"
+		}
+		metrics.LayerSwitches.WithLabelValues(direction).Inc()
+		logger.Info().
+			Str("from", current.RID).
+			Str("layer", target.RID).
+			Uint64("bandwidth", bandwidth).
+			Msg("switched simulcast layer by bandwidth")
+		current = target
+		if switched != nil {
+			switched(layerSwitch{Layer: target.RID, Bandwidth: bandwidth})
+		}
+	}
+}
+
+// fitLayer returns the layer of the highest bitrate within bandwidth, or the lowest one if none fits.
+// It returns nil if bandwidth is unknown yet or no layer is received.
+func fitLayer(layers []*session.Layer, bandwidth uint64) *session.Layer {
+	if bandwidth == 0 {
+		return nil
+	}
+	var best, lowest *session.Layer
+	for _, layer := range layers {
+		bitrate := layer.Bitrate.Bitrate()
+		if bitrate == 0 {
+			continue
+		}
+		if lowest == nil || bitrate < lowest.Bitrate.Bitrate() {
+			lowest = layer
+		}
+		if bitrate <= bandwidth && (best == nil || bitrate > best.Bitrate.Bitrate()) {
+			best = layer
+		}
+	}
+	if best == nil {
+		return lowest
+	}
+	return best
+}
@@ -0,0 +1,138 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rs/zerolog"
+	"nhooyr.io/websocket"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+)
+
+const (
+	// ProtocolVersion is the latest version of the WebSocket signaling protocol.
+	// Version 1 is the protocol before "hello" event, clients not sending "hello" are served with it.
+	ProtocolVersion = 2
+	// minProtocolVersion is the oldest version still served.
+	minProtocolVersion = 1
+)
+
+// Features of the WebSocket signaling protocol, negotiated by "hello" event.
+const (
+	// FeatureTrickleICE trickles candidates by "new-ice-candidate" events. Without it, the answer is sent
+	// after ICE gathering completes and carries all candidates of server.
+	FeatureTrickleICE = "trickle-ice"
+	// FeatureMultiStream negotiates many streams over a connection. Without it, an offer closes peer connections
+	// of other streams of the connection.
+	FeatureMultiStream = "multi-stream"
+	// FeatureStatsEvents sends "stats" events of peer connections.
+	FeatureStatsEvents = "stats-events"
+	// FeatureEndOfCandidates sends a "new-ice-candidate" event with empty candidate once all candidates
+	// of server are sent. Legacy clients aren't sent it.
+	FeatureEndOfCandidates = "end-of-candidates"
+	// FeatureBundle bundles more track sources of the machine of an offer in its peer connection, listed by
+	// "track_sources" of its meta. Without it, they are ignored.
+	FeatureBundle = "bundle"
+	// FeatureICERestart restarts ICE of a negotiated stream by "restart-ice" event, e.g. once the network of client
+	// changes, keeping its peer connection. Clients not seeing it subscribe again instead.
+	FeatureICERestart = "ice-restart"
+	// FeatureConnectionState sends "connection-state" events once ICE connection state of a peer connection changes,
+	// so clients can tell connecting from failed.
+	FeatureConnectionState = "connection-state"
+)
+
+// features are all features supported by server, in order advertised.
+var features = []string{
+	FeatureTrickleICE, FeatureMultiStream, FeatureStatsEvents, FeatureEndOfCandidates, FeatureBundle, FeatureICERestart,
+	FeatureConnectionState,
+}
+
+// legacyFeatures are features of version 1.
+var legacyFeatures = []string{FeatureTrickleICE, FeatureMultiStream, FeatureStatsEvents}
+
+// hello is the data of "hello" event, sent by client and replied by server with negotiated version and features.
+type hello struct {
+	Version  int      `json:"version"`
+	Features []string `json:"features"`
+}
+
+// protocol is the WebSocket signaling protocol negotiated of a connection.
+type protocol struct {
+	version  int
+	features map[string]bool
+}
+
+// legacyProtocol returns the protocol of clients not sending "hello", which has all features of version 1.
+func legacyProtocol() protocol {
+	p := protocol{version: minProtocolVersion, features: make(map[string]bool, len(legacyFeatures))}
+	for _, f := range legacyFeatures {
+		p.features[f] = true
+	}
+	return p
+}
+
+// has reports whether feature is negotiated.
+func (p protocol) has(feature string) bool {
+	return p.features[feature]
+}
+
+// negotiateProtocol negotiates the protocol of a "hello" event, unknown features of client are ignored.
+// It returns false if the version of client is not served.
+func negotiateProtocol(h *hello) (protocol, bool) {
+	if h.Version < minProtocolVersion {
+		return protocol{}, false
+	}
+	p := protocol{version: h.Version, features: make(map[string]bool, len(h.Features))}
+	if p.version > ProtocolVersion {
+		p.version = ProtocolVersion
+	}
+	for _, f := range h.Features {
+		for _, supported := range features {
+			if f == supported {
+				p.features[f] = true
+			}
+		}
+	}
+	return p, true
+}
+
+// hello negotiates the protocol of a "hello" event, and replies "hello" event with the negotiated one.
+// Protocol is kept unchanged on error. It must be sent before any offer, as peer connections are created
+// with the former protocol.
+func (s *Subscriber) hello(ctx context.Context, c *websocket.Conn, msg *incomingMessage, p *protocol, negotiated bool, logger *zerolog.Logger) {
+	if negotiated {
+		logger.Warn().Msg("received hello after offer")
+		_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrUnexpectedHello)
+		return
+	}
+	var h hello
+	if err := json.Unmarshal(msg.Data, &h); err != nil {
+		logger.Err(err).Msg("could not unmarshal JSON data")
+		_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrUnmarshalJSON)
+		return
+	}
+	negotiatedProtocol, ok := negotiateProtocol(&h)
+	if !ok {
+		logger.Warn().Int("version", h.Version).Msg("unsupported protocol version")
+		_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrUnsupportedProtocolVersion)
+		return
+	}
+	*p = negotiatedProtocol
+
+	reply := hello{Version: p.version, Features: []string{}}
+	for _, f := range features {
+		if p.has(f) {
+			reply.Features = append(reply.Features, f)
+		}
+	}
+	if err := s.writeJSON(ctx, c, outgoingMessage{
+		Event: "hello",
+		ID:    msg.ID,
+		Data:  reply,
+	}); err != nil {
+		logger.Err(err).Msg("could not write hello event")
+		return
+	}
+	logger.Info().Int("version", reply.Version).Strs("features", reply.Features).Msg("negotiated signaling protocol")
+}
@@ -0,0 +1,36 @@
+package subscriber
+
+import (
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/hooks"
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// SetHooks sets hooks of extensions called on offers and candidates of viewers, it must be called before
+// serving signaling.
+func (s *Subscriber) SetHooks(h hooks.Hooks) {
+	s.hooks = h
+}
+
+// hookRejected returns the error replied to a viewer rejected by hooks for reason.
+func hookRejected(reason error) *httpx.Error {
+	return httpx.NewError(httpx.ErrHookRejected, map[string]interface{}{
+		"reason": reason.Error(),
+	})
+}
+
+// filterCandidates filters candidates of the viewer watching meta by hooks.
+func (s *Subscriber) filterCandidates(w *webrtcx.WebRTC, meta *pb.Meta) {
+	w.FilterCandidates(hooks.CandidateFilter(s.hooks, hooks.RoleSubscriber, meta))
+}
+
+// subjectOf returns the subject of claims, empty if auth is disabled.
+func subjectOf(claims *auth.Claims) string {
+	if claims == nil {
+		return ""
+	}
+	return claims.Subject
+}
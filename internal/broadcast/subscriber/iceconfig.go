@@ -0,0 +1,67 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// defaultTURNUser is user of minted TURN credentials if subscriber is anonymous.
+const defaultTURNUser = "subscriber"
+
+// iceServer is an RTCIceServer of browsers.
+type iceServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// iceConfig is an RTCConfiguration subset of browsers.
+type iceConfig struct {
+	ICEServers []iceServer `json:"iceServers"`
+	// TTL is seconds before minted TURN credentials expire, clients should fetch again before then.
+	TTL int64 `json:"ttl,omitempty"`
+}
+
+// handleICEConfig returns ICE servers for browsers, with short-lived TURN credentials minted from shared secret,
+// so browsers behind symmetric NAT can relay through TURN without long-lived credentials.
+func (s *Subscriber) handleICEConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := s.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		config := iceConfig{ICEServers: []iceServer{}}
+		// Only STUN servers are shared, credentials of TURN servers configured for this server are kept secret.
+		for _, server := range s.media.ICEServers() {
+			if strings.HasPrefix(server.URL, "stun:") || strings.HasPrefix(server.URL, "stuns:") {
+				config.ICEServers = append(config.ICEServers, iceServer{URLs: []string{server.URL}})
+			}
+		}
+		if s.config.TURNSecret != "" && len(s.config.TURNURLs) > 0 {
+			user := defaultTURNUser
+			if claims != nil && claims.Subject != "" {
+				user = claims.Subject
+			}
+			username, credential := webrtcx.TURNCredential(s.config.TURNSecret, user, s.config.TURNCredentialTTL, time.Now())
+			config.ICEServers = append(config.ICEServers, iceServer{
+				URLs:       s.config.TURNURLs,
+				Username:   username,
+				Credential: credential,
+			})
+			config.TTL = int64(s.config.TURNCredentialTTL / time.Second)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		// Credentials must not be cached by intermediaries.
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(config); err != nil {
+			s.logger.Err(err).Msg("could not write ICE config JSON")
+		}
+	}
+}
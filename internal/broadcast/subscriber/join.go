@@ -0,0 +1,53 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// joinTimeout is how long a subscriber may take to receive first media before its join is counted as failed.
+const joinTimeout = 30 * time.Second
+
+// trackJoin measures join latency from start, when offer is received, to first media confirmed by subscriber.
+func (s *Subscriber) trackJoin(start time.Time, w *webrtcx.WebRTC, firstMedia <-chan struct{}, logger *zerolog.Logger) {
+	timer := time.NewTimer(joinTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-firstMedia:
+		latency := time.Since(start)
+		metrics.JoinsPending.Dec()
+		metrics.JoinLatency.Observe(latency.Seconds())
+		s.slo.Observe(latency)
+		logger.Info().Dur("latency", latency).Msg("subscriber received first media")
+	case <-w.Done():
+		s.joinFailed()
+		logger.Warn().Msg("subscriber peer connection closed before receiving media")
+	case <-timer.C:
+		s.joinFailed()
+		logger.Warn().Dur("timeout", joinTimeout).Msg("subscriber did not receive media in time")
+	}
+}
+
+// joinFailed counts a pending join as failed.
+func (s *Subscriber) joinFailed() {
+	metrics.JoinsPending.Dec()
+	metrics.JoinFailures.Inc()
+	s.slo.Fail()
+}
+
+// handleSLO reports join latency against the SLO in the sliding window.
+func (s *Subscriber) handleSLO() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.slo.Report(time.Now())); err != nil {
+			s.logger.Err(err).Msg("could not write SLO report JSON")
+		}
+	}
+}
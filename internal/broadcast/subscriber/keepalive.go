@@ -0,0 +1,48 @@
+package subscriber
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+	"nhooyr.io/websocket"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// keepalive pings client every WSPingInterval until ctx is done, and calls cancel if a pong isn't received
+// in WSPongTimeout, e.g. the connection is silently dropped by a proxy. Cancel unblocks the read loop
+// and aborts pending negotiations of the connection. Pongs are handled by the read loop, which must be running.
+func (s *Subscriber) keepalive(ctx context.Context, c *websocket.Conn, cancel context.CancelFunc, logger *zerolog.Logger) {
+	if s.config.WSPingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.config.WSPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.ping(ctx, c); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			metrics.WebSocketStale.Inc()
+			logger.Warn().Err(err).Msg("no pong from client, closing stale signaling connection")
+			cancel()
+			return
+		}
+	}
+}
+
+// ping sends a ping and waits for the pong in WSPongTimeout.
+func (s *Subscriber) ping(ctx context.Context, c *websocket.Conn) error {
+	if s.config.WSPongTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.WSPongTimeout)
+		defer cancel()
+	}
+	return c.Ping(ctx)
+}
@@ -0,0 +1,61 @@
+package subscriber
+
+import (
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// Kick closes the subscriber peer connection of viewer id, and reports whether it's found.
+func (s *Subscriber) Kick(id string) bool {
+	var kicked *webrtcx.WebRTC
+	s.viewers.Range(func(key, value interface{}) bool {
+		if value.(viewer).ID == id {
+			kicked = key.(*webrtcx.WebRTC)
+			return false
+		}
+		return true
+	})
+	if kicked == nil {
+		return false
+	}
+	if err := kicked.Close(); err != nil {
+		s.logger.Err(err).Str("viewer", id).Msg("could not close kicked subscriber peer connection")
+	}
+	s.logger.Info().Str("viewer", id).Msg("kicked subscriber")
+	return true
+}
+
+// Viewer returns the subscriber peer connection of id, see /v1/admin/subscribers, and meta of the stream it watches.
+func (s *Subscriber) Viewer(id string) (*webrtcx.WebRTC, *pb.Meta, bool) {
+	var (
+		found *webrtcx.WebRTC
+		meta  *pb.Meta
+	)
+	s.viewers.Range(func(key, value interface{}) bool {
+		if value.(viewer).ID == id {
+			found, meta = key.(*webrtcx.WebRTC), value.(viewer).Meta
+			return false
+		}
+		return true
+	})
+	return found, meta, found != nil
+}
+
+// KickSession closes subscriber peer connections of viewers of the session of key, and returns how many are closed.
+func (s *Subscriber) KickSession(key session.Key) int {
+	var kicked []*webrtcx.WebRTC
+	s.viewers.Range(func(k, value interface{}) bool {
+		if s.sessions.Key(value.(viewer).Meta) == key {
+			kicked = append(kicked, k.(*webrtcx.WebRTC))
+		}
+		return true
+	})
+	for _, w := range kicked {
+		if err := w.Close(); err != nil {
+			s.logger.Err(err).Msg("could not close kicked subscriber peer connection")
+		}
+	}
+	return len(kicked)
+}
@@ -0,0 +1,69 @@
+package subscriber
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// limitReason is why a subscriber peer connection is closed by limits.
+type limitReason string
+
+const (
+	limitICEConnectTimeout limitReason = "ice_connect_timeout"
+	limitSessionExpired    limitReason = "session_expired"
+)
+
+// limit closes subscriber peer connection w if ICE isn't connected in ICEConnectTimeout after answered,
+// or once it has watched for MaxSubscriberDuration, e.g. to bound demo and unauthenticated access.
+// notify tells the client why before it's closed, it may be nil if the client can't be told.
+// It returns once w is closed or no more limit applies.
+func (s *Subscriber) limit(w *webrtcx.WebRTC, notify func(reason limitReason), logger *zerolog.Logger) {
+	if timeout := s.config.ICEConnectTimeout; timeout > 0 {
+		timer := time.NewTimer(timeout)
+		select {
+		case <-w.Connected():
+			timer.Stop()
+		case <-w.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			logger.Warn().Dur("timeout", timeout).Msg("subscriber did not connect ICE in time, closed it")
+			s.closeLimited(w, limitICEConnectTimeout, notify, logger)
+			return
+		}
+	} else {
+		select {
+		case <-w.Connected():
+		case <-w.Done():
+			return
+		}
+	}
+
+	max := s.config.MaxSubscriberDuration
+	if max <= 0 {
+		return
+	}
+	timer := time.NewTimer(max)
+	defer timer.Stop()
+	select {
+	case <-w.Done():
+	case <-timer.C:
+		logger.Info().Dur("max_duration", max).Msg("subscriber reached max duration, closed it")
+		s.closeLimited(w, limitSessionExpired, notify, logger)
+	}
+}
+
+// closeLimited tells the client reason by notify if not nil, and closes w.
+func (s *Subscriber) closeLimited(w *webrtcx.WebRTC, reason limitReason, notify func(reason limitReason), logger *zerolog.Logger) {
+	metrics.SubscriberLimits.WithLabelValues(string(reason)).Inc()
+	if notify != nil {
+		notify(reason)
+	}
+	if err := w.Close(); err != nil {
+		logger.Err(err).Msg("could not close limited subscriber peer connection")
+	}
+}
@@ -0,0 +1,45 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"net/http"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// handleMarkers lists markers of a live stream, operators add them by the admin API.
+func (s *Subscriber) handleMarkers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sess, ok := s.streamSession(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(sess.Markers()); err != nil {
+			s.logger.Err(err).Msg("could not write markers JSON")
+		}
+	}
+}
+
+// streamSession returns the live session of stream in URL path, or replies not found.
+func (s *Subscriber) streamSession(w http.ResponseWriter, r *http.Request) (*session.Session, bool) {
+	vars := mux.Vars(r)
+	trackSource, err := session.ParseTrackSource(vars["track_source"])
+	if err != nil {
+		http.Error(w, "invalid track source", http.StatusBadRequest)
+		return nil, false
+	}
+	sess, ok := s.sessions.Get(s.sessions.Key(&pb.Meta{
+		Id:          vars["id"],
+		TrackSource: trackSource,
+	}))
+	if !ok {
+		http.Error(w, "stream not found", http.StatusNotFound)
+		return nil, false
+	}
+	return sess, true
+}
@@ -0,0 +1,372 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/acl"
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/hooks"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// SignalMQTT performs webRTC signaling over MQTT for clients not speaking WebSocket, e.g. ground-station apps.
+// Topics mirror the publisher's, but are keyed by client id before "id/track_source" of the stream:
+// a client publishes offer to "offer_prefix/client_id/id/track_source", and receives answer and candidates
+// on topics of the same suffix. Sessions are shared with WebSocket subscribers. If multi-tenant, topics are
+// prefixed by the tenant as ones of edges, e.g. "acme/offer_prefix/client_id/drone1/0", so brokers can restrict
+// clients of each tenant to its own topics, and clients watch streams of that tenant only.
+func (s *Subscriber) SignalMQTT() {
+	s.clientMux.Lock()
+	s.signaling = true
+	s.clientMux.Unlock()
+
+	topic := s.offerTopic()
+	t := s.mqttClient().Subscribe(topic, byte(s.config.Qos), s.handleOffer())
+	// the connection handler is called in a goroutine so blocking here would hot cause an issue. However as blocking
+	// in other handlers does cause problems its best to just assume we should not block
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			s.logger.Err(t.Error()).Msgf("could not subscribe to %s", topic)
+		} else {
+			s.logger.Info().Msgf("subscribed to %s", topic)
+		}
+	}()
+}
+
+func (s *Subscriber) offerTopic() string {
+	topic := s.config.MQTTOfferTopicPrefix + "/" + "+" + "/" + "+" + "/" + "+"
+	if s.tenants != nil {
+		topic = "+" + "/" + topic
+	}
+	return topic
+}
+
+// Unsubscribe stops MQTT signaling and watching capabilities started by SignalMQTT and WatchCapabilities,
+// it unsubscribes from their topics before ctx is done. Established peer connections are kept, and both may be
+// called again, e.g. to retry a failed start.
+func (s *Subscriber) Unsubscribe(ctx context.Context) error {
+	err := s.unsubscribe(ctx)
+	s.clientMux.Lock()
+	s.signaling, s.watching = false, false
+	s.clientMux.Unlock()
+	return err
+}
+
+// unsubscribe unsubscribes from offer and candidate topics of MQTT signaling and capability topic, if started.
+func (s *Subscriber) unsubscribe(ctx context.Context) error {
+	s.clientMux.RLock()
+	signaling, watching := s.signaling, s.watching
+	s.clientMux.RUnlock()
+
+	var topics []string
+	if signaling {
+		topics = append(topics, s.offerTopic())
+		s.candidateTopics.Range(func(key, _ interface{}) bool {
+			topics = append(topics, key.(string))
+			return true
+		})
+	}
+	if watching {
+		topics = append(topics, s.capabilityTopic())
+	}
+	if len(topics) == 0 {
+		return nil
+	}
+	t := s.mqttClient().Unsubscribe(topics...)
+	select {
+	case <-t.Done():
+		if t.Error() != nil {
+			s.logger.Err(t.Error()).Msg("could not unsubscribe from topics")
+		} else {
+			s.logger.Info().Int("topics", len(topics)).Msg("unsubscribed from topics")
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleOffer handles offers of MQTT subscribers.
+func (s *Subscriber) handleOffer() mqtt.MessageHandler {
+	return func(c mqtt.Client, m mqtt.Message) {
+		// Topic is "offer_prefix/client_id/id/track_source", prefixed by "tenant/" if multi-tenant.
+		topic, clientTenant := m.Topic(), defaultTenant
+		if s.tenants != nil {
+			clientTenant = tenant.FromTopic(topic)
+			topic = strings.TrimPrefix(topic, clientTenant+"/")
+		}
+		parts := strings.Split(strings.TrimPrefix(topic, s.config.MQTTOfferTopicPrefix+"/"), "/")
+		if len(parts) != 3 {
+			s.logger.Error().Str("topic", m.Topic()).Msg("incorrect offer topic")
+			mqttSignalingFailed("topic")
+			return
+		}
+		// The client ID of the topic is trusted as the subject of ACL, billing and audit, so the broker must restrict
+		// each client to topics of its own client ID, and of its own tenant if multi-tenant.
+		clientID := parts[0]
+
+		var offer pb.SessionDescription
+		if err := proto.Unmarshal(m.Payload(), &offer); err != nil {
+			s.logger.Err(err).Msg("could not unmarshal sdp")
+			mqttSignalingFailed("unmarshal")
+			return
+		}
+		if offer.Meta == nil || offer.Meta.Id == "" {
+			s.logger.Error().Msg("incorrect metadata")
+			mqttSignalingFailed("metadata")
+			return
+		}
+		if s.tenants != nil {
+			// Clients name streams of their tenant by raw machine IDs as edges do.
+			if owner, _ := tenant.Split(offer.Meta.Id); owner == "" {
+				offer.Meta.Id = tenant.Qualify(clientTenant, offer.Meta.Id)
+			}
+		}
+
+		peer := conns.Conn{ID: conns.NewID(), Kind: conns.KindPeer, Role: metrics.RoleSubscriber, Meta: offer.Meta, Tenant: clientTenant}
+		logger := peer.Logger(&s.logger).With().
+			Str("client_id", clientID).
+			Str("id", offer.Meta.Id).
+			Int32("track_source", int32(offer.Meta.TrackSource)).
+			Logger()
+		logger.Info().Msg("received offer from MQTT subscriber")
+
+		answer, err := s.signalMQTTPeerConnection(clientID, peer, &offer, &logger)
+		if err != nil {
+			logger.Err(err).Msg("failed to signal peer connection")
+			if errors.Is(err, webrtcx.ErrSignalTimeout) {
+				mqttSignalingFailed("timeout")
+			} else {
+				mqttSignalingFailed("signal")
+			}
+			return
+		}
+
+		payload, err := pb.EncodeSDP(answer, offer.Meta)
+		if err != nil {
+			logger.Err(err).Msg("could not encode sdp")
+			mqttSignalingFailed("encode")
+			return
+		}
+		answerTopic := s.mqttTopic(s.config.MQTTAnswerTopicPrefix, clientID, offer.Meta)
+		t := c.Publish(answerTopic, byte(s.config.Qos), s.config.Retained, payload)
+		<-t.Done()
+		if t.Error() != nil {
+			logger.Err(t.Error()).Msgf("could not publish to %s", answerTopic)
+			mqttSignalingFailed("publish")
+			return
+		}
+		logger.Info().Str("answer_topic", answerTopic).Msg("sent answer to MQTT subscriber")
+	}
+}
+
+// mqttSignalingFailed counts a failed signaling of MQTT subscriber offer.
+func mqttSignalingFailed(reason string) {
+	metrics.SignalingFailures.WithLabelValues(metrics.RoleSubscriber, reason).Inc()
+}
+
+// mqttTopic returns the MQTT topic of prefix unique to a stream of an MQTT subscriber, "prefix/client_id/id/track_source",
+// prefixed by the tenant of the stream if multi-tenant, which is then omitted from the ID.
+func (s *Subscriber) mqttTopic(prefix, clientID string, meta *pb.Meta) string {
+	if s.tenants == nil {
+		return prefix + "/" + clientID + "/" + meta.Id + "/" + strconv.Itoa(int(meta.TrackSource))
+	}
+	owner, id := tenant.Split(meta.Id)
+	return owner + "/" + prefix + "/" + clientID + "/" + id + "/" + strconv.Itoa(int(meta.TrackSource))
+}
+
+// signalMQTTPeerConnection creates a subscriber peer of an existing session and performs webRTC signaling,
+// the peer connection is registered as peer once created. The client is of the tenant of peer.
+func (s *Subscriber) signalMQTTPeerConnection(
+	clientID string,
+	peer conns.Conn,
+	offer *pb.SessionDescription,
+	logger *zerolog.Logger,
+) (
+	*webrtc.SessionDescription,
+	error,
+) {
+	start := time.Now()
+	// MQTT clients are authenticated by broker, which restricts them to topics of their tenant.
+	if !s.allowTenant(peer.Tenant, offer.Meta) {
+		return nil, fmt.Errorf("stream %s is not of tenant %s", offer.Meta.Id, peer.Tenant)
+	}
+	if s.quota.Exceeded(peer.Tenant) {
+		return nil, fmt.Errorf("egress quota of tenant %s exceeded", peer.Tenant)
+	}
+	if s.acl != nil {
+		// MQTT client ID is the subject, as MQTT clients carry no token.
+		r := &acl.Request{Subject: clientID, Tenant: peer.Tenant, Meta: offer.Meta}
+		if err := s.acl.Check(context.Background(), r); err != nil {
+			return nil, err
+		}
+	}
+	if !s.allowViewer(offer.Meta) {
+		return nil, fmt.Errorf("viewers limit of tenant of %s reached", offer.Meta.Id)
+	}
+	if err := s.hooks.OnSubscribeRequest(context.Background(), &hooks.SubscribeRequest{
+		Meta:     offer.Meta,
+		Protocol: protocolMQTT,
+		Tenant:   peer.Tenant,
+		Subject:  clientID,
+	}); err != nil {
+		return nil, fmt.Errorf("rejected by hooks: %w", err)
+	}
+	sess, ok := s.sessions.Get(s.sessions.Key(offer.Meta))
+	if !ok {
+		sess, ok = s.relay(context.Background(), offer.Meta, logger)
+	}
+	if !ok {
+		return nil, fmt.Errorf("no session of id %s and track source %d", offer.Meta.Id, offer.Meta.TrackSource)
+	}
+
+	var sdp webrtc.SessionDescription
+	if err := json.Unmarshal([]byte(offer.Sdp), &sdp); err != nil {
+		return nil, err
+	}
+
+	recvCandidate, releaseCandidate := s.recvMQTTCandidate(clientID, offer.Meta)
+	w := webrtcx.New(
+		s.media,
+		s.config.WebRTCConfigOptions,
+		logger,
+		s.sendMQTTCandidate(clientID, offer.Meta),
+		recvCandidate,
+		webrtcx.NoopRegisterSessionFunc,
+		webrtcx.NoopUnregisterSessionFunc,
+		s.hookStream(offer.Meta),
+	)
+	w.RelayTelemetry(sess.Telemetry)
+	s.filterCandidates(w, offer.Meta)
+	firstMedia := make(chan struct{})
+	w.OnFirstMedia(func() { close(firstMedia) })
+	w.OnKeyframeRequest(sess.RequestKeyframe)
+	if sess.VideoCache != nil {
+		w.Retransmit(sess.PacketCache)
+	}
+	if len(sess.Layers.RIDs()) > 1 {
+		w.RewriteLayers()
+	}
+	if sess.LowLatency {
+		w.DelayPlayout()
+	}
+	metrics.JoinsPending.Inc()
+
+	signalCtx, cancel := webrtcx.SignalContext(context.Background(), s.config.WebRTCConfigOptions)
+	defer cancel()
+	answer, err := w.CreateSubscriber(signalCtx, &sdp, sess.VideoTrack, sess.AudioTrack)
+	if err != nil {
+		s.joinFailed()
+		releaseCandidate()
+		return nil, fmt.Errorf("failed to create webRTC subscriber: %w", err)
+	}
+	s.peers.Add(w)
+	conns.Default.Register(peer, w.Done())
+	go s.trackJoin(start, w, firstMedia, logger)
+	logger.Info().Msg("created subscriber")
+	// MQTT subscribers are not listed as viewers, as they can't receive stats events, but they are audited.
+	s.auditViewer(w, viewer{ID: peer.ID, Meta: offer.Meta, Tenant: peer.Tenant, Subject: clientID, Protocol: protocolMQTT, Since: start})
+	go s.controlCongestion(w, sess, nil, nil, logger)
+	go s.limit(w, nil, logger)
+
+	// The peer connection outlives MQTT signaling, so the viewer leaves after it's closed.
+	sess.Join()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-w.Done()
+		cancel()
+		sess.Leave()
+		releaseCandidate()
+	}()
+	go s.accountEgress(ctx, peer.Tenant, clientID, sess, w)
+
+	return answer, nil
+}
+
+// sendMQTTCandidate sends candidate to MQTT subscriber.
+func (s *Subscriber) sendMQTTCandidate(clientID string, meta *pb.Meta) webrtcx.SendCandidateFunc {
+	return func(candidate *webrtc.ICECandidate) error {
+		payload, err := pb.EncodeCandidate(candidate)
+		if err != nil {
+			return fmt.Errorf("could not encode candidate: %w", err)
+		}
+		topic := s.mqttTopic(s.config.MQTTCandidateSendTopicPrefix, clientID, meta)
+		t := s.mqttClient().Publish(topic, byte(s.config.Qos), s.config.Retained, payload)
+		// Handle the token in a go routine so this loop keeps sending messages regardless of delivery status
+		go func() {
+			<-t.Done()
+			if t.Error() != nil {
+				s.logger.Err(t.Error()).Msgf("could not publish to %s", topic)
+			}
+		}()
+		return nil
+	}
+}
+
+// recvMQTTCandidate receives candidates from MQTT subscriber. release unsubscribes from the topic once the peer
+// connection is closed or signaling failed, unless a re-offer subscribed to it again, it must be called after
+// signaling returns.
+func (s *Subscriber) recvMQTTCandidate(clientID string, meta *pb.Meta) (recv webrtcx.RecvCandidateFunc, release func()) {
+	topic := s.mqttTopic(s.config.MQTTCandidateRecvTopicPrefix, clientID, meta)
+	var candidates *webrtcx.CandidateQueue
+	recv = func() *webrtcx.CandidateQueue {
+		candidates = webrtcx.NewCandidateQueue()
+		s.candidateTopicsMux.Lock()
+		defer s.candidateTopicsMux.Unlock()
+		s.candidateTopics.Store(topic, candidates)
+		t := s.mqttClient().Subscribe(topic, byte(s.config.Qos), func(c mqtt.Client, m mqtt.Message) {
+			candidate, err := pb.DecodeCandidate(m.Payload())
+			if err != nil {
+				s.logger.Err(err).Msg("could not decode candidate")
+				return
+			}
+			// Handlers must not block, candidates of an ended or closed peer connection are dropped.
+			if !candidates.Push(candidate) {
+				s.logger.Warn().Str("topic", topic).Msg("dropped candidate of ended or closed peer connection")
+			}
+		})
+		go func() {
+			<-t.Done()
+			if t.Error() != nil {
+				s.logger.Err(t.Error()).Msgf("could not subscribe to %s", topic)
+			} else {
+				s.logger.Info().Msgf("subscribed to %s", topic)
+			}
+		}()
+		return candidates
+	}
+	release = func() { s.unsubscribeCandidate(topic, candidates) }
+	return recv, release
+}
+
+// unsubscribeCandidate unsubscribes from candidate topic of an MQTT subscriber if it's still subscribed for candidates.
+func (s *Subscriber) unsubscribeCandidate(topic string, candidates *webrtcx.CandidateQueue) {
+	s.candidateTopicsMux.Lock()
+	defer s.candidateTopicsMux.Unlock()
+	if current, ok := s.candidateTopics.Load(topic); !ok || candidates == nil || current != candidates {
+		return
+	}
+	s.candidateTopics.Delete(topic)
+	t := s.mqttClient().Unsubscribe(topic)
+	go func() {
+		<-t.Done()
+		if t.Error() != nil {
+			s.logger.Err(t.Error()).Msgf("could not unsubscribe from %s", topic)
+		}
+	}()
+}
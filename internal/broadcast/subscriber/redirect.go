@@ -0,0 +1,67 @@
+package subscriber
+
+import (
+	"context"
+	"net/http"
+
+	pb "github.com/SB-IM/pb/signal"
+	"nhooyr.io/websocket"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/directory"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// SetDirectory sets the multi-region directory, so viewers of streams hosted in other regions are redirected.
+// It must be called before serving signaling.
+func (s *Subscriber) SetDirectory(d *directory.Directory) {
+	s.directory = d
+}
+
+// redirectHTTP redirects a signaling request of an edge device, given by "id" query, to the instance hosting it
+// if it's another one, and reports whether it's redirected. It's for clients following redirects on WebSocket
+// handshake, browsers don't and get "redirect" event of their offers instead.
+func (s *Subscriber) redirectHTTP(w http.ResponseWriter, r *http.Request) bool {
+	id := r.URL.Query().Get("id")
+	// Streams hosted elsewhere are relayed if clustering is enabled.
+	if s.directory == nil || s.cluster != nil || id == "" {
+		return false
+	}
+	entry, ok := s.directory.Remote(r.Context(), s.sessions.Key(&pb.Meta{Id: id}))
+	if !ok {
+		return false
+	}
+	metrics.DirectoryRedirects.Inc()
+	http.Redirect(w, r, entry.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	return true
+}
+
+// redirect sends "redirect" event of an offer to client if the stream is hosted by another instance,
+// and reports whether it's sent. Client should offer again through signaling URL of the event,
+// keeping query of its current signaling URL, e.g. token.
+func (s *Subscriber) redirect(ctx context.Context, c *websocket.Conn, id string, meta *pb.Meta) bool {
+	if s.directory == nil || s.cluster != nil {
+		return false
+	}
+	entry, ok := s.directory.Remote(ctx, s.sessions.Key(meta))
+	if !ok {
+		return false
+	}
+	type data struct {
+		Meta   *pb.Meta `json:"meta"`
+		Region string   `json:"region,omitempty"`
+		URL    string   `json:"url"`
+	}
+	metrics.DirectoryRedirects.Inc()
+	if err := s.writeJSON(ctx, c, outgoingMessage{
+		Event: "redirect",
+		ID:    id,
+		Data: data{
+			Meta:   meta,
+			Region: entry.Region,
+			URL:    entry.SignalURL(),
+		},
+	}); err != nil {
+		s.logger.Err(err).Msg("could not write redirect JSON")
+	}
+	return true
+}
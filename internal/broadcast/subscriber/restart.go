@@ -0,0 +1,91 @@
+package subscriber
+
+import (
+	"context"
+	"encoding/json"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+	"nhooyr.io/websocket"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// restartICE restarts ICE of a negotiated stream by "restart-ice" event, keeping its peer connection and tracks.
+// A re-offer of client with new ICE credentials is answered by "restart-ice-answer" event. Without one, server
+// offers new credentials by "restart-ice-offer" event, which client answers by "restart-ice-answer" event.
+// Candidates of client for the new credentials are added from candidates.
+func (s *Subscriber) restartICE(
+	ctx context.Context,
+	c *websocket.Conn,
+	id string,
+	n *negotiation,
+	data *pb.SessionDescription,
+	offer *webrtc.SessionDescription,
+	candidates *webrtcx.CandidateQueue,
+) {
+	logger := n.peer.Logger(&s.logger).With().Str("event_id", id).Str("id", n.sess.ID).Logger()
+	signalCtx, cancel := webrtcx.SignalContext(ctx, s.config.WebRTCConfigOptions)
+	defer cancel()
+
+	event := "restart-ice-answer"
+	var sdp *webrtc.SessionDescription
+	var err error
+	if offer != nil {
+		sdp, err = n.w.RestartICE(signalCtx, offer, candidates)
+	} else {
+		event = "restart-ice-offer"
+		sdp, err = n.w.OfferICERestart(signalCtx)
+	}
+	if err != nil {
+		metrics.ICERestarts.WithLabelValues("failed").Inc()
+		logger.Err(err).Msg("could not restart ICE")
+		_ = s.replyErr(ctx, c, id, data.Meta, httpx.ErrFailedToRestartICE)
+		return
+	}
+	b, err := json.Marshal(sdp)
+	if err != nil {
+		logger.Err(err).Msg("could not marshal session description to JSON")
+		_ = s.replyErr(ctx, c, id, data.Meta, httpx.ErrUnmarshalJSON)
+		return
+	}
+	if err := s.writeJSON(ctx, c, outgoingMessage{
+		Event: event,
+		ID:    id,
+		Data: &pb.SessionDescription{
+			Meta: data.Meta,
+			Sdp:  string(b),
+		},
+	}); err != nil {
+		logger.Err(err).Str("event", event).Msg("could not write ICE restart event")
+		return
+	}
+	if offer != nil {
+		metrics.ICERestarts.WithLabelValues("restarted").Inc()
+		logger.Info().Msg("restarted ICE by offer of subscriber")
+		return
+	}
+	logger.Info().Msg("sent ICE restart offer to subscriber")
+}
+
+// acceptICERestart sets the answer of client by "restart-ice-answer" event to the offer of restartICE.
+func (s *Subscriber) acceptICERestart(
+	ctx context.Context,
+	c *websocket.Conn,
+	id string,
+	n *negotiation,
+	data *pb.SessionDescription,
+	answer *webrtc.SessionDescription,
+) {
+	logger := n.peer.Logger(&s.logger).With().Str("event_id", id).Str("id", n.sess.ID).Logger()
+	if err := n.w.AcceptICERestart(answer, n.candidates); err != nil {
+		metrics.ICERestarts.WithLabelValues("failed").Inc()
+		logger.Err(err).Msg("could not accept ICE restart answer")
+		_ = s.replyErr(ctx, c, id, data.Meta, httpx.ErrFailedToRestartICE)
+		return
+	}
+	metrics.ICERestarts.WithLabelValues("restarted").Inc()
+	logger.Info().Msg("restarted ICE by answer of subscriber")
+}
@@ -0,0 +1,48 @@
+package subscriber
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/share"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// SetShares sets sharing links checked along with tokens minted for them. It must be called before serving signaling.
+func (s *Subscriber) SetShares(l *share.Links) {
+	s.shares = l
+}
+
+// authenticate validates token of request r and returns its claims, a token of a sharing link must be valid by the
+// link too. If multi-tenant, the token must carry the tenant of the client. A nil Authenticator returns nil claims
+// without error unless multi-tenant.
+func (s *Subscriber) authenticate(r *http.Request) (*auth.Claims, error) {
+	claims, err := s.auth.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if s.tenants != nil && (claims == nil || claims.Tenant == "") {
+		return nil, errNoTenant
+	}
+	if err := s.shares.Check(claims, r.RemoteAddr, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// joinShare counts the viewer of claims by its sharing link until w is closed, and closes w once the link is revoked
+// or expires. It returns the error code replied to the viewer if it may not watch by the link anymore.
+func (s *Subscriber) joinShare(claims *auth.Claims, remoteAddr string, w *webrtcx.WebRTC) (httpx.Code, error) {
+	err := s.shares.Join(claims, remoteAddr, w.Done(), func() { _ = w.Close() }, time.Now())
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.Is(err, share.ErrMaxViewers):
+		return httpx.ErrShareViewerLimit, err
+	default:
+		return httpx.ErrShareLinkInvalid, err
+	}
+}
@@ -0,0 +1,40 @@
+package subscriber
+
+import (
+	"context"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+	"nhooyr.io/websocket"
+)
+
+// connectionState is the data of "connection-state" event.
+type connectionState struct {
+	Meta *pb.Meta `json:"meta"`
+	// State is ICE connection state of the peer connection, i.e. checking, connected, completed, disconnected,
+	// failed or closed.
+	State string `json:"state"`
+}
+
+// sendConnectionState returns a handler sending ICE connection states of a subscriber peer connection
+// to WebSocket client, so it can show progress and retry once failed instead of waiting for media.
+// The initial new state is not sent.
+func (s *Subscriber) sendConnectionState(
+	ctx context.Context,
+	c *websocket.Conn,
+	id string,
+	meta *pb.Meta,
+) func(state webrtc.ICEConnectionState) {
+	return func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateNew {
+			return
+		}
+		if err := s.writeJSON(ctx, c, outgoingMessage{
+			Event: "connection-state",
+			ID:    id,
+			Data:  connectionState{Meta: meta, State: state.String()},
+		}); err != nil {
+			s.logger.Debug().Err(err).Str("event_id", id).Str("state", state.String()).Msg("could not send connection state")
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package subscriber
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"nhooyr.io/websocket"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// viewer is a subscriber peer connection of a stream.
+type viewer struct {
+	// ID is the connection ID of the peer connection, operators kick the viewer by it.
+	ID         string    `json:"id"`
+	Meta       *pb.Meta  `json:"meta"`
+	Tenant     string    `json:"tenant"`
+	Subject    string    `json:"subject,omitempty"` // Subject of the token, or client ID of MQTT subscribers.
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Protocol   string    `json:"protocol"` // Signaling protocol, websocket, whep or mqtt.
+	Since      time.Time `json:"since"`
+}
+
+// Signaling protocols of viewers.
+const (
+	protocolWebSocket = "websocket"
+	protocolWHEP      = "whep"
+	protocolMQTT      = "mqtt"
+)
+
+// PeerStats is stats of a viewer.
+type PeerStats struct {
+	viewer
+	Stats webrtcx.Stats `json:"stats"`
+}
+
+// watchViewer tracks w as a viewer until its peer connection is gone, so its stats can be listed.
+func (s *Subscriber) watchViewer(w *webrtcx.WebRTC, v viewer) {
+	s.viewers.Store(w, v)
+	s.auditViewer(w, v)
+	go func() {
+		<-w.Done()
+		s.viewers.Delete(w)
+	}()
+}
+
+// sendStats sends "stats" events of a subscriber peer connection in StatsInterval to WebSocket client,
+// until the peer connection is gone or ctx is done. Events carry event ID of the offer as candidates do.
+func (s *Subscriber) sendStats(ctx context.Context, c *websocket.Conn, w *webrtcx.WebRTC, id string, meta *pb.Meta) {
+	if s.config.StatsInterval <= 0 {
+		return
+	}
+	type data struct {
+		Meta  *pb.Meta      `json:"meta"`
+		Stats webrtcx.Stats `json:"stats"`
+	}
+	ticker := time.NewTicker(s.config.StatsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.Done():
+			return
+		case <-ticker.C:
+			if err := s.writeJSON(ctx, c, outgoingMessage{
+				Event: "stats",
+				ID:    id,
+				Data:  data{Meta: meta, Stats: w.Stats()},
+			}); err != nil {
+				peer, _ := conns.FromContext(ctx)
+				logger := peer.Logger(&s.logger)
+				logger.Err(err).Str("id", meta.Id).Msg("could not write stats event")
+				return
+			}
+		}
+	}
+}
+
+// Peers returns stats of all live subscriber peer connections, for operators to spot viewers with poor links.
+func (s *Subscriber) Peers() []PeerStats {
+	peers := make([]PeerStats, 0)
+	s.viewers.Range(func(key, value interface{}) bool {
+		peers = append(peers, PeerStats{
+			viewer: value.(viewer),
+			Stats:  key.(*webrtcx.WebRTC).Stats(),
+		})
+		return true
+	})
+	return peers
+}
@@ -0,0 +1,116 @@
+package subscriber
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/capability"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+)
+
+// stream is a stream listed for web clients, it's either live or only advertised by edge capabilities.
+type stream struct {
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	Live        bool           `json:"live"`
+	Codec       string         `json:"codec,omitempty"`
+	AudioCodec  string         `json:"audio_codec,omitempty"`
+	Viewers     int64          `json:"viewers"`
+	StartedAt   *time.Time     `json:"started_at,omitempty"`
+	Latency     *latency       `json:"latency,omitempty"`
+
+	Capability *capability.Source `json:"capability,omitempty"`
+}
+
+// latency is percentiles in milliseconds of delays of a live stream from edge, see session.Latency.
+type latency struct {
+	P50 float64 `json:"p50_ms"`
+	P95 float64 `json:"p95_ms"`
+	P99 float64 `json:"p99_ms"`
+}
+
+// newLatency returns latency of sess, or nil if edge doesn't stamp packets.
+func newLatency(sess *session.Session) *latency {
+	p, ok := sess.Latency.Percentiles()
+	if !ok {
+		return nil
+	}
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return &latency{P50: ms(p.P50), P95: ms(p.P95), P99: ms(p.P99)}
+}
+
+// handleStreams lists all live streams merged with track sources advertised by edges,
+// so web clients can discover them before signaling. Only streams of the tenant of the request are listed
+// if multi-tenant, clients are then authenticated as signaling ones.
+func (s *Subscriber) handleStreams() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		visible := func(id string) bool { return true }
+		if s.tenants != nil {
+			claims, err := s.authenticate(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			t := requestTenant(claims)
+			visible = func(id string) bool {
+				owner, _ := tenant.Split(id)
+				return owner == t
+			}
+		}
+
+		sessions := s.sessions.List()
+		streams := make([]stream, 0, len(sessions))
+		live := make(map[session.Key]int, len(sessions)) // Index in streams by session key.
+		for _, sess := range sessions {
+			if !visible(sess.Meta.Id) {
+				continue
+			}
+			startedAt := sess.CreatedAt
+			live[sess.Key] = len(streams)
+			streams = append(streams, stream{
+				ID:          sess.Meta.Id,
+				TrackSource: sess.Meta.TrackSource,
+				Live:        true,
+				Codec:       sess.VideoTrack.Codec().MimeType,
+				AudioCodec:  sess.AudioTrack.Codec().MimeType,
+				Viewers:     sess.Viewers(),
+				StartedAt:   &startedAt,
+				Latency:     newLatency(sess),
+			})
+		}
+		for id, doc := range s.capabilities.List() {
+			if !visible(id) {
+				continue
+			}
+			for i := range doc.Sources {
+				source := &doc.Sources[i]
+				meta := &pb.Meta{Id: id, TrackSource: source.TrackSource}
+				if j, ok := live[s.sessions.Key(meta)]; ok {
+					streams[j].Capability = source
+					continue
+				}
+				streams = append(streams, stream{
+					ID:          id,
+					TrackSource: source.TrackSource,
+					Capability:  source,
+				})
+			}
+		}
+		sort.Slice(streams, func(i, j int) bool {
+			if streams[i].ID != streams[j].ID {
+				return streams[i].ID < streams[j].ID
+			}
+			return streams[i].TrackSource < streams[j].TrackSource
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(streams); err != nil {
+			s.logger.Err(err).Msg("could not write streams JSON")
+		}
+	}
+}
@@ -3,32 +3,107 @@ package subscriber
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	pb "github.com/SB-IM/pb/signal"
-	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gorilla/mux"
 	"github.com/pion/webrtc/v3"
 	"github.com/rs/zerolog"
 	"nhooyr.io/websocket"
 	"nhooyr.io/websocket/wsjson"
 
+	"github.com/SB-IM/skywalker/internal/broadcast/accounting"
+	"github.com/SB-IM/skywalker/internal/broadcast/acl"
+	"github.com/SB-IM/skywalker/internal/broadcast/audit"
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/capability"
 	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/cluster"
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/cors"
+	"github.com/SB-IM/skywalker/internal/broadcast/directory"
+	"github.com/SB-IM/skywalker/internal/broadcast/hooks"
 	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/mqttx"
+	"github.com/SB-IM/skywalker/internal/broadcast/quota"
+	"github.com/SB-IM/skywalker/internal/broadcast/ratelimit"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/share"
+	"github.com/SB-IM/skywalker/internal/broadcast/slo"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+	"github.com/SB-IM/skywalker/internal/broadcast/thumbnail"
+	"github.com/SB-IM/skywalker/internal/broadcast/tracing"
 	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
 )
 
 // Subscriber stands for a subscriber webRTC peer.
 type Subscriber struct {
-	client mqtt.Client
-	config *cfg.SubscriberConfigOptions
-	logger zerolog.Logger
+	client    mqttx.SignalTransport
+	clientMux sync.RWMutex
+	signaling bool // Whether SignalMQTT has been called, guarded by clientMux.
+	watching  bool // Whether WatchCapabilities has been called, guarded by clientMux.
+	config    *cfg.SubscriberConfigOptions
+	logger    zerolog.Logger
 
 	// sessions must be created before used by publisher and is shared between publishers ans subscribers.
 	// It's only read by subscriber.
-	sessions *sync.Map
+	sessions *session.SessionManager
+	// media is the ICE/UDP stack of subscriber peer connections.
+	media *webrtcx.Media
+
+	// quota accounts viewer egress per tenant.
+	quota *quota.Quota
+	// accountant accounts viewer egress per session and subject for billing, it's nil if accounting is disabled.
+	accountant *accounting.Accountant
+	// limiter limits signaling connections per client IP and in total.
+	limiter *ratelimit.Limiter
+	// auth authenticates signaling requests, it's nil if auth is disabled.
+	auth *auth.Authenticator
+	// slo tracks join latency of subscribers.
+	slo *slo.Tracker
+	// origins checks origins of WebSocket handshakes.
+	origins *cors.Policy
+	// capabilities are track source capabilities advertised by edges.
+	capabilities *capability.Store
+	// directory locates streams hosted in other regions, it's nil if the directory is disabled.
+	directory *directory.Directory
+	// cluster relays streams hosted by other instances, it's nil if clustering is disabled.
+	cluster *cluster.Cluster
+	// acl restricts streams subscribers may watch, it's nil if ACL is disabled.
+	acl    acl.ACL
+	aclMux sync.RWMutex
+	// audit records viewers joining and leaving, it's nil if audit is disabled.
+	audit *audit.Auditor
+	// thumbnails are previews of live streams, it's nil if thumbnails are disabled.
+	thumbnails *thumbnail.Thumbnailer
+	// shares are sharing links of streams, it's nil if auth is disabled.
+	shares *share.Links
+	// tenants isolates streams of tenants and limits their viewers, it's nil unless multi-tenant.
+	tenants *tenant.Tenants
+	// hooks are hooks of extensions, Nop by default.
+	hooks hooks.Hooks
+
+	// peers are live subscriber peer connections, they outlive signaling WebSocket connections.
+	peers *webrtcx.Peers
+	// viewers are details of live subscriber peer connections, keyed by them.
+	viewers sync.Map
+	// conns are open signaling WebSocket connections.
+	conns sync.Map
+	// candidateTopics are subscribed topics of receiving candidates from MQTT subscribers by the candidate queue of
+	// the latest peer connection of each. candidateTopicsMux serializes subscribing and unsubscribing them, so
+	// a closed peer connection never unsubscribes a re-offer.
+	candidateTopics    sync.Map
+	candidateTopicsMux sync.Mutex
+	// wheps are peers of WHEP subscribers by resource ID.
+	wheps sync.Map
 }
 
 // incomingMessage is a generic WebSocket incoming message.
@@ -36,6 +111,8 @@ type incomingMessage struct {
 	Event string          `json:"event"`
 	ID    string          `json:"id"`
 	Data  json.RawMessage `json:"data"`
+	// Traceparent is the W3C trace context of an offer, signaling of the offer is traced as its child.
+	Traceparent string `json:"traceparent,omitempty"`
 }
 
 // outgoingMessage is a generic WebSocket outgoing message.
@@ -43,34 +120,116 @@ type outgoingMessage struct {
 	Event string      `json:"event"`
 	ID    string      `json:"id"`
 	Data  interface{} `json:"data"`
+	// Traceparent is the W3C trace context of signaling of an answer, empty if it isn't traced.
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+const (
+	// defaultTenant is used if tenant is not specified by signaling request.
+	defaultTenant = "default"
+
+	defaultAccountInterval = 10 * time.Second
+)
+
+// answer is the data of "video-answer" event.
+// Negotiated session details are attached along with the SDP, so clients can display connection info directly.
+type answer struct {
+	*pb.SessionDescription
+	Session snapshot `json:"session"`
+}
+
+// snapshot is negotiated details of a subscriber session.
+type snapshot struct {
+	ID         string `json:"id"`
+	Codec      string `json:"codec"`
+	AudioCodec string `json:"audio_codec"`
+	Bitrate    uint64 `json:"bitrate"` // Estimated bitrate in bits per second of the stream from edge.
+	Region     string `json:"region,omitempty"`
+	// Layers are RIDs of simulcast layers from edge, the first one is watched until another is selected.
+	Layers []string `json:"layers,omitempty"`
+	// StreamID is the MSID of tracks of the stream.
+	StreamID string `json:"stream_id"`
+	// Bundle are streams bundled in the peer connection besides the offered one, see FeatureBundle.
+	Bundle []bundled `json:"bundle,omitempty"`
 }
 
 // New returns a new Subscriber.
 func New(
-	client mqtt.Client,
-	sessions *sync.Map,
+	client mqttx.SignalTransport,
+	sessions *session.SessionManager,
+	media *webrtcx.Media,
 	logger *zerolog.Logger,
 	config *cfg.SubscriberConfigOptions,
 ) *Subscriber {
-	l := logger.With().Str("component", "Subscriber").Logger()
+	l := loglevel.Default.Component(logger, "Subscriber")
 	return &Subscriber{
 		client:   client,
 		sessions: sessions,
+		media:    media,
 		config:   config,
 		logger:   l,
+		quota:    quota.New(config.QuotaConfigOptions),
+		limiter:  ratelimit.New(config.RateLimitConfigOptions),
+		auth:     auth.New(config.AuthConfigOptions),
+		slo:      slo.New(config.SLOConfigOptions),
+		origins:  cors.New(config.ServerConfigOptions),
+
+		capabilities: capability.NewStore(),
+		peers:        webrtcx.NewPeers(),
+		hooks:        hooks.Nop{},
+	}
+}
+
+// SetClient replaces the MQTT client used for hooking stream, MQTT signaling and capabilities,
+// e.g. after broker credentials are rotated, and subscribes to topics again with the new client if started.
+func (s *Subscriber) SetClient(client mqttx.SignalTransport) {
+	s.clientMux.Lock()
+	s.client = client
+	signaling, watching := s.signaling, s.watching
+	s.clientMux.Unlock()
+
+	if signaling {
+		s.SignalMQTT()
+	}
+	if watching {
+		s.WatchCapabilities()
 	}
 }
 
+// Heartbeat acquires locks taken by signaling in turn, it blocks while one of them is held, e.g. on deadlock.
+func (s *Subscriber) Heartbeat() {
+	s.clientMux.Lock()
+	s.clientMux.Unlock() //nolint:staticcheck // Empty critical section waits for holders.
+	s.peers.Len()
+}
+
+func (s *Subscriber) mqttClient() mqttx.SignalTransport {
+	s.clientMux.RLock()
+	defer s.clientMux.RUnlock()
+	return s.client
+}
+
 // Signal performs webRTC signaling for all subscriber peers.
 func (s *Subscriber) Signal() http.Handler {
 	r := mux.NewRouter()
 	r.HandleFunc("/v1/broadcast/signal", s.handleSignal()) // WebRTC SDP signaling. candidates trickling
 	s.logger.Info().Msg("registered signal HTTP handler")
-
-	if s.config.EnableFrontend {
-		r.Handle("/v1/test/e2e/broadcast", http.StripPrefix("/v1/test/e2e/broadcast", http.FileServer(http.Dir("e2e/broadcast/static")))) // E2e static file server for debuging
-		s.logger.Debug().Str("address", "http://localhost:8080/v1/test/e2e/broadcast").Msg("registered broadcast e2e static file server handler")
+	r.HandleFunc(whepPath+"/{id}/{track_source:[0-9]+}", s.handleWHEP()).Methods(http.MethodPost) // WHEP for standard players.
+	r.HandleFunc(whepPath+"/{id}/{track_source:[0-9]+}/{resource}", s.handleWHEPPatch()).Methods(http.MethodPatch)
+	r.HandleFunc(whepPath+"/{id}/{track_source:[0-9]+}/{resource}", s.handleWHEPDelete()).Methods(http.MethodDelete)
+	s.logger.Info().Msg("registered WHEP HTTP handler")
+	r.HandleFunc("/v1/broadcast/streams", s.handleStreams()).Methods(http.MethodGet) // Live streams discovery.
+	s.logger.Info().Msg("registered streams HTTP handler")
+	r.HandleFunc("/v1/broadcast/streams/{id}/{track_source:[0-9]+}/markers", s.handleMarkers()).Methods(http.MethodGet) // Event markers for post-flight review.
+	s.logger.Info().Msg("registered markers HTTP handler")
+	if s.thumbnails != nil {
+		r.HandleFunc("/v1/broadcast/streams/{id}/{track_source:[0-9]+}/thumbnail.jpg", s.handleThumbnail()).Methods(http.MethodGet) // Previews for dashboards.
+		s.logger.Info().Msg("registered thumbnail HTTP handler")
 	}
+	r.HandleFunc("/v1/broadcast/ice-config", s.handleICEConfig()).Methods(http.MethodGet) // ICE servers with short-lived TURN credentials.
+	s.logger.Info().Msg("registered ICE config HTTP handler")
+	r.HandleFunc("/v1/broadcast/slo", s.handleSLO()).Methods(http.MethodGet) // Join latency SLO report.
+	s.logger.Info().Msg("registered SLO HTTP handler")
 	return r
 }
 
@@ -78,146 +237,756 @@ func (s *Subscriber) Signal() http.Handler {
 // Has candidate trickle support.
 func (s *Subscriber) handleSignal() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-			OriginPatterns: []string{"*"}, // TODO: Must remove this option on production environment.
-		})
+		// Rate is limited first, as it's the cheapest check against clients stuck in retry loops.
+		if !s.limiter.Allow(r.RemoteAddr) {
+			metrics.SignalRejections.WithLabelValues("rate_limit").Inc()
+			s.logger.Debug().Str("remote_addr", r.RemoteAddr).Msg("rate limited signaling connection")
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many signaling connections", http.StatusTooManyRequests)
+			return
+		}
+		// Authenticate before upgrading, so unauthorized clients get a plain HTTP error.
+		claims, err := s.authenticate(r)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("remote_addr", r.RemoteAddr).Msg("unauthorized subscriber")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if s.redirectHTTP(w, r) {
+			return
+		}
+
+		acquired := s.limiter.Acquire()
+		if acquired {
+			defer s.limiter.Release()
+		}
+		c, err := websocket.Accept(w, r, s.origins.AcceptOptions())
 		if err != nil {
 			s.logger.Err(err).Msg("could not upgrade to webSocket connection")
 			return
 		}
+		if !acquired {
+			// Browsers can't read HTTP status of a failed handshake, so the close code tells them to back off.
+			metrics.SignalRejections.WithLabelValues("max_connections").Inc()
+			s.logger.Warn().Str("remote_addr", r.RemoteAddr).Msg("too many signaling connections, closed the new one")
+			c.Close(websocket.StatusTryAgainLater, "too many connections")
+			return
+		}
 		defer c.Close(websocket.StatusNormalClosure, "")
+		s.conns.Store(c, struct{}{})
+		defer s.conns.Delete(c)
+		metrics.WebSocketConnects.Inc()
+		metrics.WebSocketConnections.Inc()
+		defer func() {
+			metrics.WebSocketDisconnects.Inc()
+			metrics.WebSocketConnections.Dec()
+		}()
 
 		ctx, cancel := context.WithCancel(r.Context())
 		defer cancel()
+		// Browsers can't set headers of WebSocket handshakes, so offers may carry their own trace context too.
+		ctx = tracing.WithRemote(ctx, r.Header.Get("traceparent"))
 
-		s.processMessage(ctx, c)
+		// Tenant is used for egress accounting, and isolates streams of tenants if multi-tenant.
+		tenant := requestTenant(claims)
+
+		conn := conns.Default.Register(conns.Conn{
+			Kind:       conns.KindWebSocket,
+			Role:       metrics.RoleSubscriber,
+			Tenant:     tenant,
+			RemoteAddr: r.RemoteAddr,
+		}, ctx.Done())
+		logger := conn.Logger(&s.logger)
+		logger.Info().Str("remote_addr", r.RemoteAddr).Msg("accepted signaling connection")
+		go s.keepalive(ctx, c, cancel, &logger)
+		s.processMessage(conns.NewContext(ctx, conn), c, tenant, claims, r.URL.Query().Get("ice"))
 	}
 }
 
-func (s *Subscriber) processMessage(ctx context.Context, c *websocket.Conn) {
-	candidateChan := map[pb.TrackSource]chan string{
-		pb.TrackSource_DRONE:   make(chan string, 2), // make buffer 2 because we send candidate at least twice.
-		pb.TrackSource_MONITOR: make(chan string, 2), // make buffer 2 because we send candidate at least twice.
-	}
+// negotiation is a peer connection negotiation of a stream on a WebSocket connection.
+// Candidates of the stream from client are routed to it.
+type negotiation struct {
+	eventID    string // Event ID of the offer, it's attached to candidates sent to client.
+	peer       conns.Conn
+	sess       *session.Session
+	w          *webrtcx.WebRTC
+	candidates *webrtcx.CandidateQueue
+	protocol   protocol // Protocol of the connection when offered.
+	subject    string   // Subject of the token of the client, empty if auth is disabled.
+	manual     int32    // Set atomically once client selects a layer, which stops congestion control.
+	// bundle are sessions bundled in the peer connection besides sess, see FeatureBundle.
+	bundle []*session.Session
+}
+
+const (
+	// maxPendingCandidates caps candidates of a stream buffered before its offer.
+	maxPendingCandidates = 16
+	// maxPendingStreams caps streams of a connection with candidates buffered before their offers.
+	maxPendingStreams = 8
+)
+
+// processMessage processes signaling messages of a WebSocket connection.
+// Streams are restricted by claims, nil claims allow all.
+// Each offer starts an independent negotiation keyed by its stream, so a client can watch many streams
+// over a single connection, and an error of a stream doesn't affect others.
+// Client may negotiate the protocol by "hello" event first, otherwise the legacy one is served.
+// iceMode is the ICE mode of offers by default, see offerICEMode.
+func (s *Subscriber) processMessage(ctx context.Context, c *websocket.Conn, tenant string, claims *auth.Claims, iceMode string) {
+	conn, _ := conns.FromContext(ctx)
+	logger := conn.Logger(&s.logger)
+
+	// Negotiations by session key of their streams, a stream is negotiated again if client re-offers.
+	// It's only accessed by this loop, which is also the only sender of candidates.
+	negotiations := make(map[session.Key]*negotiation)
+	// Candidates of streams received before their offers by session key, as clients may trickle them before
+	// an offer is processed. They are replayed once the stream is negotiated, and dropped if its offer fails.
+	pending := make(map[session.Key][]string)
 	defer func() {
-		for _, ch := range candidateChan {
-			close(ch)
+		for _, n := range negotiations {
+			n.candidates.Close()
 		}
 	}()
 
+	proto := legacyProtocol()
+
+	// Sessions subscribed by this connection, client is notified once any of them is closed.
+	var subscribed sync.Map
+	events, stop := s.sessions.Watch()
+	defer stop()
+	go s.notifySessionEvents(ctx, c, events, &subscribed)
+
 	for {
 		var msg incomingMessage
 		if err := wsjson.Read(ctx, c, &msg); err != nil {
 			if websocket.CloseStatus(err) == websocket.StatusGoingAway ||
 				websocket.CloseStatus(err) == websocket.StatusNoStatusRcvd {
-				s.logger.Info().Msg("client closed connection")
+				logger.Info().Msg("client closed connection")
 			} else {
-				s.logger.Err(err).Msg("could not read message")
-				_ = replyErr(ctx, c, msg.ID, nil, httpx.ErrReadMessage)
+				logger.Err(err).Msg("could not read message")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrReadMessage)
 			}
 			return
 		}
 
 		switch msg.Event {
+		case "hello":
+			s.hello(ctx, c, &msg, &proto, len(negotiations) > 0, &logger)
 		case "video-offer":
 			var offer pb.SessionDescription
 			if err := json.Unmarshal(msg.Data, &offer); err != nil {
-				s.logger.Err(err).Msg("could not unmarshal JSON data")
-				_ = replyErr(ctx, c, msg.ID, nil, httpx.ErrUnmarshalJSON)
-				return
+				logger.Err(err).Msg("could not unmarshal JSON data")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrUnmarshalJSON)
+				continue
 			}
 			if offer.Meta == nil || offer.Meta.Id == "" {
-				s.logger.Error().Msg("incorrect metadata")
-				_ = replyErr(ctx, c, msg.ID, nil, httpx.ErrIncorrectMetadata)
-				return
+				logger.Error().Msg("incorrect metadata")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrIncorrectMetadata)
+				continue
+			}
+			peer := conns.Conn{
+				ID:         conns.NewID(),
+				Kind:       conns.KindPeer,
+				Role:       metrics.RoleSubscriber,
+				Parent:     conn.ID,
+				Meta:       offer.Meta,
+				Tenant:     tenant,
+				RemoteAddr: conn.RemoteAddr,
 			}
-			logger := s.logger.With().Str("event_id", msg.ID).Str("id", offer.Meta.Id).Int32("track_source", int32(offer.Meta.TrackSource)).Logger()
+			logger := peer.Logger(&s.logger).With().
+				Str("event_id", msg.ID).
+				Str("id", offer.Meta.Id).
+				Int32("track_source", int32(offer.Meta.TrackSource)).
+				Logger()
+			start := time.Now()
 			logger.Info().Msg("received offer from subscriber")
+			// The span of the offer ends once answered, or by replyErr once rejected.
+			ctx, span := tracing.Default.Start(tracing.WithRemote(ctx, msg.Traceparent), "subscriber.handle_offer", tracing.KindServer)
+			span.SetString("signal.transport", protocolWebSocket)
+			span.SetString("stream.id", offer.Meta.Id)
+			span.SetInt("stream.track_source", int64(offer.Meta.TrackSource))
+			span.SetString("peer.id", peer.ID)
+			span.SetString("tenant", tenant)
+			early := pending[s.sessions.Key(offer.Meta)]
+			delete(pending, s.sessions.Key(offer.Meta))
+
+			if !claims.Allow(offer.Meta) || !s.allowTenant(tenant, offer.Meta) {
+				logger.Warn().Str("subject", claims.Subject).Str("tenant", tenant).Msg("subscriber is not allowed to watch the stream")
+				_ = s.replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrForbidden)
+				continue
+			}
+			if err := s.checkACL(ctx, claims, tenant, offer.Meta, conn.RemoteAddr); err != nil {
+				logger.Warn().Err(err).Msg("subscriber denied by ACL")
+				_ = s.replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrACLDenied)
+				continue
+			}
 
-			sessionID := offer.Meta.Id + strconv.Itoa(int(offer.Meta.TrackSource))
-			value, ok := s.sessions.Load(sessionID)
+			if s.quota.Exceeded(tenant) {
+				logger.Warn().Str("tenant", tenant).Msg("egress quota exceeded, rejected subscriber")
+				_ = s.replyError(ctx, c, msg.ID, offer.Meta, httpx.NewError(httpx.ErrQuotaExceeded, map[string]interface{}{
+					"tenant": tenant,
+				}))
+				continue
+			}
+			if !s.allowViewer(offer.Meta) {
+				logger.Warn().Str("tenant", tenant).Msg("viewers limit of tenant reached, rejected subscriber")
+				_ = s.replyError(ctx, c, msg.ID, offer.Meta, httpx.NewError(httpx.ErrTenantViewerLimit, map[string]interface{}{
+					"tenant": s.sessions.Key(offer.Meta).Scope,
+				}))
+				continue
+			}
+			if err := s.hooks.OnSubscribeRequest(ctx, &hooks.SubscribeRequest{
+				Meta:       offer.Meta,
+				Protocol:   protocolWebSocket,
+				Tenant:     tenant,
+				Subject:    subjectOf(claims),
+				RemoteAddr: conn.RemoteAddr,
+			}); err != nil {
+				logger.Warn().Err(err).Msg("subscriber rejected by hooks")
+				_ = s.replyError(ctx, c, msg.ID, offer.Meta, hookRejected(err))
+				continue
+			}
+
+			sess, ok := s.sessions.Get(s.sessions.Key(offer.Meta))
+			if !ok {
+				sess, ok = s.relay(ctx, offer.Meta, &logger)
+			}
 			if !ok {
+				if s.redirect(ctx, c, msg.ID, offer.Meta) {
+					span.SetBool("redirected", true)
+					span.End()
+					logger.Info().Msg("redirected subscriber to instance hosting the stream")
+					continue
+				}
 				logger.Error().Msg("no machine id or track source found in existing sessions")
-				_ = replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrMetadataNotMatched)
-				return
+				_ = s.replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrMetadataNotMatched)
+				continue
+			}
+			var bundle []*session.Session
+			if metas := bundledMetas(msg.Data, offer.Meta); len(metas) > 0 && proto.has(FeatureBundle) {
+				var code httpx.Code
+				if bundle, code, ok = s.bundle(ctx, claims, tenant, conn.RemoteAddr, metas, &logger); !ok {
+					_ = s.replyErr(ctx, c, msg.ID, offer.Meta, code)
+					continue
+				}
+				span.SetInt("stream.bundled", int64(len(bundle)))
+			}
+
+			var sdp webrtc.SessionDescription
+			if err := json.Unmarshal([]byte(offer.Sdp), &sdp); err != nil {
+				logger.Err(err).Msg("could not unmarshal sdp")
+				_ = s.replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrUnmarshalJSON)
+				continue
 			}
 
-			wcx := webrtcx.New(
-				s.config.WebRTCConfigOptions,
+			for key, old := range negotiations {
+				// Clients without multi-stream watch a stream at a time.
+				if key != sess.Key && proto.has(FeatureMultiStream) {
+					continue
+				}
+				old.candidates.Close()
+				if err := old.w.Close(); err != nil {
+					logger.Err(err).Msg("could not close old peer connection")
+				}
+				delete(negotiations, key)
+				logger.Info().Str("old_event_id", old.eventID).Msg("closed old negotiation")
+			}
+			n := &negotiation{
+				eventID:    msg.ID,
+				peer:       peer,
+				sess:       sess,
+				candidates: webrtcx.NewCandidateQueue(),
+				protocol:   proto,
+				bundle:     bundle,
+			}
+			if claims != nil {
+				n.subject = claims.Subject
+			}
+			config := s.config.WebRTCConfigOptions
+			vanilla := !proto.has(FeatureTrickleICE) || offerICEMode(msg.Data, iceMode) == iceModeVanilla
+			if vanilla {
+				config = vanillaConfig(config)
+			}
+			n.w = webrtcx.New(
+				s.media,
+				config,
 				&logger,
-				sendCandidate(ctx, c, offer.Meta),
-				recvCandidate(candidateChan[offer.Meta.TrackSource]),
+				s.sendCandidate(ctx, c, msg.ID, offer.Meta),
+				recvCandidate(n.candidates),
 				webrtcx.NoopRegisterSessionFunc,
+				webrtcx.NoopUnregisterSessionFunc,
 				s.hookStream(offer.Meta),
 			)
-
-			var sdp webrtc.SessionDescription
-			if err := json.Unmarshal([]byte(offer.Sdp), &sdp); err != nil {
-				s.logger.Err(err).Msg("could not unmarshal sdp")
-				_ = replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrUnmarshalJSON)
-				return
+			if vanilla {
+				n.w.DisableTrickle()
+				logger.Debug().Msg("answering offer by vanilla ICE")
+			} else if proto.has(FeatureEndOfCandidates) {
+				n.w.OnEndOfCandidates(s.sendEndOfCandidates(ctx, c, msg.ID, offer.Meta))
 			}
-			// TODO: handle blocking case with timeout for channels.
-			wcx.SignalChan <- &sdp
-			if err := wcx.CreateSubscriber(value.(*webrtc.TrackLocalStaticRTP)); err != nil {
-				logger.Err(err).Msg("failed to create subscriber")
-				_ = replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrFailedToCreateSubscriber)
-				return
+			if proto.has(FeatureConnectionState) {
+				n.w.OnICEConnectionState(s.sendConnectionState(ctx, c, msg.ID, offer.Meta))
 			}
-			logger.Info().Msg("successfully created subscriber")
-
-			// TODO: Timeout channel receiving to avoid blocking.
-			answer := <-wcx.SignalChan
-			b, err := json.Marshal(answer)
-			if err != nil {
-				s.logger.Err(err).Msg("could not unmarshal answer to JSON")
-				_ = replyErr(ctx, c, msg.ID, offer.Meta, httpx.ErrUnmarshalJSON)
-				return
+			if code, err := s.joinShare(claims, conn.RemoteAddr, n.w); err != nil {
+				logger.Warn().Err(err).Msg("subscriber rejected by sharing link")
+				_ = n.w.Close()
+				_ = s.replyErr(ctx, c, msg.ID, offer.Meta, code)
+				continue
 			}
-			if err := wsjson.Write(ctx, c, &outgoingMessage{
-				Event: "video-answer",
-				Data: &pb.SessionDescription{
-					Meta: offer.Meta,
-					Sdp:  string(b),
-				},
-			}); err != nil {
-				s.logger.Err(err).Msg("could not write answer JSON")
-				return
+			n.w.RelayTelemetry(sess.Telemetry)
+			s.filterCandidates(n.w, offer.Meta)
+			negotiations[sess.Key] = n
+			for _, candidate := range early {
+				if candidate == "" {
+					n.candidates.End()
+					break
+				}
+				n.candidates.Push(candidate)
+			}
+			if len(early) > 0 {
+				logger.Debug().Int("candidates", len(early)).Msg("replayed candidates received before offer")
 			}
-			logger.Info().Msg("sent answer to subscriber")
+			go s.negotiate(conns.NewContext(ctx, peer), c, n, &offer, &sdp, sess, start, tenant, &subscribed, &logger)
 		case "new-ice-candidate":
 			var candidate pb.ICECandidate
 			if err := json.Unmarshal(msg.Data, &candidate); err != nil {
-				s.logger.Err(err).Msg("could not unmarshal JSON data")
-				_ = replyErr(ctx, c, msg.ID, nil, httpx.ErrUnmarshalJSON)
-				return
+				logger.Err(err).Msg("could not unmarshal JSON data")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrUnmarshalJSON)
+				continue
 			}
 			if candidate.Meta == nil || candidate.Meta.Id == "" {
-				s.logger.Error().Msg("incorrect metadata")
-				_ = replyErr(ctx, c, msg.ID, nil, httpx.ErrIncorrectMetadata)
-				return
+				logger.Error().Msg("incorrect metadata")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrIncorrectMetadata)
+				continue
 			}
-			sessionID := candidate.Meta.Id + strconv.Itoa(int(candidate.Meta.TrackSource))
-			_, ok := s.sessions.Load(sessionID)
-			if !ok {
-				s.logger.Error().Msg("no machine id or track source found in existing sessions")
-				_ = replyErr(ctx, c, msg.ID, candidate.Meta, httpx.ErrMetadataNotMatched)
-				return
+			if !claims.Allow(candidate.Meta) {
+				logger.Warn().Str("subject", claims.Subject).Msg("subscriber is not allowed to watch the stream")
+				_ = s.replyErr(ctx, c, msg.ID, candidate.Meta, httpx.ErrForbidden)
+				continue
 			}
-
 			var candidateInit webrtc.ICECandidateInit
 			if err := json.Unmarshal([]byte(candidate.Candidate), &candidateInit); err != nil {
-				s.logger.Err(err).Msg("could not unmarshal JSON candidate")
-				_ = replyErr(ctx, c, msg.ID, candidate.Meta, httpx.ErrUnmarshalJSON)
-				return
+				logger.Err(err).Msg("could not unmarshal JSON candidate")
+				_ = s.replyErr(ctx, c, msg.ID, candidate.Meta, httpx.ErrUnmarshalJSON)
+				continue
 			}
-			if candidate.Meta.TrackSource == pb.TrackSource_DRONE {
-				candidateChan[pb.TrackSource_DRONE] <- candidateInit.Candidate
-			} else {
-				candidateChan[pb.TrackSource_MONITOR] <- candidateInit.Candidate
+			key := s.sessions.Key(candidate.Meta)
+			n, ok := negotiations[key]
+			if !ok {
+				early, buffered := pending[key]
+				if len(early) >= maxPendingCandidates || (!buffered && len(pending) >= maxPendingStreams) {
+					logger.Error().Msg("too many candidates before offer of the stream")
+					_ = s.replyErr(ctx, c, msg.ID, candidate.Meta, httpx.ErrMetadataNotMatched)
+					continue
+				}
+				pending[key] = append(early, candidateInit.Candidate)
+				logger.Debug().Msg("buffered candidate received before offer")
+				continue
+			}
+			// An empty candidate signals end-of-candidates of client.
+			if candidateInit.Candidate == "" {
+				n.candidates.End()
+				logger.Debug().Str("event_id", n.eventID).Msg("received end of candidates")
+				continue
+			}
+			// Candidates are queued until remote description is set, so a slow negotiation never blocks the loop.
+			if !n.candidates.Push(candidateInit.Candidate) {
+				logger.Warn().Str("event_id", n.eventID).Msg("dropped candidate of ended or closed negotiation")
+			}
+		case "select-layer":
+			var layer selectLayer
+			if err := json.Unmarshal(msg.Data, &layer); err != nil {
+				logger.Err(err).Msg("could not unmarshal JSON data")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrUnmarshalJSON)
+				continue
+			}
+			if layer.Meta == nil || layer.Meta.Id == "" {
+				logger.Error().Msg("incorrect metadata")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrIncorrectMetadata)
+				continue
+			}
+			n, ok := negotiations[s.sessions.Key(layer.Meta)]
+			if !ok {
+				logger.Error().Msg("no offer of the stream found in this connection")
+				_ = s.replyErr(ctx, c, msg.ID, layer.Meta, httpx.ErrMetadataNotMatched)
+				continue
+			}
+			s.selectLayer(ctx, c, msg.ID, n, &layer)
+		case "restart-ice", "restart-ice-answer":
+			var desc pb.SessionDescription
+			if err := json.Unmarshal(msg.Data, &desc); err != nil {
+				logger.Err(err).Msg("could not unmarshal JSON data")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrUnmarshalJSON)
+				continue
+			}
+			if desc.Meta == nil || desc.Meta.Id == "" {
+				logger.Error().Msg("incorrect metadata")
+				_ = s.replyErr(ctx, c, msg.ID, nil, httpx.ErrIncorrectMetadata)
+				continue
+			}
+			n, ok := negotiations[s.sessions.Key(desc.Meta)]
+			if !ok {
+				logger.Error().Msg("no offer of the stream found in this connection")
+				_ = s.replyErr(ctx, c, msg.ID, desc.Meta, httpx.ErrMetadataNotMatched)
+				continue
+			}
+			// "restart-ice" may carry a re-offer of client, "restart-ice-answer" always carries an answer.
+			var sdp *webrtc.SessionDescription
+			if desc.Sdp != "" || msg.Event == "restart-ice-answer" {
+				sdp = new(webrtc.SessionDescription)
+				if err := json.Unmarshal([]byte(desc.Sdp), sdp); err != nil {
+					logger.Err(err).Msg("could not unmarshal sdp")
+					_ = s.replyErr(ctx, c, msg.ID, desc.Meta, httpx.ErrUnmarshalJSON)
+					continue
+				}
+			}
+			if msg.Event == "restart-ice-answer" {
+				s.acceptICERestart(ctx, c, msg.ID, n, &desc, sdp)
+				continue
 			}
+			// Candidates of the former credentials are over, ones of the new credentials are queued until
+			// the new remote description is set.
+			n.candidates.Close()
+			n.candidates = webrtcx.NewCandidateQueue()
+			go s.restartICE(ctx, c, msg.ID, n, &desc, sdp, n.candidates)
 		default:
-			s.logger.Warn().Str("event", msg.Event).Msg("unknown event")
+			logger.Warn().Str("event", msg.Event).Msg("unknown event")
+		}
+	}
+}
+
+// selectLayer is the data of "select-layer" event.
+type selectLayer struct {
+	Meta  *pb.Meta `json:"meta"`
+	Layer string   `json:"layer"` // RID of the simulcast layer.
+}
+
+// selectLayer switches video of a negotiated stream to the simulcast layer, and replies "layer-selected" event.
+// A keyframe of the layer is requested at once, so the subscriber needn't wait for the periodic one.
+func (s *Subscriber) selectLayer(ctx context.Context, c *websocket.Conn, id string, n *negotiation, data *selectLayer) {
+	logger := n.peer.Logger(&s.logger).With().Str("event_id", id).Str("id", n.sess.ID).Str("layer", data.Layer).Logger()
+	layer, ok := n.sess.Layers.Get(data.Layer)
+	if !ok {
+		logger.Warn().Msg("simulcast layer not found")
+		_ = s.replyError(ctx, c, id, data.Meta, httpx.NewError(httpx.ErrLayerNotFound, map[string]interface{}{
+			"layer":  data.Layer,
+			"layers": n.sess.Layers.RIDs(),
+		}))
+		return
+	}
+	if err := n.w.ReplaceVideoTrack(layer.Track); err != nil {
+		logger.Err(err).Msg("could not switch simulcast layer")
+		_ = s.replyErr(ctx, c, id, data.Meta, httpx.ErrFailedToSelectLayer)
+		return
+	}
+	atomic.StoreInt32(&n.manual, 1)
+	layer.RequestKeyframe()
+	if err := s.writeJSON(ctx, c, outgoingMessage{
+		Event: "layer-selected",
+		ID:    id,
+		Data:  data,
+	}); err != nil {
+		logger.Err(err).Msg("could not write layer-selected event")
+		return
+	}
+	logger.Info().Msg("switched simulcast layer")
+}
+
+// negotiate creates a subscriber peer of offer to the session, and sends answer to client.
+// start is when the offer is received, it's used to measure join latency.
+func (s *Subscriber) negotiate(
+	ctx context.Context,
+	c *websocket.Conn,
+	n *negotiation,
+	offer *pb.SessionDescription,
+	sdp *webrtc.SessionDescription,
+	sess *session.Session,
+	start time.Time,
+	tenant string,
+	subscribed *sync.Map,
+	logger *zerolog.Logger,
+) {
+	span := tracing.SpanFromContext(ctx)
+	defer span.End()
+	firstMedia := make(chan struct{})
+	n.w.OnFirstMedia(func() { close(firstMedia) })
+	if len(n.bundle) == 0 {
+		n.w.OnKeyframeRequest(sess.RequestKeyframe)
+		if sess.VideoCache != nil {
+			n.w.Retransmit(sess.PacketCache)
+		}
+		if len(sess.Layers.RIDs()) > 1 {
+			n.w.RewriteLayers()
+		}
+	} else {
+		// A request goes to the session of its track. Caches of sessions are per stream while the retransmitter
+		// answers by the one of the first video, so NACKs of a bundle are answered by the default NACK responder.
+		n.w.OnKeyframeRequest(func(track webrtc.TrackLocal) {
+			sess.RequestKeyframe(track)
+			for _, b := range n.bundle {
+				b.RequestKeyframe(track)
+			}
+		})
+		for _, b := range n.bundle {
+			n.w.BundleTracks(b.VideoTrack, b.AudioTrack)
+		}
+	}
+	if sess.LowLatency {
+		n.w.DelayPlayout()
+	}
+	metrics.JoinsPending.Inc()
+	signalCtx, createSpan := tracing.Default.Start(ctx, "subscriber.create_subscriber", tracing.KindInternal)
+	signalCtx, cancel := webrtcx.SignalContext(signalCtx, s.config.WebRTCConfigOptions)
+	answerSDP, err := n.w.CreateSubscriber(signalCtx, sdp, sess.VideoTrack, sess.AudioTrack)
+	cancel()
+	createSpan.SetError(err)
+	createSpan.End()
+	if err != nil {
+		logger.Err(err).Msg("failed to create subscriber")
+		s.joinFailed()
+		_ = s.replyErr(ctx, c, n.eventID, offer.Meta, httpx.ErrFailedToCreateSubscriber)
+		return
+	}
+	s.peers.Add(n.w)
+	conns.Default.Register(n.peer, n.w.Done())
+	go s.trackJoin(start, n.w, firstMedia, logger)
+	logger.Info().Msg("successfully created subscriber")
+
+	b, err := json.Marshal(answerSDP)
+	if err != nil {
+		logger.Err(err).Msg("could not unmarshal answer to JSON")
+		_ = s.replyErr(ctx, c, n.eventID, offer.Meta, httpx.ErrUnmarshalJSON)
+		return
+	}
+	var bundle []bundled
+	for _, b := range n.bundle {
+		bundle = append(bundle, bundled{
+			Meta:       b.Meta,
+			StreamID:   b.VideoTrack.StreamID(),
+			Codec:      b.VideoTrack.Codec().MimeType,
+			AudioCodec: b.AudioTrack.Codec().MimeType,
+		})
+	}
+	if err := s.writeJSON(ctx, c, &outgoingMessage{
+		Event:       "video-answer",
+		ID:          n.eventID,
+		Traceparent: span.Traceparent(),
+		Data: &answer{
+			SessionDescription: &pb.SessionDescription{
+				Meta: offer.Meta,
+				Sdp:  string(b),
+			},
+			Session: snapshot{
+				ID:         sess.ID,
+				Codec:      sess.VideoTrack.Codec().MimeType,
+				AudioCodec: sess.AudioTrack.Codec().MimeType,
+				Bitrate:    sess.Bitrate.Bitrate(),
+				Region:     s.config.Region,
+				Layers:     sess.Layers.RIDs(),
+				StreamID:   sess.VideoTrack.StreamID(),
+				Bundle:     bundle,
+			},
+		},
+	}); err != nil {
+		span.SetError(err)
+		logger.Err(err).Msg("could not write answer JSON")
+		return
+	}
+	span.End()
+	logger.Info().Msg("sent answer to subscriber")
+	go s.limit(n.w, func(reason limitReason) {
+		if reason == limitICEConnectTimeout {
+			_ = s.replyError(ctx, c, n.eventID, offer.Meta, httpx.NewError(httpx.ErrICEConnectTimeout, map[string]interface{}{
+				"timeout": s.config.ICEConnectTimeout.Seconds(),
+			}))
+			return
+		}
+		type data struct {
+			Meta        *pb.Meta `json:"meta"`
+			MaxDuration float64  `json:"max_duration"` // In seconds.
+		}
+		if err := s.writeJSON(ctx, c, outgoingMessage{
+			Event: "session-expired",
+			ID:    n.eventID,
+			Data:  data{Meta: offer.Meta, MaxDuration: s.config.MaxSubscriberDuration.Seconds()},
+		}); err != nil {
+			logger.Err(err).Msg("could not write session-expired event")
+		}
+	}, logger)
+	s.watchViewer(n.w, viewer{
+		ID:         n.peer.ID,
+		Meta:       offer.Meta,
+		Tenant:     tenant,
+		Subject:    n.subject,
+		RemoteAddr: n.peer.RemoteAddr,
+		Protocol:   protocolWebSocket,
+		Since:      start,
+	})
+	if n.protocol.has(FeatureStatsEvents) {
+		go s.sendStats(ctx, c, n.w, n.eventID, offer.Meta)
+	}
+	go s.controlCongestion(n.w, sess, &n.manual, func(l layerSwitch) {
+		type data struct {
+			Meta *pb.Meta `json:"meta"`
+			layerSwitch
+		}
+		if err := s.writeJSON(ctx, c, outgoingMessage{
+			Event: "layer-selected",
+			ID:    n.eventID,
+			Data:  data{Meta: offer.Meta, layerSwitch: l},
+		}); err != nil {
+			logger.Err(err).Msg("could not write layer-selected event")
+		}
+	}, logger)
+	watched := append([]*session.Session{sess}, n.bundle...)
+	for _, sess := range watched {
+		subscribed.Store(sess, struct{}{})
+		// Tell a new viewer at once if the stream is already degraded.
+		if degraded, reasons := sess.Quality.Degraded(); degraded {
+			s.notify(ctx, c, "quality-degraded", sess, reasons)
+		}
+	}
+
+	// The peer connection outlives the signaling WebSocket connection, so the viewer leaves and its egress is
+	// accounted until it's closed, e.g. replaced by a new negotiation of the stream.
+	accountCtx, stop := context.WithCancel(context.Background())
+	for _, sess := range watched {
+		sess.Join()
+		go s.accountEgress(accountCtx, tenant, n.subject, sess, n.w)
+	}
+	go func() {
+		<-n.w.Done()
+		stop()
+		for _, sess := range watched {
+			sess.Leave()
+		}
+	}()
+}
+
+// Close stops MQTT signaling, closes all signaling WebSocket connections and subscriber peer connections,
+// it returns after peer connections are closed or ctx is done.
+// Caller should stop accepting new connections first.
+func (s *Subscriber) Close(ctx context.Context) error {
+	if err := s.unsubscribe(ctx); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	s.conns.Range(func(key, _ interface{}) bool {
+		wg.Add(1)
+		go func(c *websocket.Conn) {
+			defer wg.Done()
+			_ = c.Close(websocket.StatusGoingAway, "server is shutting down")
+		}(key.(*websocket.Conn))
+		return true
+	})
+	closed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		s.logger.Info().Msg("closed signaling WebSocket connections")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := s.peers.Close(ctx); err != nil {
+		return fmt.Errorf("could not close subscriber peer connections: %w", err)
+	}
+	s.logger.Info().Msg("closed subscriber peer connections")
+	return nil
+}
+
+// notifySessionEvents sends events of subscribed sessions to WebSocket client:
+//   - "stream-ended" when a session is closed, so web clients know the stream ended instead of showing a frozen frame.
+//   - "publisher-restarted" when a session is replaced after edge re-offered, so clients can renegotiate
+//     with a new offer to bind to the new tracks.
+//   - "quality-degraded" with reasons and "quality-recovered" when ingest quality of a session changes,
+//     so players can tell viewers the drone uplink is poor rather than their own network.
+//
+// It returns after events channel is closed.
+func (s *Subscriber) notifySessionEvents(
+	ctx context.Context,
+	c *websocket.Conn,
+	events <-chan session.Event,
+	subscribed *sync.Map,
+) {
+	for event := range events {
+		switch event.Type {
+		case session.EventClosed:
+			if _, ok := subscribed.LoadAndDelete(event.Session); ok {
+				s.notify(ctx, c, "stream-ended", event.Session, nil)
+			}
+		case session.EventReplaced:
+			if _, ok := subscribed.LoadAndDelete(event.Replaced); ok {
+				s.notify(ctx, c, "publisher-restarted", event.Replaced, nil)
+			}
+		case session.EventDegraded:
+			if _, ok := subscribed.Load(event.Session); ok {
+				s.notify(ctx, c, "quality-degraded", event.Session, event.Reasons)
+			}
+		case session.EventRecovered:
+			if _, ok := subscribed.Load(event.Session); ok {
+				s.notify(ctx, c, "quality-recovered", event.Session, nil)
+			}
+		default:
+		}
+	}
+}
+
+// notify sends an event of a session to WebSocket client, with reasons if any.
+func (s *Subscriber) notify(ctx context.Context, c *websocket.Conn, name string, sess *session.Session, reasons []string) {
+	type data struct {
+		Meta    *pb.Meta `json:"meta"`
+		Reasons []string `json:"reasons,omitempty"`
+	}
+	conn, _ := conns.FromContext(ctx)
+	logger := conn.Logger(&s.logger)
+	if err := s.writeJSON(ctx, c, outgoingMessage{
+		Event: name,
+		Data:  data{Meta: sess.Meta, Reasons: reasons},
+	}); err != nil {
+		logger.Err(err).Str("id", sess.ID).Msgf("could not write %s event", name)
+		return
+	}
+	logger.Info().Str("id", sess.ID).Msgf("sent %s event to subscriber", name)
+}
+
+// accountEgress accounts egress of tracks of sess sent by the subscriber peer connection w of a viewer to tenant,
+// and to subject of its token for billing, periodically until ctx is done or the session is gone. Egress is bytes
+// sent to the viewer, which differ from bytes the session receives from edge by simulcast layers, packets skipped
+// for slow viewers and retransmissions.
+func (s *Subscriber) accountEgress(ctx context.Context, tenant, subject string, sess *session.Session, w *webrtcx.WebRTC) {
+	interval := s.config.AccountInterval
+	if interval <= 0 {
+		interval = defaultAccountInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last uint64
+	account := func() {
+		total := w.BytesSent(sess.VideoTrack, sess.AudioTrack)
+		s.quota.Add(tenant, total-last)
+		s.accountant.Add(accounting.Key{
+			Tenant:      tenant,
+			ID:          sess.Meta.Id,
+			TrackSource: sess.Meta.TrackSource,
+			Subject:     subject,
+		}, total-last)
+		last = total
+	}
+	defer account()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			account()
+			if current, ok := s.sessions.Get(sess.Key); !ok || current != sess {
+				return
+			}
 		}
 	}
 }
@@ -225,8 +994,8 @@ func (s *Subscriber) processMessage(ctx context.Context, c *websocket.Conn) {
 // hookStream only signal to drone and deport track source.
 func (s *Subscriber) hookStream(meta *pb.Meta) webrtcx.HookStreamFunc {
 	return func(iceConnectionStat webrtc.ICEConnectionState) {
-		topic := s.config.HookStreamTopicPrefix + "/" + meta.Id + "/" + strconv.Itoa(int(meta.TrackSource))
-		t := s.client.Publish(topic, byte(s.config.Qos), s.config.Retained, strconv.Itoa(int(iceConnectionStat)))
+		topic := s.edgeTopic(s.config.HookStreamTopicPrefix, meta)
+		t := s.mqttClient().Publish(topic, byte(s.config.Qos), s.config.Retained, strconv.Itoa(int(iceConnectionStat)))
 		// Handle the token in a go routine so this loop keeps sending messages regardless of delivery status
 		go func() {
 			<-t.Done()
@@ -241,15 +1010,22 @@ func (s *Subscriber) hookStream(meta *pb.Meta) webrtcx.HookStreamFunc {
 
 // sendCandidate sends an ice candidate through webSocket.
 // It can be called multiple time to send multiple ice candidates.
-func sendCandidate(ctx context.Context, c *websocket.Conn, meta *pb.Meta) webrtcx.SendCandidateFunc {
+// Candidates carry event ID of the offer, so client can tell negotiations of the same stream apart.
+func (s *Subscriber) sendCandidate(
+	ctx context.Context,
+	c *websocket.Conn,
+	id string,
+	meta *pb.Meta,
+) webrtcx.SendCandidateFunc {
 	return func(candidate *webrtc.ICECandidate) error {
 		// See: https://github.com/pion/example-webrtc-applications/blob/166d375aa9f8725e968758747e0d5bcf66d5b8dc/sfu-ws/main.go#L269-L269
 		candidateJSON, err := json.Marshal(candidate.ToJSON())
 		if err != nil {
 			return err
 		}
-		return wsjson.Write(ctx, c, outgoingMessage{
+		return s.writeJSON(ctx, c, outgoingMessage{
 			Event: "new-ice-candidate",
+			ID:    id,
 			Data: &pb.ICECandidate{
 				Meta:      meta,
 				Candidate: string(candidateJSON),
@@ -258,28 +1034,73 @@ func sendCandidate(ctx context.Context, c *websocket.Conn, meta *pb.Meta) webrtc
 	}
 }
 
-// recvCandidate sends an ice candidate through webSocket.
-// It continually reads from established webSocket connection getting ice candidates.
-func recvCandidate(candidateChan <-chan string) webrtcx.RecvCandidateFunc {
-	return func() <-chan string {
-		return candidateChan
+// sendEndOfCandidates tells client all candidates of server are sent, by a candidate with empty
+// candidate-attribute as browsers' RTCPeerConnection.addIceCandidate takes.
+func (s *Subscriber) sendEndOfCandidates(ctx context.Context, c *websocket.Conn, id string, meta *pb.Meta) func() {
+	return func() {
+		candidateJSON, err := json.Marshal(webrtc.ICECandidateInit{})
+		if err != nil {
+			return
+		}
+		if err := s.writeJSON(ctx, c, outgoingMessage{
+			Event: "new-ice-candidate",
+			ID:    id,
+			Data: &pb.ICECandidate{
+				Meta:      meta,
+				Candidate: string(candidateJSON),
+			},
+		}); err != nil {
+			s.logger.Err(err).Str("event_id", id).Msg("could not send end of candidates")
+		}
+	}
+}
+
+// recvCandidate returns candidates queued from client of a negotiation.
+func recvCandidate(candidates *webrtcx.CandidateQueue) webrtcx.RecvCandidateFunc {
+	return func() *webrtcx.CandidateQueue {
+		return candidates
 	}
 }
 
-// replyErr is an uniform error event reply to WebSocket client.
-func replyErr(ctx context.Context, c *websocket.Conn, id string, meta *pb.Meta, code httpx.Code) error {
+// replyErr is an uniform error event reply to WebSocket client, carrying IDs of the connection in ctx.
+func (s *Subscriber) replyErr(ctx context.Context, c *websocket.Conn, id string, meta *pb.Meta, code httpx.Code) error {
+	return s.replyError(ctx, c, id, meta, httpx.NewError(code, nil))
+}
+
+// replyError is replyErr of an error with details.
+func (s *Subscriber) replyError(ctx context.Context, c *websocket.Conn, id string, meta *pb.Meta, e *httpx.Error) error {
 	type data struct {
-		Meta *pb.Meta   `json:"meta,omitempty"`
-		Code httpx.Code `json:"code"`
-		Msg  string     `json:"message"`
+		Meta *pb.Meta `json:"meta,omitempty"`
+		*httpx.Error
+		ConnID string `json:"conn_id,omitempty"`
+		PeerID string `json:"peer_id,omitempty"`
 	}
-	return wsjson.Write(ctx, c, outgoingMessage{
+	metrics.SignalingFailures.WithLabelValues(metrics.RoleSubscriber, strconv.Itoa(int(e.Code))).Inc()
+	// An error ends the span of signaling of ctx if any, e.g. of an offer rejected.
+	span := tracing.SpanFromContext(ctx)
+	span.SetError(errors.New(e.Message))
+	span.SetInt("error.code", int64(e.Code))
+	span.End()
+	conn, _ := conns.FromContext(ctx)
+	connID, peerID := conn.IDs()
+	return s.writeJSON(ctx, c, outgoingMessage{
 		Event: "error",
 		ID:    id,
 		Data: data{
-			Meta: meta,
-			Code: code,
-			Msg:  httpx.Errors[code],
+			Meta:   meta,
+			Error:  e,
+			ConnID: connID,
+			PeerID: peerID,
 		},
 	})
 }
+
+// writeJSON writes v as JSON message in WSWriteTimeout, so a stalled client can't block signaling forever.
+func (s *Subscriber) writeJSON(ctx context.Context, c *websocket.Conn, v interface{}) error {
+	if s.config.WSWriteTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.WSWriteTimeout)
+		defer cancel()
+	}
+	return wsjson.Write(ctx, c, v)
+}
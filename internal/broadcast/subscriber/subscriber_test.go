@@ -0,0 +1,258 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+	"github.com/SB-IM/skywalker/testsupport"
+)
+
+// signalTimeout is the max time of subscriber signaling in tests.
+const signalTimeout = 10 * time.Second
+
+// testSubscriber is a subscriber serving signaling in process, with peers on a virtual network.
+type testSubscriber struct {
+	*Subscriber
+	peers    *testsupport.PeerFactory
+	sessions *session.SessionManager
+}
+
+func newTestSubscriber(t *testing.T, config *cfg.SubscriberConfigOptions) *testSubscriber {
+	t.Helper()
+	peers, err := testsupport.NewPeerFactory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.Nop()
+	config.SignalTimeout = signalTimeout
+	client := testsupport.NewBroker().NewClient()
+	sessions := session.NewSessionManager(0, &logger)
+	s := New(client, sessions, webrtcx.NewMediaOf(peers, config.WebRTCConfigOptions), &logger, config)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Close(ctx); err != nil {
+			t.Error(err)
+		}
+		client.Disconnect(0)
+		sessions.Close()
+		if err := peers.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return &testSubscriber{Subscriber: s, peers: peers, sessions: sessions}
+}
+
+// publish adds a session of meta as publisher does once an edge is signaled.
+func (s *testSubscriber) publish(t *testing.T, meta *pb.Meta) *session.Session {
+	t.Helper()
+	videoTrack, audioTrack, err := webrtcx.CreateLocalTrack(webrtcx.DefaultCodecs())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := session.New(s.sessions.Key(meta), meta, videoTrack, audioTrack)
+	s.sessions.Add(sess)
+	return sess
+}
+
+// subscribe offers to watch the stream of meta as a viewer over a signaling connection of path. It returns a
+// channel receiving once video arrives at the viewer, a channel of the error ending signaling and the client.
+func (s *testSubscriber) subscribe(
+	t *testing.T,
+	path string,
+	meta *pb.Meta,
+) (<-chan struct{}, <-chan error, *testsupport.SignalClient) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), signalTimeout)
+	t.Cleanup(cancel)
+
+	peerConnection, err := s.peers.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = peerConnection.Close() })
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := peerConnection.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	received := make(chan struct{}, 1)
+	peerConnection.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		for {
+			if _, _, err := track.ReadRTP(); err != nil {
+				return
+			}
+			if track.Kind() == webrtc.RTPCodecTypeVideo {
+				select {
+				case received <- struct{}{}:
+				default:
+				}
+			}
+		}
+	})
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-gatherComplete:
+	case <-ctx.Done():
+		t.Fatal("timed out gathering candidates")
+	}
+
+	client, err := testsupport.NewSignalClient(ctx, s.Signal(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	if err := client.Offer(ctx, meta, peerConnection); err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Signal(ctx, peerConnection, nil)
+	}()
+	return received, errc, client
+}
+
+// forward forwards video frames to sess until one arrives at the viewer by received. Signaling must not end
+// by errc meanwhile unless it's nil.
+func forward(t *testing.T, sess *session.Session, received <-chan struct{}, errc <-chan error) {
+	t.Helper()
+	// Frames are forwarded repeatedly, as media may flow a moment after ICE connects.
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(signalTimeout)
+	packet := &rtp.Packet{Header: rtp.Header{Version: 2, Marker: true, SSRC: 1, PayloadType: 96}, Payload: []byte{0x65, 1, 2, 3}}
+	for {
+		select {
+		case <-received:
+			return
+		case err := <-errc:
+			t.Fatalf("signaling ended before RTP arrived: %v", err)
+		case <-ticker.C:
+			b, err := packet.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := sess.VideoTrack.Forward(b); err != nil {
+				t.Fatal(err)
+			}
+			packet.SequenceNumber++
+			packet.Timestamp += 3000
+		case <-timeout:
+			t.Fatal("timed out waiting for RTP at the viewer")
+		}
+	}
+}
+
+// waitFor polls until cond is true, and fails the test with msg if it isn't in signalTimeout.
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(signalTimeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// errCode returns the code of the signaling error received from errc.
+func errCode(t *testing.T, errc <-chan error) httpx.Code {
+	t.Helper()
+	var err error
+	select {
+	case err = <-errc:
+	case <-time.After(signalTimeout):
+		t.Fatal("timed out waiting for signaling error")
+	}
+	var e *httpx.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Signal() error = %v, want *httpx.Error", err)
+	}
+	return e.Code
+}
+
+func TestSubscriberSignal(t *testing.T) {
+	s := newTestSubscriber(t, &cfg.SubscriberConfigOptions{})
+	meta := &pb.Meta{Id: "drone", TrackSource: pb.TrackSource_DRONE}
+	sess := s.publish(t, meta)
+	received, errc, _ := s.subscribe(t, "/v1/broadcast/signal", meta)
+	forward(t, sess, received, errc)
+}
+
+func TestSubscriberSignalClosedWebSocket(t *testing.T) {
+	s := newTestSubscriber(t, &cfg.SubscriberConfigOptions{})
+	meta := &pb.Meta{Id: "drone", TrackSource: pb.TrackSource_DRONE}
+	sess := s.publish(t, meta)
+	received, errc, client := s.subscribe(t, "/v1/broadcast/signal", meta)
+	forward(t, sess, received, errc)
+
+	_ = client.Close()
+	waitFor(t, func() bool {
+		n := 0
+		s.conns.Range(func(_, _ interface{}) bool {
+			n++
+			return true
+		})
+		return n == 0
+	}, "timed out waiting for the signaling connection to close")
+
+	// The peer connection outlives signaling, so the viewer keeps watching and counting toward limits.
+	forward(t, sess, received, nil)
+	if viewers := sess.Viewers(); viewers != 1 {
+		t.Fatalf("viewers after signaling closed = %d, want 1", viewers)
+	}
+
+	// The viewer leaves once its peer connection is closed.
+	ctx, cancel := context.WithTimeout(context.Background(), signalTimeout)
+	defer cancel()
+	if err := s.Subscriber.peers.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return sess.Viewers() == 0 }, "viewer doesn't leave after its peer connection closed")
+}
+
+func TestSubscriberSignalNoSession(t *testing.T) {
+	s := newTestSubscriber(t, &cfg.SubscriberConfigOptions{})
+	_, errc, _ := s.subscribe(t, "/v1/broadcast/signal", &pb.Meta{Id: "drone", TrackSource: pb.TrackSource_DRONE})
+	if code := errCode(t, errc); code != httpx.ErrMetadataNotMatched {
+		t.Fatalf("signaling error code = %v, want %v", code, httpx.ErrMetadataNotMatched)
+	}
+}
+
+func TestSubscriberSignalForbidden(t *testing.T) {
+	authConfig := cfg.AuthConfigOptions{SigningKey: "key"}
+	s := newTestSubscriber(t, &cfg.SubscriberConfigOptions{AuthConfigOptions: authConfig})
+	meta := &pb.Meta{Id: "drone", TrackSource: pb.TrackSource_DRONE}
+	s.publish(t, meta)
+
+	token, err := auth.New(authConfig).Sign(&auth.Claims{Subject: "viewer", Streams: []auth.Stream{{ID: "other"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errc, _ := s.subscribe(t, "/v1/broadcast/signal?token="+token, meta)
+	if code := errCode(t, errc); code != httpx.ErrForbidden {
+		t.Fatalf("signaling error code = %v, want %v", code, httpx.ErrForbidden)
+	}
+}
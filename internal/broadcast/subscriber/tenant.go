@@ -0,0 +1,52 @@
+package subscriber
+
+import (
+	"errors"
+	"strconv"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/auth"
+	"github.com/SB-IM/skywalker/internal/broadcast/tenant"
+)
+
+// SetTenants enables multi-tenancy, subscribers then only watch and discover streams of their own tenant,
+// and viewers of tenants are limited by t. It must be called before serving signaling.
+func (s *Subscriber) SetTenants(t *tenant.Tenants) {
+	s.tenants = t
+}
+
+// errNoTenant is returned by authenticate if multi-tenant and the token of a request carries no tenant.
+var errNoTenant = errors.New("token has no tenant claim")
+
+// requestTenant returns the tenant of a signaling request by its claims, defaultTenant if they carry none. It's
+// never taken from the request itself, e.g. its query, as that could be forged to watch or bill another tenant.
+func requestTenant(claims *auth.Claims) string {
+	if claims != nil && claims.Tenant != "" {
+		return claims.Tenant
+	}
+	return defaultTenant
+}
+
+// allowTenant reports whether subscribers of t may watch the stream of meta, streams of other tenants
+// are not allowed if multi-tenant.
+func (s *Subscriber) allowTenant(t string, meta *pb.Meta) bool {
+	if s.tenants == nil {
+		return true
+	}
+	owner, _ := tenant.Split(meta.Id)
+	return owner == t
+}
+
+// allowViewer reports whether another viewer may watch the stream of meta within the viewers limit of its tenant.
+func (s *Subscriber) allowViewer(meta *pb.Meta) bool {
+	return s.tenants == nil || s.tenants.AllowViewer(s.sessions.Key(meta).Scope)
+}
+
+// edgeTopic returns the MQTT topic of prefix of the edge track source of meta, prefixed by its tenant if multi-tenant.
+func (s *Subscriber) edgeTopic(prefix string, meta *pb.Meta) string {
+	if s.tenants != nil {
+		return tenant.Topic(prefix, meta)
+	}
+	return prefix + "/" + meta.Id + "/" + strconv.Itoa(int(meta.TrackSource))
+}
@@ -0,0 +1,48 @@
+package subscriber
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/thumbnail"
+)
+
+// SetThumbnails sets thumbnails of live streams served to dashboards. It must be called before Signal.
+func (s *Subscriber) SetThumbnails(t *thumbnail.Thumbnailer) {
+	s.thumbnails = t
+}
+
+// handleThumbnail serves the latest JPEG thumbnail of a live stream, to clients allowed to watch it.
+func (s *Subscriber) handleThumbnail() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, err := s.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		sess, ok := s.streamSession(w, r)
+		if !ok {
+			return
+		}
+		if !claims.Allow(sess.Meta) {
+			http.Error(w, "stream not allowed", http.StatusForbidden)
+			return
+		}
+		t, ok := s.thumbnails.Get(sess.Key)
+		if !ok {
+			// The first thumbnail is taken in an interval after the stream starts.
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "thumbnail not taken yet", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", strconv.Itoa(len(t.JPEG)))
+		w.Header().Set("Last-Modified", t.At.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "no-cache")
+		if _, err := w.Write(t.JPEG); err != nil {
+			s.logger.Debug().Err(err).Time("taken_at", t.At).Dur("age", time.Since(t.At)).Msg("could not write thumbnail")
+		}
+	}
+}
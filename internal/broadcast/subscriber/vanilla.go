@@ -0,0 +1,33 @@
+package subscriber
+
+import (
+	"encoding/json"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// iceModeVanilla answers offers by vanilla ICE, for clients which can't trickle ICE, e.g. embedded players.
+// The answer carries all candidates of server gathered in VanillaICETimeout, and none is trickled.
+const iceModeVanilla = "vanilla"
+
+// offerOptions are options of an offer in data of "video-offer" event, beside its session description.
+type offerOptions struct {
+	ICEMode string `json:"ice_mode"` // "vanilla" or "trickle", empty means the one of signaling URL.
+}
+
+// offerICEMode returns the ICE mode of an offer of data, by "ice_mode" of it, or by "ice" query of signaling URL,
+// iceMode, if not set. Clients without trickle ICE negotiated by "hello" are answered by vanilla ICE regardless.
+func offerICEMode(data json.RawMessage, iceMode string) string {
+	var options offerOptions
+	if err := json.Unmarshal(data, &options); err == nil && options.ICEMode != "" {
+		return options.ICEMode
+	}
+	return iceMode
+}
+
+// vanillaConfig adapts config of subscriber peer connections to vanilla ICE.
+func vanillaConfig(config cfg.WebRTCConfigOptions) cfg.WebRTCConfigOptions {
+	config.WaitICEGathering = true
+	config.ICEGatheringTimeout = config.VanillaICETimeout
+	return config
+}
@@ -0,0 +1,328 @@
+package subscriber
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/gorilla/mux"
+	"github.com/pion/randutil"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/conns"
+	"github.com/SB-IM/skywalker/internal/broadcast/hooks"
+	"github.com/SB-IM/skywalker/internal/broadcast/httpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+const (
+	whepPath = "/v1/broadcast/whep"
+	// maxSDPSize limits SDP offers and trickled fragments of WHEP subscribers.
+	maxSDPSize = 64 << 10
+
+	sdpContentType       = "application/sdp"
+	sdpFragContentType   = "application/trickle-ice-sdpfrag"
+	whepResourceIDLength = 16
+	whepResourceIDRunes  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// whepPeer is a subscriber peer connection of a WHEP resource.
+type whepPeer struct {
+	meta       *pb.Meta
+	w          *webrtcx.WebRTC
+	candidates *webrtcx.CandidateQueue
+}
+
+// trickle sends candidates to the peer connection, followed by end-of-candidates if ended.
+// They're dropped once it's closed.
+func (p *whepPeer) trickle(candidates []string, ended bool) {
+	for _, c := range candidates {
+		p.candidates.Push(c)
+	}
+	if ended {
+		p.candidates.End()
+	}
+}
+
+func (p *whepPeer) close() {
+	p.candidates.Close()
+}
+
+// handleWHEP handles the WebRTC-HTTP Egress Protocol (WHEP), so standard players and CDN edges subscribe
+// with plain HTTP, see https://datatracker.ietf.org/doc/draft-murillo-whep/
+// The answer carries candidates gathered in ICEGatheringTimeout, and candidates of the player are trickled
+// by PATCH of the resource. Players are authenticated by "Authorization: Bearer" header as WebSocket ones.
+func (s *Subscriber) handleWHEP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		// Every reply carries the peer connection ID, so failures can be correlated with logs.
+		conn := conns.Conn{ID: conns.NewID(), Kind: conns.KindPeer, Role: metrics.RoleSubscriber, RemoteAddr: r.RemoteAddr}
+		w.Header().Set(conns.Header, conn.ID)
+		meta, ok := whepMeta(w, r)
+		if !ok {
+			return
+		}
+		claims, err := s.authenticate(r)
+		if err != nil {
+			s.logger.Warn().Err(err).Str("remote_addr", r.RemoteAddr).Msg("unauthorized WHEP subscriber")
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		tenant := requestTenant(claims)
+		if !claims.Allow(meta) || !s.allowTenant(tenant, meta) {
+			whepFailed(w, httpx.ErrForbidden, http.StatusForbidden)
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != sdpContentType {
+			http.Error(w, "offer must be "+sdpContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+
+		conn.Meta, conn.Tenant = meta, tenant
+		logger := conn.Logger(&s.logger).With().
+			Str("id", meta.Id).
+			Int32("track_source", int32(meta.TrackSource)).
+			Str("remote_addr", r.RemoteAddr).
+			Logger()
+		logger.Info().Msg("received offer from WHEP subscriber")
+
+		if err := s.checkACL(r.Context(), claims, tenant, meta, r.RemoteAddr); err != nil {
+			logger.Warn().Err(err).Msg("WHEP subscriber denied by ACL")
+			whepFailed(w, httpx.ErrACLDenied, http.StatusForbidden)
+			return
+		}
+		if s.quota.Exceeded(tenant) {
+			logger.Warn().Str("tenant", tenant).Msg("egress quota exceeded, rejected WHEP subscriber")
+			whepFailed(w, httpx.ErrQuotaExceeded, http.StatusTooManyRequests)
+			return
+		}
+		if !s.allowViewer(meta) {
+			logger.Warn().Str("tenant", tenant).Msg("viewers limit of tenant reached, rejected WHEP subscriber")
+			whepFailed(w, httpx.ErrTenantViewerLimit, http.StatusTooManyRequests)
+			return
+		}
+		if err := s.hooks.OnSubscribeRequest(r.Context(), &hooks.SubscribeRequest{
+			Meta:       meta,
+			Protocol:   protocolWHEP,
+			Tenant:     tenant,
+			Subject:    subjectOf(claims),
+			RemoteAddr: r.RemoteAddr,
+		}); err != nil {
+			logger.Warn().Err(err).Msg("WHEP subscriber rejected by hooks")
+			whepError(w, hookRejected(err), http.StatusForbidden)
+			return
+		}
+		sess, ok := s.sessions.Get(s.sessions.Key(meta))
+		if !ok {
+			sess, ok = s.relay(r.Context(), meta, &logger)
+		}
+		if !ok {
+			if s.directory != nil && s.cluster == nil {
+				if entry, ok := s.directory.Remote(r.Context(), s.sessions.Key(meta)); ok {
+					// 307 keeps method and body of the offer.
+					metrics.DirectoryRedirects.Inc()
+					http.Redirect(w, r, entry.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+					return
+				}
+			}
+			whepFailed(w, httpx.ErrMetadataNotMatched, http.StatusNotFound)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSDPSize))
+		if err != nil {
+			http.Error(w, "could not read offer", http.StatusBadRequest)
+			return
+		}
+		resource, err := randutil.GenerateCryptoRandomString(whepResourceIDLength, whepResourceIDRunes)
+		if err != nil {
+			logger.Err(err).Msg("could not generate WHEP resource ID")
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+
+		// Candidates can't be trickled to players, they must be carried by the answer.
+		config := s.config.WebRTCConfigOptions
+		config.WaitICEGathering = true
+		peer := &whepPeer{meta: meta, candidates: webrtcx.NewCandidateQueue()}
+		peer.w = webrtcx.New(
+			s.media,
+			config,
+			&logger,
+			webrtcx.NoopSendCandidateFunc,
+			recvCandidate(peer.candidates),
+			webrtcx.NoopRegisterSessionFunc,
+			webrtcx.NoopUnregisterSessionFunc,
+			s.hookStream(meta),
+		)
+		if code, err := s.joinShare(claims, r.RemoteAddr, peer.w); err != nil {
+			logger.Warn().Err(err).Msg("WHEP subscriber rejected by sharing link")
+			_ = peer.w.Close()
+			peer.close()
+			whepFailed(w, code, http.StatusForbidden)
+			return
+		}
+		peer.w.RelayTelemetry(sess.Telemetry)
+		s.filterCandidates(peer.w, meta)
+		firstMedia := make(chan struct{})
+		peer.w.OnFirstMedia(func() { close(firstMedia) })
+		peer.w.OnKeyframeRequest(sess.RequestKeyframe)
+		if sess.VideoCache != nil {
+			peer.w.Retransmit(sess.PacketCache)
+		}
+		if len(sess.Layers.RIDs()) > 1 {
+			peer.w.RewriteLayers()
+		}
+		if sess.LowLatency {
+			peer.w.DelayPlayout()
+		}
+		metrics.JoinsPending.Inc()
+
+		signalCtx, cancel := webrtcx.SignalContext(r.Context(), config)
+		defer cancel()
+		offer := &webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(body)}
+		answer, err := peer.w.CreateSubscriber(signalCtx, offer, sess.VideoTrack, sess.AudioTrack)
+		if err != nil {
+			logger.Err(err).Msg("failed to create WHEP subscriber")
+			peer.close()
+			s.joinFailed()
+			if errors.Is(err, webrtcx.ErrSignalTimeout) {
+				whepFailed(w, httpx.ErrFailedToCreateSubscriber, http.StatusServiceUnavailable)
+			} else {
+				whepFailed(w, httpx.ErrFailedToCreateSubscriber, http.StatusBadRequest)
+			}
+			return
+		}
+		s.peers.Add(peer.w)
+		conns.Default.Register(conn, peer.w.Done())
+		go s.trackJoin(start, peer.w, firstMedia, &logger)
+		v := viewer{ID: conn.ID, Meta: meta, Tenant: tenant, RemoteAddr: conn.RemoteAddr, Protocol: protocolWHEP, Since: start}
+		if claims != nil {
+			v.Subject = claims.Subject
+		}
+		s.watchViewer(peer.w, v)
+		s.wheps.Store(resource, peer)
+		go s.controlCongestion(peer.w, sess, nil, nil, &logger)
+		go s.limit(peer.w, nil, &logger)
+
+		// The peer connection outlives the request, so the viewer leaves after it's closed.
+		sess.Join()
+		ctx, stop := context.WithCancel(context.Background())
+		go func() {
+			<-peer.w.Done()
+			stop()
+			sess.Leave()
+			peer.close()
+			s.wheps.Delete(resource)
+		}()
+		go s.accountEgress(ctx, tenant, v.Subject, sess, peer.w)
+		logger.Info().Str("resource", resource).Msg("created WHEP subscriber")
+
+		w.Header().Set("Content-Type", sdpContentType)
+		w.Header().Set("Location", strings.Join([]string{whepPath, meta.Id, strconv.Itoa(int(meta.TrackSource)), resource}, "/"))
+		w.Header().Set("Accept-Patch", sdpFragContentType)
+		w.WriteHeader(http.StatusCreated)
+		if _, err := io.WriteString(w, answer.SDP); err != nil {
+			logger.Err(err).Msg("could not write WHEP answer")
+		}
+	}
+}
+
+// handleWHEPPatch trickles candidates of a WHEP subscriber in an SDP fragment, ICE restart is not supported.
+func (s *Subscriber) handleWHEPPatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := s.whepResource(w, r)
+		if !ok {
+			return
+		}
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != sdpFragContentType {
+			http.Error(w, "fragment must be "+sdpFragContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSDPSize))
+		if err != nil {
+			http.Error(w, "could not read fragment", http.StatusBadRequest)
+			return
+		}
+		var (
+			candidates []string
+			ended      bool
+		)
+		for _, line := range strings.Split(string(body), "\n") {
+			// Candidate attribute without "a=" is the candidate-attribute of ICECandidateInit.
+			switch line = strings.TrimSpace(line); {
+			case strings.HasPrefix(line, "a=candidate:"):
+				candidates = append(candidates, strings.TrimPrefix(line, "a="))
+			case line == "a=end-of-candidates":
+				ended = true
+			}
+		}
+		peer.trickle(candidates, ended)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleWHEPDelete stops a WHEP subscriber.
+func (s *Subscriber) handleWHEPDelete() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		peer, ok := s.whepResource(w, r)
+		if !ok {
+			return
+		}
+		if err := peer.w.Close(); err != nil {
+			s.logger.Err(err).Str("id", peer.meta.Id).Msg("could not close WHEP subscriber peer connection")
+		}
+		s.logger.Info().Str("id", peer.meta.Id).Msg("WHEP subscriber stopped")
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// whepResource returns the WHEP resource in URL path if the request is authorized, or replies an error.
+func (s *Subscriber) whepResource(w http.ResponseWriter, r *http.Request) (*whepPeer, bool) {
+	meta, ok := whepMeta(w, r)
+	if !ok {
+		return nil, false
+	}
+	claims, err := s.authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return nil, false
+	}
+	v, ok := s.wheps.Load(mux.Vars(r)["resource"])
+	if !ok || s.sessions.Key(v.(*whepPeer).meta) != s.sessions.Key(meta) || !claims.Allow(meta) {
+		http.Error(w, "WHEP resource not found", http.StatusNotFound)
+		return nil, false
+	}
+	return v.(*whepPeer), true
+}
+
+// whepMeta returns meta of the stream in URL path, or replies bad request.
+func whepMeta(w http.ResponseWriter, r *http.Request) (*pb.Meta, bool) {
+	vars := mux.Vars(r)
+	trackSource, err := session.ParseTrackSource(vars["track_source"])
+	if err != nil {
+		http.Error(w, "invalid track source", http.StatusBadRequest)
+		return nil, false
+	}
+	return &pb.Meta{Id: vars["id"], TrackSource: trackSource}, true
+}
+
+// whepFailed replies a failed WHEP offer with the JSON error of code, and counts it as WebSocket errors are.
+func whepFailed(w http.ResponseWriter, code httpx.Code, status int) {
+	whepError(w, httpx.NewError(code, nil), status)
+}
+
+// whepError is whepFailed of an error with details.
+func whepError(w http.ResponseWriter, e *httpx.Error, status int) {
+	metrics.SignalingFailures.WithLabelValues(metrics.RoleSubscriber, strconv.Itoa(int(e.Code))).Inc()
+	httpx.WriteError(w, e, status)
+}
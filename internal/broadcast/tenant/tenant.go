@@ -0,0 +1,183 @@
+// Package tenant namespaces fleets of multiple customers served by one instance.
+//
+// Machine IDs are namespaced by tenant as "tenant:id", e.g. "acme:drone1", and sessions are keyed by tenant in
+// Key.Scope. Edges of a tenant signal on MQTT topics prefixed by their tenant, e.g. "acme/<offer prefix>/drone1/0",
+// so brokers can restrict each tenant to its own topics, and edges keep their raw IDs.
+package tenant
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	pb "github.com/SB-IM/pb/signal"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	// Separator separates tenant and machine ID of a namespaced ID.
+	Separator = ":"
+	// Default is the tenant of subscribers which don't specify one.
+	Default = "default"
+	// others is the tenant of limits applied to tenants without limits of their own.
+	others = "*"
+)
+
+// Qualify returns the namespaced ID of machine id of tenant.
+func Qualify(tenant, id string) string {
+	return tenant + Separator + id
+}
+
+// Split splits a namespaced ID into its tenant and machine ID, tenant is empty if id is not namespaced.
+func Split(id string) (tenant, machine string) {
+	i := strings.Index(id, Separator)
+	if i < 0 {
+		return "", id
+	}
+	return id[:i], id[i+len(Separator):]
+}
+
+// Namer keys sessions by tenant, machine ID and track source, see session.Namer.
+func Namer(meta *pb.Meta) session.Key {
+	tenant, id := Split(meta.Id)
+	return session.Key{
+		Scope:       tenant,
+		ID:          id,
+		TrackSource: meta.TrackSource,
+	}
+}
+
+// Topic returns the MQTT topic of prefix of the stream of meta, "tenant/prefix/id/track_source".
+// The tenant level is omitted if meta.Id is not namespaced.
+func Topic(prefix string, meta *pb.Meta) string {
+	tenant, id := Split(meta.Id)
+	topic := prefix + "/" + id + "/" + strconv.Itoa(int(meta.TrackSource))
+	if tenant != "" {
+		topic = tenant + "/" + topic
+	}
+	return topic
+}
+
+// FromTopic returns the tenant of an MQTT topic, its first level.
+func FromTopic(topic string) string {
+	if i := strings.Index(topic, "/"); i >= 0 {
+		return topic[:i]
+	}
+	return topic
+}
+
+// Limit limits concurrent streams and viewers of a tenant, zero means unlimited.
+type Limit struct {
+	Streams int `json:"streams"`
+	Viewers int `json:"viewers"`
+}
+
+// Usage is concurrent streams and viewers of a tenant.
+type Usage struct {
+	Tenant  string `json:"tenant"`
+	Streams int    `json:"streams"`
+	Viewers int64  `json:"viewers"`
+	Limit   Limit  `json:"limit"`
+}
+
+// Tenants enforces limits of tenants on sessions.
+type Tenants struct {
+	sessions *session.SessionManager
+	limits   map[string]Limit
+}
+
+// New returns new Tenants of sessions, limits are parsed from TenantLimits in form of "tenant=streams:viewers".
+// Limits of tenant "*" apply to tenants without limits of their own.
+func New(sessions *session.SessionManager, config cfg.TenantConfigOptions) (*Tenants, error) {
+	limits := make(map[string]Limit, len(config.TenantLimits))
+	for _, spec := range config.TenantLimits {
+		i := strings.Index(spec, "=")
+		j := strings.LastIndex(spec, ":")
+		if i <= 0 || j < i {
+			return nil, fmt.Errorf("invalid tenant limit %q, must be in form of tenant=streams:viewers", spec)
+		}
+		tenant := spec[:i]
+		if _, ok := limits[tenant]; ok {
+			return nil, fmt.Errorf("duplicated limit of tenant %s", tenant)
+		}
+		streams, err := strconv.Atoi(spec[i+1 : j])
+		if err != nil || streams < 0 {
+			return nil, fmt.Errorf("invalid streams limit of tenant %s", tenant)
+		}
+		viewers, err := strconv.Atoi(spec[j+1:])
+		if err != nil || viewers < 0 {
+			return nil, fmt.Errorf("invalid viewers limit of tenant %s", tenant)
+		}
+		limits[tenant] = Limit{Streams: streams, Viewers: viewers}
+	}
+	return &Tenants{sessions: sessions, limits: limits}, nil
+}
+
+// Limit returns the limit of tenant.
+func (t *Tenants) Limit(tenant string) Limit {
+	if limit, ok := t.limits[tenant]; ok {
+		return limit
+	}
+	return t.limits[others]
+}
+
+// Usage returns concurrent streams and viewers of tenant.
+func (t *Tenants) Usage(tenant string) Usage {
+	usage := Usage{Tenant: tenant, Limit: t.Limit(tenant)}
+	for _, sess := range t.sessions.List() {
+		if sess.Key.Scope == tenant {
+			usage.Streams++
+			usage.Viewers += sess.Viewers()
+		}
+	}
+	return usage
+}
+
+// List returns usages of tenants with live streams or limits of their own.
+func (t *Tenants) List() []Usage {
+	usages := make(map[string]*Usage)
+	for tenant, limit := range t.limits {
+		if tenant != others {
+			usages[tenant] = &Usage{Tenant: tenant, Limit: limit}
+		}
+	}
+	for _, sess := range t.sessions.List() {
+		u, ok := usages[sess.Key.Scope]
+		if !ok {
+			u = &Usage{Tenant: sess.Key.Scope, Limit: t.Limit(sess.Key.Scope)}
+			usages[sess.Key.Scope] = u
+		}
+		u.Streams++
+		u.Viewers += sess.Viewers()
+	}
+	list := make([]Usage, 0, len(usages))
+	for _, u := range usages {
+		list = append(list, *u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Tenant < list[j].Tenant
+	})
+	return list
+}
+
+// AllowStream reports whether a session of key may be published within the streams limit of its tenant.
+// Republishing a live session replaces it, so it's always allowed.
+func (t *Tenants) AllowStream(key session.Key) bool {
+	limit := t.Limit(key.Scope).Streams
+	if limit <= 0 {
+		return true
+	}
+	if _, ok := t.sessions.Get(key); ok {
+		return true
+	}
+	return t.Usage(key.Scope).Streams < limit
+}
+
+// AllowViewer reports whether another viewer may watch streams of tenant within its viewers limit.
+func (t *Tenants) AllowViewer(tenant string) bool {
+	limit := t.Limit(tenant).Viewers
+	return limit <= 0 || t.Usage(tenant).Viewers < int64(limit)
+}
@@ -0,0 +1,226 @@
+// Package thumbnail takes preview thumbnails of live streams for dashboards.
+//
+// Every interval, a keyframe of each live H264 session is tapped in process and decoded into a JPEG by an
+// external decoder command, ffmpeg by default, as decoding is out of scope of an SFU. Decoding costs CPU,
+// so thumbnails are disabled by default.
+package thumbnail
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	defaultInterval = 10 * time.Second
+	defaultWidth    = 320
+	defaultDecoder  = "ffmpeg"
+
+	// maxKeyframeWait is the max time of waiting for a keyframe of a session after requesting one.
+	maxKeyframeWait = 5 * time.Second
+	// maxDecodeTime is the max time of decoding a keyframe.
+	maxDecodeTime = 5 * time.Second
+)
+
+// errNoKeyframe is returned if no keyframe of a session arrives in time.
+var errNoKeyframe = errors.New("no keyframe received")
+
+// startCode prefixes NAL units of H264 Annex B byte stream decoders read.
+var startCode = []byte{0, 0, 0, 1}
+
+// Thumbnail is a JPEG preview of a session.
+type Thumbnail struct {
+	JPEG []byte
+	At   time.Time // When the keyframe was received.
+}
+
+// Thumbnailer takes thumbnails of live sessions periodically.
+type Thumbnailer struct {
+	logger   zerolog.Logger
+	config   cfg.ThumbnailConfigOptions
+	sessions *session.SessionManager
+
+	mu         sync.RWMutex
+	thumbnails map[session.Key]*Thumbnail
+}
+
+// New returns a new Thumbnailer.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, config cfg.ThumbnailConfigOptions) (*Thumbnailer, error) {
+	if config.ThumbnailInterval <= 0 {
+		config.ThumbnailInterval = defaultInterval
+	}
+	if config.ThumbnailWidth <= 0 {
+		config.ThumbnailWidth = defaultWidth
+	}
+	if config.ThumbnailDecoder == "" {
+		config.ThumbnailDecoder = defaultDecoder
+	}
+	if _, err := exec.LookPath(config.ThumbnailDecoder); err != nil {
+		return nil, fmt.Errorf("decoder not found: %w", err)
+	}
+	return &Thumbnailer{
+		logger:     loglevel.Default.Component(logger, "Thumbnail"),
+		config:     config,
+		sessions:   sessions,
+		thumbnails: make(map[session.Key]*Thumbnail),
+	}, nil
+}
+
+// Get returns the latest thumbnail of the session of key.
+func (t *Thumbnailer) Get(key session.Key) (*Thumbnail, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	thumbnail, ok := t.thumbnails[key]
+	return thumbnail, ok
+}
+
+// Run takes thumbnails of live sessions every ThumbnailInterval until ctx is done.
+func (t *Thumbnailer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.config.ThumbnailInterval)
+	defer ticker.Stop()
+	for {
+		t.takeAll(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// takeAll takes thumbnails of live sessions concurrently, and drops ones of sessions gone.
+func (t *Thumbnailer) takeAll(ctx context.Context) {
+	sessions := t.sessions.List()
+	live := make(map[session.Key]bool, len(sessions))
+	var wg sync.WaitGroup
+	for _, sess := range sessions {
+		live[sess.Key] = true
+		// Other codecs can't be fed to the decoder as Annex B, and a hibernating edge sends no keyframe.
+		if !strings.EqualFold(sess.VideoTrack.Codec().MimeType, webrtc.MimeTypeH264) || sess.Hibernating() {
+			continue
+		}
+		wg.Add(1)
+		go func(sess *session.Session) {
+			defer wg.Done()
+			thumbnail, err := t.take(ctx, sess)
+			if err != nil {
+				t.logger.Debug().Err(err).Str("id", sess.ID).Msg("could not take thumbnail")
+				return
+			}
+			t.mu.Lock()
+			t.thumbnails[sess.Key] = thumbnail
+			t.mu.Unlock()
+		}(sess)
+	}
+	wg.Wait()
+
+	t.mu.Lock()
+	for key := range t.thumbnails {
+		if !live[key] {
+			delete(t.thumbnails, key)
+		}
+	}
+	t.mu.Unlock()
+}
+
+// take taps the next keyframe of sess, asking edge for one at once, and decodes it.
+func (t *Thumbnailer) take(ctx context.Context, sess *session.Session) (*Thumbnail, error) {
+	tap := sess.Taps.Add()
+	defer sess.Taps.Remove(tap)
+	sess.RequestKeyframe(sess.VideoTrack)
+
+	timer := time.NewTimer(maxKeyframeWait)
+	defer timer.Stop()
+	var (
+		video    rtpx.H264Depacketizer
+		sps, pps []byte
+	)
+	for {
+		select {
+		case packet, ok := <-tap.Packets():
+			if !ok {
+				return nil, errNoKeyframe
+			}
+			if packet.Kind != webrtc.RTPCodecTypeVideo {
+				continue
+			}
+			p, ok := rtpx.Parse(packet.Data)
+			if !ok {
+				continue
+			}
+			au := video.Push(p)
+			if au == nil {
+				continue
+			}
+			for _, nalu := range au.NALUs {
+				switch nalu[0] & 0x1F {
+				case rtpx.NALUTypeSPS:
+					sps = nalu
+				case rtpx.NALUTypePPS:
+					pps = nalu
+				}
+			}
+			if !au.Keyframe() || sps == nil || pps == nil {
+				continue
+			}
+			at := time.Now()
+			jpeg, err := t.decode(ctx, annexB(sps, pps, au))
+			if err != nil {
+				return nil, err
+			}
+			return &Thumbnail{JPEG: jpeg, At: at}, nil
+		case <-timer.C:
+			return nil, errNoKeyframe
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// annexB returns the keyframe au led by its parameter sets in Annex B byte stream.
+func annexB(sps, pps []byte, au *rtpx.AccessUnit) []byte {
+	var b bytes.Buffer
+	for _, nalu := range append([][]byte{sps, pps}, au.NALUs...) {
+		b.Write(startCode)
+		b.Write(nalu)
+	}
+	return b.Bytes()
+}
+
+// decode decodes a keyframe in Annex B into a JPEG scaled to ThumbnailWidth.
+func (t *Thumbnailer) decode(ctx context.Context, keyframe []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxDecodeTime)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, t.config.ThumbnailDecoder,
+		"-hide_banner", "-loglevel", "error",
+		"-f", "h264", "-i", "pipe:0",
+		"-frames:v", "1",
+		"-vf", "scale="+strconv.Itoa(t.config.ThumbnailWidth)+":-2",
+		"-f", "image2", "-c:v", "mjpeg", "pipe:1",
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(keyframe)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("could not decode keyframe: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if stdout.Len() == 0 {
+		return nil, errors.New("decoder output no image")
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,252 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+)
+
+const (
+	defaultServiceName = "skywalker-broadcast"
+
+	// exportInterval is the max time a span waits in a batch before exported.
+	exportInterval = 5 * time.Second
+	// maxBatchSize is the max spans of a batch, a full batch is exported at once.
+	maxBatchSize = 512
+	// maxQueuedSpans caps spans waiting for export, spans are dropped once it's full, e.g. while the
+	// collector is down, so tracing never stalls signaling.
+	maxQueuedSpans = 2048
+	exportTimeout  = 10 * time.Second
+)
+
+// Exporter exports ended spans in batches to an OpenTelemetry collector over OTLP/HTTP in JSON.
+type Exporter struct {
+	logger  zerolog.Logger
+	url     string
+	service string
+	headers map[string]string
+	client  *http.Client
+	spans   chan *Span
+}
+
+// NewExporter returns a new Exporter of TracingEndpoint of config, the base URL of an OTLP/HTTP receiver,
+// e.g. "http://localhost:4318", spans are posted to its "/v1/traces".
+func NewExporter(config cfg.TracingConfigOptions, logger *zerolog.Logger) (*Exporter, error) {
+	u, err := url.Parse(config.TracingEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse tracing endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported tracing endpoint scheme: %q", u.Scheme)
+	}
+	headers := make(map[string]string, len(config.TracingHeaders))
+	for _, h := range config.TracingHeaders {
+		i := strings.IndexByte(h, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid tracing header %q, must be in form of key=value", h)
+		}
+		headers[h[:i]] = h[i+1:]
+	}
+	service := config.TracingServiceName
+	if service == "" {
+		service = defaultServiceName
+	}
+
+	return &Exporter{
+		logger:  loglevel.Default.Component(logger, "Tracing"),
+		url:     strings.TrimSuffix(u.String(), "/") + "/v1/traces",
+		service: service,
+		headers: headers,
+		client:  &http.Client{Timeout: exportTimeout},
+		spans:   make(chan *Span, maxQueuedSpans),
+	}, nil
+}
+
+// export queues an ended span, it's dropped if the queue is full.
+func (e *Exporter) export(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+		e.logger.Debug().Str("span", span.name).Msg("dropped span as export queue is full")
+	}
+}
+
+// Run exports spans in batches until ctx is done, spans queued then are exported at last.
+func (e *Exporter) Run(ctx context.Context) {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+
+	e.logger.Info().Str("url", e.url).Msg("started exporting spans")
+	batch := make([]*Span, 0, maxBatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(ctx, batch); err != nil {
+			e.logger.Err(err).Int("spans", len(batch)).Msg("could not export spans")
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= maxBatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+			defer cancel()
+			for {
+				select {
+				case span := <-e.spans:
+					batch = append(batch, span)
+					if len(batch) >= maxBatchSize {
+						flush(ctx)
+					}
+				default:
+					flush(ctx)
+					return
+				}
+			}
+		}
+	}
+}
+
+// post posts spans in an OTLP ExportTraceServiceRequest.
+func (e *Exporter) post(ctx context.Context, spans []*Span) error {
+	b, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return fmt.Errorf("could not encode spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, body)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// OTLP JSON encoding of spans, IDs are in hex and 64-bit integers are in strings.
+// See: https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              Kind            `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+		BoolValue   *bool   `json:"boolValue,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"` // 0 for unset, 2 for error.
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// request returns the OTLP request of spans.
+func (e *Exporter) request(spans []*Span) otlpRequest {
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "github.com/SB-IM/skywalker"}}
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parentID != [8]byte{} {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, newAttribute(a.key, a.value))
+		}
+		if s.err != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.err}
+		}
+		s.mu.Unlock()
+		scope.Spans = append(scope.Spans, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpAttribute{newAttribute("service.name", e.service)}},
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
+
+// newAttribute returns an OTLP attribute of key and value.
+func newAttribute(key string, value interface{}) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		a.Value.StringValue = &v
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		a.Value.IntValue = &s
+	case bool:
+		a.Value.BoolValue = &v
+	default:
+		s := fmt.Sprint(v)
+		a.Value.StringValue = &s
+	}
+	return a
+}
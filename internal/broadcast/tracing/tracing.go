@@ -0,0 +1,263 @@
+// Package tracing traces signaling of streams across MQTT, WebRTC and WebSocket in OpenTelemetry spans,
+// e.g. to find which step makes a stream slow to start.
+//
+// Only what signaling needs is implemented: spans with attributes and error status, W3C trace context
+// propagation and an OTLP/HTTP JSON exporter, so any OpenTelemetry collector receives them.
+// See: https://www.w3.org/TR/trace-context/ and https://opentelemetry.io/docs/specs/otlp/
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default is the tracer of broadcast service, it doesn't record spans until an exporter is set.
+var Default = &Tracer{}
+
+// Kind is the kind of a span, values are the ones of OTLP.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// SpanContext identifies a span across services.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Valid returns whether sc has trace and span IDs.
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent returns sc in W3C traceparent form, e.g. "00-<trace-id>-<span-id>-01".
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a W3C traceparent. Versions above 00 are parsed by the fields of version 00,
+// as the spec requires.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, errors.New("malformed traceparent")
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, errors.New("invalid traceparent version")
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, errors.New("invalid trace ID")
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, errors.New("invalid span ID")
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return sc, errors.New("invalid trace flags")
+	}
+	sc.Sampled = flags&1 == 1
+	if !sc.Valid() {
+		return sc, errors.New("zero trace or span ID")
+	}
+	return sc, nil
+}
+
+type (
+	spanKey   struct{}
+	remoteKey struct{}
+)
+
+// WithRemote returns a copy of ctx in which spans started are children of the remote span of traceparent,
+// e.g. of an edge or a client. ctx is returned as is if traceparent is empty or invalid.
+func WithRemote(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanFromContext returns the span of ctx, nil if there is none. Methods of a nil span do nothing.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Tracer starts spans and sends them to its exporter once ended.
+type Tracer struct {
+	mu       sync.RWMutex
+	exporter *Exporter
+	// ratio of root spans sampled, by the first 8 bytes of their trace IDs.
+	ratio float64
+}
+
+// SetExporter sets the exporter of spans, root spans are sampled by ratio in [0, 1].
+// Spans continuing a remote one follow its sampling decision instead.
+func (t *Tracer) SetExporter(exporter *Exporter, ratio float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.exporter = exporter
+	t.ratio = ratio
+}
+
+// Start starts a span of name, as a child of the span or the remote span of ctx if any.
+// It returns ctx as is and a nil span if tracing is disabled.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	t.mu.RLock()
+	exporter, ratio := t.exporter, t.ratio
+	t.mu.RUnlock()
+	if exporter == nil {
+		return ctx, nil
+	}
+
+	span := &Span{exporter: exporter, name: name, kind: kind, start: time.Now()}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.sc.TraceID, span.parentID, span.sc.Sampled = parent.sc.TraceID, parent.sc.SpanID, parent.sc.Sampled
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		span.sc.TraceID, span.parentID, span.sc.Sampled = remote.TraceID, remote.SpanID, remote.Sampled
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = sampled(span.sc.TraceID, ratio)
+	}
+	span.sc.SpanID = newSpanID()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// sampled returns whether a root span of traceID is sampled by ratio, it's deterministic by trace ID.
+func sampled(traceID [16]byte, ratio float64) bool {
+	switch {
+	case ratio >= 1:
+		return true
+	case ratio <= 0:
+		return false
+	default:
+		return binary.BigEndian.Uint64(traceID[:8]) < uint64(ratio*math.MaxUint64)
+	}
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() (id [16]byte) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() (id [8]byte) {
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// Span is a timed step of signaling. It's safe for concurrent use, and changes after End are ignored.
+type Span struct {
+	exporter *Exporter
+	name     string
+	kind     Kind
+	sc       SpanContext
+	parentID [8]byte
+	start    time.Time
+
+	mu    sync.Mutex
+	end   time.Time
+	attrs []attribute
+	err   string // Error message, the span failed if it's not empty.
+}
+
+// attribute is a key value pair of a span, value is a string, an int64 or a bool.
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// Context returns the span context of s, e.g. to propagate it.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// Traceparent returns the span context of s in W3C traceparent form, empty if s is nil.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return s.sc.Traceparent()
+}
+
+// SetString sets a string attribute.
+func (s *Span) SetString(key, value string) {
+	s.set(key, value)
+}
+
+// SetInt sets an integer attribute.
+func (s *Span) SetInt(key string, value int64) {
+	s.set(key, value)
+}
+
+// SetBool sets a boolean attribute.
+func (s *Span) SetBool(key string, value bool) {
+	s.set(key, value)
+}
+
+func (s *Span) set(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.attrs = append(s.attrs, attribute{key: key, value: value})
+}
+
+// SetError marks s failed with message of err, a nil err is ignored.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.end.IsZero() {
+		return
+	}
+	s.err = err.Error()
+}
+
+// End ends s and sends it to the exporter if it's sampled, only the first call takes effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.exporter.export(s)
+	}
+}
@@ -0,0 +1,240 @@
+// Package webhook notifies HTTP webhooks of streams going live and stopping, e.g. a mission-control backend
+// waiting for drones. Payloads are signed by HMAC SHA-256 if a secret is set, and deliveries are retried with
+// backoff. Each webhook is delivered in order of events by its own queue, so a slow one doesn't delay others.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+const (
+	// SignatureHeader carries "sha256=" and hex HMAC SHA-256 of the body keyed by the secret.
+	SignatureHeader = "X-Skywalker-Signature"
+
+	defaultTimeout = 5 * time.Second
+	defaultBackoff = time.Second
+	// queueSize is events queued per webhook, events are dropped once it's full.
+	queueSize = 256
+)
+
+// Events of payloads.
+const (
+	StreamStarted = "stream-started"
+	StreamStopped = "stream-stopped"
+)
+
+// Payload is the JSON body POSTed to webhooks.
+type Payload struct {
+	Event       string         `json:"event"`
+	ID          string         `json:"id"`
+	TrackSource pb.TrackSource `json:"track_source"`
+	Region      string         `json:"region,omitempty"`
+	StartedAt   time.Time      `json:"started_at"`
+	StoppedAt   *time.Time     `json:"stopped_at,omitempty"`
+	// Timestamp is when the event happened, receivers may reject stale deliveries by it.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Notifier delivers session lifecycle events to webhooks.
+type Notifier struct {
+	logger   zerolog.Logger
+	config   cfg.WebhookConfigOptions
+	sessions *session.SessionManager
+	region   string
+	client   *http.Client
+	queues   map[string]chan *Payload
+}
+
+// New returns a new Notifier of webhooks of config.
+func New(sessions *session.SessionManager, logger *zerolog.Logger, region string, config cfg.WebhookConfigOptions) (*Notifier, error) {
+	if config.WebhookTimeout <= 0 {
+		config.WebhookTimeout = defaultTimeout
+	}
+	if config.WebhookBackoff <= 0 {
+		config.WebhookBackoff = defaultBackoff
+	}
+	if config.WebhookRetries < 0 {
+		return nil, fmt.Errorf("invalid webhook retries %d", config.WebhookRetries)
+	}
+	queues := make(map[string]chan *Payload, len(config.Webhooks))
+	for _, u := range config.Webhooks {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook URL: %w", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported webhook scheme %q", parsed.Scheme)
+		}
+		queues[u] = make(chan *Payload, queueSize)
+	}
+	if len(queues) == 0 {
+		return nil, errors.New("no webhook")
+	}
+	return &Notifier{
+		logger:   loglevel.Default.Component(logger, "Webhook"),
+		config:   config,
+		sessions: sessions,
+		region:   region,
+		client:   &http.Client{Timeout: config.WebhookTimeout},
+		queues:   queues,
+	}, nil
+}
+
+// Run notifies webhooks of sessions published to this instance until ctx is done.
+// Sessions relayed from other instances are left to the instances they are published to.
+func (n *Notifier) Run(ctx context.Context) {
+	for u, queue := range n.queues {
+		go n.deliver(ctx, u, queue)
+	}
+	events, stop := n.sessions.Watch()
+	defer stop()
+	for {
+		select {
+		case e := <-events:
+			switch e.Type {
+			case session.EventCreated:
+				n.notify(n.payload(StreamStarted, e.Session))
+			case session.EventClosed:
+				n.notify(n.payload(StreamStopped, e.Session))
+			case session.EventReplaced:
+				n.notify(n.payload(StreamStopped, e.Replaced))
+				n.notify(n.payload(StreamStarted, e.Session))
+			default:
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// payload returns the payload of event of sess, or nil if sess is relayed.
+func (n *Notifier) payload(event string, sess *session.Session) *Payload {
+	if sess.Origin != "" {
+		return nil
+	}
+	now := time.Now()
+	p := &Payload{
+		Event:       event,
+		ID:          sess.Meta.Id,
+		TrackSource: sess.Meta.TrackSource,
+		Region:      n.region,
+		StartedAt:   sess.CreatedAt,
+		Timestamp:   now,
+	}
+	if event == StreamStopped {
+		p.StoppedAt = &now
+	}
+	return p
+}
+
+// notify queues p to all webhooks, it's dropped for a webhook whose queue is full.
+func (n *Notifier) notify(p *Payload) {
+	if p == nil {
+		return
+	}
+	for u, queue := range n.queues {
+		select {
+		case queue <- p:
+		default:
+			metrics.WebhookDeliveries.WithLabelValues("dropped").Inc()
+			n.logger.Warn().Str("url", redact(u)).Str("event", p.Event).Str("id", p.ID).Msg("webhook queue is full, dropped event")
+		}
+	}
+}
+
+// deliver POSTs payloads of queue to webhook u in order until ctx is done.
+func (n *Notifier) deliver(ctx context.Context, u string, queue <-chan *Payload) {
+	logger := n.logger.With().Str("url", redact(u)).Logger()
+	for {
+		select {
+		case p := <-queue:
+			body, err := json.Marshal(p)
+			if err != nil {
+				logger.Err(err).Msg("could not marshal webhook payload")
+				continue
+			}
+			if err := n.post(ctx, u, body); err != nil {
+				metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+				logger.Err(err).Str("event", p.Event).Str("id", p.ID).Msg("could not deliver webhook, gave up")
+				continue
+			}
+			metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+			logger.Debug().Str("event", p.Event).Str("id", p.ID).Msg("delivered webhook")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// post POSTs body to u, and retries up to WebhookRetries times with backoff doubling from WebhookBackoff.
+func (n *Notifier) post(ctx context.Context, u string, body []byte) error {
+	backoff := n.config.WebhookBackoff
+	for attempt := 0; ; attempt++ {
+		err := n.postOnce(ctx, u, body)
+		if err == nil || attempt >= n.config.WebhookRetries {
+			return err
+		}
+		metrics.WebhookDeliveries.WithLabelValues("retried").Inc()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) postOnce(ctx context.Context, u string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if n.config.WebhookSecret != "" {
+		req.Header.Set(SignatureHeader, Sign([]byte(n.config.WebhookSecret), body))
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the value of SignatureHeader of body keyed by secret, receivers verify deliveries by it.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// redact returns u without credentials and query, which may carry tokens, for logs.
+func redact(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	parsed.User, parsed.RawQuery = nil, ""
+	return parsed.String()
+}
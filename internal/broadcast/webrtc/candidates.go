@@ -0,0 +1,91 @@
+package webrtc
+
+import "sync"
+
+// maxQueuedCandidates caps candidates queued of a remote peer, so a peer flooding them can't exhaust memory.
+// A peer gathers a handful of candidates per network interface and ICE server.
+const maxQueuedCandidates = 128
+
+// CandidateQueue queues candidates from a remote peer until they are added to its peer connection.
+// Push never blocks, so a slow or failed negotiation never stalls the reader of signaling. The remote peer
+// signals end-of-candidates by End, and the queue is closed once the peer connection is closed, candidates
+// pushed afterwards are dropped.
+type CandidateQueue struct {
+	mu         sync.Mutex
+	candidates []string
+	ended      bool // Whether the remote peer has no more candidates.
+	closed     bool // Whether the peer connection is closed, candidates are discarded then.
+	// ready has a value while candidates are queued, or once ended or closed.
+	ready chan struct{}
+}
+
+// NewCandidateQueue returns a new CandidateQueue.
+func NewCandidateQueue() *CandidateQueue {
+	return &CandidateQueue{ready: make(chan struct{}, 1)}
+}
+
+// Push queues a candidate, it returns false if the candidate is dropped as the queue is ended, closed or full.
+func (q *CandidateQueue) Push(candidate string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.ended || q.closed || len(q.candidates) >= maxQueuedCandidates {
+		return false
+	}
+	q.candidates = append(q.candidates, candidate)
+	q.signal()
+	return true
+}
+
+// End signals end-of-candidates, candidates queued before are still popped.
+func (q *CandidateQueue) End() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.ended = true
+	q.signal()
+}
+
+// Close discards candidates queued, it's called once the peer connection is closed.
+func (q *CandidateQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.candidates = nil
+	q.signal()
+}
+
+// signal wakes up Pop, q.mu must be held.
+func (q *CandidateQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Pop blocks until a candidate is queued, and returns false once the queue is ended and drained, closed,
+// or done is closed.
+func (q *CandidateQueue) Pop(done <-chan struct{}) (string, bool) {
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return "", false
+		}
+		if len(q.candidates) > 0 {
+			candidate := q.candidates[0]
+			q.candidates = q.candidates[1:]
+			q.mu.Unlock()
+			return candidate, true
+		}
+		ended := q.ended
+		q.mu.Unlock()
+		if ended {
+			return "", false
+		}
+
+		select {
+		case <-q.ready:
+		case <-done:
+			return "", false
+		}
+	}
+}
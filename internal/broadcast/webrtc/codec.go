@@ -0,0 +1,233 @@
+package webrtc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+const (
+	// mimeTypeAV1 is not registered by default codecs of pion.
+	mimeTypeAV1    = "video/AV1"
+	av1PayloadType = 45
+)
+
+// videoRTCPFeedback is RTCP feedback of video codecs as default ones of pion.
+var videoRTCPFeedback = []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}}
+
+// Codecs are codecs of video and audio tracks of a session.
+type Codecs struct {
+	Video webrtc.RTPCodecCapability
+	Audio webrtc.RTPCodecCapability
+
+	// preferred are codecs negotiated by configured ones, edge is answered with only them.
+	preferred []webrtc.RTPCodecCapability
+}
+
+// DefaultCodecs returns H264 video and Opus audio codecs, which are forwarded for track sources without codecs configured.
+func DefaultCodecs() *Codecs {
+	return &Codecs{
+		Video: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264},
+		Audio: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus},
+	}
+}
+
+// AnsweredCodecs returns codecs of video and audio chosen by answer, i.e. the first one of each kind,
+// e.g. of a peer connection pulling a stream from another instance. A kind not answered gets the default one.
+func AnsweredCodecs(answer *webrtc.SessionDescription) *Codecs {
+	answered := DefaultCodecs()
+	var video, audio bool
+	for _, c := range offeredCodecs(answer.SDP) {
+		switch {
+		case c.kind == webrtc.RTPCodecTypeVideo && !video:
+			answered.Video, video = c.capability, true
+		case c.kind == webrtc.RTPCodecTypeAudio && !audio:
+			answered.Audio, audio = c.capability, true
+		}
+	}
+	return answered
+}
+
+// offeredCodec is a codec of an offer.
+type offeredCodec struct {
+	kind       webrtc.RTPCodecType
+	capability webrtc.RTPCodecCapability
+}
+
+// NegotiateCodecs picks codecs of a publisher from offer by codecs configured for trackSource in order of preference.
+// A kind without codecs configured gets the default one, see DefaultCodecs.
+func NegotiateCodecs(offer *webrtc.SessionDescription, trackSource int32, codecs []cfg.Codec) (*Codecs, error) {
+	negotiated := DefaultCodecs()
+	offered := offeredCodecs(offer.SDP)
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		var accepted []string
+		var picked *webrtc.RTPCodecCapability
+		for _, codec := range codecs {
+			if codec.TrackSource != trackSource || !strings.HasPrefix(strings.ToLower(codec.MimeType), kind.String()+"/") {
+				continue
+			}
+			accepted = append(accepted, codec.MimeType)
+			if picked != nil {
+				continue
+			}
+			for _, o := range offered {
+				if o.kind == kind && matchCodec(codec, o.capability) {
+					c := o.capability
+					picked = &c
+					break
+				}
+			}
+		}
+		switch {
+		case len(accepted) == 0:
+			continue
+		case picked == nil:
+			return nil, fmt.Errorf("edge offered none of %s codecs %s", kind, strings.Join(accepted, ", "))
+		case kind == webrtc.RTPCodecTypeVideo:
+			negotiated.Video = *picked
+		default:
+			negotiated.Audio = *picked
+		}
+		negotiated.preferred = append(negotiated.preferred, *picked)
+	}
+	return negotiated, nil
+}
+
+// NegotiateLowLatencyCodecs picks codecs as NegotiateCodecs, but a track source without video codecs configured
+// gets H264 of a baseline profile if offered, which has no B-frames, so the decoder of a subscriber never waits
+// for frames after the one it's showing. Edge is answered with only it.
+func NegotiateLowLatencyCodecs(offer *webrtc.SessionDescription, trackSource int32, codecs []cfg.Codec) (*Codecs, error) {
+	negotiated, err := NegotiateCodecs(offer, trackSource, codecs)
+	if err != nil {
+		return nil, err
+	}
+	for _, codec := range codecs {
+		if codec.TrackSource == trackSource && strings.HasPrefix(strings.ToLower(codec.MimeType), "video/") {
+			return negotiated, nil
+		}
+	}
+	for _, o := range offeredCodecs(offer.SDP) {
+		if o.kind == webrtc.RTPCodecTypeVideo && strings.EqualFold(o.capability.MimeType, webrtc.MimeTypeH264) &&
+			isBaselineH264(o.capability.SDPFmtpLine) {
+			negotiated.Video = o.capability
+			negotiated.preferred = append(negotiated.preferred, o.capability)
+			break
+		}
+	}
+	return negotiated, nil
+}
+
+// isBaselineH264 reports whether fmtp of H264 is of the baseline or constrained baseline profile, profile_idc 0x42.
+func isBaselineH264(fmtp string) bool {
+	return strings.HasPrefix(strings.ToLower(parseFmtp(fmtp)["profile-level-id"]), "42")
+}
+
+// matchCodec reports whether the offered codec is the configured one, format parameters configured must be offered.
+func matchCodec(codec cfg.Codec, offered webrtc.RTPCodecCapability) bool {
+	if !strings.EqualFold(codec.MimeType, offered.MimeType) {
+		return false
+	}
+	if codec.ClockRate != 0 && codec.ClockRate != offered.ClockRate {
+		return false
+	}
+	params := parseFmtp(offered.SDPFmtpLine)
+	for k, v := range parseFmtp(codec.SDPFmtpLine) {
+		if !strings.EqualFold(params[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// offeredCodecs returns codecs of offer in order of preference of each media section.
+func offeredCodecs(sdp string) []offeredCodec {
+	var codecs []offeredCodec
+	// Codecs of the current media section by payload type, in order of its m-line.
+	var kind webrtc.RTPCodecType
+	var payloadTypes []string
+	rtpmaps, fmtps := map[string]string{}, map[string]string{}
+	flush := func() {
+		for _, pt := range payloadTypes {
+			rtpmap, ok := rtpmaps[pt]
+			if !ok {
+				continue
+			}
+			// <encoding name>/<clock rate>[/<channels>]
+			parts := strings.Split(rtpmap, "/")
+			capability := webrtc.RTPCodecCapability{
+				MimeType:    kind.String() + "/" + parts[0],
+				SDPFmtpLine: fmtps[pt],
+			}
+			if len(parts) > 1 {
+				clockRate, _ := strconv.ParseUint(parts[1], 10, 32)
+				capability.ClockRate = uint32(clockRate)
+			}
+			if len(parts) > 2 {
+				channels, _ := strconv.ParseUint(parts[2], 10, 16)
+				capability.Channels = uint16(channels)
+			}
+			codecs = append(codecs, offeredCodec{kind: kind, capability: capability})
+		}
+		payloadTypes = nil
+		rtpmaps, fmtps = map[string]string{}, map[string]string{}
+	}
+
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			flush()
+			// m=<media> <port> <proto> <fmt> ...
+			fields := strings.Fields(strings.TrimPrefix(line, "m="))
+			if len(fields) < 4 {
+				kind = 0
+				continue
+			}
+			kind = webrtc.NewRTPCodecType(fields[0])
+			payloadTypes = fields[3:]
+		case strings.HasPrefix(line, "a=rtpmap:"):
+			if pt, v, ok := splitAttribute(strings.TrimPrefix(line, "a=rtpmap:")); ok {
+				rtpmaps[pt] = v
+			}
+		case strings.HasPrefix(line, "a=fmtp:"):
+			if pt, v, ok := splitAttribute(strings.TrimPrefix(line, "a=fmtp:")); ok {
+				fmtps[pt] = v
+			}
+		}
+	}
+	flush()
+	return codecs
+}
+
+// splitAttribute splits "<payload type> <value>" of rtpmap and fmtp attributes.
+func splitAttribute(s string) (pt, value string, ok bool) {
+	i := strings.Index(s, " ")
+	if i < 0 {
+		return "", "", false
+	}
+	return s[:i], strings.TrimSpace(s[i+1:]), true
+}
+
+// parseFmtp parses format parameters "k1=v1;k2=v2", keys are in lower case.
+func parseFmtp(line string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(line, ";") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = kv[1]
+		}
+	}
+	return params
+}
+
+// registerAV1 registers AV1 codec, which is not a default codec of pion yet.
+func registerAV1(m *webrtc.MediaEngine) error {
+	return m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: mimeTypeAV1, ClockRate: 90000, RTCPFeedback: videoRTCPFeedback},
+		PayloadType:        av1PayloadType,
+	}, webrtc.RTPCodecTypeVideo)
+}
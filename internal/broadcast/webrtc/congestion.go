@@ -0,0 +1,38 @@
+package webrtc
+
+const (
+	// Thresholds of fraction lost of the loss-based controller of GCC, see draft-ietf-rmcat-gcc section 6:
+	// the estimate is decreased above lossDecrease, and increased below lossIncrease.
+	lossDecrease = 0.1
+	lossIncrease = 0.02
+	// increaseFactor is the growth of the estimate in an update without loss.
+	increaseFactor = 1.05
+)
+
+// BandwidthEstimator estimates bitrate available to a subscriber from its RTCP feedback: REMB if subscriber
+// sends it, bounded by the loss-based controller of GCC on fraction lost of receiver reports of video.
+// It's not safe for concurrent use.
+type BandwidthEstimator struct {
+	estimate float64
+}
+
+// Update updates the estimate by stats of the subscriber, sending is bitrate of video currently sent to it,
+// and returns the estimate in bits per second. Updates should be made in a regular interval, e.g. a second.
+func (e *BandwidthEstimator) Update(stats Stats, sending uint64) uint64 {
+	if e.estimate == 0 {
+		e.estimate = float64(sending)
+	}
+	switch loss := stats.Video.FractionLost; {
+	case loss > lossDecrease:
+		e.estimate = float64(sending) * (1 - 0.5*loss)
+	case loss < lossIncrease:
+		if e.estimate < float64(sending) {
+			e.estimate = float64(sending)
+		}
+		e.estimate *= increaseFactor
+	}
+	if remb := float64(stats.EstimatedBitrate); remb > 0 && remb < e.estimate {
+		return uint64(remb)
+	}
+	return uint64(e.estimate)
+}
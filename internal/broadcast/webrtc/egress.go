@@ -0,0 +1,110 @@
+package webrtc
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// sentCounter is an interceptor of a subscriber peer connection counting RTP bytes sent by SSRC, retransmissions
+// included, so viewers are accounted for what each of them is sent, e.g. one simulcast layer, rather than what
+// sessions receive from edge.
+type sentCounter struct {
+	interceptor.NoOp
+
+	mu      sync.Mutex
+	streams map[uint32]*sentStream
+}
+
+// sentStream is bytes sent of a stream, accessed atomically.
+type sentStream struct {
+	bytes uint64
+	video bool
+}
+
+func newSentCounter() *sentCounter {
+	return &sentCounter{streams: make(map[uint32]*sentStream)}
+}
+
+// NewInterceptor returns c itself, it's built once for the peer connection it's created for.
+func (c *sentCounter) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return c, nil
+}
+
+// BindLocalStream counts bytes of packets written to the stream.
+func (c *sentCounter) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	stream := &sentStream{video: strings.HasPrefix(strings.ToLower(info.MimeType), "video/")}
+	c.mu.Lock()
+	c.streams[info.SSRC] = stream
+	c.mu.Unlock()
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		n, err := writer.Write(header, payload, attributes)
+		if err == nil {
+			atomic.AddUint64(&stream.bytes, uint64(header.MarshalSize()+len(payload)))
+		}
+		return n, err
+	})
+}
+
+// bytes returns bytes sent of the stream of ssrc.
+func (c *sentCounter) bytes(ssrc uint32) uint64 {
+	c.mu.Lock()
+	stream, ok := c.streams[ssrc]
+	c.mu.Unlock()
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(&stream.bytes)
+}
+
+// kinds returns bytes sent of video and audio streams.
+func (c *sentCounter) kinds() (video, audio uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, stream := range c.streams {
+		if stream.video {
+			video += atomic.LoadUint64(&stream.bytes)
+		} else {
+			audio += atomic.LoadUint64(&stream.bytes)
+		}
+	}
+	return video, audio
+}
+
+// BytesSent returns RTP bytes sent to subscriber of tracks added by CreateSubscriber or BundleTracks, including
+// retransmissions and whichever simulcast layer replaced a video track. It's zero if the peer connection is not
+// created by Media of NewMedia, which counts them.
+func (w *WebRTC) BytesSent(tracks ...*session.Track) uint64 {
+	w.sendersMux.Lock()
+	defer w.sendersMux.Unlock()
+	if w.sent == nil {
+		return 0
+	}
+	var n uint64
+	for _, track := range tracks {
+		if ssrc, ok := w.senders[track]; ok {
+			n += w.sent.bytes(ssrc)
+		}
+	}
+	return n
+}
+
+// addSender records the SSRC of the sender of track, so bytes sent of it are found by the track.
+func (w *WebRTC) addSender(track *session.Track, sender *webrtc.RTPSender) {
+	encodings := sender.GetParameters().Encodings
+	if len(encodings) == 0 {
+		return
+	}
+	w.sendersMux.Lock()
+	defer w.sendersMux.Unlock()
+	if w.senders == nil {
+		w.senders = make(map[*session.Track]uint32)
+	}
+	w.senders[track] = uint32(encodings[0].SSRC)
+}
@@ -0,0 +1,143 @@
+package webrtc
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+)
+
+// jitterWindow is the max distance of sequence numbers of packets held by a jitterBuffer. A packet farther ahead
+// is taken as a restart of the stream rather than a gap, e.g. edge reset its sequence numbers.
+const jitterWindow = 512
+
+// heldPacket is a packet held by a jitterBuffer until packets before it arrive.
+type heldPacket struct {
+	data []byte
+	at   time.Time
+}
+
+// jitterBuffer reorders RTP packets of a track from edge by sequence numbers, links over LTE deliver them out of
+// order. A packet arriving before the ones preceding it is held until they arrive or it has waited for latency,
+// then the missing ones are skipped as lost. Packets arriving after they are skipped or released are dropped.
+// There is no timer, held packets are released by arrivals of later packets, so a stream stalling on a gap waits
+// for its next packet. It's used by the read loop of a track only.
+type jitterBuffer struct {
+	latency time.Duration
+	kind    string
+
+	started bool
+	// next is the sequence number of the next packet to release.
+	next uint16
+	held map[uint16]heldPacket
+	// since is the arrival time of the earliest packet held, waiting for the gap before next one.
+	since time.Time
+}
+
+// newJitterBuffer returns a jitterBuffer of packets of kind reordered within latency.
+func newJitterBuffer(latency time.Duration, kind string) *jitterBuffer {
+	return &jitterBuffer{
+		latency: latency,
+		kind:    kind,
+		held:    make(map[uint16]heldPacket),
+	}
+}
+
+// push adds packet arrived at now, and releases packets in order to release, which may be given packet itself
+// or a copy of it. It stops at the first error of release and returns it.
+func (b *jitterBuffer) push(packet []byte, now time.Time, release func([]byte) error) error {
+	if len(packet) < rtpHeaderSize {
+		return release(packet)
+	}
+	seq := binary.BigEndian.Uint16(packet[2:4])
+	if !b.started {
+		b.started, b.next = true, seq
+	}
+
+	switch d := int16(seq - b.next); {
+	case d == 0:
+		b.next++
+		if err := release(packet); err != nil {
+			return err
+		}
+	case d < -jitterWindow || d >= jitterWindow:
+		// The stream restarted, so held packets of it before are released as they are.
+		if err := b.flush(release); err != nil {
+			return err
+		}
+		b.next = seq + 1
+		if err := release(packet); err != nil {
+			return err
+		}
+	case d < 0:
+		metrics.JitterBufferPackets.WithLabelValues(b.kind, "late").Inc()
+		return nil
+	default:
+		if _, ok := b.held[seq]; ok {
+			return nil
+		}
+		if len(b.held) == 0 {
+			b.since = now
+		}
+		b.held[seq] = heldPacket{data: append([]byte(nil), packet...), at: now}
+		metrics.JitterBufferPackets.WithLabelValues(b.kind, "reordered").Inc()
+	}
+	return b.drain(now, release)
+}
+
+// drain releases held packets following next, and skips gaps which have been waited for latency.
+func (b *jitterBuffer) drain(now time.Time, release func([]byte) error) error {
+	for len(b.held) > 0 {
+		p, ok := b.held[b.next]
+		if !ok {
+			if now.Sub(b.since) < b.latency {
+				return nil
+			}
+			b.skip()
+			continue
+		}
+		delete(b.held, b.next)
+		b.next++
+		if err := release(p.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip moves next to the first held packet, and restarts waiting from the earliest arrival of ones left.
+func (b *jitterBuffer) skip() {
+	i := uint16(1)
+	for ; i < jitterWindow; i++ {
+		if _, ok := b.held[b.next+i]; ok {
+			break
+		}
+	}
+	if i == jitterWindow {
+		// Held packets are always within the window, they are dropped rather than spinning drain if not.
+		b.held = make(map[uint16]heldPacket)
+		return
+	}
+	metrics.JitterBufferPackets.WithLabelValues(b.kind, "skipped").Add(uint64(i))
+	b.next += i
+	b.since = time.Time{}
+	for _, p := range b.held {
+		if b.since.IsZero() || p.at.Before(b.since) {
+			b.since = p.at
+		}
+	}
+}
+
+// flush releases all held packets in order and empties the buffer.
+func (b *jitterBuffer) flush(release func([]byte) error) error {
+	for i := uint16(0); len(b.held) > 0 && i < jitterWindow; i++ {
+		if p, ok := b.held[b.next+i]; ok {
+			delete(b.held, b.next+i)
+			if err := release(p.data); err != nil {
+				return err
+			}
+		}
+	}
+	b.held = make(map[uint16]heldPacket)
+	return nil
+}
@@ -0,0 +1,49 @@
+package webrtc
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/rtpx"
+)
+
+// RTP header extensions of edge stamping video packets, so latency of them can be measured.
+const (
+	absCaptureTimeURI = "http://www.webrtc.org/experiments/rtp-hdrext/abs-capture-time"
+	absSendTimeURI    = "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time"
+)
+
+// latencyExtensions are RTP header extensions of stamped time, in order of preference.
+var latencyExtensions = []string{absCaptureTimeURI, absSendTimeURI}
+
+// stampFunc returns time stamped on an RTP packet by edge received at receivedAt, and reports whether it's stamped.
+type stampFunc func(packet []byte, receivedAt time.Time) (time.Time, bool)
+
+// newStampFunc returns stampFunc of the most preferred latency extension negotiated with receiver,
+// or nil if none is.
+func newStampFunc(receiver *webrtc.RTPReceiver) stampFunc {
+	ids := make(map[string]uint8)
+	for _, ext := range receiver.GetParameters().HeaderExtensions {
+		ids[ext.URI] = uint8(ext.ID)
+	}
+	if id, ok := ids[absCaptureTimeURI]; ok {
+		return func(packet []byte, _ time.Time) (time.Time, bool) {
+			ext, ok := rtpx.Extension(packet, id)
+			if !ok {
+				return time.Time{}, false
+			}
+			return rtpx.AbsCaptureTime(ext)
+		}
+	}
+	if id, ok := ids[absSendTimeURI]; ok {
+		return func(packet []byte, receivedAt time.Time) (time.Time, bool) {
+			ext, ok := rtpx.Extension(packet, id)
+			if !ok {
+				return time.Time{}, false
+			}
+			return rtpx.AbsSendTime(ext, receivedAt)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/nack"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// iceTCPReadBufferSize is the number of packets buffered per ICE-TCP connection before read.
+const iceTCPReadBufferSize = 8
+
+// PeerFactory creates peer connections, *webrtc.API is one. Peer connections can be created on a virtual
+// network instead, e.g. by testsupport.PeerFactory, so signaling is tested without real network or browsers.
+// They are concrete pion ones, as WebRTC drives tracks, transceivers and data channels of them, so tests fake
+// the network under peer connections rather than peer connections themselves.
+type PeerFactory interface {
+	NewPeerConnection(configuration webrtc.Configuration) (*webrtc.PeerConnection, error)
+}
+
+// Media is the media (ICE/UDP) stack shared by all peer connections.
+// It's configured independently of the signaling server, so media can use a direct public interface
+// while signaling sits behind a WAF.
+type Media struct {
+	api PeerFactory
+	// mediaEngine and settingEngine of api, subscribers retransmitting from session caches have their own APIs.
+	// mediaEngine is nil if api is not created by NewMedia.
+	mediaEngine   *webrtc.MediaEngine
+	settingEngine webrtc.SettingEngine
+	// udpConn is the socket of UDPPort multiplexing ICE of all peer connections, it's nil if UDPPort is not set.
+	udpConn *net.UDPConn
+	// tcpListener accepts ICE-TCP connections on TCPPort, it's nil if ICE-TCP is disabled.
+	tcpListener *net.TCPListener
+
+	// iceServers are STUN and TURN servers of new peer connections, they are replaced on config reload.
+	iceServers []cfg.ICEServer
+	iceMux     sync.RWMutex
+}
+
+// NewMedia returns a new Media gathering ICE candidates on MediaInterfaces of config, or all interfaces if empty.
+// Media uses UDPPort for all peer connections if set, or ephemeral ports in the range of UDPPortMin and UDPPortMax.
+// Peers fall back to TCPPort if ICE-TCP is enabled. IPv6 host candidates are gathered besides IPv4 ones if IPv6 is set.
+func NewMedia(config cfg.WebRTCConfigOptions, logger *zerolog.Logger) (*Media, error) {
+	m := &webrtc.MediaEngine{}
+	i := &interceptor.Registry{}
+	if err := RegisterMedia(m, i); err != nil {
+		return nil, err
+	}
+	if config.PlayoutDelay {
+		// Subscribers of low-latency sessions are stamped the extension by their own interceptors, see DelayPlayout.
+		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: playoutDelayURI}, webrtc.RTPCodecTypeVideo); err != nil {
+			return nil, fmt.Errorf("could not register header extension %s: %w", playoutDelayURI, err)
+		}
+	}
+
+	s := webrtc.SettingEngine{}
+	if len(config.MediaInterfaces) > 0 {
+		interfaces := make(map[string]bool, len(config.MediaInterfaces))
+		for _, name := range config.MediaInterfaces {
+			if _, err := net.InterfaceByName(name); err != nil {
+				return nil, fmt.Errorf("could not find media interface %s: %w", name, err)
+			}
+			interfaces[name] = true
+		}
+		s.SetInterfaceFilter(func(name string) bool {
+			return interfaces[name]
+		})
+		logger.Info().Strs("interfaces", config.MediaInterfaces).Msg("gathering ICE candidates on media interfaces")
+	}
+	if len(config.NAT1To1IPs) > 0 {
+		// Local candidates of an address family without NAT 1:1 IPs are advertised as they are.
+		for _, ip := range config.NAT1To1IPs {
+			if _, _, err := cfg.ParseNAT1To1IP(ip); err != nil {
+				return nil, err
+			}
+		}
+		s.SetNAT1To1IPs(config.NAT1To1IPs, webrtc.ICECandidateTypeHost)
+		logger.Info().Strs("ips", config.NAT1To1IPs).Msg("advertising NAT 1:1 IPs in host candidates")
+	}
+
+	// Sockets shared by all peer connections are dual-stack unless IPv6 is disabled.
+	udpNetwork, tcpNetwork := "udp", "tcp"
+	networkTypes := []webrtc.NetworkType{webrtc.NetworkTypeUDP4}
+	if config.IPv6 {
+		networkTypes = append(networkTypes, webrtc.NetworkTypeUDP6)
+	} else {
+		udpNetwork, tcpNetwork = "udp4", "tcp4"
+		logger.Info().Msg("gathering IPv4 ICE candidates only")
+	}
+
+	media := &Media{}
+	media.SetICEServers(config)
+	switch {
+	case config.UDPPort != 0:
+		if config.UDPPortMin != 0 || config.UDPPortMax != 0 {
+			return nil, errors.New("UDP port and UDP port range are mutually exclusive")
+		}
+		conn, err := net.ListenUDP(udpNetwork, &net.UDPAddr{Port: config.UDPPort})
+		if err != nil {
+			return nil, fmt.Errorf("could not listen on UDP port %d: %w", config.UDPPort, err)
+		}
+		media.udpConn = conn
+		s.SetICEUDPMux(webrtc.NewICEUDPMux(&pionLogger{logger}, conn))
+		logger.Info().Int("port", config.UDPPort).Msg("multiplexing media on UDP port")
+		if config.IPv6 {
+			// ICE agents advertise a single IPv4 host candidate of the multiplexed port.
+			logger.Warn().Msg("UDP port has no IPv6 host candidates, IPv6-only peers need ephemeral UDP ports or ICE-TCP")
+		}
+	case config.UDPPortMin != 0 || config.UDPPortMax != 0:
+		if config.UDPPortMin == 0 || config.UDPPortMax > 65535 {
+			return nil, fmt.Errorf("invalid UDP port range %d-%d", config.UDPPortMin, config.UDPPortMax)
+		}
+		if err := s.SetEphemeralUDPPortRange(uint16(config.UDPPortMin), uint16(config.UDPPortMax)); err != nil {
+			return nil, fmt.Errorf("invalid UDP port range %d-%d: %w", config.UDPPortMin, config.UDPPortMax, err)
+		}
+		logger.Info().Uint("min", config.UDPPortMin).Uint("max", config.UDPPortMax).Msg("using UDP port range for media")
+	}
+
+	if config.TCPPort != 0 {
+		ln, err := net.ListenTCP(tcpNetwork, &net.TCPAddr{Port: config.TCPPort})
+		if err != nil {
+			_ = media.Close()
+			return nil, fmt.Errorf("could not listen on TCP port %d: %w", config.TCPPort, err)
+		}
+		media.tcpListener = ln
+		s.SetICETCPMux(webrtc.NewICETCPMux(&pionLogger{logger}, ln, iceTCPReadBufferSize))
+		// Passive TCP candidates are gathered besides UDP ones, UDP is preferred by ICE priorities.
+		networkTypes = append(networkTypes, webrtc.NetworkTypeTCP4)
+		if config.IPv6 {
+			networkTypes = append(networkTypes, webrtc.NetworkTypeTCP6)
+		}
+		logger.Info().Int("port", config.TCPPort).Msg("accepting ICE-TCP on TCP port")
+	}
+	s.SetNetworkTypes(networkTypes)
+
+	media.api = webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i), webrtc.WithSettingEngine(s))
+	media.mediaEngine, media.settingEngine = m, s
+	return media, nil
+}
+
+// NewMediaOf returns a new Media creating peer connections by f, e.g. on a virtual network in tests.
+// Media options of config don't apply to them, and NACKs are answered by f's own responder if any,
+// as retransmission from session caches needs interceptors of NewMedia.
+func NewMediaOf(f PeerFactory, config cfg.WebRTCConfigOptions) *Media {
+	media := &Media{api: f}
+	media.SetICEServers(config)
+	return media
+}
+
+// RegisterMedia registers codecs, RTP header extensions and interceptors of peer connections of this server
+// to m and i, e.g. so peers of tests negotiate the same.
+func RegisterMedia(m *webrtc.MediaEngine, i *interceptor.Registry) error {
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return fmt.Errorf("could not register default codecs: %w", err)
+	}
+	if err := registerAV1(m); err != nil {
+		return fmt.Errorf("could not register AV1 codec: %w", err)
+	}
+	// Simulcast layers from edge are told apart by these extensions, and latency is measured by stamped ones.
+	for _, uri := range append(append([]string(nil), simulcastExtensions...), latencyExtensions...) {
+		if err := m.RegisterHeaderExtension(webrtc.RTPHeaderExtensionCapability{URI: uri}, webrtc.RTPCodecTypeVideo); err != nil {
+			return fmt.Errorf("could not register header extension %s: %w", uri, err)
+		}
+	}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		return fmt.Errorf("could not register default interceptors: %w", err)
+	}
+	return nil
+}
+
+// subscriberAPI returns an API of a subscriber peer connection with interceptors of its own. Bytes sent are counted
+// by c if not nil. NACKs are answered by r if not nil instead of the default NACK responder, and video is rewritten
+// across simulcast layer switches by l if not nil. The playout-delay extension is stamped on video by d if not nil.
+// NACK feedback and header extensions are negotiated by the media engine shared with api.
+func (m *Media) subscriberAPI(c *sentCounter, r *retransmitter, l *layerRewriter, d *playoutDelay) (*webrtc.API, error) {
+	// Packets pass through interceptors added later first. Sender reports and the default NACK responder see
+	// rewritten packets, and ones retransmitted by r are rewritten as they are read from caches of layers.
+	i := &interceptor.Registry{}
+	if err := webrtc.ConfigureRTCPReports(i); err != nil {
+		return nil, fmt.Errorf("could not register RTCP reports: %w", err)
+	}
+	if c != nil {
+		// Packets written by any interceptor added afterwards are counted, retransmissions included.
+		i.Add(c)
+	}
+	if r == nil {
+		responder, err := nack.NewResponderInterceptor()
+		if err != nil {
+			return nil, fmt.Errorf("could not create NACK responder: %w", err)
+		}
+		i.Add(responder)
+	}
+	if d != nil {
+		i.Add(d)
+	}
+	if l != nil {
+		i.Add(l)
+	}
+	if r != nil {
+		i.Add(r)
+	}
+	return webrtc.NewAPI(
+		webrtc.WithMediaEngine(m.mediaEngine),
+		webrtc.WithInterceptorRegistry(i),
+		webrtc.WithSettingEngine(m.settingEngine),
+	), nil
+}
+
+// SetICEServers replaces STUN and TURN servers with ICEServer and ICEServers of config. Peer connections created
+// afterwards use them, established ones are kept. Servers minting TURN credentials are not replaced.
+func (m *Media) SetICEServers(config cfg.WebRTCConfigOptions) {
+	servers := make([]cfg.ICEServer, 0, len(config.ICEServers)+1)
+	if config.ICEServer != "" {
+		servers = append(servers, cfg.ICEServer{
+			URL:        config.ICEServer,
+			Username:   config.Username,
+			Credential: config.Credential,
+		})
+	}
+	servers = append(servers, config.ICEServers...)
+
+	m.iceMux.Lock()
+	defer m.iceMux.Unlock()
+	m.iceServers = servers
+}
+
+// ICEServers returns STUN and TURN servers of new peer connections, they must not be modified.
+func (m *Media) ICEServers() []cfg.ICEServer {
+	m.iceMux.RLock()
+	defer m.iceMux.RUnlock()
+	return m.iceServers
+}
+
+// Close closes sockets of UDPPort and TCPPort, it must be called after peer connections are closed.
+func (m *Media) Close() error {
+	var err error
+	if m.udpConn != nil {
+		err = m.udpConn.Close()
+	}
+	if m.tcpListener != nil {
+		if tcpErr := m.tcpListener.Close(); err == nil {
+			err = tcpErr
+		}
+	}
+	return err
+}
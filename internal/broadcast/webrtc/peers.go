@@ -0,0 +1,84 @@
+package webrtc
+
+import (
+	"context"
+	"sync"
+)
+
+// Peers tracks live peer connections, so they can be closed together on shutdown.
+// A peer is removed once its peer connection is closed or failed.
+type Peers struct {
+	mu     sync.Mutex
+	peers  map[*WebRTC]struct{}
+	closed bool
+}
+
+// NewPeers returns a new Peers.
+func NewPeers() *Peers {
+	return &Peers{
+		peers: make(map[*WebRTC]struct{}),
+	}
+}
+
+// Add tracks a peer. The peer is closed immediately if peers are already closed.
+func (p *Peers) Add(w *WebRTC) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		if err := w.Close(); err != nil {
+			w.logger.Err(err).Msg("could not close peer connection")
+		}
+		return
+	}
+	p.peers[w] = struct{}{}
+	p.mu.Unlock()
+
+	go func() {
+		<-w.Done()
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.peers, w)
+	}()
+}
+
+// Len returns count of live peers.
+func (p *Peers) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.peers)
+}
+
+// Close closes all peer connections concurrently,
+// and returns after they are all closed or ctx is done.
+func (p *Peers) Close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	peers := make([]*WebRTC, 0, len(p.peers))
+	for w := range p.peers {
+		peers = append(peers, w)
+	}
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, w := range peers {
+		wg.Add(1)
+		go func(w *WebRTC) {
+			defer wg.Done()
+			if err := w.Close(); err != nil {
+				w.logger.Err(err).Msg("could not close peer connection")
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,70 @@
+package webrtc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// playoutDelayURI is the RTP header extension telling receivers the min and max delay of playing out video,
+// browsers size their jitter buffers within it.
+const playoutDelayURI = "http://www.webrtc.org/experiments/rtp-hdrext/playout-delay"
+
+// playoutDelayUnit is the granularity of delays of the playout-delay extension.
+const playoutDelayUnit = 10 * time.Millisecond
+
+// DelayPlayout asks subscriber to play out video within PlayoutDelayMin and PlayoutDelayMax of config, by the
+// playout-delay extension stamped on its video, e.g. no delay for teleoperation. It does nothing unless
+// PlayoutDelay of config is set, and video is sent as it is if subscriber doesn't negotiate the extension.
+// It must be called before CreateSubscriber.
+func (w *WebRTC) DelayPlayout() {
+	if !w.config.PlayoutDelay {
+		return
+	}
+	w.playout = newPlayoutDelay(w.config.PlayoutDelayMin, w.config.PlayoutDelayMax)
+}
+
+// playoutDelay is an interceptor of a subscriber peer connection stamping the playout-delay extension on its video.
+type playoutDelay struct {
+	interceptor.NoOp
+
+	// payload is the extension of min and max delays, 12 bits each.
+	payload []byte
+}
+
+func newPlayoutDelay(min, max time.Duration) *playoutDelay {
+	lo, hi := uint16(min/playoutDelayUnit), uint16(max/playoutDelayUnit)
+	return &playoutDelay{payload: []byte{byte(lo >> 4), byte(lo<<4) | byte(hi>>8&0x0f), byte(hi)}}
+}
+
+// NewInterceptor returns d itself, it's built once for the peer connection it's created for.
+func (d *playoutDelay) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return d, nil
+}
+
+// BindLocalStream stamps video streams negotiating the extension.
+func (d *playoutDelay) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if !strings.HasPrefix(strings.ToLower(info.MimeType), "video/") {
+		return writer
+	}
+	var id uint8
+	for _, ext := range info.RTPHeaderExtensions {
+		if ext.URI == playoutDelayURI {
+			id = uint8(ext.ID)
+		}
+	}
+	if id == 0 {
+		return writer
+	}
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		// Header is reused by the sender of the track for its next packet, so it's copied along with its extensions.
+		stamped := *header
+		stamped.Extensions = append([]rtp.Extension(nil), header.Extensions...)
+		if err := stamped.SetExtension(id, d.payload); err != nil {
+			return writer.Write(header, payload, attributes)
+		}
+		return writer.Write(&stamped, payload, attributes)
+	})
+}
@@ -0,0 +1,82 @@
+package webrtc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// RestartICE restarts ICE of the subscriber peer connection by a re-offer of subscriber with new ICE credentials,
+// e.g. after subscriber switched from Wi-Fi to cellular, and returns the answer. Tracks and forwarding state
+// are kept, so media resumes once ICE reconnects without subscribing again. Candidates of subscriber for the
+// new credentials are added from candidates, which replaces the queue of the former negotiation.
+// ICE must be restarted before it fails, as a failed peer connection is closed.
+func (w *WebRTC) RestartICE(
+	ctx context.Context,
+	offer *webrtc.SessionDescription,
+	candidates *CandidateQueue,
+) (*webrtc.SessionDescription, error) {
+	peerConnection, err := w.livePeerConnection()
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, signalErr(ctx)
+	}
+	if err := peerConnection.SetRemoteDescription(*offer); err != nil {
+		return nil, fmt.Errorf("could not set remote description: %w", err)
+	}
+	go w.addICECandidates(peerConnection, candidates)
+
+	answer, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not create answer: %w", err)
+	}
+	return w.setLocalDescription(ctx, peerConnection, answer)
+}
+
+// OfferICERestart creates an offer with new ICE credentials on the subscriber peer connection, for subscribers
+// asking server to restart ICE. The answer of subscriber is set by AcceptICERestart.
+func (w *WebRTC) OfferICERestart(ctx context.Context) (*webrtc.SessionDescription, error) {
+	peerConnection, err := w.livePeerConnection()
+	if err != nil {
+		return nil, err
+	}
+	if ctx.Err() != nil {
+		return nil, signalErr(ctx)
+	}
+	offer, err := peerConnection.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+	if err != nil {
+		return nil, fmt.Errorf("could not create offer: %w", err)
+	}
+	return w.setLocalDescription(ctx, peerConnection, offer)
+}
+
+// AcceptICERestart sets answer of subscriber to the offer of OfferICERestart, candidates are as of RestartICE.
+func (w *WebRTC) AcceptICERestart(answer *webrtc.SessionDescription, candidates *CandidateQueue) error {
+	peerConnection, err := w.livePeerConnection()
+	if err != nil {
+		return err
+	}
+	if err := peerConnection.SetRemoteDescription(*answer); err != nil {
+		return fmt.Errorf("could not set remote description: %w", err)
+	}
+	go w.addICECandidates(peerConnection, candidates)
+	return nil
+}
+
+// livePeerConnection returns the peer connection, or ErrPeerClosed if it's not created yet, closed or failed.
+func (w *WebRTC) livePeerConnection() (*webrtc.PeerConnection, error) {
+	select {
+	case <-w.done:
+		return nil, ErrPeerClosed
+	default:
+	}
+	w.peerMux.Lock()
+	defer w.peerMux.Unlock()
+	if w.closed || w.peerConnection == nil {
+		return nil, ErrPeerClosed
+	}
+	return w.peerConnection, nil
+}
@@ -0,0 +1,152 @@
+package webrtc
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// retransmitter is an interceptor of a subscriber peer connection answering its NACKs of video with packets
+// cached by the session, instead of the default NACK responder buffering packets per subscriber.
+// Packets are retransmitted as they are on the original SSRC, as RTX needs a separate SSRC signaled
+// for senders, which pion doesn't negotiate; browsers repair loss by them the same.
+type retransmitter struct {
+	interceptor.NoOp
+
+	// cache returns the cache of the video track currently sent, which may be replaced by another simulcast layer.
+	cache func() *session.PacketCache
+	// layers rewrites video across simulcast layer switches, NACKed sequence numbers are mapped to ones of
+	// the current layer by it. It's nil if video isn't rewritten.
+	layers *layerRewriter
+
+	mu      sync.Mutex
+	streams map[uint32]*retransmitStream
+}
+
+// retransmitStream is a local video stream of subscriber accepting NACKs.
+type retransmitStream struct {
+	writer      interceptor.RTPWriter
+	payloadType uint8
+}
+
+// NewInterceptor returns r itself, it's built once for the peer connection it's created for.
+func (r *retransmitter) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return r, nil
+}
+
+// BindLocalStream records video streams negotiating NACKs, so they are retransmitted to.
+func (r *retransmitter) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if !strings.HasPrefix(strings.ToLower(info.MimeType), "video/") || !acceptsNACK(info.RTCPFeedback) {
+		return writer
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streams[info.SSRC] = &retransmitStream{writer: writer, payloadType: info.PayloadType}
+	return writer
+}
+
+// UnbindLocalStream stops retransmitting to the stream.
+func (r *retransmitter) UnbindLocalStream(info *interceptor.StreamInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.streams, info.SSRC)
+}
+
+// BindRTCPReader answers NACKs read from subscriber.
+func (r *retransmitter) BindRTCPReader(reader interceptor.RTCPReader) interceptor.RTCPReader {
+	return interceptor.RTCPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, attr, err := reader.Read(b, a)
+		if err != nil {
+			return n, attr, err
+		}
+		packets, err := rtcp.Unmarshal(b[:n])
+		if err != nil {
+			return n, attr, nil
+		}
+		for _, packet := range packets {
+			if nack, ok := packet.(*rtcp.TransportLayerNack); ok {
+				go r.resend(nack)
+			}
+		}
+		return n, attr, nil
+	})
+}
+
+// resend retransmits packets of nack found in cache.
+func (r *retransmitter) resend(nack *rtcp.TransportLayerNack) {
+	r.mu.Lock()
+	stream, ok := r.streams[nack.MediaSSRC]
+	r.mu.Unlock()
+	cache := r.cache()
+	if !ok || cache == nil {
+		return
+	}
+	rewriter := r.layers.stream(nack.MediaSSRC)
+	for _, pair := range nack.Nacks {
+		for _, seq := range pair.PacketList() {
+			if rewriter != nil {
+				var ok bool
+				if seq, ok = rewriter.Source(seq); !ok {
+					// Packets of former layers are gone with their caches.
+					metrics.Retransmissions.WithLabelValues("missed").Inc()
+					continue
+				}
+			}
+			var packet rtp.Packet
+			if b := cache.Get(seq); b == nil || packet.Unmarshal(b) != nil {
+				metrics.Retransmissions.WithLabelValues("missed").Inc()
+				continue
+			}
+			packet.SSRC, packet.PayloadType = nack.MediaSSRC, stream.payloadType
+			if _, err := stream.writer.Write(&packet.Header, packet.Payload, interceptor.Attributes{}); err != nil {
+				return
+			}
+			metrics.Retransmissions.WithLabelValues("sent").Inc()
+		}
+	}
+}
+
+// acceptsNACK reports whether feedback of a stream includes generic NACK.
+func acceptsNACK(feedback []interceptor.RTCPFeedback) bool {
+	for _, fb := range feedback {
+		if fb.Type == "nack" && fb.Parameter == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Retransmit answers NACKs of the subscriber with packets cached by caches of video tracks,
+// e.g. Session.PacketCache, instead of buffering packets per subscriber. It must be called before CreateSubscriber.
+func (w *WebRTC) Retransmit(caches func(track webrtc.TrackLocal) *session.PacketCache) {
+	w.packetCaches = caches
+}
+
+// CacheVideo caches packets of the default video from edge into cache for retransmission, simulcast layers are
+// cached into caches of layers. It must be called before CreatePublisher.
+func (w *WebRTC) CacheVideo(cache *session.PacketCache) {
+	w.videoCache = cache
+}
+
+// videoPacketCache returns the cache of the video track currently sent to subscriber, nil if none.
+func (w *WebRTC) videoPacketCache() *session.PacketCache {
+	w.peerMux.Lock()
+	peerConnection := w.peerConnection
+	w.peerMux.Unlock()
+	if peerConnection == nil {
+		return nil
+	}
+	for _, sender := range peerConnection.GetSenders() {
+		if t := sender.Track(); t != nil && t.Kind() == webrtc.RTPCodecTypeVideo {
+			return w.packetCaches(t)
+		}
+	}
+	return nil
+}
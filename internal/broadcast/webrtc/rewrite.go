@@ -0,0 +1,73 @@
+package webrtc
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// RewriteRTP rewrites packets from edge by the rewriter of rewriters of their track, identified by kind and RID,
+// before they are observed, cached and forwarded, so subscribers see a continuous stream once edge restarts
+// publishing the session by another peer connection. It must be called before CreatePublisher.
+func (w *WebRTC) RewriteRTP(rewriters func(kind webrtc.RTPCodecType, rid string) *session.Rewriter) {
+	w.rewriters = rewriters
+}
+
+// RewriteLayers rewrites sequence numbers and timestamps of video sent to subscriber, so it sees a continuous stream
+// once ReplaceVideoTrack switches simulcast layers, which are numbered independently. Otherwise the subscriber
+// drops packets as out of order until it resyncs. It must be called before CreateSubscriber.
+func (w *WebRTC) RewriteLayers() {
+	w.layers = &layerRewriter{streams: make(map[uint32]*session.Rewriter)}
+}
+
+// layerRewriter is an interceptor of a subscriber peer connection rewriting its video streams by their SSRCs.
+type layerRewriter struct {
+	interceptor.NoOp
+
+	mu      sync.Mutex
+	streams map[uint32]*session.Rewriter
+}
+
+// NewInterceptor returns l itself, it's built once for the peer connection it's created for.
+func (l *layerRewriter) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return l, nil
+}
+
+// BindLocalStream rewrites video streams.
+func (l *layerRewriter) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if !strings.HasPrefix(strings.ToLower(info.MimeType), "video/") {
+		return writer
+	}
+	rewriter := session.NewRewriter(info.ClockRate)
+	l.mu.Lock()
+	l.streams[info.SSRC] = rewriter
+	l.mu.Unlock()
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		// Header is reused by the sender of the track for its next packet, so it's copied rather than rewritten.
+		rewritten := *header
+		rewriter.RewriteHeader(&rewritten)
+		return writer.Write(&rewritten, payload, attributes)
+	})
+}
+
+// UnbindLocalStream stops rewriting the stream.
+func (l *layerRewriter) UnbindLocalStream(info *interceptor.StreamInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.streams, info.SSRC)
+}
+
+// stream returns the rewriter of the stream of ssrc, nil if it's not rewritten. A nil layerRewriter has none.
+func (l *layerRewriter) stream(ssrc uint32) *session.Rewriter {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.streams[ssrc]
+}
@@ -0,0 +1,81 @@
+package webrtc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/randutil"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+)
+
+// simulcastExtensions are RTP header extensions identifying simulcast streams, see RFC 8852.
+var simulcastExtensions = []string{
+	"urn:ietf:params:rtp-hdrext:sdes:mid",
+	"urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id",
+	"urn:ietf:params:rtp-hdrext:sdes:repaired-rtp-stream-id",
+}
+
+// ErrNoVideoTrack is returned if a subscriber peer connection sends no video track.
+var ErrNoVideoTrack = errors.New("no video track of peer connection")
+
+// SimulcastRIDs returns RIDs of simulcast video streams sent by offer, in order offered, see RFC 8853.
+// It's empty if offer doesn't send simulcast video.
+func SimulcastRIDs(offer *webrtc.SessionDescription) []string {
+	var (
+		rids  []string
+		video bool
+	)
+	for _, line := range strings.Split(offer.SDP, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "m=") {
+			video = strings.HasPrefix(line, "m=video")
+			continue
+		}
+		if !video || !strings.HasPrefix(line, "a=rid:") {
+			continue
+		}
+		// a=rid:<rid-id> <direction> [<rid-params>]
+		fields := strings.Fields(strings.TrimPrefix(line, "a=rid:"))
+		if len(fields) >= 2 && fields[1] == "send" {
+			rids = append(rids, fields[0])
+		}
+	}
+	return rids
+}
+
+// CreateLayerTrack creates a video track of a simulcast layer along with videoTrack of CreateLocalTrack.
+// They share the same stream ID so that the layer is played synchronously with audio.
+func CreateLayerTrack(videoTrack *session.Track) (*session.Track, error) {
+	return session.NewTrack(
+		videoTrack.Codec(),
+		fmt.Sprintf("video-%d", randutil.NewMathRandomGenerator().Uint32()),
+		videoTrack.StreamID(),
+	)
+}
+
+// ReplaceVideoTrack replaces the video track sent to subscriber without renegotiation, e.g. to switch
+// simulcast layers. Sequence numbers and timestamps of layers are independent, so they are rewritten to continue
+// the former track if RewriteLayers is called, otherwise the subscriber resyncs at the next keyframe of the new track.
+func (w *WebRTC) ReplaceVideoTrack(track *session.Track) error {
+	w.peerMux.Lock()
+	peerConnection, closed := w.peerConnection, w.closed
+	w.peerMux.Unlock()
+	if closed || peerConnection == nil {
+		return ErrPeerClosed
+	}
+
+	for _, sender := range peerConnection.GetSenders() {
+		if t := sender.Track(); t != nil && t.Kind() == webrtc.RTPCodecTypeVideo {
+			if params := sender.GetParameters(); len(params.Encodings) > 0 {
+				if rewriter := w.layers.stream(uint32(params.Encodings[0].SSRC)); rewriter != nil {
+					rewriter.Switch()
+				}
+			}
+			return sender.ReplaceTrack(track)
+		}
+	}
+	return ErrNoVideoTrack
+}
@@ -0,0 +1,123 @@
+package webrtc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// Clock rates of RTP timestamps of H264 and Opus tracks, used to convert jitter into time.
+	videoClockRate = 90000
+	audioClockRate = 48000
+
+	// ntpEpochOffset is seconds between NTP epoch 1900 and Unix epoch 1970.
+	ntpEpochOffset = 2208988800
+)
+
+// Stats is statistics of a subscriber peer connection, derived from RTCP feedback sent by the subscriber and
+// packets sent to it.
+type Stats struct {
+	Video TrackStats `json:"video"`
+	Audio TrackStats `json:"audio"`
+
+	// EstimatedBitrate is the latest bandwidth estimation of subscriber by REMB in bits per second,
+	// zero if subscriber doesn't send REMB.
+	EstimatedBitrate uint64 `json:"estimated_bitrate"`
+	// RTT is the latest round trip time in milliseconds computed from receiver reports.
+	RTT int64 `json:"rtt_ms"`
+	// UpdatedAt is when the latest RTCP feedback is received, nil if none is received yet.
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+// TrackStats is statistics of a track forwarded to subscriber.
+type TrackStats struct {
+	PacketsLost  uint32  `json:"packets_lost"`  // Cumulative packets lost reported by subscriber.
+	FractionLost float64 `json:"fraction_lost"` // Ratio of packets lost since the previous receiver report.
+	Jitter       float64 `json:"jitter_ms"`     // Interarrival jitter in milliseconds.
+	NACKs        uint32  `json:"nacks"`         // Count of NACK packets received.
+	PLIs         uint32  `json:"plis"`          // Count of PLI packets received.
+	BytesSent    uint64  `json:"bytes_sent"`    // RTP bytes sent to subscriber, including retransmissions.
+}
+
+// statsRecorder records RTCP feedback of a peer connection into Stats.
+type statsRecorder struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Stats returns a snapshot of statistics of the subscriber peer connection.
+func (w *WebRTC) Stats() Stats {
+	w.stats.mu.Lock()
+	stats := w.stats.stats
+	w.stats.mu.Unlock()
+	w.sendersMux.Lock()
+	if w.sent != nil {
+		stats.Video.BytesSent, stats.Audio.BytesSent = w.sent.kinds()
+	}
+	w.sendersMux.Unlock()
+	return stats
+}
+
+// record records RTCP packets received at now of the track of kind, sent with ssrc.
+// A compound packet may carry feedback of other tracks, which is skipped.
+func (r *statsRecorder) record(kind webrtc.RTPCodecType, ssrc uint32, packets []rtcp.Packet, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	track, clockRate := &r.stats.Video, float64(videoClockRate)
+	if kind == webrtc.RTPCodecTypeAudio {
+		track, clockRate = &r.stats.Audio, float64(audioClockRate)
+	}
+	for _, packet := range packets {
+		switch p := packet.(type) {
+		case *rtcp.ReceiverReport:
+			for _, report := range p.Reports {
+				if report.SSRC != ssrc {
+					continue
+				}
+				track.PacketsLost = report.TotalLost
+				track.FractionLost = float64(report.FractionLost) / 256
+				track.Jitter = float64(report.Jitter) / clockRate * 1000
+				if rtt, ok := roundTripTime(report, now); ok {
+					r.stats.RTT = rtt.Milliseconds()
+				}
+			}
+		case *rtcp.ReceiverEstimatedMaximumBitrate:
+			r.stats.EstimatedBitrate = uint64(p.Bitrate)
+		case *rtcp.TransportLayerNack:
+			if p.MediaSSRC != ssrc {
+				continue
+			}
+			track.NACKs++
+		case *rtcp.PictureLossIndication:
+			if p.MediaSSRC != ssrc {
+				continue
+			}
+			track.PLIs++
+		default:
+			continue
+		}
+		r.stats.UpdatedAt = &now
+	}
+}
+
+// roundTripTime computes round trip time of a reception report received at now, see RFC 3550 section 6.4.1.
+// It reports false if no sender report is received by subscriber yet.
+func roundTripTime(report rtcp.ReceptionReport, now time.Time) (time.Duration, bool) {
+	if report.LastSenderReport == 0 {
+		return 0, false
+	}
+	// Middle 32 bits of NTP timestamp of now, in units of 1/65536 seconds.
+	seconds := uint64(now.Unix() + ntpEpochOffset)
+	fraction := uint64(now.Nanosecond()) << 32 / uint64(time.Second)
+	compact := uint32((seconds<<32 | fraction) >> 16)
+
+	rtt := compact - report.LastSenderReport - report.Delay
+	if rtt > 1<<31 { // Clock skew of subscriber or a stale report.
+		return 0, false
+	}
+	return time.Duration(uint64(rtt) * uint64(time.Second) >> 16), true
+}
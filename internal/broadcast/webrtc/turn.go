@@ -0,0 +1,22 @@
+package webrtc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// TURNCredential mints a time-limited TURN credential for user with shared secret,
+// compatible with "use-auth-secret" mode of coturn.
+// See: https://datatracker.ietf.org/doc/html/draft-uberti-behave-turn-rest-00
+func TURNCredential(secret, user string, ttl time.Duration, now time.Time) (username, credential string) {
+	username = strconv.FormatInt(now.Add(ttl).Unix(), 10)
+	if user != "" {
+		username += ":" + user
+	}
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -1,9 +1,12 @@
 package webrtc
 
 import (
+	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,150 +16,609 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/metrics"
+	"github.com/SB-IM/skywalker/internal/broadcast/session"
+	"github.com/SB-IM/skywalker/internal/broadcast/tracing"
 )
 
 // SendCandidateFunc sends a candidate to remote webRTC peer.
 type SendCandidateFunc func(candidate *webrtc.ICECandidate) error
 
-// RecvCandidateFunc receives a candidate from remote webRTC peer.
-type RecvCandidateFunc func() <-chan string
+// RecvCandidateFunc returns the queue of candidates from remote webRTC peer, it's called once per peer connection.
+type RecvCandidateFunc func() *CandidateQueue
 
 // RegisterSessionFunc registers a edge WebRTC session. Only used for publisher.
 // For subscriber, it should use NoopRegisterSessionFunc instead.
 type RegisterSessionFunc func()
 
+// UnregisterSessionFunc unregisters a edge WebRTC session after its peer connection is gone. Only used for publisher.
+// For subscriber, it should use NoopUnregisterSessionFunc instead.
+type UnregisterSessionFunc func()
+
 // HookStreamFunc hooks the stream seeding source on peer connection established.
 type HookStreamFunc func(iceConnectionStat webrtc.ICEConnectionState)
 
+// TrackSink receives RTP packets forwarded from a publisher, *session.Track fanning them out
+// to subscribers is one. Having no subscribers isn't an error.
+type TrackSink interface {
+	Forward(b []byte) error
+}
+
 const (
 	rtcpPLIInterval = time.Second * 3
+	// keyframeRequestInterval is the min interval of PLIs relayed from subscribers, requests within it are dropped,
+	// as the keyframe of the last one is on its way.
+	keyframeRequestInterval = time.Millisecond * 500
+
+	// rtpHeaderSize is size of fixed RTP header, see RFC 3550 section 5.1.
+	rtpHeaderSize = 12
+
+	// turnUser is user of TURN credentials minted for peer connections of this server.
+	turnUser = "skywalker"
 )
 
 type WebRTC struct {
 	logger zerolog.Logger
 	config cfg.WebRTCConfigOptions
-
-	// SignalChan is a bi-direction channel.
-	SignalChan chan *webrtc.SessionDescription
+	media  *Media
 
 	pendingCandidates []*webrtc.ICECandidate
+	answered          bool // Whether the answer has been sent, candidates gathered before are pending.
+	gathered          bool // Whether ICE gathering has completed.
 	candidatesMux     sync.Mutex
+	// onEndOfCandidates is called once all local candidates are sent, it's nil if remote peer isn't told.
+	onEndOfCandidates func()
+	// vanilla disables trickle ICE, candidates gathered after the answer are dropped as remote peer can't receive them.
+	vanilla bool
 
 	sendCandidate SendCandidateFunc
 	recvCandidate RecvCandidateFunc
+	// filterCandidate drops a candidate of remote peer if it returns an error, it's nil if all are added.
+	filterCandidate func(candidate string) error
 
-	registerSession RegisterSessionFunc
+	registerSession   RegisterSessionFunc
+	unregisterSession UnregisterSessionFunc
 
 	hookStream HookStreamFunc
+
+	peerConnection *webrtc.PeerConnection
+	closed         bool
+	peerMux        sync.Mutex
+	done           chan struct{}
+	doneOnce       sync.Once
+	connected      chan struct{}
+	connectedOnce  sync.Once
+
+	onFirstMedia   func()
+	firstMediaOnce sync.Once
+
+	// onICEConnectionState is called with every ICE connection state of peer connection, it's nil if not set.
+	onICEConnectionState func(state webrtc.ICEConnectionState)
+
+	// onKeyframeRequest is called with the video track of subscriber once it joins or reports loss.
+	onKeyframeRequest func(track webrtc.TrackLocal)
+
+	// telemetry is relayed over telemetry data channel, it's nil if not relayed.
+	telemetry *session.Telemetry
+	// codecs are codecs negotiated of publisher, it's nil for defaults.
+	codecs *Codecs
+	// latency measures delays of video stamped by edge of publisher, it's nil if not measured.
+	latency *session.Latency
+	// videoCache caches default video from edge of publisher for retransmission, it's nil if not cached.
+	videoCache *session.PacketCache
+	// packetCaches return caches of video tracks retransmitted to subscriber, it's nil if retransmitted
+	// by the default NACK responder.
+	packetCaches func(track webrtc.TrackLocal) *session.PacketCache
+
+	// rewriters return rewriters of tracks of publisher, it's nil if packets are forwarded as they are.
+	rewriters func(kind webrtc.RTPCodecType, rid string) *session.Rewriter
+	// layers rewrites video of subscriber across simulcast layer switches, it's nil if not rewritten.
+	layers *layerRewriter
+	// playout stamps the playout-delay extension on video of subscriber, it's nil if not stamped.
+	playout *playoutDelay
+	// sent counts bytes sent to subscriber, it's nil for publishers.
+	sent *sentCounter
+	// senders are SSRCs of senders of tracks added to subscriber.
+	senders    map[*session.Track]uint32
+	sendersMux sync.Mutex
+
+	// stats records RTCP feedback of subscriber.
+	stats statsRecorder
+	// bundle are tracks of more streams sent to subscriber along with the ones of CreateSubscriber.
+	bundle []*session.Track
+}
+
+var (
+	// ErrSignalTimeout is returned if offer/answer exchange isn't done before deadline of context.
+	ErrSignalTimeout = errors.New("webRTC signaling timed out")
+	// ErrPeerClosed is returned if the peer connection is closed or failed during signaling,
+	// or it's created after WebRTC is closed.
+	ErrPeerClosed = errors.New("webRTC peer connection is closed")
+)
+
+// SignalContext returns a copy of ctx with SignalTimeout of config as deadline of offer/answer exchange.
+// A non-positive timeout means no deadline.
+func SignalContext(ctx context.Context, config cfg.WebRTCConfigOptions) (context.Context, context.CancelFunc) {
+	if config.SignalTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, config.SignalTimeout)
+}
+
+// signalErr returns error of ctx, deadline exceeded is reported as ErrSignalTimeout.
+func signalErr(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrSignalTimeout
+	}
+	return ctx.Err()
 }
 
 // New returns a new WebRTC.
 func New(
+	media *Media,
 	config cfg.WebRTCConfigOptions,
 	logger *zerolog.Logger,
 	sendCandidate SendCandidateFunc,
 	recvCandidate RecvCandidateFunc,
 	registerSession RegisterSessionFunc,
+	unregisterSession UnregisterSessionFunc,
 	hookStream HookStreamFunc,
 ) *WebRTC {
 	return &WebRTC{
-		logger:          *logger,
-		config:          config,
-		SignalChan:      make(chan *webrtc.SessionDescription, 1), // Make 1 buffer so SDP signaling never blocks
-		sendCandidate:   sendCandidate,
-		recvCandidate:   recvCandidate,
-		registerSession: registerSession,
-		hookStream:      hookStream,
+		logger:            *logger,
+		config:            config,
+		media:             media,
+		sendCandidate:     sendCandidate,
+		recvCandidate:     recvCandidate,
+		registerSession:   registerSession,
+		unregisterSession: unregisterSession,
+		hookStream:        hookStream,
+		done:              make(chan struct{}),
+		connected:         make(chan struct{}),
 	}
 }
 
-// CreateLocalTrack creates a TrackLocalStaticRTP and is only used by publisher.
-func CreateLocalTrack() (*webrtc.TrackLocalStaticRTP, error) {
-	return webrtc.NewTrackLocalStaticRTP(
-		webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264},
+// Close closes the peer connection, and any peer connection created afterwards fails.
+func (w *WebRTC) Close() error {
+	w.peerMux.Lock()
+	w.closed = true
+	peerConnection := w.peerConnection
+	w.peerMux.Unlock()
+
+	defer w.finish()
+	return closePeerConnection(peerConnection)
+}
+
+// Done returns a channel closed after the peer connection is closed or failed.
+func (w *WebRTC) Done() <-chan struct{} {
+	return w.done
+}
+
+// Connected returns a channel closed once ICE of the peer connection is connected for the first time.
+func (w *WebRTC) Connected() <-chan struct{} {
+	return w.connected
+}
+
+func (w *WebRTC) finish() {
+	w.doneOnce.Do(func() {
+		close(w.done)
+	})
+}
+
+// OnFirstMedia sets a handler called once the subscriber reports receiving media with an RTCP receiver report.
+// It must be called before CreateSubscriber.
+func (w *WebRTC) OnFirstMedia(f func()) {
+	w.onFirstMedia = f
+}
+
+// OnICEConnectionState sets a handler called with every ICE connection state of the peer connection once it changes,
+// e.g. to report it to remote peer. It must be called before CreatePublisher or CreateSubscriber.
+func (w *WebRTC) OnICEConnectionState(f func(state webrtc.ICEConnectionState)) {
+	w.onICEConnectionState = f
+}
+
+// OnEndOfCandidates sets a handler called once ICE gathering has completed and all local candidates are sent,
+// so remote peer can be told of end-of-candidates. It must be called before CreatePublisher or CreateSubscriber.
+func (w *WebRTC) OnEndOfCandidates(f func()) {
+	w.onEndOfCandidates = f
+}
+
+// DisableTrickle disables trickle ICE for remote peers which can't receive candidates after the answer,
+// i.e. vanilla ICE. The answer is sent once ICE gathering completes or ICEGatheringTimeout expires as if
+// WaitICEGathering is enabled, and candidates gathered afterwards are dropped.
+// It must be called before CreatePublisher or CreateSubscriber.
+func (w *WebRTC) DisableTrickle() {
+	w.vanilla = true
+}
+
+// endOfCandidates calls onEndOfCandidates if set, w.candidatesMux must be held.
+func (w *WebRTC) endOfCandidates() {
+	if w.onEndOfCandidates != nil && !w.vanilla {
+		w.onEndOfCandidates()
+	}
+}
+
+// FilterCandidates sets a filter of candidates of remote peer, a candidate is dropped if f returns an error.
+// It must be called before CreatePublisher or CreateSubscriber.
+func (w *WebRTC) FilterCandidates(f func(candidate string) error) {
+	w.filterCandidate = f
+}
+
+// OnKeyframeRequest sets a handler called with the video track sent to the subscriber once it starts sending RTCP,
+// i.e. joined, and whenever it sends a PLI or FIR, so edge is asked for a keyframe at once.
+// It must be called before CreateSubscriber.
+func (w *WebRTC) OnKeyframeRequest(f func(track webrtc.TrackLocal)) {
+	w.onKeyframeRequest = f
+}
+
+// RelayTelemetry relays telemetry over the telemetry data channel, from edge of a publisher,
+// or to client of a subscriber if it offers the data channel. It must be called before CreatePublisher
+// or CreateSubscriber.
+func (w *WebRTC) RelayTelemetry(telemetry *session.Telemetry) {
+	w.telemetry = telemetry
+}
+
+// PreferCodecs answers edge with codecs negotiated by configured ones, see NegotiateCodecs.
+// It must be called before CreatePublisher.
+func (w *WebRTC) PreferCodecs(codecs *Codecs) {
+	w.codecs = codecs
+}
+
+// MeasureLatency measures delays of the default video from edge into latency, if edge stamps packets with
+// abs-capture-time or abs-send-time. It must be called before CreatePublisher.
+func (w *WebRTC) MeasureLatency(latency *session.Latency) {
+	w.latency = latency
+}
+
+// preferCodecs sets codecs of kind negotiated as the only ones of transceiver.
+func (w *WebRTC) preferCodecs(transceiver *webrtc.RTPTransceiver, kind webrtc.RTPCodecType) error {
+	if w.codecs == nil {
+		return nil
+	}
+	var preferred []webrtc.RTPCodecParameters
+	for _, c := range w.codecs.preferred {
+		if strings.HasPrefix(strings.ToLower(c.MimeType), kind.String()+"/") {
+			preferred = append(preferred, webrtc.RTPCodecParameters{RTPCodecCapability: c})
+		}
+	}
+	if len(preferred) == 0 {
+		return nil
+	}
+	if err := transceiver.SetCodecPreferences(preferred); err != nil {
+		return fmt.Errorf("could not prefer %s codecs: %w", kind, err)
+	}
+	return nil
+}
+
+// CreateLocalTrack creates a pair of video and audio tracks of codecs fanning out to subscribers, and is only used by publisher.
+// Both tracks share the same stream ID so that they are played synchronously by subscribers.
+func CreateLocalTrack(codecs *Codecs) (videoTrack, audioTrack *session.Track, err error) {
+	streamID := fmt.Sprintf("broadcast-%d", randutil.NewMathRandomGenerator().Uint32())
+
+	videoTrack, err = session.NewTrack(
+		codecs.Video,
 		fmt.Sprintf("video-%d", randutil.NewMathRandomGenerator().Uint32()),
-		fmt.Sprintf("broadcast-%d", randutil.NewMathRandomGenerator().Uint32()),
+		streamID,
 	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create video track: %w", err)
+	}
+
+	audioTrack, err = session.NewTrack(
+		codecs.Audio,
+		fmt.Sprintf("audio-%d", randutil.NewMathRandomGenerator().Uint32()),
+		streamID,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create audio track: %w", err)
+	}
+
+	return videoTrack, audioTrack, nil
 }
 
-// CreatePublisher creates a webRTC publisher peer.
-// Caller must send offer first by OfferChan or this function blocks waiting for receiving offer forever.
-func (w *WebRTC) CreatePublisher(videoTrack *webrtc.TrackLocalStaticRTP) error {
+// CreatePublisher creates a webRTC publisher peer of offer, and returns the answer.
+// Offer/answer exchange must be done before ctx is done, or the peer connection is closed.
+// Incoming stream is measured by bitrate, RTP timestamps and sequence numbers of incoming video are observed
+// by clock and quality, and delays of it by latency if set, see MeasureLatency.
+// If edge offers simulcast, each layer is forwarded to its track in layers, and only the one of videoTrack
+// is observed. Default video and audio are copied to taps. Video and audio are forwarded to videoTrack and
+// audioTrack, which are the tracks of the session, or sinks recording packets in tests.
+// A PLI is sent to edge on each request of keyframes of videoTrack, or of the layer if simulcast.
+// Packets out of order are reordered within JitterBuffer of config before all of the above if it's positive.
+func (w *WebRTC) CreatePublisher(
+	ctx context.Context,
+	offer *webrtc.SessionDescription,
+	videoTrack, audioTrack TrackSink,
+	keyframes <-chan struct{},
+	layers *session.Layers,
+	bitrate *session.Meter,
+	clock *session.Clock,
+	quality *session.Quality,
+	taps *session.Taps,
+) (*webrtc.SessionDescription, error) {
 	peerConnection, err := w.newPeerConnection()
 	if err != nil {
-		return fmt.Errorf("could not create PeerConnection: %w", err)
+		return nil, fmt.Errorf("could not create PeerConnection: %w", err)
 	}
 
-	// Allow us to receive 1 video track
-	if _, err = peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo); err != nil {
-		return fmt.Errorf("could not add tranceiver from kind: %w", err)
+	// Allow us to receive 1 video track and 1 audio track.
+	// Audio is optional, it's simply not negotiated if edge doesn't offer it.
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		transceiver, err := peerConnection.AddTransceiverFromKind(kind)
+		if err != nil {
+			return nil, w.abort(fmt.Errorf("could not add %s tranceiver from kind: %w", kind, err))
+		}
+		if err := w.preferCodecs(transceiver, kind); err != nil {
+			return nil, w.abort(err)
+		}
 	}
 
 	// Set a handler for when a new remote track starts, this just distributes all our packets
 	// to connected peers
-	peerConnection.OnTrack(func(t *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
-		go w.sendRTCP(peerConnection, t)
+	peerConnection.OnTrack(func(t *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
+		logger := w.logger.With().Str("kind", t.Kind().String()).Str("rid", t.RID()).Logger()
+		localTrack := audioTrack
+		isVideo := t.Kind() == webrtc.RTPCodecTypeVideo
+		var (
+			layerBitrate *session.Meter
+			cache        *session.PacketCache
+		)
+		if isVideo {
+			cache = w.videoCache
+			keyframes := keyframes
+			localTrack = videoTrack
+			if t.RID() != "" {
+				layer, ok := layers.Get(t.RID())
+				if !ok {
+					logger.Warn().Msg("received simulcast layer not offered")
+					return
+				}
+				localTrack = layer.Track
+				keyframes = layer.Keyframes()
+				layerBitrate = layer.Bitrate
+				cache = layer.Cache
+			}
+			// Keyframes are only meaningful to video.
+			go w.sendRTCP(peerConnection, t, keyframes)
+		}
+		var rewriter *session.Rewriter
+		if w.rewriters != nil {
+			rewriter = w.rewriters(t.Kind(), t.RID())
+		}
+		// Layers other than the default one would disturb sequence and timestamp observation.
+		observed := isVideo && localTrack == videoTrack
+		tapped := observed || !isVideo
+		var stamp stampFunc
+		if observed && w.latency != nil {
+			stamp = newStampFunc(receiver)
+		}
+		logger.Info().Str("codec", t.Codec().MimeType).Msg("received remote track")
+
+		forward := func(packet []byte) error {
+			i := len(packet)
+			if rewriter != nil {
+				rewriter.Rewrite(packet)
+			}
+			bitrate.Add(i)
+			if layerBitrate != nil {
+				layerBitrate.Add(i)
+			}
+			if observed && i >= rtpHeaderSize {
+				quality.Observe(binary.BigEndian.Uint16(packet[2:4]))
+				clock.Observe(binary.BigEndian.Uint32(packet[4:8]))
+			}
+			if stamp != nil {
+				now := time.Now()
+				if sentAt, ok := stamp(packet, now); ok {
+					w.latency.Observe(sentAt, now)
+				}
+			}
+			if tapped {
+				taps.Write(t.Kind(), packet)
+			}
+			cache.Put(packet)
+			// No subscriber is ok if no peers have connected yet.
+			return localTrack.Forward(packet)
+		}
+		var jitter *jitterBuffer
+		if w.config.JitterBuffer > 0 {
+			jitter = newJitterBuffer(w.config.JitterBuffer, t.Kind().String())
+		}
 		rtpBuf := make([]byte, 1400)
 		for {
 			i, _, readErr := t.Read(rtpBuf)
 			if readErr != nil {
-				w.logger.Err(err).Msg("could not read buffer")
+				logger.Err(readErr).Msg("could not read buffer")
 				return
 			}
-			// ErrClosedPipe means we don't have any subscribers, this is ok if no peers have connected yet
-			if _, err = videoTrack.Write(rtpBuf[:i]); err != nil && !errors.Is(err, io.ErrClosedPipe) {
-				w.logger.Err(err).Msg("could not write video track")
+			var err error
+			if jitter != nil {
+				err = jitter.push(rtpBuf[:i], time.Now(), forward)
+			} else {
+				err = forward(rtpBuf[:i])
+			}
+			if err != nil {
+				logger.Err(err).Msg("could not write local track")
 				return
 			}
 		}
 	})
 
-	if err := w.signalPeerConnection(peerConnection); err != nil {
-		return fmt.Errorf("failed to create peer connection: %w", err)
+	if w.telemetry != nil {
+		peerConnection.OnDataChannel(func(dc *webrtc.DataChannel) {
+			if dc.Label() != session.TelemetryLabel {
+				return
+			}
+			w.logger.Info().Msg("edge opened telemetry data channel")
+			dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+				metrics.TelemetryMessages.Inc()
+				w.telemetry.Write(msg)
+			})
+		})
+	}
+
+	answer, err := w.signalPeerConnection(ctx, peerConnection, offer)
+	if err != nil {
+		return nil, w.abort(fmt.Errorf("failed to create peer connection: %w", err))
 	}
 	w.logger.Info().Msg("created peer connection for publisher")
 
-	return nil
+	return answer, nil
 }
 
-// CreateSubscriber creates a webRTC subscriber peer.
-// Caller must send offer first by OfferChan or this function blocks waiting for receiving offer forever.
-func (w *WebRTC) CreateSubscriber(videoTrack *webrtc.TrackLocalStaticRTP) error {
+// CreateSubscriber creates a webRTC subscriber peer of offer, and returns the answer.
+// Offer/answer exchange must be done before ctx is done, or the peer connection is closed.
+// Video and audio tracks are negotiated in the same peer connection.
+func (w *WebRTC) CreateSubscriber(
+	ctx context.Context,
+	offer *webrtc.SessionDescription,
+	videoTrack, audioTrack *session.Track,
+) (*webrtc.SessionDescription, error) {
+	w.sent = newSentCounter()
 	peerConnection, err := w.newPeerConnection()
 	if err != nil {
-		return fmt.Errorf("could not create PeerConnection: %w", err)
+		return nil, fmt.Errorf("could not create PeerConnection: %w", err)
 	}
 
-	rtpSender, err := peerConnection.AddTrack(videoTrack)
-	if err != nil {
-		return fmt.Errorf("could not add track: %w", err)
+	for _, track := range append([]*session.Track{videoTrack, audioTrack}, w.bundle...) {
+		rtpSender, err := peerConnection.AddTrack(track)
+		if err != nil {
+			return nil, w.abort(fmt.Errorf("could not add %s track: %w", track.Kind(), err))
+		}
+		w.addSender(track, rtpSender)
+		go w.processRTCP(rtpSender)
+	}
+	if w.telemetry != nil {
+		peerConnection.OnDataChannel(func(dc *webrtc.DataChannel) {
+			if dc.Label() != session.TelemetryLabel {
+				return
+			}
+			// Cancel is idempotent, data channel may report closing more than once.
+			closed, cancel := context.WithCancel(context.Background())
+			dc.OnClose(cancel)
+			dc.OnOpen(func() { go w.sendTelemetry(dc, closed.Done()) })
+		})
 	}
-	go w.processRTCP(rtpSender)
 
-	if err := w.signalPeerConnection(peerConnection); err != nil {
-		return fmt.Errorf("failed to create peer connection: %w", err)
+	answer, err := w.signalPeerConnection(ctx, peerConnection, offer)
+	if err != nil {
+		return nil, w.abort(fmt.Errorf("failed to create peer connection: %w", err))
 	}
 	w.logger.Info().Msg("created peer connection for subscriber")
 
-	return nil
+	return answer, nil
 }
 
-func (w *WebRTC) signalPeerConnection(peerConnection *webrtc.PeerConnection) error {
-	offer := <-w.SignalChan
-	candidateChan := w.recvCandidate()
+// BundleTracks sends tracks of more streams to subscriber in the peer connection of CreateSubscriber, e.g. for
+// a dashboard watching several track sources of a machine. Tracks of each stream keep their own stream ID,
+// so subscriber tells them apart by MSID. Video tracks sent along with videoTrack of CreateSubscriber aren't
+// switched by ReplaceVideoTrack. It must be called before CreateSubscriber.
+func (w *WebRTC) BundleTracks(tracks ...*session.Track) {
+	w.bundle = append(w.bundle, tracks...)
+}
 
-	peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
-		if c == nil {
+// SentStream is a track sent to subscriber, with the SSRC and payload type it's rewritten to for the subscriber.
+type SentStream struct {
+	Track       webrtc.TrackLocal
+	SSRC        uint32
+	PayloadType uint8
+}
+
+// SentStreams returns streams sent to subscriber, e.g. to capture RTP as the subscriber receives it.
+func (w *WebRTC) SentStreams() ([]SentStream, error) {
+	peerConnection, err := w.livePeerConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	var streams []SentStream
+	for _, sender := range peerConnection.GetSenders() {
+		track := sender.Track()
+		if track == nil {
+			continue
+		}
+		params := sender.GetParameters()
+		if len(params.Encodings) == 0 {
+			continue
+		}
+		payloadType := params.Encodings[0].PayloadType
+		if payloadType == 0 && len(params.Codecs) > 0 {
+			payloadType = params.Codecs[0].PayloadType
+		}
+		streams = append(streams, SentStream{
+			Track:       track,
+			SSRC:        uint32(params.Encodings[0].SSRC),
+			PayloadType: uint8(payloadType),
+		})
+	}
+	return streams, nil
+}
+
+// sendTelemetry sends telemetry to the data channel of subscriber until closed is done or the peer connection is closed.
+func (w *WebRTC) sendTelemetry(dc *webrtc.DataChannel, closed <-chan struct{}) {
+	sub := w.telemetry.Subscribe()
+	defer w.telemetry.Unsubscribe(sub)
+	w.logger.Info().Msg("subscriber opened telemetry data channel")
+
+	for {
+		select {
+		case msg := <-sub.Messages():
+			var err error
+			if msg.IsString {
+				err = dc.SendText(string(msg.Data))
+			} else {
+				err = dc.Send(msg.Data)
+			}
+			if err != nil {
+				w.logger.Err(err).Msg("could not send telemetry")
+				return
+			}
+		case <-closed:
+			return
+		case <-w.done:
 			return
 		}
+	}
+}
+
+// abort closes WebRTC after signaling failed with err, and returns err.
+func (w *WebRTC) abort(err error) error {
+	if closeErr := w.Close(); closeErr != nil {
+		w.logger.Err(closeErr).Msg("could not close peer connection")
+	}
+	return err
+}
+
+func (w *WebRTC) signalPeerConnection(
+	ctx context.Context,
+	peerConnection *webrtc.PeerConnection,
+	offer *webrtc.SessionDescription,
+) (*webrtc.SessionDescription, error) {
+	if ctx.Err() != nil {
+		return nil, signalErr(ctx)
+	}
+	candidates := w.recvCandidate()
+
+	peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
 		w.candidatesMux.Lock()
 		defer w.candidatesMux.Unlock()
 
-		desc := peerConnection.RemoteDescription()
-		if desc == nil {
+		// A nil candidate means gathering has completed.
+		if c == nil {
+			w.gathered = true
+			if w.answered {
+				w.endOfCandidates()
+			}
+			return
+		}
+		if !w.answered {
 			w.pendingCandidates = append(w.pendingCandidates, c)
 			return
 		}
+		if w.vanilla {
+			w.logger.Debug().Msg("dropped an ICE candidate gathered after answer of vanilla ICE")
+			return
+		}
 		if err := w.sendCandidate(c); err != nil {
 			w.logger.Err(err).Msg("could not send candidate")
 		}
@@ -167,6 +629,9 @@ func (w *WebRTC) signalPeerConnection(peerConnection *webrtc.PeerConnection) err
 	// This will notify you when the peer has connected/disconnected
 	peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
 		w.logger.Info().Str("state", connectionState.String()).Msg("ICE connection state has changed")
+		if w.onICEConnectionState != nil {
+			w.onICEConnectionState(connectionState)
+		}
 
 		switch connectionState {
 		case webrtc.ICEConnectionStateFailed:
@@ -174,7 +639,13 @@ func (w *WebRTC) signalPeerConnection(peerConnection *webrtc.PeerConnection) err
 				w.logger.Panic().Err(err).Msg("could not close peer connection")
 			}
 			w.logger.Info().Msg("peer connection has been closed")
+			w.unregisterSession()
+			w.finish()
+		case webrtc.ICEConnectionStateClosed:
+			w.unregisterSession()
+			w.finish()
 		case webrtc.ICEConnectionStateConnected:
+			w.connectedOnce.Do(func() { close(w.connected) })
 			// Register session after ICE state is connected.
 			w.registerSession()
 			// Hook video seeding source here.
@@ -187,58 +658,182 @@ func (w *WebRTC) signalPeerConnection(peerConnection *webrtc.PeerConnection) err
 	})
 
 	if err := peerConnection.SetRemoteDescription(*offer); err != nil {
-		return fmt.Errorf("could not set remote description: %w", err)
+		return nil, fmt.Errorf("could not set remote description: %w", err)
 	}
 
 	// Add candidate after setting remote description.
-	go w.addICECandidates(peerConnection, candidateChan)
+	go w.addICECandidates(peerConnection, candidates)
 
 	answer, err := peerConnection.CreateAnswer(nil)
 	if err != nil {
-		return fmt.Errorf("could not create answer: %w", err)
+		return nil, fmt.Errorf("could not create answer: %w", err)
 	}
+	return w.setLocalDescription(ctx, peerConnection, answer)
+}
+
+// setLocalDescription sets local description of peerConnection, and returns it once it can be sent to remote peer.
+// Local candidates are held until then, and trickled afterwards.
+func (w *WebRTC) setLocalDescription(
+	ctx context.Context,
+	peerConnection *webrtc.PeerConnection,
+	description webrtc.SessionDescription,
+) (*webrtc.SessionDescription, error) {
+	// Candidates are gathered again once ICE restarts.
+	w.candidatesMux.Lock()
+	w.answered, w.gathered, w.pendingCandidates = false, false, nil
+	w.candidatesMux.Unlock()
 
-	if err = peerConnection.SetLocalDescription(answer); err != nil {
-		return fmt.Errorf("could not set local description: %w", err)
+	// Create channel that is blocked until ICE Gathering is complete
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+
+	if err := peerConnection.SetLocalDescription(description); err != nil {
+		return nil, fmt.Errorf("could not set local description: %w", err)
 	}
 
-	// Send answer of local description.
-	w.SignalChan <- peerConnection.LocalDescription()
+	// By default, it works in half-trickle mode, that is, answer is sent immediately and all server candidates
+	// are trickled. Otherwise, wait for gathering to complete so candidates are carried by the answer,
+	// and only those gathered after the timeout are trickled, or dropped for vanilla ICE.
+	waitGathering := w.config.WaitICEGathering || w.vanilla
+	if waitGathering {
+		if err := w.waitGathering(ctx, gatherComplete); err != nil {
+			return nil, err
+		}
+	}
 
-	// Signal candidate
 	w.candidatesMux.Lock()
 	defer w.candidatesMux.Unlock()
 
+	// Local description is sent by caller.
+	localDescription := peerConnection.LocalDescription()
+	w.answered = true
+
+	if waitGathering {
+		// Candidates gathered so far are already included in the local description.
+		w.pendingCandidates = nil
+		if w.gathered {
+			w.endOfCandidates()
+		}
+		return localDescription, nil
+	}
+
+	// Signal candidate
 	for _, c := range w.pendingCandidates {
 		if err := w.sendCandidate(c); err != nil {
-			return fmt.Errorf("could not send candidate: %w", err)
+			return nil, fmt.Errorf("could not send candidate: %w", err)
 		}
 		w.logger.Info().Msg("sent an ICE candidate")
 	}
+	w.pendingCandidates = nil
+	if w.gathered {
+		w.endOfCandidates()
+	}
+
+	return localDescription, nil
+}
+
+// waitGathering blocks until ICE gathering is complete or ICEGatheringTimeout expires.
+// A non-positive timeout waits for gathering until ctx is done or the peer connection is closed.
+func (w *WebRTC) waitGathering(ctx context.Context, gatherComplete <-chan struct{}) error {
+	_, span := tracing.Default.Start(ctx, "webrtc.ice_gathering", tracing.KindInternal)
+	defer span.End()
+	var timeout <-chan time.Time
+	if w.config.ICEGatheringTimeout > 0 {
+		timer := time.NewTimer(w.config.ICEGatheringTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
 
+	select {
+	case <-gatherComplete:
+		w.logger.Debug().Msg("ICE gathering completed")
+	case <-timeout:
+		span.SetBool("ice.gathering_timed_out", true)
+		w.logger.Warn().Dur("timeout", w.config.ICEGatheringTimeout).Msg("ICE gathering timed out, trickling remaining candidates")
+	case <-w.done:
+		span.SetError(ErrPeerClosed)
+		return ErrPeerClosed
+	case <-ctx.Done():
+		span.SetError(signalErr(ctx))
+		return signalErr(ctx)
+	}
 	return nil
 }
 
 func (w *WebRTC) newPeerConnection() (*webrtc.PeerConnection, error) {
-	return webrtc.NewPeerConnection(webrtc.Configuration{
-		ICEServers: []webrtc.ICEServer{
-			{
-				URLs:       []string{w.config.ICEServer},
-				Username:   w.config.Username,
-				Credential: w.config.Credential,
-			},
-		},
+	w.peerMux.Lock()
+	defer w.peerMux.Unlock()
+	if w.closed {
+		return nil, ErrPeerClosed
+	}
+
+	api := w.media.api
+	if (w.sent != nil || w.packetCaches != nil || w.layers != nil || w.playout != nil) && w.media.mediaEngine != nil {
+		var r *retransmitter
+		if w.packetCaches != nil {
+			r = &retransmitter{
+				cache:   w.videoPacketCache,
+				layers:  w.layers,
+				streams: make(map[uint32]*retransmitStream),
+			}
+		}
+		var err error
+		if api, err = w.media.subscriberAPI(w.sent, r, w.layers, w.playout); err != nil {
+			return nil, err
+		}
+	}
+	peerConnection, err := api.NewPeerConnection(webrtc.Configuration{
+		ICEServers: w.iceServers(),
 	})
+	if err != nil {
+		return nil, err
+	}
+	w.peerConnection = peerConnection
+	return peerConnection, nil
+}
+
+// iceServers returns STUN and TURN servers of media, along with TURN servers of minted credentials.
+func (w *WebRTC) iceServers() []webrtc.ICEServer {
+	configured := w.media.ICEServers()
+	servers := make([]webrtc.ICEServer, 0, len(configured)+1)
+	for _, server := range configured {
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       []string{server.URL},
+			Username:   server.Username,
+			Credential: server.Credential,
+		})
+	}
+	if w.config.TURNSecret != "" && len(w.config.TURNURLs) > 0 {
+		username, credential := TURNCredential(w.config.TURNSecret, turnUser, w.config.TURNCredentialTTL, time.Now())
+		servers = append(servers, webrtc.ICEServer{
+			URLs:       w.config.TURNURLs,
+			Username:   username,
+			Credential: credential,
+		})
+	}
+	return servers
 }
 
-func (w *WebRTC) addICECandidates(peerConnection *webrtc.PeerConnection, ch <-chan string) {
-	// TODO: Stop adding ICE candidate when after signaling succeeded, that is, to exit the loop.
-	// Just set a timer is not enough.
-	for c := range ch {
+// addICECandidates adds candidates of remote peer until it signals end-of-candidates or the peer connection
+// is closed, the queue is closed then, so candidates arriving late are dropped.
+func (w *WebRTC) addICECandidates(peerConnection *webrtc.PeerConnection, candidates *CandidateQueue) {
+	defer candidates.Close()
+	for {
+		c, ok := candidates.Pop(w.done)
+		if !ok {
+			w.logger.Debug().Msg("stopped adding ICE candidates")
+			return
+		}
+		if w.filterCandidate != nil && c != "" {
+			if err := w.filterCandidate(c); err != nil {
+				w.logger.Warn().Err(err).Str("candidate", c).Msg("dropped filtered ICE candidate")
+				continue
+			}
+		}
 		if err := peerConnection.AddICECandidate(webrtc.ICECandidateInit{
 			Candidate: c,
 		}); err != nil {
 			w.logger.Err(err).Msg("could not add ICE candidate")
+			continue
 		}
 		w.logger.Info().Str("candidate", c).Msg("successfully added an ICE candidate")
 	}
@@ -262,11 +857,27 @@ func closePeerConnection(peerConnection *webrtc.PeerConnection) error {
 	return peerConnection.Close()
 }
 
-// sendRTCP sends a PLI on an interval so that the publisher is pushing a keyframe every rtcpPLIInterval
-// This can be less wasteful by processing incoming RTCP events, then we would emit a NACK/PLI when a viewer requests it
-func (w *WebRTC) sendRTCP(peerConnection *webrtc.PeerConnection, remoteTrack *webrtc.TrackRemote) {
+// sendRTCP sends a PLI on an interval so that the publisher is pushing a keyframe every rtcpPLIInterval,
+// and at once on a request from keyframes, e.g. after a subscriber joined, reported loss or switched to
+// the simulcast layer. Requests are throttled by keyframeRequestInterval, so a crowd of lossy subscribers
+// doesn't make edge send keyframes only.
+func (w *WebRTC) sendRTCP(peerConnection *webrtc.PeerConnection, remoteTrack *webrtc.TrackRemote, keyframes <-chan struct{}) {
 	ticker := time.NewTicker(rtcpPLIInterval)
-	for range ticker.C {
+	defer ticker.Stop()
+	var last time.Time
+	for {
+		select {
+		case <-ticker.C:
+		case <-keyframes:
+			if time.Since(last) < keyframeRequestInterval {
+				metrics.KeyframeRequests.WithLabelValues("throttled").Inc()
+				continue
+			}
+			metrics.KeyframeRequests.WithLabelValues("relayed").Inc()
+			// The periodic PLI is due an interval after the requested one.
+			ticker.Reset(rtcpPLIInterval)
+		}
+		last = time.Now()
 		if rtcpSendErr := peerConnection.WriteRTCP([]rtcp.Packet{
 			&rtcp.PictureLossIndication{
 				MediaSSRC: uint32(remoteTrack.SSRC()),
@@ -281,10 +892,21 @@ func (w *WebRTC) sendRTCP(peerConnection *webrtc.PeerConnection, remoteTrack *we
 // processRTCP reads incoming RTCP packets
 // Before these packets are returned they are processed by interceptors.
 // For things like NACK this needs to be called.
+// Feedback of subscriber is recorded into stats, and keyframe requests of video are passed to onKeyframeRequest.
 func (w *WebRTC) processRTCP(rtpSender *webrtc.RTPSender) {
+	kind := rtpSender.Track().Kind()
+	var ssrc uint32
+	if encodings := rtpSender.GetParameters().Encodings; len(encodings) > 0 {
+		ssrc = uint32(encodings[0].SSRC)
+	}
+
 	rtcpBuf := make([]byte, 1500)
+	received := w.onFirstMedia == nil
+	relayKeyframes := kind == webrtc.RTPCodecTypeVideo && w.onKeyframeRequest != nil
+	joined := false
 	for {
-		if _, _, rtcpErr := rtpSender.Read(rtcpBuf); rtcpErr != nil {
+		n, _, rtcpErr := rtpSender.Read(rtcpBuf)
+		if rtcpErr != nil {
 			if errors.Is(rtcpErr, io.EOF) || errors.Is(rtcpErr, io.ErrClosedPipe) {
 				_ = rtpSender.Stop()
 			} else {
@@ -292,7 +914,46 @@ func (w *WebRTC) processRTCP(rtpSender *webrtc.RTPSender) {
 			}
 			return
 		}
+		packets, err := rtcp.Unmarshal(rtcpBuf[:n])
+		if err != nil {
+			continue
+		}
+		w.stats.record(kind, ssrc, packets, time.Now())
+		if !received {
+			received = w.receivedMedia(packets)
+		}
+		// The first RTCP of subscriber means it's connected, it can't decode until the next keyframe.
+		if relayKeyframes && (!joined || requestsKeyframe(packets)) {
+			joined = true
+			// Track is the one currently sent, which may be replaced by another simulcast layer.
+			if track := rtpSender.Track(); track != nil {
+				w.onKeyframeRequest(track)
+			}
+		}
+	}
+}
+
+// requestsKeyframe reports whether RTCP packets contain a PLI or FIR.
+func requestsKeyframe(packets []rtcp.Packet) bool {
+	for _, packet := range packets {
+		switch packet.(type) {
+		case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+			return true
+		}
 	}
+	return false
+}
+
+// receivedMedia reports whether RTCP packets contain a receiver report of media,
+// and calls onFirstMedia once if so.
+func (w *WebRTC) receivedMedia(packets []rtcp.Packet) bool {
+	for _, packet := range packets {
+		if rr, ok := packet.(*rtcp.ReceiverReport); ok && len(rr.Reports) > 0 {
+			w.firstMediaOnce.Do(w.onFirstMedia)
+			return true
+		}
+	}
+	return false
 }
 
 // NoopSendCandidateFunc does nothing.
@@ -300,15 +961,18 @@ func NoopSendCandidateFunc(_ *webrtc.ICECandidate) error {
 	return nil
 }
 
-// NoopRecvCandidateFunc does nothing.
-func NoopRecvCandidateFunc() <-chan string {
-	ch := make(chan string)
-	close(ch)
-	return ch
+// NoopRecvCandidateFunc returns a queue at end-of-candidates.
+func NoopRecvCandidateFunc() *CandidateQueue {
+	q := NewCandidateQueue()
+	q.End()
+	return q
 }
 
 // NoopRegisterSessionFunc does nothing.
 func NoopRegisterSessionFunc() {}
 
+// NoopUnregisterSessionFunc does nothing.
+func NoopUnregisterSessionFunc() {}
+
 // NoopHookStreamFunc does nothing.
 func NoopHookStreamFunc(_ webrtc.ICEConnectionState) {}
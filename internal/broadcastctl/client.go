@@ -0,0 +1,155 @@
+// Package broadcastctl is a client of the admin API of broadcast instances, for operators during incidents.
+package broadcastctl
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+)
+
+// maxResponseSize caps responses read, admin responses are small JSON.
+const maxResponseSize = 8 << 20
+
+// ConfigOptions are options of the admin API client.
+type ConfigOptions struct {
+	URL     string // Base URL of the broadcast instance, e.g. https://eu.example.com
+	Token   string // Admin token of the instance
+	Timeout time.Duration
+}
+
+// Client calls the admin API of a broadcast instance.
+type Client struct {
+	base   *url.URL
+	token  string
+	client *http.Client
+}
+
+// New returns a new Client.
+func New(config ConfigOptions) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(config.URL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", base.Scheme)
+	}
+	return &Client{
+		base:   base,
+		token:  config.Token,
+		client: &http.Client{Timeout: config.Timeout},
+	}, nil
+}
+
+// Streams lists sessions with ingest stats, of tenant unless it's empty.
+func (c *Client) Streams(ctx context.Context, tenant string) (json.RawMessage, error) {
+	query := url.Values{}
+	if tenant != "" {
+		query.Set("tenant", tenant)
+	}
+	return c.do(ctx, http.MethodGet, "/v1/admin/sessions", query)
+}
+
+// Accounting reports viewer egress bytes in JSON, query is of GET /v1/admin/accounting, e.g. from and group.
+func (c *Client) Accounting(ctx context.Context, query url.Values) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, "/v1/admin/accounting", query)
+}
+
+// Tenants lists concurrent streams and viewers of tenants with their limits.
+func (c *Client) Tenants(ctx context.Context) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, "/v1/admin/tenants", nil)
+}
+
+// Stats gets ingest stats of the session of meta.
+func (c *Client) Stats(ctx context.Context, meta *pb.Meta) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, sessionPath("/v1/admin/sessions", meta), nil)
+}
+
+// CloseSession closes the session of meta, all track sources of the machine if track source is negative.
+func (c *Client) CloseSession(ctx context.Context, id string, trackSource int) (json.RawMessage, error) {
+	p := "/v1/admin/sessions/" + url.PathEscape(id)
+	if trackSource >= 0 {
+		p += fmt.Sprintf("/%d", trackSource)
+	}
+	return c.do(ctx, http.MethodDelete, p, nil)
+}
+
+// Kick closes a subscriber peer connection.
+func (c *Client) Kick(ctx context.Context, peerID string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/v1/admin/subscribers/"+url.PathEscape(peerID), nil)
+	return err
+}
+
+// Keyframe asks edge of the session of meta for a keyframe.
+func (c *Client) Keyframe(ctx context.Context, meta *pb.Meta) error {
+	_, err := c.do(ctx, http.MethodPost, sessionPath("/v1/admin/sessions", meta)+"/keyframe", nil)
+	return err
+}
+
+// Recordings lists recordings.
+func (c *Client) Recordings(ctx context.Context) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, "/v1/broadcast/recordings", nil)
+}
+
+// StartRecording starts recording the session of meta.
+func (c *Client) StartRecording(ctx context.Context, meta *pb.Meta) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodPost, sessionPath("/v1/broadcast/recordings", meta), nil)
+}
+
+// StopRecording stops recording the session of meta.
+func (c *Client) StopRecording(ctx context.Context, meta *pb.Meta) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodDelete, sessionPath("/v1/broadcast/recordings", meta), nil)
+}
+
+// LogLevels lists log levels of components.
+func (c *Client) LogLevels(ctx context.Context) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, "/v1/admin/loglevel", nil)
+}
+
+// SetLogLevel sets log level of a component, an empty level resets it.
+func (c *Client) SetLogLevel(ctx context.Context, component, level string) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodPut, "/v1/admin/loglevel", url.Values{"component": {component}, "level": {level}})
+}
+
+func sessionPath(prefix string, meta *pb.Meta) string {
+	return fmt.Sprintf("%s/%s/%d", prefix, url.PathEscape(meta.Id), meta.TrackSource)
+}
+
+// do sends a request and returns the JSON body of a successful response, which is nil if there is none.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values) (json.RawMessage, error) {
+	// path is escaped already.
+	u, err := url.Parse(c.base.String() + path)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	return body, nil
+}
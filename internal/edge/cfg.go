@@ -0,0 +1,17 @@
+package edge
+
+import "time"
+
+type ConfigOptions struct {
+	ID          string // Machine ID of the synthetic edge, edges are suffixed by "-n" if Count > 1
+	TrackSource int
+	Count       int    // Synthetic edges publishing the same source, e.g. for load tests
+	Source      string // H264 Annex B (.h264) or IVF (.ivf) file, or "udp://host:port" receiving RTP
+	Codec       string // Codec of RTP received by UDP source, h264, vp8 or vp9
+	FPS         int    // Frame rate of H264 files, IVF files carry their own
+	Loop        bool   // Replay files from the start at EOF
+
+	ICEServer     string        // STUN or TURN server, empty uses host candidates only
+	SignalTimeout time.Duration // Max time of offer/answer exchange until ICE connects
+	RetryInterval time.Duration // Interval of offering again after the peer connection is gone
+}
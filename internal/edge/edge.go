@@ -0,0 +1,166 @@
+// Package edge runs synthetic Sphinx edges, which signal publisher of a broadcast instance over MQTT as
+// real edges do and stream a local video file or RTP received over UDP, e.g. for E2E tests, demos and load tests
+// without real drones.
+package edge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+	"github.com/SB-IM/skywalker/internal/broadcast/loglevel"
+)
+
+const (
+	defaultSignalTimeout = 10 * time.Second
+	defaultRetryInterval = 5 * time.Second
+)
+
+// Edge runs synthetic edges publishing the same source.
+type Edge struct {
+	client     mqtt.Client
+	logger     zerolog.Logger
+	mqttConfig cfg.MQTTClientConfigOptions
+	config     ConfigOptions
+}
+
+// New returns a new Edge, it signals publisher over client on topics of mqttConfig.
+func New(client mqtt.Client, logger *zerolog.Logger, mqttConfig cfg.MQTTClientConfigOptions, config ConfigOptions) (*Edge, error) {
+	if config.ID == "" {
+		return nil, errors.New("empty edge ID")
+	}
+	if config.Source == "" {
+		return nil, errors.New("empty edge source")
+	}
+	if config.Count < 1 {
+		config.Count = 1
+	}
+	// A UDP address can be listened on by a single edge.
+	if config.Count > 1 && strings.HasPrefix(config.Source, "udp://") {
+		return nil, errors.New("UDP source can't be published by more than one edge")
+	}
+	if config.SignalTimeout <= 0 {
+		config.SignalTimeout = defaultSignalTimeout
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = defaultRetryInterval
+	}
+	return &Edge{
+		client:     client,
+		logger:     loglevel.Default.Component(logger, "Edge"),
+		mqttConfig: mqttConfig,
+		config:     config,
+	}, nil
+}
+
+// Run publishes the source by Count edges until ctx is done, or files are played to the end if not looped.
+func (e *Edge) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < e.config.Count; i++ {
+		id := e.config.ID
+		if e.config.Count > 1 {
+			id += "-" + strconv.Itoa(i)
+		}
+		meta := &pb.Meta{Id: id, TrackSource: pb.TrackSource(e.config.TrackSource)}
+		logger := e.logger.With().Str("id", id).Int("track_source", e.config.TrackSource).Logger()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.publish(ctx, meta, &logger)
+		}()
+	}
+	wg.Wait()
+}
+
+// publish offers the source of meta to publisher and streams it until its peer connection is gone,
+// then offers again in RetryInterval until ctx is done or the source ends.
+func (e *Edge) publish(ctx context.Context, meta *pb.Meta, logger *zerolog.Logger) {
+	for {
+		err := e.stream(ctx, meta, logger)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, io.EOF) {
+			logger.Info().Msg("source ended")
+			return
+		}
+		logger.Warn().Err(err).Dur("retry_interval", e.config.RetryInterval).Msg("edge stopped, offering again")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.config.RetryInterval):
+		}
+	}
+}
+
+// stream signals a peer connection of the source and streams it until the peer connection is gone or ctx is done.
+func (e *Edge) stream(ctx context.Context, meta *pb.Meta, logger *zerolog.Logger) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	src, err := newSource(meta.Id, &e.config)
+	if err != nil {
+		return err
+	}
+	var config webrtc.Configuration
+	if e.config.ICEServer != "" {
+		config.ICEServers = []webrtc.ICEServer{{URLs: []string{e.config.ICEServer}}}
+	}
+	peerConnection, err := webrtc.NewPeerConnection(config)
+	if err != nil {
+		return fmt.Errorf("could not create PeerConnection: %w", err)
+	}
+	defer peerConnection.Close()
+	rtpSender, err := peerConnection.AddTrack(src.Track())
+	if err != nil {
+		return fmt.Errorf("could not add video track: %w", err)
+	}
+	// Read RTCP so interceptors work.
+	go func() {
+		buf := make([]byte, rtpBufferSize)
+		for {
+			if _, _, err := rtpSender.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	gone := make(chan struct{})
+	var goneOnce sync.Once
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		logger.Debug().Str("state", state.String()).Msg("edge peer connection state changed")
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			goneOnce.Do(func() {
+				close(gone)
+				cancel()
+			})
+		}
+	})
+
+	signalCtx, signalCancel := context.WithTimeout(ctx, e.config.SignalTimeout)
+	err = Signal(signalCtx, e.client, e.mqttConfig, meta, peerConnection, logger)
+	signalCancel()
+	if err != nil {
+		return err
+	}
+	logger.Info().Str("source", e.config.Source).Msg("edge signaled, streaming")
+
+	err = src.Stream(ctx)
+	select {
+	case <-gone:
+		return errors.New("peer connection is gone")
+	default:
+		return err
+	}
+}
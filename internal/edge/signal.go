@@ -0,0 +1,133 @@
+package edge
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	pb "github.com/SB-IM/pb/signal"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/pion/webrtc/v3"
+	"github.com/rs/zerolog"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/cfg"
+)
+
+// Signal offers peerConnection of meta to publisher over MQTT as a Sphinx edge does, and sets the answer and
+// candidates of publisher until ICE connects or ctx is done. Topics are those of config as publisher sees them.
+// Offer is sent after ICE gathering completes, so candidates of the edge needn't be trickled.
+func Signal(
+	ctx context.Context,
+	client mqtt.Client,
+	config cfg.MQTTClientConfigOptions,
+	meta *pb.Meta,
+	peerConnection *webrtc.PeerConnection,
+	logger *zerolog.Logger,
+) error {
+	suffix := "/" + meta.Id + "/" + strconv.Itoa(int(meta.TrackSource))
+	answerTopic := config.AnswerTopicPrefix + suffix
+	// Opposite to publisher, candidates are received on its sending topic.
+	candidateTopic := config.CandidateSendTopicPrefix + suffix
+
+	answers := make(chan []byte, 1)
+	candidates := make(chan string, 16)
+	if err := Wait(ctx, client.SubscribeMultiple(
+		map[string]byte{answerTopic: byte(config.Qos), candidateTopic: byte(config.Qos)},
+		func(_ mqtt.Client, m mqtt.Message) {
+			switch m.Topic() {
+			case answerTopic:
+				select {
+				case answers <- m.Payload():
+				default:
+				}
+			case candidateTopic:
+				candidate, err := pb.DecodeCandidate(m.Payload())
+				if err != nil {
+					logger.Err(err).Msg("could not decode candidate")
+					return
+				}
+				select {
+				case candidates <- candidate:
+				default:
+					logger.Warn().Msg("dropped candidate of publisher")
+				}
+			}
+		},
+	)); err != nil {
+		return fmt.Errorf("could not subscribe to answer and candidate topics: %w", err)
+	}
+	defer func() {
+		if err := Wait(context.Background(), client.Unsubscribe(answerTopic, candidateTopic)); err != nil {
+			logger.Err(err).Msg("could not unsubscribe from answer and candidate topics")
+		}
+	}()
+
+	connected := make(chan struct{})
+	var connectedOnce sync.Once
+	peerConnection.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if state == webrtc.ICEConnectionStateConnected {
+			connectedOnce.Do(func() { close(connected) })
+		}
+	})
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("could not create offer: %w", err)
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("could not set local description: %w", err)
+	}
+	select {
+	case <-gatherComplete:
+	case <-ctx.Done():
+		return fmt.Errorf("could not gather candidates: %w", ctx.Err())
+	}
+
+	payload, err := pb.EncodeSDP(peerConnection.LocalDescription(), meta)
+	if err != nil {
+		return fmt.Errorf("could not encode offer: %w", err)
+	}
+	if err := Wait(ctx, client.Publish(config.OfferTopicPrefix+suffix, byte(config.Qos), false, payload)); err != nil {
+		return fmt.Errorf("could not publish offer: %w", err)
+	}
+
+	var answer []byte
+	select {
+	case answer = <-answers:
+	case <-ctx.Done():
+		return fmt.Errorf("no answer from publisher: %w", ctx.Err())
+	}
+	sdp, err := pb.DecodeSDP(answer)
+	if err != nil {
+		return fmt.Errorf("could not decode answer: %w", err)
+	}
+	if err := peerConnection.SetRemoteDescription(*sdp); err != nil {
+		return fmt.Errorf("could not set remote description: %w", err)
+	}
+
+	// Publisher trickles candidates after the answer, until ICE connects.
+	for {
+		select {
+		case candidate := <-candidates:
+			if err := peerConnection.AddICECandidate(webrtc.ICECandidateInit{Candidate: candidate}); err != nil {
+				return fmt.Errorf("could not add candidate: %w", err)
+			}
+		case <-connected:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("ICE not connected: %w", ctx.Err())
+		}
+	}
+}
+
+// Wait waits for token to complete until ctx is done.
+func Wait(ctx context.Context, t mqtt.Token) error {
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
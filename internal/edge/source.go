@@ -0,0 +1,277 @@
+package edge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/h264reader"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+// rtpBufferSize is size of buffers reading RTP of UDP sources.
+const rtpBufferSize = 1500
+
+// annexBStartCode prefixes NAL units of H264 samples, so the payloader splits an access unit into them.
+var annexBStartCode = []byte{0, 0, 0, 1}
+
+// source streams video of an edge to its track.
+type source interface {
+	// Track returns the track added to the peer connection of the edge.
+	Track() webrtc.TrackLocal
+	// Stream writes video to the track until ctx is done or an error occurs.
+	// It returns io.EOF once a file is played to the end and it's not looped.
+	Stream(ctx context.Context) error
+}
+
+// newSource returns the source of config for the edge of id.
+func newSource(id string, config *ConfigOptions) (source, error) {
+	if strings.HasPrefix(config.Source, "udp://") {
+		u, err := url.Parse(config.Source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UDP source: %w", err)
+		}
+		codec, err := parseCodec(config.Codec)
+		if err != nil {
+			return nil, err
+		}
+		track, err := webrtc.NewTrackLocalStaticRTP(codec, "video", id)
+		if err != nil {
+			return nil, fmt.Errorf("could not create video track: %w", err)
+		}
+		return &udpSource{address: u.Host, track: track}, nil
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(config.Source)); ext {
+	case ".h264", ".264":
+		if config.FPS <= 0 {
+			return nil, fmt.Errorf("invalid frame rate %d", config.FPS)
+		}
+		track, err := webrtc.NewTrackLocalStaticSample(
+			webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000},
+			"video",
+			id,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not create video track: %w", err)
+		}
+		return &h264Source{path: config.Source, loop: config.Loop, interval: time.Second / time.Duration(config.FPS), track: track}, nil
+	case ".ivf":
+		return newIVFSource(id, config)
+	default:
+		return nil, fmt.Errorf("unsupported source %q, expect .h264 or .ivf file, or udp://host:port", config.Source)
+	}
+}
+
+// parseCodec parses codec of RTP received by UDP sources.
+func parseCodec(codec string) (webrtc.RTPCodecCapability, error) {
+	switch strings.ToLower(codec) {
+	case "h264":
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}, nil
+	case "vp8":
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000}, nil
+	case "vp9":
+		return webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9, ClockRate: 90000}, nil
+	default:
+		return webrtc.RTPCodecCapability{}, fmt.Errorf("unsupported codec %q, expect h264, vp8 or vp9", codec)
+	}
+}
+
+// h264Source plays an H264 Annex B file at a fixed frame rate.
+type h264Source struct {
+	path     string
+	loop     bool
+	interval time.Duration
+	track    *webrtc.TrackLocalStaticSample
+}
+
+func (s *h264Source) Track() webrtc.TrackLocal { return s.track }
+
+func (s *h264Source) Stream(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.play(ctx, ticker); err != nil {
+			return err
+		}
+		if !s.loop {
+			return io.EOF
+		}
+	}
+}
+
+// play plays the file once, an access unit is written on every tick.
+func (s *h264Source) play(ctx context.Context, ticker *time.Ticker) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := h264reader.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("could not read H264 file: %w", err)
+	}
+
+	var au []byte
+	for {
+		nal, err := r.NextNAL()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read NAL unit: %w", err)
+		}
+		au = append(au, annexBStartCode...)
+		au = append(au, nal.Data...)
+		// An access unit ends with its slice, parameter sets and SEI are sent along with it.
+		if nal.UnitType != h264reader.NalUnitTypeCodedSliceNonIdr && nal.UnitType != h264reader.NalUnitTypeCodedSliceIdr {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := s.track.WriteSample(media.Sample{Data: au, Duration: s.interval}); err != nil {
+			return fmt.Errorf("could not write sample: %w", err)
+		}
+		au = nil
+	}
+}
+
+// ivfSource plays a VP8 or VP9 IVF file at its frame rate.
+type ivfSource struct {
+	path     string
+	loop     bool
+	interval time.Duration
+	track    *webrtc.TrackLocalStaticSample
+}
+
+// newIVFSource returns a source of IVF file of config, its codec and frame rate are taken from the file header.
+func newIVFSource(id string, config *ConfigOptions) (*ivfSource, error) {
+	f, err := os.Open(config.Source)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	_, header, err := ivfreader.NewWith(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read IVF header: %w", err)
+	}
+	var mimeType string
+	switch header.FourCC {
+	case "VP80":
+		mimeType = webrtc.MimeTypeVP8
+	case "VP90":
+		mimeType = webrtc.MimeTypeVP9
+	default:
+		return nil, fmt.Errorf("unsupported IVF codec %q", header.FourCC)
+	}
+	if header.TimebaseNumerator == 0 || header.TimebaseDenominator == 0 {
+		return nil, errors.New("invalid IVF timebase")
+	}
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: mimeType, ClockRate: 90000}, "video", id)
+	if err != nil {
+		return nil, fmt.Errorf("could not create video track: %w", err)
+	}
+	return &ivfSource{
+		path:     config.Source,
+		loop:     config.Loop,
+		interval: time.Second * time.Duration(header.TimebaseNumerator) / time.Duration(header.TimebaseDenominator),
+		track:    track,
+	}, nil
+}
+
+func (s *ivfSource) Track() webrtc.TrackLocal { return s.track }
+
+func (s *ivfSource) Stream(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.play(ctx, ticker); err != nil {
+			return err
+		}
+		if !s.loop {
+			return io.EOF
+		}
+	}
+}
+
+// play plays the file once, a frame is written on every tick.
+func (s *ivfSource) play(ctx context.Context, ticker *time.Ticker) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, _, err := ivfreader.NewWith(f)
+	if err != nil {
+		return fmt.Errorf("could not read IVF header: %w", err)
+	}
+	for {
+		frame, _, err := r.ParseNextFrame()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("could not read IVF frame: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if err := s.track.WriteSample(media.Sample{Data: frame, Duration: s.interval}); err != nil {
+			return fmt.Errorf("could not write sample: %w", err)
+		}
+	}
+}
+
+// udpSource forwards RTP received on a UDP address, e.g. from
+// "ffmpeg -re -i input.mp4 -an -c:v libx264 -bsf:v h264_mp4toannexb -f rtp udp://127.0.0.1:5004".
+type udpSource struct {
+	address string
+	track   *webrtc.TrackLocalStaticRTP
+}
+
+func (s *udpSource) Track() webrtc.TrackLocal { return s.track }
+
+func (s *udpSource) Stream(ctx context.Context) error {
+	addr, err := net.ResolveUDPAddr("udp", s.address)
+	if err != nil {
+		return fmt.Errorf("invalid UDP address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on UDP: %w", err)
+	}
+	defer conn.Close()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, rtpBufferSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("could not read RTP: %w", err)
+		}
+		// ErrClosedPipe means the peer connection is not bound yet.
+		if _, err := s.track.Write(buf[:n]); err != nil && !errors.Is(err, io.ErrClosedPipe) {
+			return fmt.Errorf("could not write RTP: %w", err)
+		}
+	}
+}
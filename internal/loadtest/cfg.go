@@ -0,0 +1,15 @@
+package loadtest
+
+import "time"
+
+type ConfigOptions struct {
+	URL         string // Base URL of the broadcast instance, e.g. wss://eu.example.com
+	Token       string // Subscriber JWT, empty if the instance doesn't authenticate, its tenant is accounted egress
+	ID          string // Machine ID of the stream subscribed
+	TrackSource int
+
+	Clients       int           // Concurrent subscriber clients
+	RampUp        time.Duration // Clients are started evenly over it, zero starts them at once
+	Duration      time.Duration // Time each client receives RTP after its first video packet
+	SignalTimeout time.Duration // Max time from offer to the first video packet
+}
@@ -0,0 +1,164 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/signalclient"
+)
+
+// errNoMedia is returned if a client receives no video in SignalTimeout.
+var errNoMedia = errors.New("no media received")
+
+// result is the result of a client.
+type result struct {
+	Setup    time.Duration // From offer sent to the first video packet.
+	Received uint64        // Video packets received.
+	Lost     uint64        // Video packets lost by sequence numbers.
+	Bytes    uint64        // Video bytes received.
+	Err      error
+}
+
+// sequence counts packets received and lost by RTP sequence numbers, which wrap around at 2^16.
+type sequence struct {
+	started  bool
+	first    uint32 // Extended sequence number of the first packet.
+	highest  uint32 // The highest extended sequence number.
+	received uint64
+}
+
+func (s *sequence) add(seq uint16) {
+	s.received++
+	if !s.started {
+		s.started, s.first, s.highest = true, uint32(seq), uint32(seq)
+		return
+	}
+	// Extend seq to the cycle closest to the highest one, so reordered packets don't count as wraps.
+	ext := s.highest&^0xffff | uint32(seq)
+	switch {
+	case ext+0x8000 < s.highest:
+		ext += 0x10000
+	case ext > s.highest+0x8000 && ext >= 0x10000:
+		ext -= 0x10000
+	}
+	if ext > s.highest {
+		s.highest = ext
+	}
+}
+
+// lost returns packets expected but not received, duplicates may make it zero.
+func (s *sequence) lost() uint64 {
+	if !s.started {
+		return 0
+	}
+	expected := uint64(s.highest-s.first) + 1
+	if s.received >= expected {
+		return 0
+	}
+	return expected - s.received
+}
+
+// run subscribes to the stream through signaling URL u, and receives video for Duration after its first packet.
+func run(ctx context.Context, u string, meta *pb.Meta, config *ConfigOptions) *result {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	peerConnection, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return &result{Err: fmt.Errorf("could not create PeerConnection: %w", err)}
+	}
+	defer peerConnection.Close()
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := peerConnection.AddTransceiverFromKind(kind, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return &result{Err: fmt.Errorf("could not add %s transceiver: %w", kind, err)}
+		}
+	}
+
+	var (
+		mu    sync.Mutex
+		seq   sequence
+		bytes uint64
+	)
+	firstMedia := make(chan struct{})
+	var firstMediaOnce sync.Once
+	peerConnection.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		buf := make([]byte, 1500)
+		for {
+			n, _, err := track.Read(buf)
+			if err != nil {
+				return
+			}
+			if track.Kind() != webrtc.RTPCodecTypeVideo || n < 4 {
+				continue
+			}
+			mu.Lock()
+			seq.add(uint16(buf[2])<<8 | uint16(buf[3]))
+			bytes += uint64(n)
+			mu.Unlock()
+			firstMediaOnce.Do(func() { close(firstMedia) })
+		}
+	})
+
+	offer, err := peerConnection.CreateOffer(nil)
+	if err != nil {
+		return &result{Err: fmt.Errorf("could not create offer: %w", err)}
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	if err := peerConnection.SetLocalDescription(offer); err != nil {
+		return &result{Err: fmt.Errorf("could not set local description: %w", err)}
+	}
+	signalCtx, signalCancel := context.WithTimeout(ctx, config.SignalTimeout)
+	defer signalCancel()
+	select {
+	case <-gatherComplete:
+	case <-signalCtx.Done():
+		return &result{Err: fmt.Errorf("could not gather candidates: %w", signalCtx.Err())}
+	}
+
+	client, err := signalclient.Dial(signalCtx, u)
+	if err != nil {
+		return &result{Err: err}
+	}
+	defer client.Close()
+
+	start := time.Now()
+	if err := client.Offer(signalCtx, meta, peerConnection); err != nil {
+		return &result{Err: err}
+	}
+
+	// Signaling is kept during the test, as the connection going away ends the subscription.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- client.Signal(ctx, peerConnection, nil)
+	}()
+	var r result
+	select {
+	case <-firstMedia:
+		r.Setup = time.Since(start)
+	case err := <-errc:
+		return &result{Err: err}
+	case <-signalCtx.Done():
+		return &result{Err: errNoMedia}
+	}
+
+	select {
+	case <-time.After(config.Duration):
+	case err := <-errc:
+		if ctx.Err() == nil {
+			r.Err = fmt.Errorf("subscription ended early: %w", err)
+		}
+	case <-ctx.Done():
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	r.Received, r.Lost, r.Bytes = seq.received, seq.lost(), bytes
+	return &r
+}
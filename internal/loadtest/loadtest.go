@@ -0,0 +1,155 @@
+// Package loadtest runs many WebSocket subscriber clients of a stream against a broadcast instance, and reports
+// their setup time and packet loss, so instances can be sized before deployments.
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/SB-IM/pb/signal"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultDuration      = 30 * time.Second
+	defaultSignalTimeout = 10 * time.Second
+)
+
+// Report is statistics of a load test.
+type Report struct {
+	Clients   int `json:"clients"`
+	Succeeded int `json:"succeeded"` // Clients receiving video for the whole duration.
+	Failed    int `json:"failed"`
+	// Errors counts failed clients by error.
+	Errors map[string]int `json:"errors,omitempty"`
+
+	// Setup time in milliseconds from offer sent to the first video packet, of clients receiving video.
+	SetupP50 float64 `json:"setup_p50_ms"`
+	SetupP95 float64 `json:"setup_p95_ms"`
+	SetupP99 float64 `json:"setup_p99_ms"`
+	SetupMax float64 `json:"setup_max_ms"`
+
+	PacketsReceived uint64  `json:"packets_received"`
+	PacketsLost     uint64  `json:"packets_lost"`
+	PacketLoss      float64 `json:"packet_loss"` // Ratio of video packets lost of all clients.
+	// Bitrate is the mean video bitrate received by a client in kbps.
+	Bitrate float64 `json:"bitrate_kbps"`
+}
+
+// Run runs Clients subscriber clients, started evenly over RampUp, until they all finish or ctx is done.
+func Run(ctx context.Context, logger *zerolog.Logger, config ConfigOptions) (*Report, error) {
+	u, err := signalURL(&config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Clients < 1 {
+		return nil, errors.New("no clients")
+	}
+	if config.Duration <= 0 {
+		config.Duration = defaultDuration
+	}
+	if config.SignalTimeout <= 0 {
+		config.SignalTimeout = defaultSignalTimeout
+	}
+	meta := &pb.Meta{Id: config.ID, TrackSource: pb.TrackSource(config.TrackSource)}
+	logger.Info().
+		Str("id", config.ID).
+		Int("track_source", config.TrackSource).
+		Int("clients", config.Clients).
+		Dur("ramp_up", config.RampUp).
+		Dur("duration", config.Duration).
+		Msg("started load test")
+
+	results := make([]*result, config.Clients)
+	var wg sync.WaitGroup
+	interval := config.RampUp / time.Duration(config.Clients)
+	for i := range results {
+		if i > 0 && interval > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+		if ctx.Err() != nil {
+			results[i] = &result{Err: ctx.Err()}
+			continue
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r := run(ctx, u, meta, &config)
+			if r.Err != nil {
+				logger.Debug().Err(r.Err).Int("client", i).Msg("client failed")
+			}
+			results[i] = r
+		}(i)
+	}
+	wg.Wait()
+	return report(results, config.Duration), nil
+}
+
+// signalURL returns the signaling URL of config.
+func signalURL(config *ConfigOptions) (string, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %w", err)
+	}
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	u.Path = path.Join(u.Path, "/v1/broadcast/signal")
+	query := url.Values{}
+	if config.Token != "" {
+		query.Set("token", config.Token)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// report aggregates results of clients receiving video for duration.
+func report(results []*result, duration time.Duration) *Report {
+	r := &Report{Clients: len(results), Errors: make(map[string]int)}
+	var (
+		setups []time.Duration
+		bytes  uint64
+	)
+	for _, result := range results {
+		if result.Setup > 0 {
+			setups = append(setups, result.Setup)
+		}
+		r.PacketsReceived += result.Received
+		r.PacketsLost += result.Lost
+		bytes += result.Bytes
+		if result.Err != nil {
+			r.Failed++
+			r.Errors[result.Err.Error()]++
+			continue
+		}
+		r.Succeeded++
+	}
+	if len(setups) > 0 {
+		sort.Slice(setups, func(i, j int) bool { return setups[i] < setups[j] })
+		at := func(p float64) float64 {
+			return float64(setups[int(p*float64(len(setups)-1))]) / float64(time.Millisecond)
+		}
+		r.SetupP50, r.SetupP95, r.SetupP99 = at(0.5), at(0.95), at(0.99)
+		r.SetupMax = float64(setups[len(setups)-1]) / float64(time.Millisecond)
+		r.Bitrate = float64(bytes) * 8 / 1000 / duration.Seconds() / float64(len(setups))
+	}
+	if expected := r.PacketsReceived + r.PacketsLost; expected > 0 {
+		r.PacketLoss = float64(r.PacketsLost) / float64(expected)
+	}
+	return r
+}
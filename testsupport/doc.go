@@ -0,0 +1,10 @@
+// Package testsupport provides in-memory doubles of MQTT broker and WebSocket signaling transport,
+// so services embedding broadcast can test their integration without Docker.
+//
+// A Broker routes messages between its clients, which implement mqtt.Client of paho.
+// Put a client into context by mqttclient.WithContext before creating broadcast service,
+// and simulate edge devices with other clients of the same broker.
+// A SignalClient talks to subscriber signaling handler served in process.
+// A PeerFactory connects peer connections of the service, edges and viewers on a virtual network in process,
+// and a TrackSink records RTP forwarded by a publisher.
+package testsupport
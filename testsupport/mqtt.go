@@ -0,0 +1,336 @@
+package testsupport
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Broker is an in-memory MQTT broker. QoS is ignored as delivery is always reliable.
+type Broker struct {
+	mu       sync.RWMutex
+	clients  map[*Client]struct{}
+	retained map[string]*message
+}
+
+// NewBroker returns a new Broker.
+func NewBroker() *Broker {
+	return &Broker{
+		clients:  make(map[*Client]struct{}),
+		retained: make(map[string]*message),
+	}
+}
+
+// NewClient returns a new client of the broker, it's connected already like a client checked by
+// mqttclient.CheckConnectivity.
+func (b *Broker) NewClient() *Client {
+	c := &Client{
+		broker: b,
+		routes: make(map[string]mqtt.MessageHandler),
+	}
+	c.Connect()
+	return c
+}
+
+func (b *Broker) addClient(c *Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients[c] = struct{}{}
+}
+
+func (b *Broker) removeClient(c *Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.clients, c)
+}
+
+// publish routes a message to all subscribed clients, and retains it if required.
+func (b *Broker) publish(msg *message) {
+	b.mu.Lock()
+	if msg.retained {
+		// Empty payload clears the retained message as a real broker does.
+		if len(msg.payload) == 0 {
+			delete(b.retained, msg.topic)
+		} else {
+			b.retained[msg.topic] = msg
+		}
+	}
+	clients := make([]*Client, 0, len(b.clients))
+	for c := range b.clients {
+		clients = append(clients, c)
+	}
+	b.mu.Unlock()
+
+	for _, c := range clients {
+		c.route(msg)
+	}
+}
+
+// retainedMessages returns retained messages matching filter.
+func (b *Broker) retainedMessages(filter string) []*message {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var msgs []*message
+	for topic, msg := range b.retained {
+		if match(filter, topic) {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+// Client is an in-memory MQTT client implementing mqtt.Client.
+// Messages are delivered to handlers one by one in a goroutine per client, as paho does with order matters.
+type Client struct {
+	broker *Broker
+
+	mu        sync.RWMutex
+	connected bool
+	routes    map[string]mqtt.MessageHandler
+
+	queueMux sync.Mutex
+	queue    []func()
+	// wake wakes the delivering goroutine, it's nil while disconnected.
+	wake chan struct{}
+}
+
+var _ mqtt.Client = (*Client)(nil)
+
+// IsConnected implements mqtt.Client.
+func (c *Client) IsConnected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.connected
+}
+
+// IsConnectionOpen implements mqtt.Client.
+func (c *Client) IsConnectionOpen() bool {
+	return c.IsConnected()
+}
+
+// Connect implements mqtt.Client.
+func (c *Client) Connect() mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		return newToken(nil)
+	}
+	c.connected = true
+
+	wake := make(chan struct{}, 1)
+	c.queueMux.Lock()
+	c.wake = wake
+	c.queueMux.Unlock()
+	go c.deliver(wake)
+
+	c.broker.addClient(c)
+	return newToken(nil)
+}
+
+// Disconnect implements mqtt.Client. Subscriptions and messages not delivered yet are dropped as the session is
+// clean, and the client is removed from the broker until it connects again.
+func (c *Client) Disconnect(_ uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return
+	}
+	c.connected = false
+	c.routes = make(map[string]mqtt.MessageHandler)
+	c.broker.removeClient(c)
+
+	c.queueMux.Lock()
+	close(c.wake)
+	c.wake = nil
+	c.queue = nil
+	c.queueMux.Unlock()
+}
+
+// Publish implements mqtt.Client. Payload must be string, []byte or bytes.Buffer.
+func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	if !c.IsConnected() {
+		return newToken(mqtt.ErrNotConnected)
+	}
+
+	var b []byte
+	switch p := payload.(type) {
+	case string:
+		b = []byte(p)
+	case []byte:
+		b = p
+	case bytes.Buffer:
+		b = p.Bytes()
+	case *bytes.Buffer:
+		b = p.Bytes()
+	default:
+		return newToken(fmt.Errorf("unknown payload type: %T", payload))
+	}
+	c.broker.publish(&message{
+		topic:    topic,
+		qos:      qos,
+		retained: retained,
+		payload:  append([]byte(nil), b...),
+	})
+	return newToken(nil)
+}
+
+// Subscribe implements mqtt.Client. Retained messages matching topic are delivered immediately.
+func (c *Client) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return c.SubscribeMultiple(map[string]byte{topic: qos}, callback)
+}
+
+// SubscribeMultiple implements mqtt.Client.
+func (c *Client) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return newToken(mqtt.ErrNotConnected)
+	}
+	for filter := range filters {
+		c.routes[filter] = callback
+	}
+	c.mu.Unlock()
+
+	for filter := range filters {
+		for _, msg := range c.broker.retainedMessages(filter) {
+			msg := msg
+			c.enqueue(func() { callback(c, msg) })
+		}
+	}
+	return newToken(nil)
+}
+
+// Unsubscribe implements mqtt.Client.
+func (c *Client) Unsubscribe(topics ...string) mqtt.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.routes, topic)
+	}
+	return newToken(nil)
+}
+
+// AddRoute implements mqtt.Client.
+func (c *Client) AddRoute(topic string, callback mqtt.MessageHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.routes[topic] = callback
+}
+
+// OptionsReader implements mqtt.Client. The returned reader is empty and must not be read,
+// as paho provides no way to create one.
+func (c *Client) OptionsReader() mqtt.ClientOptionsReader {
+	return mqtt.ClientOptionsReader{}
+}
+
+// Subscriptions returns topic filters currently subscribed.
+func (c *Client) Subscriptions() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	filters := make([]string, 0, len(c.routes))
+	for filter := range c.routes {
+		filters = append(filters, filter)
+	}
+	return filters
+}
+
+// route enqueues message to handlers of all matching filters.
+func (c *Client) route(msg *message) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if !c.connected {
+		return
+	}
+	for filter, handler := range c.routes {
+		if match(filter, msg.topic) {
+			handler := handler
+			c.enqueue(func() { handler(c, msg) })
+		}
+	}
+}
+
+// enqueue queues a delivery without blocking, so handlers can publish freely. It's dropped if disconnected.
+func (c *Client) enqueue(f func()) {
+	c.queueMux.Lock()
+	defer c.queueMux.Unlock()
+	if c.wake == nil {
+		return
+	}
+	c.queue = append(c.queue, f)
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver calls queued deliveries until wake is closed by Disconnect.
+func (c *Client) deliver(wake <-chan struct{}) {
+	for range wake {
+		for {
+			c.queueMux.Lock()
+			if len(c.queue) == 0 {
+				c.queueMux.Unlock()
+				break
+			}
+			f := c.queue[0]
+			c.queue = c.queue[1:]
+			c.queueMux.Unlock()
+			f()
+		}
+	}
+}
+
+// match reports whether topic matches filter with "+" and "#" wildcards.
+func match(filter, topic string) bool {
+	filters := strings.Split(filter, "/")
+	topics := strings.Split(topic, "/")
+	for i, f := range filters {
+		if f == "#" {
+			return true
+		}
+		if i >= len(topics) || (f != "+" && f != topics[i]) {
+			return false
+		}
+	}
+	return len(filters) == len(topics)
+}
+
+// message implements mqtt.Message.
+type message struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+func (m *message) Duplicate() bool   { return false }
+func (m *message) Qos() byte         { return m.qos }
+func (m *message) Retained() bool    { return m.retained }
+func (m *message) Topic() string     { return m.topic }
+func (m *message) MessageID() uint16 { return 0 }
+func (m *message) Payload() []byte   { return m.payload }
+func (m *message) Ack()              {}
+
+// token implements mqtt.Token, which is always completed.
+type token struct {
+	done chan struct{}
+	err  error
+}
+
+func newToken(err error) *token {
+	t := &token{done: make(chan struct{}), err: err}
+	close(t.done)
+	return t
+}
+
+func (t *token) Wait() bool                     { return true }
+func (t *token) WaitTimeout(time.Duration) bool { return true }
+func (t *token) Done() <-chan struct{}          { return t.done }
+func (t *token) Error() error                   { return t.err }
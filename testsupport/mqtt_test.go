@@ -0,0 +1,149 @@
+package testsupport
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/b", "a/b/c", false},
+		{"a/b/c", "a/b", false},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"+/+/c", "a/b/c", true},
+		{"a/+/c", "a/b/d", false},
+		{"a/#", "a/b/c", true},
+		// "#" matches the parent level too.
+		{"a/#", "a", true},
+		{"#", "a/b", true},
+		{"a/+", "a/", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		if got := match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("match(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+// receive returns a handler sending payloads of messages received to the returned channel.
+func receive() (mqtt.MessageHandler, <-chan string) {
+	ch := make(chan string, 10)
+	return func(_ mqtt.Client, msg mqtt.Message) { ch <- string(msg.Payload()) }, ch
+}
+
+func expect(t *testing.T, ch <-chan string, want string) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Fatalf("received %q, want %q", got, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %q", want)
+	}
+}
+
+func expectNone(t *testing.T, ch <-chan string) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		t.Fatalf("received %q, want none", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	pub, sub := b.NewClient(), b.NewClient()
+	defer pub.Disconnect(0)
+	defer sub.Disconnect(0)
+
+	if err := pub.Publish("retained/a", 1, true, "1").Error(); err != nil {
+		t.Fatal(err)
+	}
+	handler, ch := receive()
+	if err := sub.Subscribe("retained/+", 1, handler).Error(); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, ch, "1")
+
+	// Retained message is cleared by empty payload, which is delivered too.
+	pub.Publish("retained/a", 1, true, "")
+	expect(t, ch, "")
+	if msgs := b.retainedMessages("#"); len(msgs) != 0 {
+		t.Fatalf("retained %d messages, want none", len(msgs))
+	}
+
+	pub.Publish("retained/b", 1, false, []byte("2"))
+	expect(t, ch, "2")
+
+	sub.Unsubscribe("retained/+")
+	pub.Publish("retained/b", 1, false, "3")
+	expectNone(t, ch)
+}
+
+func TestClientDisconnect(t *testing.T) {
+	b := NewBroker()
+	pub, sub := b.NewClient(), b.NewClient()
+	defer pub.Disconnect(0)
+
+	handler, ch := receive()
+	sub.Subscribe("a", 1, handler)
+	sub.Disconnect(0)
+	// Disconnecting twice is a no-op.
+	sub.Disconnect(0)
+	if sub.IsConnected() || len(sub.Subscriptions()) != 0 {
+		t.Fatal("client is still connected or subscribed after disconnected")
+	}
+	b.mu.RLock()
+	_, ok := b.clients[sub]
+	b.mu.RUnlock()
+	if ok {
+		t.Fatal("client is kept by broker after disconnected")
+	}
+	if err := sub.Publish("a", 1, false, "1").Error(); err != mqtt.ErrNotConnected {
+		t.Fatalf("Publish() error = %v, want %v", err, mqtt.ErrNotConnected)
+	}
+	if err := sub.Subscribe("a", 1, handler).Error(); err != mqtt.ErrNotConnected {
+		t.Fatalf("Subscribe() error = %v, want %v", err, mqtt.ErrNotConnected)
+	}
+	pub.Publish("a", 1, false, "1")
+	expectNone(t, ch)
+
+	// Messages are delivered again after reconnected and subscribed.
+	sub.Connect()
+	defer sub.Disconnect(0)
+	sub.Subscribe("a", 1, handler)
+	pub.Publish("a", 1, false, "2")
+	expect(t, ch, "2")
+}
+
+// TestClientDisconnectInHandler tests a handler may disconnect its client, which stops the delivering goroutine.
+func TestClientDisconnectInHandler(t *testing.T) {
+	b := NewBroker()
+	c := b.NewClient()
+
+	done := make(chan struct{})
+	c.Subscribe("a", 1, func(client mqtt.Client, _ mqtt.Message) {
+		client.Disconnect(0)
+		close(done)
+	})
+	c.Publish("a", 1, false, "1")
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+	if c.IsConnected() {
+		t.Fatal("client is still connected")
+	}
+}
@@ -0,0 +1,43 @@
+package testsupport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/SB-IM/skywalker/internal/broadcast/signalclient"
+)
+
+// SignalClient is a WebSocket signaling client of a handler served in process.
+type SignalClient struct {
+	*signalclient.Client
+
+	server *httptest.Server
+}
+
+// NewSignalClient serves handler, e.g. returned by subscriber, and connects to path of it,
+// which may carry query like "/v1/broadcast/signal?token=xxx".
+func NewSignalClient(ctx context.Context, handler http.Handler, path string) (*SignalClient, error) {
+	server := httptest.NewServer(handler)
+	client, err := signalclient.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+path)
+	if err != nil {
+		server.Close()
+		return nil, err
+	}
+	return &SignalClient{
+		Client: client,
+		server: server,
+	}, nil
+}
+
+// URL returns base URL of the in-process server, e.g. for calling HTTP APIs of the same handler.
+func (c *SignalClient) URL() string {
+	return c.server.URL
+}
+
+// Close closes connection and the server.
+func (c *SignalClient) Close() error {
+	defer c.server.Close()
+	return c.Client.Close()
+}
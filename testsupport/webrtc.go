@@ -0,0 +1,108 @@
+package testsupport
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/logging"
+	"github.com/pion/transport/vnet"
+	"github.com/pion/webrtc/v3"
+
+	webrtcx "github.com/SB-IM/skywalker/internal/broadcast/webrtc"
+)
+
+// cidr is the virtual network of peers, each peer connection gets a host of it.
+const cidr = "10.0.0.0/16"
+
+// PeerFactory creates peer connections on hosts of a virtual network, with codecs, header extensions and
+// interceptors of this server. Peer connections of edges and viewers in tests are created by it too,
+// so they connect to ones of the server. It's safe for concurrent use.
+type PeerFactory struct {
+	router *vnet.Router
+
+	mu    sync.Mutex
+	hosts int
+}
+
+var _ webrtcx.PeerFactory = (*PeerFactory)(nil)
+
+// NewPeerFactory returns a new PeerFactory of a started virtual network, it must be closed after use.
+func NewPeerFactory() (*PeerFactory, error) {
+	router, err := vnet.NewRouter(&vnet.RouterConfig{
+		CIDR:          cidr,
+		LoggerFactory: logging.NewDefaultLoggerFactory(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not create virtual router: %w", err)
+	}
+	if err := router.Start(); err != nil {
+		return nil, fmt.Errorf("could not start virtual router: %w", err)
+	}
+	return &PeerFactory{router: router}, nil
+}
+
+// NewPeerConnection creates a peer connection on a new host of the virtual network.
+func (f *PeerFactory) NewPeerConnection(configuration webrtc.Configuration) (*webrtc.PeerConnection, error) {
+	f.mu.Lock()
+	f.hosts++
+	ip := fmt.Sprintf("10.0.%d.%d", f.hosts/254, f.hosts%254+1)
+	f.mu.Unlock()
+
+	nw := vnet.NewNet(&vnet.NetConfig{StaticIPs: []string{ip}})
+	if err := f.router.AddNet(nw); err != nil {
+		return nil, fmt.Errorf("could not add host %s: %w", ip, err)
+	}
+	m := &webrtc.MediaEngine{}
+	i := &interceptor.Registry{}
+	if err := webrtcx.RegisterMedia(m, i); err != nil {
+		return nil, err
+	}
+	s := webrtc.SettingEngine{}
+	s.SetVNet(nw)
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i), webrtc.WithSettingEngine(s))
+	return api.NewPeerConnection(configuration)
+}
+
+// Close stops the virtual network, it must be called after peer connections are closed.
+func (f *PeerFactory) Close() error {
+	return f.router.Stop()
+}
+
+// TrackSink records RTP packets forwarded to it. It's safe for concurrent use.
+type TrackSink struct {
+	mu      sync.Mutex
+	packets [][]byte
+	written chan struct{}
+}
+
+var _ webrtcx.TrackSink = (*TrackSink)(nil)
+
+// NewTrackSink returns a new TrackSink.
+func NewTrackSink() *TrackSink {
+	return &TrackSink{written: make(chan struct{}, 1)}
+}
+
+// Forward records a copy of packet b.
+func (s *TrackSink) Forward(b []byte) error {
+	s.mu.Lock()
+	s.packets = append(s.packets, append([]byte(nil), b...))
+	s.mu.Unlock()
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Packets returns packets recorded so far, in order written.
+func (s *TrackSink) Packets() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.packets...)
+}
+
+// Written returns a channel receiving once packets are written since the last receive.
+func (s *TrackSink) Written() <-chan struct{} {
+	return s.written
+}